@@ -0,0 +1 @@
+package _fab
@@ -0,0 +1,129 @@
+package fab
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// SetDefault sets the name of the default target,
+// which the fab command runs when no target is named on the command line.
+// It may be any name accepted by [Controller.ParseArgs].
+//
+// The default target may also be set in the top-level fab.yaml file
+// with the _default declaration.
+//
+// Example:
+//
+//	_default: Build
+func (con *Controller) SetDefault(name string) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	con.defaultName = name
+}
+
+// Default returns the name of the default target
+// set with [Controller.SetDefault],
+// or the empty string if there is none.
+func (con *Controller) Default() string {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	return con.defaultName
+}
+
+// SetAlias makes alias a short name for the target named name,
+// which may be any name accepted by [Controller.ParseArgs].
+//
+// Aliases may also be set in the top-level fab.yaml file
+// with the _aliases declaration.
+//
+// Example:
+//
+//	_aliases:
+//	  b: Build
+//	  t: Test
+func (con *Controller) SetAlias(alias, name string) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	if con.aliases == nil {
+		con.aliases = make(map[string]string)
+	}
+	con.aliases[alias] = name
+}
+
+// alias returns the name for which the given alias is a short name,
+// and a boolean telling whether it is an alias.
+func (con *Controller) alias(alias string) (string, bool) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	name, ok := con.aliases[alias]
+	return name, ok
+}
+
+// listAliases writes the aliases and the default target, if any,
+// for [Controller.ListTargets].
+func (con *Controller) listAliases(w io.Writer) {
+	con.mu.Lock()
+	var (
+		dflt    = con.defaultName
+		aliases = make([]string, 0, len(con.aliases))
+		names   = make(map[string]string, len(con.aliases))
+	)
+	for alias, name := range con.aliases {
+		aliases = append(aliases, alias)
+		names[alias] = name
+	}
+	con.mu.Unlock()
+
+	sort.Strings(aliases)
+
+	if dflt != "" {
+		fmt.Fprintf(w, "\nDefault: %s\n", dflt)
+	}
+	if len(aliases) > 0 {
+		fmt.Fprint(w, "\nAliases:\n")
+		for _, alias := range aliases {
+			fmt.Fprintf(w, "    %s -> %s\n", alias, names[alias])
+		}
+	}
+}
+
+// readDefaultDecl handles the _default declaration in a top-level fab.yaml file.
+// See [Controller.SetDefault].
+func (con *Controller) readDefaultDecl(node *yaml.Node, dir string) error {
+	if dir != "" {
+		return fmt.Errorf("_default declaration is allowed only in the top-level YAML file")
+	}
+	if node.Kind != yaml.ScalarNode {
+		return BadYAMLNodeKindError{Got: node.Kind, Want: yaml.ScalarNode}
+	}
+	con.SetDefault(node.Value)
+	return nil
+}
+
+// readAliasesDecl handles the _aliases declaration in a top-level fab.yaml file.
+// See [Controller.SetAlias].
+func (con *Controller) readAliasesDecl(node *yaml.Node, dir string) error {
+	if dir != "" {
+		return fmt.Errorf("_aliases declaration is allowed only in the top-level YAML file")
+	}
+	if node.Kind != yaml.MappingNode {
+		return BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var aliases map[string]string
+	if err := node.Decode(&aliases); err != nil {
+		return errors.Wrap(err, "decoding _aliases declaration")
+	}
+	for alias, name := range aliases {
+		con.SetAlias(alias, name)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package fab
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAliases(t *testing.T) {
+	t.Parallel()
+
+	const yml = `
+_default: Build
+
+_aliases:
+  b: Build
+  t: Test
+
+# Build builds.
+Build: !Command
+  Shell: "true"
+
+Test: !Command
+  Shell: "true"
+`
+
+	con := NewController("")
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := con.Default(); got != "Build" {
+		t.Errorf("got default %q, want Build", got)
+	}
+
+	var (
+		build, _ = con.RegistryTarget("Build")
+		test, _  = con.RegistryTarget("Test")
+	)
+
+	targets, err := con.ParseArgs([]string{"b", "t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 || targets[0] != build || targets[1] != test {
+		t.Errorf("got %v, want [%v %v]", targets, build, test)
+	}
+
+	buf := new(bytes.Buffer)
+	con.ListTargets(buf)
+	const wantList = `Build
+    Build builds.
+Test
+
+Default: Build
+
+Aliases:
+    b -> Build
+    t -> Test
+`
+	if got := buf.String(); got != wantList {
+		t.Errorf("got list:\n%s\nwant:\n%s", got, wantList)
+	}
+}
@@ -38,6 +38,11 @@ func (*all) Desc() string {
 	return "All"
 }
 
+// Children implements GraphChildren.
+func (a *all) Children() []Target {
+	return a.Targets
+}
+
 func allDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
 	if node.Kind != yaml.SequenceNode {
 		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.SequenceNode}
@@ -54,4 +59,5 @@ func allDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
 
 func init() {
 	RegisterYAMLTarget("All", allDecoder)
+	SetYAMLTagDoc("All", "Run targets concurrently.")
 }
@@ -0,0 +1,504 @@
+package fab
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+	"gopkg.in/yaml.v3"
+)
+
+// archiveTime is the modification time given to every entry in archives made by [Tar] and [Zip],
+// so that the same files always produce the same archive.
+// It is the earliest time representable in a zip file.
+var archiveTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Tar creates a target that writes a tar archive to the file out.
+// If out ends in .gz or .tgz,
+// the archive is compressed with gzip.
+//
+// The archive contains the given files,
+// which are relative to dir.
+// Any that are directories are included recursively.
+// Entries in the archive are named relative to dir too.
+//
+// The archive is deterministic:
+// its entries are sorted by name,
+// and their modification times, owners, and permissions are normalized,
+// so the same files always produce the same archive.
+//
+// The result is a [Files] target,
+// so it runs only when its inputs or output have changed.
+// Any opts are applied as they are in Files.
+//
+// A Tar target may be specified in YAML using the !Tar tag,
+// which introduces a mapping whose fields are:
+//
+//   - Out: the archive file
+//   - Dir: the directory containing the files to archive (default: the directory containing the YAML file)
+//   - Files: a list of files and directories to archive, relative to Dir
+//
+// Out and Dir are either absolute or relative to the directory containing the YAML file.
+func Tar(out, dir string, files []string, opts ...FilesOpt) Target {
+	return newArchive("tar", out, dir, files, opts...)
+}
+
+// Zip is like [Tar] but produces a zip file.
+//
+// A Zip target may be specified in YAML using the !Zip tag,
+// with the same fields as !Tar.
+func Zip(out, dir string, files []string, opts ...FilesOpt) Target {
+	return newArchive("zip", out, dir, files, opts...)
+}
+
+func newArchive(format, out, dir string, names []string, opts ...FilesOpt) Target {
+	in := make([]string, 0, len(names))
+	for _, name := range names {
+		in = append(in, filepath.Join(dir, name))
+	}
+	a := &archive{Format: format, Out: out, Dir: dir, Files: names}
+	result := Files(a, in, []string{out}, opts...)
+	result.(*files).desc = a.Desc()
+	return result
+}
+
+type archive struct {
+	Format string   `json:"format"`
+	Out    string   `json:"out"`
+	Dir    string   `json:"dir"`
+	Files  []string `json:"files"`
+}
+
+var _ Target = &archive{}
+
+// Run implements Target.Run.
+func (a *archive) Run(ctx context.Context, con *Controller) error {
+	if GetDryRun(ctx) {
+		if GetVerbose(ctx) {
+			con.Indentf("  Would write %s", a.Out)
+		}
+		return nil
+	}
+
+	entries, err := a.entries()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.Out), 0755); err != nil {
+		return errors.Wrapf(err, "creating directory for %s", a.Out)
+	}
+	f, err := os.Create(a.Out)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", a.Out)
+	}
+	defer f.Close()
+
+	if a.Format == "zip" {
+		err = a.writeZip(f, entries)
+	} else {
+		err = a.writeTar(f, entries)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "writing %s", a.Out)
+	}
+	return errors.Wrapf(f.Close(), "closing %s", a.Out)
+}
+
+// Desc implements Target.Desc.
+func (a *archive) Desc() string {
+	if a.Format == "zip" {
+		return "Zip"
+	}
+	return "Tar"
+}
+
+// archiveEntry is a file or directory to add to an archive.
+type archiveEntry struct {
+	name  string // slash-separated, relative to the archive's Dir
+	path  string // the file itself
+	isDir bool
+	mode  fs.FileMode // normalized permissions
+	size  int64
+}
+
+// entries returns the sorted entries to put in the archive.
+func (a *archive) entries() ([]archiveEntry, error) {
+	var (
+		result []archiveEntry
+		seen   = set.New[string]()
+	)
+	for _, file := range a.Files {
+		root := filepath.Join(a.Dir, file)
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(a.Dir, p)
+			if err != nil {
+				return errors.Wrapf(err, "getting relative path to %s", p)
+			}
+			name := filepath.ToSlash(rel)
+			if seen.Has(name) {
+				return nil
+			}
+			seen.Add(name)
+
+			info, err := d.Info()
+			if err != nil {
+				return errors.Wrapf(err, "statting %s", p)
+			}
+			e := archiveEntry{name: name, path: p, mode: 0644}
+			switch {
+			case info.IsDir():
+				e.isDir, e.mode = true, 0755
+			case info.Mode().IsRegular():
+				e.size = info.Size()
+				if info.Mode()&0111 != 0 {
+					e.mode = 0755
+				}
+			default:
+				return fmt.Errorf("cannot archive %s: unsupported file type %s", p, info.Mode().Type())
+			}
+			result = append(result, e)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "walking %s", root)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result, nil
+}
+
+func (a *archive) writeTar(w io.Writer, entries []archiveEntry) error {
+	if strings.HasSuffix(a.Out, ".gz") || strings.HasSuffix(a.Out, ".tgz") {
+		gw := gzip.NewWriter(w)
+		defer gw.Close()
+		w = gw
+	}
+
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:    e.name,
+			Mode:    int64(e.mode),
+			Size:    e.size,
+			ModTime: archiveTime,
+			Format:  tar.FormatPAX,
+		}
+		if e.isDir {
+			hdr.Typeflag, hdr.Name = tar.TypeDir, e.name+"/"
+		} else {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return errors.Wrapf(err, "writing header for %s", e.name)
+		}
+		if e.isDir {
+			continue
+		}
+		if err := copyFileTo(tw, e.path); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return errors.Wrap(err, "closing tar writer")
+	}
+	if gw, ok := w.(*gzip.Writer); ok {
+		return errors.Wrap(gw.Close(), "closing gzip writer")
+	}
+	return nil
+}
+
+func (a *archive) writeZip(w io.Writer, entries []archiveEntry) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{
+			Name:     e.name,
+			Method:   zip.Deflate,
+			Modified: archiveTime,
+		}
+		hdr.SetMode(e.mode)
+		if e.isDir {
+			hdr.Name, hdr.Method = e.name+"/", zip.Store
+			hdr.SetMode(fs.ModeDir | e.mode)
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return errors.Wrapf(err, "writing header for %s", e.name)
+		}
+		if e.isDir {
+			continue
+		}
+		if err := copyFileTo(fw, e.path); err != nil {
+			return err
+		}
+	}
+	return errors.Wrap(zw.Close(), "closing zip writer")
+}
+
+func copyFileTo(w io.Writer, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", filename)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return errors.Wrapf(err, "copying %s", filename)
+}
+
+// Untar creates a target that extracts the tar archive in the file archive
+// into the directory dir.
+// If the archive file name ends in .gz or .tgz,
+// it is decompressed with gzip.
+//
+// Entries whose names would place them outside dir are rejected.
+//
+// The result is a [Files] target
+// whose input is the archive and whose output is dir,
+// so it runs only when one of those has changed.
+// Any opts are applied as they are in Files.
+//
+// An Untar target may be specified in YAML using the !Untar tag,
+// which introduces a mapping whose fields are:
+//
+//   - Archive: the archive file
+//   - Dir: the directory in which to extract the archive
+//
+// Both are either absolute or relative to the directory containing the YAML file.
+func Untar(archive, dir string, opts ...FilesOpt) Target {
+	return newExtract("tar", archive, dir, opts...)
+}
+
+// Unzip is like [Untar] but extracts a zip file.
+//
+// An Unzip target may be specified in YAML using the !Unzip tag,
+// with the same fields as !Untar.
+func Unzip(archive, dir string, opts ...FilesOpt) Target {
+	return newExtract("zip", archive, dir, opts...)
+}
+
+func newExtract(format, archive, dir string, opts ...FilesOpt) Target {
+	x := &extract{Format: format, Archive: archive, Dir: dir}
+	result := Files(x, []string{archive}, []string{dir}, opts...)
+	result.(*files).desc = x.Desc()
+	return result
+}
+
+type extract struct {
+	Format  string `json:"format"`
+	Archive string `json:"archive"`
+	Dir     string `json:"dir"`
+}
+
+var _ Target = &extract{}
+
+// Run implements Target.Run.
+func (x *extract) Run(ctx context.Context, con *Controller) error {
+	if GetDryRun(ctx) {
+		if GetVerbose(ctx) {
+			con.Indentf("  Would extract %s into %s", x.Archive, x.Dir)
+		}
+		return nil
+	}
+
+	var err error
+	if x.Format == "zip" {
+		err = x.unzip()
+	} else {
+		err = x.untar()
+	}
+	return errors.Wrapf(err, "extracting %s", x.Archive)
+}
+
+// Desc implements Target.Desc.
+func (x *extract) Desc() string {
+	if x.Format == "zip" {
+		return "Unzip"
+	}
+	return "Untar"
+}
+
+func (x *extract) untar() error {
+	f, err := os.Open(x.Archive)
+	if err != nil {
+		return errors.Wrap(err, "opening archive")
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(x.Archive, ".gz") || strings.HasSuffix(x.Archive, ".tgz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return errors.Wrap(err, "reading gzip header")
+		}
+		defer gr.Close()
+		r = gr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "reading archive")
+		}
+
+		dest, err := x.dest(hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return errors.Wrapf(err, "creating directory %s", dest)
+			}
+		case tar.TypeReg:
+			if err := writeExtracted(dest, tr, fs.FileMode(hdr.Mode).Perm()); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported entry type %c for %s", hdr.Typeflag, hdr.Name)
+		}
+	}
+}
+
+func (x *extract) unzip() error {
+	zr, err := zip.OpenReader(x.Archive)
+	if err != nil {
+		return errors.Wrap(err, "opening archive")
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		dest, err := x.dest(zf.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := zf.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return errors.Wrapf(err, "creating directory %s", dest)
+			}
+		case mode.IsRegular():
+			r, err := zf.Open()
+			if err != nil {
+				return errors.Wrapf(err, "opening %s in archive", zf.Name)
+			}
+			err = writeExtracted(dest, r, mode.Perm())
+			r.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported entry type %s for %s", mode.Type(), zf.Name)
+		}
+	}
+	return nil
+}
+
+// dest returns the path at which to extract the archive entry with the given name.
+func (x *extract) dest(name string) (string, error) {
+	rel := filepath.FromSlash(name)
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("invalid entry name %s", name)
+	}
+	return filepath.Join(x.Dir, rel), nil
+}
+
+func writeExtracted(dest string, r io.Reader, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return errors.Wrapf(err, "creating directory for %s", dest)
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", dest)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return errors.Wrapf(err, "writing %s", dest)
+	}
+	return errors.Wrapf(f.Close(), "closing %s", dest)
+}
+
+func archiveDecoder(format, tag string) YAMLTargetFunc {
+	return func(con *Controller, node *yaml.Node, dir string) (Target, error) {
+		if node.Kind != yaml.MappingNode {
+			return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+		}
+
+		var yarchive struct {
+			Out   string    `yaml:"Out"`
+			Dir   string    `yaml:"Dir"`
+			Files yaml.Node `yaml:"Files"`
+		}
+		if err := node.Decode(&yarchive); err != nil {
+			return nil, errors.Wrapf(err, "YAML error in %s node", tag)
+		}
+		if yarchive.Out == "" {
+			return nil, fmt.Errorf("%s node requires Out", tag)
+		}
+
+		names, err := con.YAMLStringList(&yarchive.Files, dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "YAML error in %s.Files node", tag)
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("%s node requires Files", tag)
+		}
+
+		return newArchive(format, con.JoinPath(dir, yarchive.Out), con.JoinPath(dir, yarchive.Dir), names), nil
+	}
+}
+
+func extractDecoder(format, tag string) YAMLTargetFunc {
+	return func(con *Controller, node *yaml.Node, dir string) (Target, error) {
+		if node.Kind != yaml.MappingNode {
+			return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+		}
+
+		var yextract struct {
+			Archive string `yaml:"Archive"`
+			Dir     string `yaml:"Dir"`
+		}
+		if err := node.Decode(&yextract); err != nil {
+			return nil, errors.Wrapf(err, "YAML error in %s node", tag)
+		}
+		if yextract.Archive == "" || yextract.Dir == "" {
+			return nil, fmt.Errorf("%s node requires Archive and Dir", tag)
+		}
+
+		return newExtract(format, con.JoinPath(dir, yextract.Archive), con.JoinPath(dir, yextract.Dir)), nil
+	}
+}
+
+func init() {
+	RegisterYAMLTarget("Tar", archiveDecoder("tar", "Tar"))
+	SetYAMLTagDoc("Tar", "Create a tar archive.")
+	RegisterYAMLTarget("Zip", archiveDecoder("zip", "Zip"))
+	SetYAMLTagDoc("Zip", "Create a zip archive.")
+	RegisterYAMLTarget("Untar", extractDecoder("tar", "Untar"))
+	SetYAMLTagDoc("Untar", "Extract a tar archive.")
+	RegisterYAMLTarget("Unzip", extractDecoder("zip", "Unzip"))
+	SetYAMLTagDoc("Unzip", "Extract a zip archive.")
+}
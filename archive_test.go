@@ -0,0 +1,211 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestArchive(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name       string
+		archive    func(out, dir string, files []string, opts ...FilesOpt) Target
+		extract    func(archive, dir string, opts ...FilesOpt) Target
+		out, other string
+	}{{
+		name:    "tar",
+		archive: Tar,
+		extract: Untar,
+		out:     "a.tar.gz",
+		other:   "b.tgz",
+	}, {
+		name:    "zip",
+		archive: Zip,
+		extract: Unzip,
+		out:     "a.zip",
+		other:   "b.zip",
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmpdir, err := os.MkdirTemp("", "fab")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmpdir)
+
+			src := filepath.Join(tmpdir, "src")
+			files := map[string]string{
+				"README":    "hello\n",
+				"bin/tool":  "#!/bin/sh\necho tool\n",
+				"lib/a.txt": "a\n",
+				"lib/b.txt": "b\n",
+			}
+			for name, content := range files {
+				p := filepath.Join(src, name)
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Chmod(filepath.Join(src, "bin/tool"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			ctx = WithVerbose(ctx, testing.Verbose())
+			ctx = WithHashDB(ctx, memdb(set.New[string]()))
+
+			out := filepath.Join(tmpdir, "dist", tc.out)
+			if err := NewController(tmpdir).Run(ctx, tc.archive(out, src, []string{"lib", "bin", "README"})); err != nil {
+				t.Fatal(err)
+			}
+
+			// Touching the inputs and listing them in a different order
+			// must produce the same bytes.
+			if err := os.Chtimes(filepath.Join(src, "lib/a.txt"), archiveTime, archiveTime); err != nil {
+				t.Fatal(err)
+			}
+			other := filepath.Join(tmpdir, "dist", tc.other)
+			if err := NewController(tmpdir).Run(ctx, tc.archive(other, src, []string{"README", "bin", "lib"})); err != nil {
+				t.Fatal(err)
+			}
+			got1, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got2, err := os.ReadFile(other)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got1, got2) {
+				t.Error("archives of the same files differ")
+			}
+
+			dest := filepath.Join(tmpdir, "dest")
+			if err := NewController(tmpdir).Run(ctx, tc.extract(out, dest)); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range files {
+				got, err := os.ReadFile(filepath.Join(dest, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("got %q for %s, want %q", got, name, want)
+				}
+			}
+			info, err := os.Stat(filepath.Join(dest, "bin/tool"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode()&0100 == 0 {
+				t.Errorf("bin/tool has mode %s, want executable", info.Mode())
+			}
+		})
+	}
+}
+
+func TestArchiveYAML(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	if err := os.MkdirAll(filepath.Join(tmpdir, "build"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpdir, "build", "x"), []byte("x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const yml = `
+Pack: !Zip
+  Out: dist/x.zip
+  Dir: build
+  Files: [x]
+
+Unpack: !Unzip
+  Archive: dist/x.zip
+  Dir: out
+`
+
+	con := NewController(tmpdir)
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	pack, _ := con.RegistryTarget("Pack")
+	unpack, _ := con.RegistryTarget("Unpack")
+
+	ctx := context.Background()
+	ctx = WithHashDB(ctx, memdb(set.New[string]()))
+
+	if err := con.Run(ctx, pack); err != nil {
+		t.Fatal(err)
+	}
+	if err := con.Run(ctx, unpack); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(tmpdir, "out", "x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "x\n" {
+		t.Errorf("got %q, want %q", got, "x\n")
+	}
+}
+
+func TestExtractDest(t *testing.T) {
+	t.Parallel()
+
+	x := &extract{Dir: "out"}
+	for _, tc := range []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{{
+		name: "a/b",
+		want: filepath.Join("out", "a", "b"),
+	}, {
+		name: "./a/",
+		want: filepath.Join("out", "a"),
+	}, {
+		name:    "../a",
+		wantErr: true,
+	}, {
+		name:    "/etc/passwd",
+		wantErr: true,
+	}, {
+		name:    "a/../../b",
+		wantErr: true,
+	}} {
+		got, err := x.dest(tc.name)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %s, want error", tc.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
@@ -38,9 +38,30 @@ type argTarget struct {
 var _ Target = &argTarget{}
 
 // Run implements Target.Run.
+// If the subtarget was registered with parameters (see [WithParams]),
+// they are parsed from the arguments,
+// and only the remaining arguments are passed on.
 func (a *argTarget) Run(ctx context.Context, con *Controller) error {
-	ctx = WithArgs(ctx, a.Args...)
-	return con.Run(ctx, a.Target)
+	target := a.Target
+	if d, ok := target.(*deferredResolutionTarget); ok {
+		var err error
+		if target, err = d.resolve(con); err != nil {
+			return err
+		}
+	}
+
+	args := a.Args
+	if params := con.targetParams(target); len(params) > 0 {
+		values, rest, err := parseParams(params, args)
+		if err != nil {
+			return errors.Wrapf(err, "parsing parameters of %s", con.Describe(target))
+		}
+		ctx = withParams(ctx, values)
+		args = rest
+	}
+
+	ctx = WithArgs(ctx, args...)
+	return con.Run(ctx, target)
 }
 
 // Desc implements Target.Desc.
@@ -48,6 +69,11 @@ func (*argTarget) Desc() string {
 	return "ArgTarget"
 }
 
+// Children implements GraphChildren.
+func (a *argTarget) Children() []Target {
+	return []Target{a.Target}
+}
+
 func argTargetDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
 	if node.Kind != yaml.SequenceNode {
 		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.SequenceNode}
@@ -70,4 +96,5 @@ func argTargetDecoder(con *Controller, node *yaml.Node, dir string) (Target, err
 
 func init() {
 	RegisterYAMLTarget("ArgTarget", argTargetDecoder)
+	SetYAMLTagDoc("ArgTarget", "Run a target with a list of command-line arguments.")
 }
@@ -0,0 +1,387 @@
+package fab
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+	json "github.com/gibson042/canonicaljson-go"
+)
+
+// ArtifactStore is the type of a content-addressed store for the output files of [Files] targets.
+// It must permit concurrent operations safely.
+//
+// When a Files target runs successfully,
+// its output files are saved in the store
+// under a key computed from the target and its input files.
+// Later,
+// when the same Files target runs with the same inputs
+// but its outputs are missing or different
+// (e.g. in a fresh checkout, or on a CI worker),
+// the outputs are restored from the store
+// instead of running the target's subtarget.
+//
+// Use [WithArtifactStore] to enable this behavior.
+type ArtifactStore interface {
+	// Get returns a reader for the artifact with the given key,
+	// or nil if there is no such artifact.
+	// Callers must close a non-nil result when finished with it.
+	Get(context.Context, []byte) (io.ReadCloser, error)
+
+	// Put stores the artifact with the given key,
+	// reading its contents from the given reader.
+	Put(context.Context, []byte, io.Reader) error
+}
+
+// DirArtifactStore is an [ArtifactStore] that keeps artifacts in files in a directory.
+// The directory may be on a shared filesystem.
+type DirArtifactStore struct {
+	Dir string
+}
+
+var _ ArtifactStore = DirArtifactStore{}
+
+// Get implements ArtifactStore.Get.
+func (s DirArtifactStore) Get(_ context.Context, key []byte) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return f, err
+}
+
+// Put implements ArtifactStore.Put.
+func (s DirArtifactStore) Put(_ context.Context, key []byte, r io.Reader) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return errors.Wrapf(err, "creating directory %s", s.Dir)
+	}
+
+	// Write to a temp file and rename it into place,
+	// so concurrent readers never see a partial artifact.
+	tmp, err := os.CreateTemp(s.Dir, "tmp")
+	if err != nil {
+		return errors.Wrap(err, "creating temp file")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err = io.Copy(tmp, r); err != nil {
+		return errors.Wrapf(err, "writing %s", tmp.Name())
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrapf(err, "closing %s", tmp.Name())
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+func (s DirArtifactStore) path(key []byte) string {
+	return filepath.Join(s.Dir, hex.EncodeToString(key)+".tar")
+}
+
+// artifactKey computes the key under which the outputs of ft are stored in an [ArtifactStore].
+// Unlike computeHash, it does not depend on the output files.
+// File names are made relative to con's top directory where possible,
+// so that the key is the same in different checkouts of a project.
+func (ft *files) artifactKey(ctx context.Context, con *Controller) ([]byte, error) {
+	inHashes, err := fileHashes(ctx, ft.hashedIn(con), ft.exclude...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "computing input hash(es) for %s", con.Describe(ft))
+	}
+	for i := 0; i < len(inHashes); i += 2 {
+		inHashes[i] = con.artifactPath(inHashes[i])
+	}
+
+	target, err := targetHashValue(ft.Target)
+	if err != nil {
+		return nil, errors.Wrapf(err, "hashing subtarget of %s", con.Describe(ft))
+	}
+
+	env := ft.envHashInputs(ctx, con)
+	tools, err := ft.toolHashInputs(ctx, con)
+	if err != nil {
+		return nil, errors.Wrapf(err, "hashing tools of %s", con.Describe(ft))
+	}
+
+	s := struct {
+		Target     any      `json:"target"`
+		TargetType string   `json:"target_type"`
+		In         []string `json:"in,omitempty"` // [filename, hash, filename, hash, ...]
+		Out        []string `json:"out"`
+		Env        []string `json:"env,omitempty"`   // see HashEnv
+		Tools      []string `json:"tools,omitempty"` // see Command.HashTool
+	}{
+		Target:     target,
+		TargetType: reflect.TypeOf(ft.Target).String(),
+		In:         inHashes,
+		Env:        env,
+		Tools:      tools,
+	}
+	for _, out := range ft.Out {
+		s.Out = append(s.Out, con.artifactPath(out))
+	}
+
+	j, err := json.Marshal(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "in JSON marshaling")
+	}
+
+	sum := sha256.Sum224(j)
+	return sum[:], nil
+}
+
+func (con *Controller) artifactPath(file string) string {
+	if !filepath.IsAbs(file) || con.topdir == "" {
+		return file
+	}
+	if rel, err := filepath.Rel(con.topdir, file); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return file
+}
+
+// Provenance is a record of how an artifact was produced.
+// It is stored with the artifact in an [ArtifactStore]
+// and checked by [Promote].
+type Provenance struct {
+	// InputHash is the hex encoding of the artifact's key,
+	// which is a hash of the target that produced the artifact and its input files.
+	InputHash string `json:"input_hash"`
+
+	// Target describes the target that produced the artifact.
+	Target string `json:"target"`
+
+	// Inputs and Outputs are the input and output files of the target,
+	// relative to the project's top directory where possible.
+	Inputs  []string `json:"inputs,omitempty"`
+	Outputs []string `json:"outputs,omitempty"`
+
+	// Host is the name of the host on which the artifact was produced.
+	Host string `json:"host,omitempty"`
+
+	// Time is when the artifact was produced.
+	Time time.Time `json:"time"`
+}
+
+// provenanceEntry is the name of the tar entry holding an artifact's [Provenance].
+// It cannot collide with the names of output entries,
+// which begin with a number.
+const provenanceEntry = "provenance.json"
+
+// ReadProvenance reads the [Provenance] record
+// from an artifact in the format written to an [ArtifactStore].
+// It returns nil if the artifact has no provenance record.
+func ReadProvenance(r io.Reader) (*Provenance, error) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "reading artifact")
+		}
+		if hdr.Name != provenanceEntry {
+			continue
+		}
+
+		var p Provenance
+		if err := json.NewDecoder(tr).Decode(&p); err != nil {
+			return nil, errors.Wrap(err, "decoding provenance record")
+		}
+		return &p, nil
+	}
+}
+
+// saveArtifacts writes the output files of ft to the store as a tar archive,
+// preceded by a [Provenance] record.
+func (ft *files) saveArtifacts(ctx context.Context, con *Controller, store ArtifactStore, key []byte) error {
+	prov := Provenance{
+		InputHash: hex.EncodeToString(key),
+		Target:    con.Describe(ft),
+		Time:      time.Now(),
+	}
+	for _, in := range ft.In {
+		prov.Inputs = append(prov.Inputs, con.artifactPath(in))
+	}
+	for _, out := range ft.Out {
+		prov.Outputs = append(prov.Outputs, con.artifactPath(out))
+	}
+	prov.Host, _ = os.Hostname()
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := writeProvenance(tw, prov)
+		if err == nil {
+			err = ft.writeArtifacts(tw)
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	err := store.Put(ctx, key, pr)
+	pr.CloseWithError(err) // unblock the writer goroutine if Put failed early
+	return err
+}
+
+func writeProvenance(tw *tar.Writer, prov Provenance) error {
+	j, err := json.Marshal(prov)
+	if err != nil {
+		return errors.Wrap(err, "marshaling provenance record")
+	}
+	hdr := &tar.Header{
+		Name:     provenanceEntry,
+		Mode:     0644,
+		Size:     int64(len(j)),
+		ModTime:  prov.Time,
+		Typeflag: tar.TypeReg,
+	}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return errors.Wrap(err, "writing tar header for provenance record")
+	}
+	_, err = tw.Write(j)
+	return errors.Wrap(err, "writing provenance record")
+}
+
+// writeArtifacts writes the output files of ft to tw.
+// Each entry is named for the index of its output in ft.Out,
+// plus its relative path within that output if the output is a directory,
+// so the archive can be restored to a checkout in a different location.
+func (ft *files) writeArtifacts(tw *tar.Writer) error {
+	for i, out := range ft.Out {
+		err := filepath.WalkDir(out, func(file string, d fs.DirEntry, err error) error {
+			if file == out && errors.Is(err, fs.ErrNotExist) {
+				// Output was not produced.
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() && !info.IsDir() {
+				return nil
+			}
+
+			hdr, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return errors.Wrapf(err, "making tar header for %s", file)
+			}
+			rel, err := filepath.Rel(out, file)
+			if err != nil {
+				return errors.Wrapf(err, "getting relative path of %s", file)
+			}
+			hdr.Name = path.Join(strconv.Itoa(i), filepath.ToSlash(rel))
+			if err = tw.WriteHeader(hdr); err != nil {
+				return errors.Wrapf(err, "writing tar header for %s", file)
+			}
+			if info.IsDir() {
+				return nil
+			}
+
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			_, err = io.Copy(tw, f)
+			return errors.Wrapf(err, "archiving %s", file)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "archiving output %s", out)
+		}
+	}
+	return nil
+}
+
+// restoreArtifacts restores the output files of ft from the store.
+// It returns false if the store has no artifact with the given key.
+func (ft *files) restoreArtifacts(ctx context.Context, store ArtifactStore, key []byte) (bool, error) {
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		return false, errors.Wrap(err, "getting artifact")
+	}
+	if rc == nil {
+		return false, nil
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return true, nil
+		}
+		if err != nil {
+			return false, errors.Wrap(err, "reading artifact")
+		}
+		if hdr.Name == provenanceEntry {
+			continue
+		}
+
+		dest, err := ft.artifactDest(hdr.Name)
+		if err != nil {
+			return false, err
+		}
+
+		mode := hdr.FileInfo().Mode()
+		if mode.IsDir() {
+			if err = os.MkdirAll(dest, mode.Perm()|0700); err != nil {
+				return false, errors.Wrapf(err, "creating directory %s", dest)
+			}
+			continue
+		}
+
+		if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return false, errors.Wrapf(err, "creating directory for %s", dest)
+		}
+		if err = restoreFile(dest, mode.Perm(), tr); err != nil {
+			return false, errors.Wrapf(err, "restoring %s", dest)
+		}
+	}
+}
+
+// artifactDest maps the name of an entry written by writeArtifacts
+// to the file it should be restored to.
+func (ft *files) artifactDest(name string) (string, error) {
+	idxStr, rel, _ := strings.Cut(path.Clean(name), "/")
+	idx, err := strconv.Atoi(idxStr)
+	if err != nil || idx < 0 || idx >= len(ft.Out) {
+		return "", fmt.Errorf("bad artifact entry %s", name)
+	}
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("bad artifact entry %s", name)
+	}
+	return filepath.Join(ft.Out[idx], filepath.FromSlash(rel)), nil
+}
+
+func restoreFile(dest string, perm fs.FileMode, r io.Reader) error {
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(f, r); err != nil {
+		return err
+	}
+	return f.Close()
+}
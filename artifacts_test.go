@@ -0,0 +1,90 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestArtifacts(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		inpath  = filepath.Join(tmpdir, "in")
+		outdir  = filepath.Join(tmpdir, "out")
+		outpath = filepath.Join(outdir, "sub", "file")
+		logpath = filepath.Join(tmpdir, "log")
+		store   = DirArtifactStore{Dir: filepath.Join(tmpdir, "artifacts")}
+	)
+	if err = os.WriteFile(inpath, []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	target := Files(
+		Shellf("sh -c 'echo run >> %s; mkdir -p %s; cp %s %s'", logpath, filepath.Dir(outpath), inpath, outpath),
+		[]string{inpath},
+		[]string{outdir},
+	)
+
+	try := func(wantRuns int, wantOut string) {
+		t.Helper()
+
+		// A fresh hash DB each time simulates a different machine
+		// sharing only the artifact store.
+		ctx := context.Background()
+		ctx = WithVerbose(ctx, testing.Verbose())
+		ctx = WithHashDB(ctx, memdb(set.New[string]()))
+		ctx = WithArtifactStore(ctx, store)
+
+		con := NewController(tmpdir)
+		if err := con.Run(ctx, target); err != nil {
+			t.Fatal(err)
+		}
+
+		log, err := os.ReadFile(logpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runs := strings.Count(string(log), "run"); runs != wantRuns {
+			t.Errorf("got %d runs, want %d", runs, wantRuns)
+		}
+
+		got, err := os.ReadFile(outpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != wantOut {
+			t.Errorf("got output %q, want %q", string(got), wantOut)
+		}
+	}
+
+	try(1, "foo")
+
+	// Outputs missing: restored from the artifact store.
+	if err = os.RemoveAll(outdir); err != nil {
+		t.Fatal(err)
+	}
+	try(1, "foo")
+
+	// New inputs: rebuilt.
+	if err = os.WriteFile(inpath, []byte("bar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	try(2, "bar")
+
+	// Back to the old inputs, with stale outputs: restored again.
+	if err = os.WriteFile(inpath, []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	try(2, "foo")
+}
@@ -0,0 +1,146 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+)
+
+// AuditLogBasename is the name of the audit log in the fab directory
+// (see [WithFabdir]).
+// See [Controller.RunAudited].
+const AuditLogBasename = "audit.log"
+
+// AuditRecord is an entry in the audit log.
+// See [Controller.RunAudited].
+type AuditRecord struct {
+	Time     time.Time     `json:"time"`
+	User     string        `json:"user"`
+	Host     string        `json:"host"`
+	Dir      string        `json:"dir"`               // the project's top directory
+	GitSHA   string        `json:"git_sha,omitempty"` // the commit checked out in Dir, if it is in a git repository
+	Targets  []string      `json:"targets"`
+	DryRun   bool          `json:"dry_run,omitempty"`
+	Result   string        `json:"result"` // "ok" or "error"
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// RunAudited runs the given targets with [Controller.Run]
+// and then records who ran them, where, and with what result,
+// for environments that need to trace the running of deploy-type targets.
+//
+// The record is an [AuditRecord],
+// appended as a line of JSON to the file named by [AuditLogBasename]
+// in the fab directory
+// (if there is one, see [GetFabdir]).
+// If url is non-empty,
+// the record is also sent there in an HTTP POST request.
+//
+// Secrets are redacted from the error in the record
+// (see [Controller.AddSecrets]).
+// A failure to record the run is reported as an error,
+// together with any error from running the targets.
+func (con *Controller) RunAudited(ctx context.Context, url string, targets ...Target) error {
+	rec := con.newAuditRecord(ctx, targets)
+
+	err := con.Run(ctx, targets...)
+
+	rec.Duration = time.Since(rec.Time)
+	rec.Result = "ok"
+	if err != nil {
+		rec.Result = "error"
+		rec.Error = con.Redact(err.Error())
+	}
+
+	if fabdir := GetFabdir(ctx); fabdir != "" {
+		err = errors.Join(err, writeAuditLog(filepath.Join(fabdir, AuditLogBasename), rec))
+	}
+	if url != "" {
+		// Use a fresh context in case ctx has timed out.
+		err = errors.Join(err, postAuditRecord(context.Background(), url, rec))
+	}
+	return err
+}
+
+func (con *Controller) newAuditRecord(ctx context.Context, targets []Target) AuditRecord {
+	rec := AuditRecord{
+		Time:   time.Now(),
+		DryRun: GetDryRun(ctx),
+	}
+	if u, err := user.Current(); err == nil {
+		rec.User = u.Username
+	} else {
+		rec.User = os.Getenv("USER")
+	}
+	rec.Host, _ = os.Hostname()
+	if dir, err := filepath.Abs(con.JoinPath()); err == nil {
+		rec.Dir = dir
+	}
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "HEAD")
+	cmd.Dir = con.JoinPath()
+	if out, err := cmd.Output(); err == nil {
+		rec.GitSHA = strings.TrimSpace(string(out))
+	}
+	for _, target := range targets {
+		rec.Targets = append(rec.Targets, con.Describe(target))
+	}
+	return rec
+}
+
+// writeAuditLog appends rec to the audit log in filename.
+func writeAuditLog(filename string, rec AuditRecord) error {
+	j, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "encoding audit record")
+	}
+	if err := mkdirParent(filename); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "opening audit log %s", filename)
+	}
+	defer f.Close()
+
+	// A single write in append mode,
+	// so that concurrent fab processes do not interleave their records.
+	if _, err := f.Write(append(j, '\n')); err != nil {
+		return errors.Wrapf(err, "writing audit log %s", filename)
+	}
+	return errors.Wrapf(f.Close(), "closing audit log %s", filename)
+}
+
+// postAuditRecord sends rec to url as JSON in an HTTP POST request.
+func postAuditRecord(ctx context.Context, url string, rec AuditRecord) error {
+	j, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "encoding audit record")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(j))
+	if err != nil {
+		return errors.Wrap(err, "creating audit request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "sending audit record to %s", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sending audit record to %s: status %d", url, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package fab
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunAudited(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var posted []AuditRecord
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var rec AuditRecord
+		if err := json.NewDecoder(req.Body).Decode(&rec); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		posted = append(posted, rec)
+	}))
+	defer srv.Close()
+
+	var (
+		fabdir = filepath.Join(tmpdir, "fab")
+		ctx    = WithFabdir(context.Background(), fabdir)
+		con    = NewController(tmpdir)
+	)
+	con.AddSecrets("hunter2")
+
+	ok := &Command{Shell: "true"}
+	if _, err := con.RegisterTarget("Deploy", "", ok); err != nil {
+		t.Fatal(err)
+	}
+	bad := F(func(context.Context, *Controller) error {
+		return fmt.Errorf("bad password hunter2")
+	})
+
+	if err := con.RunAudited(ctx, srv.URL, ok); err != nil {
+		t.Fatal(err)
+	}
+	if err := con.RunAudited(ctx, "", bad); err == nil {
+		t.Fatal("got no error from failing target")
+	}
+
+	f, err := os.Open(filepath.Join(fabdir, AuditLogBasename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var logged []AuditRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		logged = append(logged, rec)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(logged) != 2 {
+		t.Fatalf("got %d audit log records, want 2", len(logged))
+	}
+	if len(posted) != 1 {
+		t.Fatalf("got %d posted audit records, want 1", len(posted))
+	}
+
+	rec := logged[0]
+	if !reflect.DeepEqual(rec.Targets, []string{"Deploy"}) {
+		t.Errorf("got targets %v, want [Deploy]", rec.Targets)
+	}
+	if rec.Result != "ok" || rec.Error != "" {
+		t.Errorf("got result %q (error %q), want ok", rec.Result, rec.Error)
+	}
+	if rec.User == "" || rec.Host == "" || rec.Dir == "" {
+		t.Errorf("missing user, host, or dir in %+v", rec)
+	}
+	if !posted[0].Time.Equal(rec.Time) || !reflect.DeepEqual(posted[0].Targets, rec.Targets) {
+		t.Errorf("posted record %+v differs from logged record %+v", posted[0], rec)
+	}
+
+	rec = logged[1]
+	if rec.Result != "error" {
+		t.Errorf("got result %q, want error", rec.Result)
+	}
+	if want := "bad password " + Redacted; !strings.HasSuffix(rec.Error, want) {
+		t.Errorf("got error %q, want it to end with %q", rec.Error, want)
+	}
+}
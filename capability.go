@@ -0,0 +1,102 @@
+package fab
+
+import "context"
+
+// The interfaces in this file are optional extensions of [Target].
+// A target type implements whichever of them it can,
+// and the [Controller] detects them with type assertions.
+// This lets target types defined outside this package
+// take part in graph export, -clean, -watch, hashing, and scheduling
+// on the same footing as the built-in types.
+
+// GraphChildren is implemented by a [Target] that runs other targets.
+// Children returns them.
+//
+// The Controller uses it to find the subtargets of a target
+// for [Controller.Graph],
+// [Controller.Outputs],
+// [Controller.WriteEnv],
+// [Controller.Watch],
+// and the other operations that walk the tree of targets.
+// A target that does not implement it is treated as a leaf.
+type GraphChildren interface {
+	Children() []Target
+}
+
+// InputsProvider is implemented by a [Target] that reads a known set of files.
+// Inputs returns their names.
+//
+// [Controller.Watch] reruns the target when any of them changes.
+// The [Files] type implements it.
+type InputsProvider interface {
+	Inputs() []string
+}
+
+// OutputsProvider is implemented by a [Target] that writes a known set of files.
+// Outputs returns their names.
+//
+// [Controller.Outputs]
+// (and so the -clean flag)
+// includes them.
+// The [Files] type implements it.
+type OutputsProvider interface {
+	Outputs() []string
+}
+
+// Hasher is implemented by a [Target] that can summarize its own configuration.
+// Hash returns a value that changes whenever a change in the target's configuration
+// could change what it does.
+//
+// When a Hasher is the subtarget of a [Files] target,
+// its Hash is used in computing the Files target's hash
+// in place of its JSON encoding.
+// This allows a target that is not JSON-encodable,
+// e.g. because it contains a function,
+// to be the subtarget of a Files target.
+type Hasher interface {
+	Hash() ([]byte, error)
+}
+
+// Parallelizable is implemented by a [Target] that may not be safe to run
+// concurrently with other targets.
+// If Parallel returns false,
+// then when the target is among several passed to a single call of [Controller.Run],
+// it runs only after the preceding non-parallel targets in that call have finished,
+// and before the following ones start.
+// (The parallel targets in the call still run concurrently with it.)
+//
+// A target that does not implement Parallelizable is run concurrently with the others,
+// as if Parallel returned true.
+type Parallelizable interface {
+	Parallel() bool
+}
+
+// FileRestricter is implemented by a [Target] that can be restricted to some of its files
+// by naming them in its args
+// (see [ArgTarget] and [ParseFileArgs]),
+// as by a [PreCommit] target.
+// Restriction returns the files named in the args in ctx,
+// or nil if the target is to operate on all of its files.
+//
+// When the subtarget of a [Files] or [Check] target is restricted,
+// it runs without consulting or updating the hash DB
+// (or the artifact store),
+// since a successful run on some of the files says nothing about the others.
+// The subtargets of [Format] and [License] implement it,
+// as does that of golang.Lint.
+type FileRestricter interface {
+	Restriction(ctx context.Context) ([]string, error)
+}
+
+// targetHashValue is what goes into the hash of a [Files] target
+// to represent its subtarget:
+// the subtarget's [Hasher] hash if it has one,
+// and otherwise the subtarget itself
+// (to be JSON-encoded).
+func targetHashValue(target Target) (any, error) {
+	h, ok := target.(Hasher)
+	if !ok {
+		return target, nil
+	}
+	return h.Hash()
+}
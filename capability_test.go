@@ -0,0 +1,163 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+// capTarget is a target type defined outside the built-in ones
+// that implements the optional capability interfaces.
+type capTarget struct {
+	children []Target
+	outputs  []string
+	hash     []byte
+	serial   bool
+	f        func(context.Context, *Controller) error // makes capTarget not JSON-encodable
+}
+
+var (
+	_ GraphChildren   = &capTarget{}
+	_ OutputsProvider = &capTarget{}
+	_ Hasher          = &capTarget{}
+	_ Parallelizable  = &capTarget{}
+)
+
+func (c *capTarget) Run(ctx context.Context, con *Controller) error {
+	if c.f != nil {
+		return c.f(ctx, con)
+	}
+	return con.Run(ctx, c.children...)
+}
+
+func (*capTarget) Desc() string            { return "capTarget" }
+func (c *capTarget) Children() []Target    { return c.children }
+func (c *capTarget) Outputs() []string     { return c.outputs }
+func (c *capTarget) Hash() ([]byte, error) { return c.hash, nil }
+func (c *capTarget) Parallel() bool        { return !c.serial }
+
+func TestGraphChildren(t *testing.T) {
+	t.Parallel()
+
+	var (
+		leaf = &capTarget{outputs: []string{"leaf.out"}}
+		top  = &capTarget{children: []Target{leaf}, outputs: []string{"top.out"}}
+		con  = NewController("")
+	)
+
+	var visited []Target
+	err := con.walk([]Target{top}, func(target Target) error {
+		visited = append(visited, target)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Target{top, leaf}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("visited %v, want %v", visited, want)
+	}
+
+	outputs, err := con.Outputs(top)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"leaf.out", "top.out"}; !reflect.DeepEqual(outputs, want) {
+		t.Errorf("got outputs %v, want %v", outputs, want)
+	}
+}
+
+func TestHasher(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	in := filepath.Join(tmpdir, "in")
+	if err := os.WriteFile(in, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithHashDB(context.Background(), memdb(set.New[string]()))
+
+	var count int
+	newTarget := func(hash string) Target {
+		sub := &capTarget{
+			hash: []byte(hash),
+			f: func(context.Context, *Controller) error {
+				count++
+				return nil
+			},
+		}
+		return Files(sub, []string{in}, nil)
+	}
+
+	for i, c := range []struct {
+		hash      string
+		wantCount int
+	}{
+		{"a", 1}, {"a", 1}, {"b", 2},
+	} {
+		con := NewController("")
+		if err := con.Run(ctx, newTarget(c.hash)); err != nil {
+			t.Fatalf("run %d: %s", i+1, err)
+		}
+		if count != c.wantCount {
+			t.Errorf("after run %d got count %d, want %d", i+1, count, c.wantCount)
+		}
+	}
+}
+
+func TestParallelizable(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu            sync.Mutex
+		running, most int
+	)
+	newTarget := func(serial bool) Target {
+		return &capTarget{
+			serial: serial,
+			f: func(context.Context, *Controller) error {
+				mu.Lock()
+				running++
+				if running > most {
+					most = running
+				}
+				mu.Unlock()
+
+				time.Sleep(20 * time.Millisecond)
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return nil
+			},
+		}
+	}
+
+	con := NewController("")
+	if err := con.Run(context.Background(), newTarget(true), newTarget(true), newTarget(true)); err != nil {
+		t.Fatal(err)
+	}
+	if most != 1 {
+		t.Errorf("got %d non-parallel targets running at once, want 1", most)
+	}
+
+	most = 0
+	con = NewController("")
+	if err := con.Run(context.Background(), newTarget(true), newTarget(false), newTarget(false)); err != nil {
+		t.Fatal(err)
+	}
+	if most != 3 {
+		t.Errorf("got %d targets running at once, want 3", most)
+	}
+}
@@ -0,0 +1 @@
+#define GREETING "hello"
@@ -0,0 +1,3 @@
+#include <stdio.h>
+#include "greeting.h"
+int main() { printf("%s\n", GREETING); return 0; }
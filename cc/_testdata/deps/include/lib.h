@@ -0,0 +1,2 @@
+#include "sub/inner.h"
+#include "lib.h"
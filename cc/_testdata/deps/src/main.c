@@ -0,0 +1,4 @@
+#include <stdio.h>
+#include "local.h"
+# include <lib.h>
+int main() { return 0; }
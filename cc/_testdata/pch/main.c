@@ -0,0 +1 @@
+int main() { printf("%s\n", GREETING); return 0; }
@@ -0,0 +1,438 @@
+// Package cc contains Fab target types for compiling and linking C and C++ programs.
+package cc
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+	"github.com/bobg/go-generics/v2/slices"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bobg/fab"
+)
+
+// cxxExts are the filename extensions of C++ source files.
+var cxxExts = set.New(".C", ".c++", ".cc", ".cp", ".cpp", ".cxx")
+
+// IsCXX tells whether src is a C++ source file,
+// according to its filename extension.
+func IsCXX(src string) bool {
+	return cxxExts.Has(filepath.Ext(src))
+}
+
+// CC returns the command for compiling C code:
+// the value of the CC environment variable if it is set,
+// and otherwise the first of cc, clang, and gcc found in the PATH.
+// If none is found the result is cc.
+func CC() string {
+	return selectCompiler("CC", "cc", "clang", "gcc")
+}
+
+// CXX returns the command for compiling C++ code:
+// the value of the CXX environment variable if it is set,
+// and otherwise the first of c++, clang++, and g++ found in the PATH.
+// If none is found the result is c++.
+func CXX() string {
+	return selectCompiler("CXX", "c++", "clang++", "g++")
+}
+
+func selectCompiler(envvar string, candidates ...string) string {
+	if c := os.Getenv(envvar); c != "" {
+		return c
+	}
+	for _, c := range candidates {
+		if _, err := exec.LookPath(c); err == nil {
+			return c
+		}
+	}
+	return candidates[0]
+}
+
+// Compiler returns the command for compiling src:
+// [CXX] if it is a C++ source file (see [IsCXX])
+// and [CC] otherwise.
+func Compiler(src string) string {
+	if IsCXX(src) {
+		return CXX()
+	}
+	return CC()
+}
+
+// Compile produces a target that compiles the C or C++ source file src
+// to the object file obj,
+// running `COMPILER FLAGS -I INCLUDE... -c SRC -o OBJ`.
+// If compiler is empty,
+// it is chosen with [Compiler].
+// If obj is empty,
+// it is src with its extension replaced by .o.
+//
+// Compile is implemented in terms of [fab.Files].
+// Its inputs are src and the header files it includes,
+// directly or indirectly,
+// that can be found among the include directories
+// (see [Deps]).
+// Its output is obj,
+// which is automatically selected for "autocleaning."
+// See [fab.Autoclean] for more about this feature.
+// The version of the compiler also goes into the hash of the target
+// (see [fab.Command]'s HashTool field),
+// so upgrading the compiler causes the file to be recompiled.
+// Any opts are passed through to fab.Files.
+//
+// The compiler command is also recorded for the compilation database
+// (see [CompilationDatabase]).
+//
+// A Compile target may be specified in YAML using the tag !cc.Compile,
+// which introduces a mapping whose fields are:
+//
+//   - Src: the source file
+//   - Obj: the object file
+//   - Includes: a sequence of include directories
+//   - Flags: a sequence of additional flags for the compiler
+//   - Compiler: the compiler command
+//   - PCH: a header file precompiled by a !cc.PCH target with no Out field
+//     (see [PCH.Compile])
+//
+// Src, Obj, PCH, and the directories in Includes are either absolute or relative to the directory containing the YAML file.
+func Compile(compiler, src, obj string, includes, flags []string, opts ...fab.FilesOpt) (fab.Target, error) {
+	return compile(compiler, src, obj, includes, flags, nil, opts...)
+}
+
+// compile implements [Compile] and [PCH.Compile].
+// The files in extraIn are inputs in addition to src and the files it includes.
+func compile(compiler, src, obj string, includes, flags, extraIn []string, opts ...fab.FilesOpt) (fab.Target, error) {
+	if compiler == "" {
+		compiler = Compiler(src)
+	}
+	if obj == "" {
+		obj = strings.TrimSuffix(src, filepath.Ext(src)) + ".o"
+	}
+
+	deps, err := Deps(src, includes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "computing dependencies of %s", src)
+	}
+	if len(extraIn) > 0 {
+		deps = append(deps, extraIn...)
+		sort.Strings(deps)
+	}
+
+	args := append([]string{}, flags...)
+	args = append(args, slices.Map(includes, func(inc string) string { return "-I" + inc })...)
+	args = append(args, "-c", src, "-o", obj)
+
+	if err := register(compiler, src, obj, args); err != nil {
+		return nil, err
+	}
+
+	c := &fab.Command{
+		Cmd:      compiler,
+		Args:     args,
+		HashTool: "--version",
+	}
+	opts = append([]fab.FilesOpt{fab.Autoclean(true)}, opts...)
+	return fab.Files(c, deps, []string{obj}, opts...), nil
+}
+
+// MustCompile is the same as [Compile] but panics on error.
+func MustCompile(compiler, src, obj string, includes, flags []string, opts ...fab.FilesOpt) fab.Target {
+	target, err := Compile(compiler, src, obj, includes, flags, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+func compileDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var c struct {
+		Src      string    `yaml:"Src"`
+		Obj      string    `yaml:"Obj"`
+		Includes yaml.Node `yaml:"Includes"`
+		Flags    yaml.Node `yaml:"Flags"`
+		Compiler string    `yaml:"Compiler"`
+		PCH      string    `yaml:"PCH"`
+	}
+	if err := node.Decode(&c); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding cc.Compile")
+	}
+	if c.Src == "" {
+		return nil, errors.New("YAML error decoding cc.Compile: no Src")
+	}
+
+	includes, err := con.YAMLFileList(&c.Includes, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding cc.Compile.Includes")
+	}
+	flags, err := con.YAMLStringList(&c.Flags, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding cc.Compile.Flags")
+	}
+
+	var obj string
+	if c.Obj != "" {
+		obj = con.JoinPath(dir, c.Obj)
+	}
+
+	src := con.JoinPath(dir, c.Src)
+
+	if c.PCH != "" {
+		compiler := c.Compiler
+		if compiler == "" {
+			compiler = Compiler(src)
+		}
+		p := &PCH{
+			Header:   con.JoinPath(dir, c.PCH),
+			Compiler: compiler,
+		}
+		return p.Compile(src, obj, includes, flags)
+	}
+
+	return Compile(c.Compiler, src, obj, includes, flags)
+}
+
+// Link produces a target that links the object files objs
+// into the executable out,
+// running `COMPILER -o OUT OBJ... FLAGS`.
+// Libraries to link against
+// (such as -lm)
+// belong in flags,
+// after the object files that need them.
+// If compiler is empty,
+// it is [CC].
+// Programs containing C++ code should be linked with [CXX]
+// in order to get the C++ standard library.
+//
+// Link is implemented in terms of [fab.Files],
+// with objs as inputs and out as the output,
+// which is automatically selected for "autocleaning."
+// See [fab.Autoclean] for more about this feature.
+// As with [Compile],
+// the version of the compiler goes into the hash of the target.
+// Any opts are passed through to fab.Files.
+//
+// A Link target may be specified in YAML using the tag !cc.Link,
+// which introduces a mapping whose fields are:
+//
+//   - Out: the executable file
+//   - Objs: a sequence of object files
+//   - Flags: a sequence of additional flags for the compiler
+//   - Compiler: the compiler command
+//   - CXX: a boolean, true for linking with [CXX] when Compiler is not given
+//
+// Out and the files in Objs are either absolute or relative to the directory containing the YAML file.
+func Link(compiler, out string, objs, flags []string, opts ...fab.FilesOpt) (fab.Target, error) {
+	if out == "" {
+		return nil, errors.New("no output file")
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("no object files for %s", out)
+	}
+	if compiler == "" {
+		compiler = CC()
+	}
+
+	args := append([]string{"-o", out}, objs...)
+	args = append(args, flags...)
+
+	c := &fab.Command{
+		Cmd:      compiler,
+		Args:     args,
+		HashTool: "--version",
+	}
+	opts = append([]fab.FilesOpt{fab.Autoclean(true)}, opts...)
+	return fab.Files(c, objs, []string{out}, opts...), nil
+}
+
+// MustLink is the same as [Link] but panics on error.
+func MustLink(compiler, out string, objs, flags []string, opts ...fab.FilesOpt) fab.Target {
+	target, err := Link(compiler, out, objs, flags, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+func linkDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var l struct {
+		Out      string    `yaml:"Out"`
+		Objs     yaml.Node `yaml:"Objs"`
+		Flags    yaml.Node `yaml:"Flags"`
+		Compiler string    `yaml:"Compiler"`
+		CXX      bool      `yaml:"CXX"`
+	}
+	if err := node.Decode(&l); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding cc.Link")
+	}
+	if l.Out == "" {
+		return nil, errors.New("YAML error decoding cc.Link: no Out")
+	}
+
+	objs, err := con.YAMLFileList(&l.Objs, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding cc.Link.Objs")
+	}
+	flags, err := con.YAMLStringList(&l.Flags, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding cc.Link.Flags")
+	}
+
+	compiler := l.Compiler
+	if compiler == "" && l.CXX {
+		compiler = CXX()
+	}
+
+	return Link(compiler, con.JoinPath(dir, l.Out), objs, flags)
+}
+
+// Deps returns the dependencies of the C or C++ file src.
+// Included in the dependencies is the file itself,
+// plus any files it includes
+// (directly or indirectly)
+// that can be found among the given include directories.
+// A file named in an #include "..." directive
+// is also sought in the directory of the file containing the directive,
+// before the include directories.
+// Files that cannot be found,
+// such as system headers,
+// are not included.
+// The list is sorted for consistent, predictable results.
+//
+// Preprocessor conditionals are not evaluated,
+// so the result may include headers that the compiler skips.
+// That can cause unnecessary recompilation but never a missed one.
+//
+// The #include directives of each file are remembered,
+// for as long as its size and modification time don't change,
+// so that a header included by many source files is read only once.
+func Deps(src string, includes []string) ([]string, error) {
+	result := set.New[string](src)
+	if err := ccdeps(src, includes, result); err != nil {
+		return nil, err
+	}
+	slice := result.Slice()
+	sort.Strings(slice)
+	return slice, nil
+}
+
+func ccdeps(filename string, includes []string, result set.Of[string]) error {
+	directives, err := scan(filename)
+	if err != nil {
+		return err
+	}
+	for _, d := range directives {
+		dirs := includes
+		if d.quoted {
+			dirs = append([]string{filepath.Dir(filename)}, includes...)
+		}
+		for _, dir := range dirs {
+			full := filepath.Join(dir, d.name)
+			if result.Has(full) {
+				break
+			}
+			info, err := os.Stat(full)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "statting %s", full)
+			}
+			if !info.Mode().IsRegular() {
+				continue
+			}
+			result.Add(full)
+			if err := ccdeps(full, includes, result); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// directive is an #include directive.
+type directive struct {
+	name   string
+	quoted bool // #include "name" rather than #include <name>
+}
+
+// scanned is the result of scanning a file for #include directives,
+// along with the file's size and modification time at the time.
+type scanned struct {
+	size       int64
+	mtime      time.Time
+	directives []directive
+}
+
+var (
+	scanMu    sync.Mutex
+	scanCache = make(map[string]scanned)
+)
+
+var includeRegex = regexp.MustCompile(`^\s*#\s*include\s*([<"])([^>"]+)[>"]`)
+
+// scan returns the #include directives in filename,
+// using the cached result from an earlier call when the file is unchanged.
+func scan(filename string) ([]directive, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "statting %s", filename)
+	}
+
+	scanMu.Lock()
+	s, ok := scanCache[filename]
+	scanMu.Unlock()
+	if ok && s.size == info.Size() && s.mtime.Equal(info.ModTime()) {
+		return s.directives, nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %s", filename)
+	}
+	defer f.Close()
+
+	var directives []directive
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		m := includeRegex.FindStringSubmatch(sc.Text())
+		if len(m) == 0 {
+			continue
+		}
+		directives = append(directives, directive{name: m[2], quoted: m[1] == `"`})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrapf(err, "scanning %s", filename)
+	}
+
+	scanMu.Lock()
+	scanCache[filename] = scanned{size: info.Size(), mtime: info.ModTime(), directives: directives}
+	scanMu.Unlock()
+
+	return directives, nil
+}
+
+func init() {
+	fab.RegisterYAMLTarget("cc.Compile", compileDecoder)
+	fab.SetYAMLTagDoc("cc.Compile", "Compile a C or C++ source file to an object file.")
+	fab.RegisterYAMLTarget("cc.Link", linkDecoder)
+	fab.SetYAMLTagDoc("cc.Link", "Link object files into an executable.")
+}
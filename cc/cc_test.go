@@ -0,0 +1,111 @@
+package cc
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bobg/fab/internal/faketool"
+)
+
+func TestDeps(t *testing.T) {
+	e := faketool.New(t, "_testdata/deps")
+
+	var (
+		src = e.Path("src", "main.c")
+		inc = e.Path("include")
+	)
+
+	got, err := Deps(src, []string{inc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(inc, "lib.h"),
+		filepath.Join(inc, "sub", "inner.h"),
+		e.Path("src", "local.h"),
+		src,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Changing a file causes it to be scanned again.
+	local := e.Path("src", "local.h")
+	e.WriteFile(t, "src/local.h", "/* no more includes */\n")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(local, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = Deps(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{local, src}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("after change, got %v, want %v", got, want)
+	}
+}
+
+func TestIsCXX(t *testing.T) {
+	cases := map[string]bool{
+		"a.c":   false,
+		"a.h":   false,
+		"a.cc":  true,
+		"a.cpp": true,
+		"a.cxx": true,
+		"a.C":   true,
+	}
+	for src, want := range cases {
+		if got := IsCXX(src); got != want {
+			t.Errorf("IsCXX(%s) = %v, want %v", src, got, want)
+		}
+	}
+}
+
+func TestCompiler(t *testing.T) {
+	t.Setenv("CC", "my-cc")
+	t.Setenv("CXX", "my-c++")
+
+	if got := Compiler("a.c"); got != "my-cc" {
+		t.Errorf("got %s for a.c, want my-cc", got)
+	}
+	if got := Compiler("a.cc"); got != "my-c++" {
+		t.Errorf("got %s for a.cc, want my-c++", got)
+	}
+}
+
+func TestCompileLink(t *testing.T) {
+	if _, err := exec.LookPath(CC()); err != nil {
+		t.Skip("no C compiler")
+	}
+
+	e := faketool.New(t, "_testdata/compile")
+
+	run := func() string {
+		t.Helper()
+
+		e.Run(t, "Build")
+
+		out, err := exec.Command(e.Path("main")).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	if got := run(); got != "hello" {
+		t.Errorf("got %q, want hello", got)
+	}
+
+	// Changing the header is enough to rebuild.
+	e.WriteFile(t, "inc/greeting.h", "#define GREETING \"goodbye\"\n")
+	if got := run(); got != "goodbye" {
+		t.Errorf("after changing header, got %q, want goodbye", got)
+	}
+}
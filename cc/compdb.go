@@ -0,0 +1,157 @@
+package cc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bobg/fab"
+)
+
+// CompileCommand is an entry in a compilation database
+// (see [CompilationDatabase]).
+type CompileCommand struct {
+	// Directory is the working directory of the compilation.
+	Directory string `json:"directory"`
+
+	// File is the source file.
+	File string `json:"file"`
+
+	// Arguments is the compiler command line,
+	// starting with the compiler itself.
+	Arguments []string `json:"arguments"`
+
+	// Output is the object file.
+	Output string `json:"output,omitempty"`
+}
+
+var (
+	compdbMu sync.Mutex
+	compdb   = make(map[string]CompileCommand) // keyed by output file
+)
+
+// register records the command for compiling src to obj
+// in the compilation database.
+// A later command for the same obj replaces an earlier one.
+func register(compiler, src, obj string, args []string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return errors.Wrap(err, "getting working directory")
+	}
+
+	compdbMu.Lock()
+	defer compdbMu.Unlock()
+
+	compdb[obj] = CompileCommand{
+		Directory: wd,
+		File:      src,
+		Arguments: append([]string{compiler}, args...),
+		Output:    obj,
+	}
+	return nil
+}
+
+// CompileCommands returns the commands of the [Compile] targets created so far
+// (including those defined in YAML with !cc.Compile),
+// sorted by source file and then by object file.
+func CompileCommands() []CompileCommand {
+	compdbMu.Lock()
+	result := make([]CompileCommand, 0, len(compdb))
+	for _, c := range compdb {
+		result = append(result, c)
+	}
+	compdbMu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].File != result[j].File {
+			return result[i].File < result[j].File
+		}
+		return result[i].Output < result[j].Output
+	})
+	return result
+}
+
+// CompilationDatabase produces a target that writes a compilation database to the file out,
+// normally named compile_commands.json.
+// This is the JSON format understood by clangd,
+// clang-tidy,
+// and many editors and IDEs,
+// describing how each source file is compiled.
+// Its entries are those of [CompileCommands]
+// as of the time the target runs,
+// by which time Fab has normally created all the [Compile] targets it knows about.
+//
+// The file is rewritten only when its contents change,
+// so tools watching it are not disturbed needlessly.
+//
+// A CompilationDatabase target may be specified in YAML using the tag !cc.CompilationDatabase,
+// which introduces a mapping whose field is:
+//
+//   - Out: the output file,
+//     either absolute or relative to the directory containing the YAML file,
+//     by default compile_commands.json
+func CompilationDatabase(out string) fab.Target {
+	return &compilationDatabase{Out: out}
+}
+
+type compilationDatabase struct {
+	Out string
+}
+
+var _ fab.Target = &compilationDatabase{}
+
+// Run implements fab.Target.Run.
+func (c *compilationDatabase) Run(ctx context.Context, con *fab.Controller) error {
+	data, err := json.MarshalIndent(CompileCommands(), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding compilation database")
+	}
+	data = append(data, '\n')
+
+	if existing, err := os.ReadFile(c.Out); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+
+	if fab.GetDryRun(ctx) {
+		if fab.GetVerbose(ctx) {
+			con.Indentf("  Would write %s", c.Out)
+		}
+		return nil
+	}
+
+	return errors.Wrapf(os.WriteFile(c.Out, data, 0644), "writing %s", c.Out)
+}
+
+// Desc implements fab.Target.Desc.
+func (*compilationDatabase) Desc() string {
+	return "cc.CompilationDatabase"
+}
+
+func compdbDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var c struct {
+		Out string `yaml:"Out"`
+	}
+	if err := node.Decode(&c); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding cc.CompilationDatabase")
+	}
+	if c.Out == "" {
+		c.Out = "compile_commands.json"
+	}
+
+	return CompilationDatabase(con.JoinPath(dir, c.Out)), nil
+}
+
+func init() {
+	fab.RegisterYAMLTarget("cc.CompilationDatabase", compdbDecoder)
+	fab.SetYAMLTagDoc("cc.CompilationDatabase", "Write compile_commands.json for the cc.Compile targets.")
+}
@@ -0,0 +1,74 @@
+package cc
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bobg/fab/internal/faketool"
+)
+
+func TestCompilationDatabase(t *testing.T) {
+	e := faketool.New(t, "_testdata/compdb")
+	e.Run(t, "DB")
+
+	outfile := e.Path("compile_commands.json")
+	data, err := os.ReadFile(outfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []CompileCommand
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	// Other tests may have created Compile targets too.
+	var mine []CompileCommand
+	for _, c := range got {
+		if strings.HasPrefix(c.File, e.Dir) {
+			mine = append(mine, c)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		a    = e.Path("a.c")
+		aObj = e.Path("a.o")
+		b    = e.Path("b.cc")
+		bObj = e.Path("b-obj.o")
+	)
+	want := []CompileCommand{{
+		Directory: wd,
+		File:      a,
+		Arguments: []string{"my-cc", "-O2", "-c", a, "-o", aObj},
+		Output:    aObj,
+	}, {
+		Directory: wd,
+		File:      b,
+		Arguments: []string{"my-c++", "-I" + e.Path("inc"), "-c", b, "-o", bObj},
+		Output:    bObj,
+	}}
+	if !reflect.DeepEqual(mine, want) {
+		t.Errorf("got %+v, want %+v", mine, want)
+	}
+
+	// Running again with no changes leaves the file alone.
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(outfile, past, past); err != nil {
+		t.Fatal(err)
+	}
+	e.RunTarget(t, CompilationDatabase(outfile))
+	info, err := os.Stat(outfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(past) {
+		t.Errorf("compilation database rewritten with no changes")
+	}
+}
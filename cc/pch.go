@@ -0,0 +1,249 @@
+package cc
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+	"github.com/bobg/go-generics/v2/slices"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bobg/fab"
+)
+
+// cxxHeaderExts are the filename extensions of C++ header files.
+// (C++ headers named .h are also common,
+// but that extension doesn't distinguish them from C headers.)
+var cxxHeaderExts = set.New(".H", ".h++", ".hh", ".hpp", ".hxx")
+
+// PCH is a precompiled header:
+// a header file that the compiler has processed ahead of time,
+// so that the source files including it compile faster.
+// This matters most for large C++ headers,
+// such as those of the standard library,
+// that are included by many source files.
+//
+// Use [PCH.Target] to produce the precompiled header,
+// and [PCH.Compile] to compile source files using it.
+// The compiler and the flags affecting code generation
+// must be the same in both.
+//
+// Example:
+//
+//	pch := &cc.PCH{Header: "src/common.h", Compiler: cc.CXX()}
+//	Common = cc.MustPCHTarget(pch, []string{"include"}, []string{"-O2"})
+//	Main = cc.MustPCHCompile(pch, "src/main.cc", "", []string{"include"}, []string{"-O2"})
+//	Build = fab.Seq(Common, Main)
+type PCH struct {
+	// Header is the header file.
+	Header string
+
+	// Out is the precompiled header file.
+	// If empty,
+	// it is Header with .pch appended for clang,
+	// and with .gch appended for other compilers.
+	// A compiler other than clang finds the precompiled header
+	// only if Out is Header with .gch appended,
+	// optionally in a different directory.
+	Out string
+
+	// Compiler is the compiler command.
+	// If empty,
+	// it is [CXX] for a C++ header
+	// (with an extension such as .hpp),
+	// and [CC] otherwise.
+	// For a C++ header named .h,
+	// specify CXX.
+	Compiler string
+}
+
+func (p *PCH) compiler() string {
+	if p.Compiler != "" {
+		return p.Compiler
+	}
+	if cxxHeaderExts.Has(filepath.Ext(p.Header)) {
+		return CXX()
+	}
+	return CC()
+}
+
+func (p *PCH) out() string {
+	if p.Out != "" {
+		return p.Out
+	}
+	if isClang(p.compiler()) {
+		return p.Header + ".pch"
+	}
+	return p.Header + ".gch"
+}
+
+// Target produces a target that precompiles the header,
+// running `COMPILER FLAGS -I INCLUDE... HEADER -o OUT`.
+//
+// Like [Compile],
+// Target is implemented in terms of [fab.Files],
+// whose inputs are the header and the headers it includes
+// that can be found among the include directories,
+// and whose output is the precompiled header,
+// which is automatically selected for "autocleaning."
+// So the header is precompiled again only when it
+// (or one of its own headers,
+// or the compiler)
+// changes.
+// Any opts are passed through to fab.Files.
+//
+// A PCH target may be specified in YAML using the tag !cc.PCH,
+// which introduces a mapping whose fields are:
+//
+//   - Header: the header file
+//   - Out: the precompiled header file
+//   - Includes: a sequence of include directories
+//   - Flags: a sequence of additional flags for the compiler
+//   - Compiler: the compiler command
+//   - CXX: a boolean, true for compiling with [CXX] when Compiler is not given
+//
+// Header, Out, and the directories in Includes are either absolute or relative to the directory containing the YAML file.
+// A !cc.Compile target may use the precompiled header with its PCH field.
+func (p *PCH) Target(includes, flags []string, opts ...fab.FilesOpt) (fab.Target, error) {
+	if p.Header == "" {
+		return nil, errors.New("no header")
+	}
+	out := p.out()
+	if !isClang(p.compiler()) && !strings.HasSuffix(out, ".gch") {
+		return nil, fmt.Errorf("precompiled header %s must end in .gch for %s", out, p.compiler())
+	}
+
+	deps, err := Deps(p.Header, includes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "computing dependencies of %s", p.Header)
+	}
+
+	args := append([]string{}, flags...)
+	args = append(args, slices.Map(includes, func(inc string) string { return "-I" + inc })...)
+	args = append(args, p.Header, "-o", out)
+
+	c := &fab.Command{
+		Cmd:      p.compiler(),
+		Args:     args,
+		HashTool: "--version",
+	}
+	opts = append([]fab.FilesOpt{fab.Autoclean(true)}, opts...)
+	return fab.Files(c, deps, []string{out}, opts...), nil
+}
+
+// MustPCHTarget is the same as [PCH.Target] but panics on error.
+func MustPCHTarget(p *PCH, includes, flags []string, opts ...fab.FilesOpt) fab.Target {
+	target, err := p.Target(includes, flags, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+// Compile is like the package-level [Compile],
+// but compiles src using the precompiled header,
+// as if src began with an #include of the header.
+// The precompiled header is one of the inputs of the resulting target,
+// so src is recompiled when the header is.
+//
+// It does not cause the header to be precompiled;
+// run the target from [PCH.Target] first.
+func (p *PCH) Compile(src, obj string, includes, flags []string, opts ...fab.FilesOpt) (fab.Target, error) {
+	var (
+		compiler = p.compiler()
+		out      = p.out()
+	)
+	if isClang(compiler) {
+		flags = append([]string{"-include-pch", out}, flags...)
+	} else {
+		if !strings.HasSuffix(out, ".gch") {
+			return nil, fmt.Errorf("precompiled header %s must end in .gch for %s", out, compiler)
+		}
+		// The compiler looks for FILE.gch when including FILE.
+		flags = append([]string{"-include", strings.TrimSuffix(out, ".gch")}, flags...)
+	}
+	return compile(compiler, src, obj, includes, flags, []string{out}, opts...)
+}
+
+// MustPCHCompile is the same as [PCH.Compile] but panics on error.
+func MustPCHCompile(p *PCH, src, obj string, includes, flags []string, opts ...fab.FilesOpt) fab.Target {
+	target, err := p.Compile(src, obj, includes, flags, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+var (
+	clangMu sync.Mutex
+	clang   = make(map[string]bool)
+)
+
+// isClang tells whether compiler is clang,
+// which may be installed under another name such as cc.
+func isClang(compiler string) bool {
+	clangMu.Lock()
+	defer clangMu.Unlock()
+
+	if result, ok := clang[compiler]; ok {
+		return result
+	}
+	result := strings.Contains(filepath.Base(compiler), "clang")
+	if !result {
+		out, err := exec.Command(compiler, "--version").Output()
+		result = err == nil && strings.Contains(string(out), "clang")
+	}
+	clang[compiler] = result
+	return result
+}
+
+func pchDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var y struct {
+		Header   string    `yaml:"Header"`
+		Out      string    `yaml:"Out"`
+		Includes yaml.Node `yaml:"Includes"`
+		Flags    yaml.Node `yaml:"Flags"`
+		Compiler string    `yaml:"Compiler"`
+		CXX      bool      `yaml:"CXX"`
+	}
+	if err := node.Decode(&y); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding cc.PCH")
+	}
+	if y.Header == "" {
+		return nil, errors.New("YAML error decoding cc.PCH: no Header")
+	}
+
+	includes, err := con.YAMLFileList(&y.Includes, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding cc.PCH.Includes")
+	}
+	flags, err := con.YAMLStringList(&y.Flags, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding cc.PCH.Flags")
+	}
+
+	p := &PCH{
+		Header:   con.JoinPath(dir, y.Header),
+		Compiler: y.Compiler,
+	}
+	if y.Out != "" {
+		p.Out = con.JoinPath(dir, y.Out)
+	}
+	if p.Compiler == "" && y.CXX {
+		p.Compiler = CXX()
+	}
+	return p.Target(includes, flags)
+}
+
+func init() {
+	fab.RegisterYAMLTarget("cc.PCH", pchDecoder)
+	fab.SetYAMLTagDoc("cc.PCH", "Precompile a C or C++ header file.")
+}
@@ -0,0 +1,57 @@
+package cc
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/bobg/fab/internal/faketool"
+)
+
+func TestPCH(t *testing.T) {
+	if _, err := exec.LookPath(CC()); err != nil {
+		t.Skip("no C compiler")
+	}
+
+	e := faketool.New(t, "_testdata/pch")
+
+	run := func() string {
+		t.Helper()
+
+		e.Run(t, "Build")
+
+		out, err := exec.Command(e.Path("main")).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	if got := run(); got != "hello" {
+		t.Errorf("got %q, want hello", got)
+	}
+
+	p := &PCH{Header: e.Path("common.h")}
+	if _, err := os.Stat(p.out()); err != nil {
+		t.Errorf("precompiled header: %s", err)
+	}
+
+	// Changing the header recompiles it and the source file using it.
+	e.WriteFile(t, "common.h", "#include <stdio.h>\n#define GREETING \"goodbye\"\n")
+	if got := run(); got != "goodbye" {
+		t.Errorf("after changing header, got %q, want goodbye", got)
+	}
+}
+
+func TestPCHOut(t *testing.T) {
+	p := &PCH{Header: "x.h", Out: "build/x.h.pch", Compiler: "gcc-not-clang"}
+	if _, err := p.Target(nil, nil); err == nil {
+		t.Error("got no error for a .pch file without clang")
+	}
+
+	p = &PCH{Header: "x.h", Compiler: "clang"}
+	if got := p.out(); got != "x.h.pch" {
+		t.Errorf("got %s for clang, want x.h.pch", got)
+	}
+}
@@ -0,0 +1,85 @@
+package fab
+
+import (
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Check creates a target for running a "check" -
+// a linter, a vet tool, a test suite, etc. -
+// that produces no output files.
+//
+// It works like [Files] with an empty output list:
+// after the subtarget succeeds,
+// a hash of the subtarget and its input files
+// is recorded in the hash database
+// (obtained with [GetHashDB]).
+// The next time the Check target runs,
+// if that hash is found in the database,
+// none of the inputs has changed since the last successful check,
+// so running the subtarget is skipped.
+// A failing subtarget records nothing,
+// so it will run again next time.
+//
+// As with Files,
+// the subtarget must be of a type that can be JSON-marshaled,
+// and the list of inputs should mention every file where a change should cause the check to rerun.
+// Any opts are applied as they are in Files.
+//
+// A Check target may be specified in YAML using the !Check tag,
+// which introduces a mapping whose fields are:
+//
+//   - Target: the nested subtarget, or target name
+//   - In: the list of input files, interpreted with [YAMLFilesList]
+//
+// Example:
+//
+//	Vet: !Check
+//	  Target: !Command
+//	    Shell: go vet ./...
+//	  In: !go.Deps
+//	    Dir: .
+//	    Recursive: true
+//	    Tests: true
+func Check(target Target, in []string, opts ...FilesOpt) Target {
+	result := &files{
+		Target: target,
+		In:     in,
+		desc:   "Check",
+	}
+	for _, opt := range opts {
+		opt(result)
+	}
+	return result
+}
+
+func checkDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var ycheck struct {
+		In     yaml.Node `yaml:"In"`
+		Target yaml.Node `yaml:"Target"`
+	}
+	if err := node.Decode(&ycheck); err != nil {
+		return nil, errors.Wrap(err, "YAML error in Check node")
+	}
+
+	target, err := con.YAMLTarget(&ycheck.Target, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Target child of Check node")
+	}
+
+	in, err := con.YAMLFileList(&ycheck.In, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Check.In node")
+	}
+
+	return Check(target, in), nil
+}
+
+func init() {
+	RegisterYAMLTarget("Check", checkDecoder)
+	SetYAMLTagDoc("Check", "Run a check that produces no output files, when its inputs have changed.")
+}
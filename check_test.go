@@ -0,0 +1,59 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	inpath := filepath.Join(tmpdir, "in")
+	if err = os.WriteFile(inpath, []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		ct    = &countTarget{}
+		check = Check(ct, []string{inpath})
+		ctx   = context.Background()
+	)
+	ctx = WithVerbose(ctx, testing.Verbose())
+	ctx = WithHashDB(ctx, memdb(set.New[string]()))
+
+	try := func(want uint32) {
+		t.Helper()
+
+		con := NewController("")
+		if err := con.Run(ctx, check); err != nil {
+			t.Fatal(err)
+		}
+		if ct.count != want {
+			t.Errorf("got count %d, want %d", ct.count, want)
+		}
+	}
+
+	try(1)
+	try(1) // inputs unchanged, check skipped
+
+	if err = os.WriteFile(inpath, []byte("bar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	try(2)
+	try(2)
+
+	if got := check.Desc(); got != "Check" {
+		t.Errorf("got Desc %s, want Check", got)
+	}
+}
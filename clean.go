@@ -18,6 +18,8 @@ import (
 // If Autoclean is true,
 // files listed in the "autoclean registry" are also removed.
 // See [Autoclean] for more about this feature.
+// So are the stale outputs of Files targets
+// (see [Controller.PruneOutputs]).
 //
 // A Clean target may be specified in YAML using the tag !Clean.
 // It may introduce a sequence,
@@ -45,6 +47,22 @@ func (c *Clean) Run(ctx context.Context, con *Controller) error {
 	}
 	sort.Strings(files)
 
+	if c.Autoclean {
+		if fabdir := GetFabdir(ctx); fabdir != "" {
+			pruned, err := con.PruneOutputs(ctx, fabdir)
+			if err != nil {
+				return errors.Wrap(err, "pruning stale outputs")
+			}
+			if len(pruned) > 0 && GetVerbose(ctx) {
+				if GetDryRun(ctx) {
+					con.Indentf("  would remove stale outputs %v", pruned)
+				} else {
+					con.Indentf("  removed stale outputs %v", pruned)
+				}
+			}
+		}
+	}
+
 	if len(files) == 0 {
 		return nil
 	}
@@ -75,6 +93,47 @@ func (*Clean) Desc() string {
 	return "Clean"
 }
 
+// Outputs returns the output files of the [Files] targets
+// among the given targets and their subtargets
+// (including Files targets that produce their input files).
+// If no targets are given,
+// the outputs of all the targets in the registry are returned.
+func (con *Controller) Outputs(targets ...Target) ([]string, error) {
+	if len(targets) == 0 {
+		for _, name := range con.RegistryNames() {
+			target, _ := con.RegistryTarget(name)
+			targets = append(targets, target)
+		}
+	}
+
+	outputs := set.New[string]()
+	err := con.walk(targets, func(target Target) error {
+		if op, ok := target.(OutputsProvider); ok {
+			outputs.Add(op.Outputs()...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := outputs.Slice()
+	sort.Strings(result)
+	return result, nil
+}
+
+// CleanOutputs removes the files reported by [Controller.Outputs],
+// as if by a [Clean] target listing them.
+// This is the -clean mode of the fab command.
+func (con *Controller) CleanOutputs(ctx context.Context, targets ...Target) error {
+	outputs, err := con.Outputs(targets...)
+	if err != nil {
+		return errors.Wrap(err, "finding outputs")
+	}
+	c := &Clean{Files: outputs}
+	return c.Run(ctx, con)
+}
+
 var (
 	autocleanMu       sync.Mutex
 	autocleanRegistry = set.New[string]()
@@ -117,4 +176,5 @@ func cleanDecoder(con *Controller, node *yaml.Node, dir string) (Target, error)
 
 func init() {
 	RegisterYAMLTarget("Clean", cleanDecoder)
+	SetYAMLTagDoc("Clean", "Remove files.")
 }
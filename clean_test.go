@@ -94,3 +94,64 @@ func TestAutoclean(t *testing.T) {
 		t.Errorf("got %v, want %v", err, fs.ErrNotExist)
 	}
 }
+
+func TestCleanOutputs(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		a   = filepath.Join(tmpdir, "a")
+		b   = filepath.Join(tmpdir, "b")
+		in  = filepath.Join(tmpdir, "in")
+		con = NewController(tmpdir)
+		ctx = context.Background()
+	)
+	for _, f := range []string{a, b, in} {
+		if err := os.WriteFile(f, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		buildA = Files(&Command{Shell: "touch a"}, []string{in}, []string{a})
+		buildB = Files(&Command{Shell: "touch b"}, []string{a}, []string{b})
+	)
+	if _, err := con.RegisterTarget("BuildA", "", buildA); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := con.RegisterTarget("BuildB", "", Seq(buildB)); err != nil {
+		t.Fatal(err)
+	}
+
+	exists := func(file string) bool {
+		_, err := os.Stat(file)
+		return err == nil
+	}
+
+	// Dry run removes nothing.
+	if err := con.CleanOutputs(WithDryRun(ctx, true)); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(a) || !exists(b) {
+		t.Fatal("files removed in dry-run mode")
+	}
+
+	if err := con.CleanOutputs(ctx, buildA); err != nil {
+		t.Fatal(err)
+	}
+	if exists(a) || !exists(b) {
+		t.Errorf("after cleaning BuildA: a exists = %v, b exists = %v; want false, true", exists(a), exists(b))
+	}
+
+	if err := con.CleanOutputs(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if exists(b) || !exists(in) {
+		t.Errorf("after cleaning everything: b exists = %v, in exists = %v; want false, true", exists(b), exists(in))
+	}
+}
@@ -0,0 +1,143 @@
+package fab
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultEnvAllow is the list of environment variables
+// that commands inherit from Fab's own environment
+// even when running in a clean environment.
+// It includes the variables that programs generally need in order to work at all
+// (such as PATH and, on Windows, SystemRoot),
+// but nothing that typically changes what a build produces.
+var defaultEnvAllow = []string{
+	"HOME",
+	"LANG",
+	"LOGNAME",
+	"PATH",
+	"TERM",
+	"TMPDIR",
+	"USER",
+
+	// Windows.
+	"ComSpec",
+	"PATHEXT",
+	"SystemRoot",
+	"TEMP",
+	"TMP",
+	"USERPROFILE",
+	"windir",
+}
+
+// SetCleanEnv tells whether every [Command] run by con
+// should run in a clean environment,
+// as if its CleanEnv field were set.
+// The allow list names environment variables,
+// beyond a default set,
+// that commands still inherit from Fab's environment;
+// see Command.EnvAllow.
+//
+// The clean environment applies also to the commands of [CommandSucceeds] conditions,
+// and is what "fab env" reports
+// (see [Controller.WriteEnv]).
+//
+// The setting may also be made in the top-level fab.yaml file
+// with the _clean_env declaration.
+// Its value is either a boolean,
+// or a list of environment variables to allow
+// (which implies true).
+//
+// Example:
+//
+//	_clean_env: [GOPATH, GOCACHE]
+func (con *Controller) SetCleanEnv(clean bool, allow ...string) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	con.cleanEnv = clean
+	con.envAllow = allow
+}
+
+// CleanEnv returns the setting made with [Controller.SetCleanEnv].
+func (con *Controller) CleanEnv() (bool, []string) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	return con.cleanEnv, con.envAllow
+}
+
+// baseEnv returns the environment that a command run by con inherits,
+// before the settings from [WithEnv] and the command's own are added.
+// That is all of Fab's own environment,
+// unless clean is true or con has a clean-environment setting,
+// in which case it is only the allowed variables
+// (the default ones,
+// those allowed with [Controller.SetCleanEnv],
+// and those in allow).
+func (con *Controller) baseEnv(clean bool, allow []string) []string {
+	conClean, conAllow := con.CleanEnv()
+	if !clean && !conClean {
+		return os.Environ()
+	}
+	return filterEnv(os.Environ(), defaultEnvAllow, conAllow, allow)
+}
+
+// filterEnv returns the VAR=VALUE strings in env
+// whose variables are named in one of the allow lists.
+// On Windows,
+// where environment variable names are case-insensitive,
+// so is the comparison.
+func filterEnv(env []string, allow ...[]string) []string {
+	names := make(map[string]bool)
+	for _, list := range allow {
+		for _, name := range list {
+			names[envKey(name)] = true
+		}
+	}
+
+	var result []string
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if names[envKey(name)] {
+			result = append(result, kv)
+		}
+	}
+	return result
+}
+
+func envKey(name string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToUpper(name)
+	}
+	return name
+}
+
+// readCleanEnvDecl handles the _clean_env declaration in a top-level fab.yaml file.
+// See [Controller.SetCleanEnv].
+func (con *Controller) readCleanEnvDecl(node *yaml.Node, dir string) error {
+	if dir != "" {
+		return fmt.Errorf("_clean_env declaration is allowed only in the top-level YAML file")
+	}
+
+	if node.Kind == yaml.ScalarNode {
+		clean, err := strconv.ParseBool(node.Value)
+		if err != nil {
+			return fmt.Errorf("_clean_env value %s is neither a boolean nor a list", node.Value)
+		}
+		con.SetCleanEnv(clean)
+		return nil
+	}
+
+	allow, err := con.YAMLStringList(node, dir)
+	if err != nil {
+		return err
+	}
+	con.SetCleanEnv(true, allow...)
+	return nil
+}
@@ -0,0 +1,125 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterEnv(t *testing.T) {
+	env := []string{"PATH=/bin", "FOO=1", "BAR=2", "BAZ=3"}
+	got := filterEnv(env, []string{"PATH"}, nil, []string{"BAZ", "QUUX"})
+	want := []string{"PATH=/bin", "BAZ=3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCleanEnv(t *testing.T) {
+	t.Setenv("FAB_TEST_CLEAN_ENV_A", "a")
+	t.Setenv("FAB_TEST_CLEAN_ENV_B", "b")
+
+	const shell = "echo x${FAB_TEST_CLEAN_ENV_A}x${FAB_TEST_CLEAN_ENV_B}x${FAB_TEST_CLEAN_ENV_C}x"
+
+	cases := []struct {
+		name     string
+		conClean bool
+		conAllow []string
+		cmd      Command
+		want     string
+	}{{
+		name: "inherit",
+		want: "xaxbxx",
+	}, {
+		name: "clean",
+		cmd:  Command{CleanEnv: true},
+		want: "xxxx",
+	}, {
+		name: "clean_allow",
+		cmd:  Command{CleanEnv: true, EnvAllow: []string{"FAB_TEST_CLEAN_ENV_B"}},
+		want: "xxbxx",
+	}, {
+		name: "clean_env",
+		cmd:  Command{CleanEnv: true, Env: []string{"FAB_TEST_CLEAN_ENV_C=c"}},
+		want: "xxxcx",
+	}, {
+		name:     "controller",
+		conClean: true,
+		conAllow: []string{"FAB_TEST_CLEAN_ENV_A"},
+		cmd:      Command{EnvAllow: []string{"FAB_TEST_CLEAN_ENV_B"}},
+		want:     "xaxbxx",
+	}, {
+		name:     "controller_no_allow",
+		conClean: true,
+		want:     "xxxx",
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			con := NewController("")
+			con.SetCleanEnv(tc.conClean, tc.conAllow...)
+
+			buf := new(bytes.Buffer)
+			cmd := tc.cmd
+			cmd.Shell = shell
+			cmd.Stdout = buf
+			if err := cmd.Run(context.Background(), con); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(buf.String()); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCleanEnvDecl(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		yaml      string
+		wantClean bool
+		wantAllow []string
+		wantErr   bool
+	}{{
+		yaml:      "_clean_env: true",
+		wantClean: true,
+	}, {
+		yaml: "_clean_env: false",
+	}, {
+		yaml:      "_clean_env: [GOPATH, GOCACHE]",
+		wantClean: true,
+		wantAllow: []string{"GOPATH", "GOCACHE"},
+	}, {
+		yaml:    "_clean_env: bogus",
+		wantErr: true,
+	}}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.yaml, func(t *testing.T) {
+			t.Parallel()
+
+			con := NewController("")
+			err := con.ReadYAML(strings.NewReader(tc.yaml), "")
+			if tc.wantErr {
+				if err == nil {
+					t.Error("got no error, want one")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			clean, allow := con.CleanEnv()
+			if clean != tc.wantClean {
+				t.Errorf("got clean %v, want %v", clean, tc.wantClean)
+			}
+			if !reflect.DeepEqual(allow, tc.wantAllow) {
+				t.Errorf("got allow %v, want %v", allow, tc.wantAllow)
+			}
+		})
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"time"
 
 	"github.com/bobg/fab"
 	_ "github.com/bobg/fab/golang"
@@ -23,28 +25,171 @@ func main() {
 	}
 
 	var (
-		fabdir  string
-		verbose bool
-		list    bool
-		force   bool
-		dryrun  bool
+		fabdir     string
+		verbose    bool
+		list       bool
+		jsonList   bool
+		force      bool
+		dryrun     bool
+		flaky      bool
+		prune      bool
+		watch      bool
+		graph      string
+		cache      string
+		artifacts  string
+		toolenv    bool
+		host       string
+		timings    bool
+		lanes      bool
+		ui         bool
+		tag        string
+		trace      string
+		timeout    time.Duration
+		grace      time.Duration
+		guard      bool
+		traceFiles bool
+		trustMtime bool
+		audit      bool
+		auditURL   string
+		limits     fab.Limits
+		clean      bool
+		progress   string
+		daemon     bool
+		env        bool
+		describe   bool
+		explain    bool
+		keepGoing  bool
+		failFast   bool
 	)
 	flag.StringVar(&fabdir, "fab", filepath.Join(cacheDir, "fab"), "directory containing fab DB and compiled drivers")
 	flag.BoolVar(&verbose, "v", false, "run verbosely")
 	flag.BoolVar(&list, "list", false, "list available targets")
+	flag.BoolVar(&jsonList, "json", false, "with -list or -describe, write JSON")
 	flag.BoolVar(&force, "f", false, "force compilation of -bin executable")
 	flag.BoolVar(&dryrun, "n", false, "dry run mode")
+	flag.BoolVar(&flaky, "flaky", false, "report on flaky targets")
+	flag.BoolVar(&prune, "prune-outputs", false, "remove files that targets no longer list as outputs")
+	flag.BoolVar(&watch, "watch", false, "rerun targets when their input files change")
+	flag.StringVar(&graph, "graph", "", "write the target dependency graph in this format (dot or json)")
+	flag.StringVar(&cache, "cache", "", "URL of a shared hash DB to use instead of the local one")
+	flag.StringVar(&artifacts, "artifacts", "", "directory for saving and restoring output files")
+	flag.BoolVar(&toolenv, "toolenv", false, "give commands the environment from .tool-versions and .envrc")
+	flag.StringVar(&host, "host", "", "run targets on this remote host via ssh and rsync")
+	flag.BoolVar(&timings, "timings", false, "print per-target run times")
+	flag.BoolVar(&lanes, "lanes", false, "label concurrent targets' output by lane and chart their overlap")
+	flag.StringVar(&tag, "tag", "", "run the targets having any of these comma-separated tags")
+	flag.BoolVar(&ui, "ui", false, "show a full-screen, interactive display of the running targets")
+	flag.StringVar(&trace, "trace", "", "write per-target run times to this file in Chrome trace-event format")
+	flag.DurationVar(&timeout, "timeout", 0, "time limit for running targets")
+	flag.DurationVar(&grace, "grace", 10*time.Second, "with -timeout, time allowed for cleanup before commands are killed")
+	flag.BoolVar(&guard, "guard", false, "warn about input files that change while targets are running")
+	flag.BoolVar(&audit, "audit", false, "append a record of who ran which targets, and the result, to the audit log in the fab directory")
+	flag.StringVar(&auditURL, "audit-url", "", "also send audit records to this URL (implies -audit)")
+	flag.BoolVar(&traceFiles, "trace-files", false, "trace the files that targets read and write (Linux, using strace) and warn about undeclared ones")
+	flag.BoolVar(&trustMtime, "trust-mtime", true, "skip rehashing input files whose size, modification time, and inode are unchanged")
+	flag.BoolVar(&keepGoing, "k", false, "keep going: run the targets that don't depend on a failing one")
+	flag.BoolVar(&failFast, "fail-fast", false, "when a target fails, cancel running targets and start no more")
+	flag.IntVar(&limits.MaxDepth, "max-depth", 0, "fail targets nested more deeply than this (0 for no limit)")
+	flag.IntVar(&limits.MaxTargets, "max-targets", 0, "fail after running this many distinct targets (0 for no limit)")
+	flag.BoolVar(&clean, "clean", false, "remove the output files of the given targets (or of all targets) instead of running them")
+	flag.StringVar(&progress, "progress", "auto", "report progress in this format (text, json, status, or auto for status on a terminal except in verbose mode)")
+	flag.BoolVar(&describe, "describe", false, "print the resolved structure of the given targets instead of running them")
+	flag.BoolVar(&explain, "explain", false, "report why the given targets are not up to date instead of running them")
+	flag.BoolVar(&daemon, "daemon", false, "keep the driver compiled and run it for other fab processes in this project, until interrupted")
 	flag.Parse()
 
+	if flag.NArg() > 0 && flag.Arg(0) == fab.CompletionArg {
+		if flag.NArg() != 2 {
+			fmt.Println("Usage: fab completion bash|zsh|fish")
+			os.Exit(1)
+		}
+		if err := fab.WriteCompletion(os.Stdout, flag.Arg(1)); err != nil {
+			fmt.Printf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var (
+		args        = flag.Args()
+		doctor      bool
+		fix         bool
+		installHook bool
+		forceHook   bool
+		printHook   bool
+	)
+	if len(args) > 0 {
+		switch args[0] {
+		case fab.EnvArg:
+			env, args = true, args[1:]
+
+		case fab.DoctorArg:
+			fs := flag.NewFlagSet("fab doctor", flag.ExitOnError)
+			fs.BoolVar(&fix, "fix", false, "repair problems where that can be done safely")
+			fs.Parse(args[1:]) // ExitOnError means no error to check
+			doctor, args = true, nil
+
+		case fab.PreCommitArg:
+			fs := flag.NewFlagSet("fab pre-commit", flag.ExitOnError)
+			fs.BoolVar(&forceHook, "force", false, "replace an existing pre-commit hook")
+			fs.BoolVar(&printHook, "print", false, "print the hook instead of installing it")
+			fs.Parse(args[1:]) // ExitOnError means no error to check
+			installHook, args = true, fs.Args()
+		}
+	}
+
 	m := fab.Main{
-		Fabdir:  fabdir,
-		Verbose: verbose,
-		List:    list,
-		Force:   force,
-		DryRun:  dryrun,
-		Args:    flag.Args(),
+		Fabdir:        fabdir,
+		Verbose:       verbose,
+		List:          list,
+		JSON:          jsonList,
+		Force:         force,
+		DryRun:        dryrun,
+		Flaky:         flaky,
+		PruneOutputs:  prune,
+		Watch:         watch,
+		Graph:         graph,
+		Cache:         cache,
+		Artifacts:     artifacts,
+		ToolEnv:       toolenv,
+		Host:          host,
+		Timings:       timings,
+		Lanes:         lanes,
+		UI:            ui,
+		Tag:           tag,
+		Trace:         trace,
+		Timeout:       timeout,
+		Grace:         grace,
+		Guard:         guard,
+		TraceFiles:    traceFiles,
+		DistrustMtime: !trustMtime,
+		Audit:         audit,
+		AuditURL:      auditURL,
+		KeepGoing:     keepGoing,
+		FailFast:      failFast,
+		Limits:        limits,
+		Clean:         clean,
+		Progress:      progress,
+		Doctor:        doctor,
+		Fix:           fix,
+		Env:           env,
+		Describe:      describe,
+		Explain:       explain,
+		Daemon:        daemon,
+		InstallHook:   installHook,
+		ForceHook:     forceHook,
+		PrintHook:     printHook,
+		Args:          args,
+	}
+
+	ctx := context.Background()
+	if daemon {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
 	}
-	if err := m.Run(context.Background()); err != nil {
+
+	if err := m.Run(ctx); err != nil {
 		fmt.Printf("Error: %s\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,123 @@
+package fab
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// CommandOutput runs a shell command in the given directory
+// and returns the lines of its standard output,
+// with surrounding whitespace trimmed
+// and blank lines left out.
+// The command runs with $SHELL,
+// or /bin/sh if that is not set
+// (see [Command] for Windows).
+//
+// This is for computing a list of strings,
+// such as the input files of a [Files] target,
+// with a tool like git ls-files or find.
+// If the command fails,
+// the error is a [CommandErr] containing the command's standard error.
+//
+// In YAML,
+// a !CommandOutput node produces the same list.
+// It may be a string,
+// the command to run:
+//
+//	In: !CommandOutput git ls-files '*.go'
+//
+// or a mapping with a Shell field and an optional Dir field:
+//
+//	In: !CommandOutput
+//	  Shell: find . -name '*.proto'
+//	  Dir: proto
+//
+// The command runs when the YAML is read,
+// in the directory of the YAML file
+// (or in Dir, relative to that).
+// Its output is relative to that directory too,
+// so when it is a list of files they are interpreted correctly.
+func CommandOutput(ctx context.Context, dir, shell string) ([]string, error) {
+	var stdout, stderr bytes.Buffer
+
+	sh, args := shellArgv(shellProgram(), shell)
+	cmd := exec.CommandContext(ctx, sh, args...)
+	setShellCmdLine(cmd)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), GetEnv(ctx)...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, CommandErr{Err: errors.Wrapf(err, "running %s", shell), Output: stderr.Bytes()}
+	}
+
+	var (
+		result []string
+		sc     = bufio.NewScanner(&stdout)
+	)
+	sc.Buffer(nil, 1024*1024)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			result = append(result, line)
+		}
+	}
+	return result, errors.Wrapf(sc.Err(), "reading output of %s", shell)
+}
+
+func commandOutputDecoder(con *Controller, node *yaml.Node, dir string) ([]string, error) {
+	var co struct {
+		Shell string `yaml:"Shell"`
+		Dir   string `yaml:"Dir"`
+	}
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		co.Shell = node.Value
+
+	case yaml.MappingNode:
+		if err := node.Decode(&co); err != nil {
+			return nil, errors.Wrap(err, "YAML error decoding CommandOutput")
+		}
+
+	default:
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	if strings.TrimSpace(co.Shell) == "" {
+		return nil, errors.New("!CommandOutput requires a command")
+	}
+
+	cmdDir := con.JoinPath(dir, co.Dir)
+	if cmdDir == "" {
+		cmdDir = "."
+	}
+
+	result, err := CommandOutput(context.Background(), cmdDir, co.Shell)
+	if err != nil {
+		return nil, errors.Wrap(err, "in CommandOutput")
+	}
+	if co.Dir == "" {
+		return result, nil
+	}
+
+	// Make the results relative to dir rather than to co.Dir.
+	for i, s := range result {
+		if !filepath.IsAbs(s) {
+			result[i] = filepath.Join(co.Dir, s)
+		}
+	}
+	return result, nil
+}
+
+func init() {
+	RegisterYAMLStringList("CommandOutput", commandOutputDecoder)
+	SetYAMLTagDoc("CommandOutput", "List the lines of output of a shell command, run when the YAML is read.")
+}
@@ -0,0 +1,82 @@
+package fab
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommandOutput(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	got, err := CommandOutput(ctx, ".", "printf 'a\\n\\n  b c  \\nd\\n'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	_, err = CommandOutput(ctx, ".", "echo oops >&2; exit 1")
+	var cerr CommandErr
+	if !errors.As(err, &cerr) {
+		t.Fatalf("got error %v, want a CommandErr", err)
+	}
+	if !strings.Contains(string(cerr.Output), "oops") {
+		t.Errorf("got output %q, want it to contain oops", cerr.Output)
+	}
+}
+
+func TestCommandOutputYAML(t *testing.T) {
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpdir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		if err := os.WriteFile(filepath.Join(tmpdir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const yml = `
+Top: !Files
+  Target: !Command
+    Shell: echo hello
+  In: !CommandOutput ls *.txt
+
+Sub: !Files
+  Target: !Command
+    Shell: echo hello
+  In: !CommandOutput
+    Shell: ls *.txt
+    Dir: sub
+`
+
+	con := NewController(tmpdir)
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"Top": filepath.Join(tmpdir, "a.txt"),
+		"Sub": filepath.Join(tmpdir, "sub", "b.txt"),
+	}
+	for name, want := range cases {
+		target, _ := con.RegistryTarget(name)
+		ft, ok := target.(*files)
+		if !ok {
+			t.Fatalf("%s: got %T, want *files", name, target)
+		}
+		if len(ft.In) != 1 || ft.In[0] != want {
+			t.Errorf("%s: got In %v, want [%s]", name, ft.In, want)
+		}
+	}
+}
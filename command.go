@@ -1,13 +1,15 @@
 package fab
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bobg/errors"
 	"github.com/bobg/go-generics/v2/slices"
@@ -50,6 +52,26 @@ import (
 //   - Dir, the directory in which the command should run,
 //     either absolute or relative to the directory in which the YAML file is found.
 //   - Env, a list of VAR=VALUE strings to add to the command's environment.
+//   - EnvFile, the name of a .env-style file of variable settings to add to the command's environment
+//     (see the EnvFile field below),
+//     either absolute or relative to the directory in which the YAML file is found.
+//   - NoWrapper, a boolean that, when true, means to run the command without the command wrapper
+//     (see [Controller.SetCommandWrapper]).
+//   - NoMkdir, a boolean that, when true, means not to create the parent directories of Stdout and Stderr files
+//     (see the NoMkdir field below).
+//   - Timeout, a duration string as parsed by [time.ParseDuration], e.g. 5m,
+//     limiting how long each attempt to run the command may take.
+//   - Retries, the number of times to retry the command after a failure.
+//   - CombinedOutput, a boolean that, when true, means to send the command's error output
+//     to the same place as its standard output,
+//     preserving their relative order.
+//     Stderr must not also be given.
+//   - Timestamps, a boolean that, when true, means to prefix each line of the command's output
+//     with the time it was produced.
+//   - Throttle, a number that, when greater than zero, summarizes the command's verbose output
+//     as described for the Throttle field below.
+//   - Expand, a boolean that, when true, means Fab expands variable references in Shell
+//     as described for the Expand field below.
 //
 // As a special case,
 // a !Command whose shell is a list instead of a single string
@@ -68,6 +90,11 @@ type Command struct {
 	// as a single string with command name and arguments together.
 	// It is invoked with $SHELL -c,
 	// with $SHELL defaulting to /bin/sh.
+	// On Windows,
+	// $SHELL defaults to sh if that is in the PATH,
+	// and otherwise to cmd.exe,
+	// which is invoked with /C
+	// (as is PowerShell with -Command, when $SHELL names it).
 	//
 	// If you prefer to specify a command that is not executed by a shell,
 	// leave Shell blank and fill in Cmd and Args instead.
@@ -172,6 +199,139 @@ type Command struct {
 
 	// Env is a list of VAR=VALUE strings to add to the environment when the command runs.
 	Env []string `json:"env,omitempty"`
+
+	// EnvFile is the name of a .env-style file
+	// whose settings are added to the environment when the command runs.
+	// They come after any environment from [WithEnv]
+	// and before Env,
+	// so Env can override them.
+	//
+	// Each line of the file is VAR=VALUE,
+	// optionally preceded by "export".
+	// Blank lines and lines beginning with # are ignored.
+	// A VALUE in single quotes is taken literally.
+	// A VALUE in double quotes may contain the escapes \n, \t, \", \\, and \$.
+	// Only a comment may follow the closing quote.
+	// In an unquoted VALUE,
+	// a # preceded by whitespace begins a comment.
+	// In unquoted and double-quoted values,
+	// ${NAME} is replaced with the value of NAME,
+	// looked up first among the earlier lines of the file
+	// and then in the rest of the command's environment.
+	// An undefined NAME is replaced with the empty string.
+	// Write $${NAME} for a literal ${NAME}.
+	//
+	// The file is also an input of any [Files] target that runs this command,
+	// so that changing it causes the Files target to run again.
+	// It is an error for the file not to exist when the command runs,
+	// except in dry-run mode (see [WithDryRun]).
+	EnvFile string `json:"env_file,omitempty"`
+
+	// CleanEnv, if true,
+	// means the command does not inherit all of Fab's own environment,
+	// only a few variables that programs generally need,
+	// such as PATH and HOME,
+	// plus those named in EnvAllow.
+	// The settings from Env and from [WithEnv] are added to that.
+	// This makes the command's behavior
+	// (and so the validity of a [Files] target's cached result)
+	// independent of stray variables in the user's environment.
+	// See also [Controller.SetCleanEnv].
+	CleanEnv bool `json:"clean_env,omitempty"`
+
+	// EnvAllow names environment variables,
+	// beyond the default ones,
+	// that the command inherits from Fab's environment
+	// when it runs in a clean environment
+	// (see CleanEnv).
+	EnvAllow []string `json:"env_allow,omitempty"`
+
+	// HashEnv names environment variables whose values
+	// go into the hash of any [Files] target that runs this command,
+	// so that changing one causes the Files target to run again.
+	// See [HashEnv].
+	HashEnv []string `json:"hash_env,omitempty"`
+
+	// HashTool, if not empty,
+	// puts the identity of the program that the command runs
+	// into the hash of any [Files] target that runs this command,
+	// so that e.g. upgrading the compiler causes the Files target to run again.
+	// The program is Cmd,
+	// or the first word of Shell,
+	// found in the PATH.
+	// Its identity is its resolved path
+	// together with a digest of either the program file itself,
+	// if HashTool is [ToolDigest] ("digest"),
+	// or its output when run with the space-separated arguments in HashTool,
+	// such as "--version"
+	// (or "version" for the go command).
+	HashTool string `json:"hash_tool,omitempty"`
+
+	// NoWrapper, if true, means not to run the command with the command wrapper.
+	// See [Controller.SetCommandWrapper].
+	NoWrapper bool `json:"no_wrapper,omitempty"`
+
+	// NoMkdir, if true,
+	// means not to create missing parent directories of StdoutFile and StderrFile
+	// before opening them.
+	NoMkdir bool `json:"no_mkdir,omitempty"`
+
+	// Timeout, if positive,
+	// limits how long each attempt to run the command may take.
+	// When it is exceeded,
+	// the command is interrupted
+	// (see [WithGracePeriod]).
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// Retries is the number of times to retry the command after a failure,
+	// waiting a second before the first retry
+	// and doubling the wait before each subsequent one.
+	// See also [Retry].
+	Retries int `json:"retries,omitempty"`
+
+	// CombinedOutput, if true,
+	// sends the command's error output to the same destination as its standard output
+	// (determined by Stdout, StdoutFile, or StdoutFn, or the default as described for Stdout),
+	// using a single pipe so that the relative order of the two streams is preserved.
+	// It is an error to set Stderr, StderrFile, or StderrFn as well.
+	CombinedOutput bool `json:"combined_output,omitempty"`
+
+	// Timestamps, if true,
+	// prefixes each line of the command's output with the time it was produced,
+	// which can help in debugging tools with racy output.
+	Timestamps bool `json:"timestamps,omitempty"`
+
+	// Throttle, if greater than zero,
+	// summarizes the command's output when it is copied to Fab's own output in verbose mode
+	// (i.e., when Stdout or Stderr is defaulted as described above).
+	// This keeps CI logs readable for tools that report progress noisily.
+	// A line rewritten with carriage returns,
+	// such as a progress bar,
+	// collapses to its final version.
+	// Then, of the resulting lines,
+	// only the first and every Throttle'th one after that is shown,
+	// along with the last one,
+	// and a note of how many were omitted.
+	Throttle int `json:"throttle,omitempty"`
+
+	// Expand, if true,
+	// means that Fab itself expands each ${NAME} in Shell
+	// before passing it to the shell,
+	// so that the command means the same thing whatever $SHELL is.
+	// NAME is looked up first in the command's environment
+	// (including Env and any environment from [WithEnv]),
+	// and then among the variables of the top-level YAML file
+	// (see [Controller.Var]).
+	// A reference to an undefined variable is an error.
+	//
+	// To pass a literal ${NAME} to the shell,
+	// write $${NAME}.
+	// (In a YAML file,
+	// $${NAME} is also not replaced with the value of a YAML variable;
+	// see [Controller.Interpolate].)
+	// Only the ${NAME} form is expanded;
+	// $NAME and other shell syntax are left alone.
+	Expand bool `json:"expand,omitempty"`
 }
 
 var _ Target = &Command{}
@@ -185,22 +345,53 @@ func Shellf(format string, args ...any) *Command {
 }
 
 // Run implements Target.Run.
-func (c *Command) Run(ctx context.Context, con *Controller) (err error) {
-	var (
-		cmdname = c.Cmd
-		args    = c.Args
-	)
-	if cmdname == "" {
-		if cmdname = os.Getenv("SHELL"); cmdname == "" {
-			cmdname = "/bin/sh"
+func (c *Command) Run(ctx context.Context, con *Controller) error {
+	return withRetries(ctx, con, c, c.Retries, defaultRetryBackoff, func() error {
+		return c.runOnce(ctx, con)
+	})
+}
+
+func (c *Command) runOnce(ctx context.Context, con *Controller) (err error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+		defer func() {
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				err = errors.Wrapf(err, "timed out after %s", c.Timeout)
+			}
+		}()
+	}
+
+	env, err := c.environ(ctx, con)
+	if err != nil {
+		return err
+	}
+
+	shell := c.Shell
+	if c.Expand {
+		if shell, err = c.expandShell(con, env); err != nil {
+			return err
 		}
-		args = []string{"-c", c.Shell}
 	}
 
+	cmdname, args := c.argv(con, shell)
+	sb := getSandbox(ctx)
+	dir := sb.path(c.Dir)
+	if tr := getFileTracer(ctx); tr != nil && !GetDryRun(ctx) {
+		cmdname, args = tr.wrap(cmdname, args, dir, sb)
+	}
 	cmd := exec.CommandContext(ctx, cmdname, args...)
+	setShellCmdLine(cmd)
+	if grace := GetGracePeriod(ctx); grace > 0 {
+		// When ctx is canceled,
+		// give the command a chance to exit cleanly before it is killed.
+		cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+		cmd.WaitDelay = grace
+	}
 
-	cmd.Dir = c.Dir
-	cmd.Env = append(os.Environ(), c.Env...)
+	cmd.Dir = dir
+	cmd.Env = env
 
 	if GetDryRun(ctx) {
 		if GetVerbose(ctx) {
@@ -224,11 +415,31 @@ func (c *Command) Run(ctx context.Context, con *Controller) (err error) {
 	if stderrAppend {
 		stderrFile = strings.TrimLeft(stderrFile, "> ")
 	}
+	if sb != nil {
+		// See Hermetic.
+		for _, file := range []*string{&stdoutFile, &stderrFile} {
+			if *file != "" {
+				*file = sb.path(*file)
+			}
+		}
+	}
+
+	if c.CombinedOutput && (c.Stderr != nil || stderrFile != "" || c.StderrFn != nil) {
+		return fmt.Errorf("CombinedOutput is incompatible with Stderr, StderrFile, and StderrFn")
+	}
 
 	if stdoutFile == stderrFile && stdoutAppend != stderrAppend {
 		return fmt.Errorf("stdout and stderr name the same file but disagree about append vs. overwrite")
 	}
 
+	if !c.NoMkdir {
+		for _, file := range []string{stdoutFile, stderrFile} {
+			if err := mkdirParent(file); err != nil {
+				return err
+			}
+		}
+	}
+
 	if stdoutFile != "" {
 		if stdoutAppend {
 			f, err := os.OpenFile(stdoutFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
@@ -307,43 +518,157 @@ func (c *Command) Run(ctx context.Context, con *Controller) (err error) {
 		}
 	}
 
-	var buf bytes.Buffer
+	var (
+		buf       = &spillBuffer{limit: outputMemLimit}
+		captured  = io.Writer(buf)
+		throttles []*throttleWriter
+		redactors []*redactWriter
+	)
+
+	// Secrets are redacted from output that goes to Fab's own output
+	// or into a CommandErr.
+	redact := func(w io.Writer) io.Writer {
+		if !con.hasSecrets() {
+			return w
+		}
+		r := &redactWriter{con: con, w: w}
+		redactors = append(redactors, r)
+		return r
+	}
 
 	if GetVerbose(ctx) {
+		throttle := func(w io.Writer) io.Writer {
+			if c.Throttle <= 0 {
+				return w
+			}
+			t := &throttleWriter{w: w, every: c.Throttle}
+			throttles = append(throttles, t)
+			return t
+		}
 		if cmd.Stdout == nil {
-			cmd.Stdout = con.IndentingCopier(os.Stdout, "    ")
+			cmd.Stdout = throttle(redact(&progressWriter{ctx: ctx, con: con, target: c, stream: "stdout"}))
 		}
 		if cmd.Stderr == nil {
-			cmd.Stderr = con.IndentingCopier(os.Stderr, "    ")
+			cmd.Stderr = throttle(redact(&progressWriter{ctx: ctx, con: con, target: c, stream: "stderr"}))
 		}
 		con.Indentf("  Running command %s", cmd)
 	} else {
+		captured = redact(buf)
 		if cmd.Stdout == nil {
-			cmd.Stdout = &buf
+			cmd.Stdout = captured
 		}
 		if cmd.Stderr == nil {
-			cmd.Stderr = &buf
+			cmd.Stderr = captured
+		}
+	}
+
+	if c.CombinedOutput {
+		// Using the same writer for both streams gives the command a single pipe for both.
+		cmd.Stderr = cmd.Stdout
+	}
+	if c.Timestamps {
+		// Keep a single pipe for both streams if there was one.
+		shared := c.CombinedOutput || (cmd.Stdout == captured && cmd.Stderr == captured)
+
+		stdout := &timestampWriter{w: cmd.Stdout, bol: true}
+		cmd.Stdout = stdout
+		if shared {
+			cmd.Stderr = stdout
+		} else {
+			cmd.Stderr = &timestampWriter{w: cmd.Stderr, bol: true}
 		}
 	}
 
 	cmd.Stdin = c.Stdin
 	if c.StdinFile != "" {
-		f, err := os.Open(c.StdinFile)
+		stdinFile := c.StdinFile
+		if sb != nil {
+			stdinFile = sb.path(stdinFile)
+		}
+		f, err := os.Open(stdinFile)
 		if err != nil {
-			return errors.Wrapf(err, "opening %s", c.StdinFile)
+			return errors.Wrapf(err, "opening %s", stdinFile)
 		}
 		defer f.Close()
 		cmd.Stdin = f
 	}
 
-	err = cmd.Run()
-	if err != nil && buf.Len() > 0 {
-		err = CommandErr{
-			Err:    err,
-			Output: buf.Bytes(),
+	runErr := cmd.Run()
+	for _, t := range throttles {
+		if err := t.flush(); err != nil && runErr == nil {
+			runErr = err
+		}
+	}
+	for _, r := range redactors {
+		if err := r.flush(); err != nil && runErr == nil {
+			runErr = err
 		}
 	}
-	return err
+
+	return buf.result(runErr, outputTailSize)
+}
+
+// argv returns the name of the program to run and its arguments,
+// taking account of the shell string (normally c.Shell)
+// and of any command wrapper.
+func (c *Command) argv(con *Controller, shell string) (string, []string) {
+	var (
+		cmdname = c.Cmd
+		args    = c.Args
+	)
+	if cmdname == "" {
+		cmdname, args = shellArgv(shellProgram(), shell)
+	}
+	if wrapper := con.CommandWrapper(); len(wrapper) > 0 && !c.NoWrapper {
+		args = append(append(slices.Clip(wrapper[1:]), cmdname), args...)
+		cmdname = wrapper[0]
+	}
+	return cmdname, args
+}
+
+// environ returns the environment in which to run the command.
+func (c *Command) environ(ctx context.Context, con *Controller) ([]string, error) {
+	env := append(con.baseEnv(c.CleanEnv, c.EnvAllow), GetEnv(ctx)...)
+	if c.EnvFile != "" {
+		fileEnv, err := c.readEnvFile(getSandbox(ctx), env)
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && GetDryRun(ctx):
+			// The file may be the output of a target
+			// that a dry run does not run.
+		case err != nil:
+			return nil, err
+		default:
+			env = append(env, fileEnv...)
+		}
+	}
+	return append(env, c.Env...), nil
+}
+
+// expandShell expands the ${NAME} references in c.Shell
+// as described for the Expand field,
+// looking up names first in env.
+func (c *Command) expandShell(con *Controller, env []string) (string, error) {
+	var undefined []string
+	result := varRefRegex.ReplaceAllStringFunc(c.Shell, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		name := ref[2 : len(ref)-1]
+		for i := len(env) - 1; i >= 0; i-- {
+			if value, ok := strings.CutPrefix(env[i], name+"="); ok {
+				return value
+			}
+		}
+		if value, ok := con.Var(name, ""); ok {
+			return value
+		}
+		undefined = append(undefined, name)
+		return ref
+	})
+	if len(undefined) > 0 {
+		return "", fmt.Errorf("undefined variable(s) in Shell: %s", strings.Join(undefined, ", "))
+	}
+	return result, nil
 }
 
 // Desc implements Target.Desc.
@@ -351,17 +676,57 @@ func (*Command) Desc() string {
 	return "Command"
 }
 
+// timestampWriter is an io.Writer that prefixes each line with the current time.
+type timestampWriter struct {
+	w io.Writer
+
+	mu  sync.Mutex // protects bol
+	bol bool       // at the beginning of a line
+}
+
+func (t *timestampWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var (
+		stamp = time.Now().Format("15:04:05.000 ")
+		buf   = make([]byte, 0, len(p)+len(stamp))
+	)
+	for _, b := range p {
+		if t.bol {
+			buf = append(buf, stamp...)
+		}
+		buf = append(buf, b)
+		t.bol = b == '\n'
+	}
+	if _, err := t.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
 // CommandErr is a type of error that may be returned from command.Run.
 // If the command's Stdout or Stderr field was nil,
 // then that output from the subprocess is in CommandErr.Output
 // and the underlying error is in CommandErr.Err.
+// Output beyond the first megabyte spills to a temporary file,
+// named in CommandErr.OutputFile.
 type CommandErr struct {
 	Err    error
 	Output []byte
+
+	// OutputFile, if non-empty,
+	// is a file containing the command's complete output,
+	// which was too large to keep in memory.
+	// In that case Output contains only the end of it.
+	OutputFile string
 }
 
 // Error implements error.Error.
 func (e CommandErr) Error() string {
+	if e.OutputFile != "" {
+		return fmt.Sprintf("%s; full output in %s; last %d bytes follow\n%s", e.Err, e.OutputFile, len(e.Output), string(e.Output))
+	}
 	return fmt.Sprintf("%s; output follows\n%s", e.Err, string(e.Output))
 }
 
@@ -388,6 +753,20 @@ func commandDecoder(con *Controller, node *yaml.Node, dir string) (Target, error
 	if err != nil {
 		return nil, errors.Wrap(err, "YAML error decoding Command.Env")
 	}
+	envAllow, err := con.YAMLStringList(&c.EnvAllow, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding Command.EnvAllow")
+	}
+	hashEnv, err := con.YAMLStringList(&c.HashEnv, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding Command.HashEnv")
+	}
+	var timeout time.Duration
+	if c.Timeout != "" {
+		if timeout, err = time.ParseDuration(c.Timeout); err != nil {
+			return nil, errors.Wrap(err, "parsing Command.Timeout")
+		}
+	}
 
 	if c.Cmd == "" {
 		strs, err := con.YAMLStringList(&c.Shell, dir)
@@ -405,7 +784,7 @@ func commandDecoder(con *Controller, node *yaml.Node, dir string) (Target, error
 			// Make this a Seq of identical-except-for-the-shell-string Commands.
 
 			targets, err := slices.Mapx(strs, func(idx int, str string) (Target, error) {
-				return c.toTarget(con, str, dir, args, env, idx > 0), nil
+				return c.toTarget(con, str, dir, args, env, envAllow, hashEnv, timeout, idx > 0), nil
 			})
 			return Seq(targets...), err
 		}
@@ -423,7 +802,7 @@ func commandDecoder(con *Controller, node *yaml.Node, dir string) (Target, error
 		return nil, errors.Wrap(BadYAMLNodeKindError{Got: c.Shell.Kind, Want: yaml.ScalarNode}, "in Command.Shell node")
 	}
 
-	return c.toTarget(con, shell, dir, args, env, false), nil
+	return c.toTarget(con, shell, dir, args, env, envAllow, hashEnv, timeout, false), nil
 }
 
 type commandYAML struct {
@@ -435,15 +814,48 @@ type commandYAML struct {
 	Stderr string    `yaml:"Stderr"`
 	Dir    string    `yaml:"Dir"`
 	Env    yaml.Node `yaml:"Env"`
+
+	EnvFile  string    `yaml:"EnvFile"`
+	CleanEnv bool      `yaml:"CleanEnv"`
+	EnvAllow yaml.Node `yaml:"EnvAllow"`
+	HashEnv  yaml.Node `yaml:"HashEnv"`
+	HashTool string    `yaml:"HashTool"`
+
+	NoWrapper      bool   `yaml:"NoWrapper"`
+	NoMkdir        bool   `yaml:"NoMkdir"`
+	Timeout        string `yaml:"Timeout"`
+	Retries        int    `yaml:"Retries"`
+	CombinedOutput bool   `yaml:"CombinedOutput"`
+	Timestamps     bool   `yaml:"Timestamps"`
+	Throttle       int    `yaml:"Throttle"`
+	Expand         bool   `yaml:"Expand"`
 }
 
-func (c commandYAML) toTarget(con *Controller, shell, dir string, args, env []string, forceAppend bool) Target {
+func (c commandYAML) toTarget(con *Controller, shell, dir string, args, env, envAllow, hashEnv []string, timeout time.Duration, forceAppend bool) Target {
 	result := &Command{
 		Shell: shell,
 		Cmd:   c.Cmd,
 		Args:  args,
 		Dir:   con.JoinPath(dir, c.Dir),
 		Env:   env,
+
+		CleanEnv:  c.CleanEnv,
+		EnvAllow:  envAllow,
+		HashEnv:   hashEnv,
+		HashTool:  c.HashTool,
+		NoWrapper: c.NoWrapper,
+		NoMkdir:   c.NoMkdir,
+		Timeout:   timeout,
+		Retries:   c.Retries,
+
+		CombinedOutput: c.CombinedOutput,
+		Timestamps:     c.Timestamps,
+		Throttle:       c.Throttle,
+		Expand:         c.Expand,
+	}
+
+	if c.EnvFile != "" {
+		result.EnvFile = con.JoinPath(dir, c.EnvFile)
 	}
 
 	if c.Stdin == "$stdin" {
@@ -507,14 +919,14 @@ func (c commandYAML) toTarget(con *Controller, shell, dir string, args, env []st
 
 func deferredIndent(w io.Writer) func(context.Context, *Controller) io.Writer {
 	return func(_ context.Context, con *Controller) io.Writer {
-		return con.IndentingCopier(w, "    ")
+		return con.IndentingCopier(w, con.TextStyle().OutputPrefix)
 	}
 }
 
 func maybeIndent(w io.Writer) func(context.Context, *Controller) io.Writer {
 	return func(ctx context.Context, con *Controller) io.Writer {
 		if GetVerbose(ctx) {
-			return con.IndentingCopier(w, "    ")
+			return con.IndentingCopier(w, con.TextStyle().OutputPrefix)
 		}
 		return nil
 	}
@@ -522,4 +934,5 @@ func maybeIndent(w io.Writer) func(context.Context, *Controller) io.Writer {
 
 func init() {
 	RegisterYAMLTarget("Command", commandDecoder)
+	SetYAMLTagDoc("Command", "Run a shell command or a program.")
 }
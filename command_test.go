@@ -8,6 +8,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -140,3 +142,152 @@ func TestCommand(t *testing.T) {
 		}
 	})
 }
+
+func TestCombinedOutput(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		con   = NewController("")
+		ctx   = context.Background()
+		shell = "echo a; echo b >&2; echo c; echo d >&2"
+		out   = filepath.Join(tmpdir, "out")
+		stamp = regexp.MustCompile(`^\d\d:\d\d:\d\d\.\d\d\d `)
+	)
+
+	c := &Command{Shell: shell, StdoutFile: out, CombinedOutput: true}
+	if err := con.Run(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "a\nb\nc\nd\n" {
+		t.Errorf("got %q, want %q", string(got), "a\nb\nc\nd\n")
+	}
+
+	c = &Command{Shell: shell, StdoutFile: out, CombinedOutput: true, Timestamps: true}
+	if err := con.Run(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	got, err = os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(got), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4", len(lines))
+	}
+	for i, line := range lines {
+		if !stamp.MatchString(line) || !strings.HasSuffix(line, string(rune('a'+i))) {
+			t.Errorf("line %d is %q", i, line)
+		}
+	}
+
+	c = &Command{Shell: shell + "; false", Timestamps: true}
+	var cerr CommandErr
+	if err := con.Run(ctx, c); !errors.As(err, &cerr) {
+		t.Fatalf("got error %v, want CommandErr", err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(cerr.Output), "\n"), "\n") {
+		if !stamp.MatchString(line) {
+			t.Errorf("line %q has no timestamp", line)
+		}
+	}
+
+	c = &Command{Shell: shell, StdoutFile: out, StderrFile: out, CombinedOutput: true}
+	if err := con.Run(ctx, c); err == nil {
+		t.Error("got no error for CombinedOutput with StderrFile")
+	}
+}
+
+func TestCommandMkdir(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		con    = NewController("")
+		ctx    = context.Background()
+		stdout = filepath.Join(tmpdir, "out", "stdout")
+		stderr = filepath.Join(tmpdir, "err", "stderr")
+	)
+
+	c := &Command{Shell: "echo a; echo b >&2", StdoutFile: stdout, StderrFile: ">>" + stderr, NoMkdir: true}
+	if err := con.Run(ctx, c); err == nil {
+		t.Error("got no error with NoMkdir")
+	}
+
+	con = NewController("")
+	c = &Command{Shell: "echo a; echo b >&2", StdoutFile: stdout, StderrFile: ">>" + stderr}
+	if err := con.Run(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]string{stdout: "a\n", stderr: "b\n"} {
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("got %q in %s, want %q", got, file, want)
+		}
+	}
+}
+
+func TestCommandExpand(t *testing.T) {
+	t.Parallel()
+
+	const yml = `
+_vars:
+  GREETING: hello
+
+Echo: !Command
+  Shell: echo ${GREETING} ${WHO} $${WHO}
+  Env: [WHO=world]
+  Expand: true
+`
+
+	con := NewController("")
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+	target, _ := con.RegistryTarget("Echo")
+	c, ok := target.(*Command)
+	if !ok {
+		t.Fatalf("got %T, want *Command", target)
+	}
+
+	// The YAML variable GREETING is interpolated when the YAML is read.
+	// The escaped reference is not.
+	if c.Shell != "echo hello ${WHO} $${WHO}" {
+		t.Errorf("got Shell %q", c.Shell)
+	}
+
+	buf := new(bytes.Buffer)
+	c.Stdout = buf
+	if err := con.Run(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+
+	// The shell sees "echo hello world ${WHO}",
+	// in which it expands ${WHO} to world too.
+	if got := buf.String(); got != "hello world world\n" {
+		t.Errorf("got %q, want %q", got, "hello world world\n")
+	}
+
+	con = NewController("")
+	c = &Command{Shell: "echo ${FAB_SURELY_UNDEFINED}", Expand: true}
+	if err := con.Run(context.Background(), c); err == nil || !strings.Contains(err.Error(), "FAB_SURELY_UNDEFINED") {
+		t.Errorf("got error %v, want one about an undefined variable", err)
+	}
+}
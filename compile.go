@@ -1,24 +1,27 @@
 package fab
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"go/ast"
 	"go/doc"
 	"go/parser"
 	"go/token"
-	"io"
+	"go/types"
+	"io/fs"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
 
 	"github.com/bobg/errors"
 	"github.com/bobg/go-generics/v2/maps"
+	"github.com/bobg/go-generics/v2/set"
 	"github.com/bobg/go-generics/v2/slices"
-	"golang.org/x/mod/modfile"
 	"golang.org/x/tools/go/packages"
 )
 
@@ -27,9 +30,14 @@ import (
 // and places the executable result in a given file.
 // The driver converts command-line target names into the necessary Fab rule invocations.
 //
-// The package of user code should contain one or more exported identifiers
-// whose types satisfy the [Target] interface.
+// The package of user code should contain one or more exported variables
+// whose types satisfy the [Target] interface,
+// and/or exported functions that take no arguments
+// and return a Target
+// (or a Target and an error).
 // These become the build rules that the driver can invoke.
+// A function is called only when its target is needed
+// (see [Lazy]).
 //
 // When Compile runs
 // the "go" program must exist in the user's PATH.
@@ -39,22 +47,50 @@ import (
 //
 //   - The user's code is loaded with packages.Load.
 //   - The set of exported top-level identifiers is filtered
-//     to find those implementing the fab.Target interface.
-//   - The user's code is then copied to a temp directory
-//     together with a main package (and main() function)
-//     that registers (with Register) that set of targets.
+//     to find the variables implementing the fab.Target interface
+//     and the functions returning one.
+//   - A main package (and main() function)
+//     that registers (with Register) that set of targets
+//     is written to a build directory
+//     (a temp directory, or the one given to [CompilePackageDir])
+//     together with a copy of Fab's own code.
 //   - The go compiler is invoked to produce an executable,
 //     which is renamed into place as binfile.
 //
-// For the synthesized calls to Register on Target-valued variables,
-// the driver uses the variable's name as the "name" argument
-// and the variable's doc comment as the "doc" argument.
+// When the user's package is in a Go module,
+// the driver is compiled as part of that module,
+// as with "go run" on a file outside the module,
+// so the user's package is compiled in place
+// and may import any other package in its module,
+// including "internal" ones.
+// The compiler uses a copy of the user's go.mod file
+// (via the -modfile flag)
+// that replaces github.com/bobg/fab with the copy of Fab's code.
+// (If the user's module is Fab itself, its own code is used.)
+//
+// Otherwise,
+// the user's code is copied into the build directory too,
+// where it is combined with the main package in a synthesized module.
+//
+// Either way,
+// the go compiler is first run with GOPROXY=off,
+// so it uses only modules already in the module cache,
+// which is normally enough,
+// since the user's own builds put them there.
+// If that fails,
+// and GOPROXY=off is not also set in the environment,
+// Compile tries again,
+// allowing modules to be downloaded.
+//
+// For the synthesized calls to Register on Target-valued variables and functions,
+// the driver uses the variable's or function's name as the "name" argument
+// and its doc comment as the target's doc string.
 //
 // The user's code is able to make its own calls to Register during program initialization
 // in order to augment the set of available targets.
 func Compile(ctx context.Context, pkgdir, binfile string) error {
 	config := &packages.Config{
-		Mode:    packages.NeedName | packages.NeedFiles | packages.NeedTypes | packages.NeedDeps,
+		Mode:    LoadMode,
 		Context: ctx,
 		Dir:     pkgdir,
 	}
@@ -78,28 +114,332 @@ func Compile(ctx context.Context, pkgdir, binfile string) error {
 // The call to packages.Load must use a value for Config.Mode that contains at least the bits in LoadMode.
 // See Compile for further details.
 func CompilePackage(ctx context.Context, pkg *packages.Package, binfile string) error {
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		return errors.Wrap(err, "creating tempdir")
+	}
+	defer os.RemoveAll(tmpdir)
+
+	return CompilePackageDir(ctx, pkg, tmpdir, binfile)
+}
+
+// CompilePackageDir is like [CompilePackage]
+// but assembles the driver's code in builddir,
+// which it creates if necessary,
+// instead of in a temporary directory.
+//
+// Reusing the same builddir for a given package
+// lets the go compiler reuse its build cache,
+// which depends on the paths of the files it compiles,
+// making recompilation of the driver much faster.
+// Files in builddir whose contents have not changed are left alone,
+// and files not belonging to the driver are removed,
+// so builddir should be dedicated to this purpose.
+func CompilePackageDir(ctx context.Context, pkg *packages.Package, builddir, binfile string) error {
+	if len(pkg.GoFiles) == 0 {
+		return fmt.Errorf("no Go files in package")
+	}
+	topdir := filepath.Dir(filepath.Dir(pkg.GoFiles[0]))
+	return CompilePackages(ctx, topdir, []*packages.Package{pkg}, builddir, binfile)
+}
+
+// CompilePackages is like [CompilePackageDir]
+// but compiles a single driver from multiple packages,
+// as loaded by packages.Load,
+// for a project whose Go rules are in _fab subdirectories of more than one directory.
+//
+// The targets of the package in topdir/_fab are registered under their own names,
+// and those of the package in topdir/foo/_fab are registered with the prefix foo/
+// (see [Controller.Namespace]),
+// mirroring the way targets in fab.yaml files in subdirectories are named.
+// The packages must all be in the same module,
+// or all be in none.
+func CompilePackages(ctx context.Context, topdir string, pkgs []*packages.Package, builddir, binfile string) error {
+	if len(pkgs) == 0 {
+		return fmt.Errorf("no packages")
+	}
+
+	topdir, err := filepath.Abs(topdir)
+	if err != nil {
+		return errors.Wrapf(err, "getting absolute path of %s", topdir)
+	}
+
+	var (
+		dpkgs    []*driverPackage
+		first    = pkgs[0]
+		inModule = first.Module != nil && first.Module.GoMod != ""
+	)
+	for i, pkg := range pkgs {
+		if inModule != (pkg.Module != nil && pkg.Module.GoMod != "") || (inModule && pkg.Module.Path != first.Module.Path) {
+			return fmt.Errorf("packages %s and %s are not in the same module", first.PkgPath, pkg.PkgPath)
+		}
+		dpkg, err := newDriverPackage(pkg, topdir)
+		if err != nil {
+			return err
+		}
+		dpkg.Alias = fmt.Sprintf("subpkg%d", i)
+		dpkgs = append(dpkgs, dpkg)
+	}
+
+	builddir, err = filepath.Abs(builddir)
+	if err != nil {
+		return errors.Wrapf(err, "getting absolute path of %s", builddir)
+	}
+
+	tree := newDriverTree(builddir)
+
+	if !inModule || first.Module.Path != fabModulePath {
+		if err = tree.populateFab(); err != nil {
+			return errors.Wrap(err, "copying fab code")
+		}
+	}
+
+	if !inModule {
+		// The user's packages are not in a module,
+		// so copy them into the driver's own module.
+		for _, dpkg := range dpkgs {
+			rel := path.Join("pkg", dpkg.rel)
+			dpkg.Import = driverModulePath + "/" + rel
+			if err = tree.copyPackage(dpkg.dir, filepath.FromSlash(rel)); err != nil {
+				return errors.Wrapf(err, "copying %s", dpkg.dir)
+			}
+		}
+	}
+
+	data := struct {
+		Packages []*driverPackage
+	}{
+		Packages: dpkgs,
+	}
+
+	tmpl := template.New("")
+	_, err = tmpl.Parse(driverStr)
+	if err != nil {
+		return errors.Wrap(err, "parsing driver template")
+	}
+	driverBuf := new(bytes.Buffer)
+	if err = tmpl.Execute(driverBuf, data); err != nil {
+		return errors.Wrap(err, "rendering driver.go template")
+	}
+	if err = tree.writeFile("driver.go", driverBuf.Bytes()); err != nil {
+		return errors.Wrap(err, "writing driver.go")
+	}
+
+	if inModule {
+		err = writeUserDriverModule(tree, first.Module)
+	} else {
+		err = writeDriverModule(tree, first.Module)
+	}
+	if err != nil {
+		return errors.Wrap(err, "writing driver module files")
+	}
+	if err = tree.prune(); err != nil {
+		return errors.Wrap(err, "removing stale files from build dir")
+	}
+
+	binpath := filepath.Join(builddir, driverModulePath)
+	if inModule {
+		err = buildDriver(ctx, first.Module.Dir, false, "-modfile", filepath.Join(builddir, "go.mod"), "-mod=mod", "-o", binpath, filepath.Join(builddir, "driver.go"))
+	} else {
+		err = buildDriver(ctx, builddir, true, "-mod=mod", "-o", binpath)
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(binpath, binfile)
+}
+
+// fabPackageDirs returns the directories of the _fab packages of the project in topdir,
+// relative to topdir:
+// _fab, if it exists,
+// followed by the _fab subdirectories of the project's other directories, in sorted order.
+// Directories are skipped as in [Controller.ReadAllYAMLFiles].
+func fabPackageDirs(topdir string) ([]string, error) {
+	var dirs []string
+	err := filepath.WalkDir(topdir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != topdir {
+			name := entry.Name()
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "node_modules" {
+				return fs.SkipDir
+			}
+		}
+		info, err := os.Stat(filepath.Join(path, "_fab"))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "statting %s/_fab", path)
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(topdir, filepath.Join(path, "_fab"))
+		if err != nil {
+			return errors.Wrapf(err, "getting relative path from %s to %s", topdir, path)
+		}
+		dirs = append(dirs, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "walking %s", topdir)
+	}
+
+	sort.Slice(dirs, func(i, j int) bool {
+		if dirs[i] == "_fab" || dirs[j] == "_fab" {
+			return dirs[i] == "_fab"
+		}
+		return dirs[i] < dirs[j]
+	})
+
+	return dirs, nil
+}
+
+// loadFabPackages loads the packages in dirs,
+// which are relative to topdir,
+// in the same order.
+func loadFabPackages(ctx context.Context, topdir string, dirs []string) ([]*packages.Package, error) {
+	config := &packages.Config{
+		Mode:    LoadMode,
+		Context: ctx,
+		Dir:     topdir,
+	}
+	patterns := slices.Map(dirs, func(dir string) string { return "./" + filepath.ToSlash(dir) })
+	pkgs, err := packages.Load(config, patterns...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading %s", strings.Join(dirs, ", "))
+	}
+
+	byDir := make(map[string]*packages.Package)
+	for _, pkg := range pkgs {
+		if len(pkg.GoFiles) == 0 {
+			continue
+		}
+		byDir[realPath(filepath.Dir(pkg.GoFiles[0]))] = pkg
+	}
+
+	var result []*packages.Package
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(filepath.Join(topdir, dir))
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting absolute path of %s", dir)
+		}
+		pkg, ok := byDir[realPath(abs)]
+		if !ok {
+			return nil, fmt.Errorf("no Go package found in %s", dir)
+		}
+		if len(pkg.Errors) > 0 {
+			var err error
+			for _, e := range pkg.Errors {
+				err = errors.Join(err, e)
+			}
+			return nil, errors.Wrapf(err, "loading package %s", pkg.Name)
+		}
+		result = append(result, pkg)
+	}
+	return result, nil
+}
+
+// realPath returns path with symbolic links resolved,
+// or path itself if that fails.
+func realPath(path string) string {
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		return p
+	}
+	return path
+}
+
+// driverPackage is one of the user's packages compiled into a driver.
+type driverPackage struct {
+	Alias   string // the name under which the driver imports the package
+	Import  string // the import path of the package
+	Prefix  string // the prefix for the names of the package's targets, "" for the top-level package
+	Targets []*targetPair
+
+	dir string // the package's directory
+	rel string // the package's directory relative to the project's top directory, with slashes
+}
+
+type targetPair struct {
+	Name, Doc string
+
+	// Results is the number of results (1 or 2) of a function producing the target,
+	// or 0 if the target is a variable.
+	Results int
+}
+
+// targetFuncResults tells whether fn is a function that the driver can use to produce a target:
+// one taking no arguments and returning a [Target],
+// or a Target and an error.
+// It returns the number of results (1 or 2) if so,
+// and 0 otherwise.
+func targetFuncResults(fn *types.Func) int {
+	sig, ok := fn.Type().(*types.Signature)
+	if !ok || sig.Recv() != nil || sig.TypeParams().Len() > 0 || sig.Params().Len() > 0 {
+		return 0
+	}
+	results := sig.Results()
+	switch results.Len() {
+	case 1:
+	case 2:
+		if !types.Identical(results.At(1).Type(), types.Universe.Lookup("error").Type()) {
+			return 0
+		}
+	default:
+		return 0
+	}
+	if err := checkImplementsTarget(results.At(0).Type()); err != nil {
+		return 0
+	}
+	return results.Len()
+}
+
+// newDriverPackage finds the exported targets in pkg
+// for compiling into a driver
+// for the project in topdir.
+func newDriverPackage(pkg *packages.Package, topdir string) (*driverPackage, error) {
 	if len(pkg.Errors) > 0 {
 		var err error
 		for _, e := range pkg.Errors {
 			err = errors.Join(err, e)
 		}
-		return errors.Wrapf(err, "loading package %s", pkg.Name)
+		return nil, errors.Wrapf(err, "loading package %s", pkg.Name)
 	}
 
 	if len(pkg.GoFiles) == 0 {
-		return fmt.Errorf("no Go files in package")
+		return nil, fmt.Errorf("no Go files in package %s", pkg.PkgPath)
 	}
 
 	var (
 		fset   = token.NewFileSet()
 		pkgdir = filepath.Dir(pkg.GoFiles[0])
 	)
+
+	rel, err := filepath.Rel(realPath(topdir), realPath(pkgdir))
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting relative path from %s to %s", topdir, pkgdir)
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return nil, fmt.Errorf("package %s is not in %s", pkg.PkgPath, topdir)
+	}
+	prefix := path.Dir(rel)
+	if prefix == "." {
+		prefix = ""
+	}
+
 	astpkgs, err := parser.ParseDir(fset, pkgdir, nil, parser.ParseComments)
 	if err != nil {
-		return errors.Wrapf(err, "parsing %s", pkgdir)
+		return nil, errors.Wrapf(err, "parsing %s", pkgdir)
 	}
 	if len(astpkgs) != 1 {
-		return fmt.Errorf(
+		return nil, fmt.Errorf(
 			"parsed %d packages in %s, want 1 %v",
 			len(astpkgs),
 			pkgdir,
@@ -108,12 +448,9 @@ func CompilePackage(ctx context.Context, pkg *packages.Package, binfile string)
 	}
 	astpkg, ok := astpkgs[pkg.Name]
 	if !ok {
-		return fmt.Errorf("package %s not found in %s", pkg.Name, pkgdir)
+		return nil, fmt.Errorf("package %s not found in %s", pkg.Name, pkgdir)
 	}
 
-	type targetPair struct {
-		Name, Doc string
-	}
 	var (
 		scope   = pkg.Types.Scope()
 		idents  = scope.Names()
@@ -123,14 +460,18 @@ func CompilePackage(ctx context.Context, pkg *packages.Package, binfile string)
 		if !ast.IsExported(ident) {
 			continue
 		}
-		obj := scope.Lookup(ident)
-		if obj == nil {
-			continue
-		}
-		if err := checkImplementsTarget(obj.Type()); err != nil {
-			continue
+		switch obj := scope.Lookup(ident).(type) {
+		case *types.Var:
+			if err := checkImplementsTarget(obj.Type()); err != nil {
+				continue
+			}
+			targets[ident] = &targetPair{Name: ident, Doc: `""`}
+
+		case *types.Func:
+			if n := targetFuncResults(obj); n > 0 {
+				targets[ident] = &targetPair{Name: ident, Doc: `""`, Results: n}
+			}
 		}
-		targets[ident] = &targetPair{Name: ident}
 	}
 
 	var (
@@ -138,141 +479,145 @@ func CompilePackage(ctx context.Context, pkg *packages.Package, binfile string)
 		parser = dpkg.Parser()
 		pr     = dpkg.Printer()
 	)
+	setDoc := func(name, docstr string) {
+		if tp, ok := targets[name]; ok {
+			dstr := string(pr.Text(parser.Parse(docstr)))
+			dstr = strings.TrimRight(dstr, "\r\n")
+			tp.Doc = strconv.Quote(dstr)
+		}
+	}
 	for _, v := range dpkg.Vars {
 		for _, name := range v.Names {
-			if tp, ok := targets[name]; ok {
-				dstr := string(pr.Text(parser.Parse(v.Doc)))
-				dstr = strings.TrimRight(dstr, "\r\n")
-				tp.Doc = strconv.Quote(dstr)
-			}
+			setDoc(name, v.Doc)
 		}
 	}
-
-	tmpdir, err := os.MkdirTemp("", "fab")
-	if err != nil {
-		return errors.Wrap(err, "creating tempdir")
+	for _, f := range dpkg.Funcs {
+		setDoc(f.Name, f.Doc)
 	}
-	defer os.RemoveAll(tmpdir)
-
-	if err = populateFabDir(tmpdir); err != nil {
-		return errors.Wrap(err, "copying fab code")
+	for _, t := range dpkg.Types {
+		// Functions returning a type defined in the package are grouped with the type.
+		for _, f := range t.Funcs {
+			setDoc(f.Name, f.Doc)
+		}
 	}
 
-	subpkgdir := filepath.Join(tmpdir, "pkg", pkg.Name)
-	if err = os.MkdirAll(subpkgdir, 0755); err != nil {
-		return errors.Wrapf(err, "creating %s", subpkgdir)
+	result := &driverPackage{
+		Import:  pkg.PkgPath,
+		Prefix:  prefix,
+		Targets: maps.Values(targets),
+		dir:     pkgdir,
+		rel:     rel,
 	}
+	sort.Slice(result.Targets, func(i, j int) bool { return result.Targets[i].Name < result.Targets[j].Name })
 
-	entries, err := os.ReadDir(pkgdir)
-	if err != nil {
-		return errors.Wrapf(err, "reading entries from %s", pkgdir)
-	}
+	return result, nil
+}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		if strings.HasSuffix(entry.Name(), "_test.go") {
-			continue
-		}
-		if !strings.HasSuffix(entry.Name(), ".go") {
-			continue
-		}
-		if err = copyFile(filepath.Join(pkgdir, entry.Name()), subpkgdir); err != nil {
-			return errors.Wrapf(err, "copying %s to tmp subdir", entry.Name())
-		}
-	}
+// LoadMode is the minimal set of flags to enable for Config.Mode in a call to Packages.Load
+// in order to produce a suitable package object for CompilePackage.
+// (Without NeedModule,
+// CompilePackage cannot tell that the user's package is in a module,
+// so the package cannot import other packages in its module,
+// and compiling it is more likely to need the network.)
+const LoadMode = packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedTypes | packages.NeedDeps | packages.NeedModule
 
-	data := struct {
-		Subpkg  string
-		Targets []*targetPair
-	}{
-		Subpkg:  pkg.Name,
-		Targets: maps.Values(targets),
-	}
+// driverSourceFiles returns the files whose contents determine the driver compiled from pkg:
+// the Go files of pkg,
+// and, when pkg is in a module,
+// those of the packages in the same module that it imports (directly or indirectly)
+// plus the module's go.mod file.
+func driverSourceFiles(pkg *packages.Package) []string {
+	result := append([]string{}, pkg.GoFiles...)
+	if pkg.Module == nil || pkg.Module.GoMod == "" {
+		return result
+	}
+	result = append(result, pkg.Module.GoMod)
 
-	driverOut, err := os.Create(filepath.Join(tmpdir, "driver.go"))
-	if err != nil {
-		return errors.Wrap(err, "creating driver.go in temp dir")
+	seen := set.New[string](pkg.PkgPath)
+	var walk func(*packages.Package)
+	walk = func(p *packages.Package) {
+		for _, imp := range p.Imports {
+			if seen.Has(imp.PkgPath) {
+				continue
+			}
+			seen.Add(imp.PkgPath)
+			if imp.Module == nil || imp.Module.Path != pkg.Module.Path {
+				continue
+			}
+			result = append(result, imp.GoFiles...)
+			walk(imp)
+		}
 	}
-	defer driverOut.Close()
+	walk(pkg)
 
-	tmpl := template.New("")
-	_, err = tmpl.Parse(driverStr)
-	if err != nil {
-		return errors.Wrap(err, "parsing driver template")
-	}
-	if err = tmpl.Execute(driverOut, data); err != nil {
-		return errors.Wrap(err, "rendering driver.go template")
-	}
-	if err = driverOut.Close(); err != nil {
-		return errors.Wrap(err, "closing driver.go")
-	}
+	return result
+}
 
-	cmd := exec.CommandContext(ctx, "go", "mod", "init", "x")
-	cmd.Dir = tmpdir
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("error in go mod init fab: %w; output follows\n%s", err, string(output))
-	}
+// driverTree writes the files of a driver's build directory.
+// A file whose contents are already correct is left alone,
+// and the files written are recorded
+// so that any others can be removed with prune.
+type driverTree struct {
+	dir     string
+	written set.Of[string] // paths relative to dir
+}
 
-	gomodPath := filepath.Join(tmpdir, "go.mod")
-	gomodData, err := os.ReadFile(gomodPath)
-	if err != nil {
-		return errors.Wrapf(err, "reading %s", gomodPath)
-	}
-	mf, err := modfile.Parse(gomodPath, gomodData, nil)
-	if err != nil {
-		return errors.Wrapf(err, "parsing %s", gomodPath)
-	}
-	if err = mf.AddReplace("github.com/bobg/fab", "", "./fab", ""); err != nil {
-		return errors.Wrapf(err, "adding replace directive in %s", gomodPath)
-	}
-	gomodData, err = mf.Format()
-	if err != nil {
-		return errors.Wrapf(err, "formatting go.mod in %s", gomodPath)
-	}
-	if err = os.WriteFile(gomodPath, gomodData, 0644); err != nil {
-		return errors.Wrapf(err, "rewriting %s", gomodPath)
-	}
+func newDriverTree(dir string) *driverTree {
+	return &driverTree{dir: dir, written: set.New[string]()}
+}
 
-	cmd = exec.CommandContext(ctx, "go", "mod", "tidy")
-	cmd.Dir = tmpdir
-	output, err = cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("error in go mod tidy: %w; output follows\n%s", err, string(output))
-	}
+// writeFile writes contents to the file at rel,
+// a path relative to the tree's directory,
+// unless the file already has those contents.
+func (t *driverTree) writeFile(rel string, contents []byte) error {
+	t.written.Add(rel)
 
-	cmd = exec.CommandContext(ctx, "go", "build")
-	cmd.Dir = tmpdir
-	output, err = cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("error in go build: %w; output follows\n%s", err, string(output))
+	dest := filepath.Join(t.dir, rel)
+	if existing, err := os.ReadFile(dest); err == nil && bytes.Equal(existing, contents) {
+		return nil
 	}
-
-	return os.Rename(filepath.Join(tmpdir, "x"), binfile)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return errors.Wrapf(err, "creating %s", filepath.Dir(dest))
+	}
+	return errors.Wrapf(os.WriteFile(dest, contents, 0644), "writing %s", dest)
 }
 
-// LoadMode is the minimal set of flags to enable for Config.Mode in a call to Packages.Load
-// in order to produce a suitable package object for CompilePackage.
-const LoadMode = packages.NeedName | packages.NeedFiles | packages.NeedTypes | packages.NeedDeps
+// prune removes the files in the tree's directory that were not written with writeFile,
+// such as ones left over from an earlier version of the user's package.
+func (t *driverTree) prune() error {
+	return filepath.WalkDir(t.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(t.dir, path)
+		if err != nil {
+			return errors.Wrapf(err, "getting relative path to %s", path)
+		}
+		if t.written.Has(rel) {
+			return nil
+		}
+		return errors.Wrapf(os.Remove(path), "removing %s", path)
+	})
+}
 
-func populateFabDir(tmpdir string) error {
-	return populateFabSubdir(filepath.Join(tmpdir, "fab"), ".")
+// populateFab writes the embedded copy of Fab's own code
+// to the fab subdirectory of the tree.
+func (t *driverTree) populateFab() error {
+	return t.populateFabSubdir(".")
 }
 
-func populateFabSubdir(destdir, subdir string) error {
-	if err := os.MkdirAll(destdir, 0755); err != nil {
-		return errors.Wrapf(err, "creating %s", destdir)
-	}
+func (t *driverTree) populateFabSubdir(subdir string) error {
 	entries, err := embeds.ReadDir(subdir)
 	if err != nil {
 		return errors.Wrap(err, "reading embeds")
 	}
 	for _, entry := range entries {
+		name := filepath.Join(subdir, entry.Name())
 		if entry.IsDir() {
-			err = populateFabSubdir(filepath.Join(destdir, entry.Name()), filepath.Join(subdir, entry.Name()))
-			if err != nil {
+			if err = t.populateFabSubdir(name); err != nil {
 				return errors.Wrapf(err, "populating dir %s", entry.Name())
 			}
 			continue
@@ -280,33 +625,46 @@ func populateFabSubdir(destdir, subdir string) error {
 		if strings.HasSuffix(entry.Name(), "_test.go") {
 			continue
 		}
-		contents, err := embeds.ReadFile(filepath.Join(subdir, entry.Name()))
+		contents, err := embeds.ReadFile(name)
 		if err != nil {
 			return errors.Wrapf(err, "reading embedded file %s", entry.Name())
 		}
-		dest := filepath.Join(destdir, entry.Name())
-		err = os.WriteFile(dest, contents, 0644)
-		if err != nil {
-			return errors.Wrapf(err, "writing %s", dest)
+		if err = t.writeFile(filepath.Join("fab", name), contents); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func copyFile(filename, destdir string) error {
-	outfilename := filepath.Join(destdir, filepath.Base(filename))
-	out, err := os.OpenFile(outfilename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
-	if err != nil {
-		return errors.Wrapf(err, "creating %s", outfilename)
-	}
-	defer out.Close()
+func populateFabDir(dir string) error {
+	return newDriverTree(dir).populateFab()
+}
 
-	in, err := os.Open(filename)
+// copyPackage copies the non-test Go files in pkgdir
+// to the subdirectory rel of the tree.
+func (t *driverTree) copyPackage(pkgdir, rel string) error {
+	entries, err := os.ReadDir(pkgdir)
 	if err != nil {
-		return errors.Wrapf(err, "opening %s", filename)
+		return errors.Wrapf(err, "reading entries from %s", pkgdir)
 	}
-	defer in.Close()
 
-	_, err = io.Copy(out, in)
-	return errors.Wrapf(err, "copying %s to %s", filename, destdir)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), "_test.go") {
+			continue
+		}
+		if !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+		contents, err := os.ReadFile(filepath.Join(pkgdir, entry.Name()))
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", entry.Name())
+		}
+		if err = t.writeFile(filepath.Join(rel, entry.Name()), contents); err != nil {
+			return errors.Wrapf(err, "copying %s to build dir", entry.Name())
+		}
+	}
+	return nil
 }
@@ -1,15 +1,27 @@
 package fab
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"text/template"
 	"time"
 
 	"github.com/otiai10/copy"
+	"golang.org/x/tools/go/packages"
 )
 
 func TestCompile(t *testing.T) {
@@ -99,6 +111,208 @@ func TestCompile(t *testing.T) {
 	})
 }
 
+func TestDriverTree(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	tree := newDriverTree(dir)
+	if err := tree.writeFile("a.go", []byte("package a\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.writeFile(filepath.Join("sub", "b.go"), []byte("package b\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Backdate a.go so that a rewrite would be detectable.
+	var (
+		afile = filepath.Join(dir, "a.go")
+		old   = time.Now().Add(-time.Hour).Truncate(time.Second)
+	)
+	if err := os.Chtimes(afile, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new tree writes a.go with the same contents and b.go with different contents,
+	// and does not write sub/b.go.
+	tree = newDriverTree(dir)
+	if err := tree.writeFile("a.go", []byte("package a\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.writeFile("b.go", []byte("package b\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(afile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("a.go was rewritten (modtime %s, want %s)", info.ModTime(), old)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.go")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub", "b.go")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v for sub/b.go, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestDriverSourceFiles(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mod   = &packages.Module{Path: "example.com/proj", GoMod: "/proj/go.mod"}
+		other = &packages.Module{Path: "example.com/other"}
+		util  = &packages.Package{PkgPath: "example.com/proj/internal/util", GoFiles: []string{"/proj/internal/util/util.go"}, Module: mod}
+		lib   = &packages.Package{PkgPath: "example.com/proj/lib", GoFiles: []string{"/proj/lib/lib.go"}, Module: mod, Imports: map[string]*packages.Package{"example.com/proj/internal/util": util}}
+		ext   = &packages.Package{PkgPath: "example.com/other", GoFiles: []string{"/other/other.go"}, Module: other}
+		pkg   = &packages.Package{
+			PkgPath: "example.com/proj/_fab",
+			GoFiles: []string{"/proj/_fab/a.go", "/proj/_fab/b.go"},
+			Module:  mod,
+			Imports: map[string]*packages.Package{
+				"example.com/proj/lib":           lib,
+				"example.com/proj/internal/util": util,
+				"example.com/other":              ext,
+				"fmt":                            {PkgPath: "fmt", GoFiles: []string{"/goroot/src/fmt/print.go"}},
+			},
+		}
+	)
+
+	got := driverSourceFiles(pkg)
+	sort.Strings(got)
+	want := []string{"/proj/_fab/a.go", "/proj/_fab/b.go", "/proj/go.mod", "/proj/internal/util/util.go", "/proj/lib/lib.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	pkg.Module = nil
+	got = driverSourceFiles(pkg)
+	if want := pkg.GoFiles; !reflect.DeepEqual(got, want) {
+		t.Errorf("without a module, got %v, want %v", got, want)
+	}
+}
+
+func TestFabPackageDirs(t *testing.T) {
+	t.Parallel()
+
+	topdir := t.TempDir()
+	for _, dir := range []string{"_fab", "a/_fab", "B/_fab", "a/b/_fab", ".hidden/_fab", "vendor/_fab", "_skip/_fab", "c"} {
+		if err := os.MkdirAll(filepath.Join(topdir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(topdir, "c", "_fab"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := fabPackageDirs(topdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"_fab", filepath.Join("B", "_fab"), filepath.Join("a", "_fab"), filepath.Join("a", "b", "_fab")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDriverTemplate(t *testing.T) {
+	t.Parallel()
+
+	data := struct {
+		Packages []*driverPackage
+	}{
+		Packages: []*driverPackage{{
+			Alias:   "subpkg0",
+			Import:  "example.com/proj/_fab",
+			Targets: []*targetPair{{Name: "Build", Doc: `"Build the project."`}},
+		}, {
+			Alias:   "subpkg1",
+			Import:  "example.com/proj/foo/_fab",
+			Prefix:  "foo",
+			Targets: []*targetPair{{Name: "Test", Doc: `""`}, {Name: "Deploy", Doc: `""`, Results: 1}, {Name: "Release", Doc: `""`, Results: 2}},
+		}, {
+			Alias:  "subpkg2",
+			Import: "example.com/proj/bar/_fab",
+			Prefix: "bar",
+		}},
+	}
+
+	tmpl, err := template.New("").Parse(driverStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		t.Fatal(err)
+	}
+	driver := buf.String()
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "driver.go", driver, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`subpkg0 "example.com/proj/_fab"`,
+		`subpkg1 "example.com/proj/foo/_fab"`,
+		`_ "example.com/proj/bar/_fab"`,
+		`con.Register("Build", subpkg0.Build, fab.WithDoc("Build the project."))`,
+		`con.Namespace("foo").Register("Test", subpkg1.Test, fab.WithDoc(""))`,
+		`Error registering target foo/Test`,
+		`Register("Deploy", fab.Lazy(func() (fab.Target, error) { return subpkg1.Deploy(), nil }), fab.WithDoc(""))`,
+		`Register("Release", fab.Lazy(func() (fab.Target, error) { return subpkg1.Release() }), fab.WithDoc(""))`,
+	} {
+		if !strings.Contains(driver, want) {
+			t.Errorf("driver does not contain %s", want)
+		}
+	}
+}
+
+func TestTargetFuncResults(t *testing.T) {
+	t.Parallel()
+
+	const src = `package p
+
+type T struct{}
+
+func (T) Method() error { return nil }
+
+func WithArg(x int) error { return nil }
+
+func NotTarget() int { return 0 }
+
+func NotError() (int, int) { return 0, 0 }
+
+func TooMany() (int, error, error) { return 0, nil, nil }
+`
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := new(types.Config).Check("p", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"WithArg", "NotTarget", "NotError", "TooMany"} {
+		fn := pkg.Scope().Lookup(name).(*types.Func)
+		if n := targetFuncResults(fn); n != 0 {
+			t.Errorf("targetFuncResults(%s) = %d, want 0", name, n)
+		}
+	}
+
+	method, _, _ := types.LookupFieldOrMethod(pkg.Scope().Lookup("T").Type(), false, pkg, "Method")
+	if n := targetFuncResults(method.(*types.Func)); n != 0 {
+		t.Errorf("targetFuncResults(T.Method) = %d, want 0", n)
+	}
+}
+
 func BenchmarkCompile(b *testing.B) {
 	tbCompile(b, func(tmpdir string) {
 		pkgdir := filepath.Join(tmpdir, "compile/_fab")
@@ -0,0 +1,66 @@
+package fab
+
+import (
+	"fmt"
+	"io"
+)
+
+// CompletionArg is the command-line argument
+// that asks the fab command for a shell completion script,
+// as in `fab completion bash`.
+// See [WriteCompletion].
+const CompletionArg = "completion"
+
+// WriteCompletion writes a script for the given shell
+// (bash, zsh, or fish)
+// that completes target names for the fab command.
+// The script gets the names at completion time
+// by running `fab -list -json`
+// (see [Controller.ListTargetsJSON]).
+//
+// For example,
+// to enable completion in bash,
+// add this to .bashrc:
+//
+//	source <(fab completion bash)
+func WriteCompletion(w io.Writer, shell string) error {
+	script, ok := completionScripts[shell]
+	if !ok {
+		return fmt.Errorf("unknown shell %s (want bash, zsh, or fish)", shell)
+	}
+	_, err := io.WriteString(w, script)
+	return err
+}
+
+// Each script extracts target names from the output of `fab -list -json`,
+// which has one target per line.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for fab
+_fab_targets() {
+  fab -list -json 2>/dev/null | sed -n 's/.*"name":"\([^"]*\)".*/\1/p'
+}
+_fab() {
+  local cur="${COMP_WORDS[COMP_CWORD]}"
+  case "$cur" in
+    -*) return ;;
+  esac
+  local IFS=$'\n'
+  COMPREPLY=($(compgen -W "$(_fab_targets)" -- "$cur"))
+}
+complete -F _fab fab
+`,
+
+	"zsh": `#compdef fab
+# zsh completion for fab
+_fab() {
+  local -a targets
+  targets=(${(f)"$(fab -list -json 2>/dev/null | sed -n 's/.*"name":"\([^"]*\)".*/\1/p')"})
+  compadd -a targets
+}
+compdef _fab fab
+`,
+
+	"fish": `# fish completion for fab
+complete -c fab -f -n 'not string match -q -- "-*" (commandline -ct)' -a "(fab -list -json 2>/dev/null | string match -r -g '\"name\":\"([^\"]*)\"')"
+`,
+}
@@ -0,0 +1,104 @@
+package fab
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListTargetsJSON(t *testing.T) {
+	t.Parallel()
+
+	con := NewController("_testdata/foreach")
+	con.SetAlias("b", "a/Build")
+
+	buf := new(bytes.Buffer)
+	if err := con.ListTargetsJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var items []struct {
+		Name string `json:"name"`
+		Doc  string `json:"doc"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &items); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	want := []string{"Build", "a/Build", "a/Test", "b/c/Build", "d/Test", "b"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+	if doc := items[len(items)-1].Doc; doc != "Alias for a/Build" {
+		t.Errorf("got alias doc %q", doc)
+	}
+
+	// One item per line, plus the brackets.
+	if lines := strings.Count(buf.String(), "\n"); lines != len(items)+2 {
+		t.Errorf("got %d lines, want %d", lines, len(items)+2)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	t.Parallel()
+
+	if err := WriteCompletion(new(bytes.Buffer), "tcsh"); err == nil {
+		t.Error("got no error for unknown shell")
+	}
+
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available")
+	}
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	con := NewController("_testdata/foreach")
+	listing := new(bytes.Buffer)
+	if err := con.ListTargetsJSON(listing); err != nil {
+		t.Fatal(err)
+	}
+
+	// A stand-in for fab that produces the listing.
+	var (
+		listingFile = filepath.Join(tmpdir, "listing.json")
+		fakeFab     = "#!/bin/sh\ncat " + listingFile + "\n"
+		script      = new(bytes.Buffer)
+	)
+	if err := os.WriteFile(listingFile, listing.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpdir, "fab"), []byte(fakeFab), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteCompletion(script, "bash"); err != nil {
+		t.Fatal(err)
+	}
+	scriptFile := filepath.Join(tmpdir, "completion.bash")
+	if err := os.WriteFile(scriptFile, script.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(bash, "-c", `source `+scriptFile+`; COMP_WORDS=(fab a/); COMP_CWORD=1; _fab; echo "${COMPREPLY[@]}"`)
+	cmd.Env = append(os.Environ(), "PATH="+tmpdir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+	if got := strings.TrimSpace(string(out)); got != "a/Build a/Test" {
+		t.Errorf("got completions %q, want %q", got, "a/Build a/Test")
+	}
+}
@@ -1,13 +1,28 @@
 package fab
 
-import "context"
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 type (
-	dryrunKeyType  struct{}
-	forceKeyType   struct{}
-	hashDBKeyType  struct{}
-	verboseKeyType struct{}
-	argsKeyType    struct{}
+	dryrunKeyType     struct{}
+	forceKeyType      struct{}
+	hashDBKeyType     struct{}
+	verboseKeyType    struct{}
+	argsKeyType       struct{}
+	fabdirKeyType     struct{}
+	artifactsKeyType  struct{}
+	envKeyType        struct{}
+	graceKeyType      struct{}
+	inputHashKeyType  struct{}
+	trustMtimeKeyType struct{}
+	keepGoingKeyType  struct{}
+	failFastKeyType   struct{}
+	failedKeyType     struct{}
+	paramsKeyType     struct{}
 )
 
 // WithDryRun decorates a context with the value of a "dryrun" boolean.
@@ -74,3 +89,178 @@ func GetArgs(ctx context.Context) []string {
 	val, _ := ctx.Value(argsKeyType{}).([]string)
 	return val
 }
+
+// WithFabdir decorates a context with the name of the directory
+// where Fab keeps its persistent state,
+// such as the hash DB.
+// Retrieve it with [GetFabdir].
+func WithFabdir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, fabdirKeyType{}, dir)
+}
+
+// GetFabdir returns the directory added to `ctx` with [WithFabdir].
+// The default, if WithFabdir was not used, is the empty string.
+func GetFabdir(ctx context.Context) string {
+	val, _ := ctx.Value(fabdirKeyType{}).(string)
+	return val
+}
+
+// WithArtifactStore decorates a context with an [ArtifactStore].
+// Retrieve it with [GetArtifactStore].
+func WithArtifactStore(ctx context.Context, store ArtifactStore) context.Context {
+	return context.WithValue(ctx, artifactsKeyType{}, store)
+}
+
+// GetArtifactStore returns the value of the ArtifactStore added to `ctx` with [WithArtifactStore].
+// The default, if WithArtifactStore was not used, is nil.
+func GetArtifactStore(ctx context.Context) ArtifactStore {
+	store, _ := ctx.Value(artifactsKeyType{}).(ArtifactStore)
+	return store
+}
+
+// WithEnv decorates a context with a list of VAR=VALUE strings
+// to add to the environment of every [Command].
+// A Command's own Env settings take precedence over these.
+// Retrieve it with [GetEnv].
+func WithEnv(ctx context.Context, env []string) context.Context {
+	return context.WithValue(ctx, envKeyType{}, env)
+}
+
+// GetEnv returns the list of VAR=VALUE strings added to `ctx` with [WithEnv].
+// The default, if WithEnv was not used, is nil.
+func GetEnv(ctx context.Context) []string {
+	val, _ := ctx.Value(envKeyType{}).([]string)
+	return val
+}
+
+// WithGracePeriod decorates a context with a grace period:
+// how long to allow for cleanup after the context is canceled
+// or passes its deadline
+// (e.g. because of the -timeout flag).
+// A [Command] running when that happens is interrupted,
+// and killed only if it has not exited after the grace period.
+// The cleanup target in a [Finally] target runs for up to the grace period.
+// Retrieve it with [GetGracePeriod].
+func WithGracePeriod(ctx context.Context, grace time.Duration) context.Context {
+	return context.WithValue(ctx, graceKeyType{}, grace)
+}
+
+// GetGracePeriod returns the grace period added to `ctx` with [WithGracePeriod].
+// The default, if WithGracePeriod was not used, is zero.
+func GetGracePeriod(ctx context.Context) time.Duration {
+	val, _ := ctx.Value(graceKeyType{}).(time.Duration)
+	return val
+}
+
+// WithTrustMtime decorates a context with the value of a "trust mtime" boolean,
+// which tells whether to skip rehashing files
+// whose size, modification time, and inode are unchanged.
+// See [FileHashCache].
+// Retrieve it with [GetTrustMtime].
+func WithTrustMtime(ctx context.Context, trust bool) context.Context {
+	return context.WithValue(ctx, trustMtimeKeyType{}, trust)
+}
+
+// GetTrustMtime returns the value of the "trust mtime" boolean added to `ctx` with [WithTrustMtime].
+// The default, if WithTrustMtime was not used, is true.
+func GetTrustMtime(ctx context.Context) bool {
+	val, ok := ctx.Value(trustMtimeKeyType{}).(bool)
+	return val || !ok
+}
+
+// WithKeepGoing decorates a context with the value of a "keep going" boolean,
+// which tells [Controller.Run] to keep starting targets
+// that don't depend on a failing one,
+// as with make -k.
+// Without it, no more targets are started after the first failure.
+// (A [Seq] target stops at its first failing step either way.)
+// Retrieve it with [GetKeepGoing].
+func WithKeepGoing(ctx context.Context, keepGoing bool) context.Context {
+	return context.WithValue(ctx, keepGoingKeyType{}, keepGoing)
+}
+
+// GetKeepGoing returns the value of the "keep going" boolean added to `ctx` with [WithKeepGoing].
+// The default, if WithKeepGoing was not used, is false.
+func GetKeepGoing(ctx context.Context) bool {
+	val, _ := ctx.Value(keepGoingKeyType{}).(bool)
+	return val
+}
+
+// WithFailFast decorates a context with the value of a "fail fast" boolean,
+// which tells [Controller.Run] to cancel the targets still running
+// when one of them fails,
+// and not to start any more.
+// Retrieve it with [GetFailFast].
+func WithFailFast(ctx context.Context, failFast bool) context.Context {
+	return context.WithValue(ctx, failFastKeyType{}, failFast)
+}
+
+// GetFailFast returns the value of the "fail fast" boolean added to `ctx` with [WithFailFast].
+// The default, if WithFailFast was not used, is false.
+func GetFailFast(ctx context.Context) bool {
+	val, _ := ctx.Value(failFastKeyType{}).(bool)
+	return val
+}
+
+// withFailed decorates a context with a flag
+// that [Controller.Run] sets when a target fails
+// (unless in "keep going" mode),
+// shared by the calls to Run nested inside the one that added it.
+func withFailed(ctx context.Context, failed *atomic.Bool) context.Context {
+	return context.WithValue(ctx, failedKeyType{}, failed)
+}
+
+func getFailed(ctx context.Context) *atomic.Bool {
+	val, _ := ctx.Value(failedKeyType{}).(*atomic.Bool)
+	return val
+}
+
+// withFailureScope decorates a context with a new failure flag (see [withFailed]),
+// so that target failures in the new context don't keep targets from starting in the old one or vice versa.
+// It is for running targets whose failure is not (yet) a failure of the build,
+// as in each attempt of a [Retry] target,
+// or that must run after a failure,
+// as in the cleanup of a [Finally] target.
+func withFailureScope(ctx context.Context) context.Context {
+	return withFailed(ctx, new(atomic.Bool))
+}
+
+// inputHash lazily computes the input hash of a [Files] target.
+type inputHash struct {
+	once sync.Once
+	fn   func() ([]byte, error)
+	h    []byte
+	err  error
+}
+
+func (ih *inputHash) get() ([]byte, error) {
+	ih.once.Do(func() { ih.h, ih.err = ih.fn() })
+	return ih.h, ih.err
+}
+
+// withInputHash decorates a context with a function for computing the input hash of a [Files] target.
+// The function is called at most once,
+// and only if the hash is requested with [GetInputHash].
+func withInputHash(ctx context.Context, fn func() ([]byte, error)) context.Context {
+	return context.WithValue(ctx, inputHashKeyType{}, &inputHash{fn: fn})
+}
+
+// GetInputHash returns the input hash of the [Files] target whose subtarget is running.
+// This is a hash of the subtarget
+// (in its JSON encoding),
+// the names of the Files target's input and output files,
+// and the contents of its input files,
+// but not of the output files,
+// with file names made relative to the controller's top directory where possible.
+// It is the same in different checkouts of a project,
+// and it is the key under which outputs are stored in an [ArtifactStore].
+//
+// A subtarget can use it to key caches of its own.
+// The result is nil if no Files target is running.
+func GetInputHash(ctx context.Context) ([]byte, error) {
+	ih, _ := ctx.Value(inputHashKeyType{}).(*inputHash)
+	if ih == nil {
+		return nil, nil
+	}
+	return ih.get()
+}
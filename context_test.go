@@ -1,7 +1,10 @@
 package fab
 
 import (
+	"bytes"
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -44,3 +47,52 @@ func TestWithVerbose(t *testing.T) {
 		t.Error("got false, want true")
 	}
 }
+
+func TestGetInputHash(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	ctx := context.Background()
+	if h, err := GetInputHash(ctx); err != nil || h != nil {
+		t.Errorf("got %x, %v outside a Files target; want nil, nil", h, err)
+	}
+
+	in := filepath.Join(tmpdir, "in")
+	if err := os.WriteFile(in, []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func() []byte {
+		t.Helper()
+
+		var got []byte
+		target := Files(F(func(ctx context.Context, _ *Controller) error {
+			var err error
+			got, err = GetInputHash(ctx)
+			return err
+		}), []string{in}, nil)
+		if err := NewController(tmpdir).Run(ctx, target); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) == 0 {
+			t.Fatal("got no input hash")
+		}
+		return got
+	}
+
+	h1 := run()
+	if h2 := run(); !bytes.Equal(h1, h2) {
+		t.Errorf("input hash changed from %x to %x with unchanged input", h1, h2)
+	}
+	if err := os.WriteFile(in, []byte("2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if h3 := run(); bytes.Equal(h1, h3) {
+		t.Error("input hash unchanged after changing input")
+	}
+}
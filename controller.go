@@ -1,11 +1,16 @@
 package fab
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
 )
 
 // Controller is in charge of registering and running targets.
@@ -25,10 +30,84 @@ type Controller struct {
 	// Records targets that have run or are running.
 	ran map[uintptr]*outcome
 
+	// Records targets that were not started because another target failed
+	// and that have not run since.
+	// See notStarted.
+	notRan map[uintptr]*outcome
+
+	// Parent target -> subtarget -> count,
+	// for each subtarget that a running parent is running or waiting for.
+	// See addRunEdge.
+	runEdges map[uintptr]map[uintptr]int
+
 	// Keys are names related to topdir.
 	targetsByName map[string]targetRegistryTuple
 
 	targetsByAddr map[uintptr]targetRegistryTuple
+
+	// Project name -> directory relative to topdir.
+	// See readProjectsDecl.
+	projects map[string]string
+
+	// Directory relative to topdir -> variable name -> value.
+	// See readVarsDecl.
+	vars map[string]map[string]string
+
+	// Variable name -> value.
+	// See SetVar.
+	varOverrides map[string]string
+
+	// Directories relative to topdir whose YAML files have been read.
+	// See ReadYAMLFile.
+	yamlDirs set.Of[string]
+
+	// Names of YAML files that have been read,
+	// including included files.
+	yamlFiles set.Of[string]
+
+	// Bare target name -> prefixed name,
+	// while reading an included YAML file with a prefix.
+	// See readIncludeDecl.
+	yamlRenames map[string]string
+
+	// Words to prepend to the command line of every Command.
+	// See SetCommandWrapper.
+	wrapper []string
+
+	// Whether commands run in a clean environment,
+	// and the environment variables they may still inherit.
+	// See SetCleanEnv.
+	cleanEnv bool
+	envAllow []string
+
+	// Tool path and mode -> hash.
+	// See toolHash.
+	toolHashes map[string]string
+
+	// See SetDefault.
+	defaultName string
+
+	// Alias -> target name.
+	// See SetAlias.
+	aliases map[string]string
+
+	// See SetProgressSink.
+	progress ProgressSink
+
+	// See SetTextStyle.
+	style TextStyle
+
+	// See SetLimits.
+	limits Limits
+
+	// Secret values to redact from output,
+	// longest first.
+	// See AddSecrets.
+	secrets []string
+
+	// The default progress sink, created when first needed.
+	// See defaultProgressSink.
+	text *textProgressSink
 }
 
 // NewController creates a new [Controller]
@@ -39,6 +118,7 @@ func NewController(topdir string) *Controller {
 	return &Controller{
 		topdir:        topdir,
 		ran:           make(map[uintptr]*outcome),
+		notRan:        make(map[uintptr]*outcome),
 		targetsByName: make(map[string]targetRegistryTuple),
 		targetsByAddr: make(map[uintptr]targetRegistryTuple),
 	}
@@ -49,13 +129,20 @@ func NewController(topdir string) *Controller {
 // If all path segments are relative,
 // then con's top directory is implicitly joined at the beginning.
 //
+// Path segments may use slashes as separators on any platform.
+// On Windows,
+// a segment that begins with a separator but has no drive letter,
+// like /c/d,
+// counts as absolute
+// (relative to the current drive).
+//
 // Examples:
 //
 //   - JoinPath("a/b", "c/d") -> TOP/a/b/c/d
 //   - JoinPath("a/b", "/c/d") -> /c/d
 func (con *Controller) JoinPath(elts ...string) string {
 	for i := len(elts) - 1; i >= 0; i-- {
-		if filepath.IsAbs(elts[i]) {
+		if filepath.IsAbs(elts[i]) || isRooted(elts[i]) {
 			return filepath.Join(elts[i:]...)
 		}
 	}
@@ -79,22 +166,77 @@ func (con *Controller) RelPath(path string) (string, error) {
 // The two cases are distinguished by whether there is a second argument
 // and whether it begins with a hyphen.
 // (That's the ArgTarget case.)
+//
+// If the top-level fab.yaml file has a _projects declaration,
+// a target name may also have the form PROJECT:NAME,
+// meaning the target NAME in the directory of the project PROJECT.
+// If no such target exists,
+// NAME with its first letter capitalized is tried,
+// so server:build may mean server/Build.
+// A bare project name PROJECT
+// (or PROJECT:)
+// means the project's [DefaultTargetName] target.
+//
+// A target name may also be the name of a file
+// matching an output pattern of a [Pattern] target,
+// meaning the expansion of the pattern for that file.
+//
+// A target name may also be an alias
+// (see [Controller.SetAlias]).
+//
+// A target name of the form */NAME
+// means the target NAME in every subdirectory that defines one
+// (see [Controller.Foreach]).
+// If the first argument is [ForeachArg]
+// (and there is no target with that name),
+// every remaining argument is treated that way,
+// so `foreach Build Test` is the same as `*/Build */Test`.
 func (con *Controller) ParseArgs(args []string) ([]Target, error) {
 	var (
 		targets []Target
 		unknown []string
 	)
 
+	if len(args) > 0 && args[0] == ForeachArg {
+		if target, _ := con.RegistryTarget(ForeachArg); target == nil {
+			for _, arg := range args[1:] {
+				target, err := con.Foreach(arg)
+				if err != nil {
+					return nil, errors.Wrapf(err, "looking up %s", arg)
+				}
+				targets = append(targets, target)
+			}
+			return targets, nil
+		}
+	}
+
 	if len(args) > 1 && args[1][0] == '-' {
 		// Just one target, and remaining args are arguments for that target.
-		if target, _ := con.RegistryTarget(args[0]); target != nil {
+		target, err := con.lookupArg(args[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "looking up %s", args[0])
+		}
+		if target != nil {
+			if params := con.targetParams(target); len(params) > 0 {
+				if _, _, err := parseParams(params, args[1:]); err != nil {
+					return nil, errors.Wrapf(err, "parsing parameters of %s", args[0])
+				}
+			}
 			targets = append(targets, ArgTarget(target, args[1:]...))
 		} else {
 			unknown = append(unknown, args[0])
 		}
 	} else {
 		for _, arg := range args {
-			if target, _ := con.RegistryTarget(arg); target != nil {
+			target, err := con.lookupArg(arg)
+			if err != nil {
+				return nil, errors.Wrapf(err, "looking up %s", arg)
+			}
+			if target != nil {
+				if len(con.targetParams(target)) > 0 {
+					// Supply the parameters' default values.
+					target = ArgTarget(target)
+				}
 				targets = append(targets, target)
 			} else {
 				unknown = append(unknown, arg)
@@ -112,14 +254,101 @@ func (con *Controller) ParseArgs(args []string) ([]Target, error) {
 	}
 }
 
-// ListTargets outputs a formatted list of the targets in the registry and their docstrings.
+// ListTargets outputs a formatted list of the targets in the registry and their docstrings,
+// except for hidden ones (see [WithHidden]),
+// followed by the default target and aliases, if any
+// (see [Controller.SetDefault] and [Controller.SetAlias]).
+// If there are projects
+// (see [Controller.ParseArgs]),
+// the targets of each project are listed together
+// with their project-relative names.
 func (con *Controller) ListTargets(w io.Writer) {
-	names := con.RegistryNames()
-	for _, name := range names {
-		fmt.Fprintln(w, name)
-		if _, d := con.RegistryTarget(name); d != "" {
-			d = bolRegex.ReplaceAllString(d, "    ")
-			fmt.Fprintln(w, d)
+	con.mu.Lock()
+	nprojects := len(con.projects)
+	con.mu.Unlock()
+
+	if nprojects > 0 {
+		con.listProjectTargets(w)
+	} else {
+		names := con.listedNames()
+		for _, name := range names {
+			fmt.Fprintln(w, name)
+			if _, d := con.RegistryTarget(name); d != "" {
+				d = bolRegex.ReplaceAllString(d, "    ")
+				fmt.Fprintln(w, d)
+			}
+			if tags := con.Tags(name); len(tags) > 0 {
+				fmt.Fprintf(w, "    Tags: %s\n", strings.Join(tags, ", "))
+			}
+			con.writeParams(w, name)
+		}
+	}
+
+	con.listAliases(w)
+}
+
+// ListTargetsJSON outputs a JSON array describing the targets in the registry,
+// except for hidden ones (see [WithHidden]),
+// after reading all of the project's YAML files
+// (see [Controller.ReadAllYAMLFiles])
+// so that targets in subdirectories are included.
+// Aliases are included too
+// (see [Controller.SetAlias]).
+//
+// Each element of the array is an object with a "name" field,
+// a "doc" field if there is a docstring,
+// a "tags" field if the target has tags (see [WithTags]),
+// and a "params" field if it has parameters (see [WithParams]).
+// Each element is on a line by itself,
+// for the benefit of simple consumers like shell completion scripts
+// (see [WriteCompletion]).
+func (con *Controller) ListTargetsJSON(w io.Writer) error {
+	if err := con.ReadAllYAMLFiles(); err != nil {
+		return err
+	}
+
+	type item struct {
+		Name   string   `json:"name"`
+		Doc    string   `json:"doc,omitempty"`
+		Tags   []string `json:"tags,omitempty"`
+		Params []Param  `json:"params,omitempty"`
+	}
+
+	var items []item
+	for _, name := range con.listedNames() {
+		target, doc := con.RegistryTarget(name)
+		items = append(items, item{Name: name, Doc: doc, Tags: con.Tags(name), Params: con.targetParams(target)})
+	}
+
+	con.mu.Lock()
+	aliases := make([]string, 0, len(con.aliases))
+	for alias := range con.aliases {
+		aliases = append(aliases, alias)
+	}
+	con.mu.Unlock()
+	sort.Strings(aliases)
+
+	for _, alias := range aliases {
+		name, _ := con.alias(alias)
+		items = append(items, item{Name: alias, Doc: "Alias for " + name})
+	}
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i, it := range items {
+		j, err := json.Marshal(it)
+		if err != nil {
+			return errors.Wrapf(err, "marshaling target %s", it.Name)
+		}
+		sep := ","
+		if i == len(items)-1 {
+			sep = ""
+		}
+		if _, err := fmt.Fprintf(w, "\n%s%s", j, sep); err != nil {
+			return err
 		}
 	}
+	_, err := io.WriteString(w, "\n]\n")
+	return err
 }
@@ -3,6 +3,7 @@ package fab
 import (
 	"bytes"
 	"fmt"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -40,8 +41,8 @@ func TestJoinPath(t *testing.T) {
 			t.Parallel()
 
 			got := con.JoinPath(tc.inp...)
-			if got != tc.want {
-				t.Errorf("got %s, want %s", got, tc.want)
+			if want := filepath.FromSlash(tc.want); got != want {
+				t.Errorf("got %s, want %s", got, want)
 			}
 		})
 	}
@@ -0,0 +1,240 @@
+package fab
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Copy creates a target that copies the file or directory src to dest,
+// creating dest's parent directory if necessary.
+// If src is a directory,
+// the whole tree is copied,
+// so that dest becomes a copy of src.
+// File permissions are preserved,
+// and symbolic links are copied as links.
+//
+// The result is a [Files] target
+// whose input is src and whose output is dest,
+// so it runs only when one of those has changed.
+// Any opts are applied as they are in Files.
+// When [GetDryRun] is true,
+// nothing is copied.
+//
+// A Copy target may be specified in YAML using the !Copy tag,
+// which introduces a mapping whose fields are:
+//
+//   - Src: the file or directory to copy
+//   - Dest: the destination
+//
+// Both are either absolute or relative to the directory containing the YAML file.
+func Copy(src, dest string, opts ...FilesOpt) Target {
+	result := Files(&copyTarget{Src: src, Dest: dest}, []string{src}, []string{dest}, opts...)
+	result.(*files).desc = "Copy"
+	return result
+}
+
+type copyTarget struct {
+	Src  string `json:"src"`
+	Dest string `json:"dest"`
+}
+
+var _ Target = &copyTarget{}
+
+// Run implements Target.Run.
+func (c *copyTarget) Run(ctx context.Context, con *Controller) error {
+	if GetDryRun(ctx) {
+		if GetVerbose(ctx) {
+			con.Indentf("  Would copy %s to %s", c.Src, c.Dest)
+		}
+		return nil
+	}
+	if GetVerbose(ctx) {
+		con.Indentf("  Copying %s to %s", c.Src, c.Dest)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.Dest), 0755); err != nil {
+		return errors.Wrapf(err, "creating directory for %s", c.Dest)
+	}
+
+	type dirPerm struct {
+		dir  string
+		perm fs.FileMode
+	}
+	var dirPerms []dirPerm
+
+	err := filepath.WalkDir(c.Src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(c.Src, path)
+		if err != nil {
+			return errors.Wrapf(err, "getting relative path to %s", path)
+		}
+		dest := filepath.Join(c.Dest, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return errors.Wrapf(err, "statting %s", path)
+		}
+		switch {
+		case d.IsDir():
+			// Permissions are set afterwards,
+			// in case they don't allow copying the directory's contents.
+			dirPerms = append(dirPerms, dirPerm{dir: dest, perm: info.Mode().Perm()})
+			return errors.Wrapf(os.MkdirAll(dest, 0755), "creating directory %s", dest)
+
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return errors.Wrapf(err, "reading symlink %s", path)
+			}
+			if err := os.Remove(dest); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return errors.Wrapf(err, "removing %s", dest)
+			}
+			return errors.Wrapf(os.Symlink(target, dest), "creating symlink %s", dest)
+
+		case info.Mode().IsRegular():
+			return copyRegularFile(path, dest, info.Mode().Perm())
+
+		default:
+			return fmt.Errorf("cannot copy %s: unsupported file type %s", path, info.Mode().Type())
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Innermost directories first.
+	for i := len(dirPerms) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirPerms[i].dir, dirPerms[i].perm); err != nil {
+			return errors.Wrapf(err, "setting permissions of %s", dirPerms[i].dir)
+		}
+	}
+	return nil
+}
+
+// Desc implements Target.Desc.
+func (*copyTarget) Desc() string {
+	return "Copy"
+}
+
+func copyRegularFile(src, dest string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", src)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", dest)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return errors.Wrapf(err, "copying %s to %s", src, dest)
+	}
+	if err := out.Chmod(perm); err != nil {
+		return errors.Wrapf(err, "setting permissions of %s", dest)
+	}
+	return errors.Wrapf(out.Close(), "closing %s", dest)
+}
+
+// Mkdir creates a target that creates the directory dir,
+// along with any necessary parents,
+// like `mkdir -p`.
+// It is not an error if dir already exists.
+// When [GetDryRun] is true,
+// nothing is created.
+//
+// It is JSON-encodable
+// (and therefore usable as the subtarget in [Files]).
+//
+// A Mkdir target may be specified in YAML using the !Mkdir tag,
+// which introduces either a single directory name
+// or a mapping with a Dir field.
+// The directory is either absolute or relative to the directory containing the YAML file.
+func Mkdir(dir string) Target {
+	return &mkdir{Dir: dir}
+}
+
+type mkdir struct {
+	Dir string `json:"dir"`
+}
+
+var _ Target = &mkdir{}
+
+// Run implements Target.Run.
+func (m *mkdir) Run(ctx context.Context, con *Controller) error {
+	if GetDryRun(ctx) {
+		if GetVerbose(ctx) {
+			con.Indentf("  Would create directory %s", m.Dir)
+		}
+		return nil
+	}
+	return errors.Wrapf(os.MkdirAll(m.Dir, 0755), "creating directory %s", m.Dir)
+}
+
+// Desc implements Target.Desc.
+func (*mkdir) Desc() string {
+	return "Mkdir"
+}
+
+func copyDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var ycopy struct {
+		Src  string `yaml:"Src"`
+		Dest string `yaml:"Dest"`
+	}
+	if err := node.Decode(&ycopy); err != nil {
+		return nil, errors.Wrap(err, "YAML error in Copy node")
+	}
+	if ycopy.Src == "" || ycopy.Dest == "" {
+		return nil, fmt.Errorf("Copy node requires Src and Dest")
+	}
+
+	return Copy(con.JoinPath(dir, ycopy.Src), con.JoinPath(dir, ycopy.Dest)), nil
+}
+
+func mkdirDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	var d string
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		d = node.Value
+
+	case yaml.MappingNode:
+		var ymkdir struct {
+			Dir string `yaml:"Dir"`
+		}
+		if err := node.Decode(&ymkdir); err != nil {
+			return nil, errors.Wrap(err, "YAML error in Mkdir node")
+		}
+		d = ymkdir.Dir
+
+	default:
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	if d == "" {
+		return nil, fmt.Errorf("Mkdir node requires a directory")
+	}
+	return Mkdir(con.JoinPath(dir, d)), nil
+}
+
+func init() {
+	RegisterYAMLTarget("Copy", copyDecoder)
+	SetYAMLTagDoc("Copy", "Copy files.")
+	RegisterYAMLTarget("Mkdir", mkdirDecoder)
+	SetYAMLTagDoc("Mkdir", "Create directories.")
+}
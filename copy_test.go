@@ -0,0 +1,147 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestCopy(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	src := filepath.Join(tmpdir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "a"), []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "sub", "run"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	ctx = WithVerbose(ctx, testing.Verbose())
+	ctx = WithHashDB(ctx, memdb(set.New[string]()))
+
+	t.Run("dryrun", func(t *testing.T) {
+		dest := filepath.Join(tmpdir, "dryrun")
+		if err := NewController(tmpdir).Run(WithDryRun(ctx, true), Copy(src, dest)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(dest); !os.IsNotExist(err) {
+			t.Errorf("dry run created %s (err is %v)", dest, err)
+		}
+	})
+
+	t.Run("tree", func(t *testing.T) {
+		dest := filepath.Join(tmpdir, "out", "tree")
+		if err := NewController(tmpdir).Run(ctx, Copy(src, dest)); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := os.ReadFile(filepath.Join(dest, "a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "a\n" {
+			t.Errorf("got %q, want %q", got, "a\n")
+		}
+
+		info, err := os.Stat(filepath.Join(dest, "sub", "run"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0755 {
+			t.Errorf("got mode %s, want 0755", info.Mode().Perm())
+		}
+
+		link, err := os.Readlink(filepath.Join(dest, "link"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link != "a" {
+			t.Errorf("got link to %s, want a", link)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		dest := filepath.Join(tmpdir, "file", "a")
+		if err := NewController(tmpdir).Run(ctx, Copy(filepath.Join(src, "a"), dest)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "a\n" {
+			t.Errorf("got %q, want %q", got, "a\n")
+		}
+	})
+}
+
+func TestMkdir(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	const yml = `
+A: !Mkdir a/b/c
+
+B: !Mkdir
+  Dir: d
+`
+
+	// Each run needs a new controller,
+	// since a controller runs each target only once.
+	load := func() (*Controller, []Target) {
+		con := NewController(tmpdir)
+		if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+			t.Fatal(err)
+		}
+		a, _ := con.RegistryTarget("A")
+		b, _ := con.RegistryTarget("B")
+		return con, []Target{a, b}
+	}
+
+	ctx := context.Background()
+
+	con, targets := load()
+	if err := con.Run(WithDryRun(ctx, true), targets...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpdir, "a")); !os.IsNotExist(err) {
+		t.Errorf("dry run created a (err is %v)", err)
+	}
+
+	con, targets = load()
+	if err := con.Run(ctx, targets...); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"a/b/c", "d"} {
+		info, err := os.Stat(filepath.Join(tmpdir, dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.IsDir() {
+			t.Errorf("%s is not a directory", dir)
+		}
+	}
+}
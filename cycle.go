@@ -0,0 +1,135 @@
+package fab
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type runningKeyType struct{}
+
+// withRunning decorates a context with the address of the target being run with it.
+func withRunning(ctx context.Context, addr uintptr) context.Context {
+	return context.WithValue(ctx, runningKeyType{}, addr)
+}
+
+// getRunning returns the address of the target being run with ctx,
+// or 0 if there is none.
+func getRunning(ctx context.Context) uintptr {
+	addr, _ := ctx.Value(runningKeyType{}).(uintptr)
+	return addr
+}
+
+// CycleError is the error produced by [Controller.Run]
+// when a target depends,
+// directly or indirectly,
+// on itself.
+type CycleError struct {
+	// Names describes the targets in the cycle,
+	// beginning and ending with the same one.
+	Names []string
+}
+
+func (e CycleError) Error() string {
+	return "dependency cycle: " + strings.Join(e.Names, " -> ")
+}
+
+// addRunEdge records that the target at parent
+// is about to run (or wait for) child,
+// whose address is childAddr.
+// If that would complete a cycle,
+// it returns a [CycleError] instead.
+// A parent of 0 means a top-level call to [Controller.Run],
+// which cannot be part of a cycle.
+//
+// Without this check,
+// a cycle would deadlock,
+// with each target waiting for the next one to finish.
+// Following the recorded edges finds cycles
+// even when they span several goroutines.
+//
+// The caller must hold con.mu.
+func (con *Controller) addRunEdge(parent uintptr, child Target, childAddr uintptr) error {
+	if parent == 0 {
+		return nil
+	}
+	if path := con.findRunPath(childAddr, parent, make(map[uintptr]bool)); path != nil {
+		childName := con.describeLocked(childAddr, child)
+		names := []string{childName}
+		for _, addr := range path[1:] {
+			names = append(names, con.describeRunningLocked(addr))
+		}
+		return CycleError{Names: append(names, childName)}
+	}
+	if con.runEdges == nil {
+		con.runEdges = make(map[uintptr]map[uintptr]int)
+	}
+	if con.runEdges[parent] == nil {
+		con.runEdges[parent] = make(map[uintptr]int)
+	}
+	con.runEdges[parent][childAddr]++
+	return nil
+}
+
+// describeRunningLocked describes the target at addr,
+// which appears in a path of run edges.
+// Its entry in con.ran may be gone,
+// removed by forgetFailures or forgetAll
+// (e.g. in [Retry], [Flaky], or watch mode),
+// in which case it is described by name if it has one,
+// or else by address.
+func (con *Controller) describeRunningLocked(addr uintptr) string {
+	if r, ok := con.ran[addr]; ok && r != nil {
+		return con.describeLocked(addr, r.target)
+	}
+	if tuple, ok := con.targetsByAddr[addr]; ok {
+		return tuple.name
+	}
+	return fmt.Sprintf("target at %#x", addr)
+}
+
+// removeRunEdge removes an edge added with addRunEdge.
+func (con *Controller) removeRunEdge(parent, child uintptr) {
+	if parent == 0 {
+		return
+	}
+
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	children := con.runEdges[parent]
+	if children[child]--; children[child] <= 0 {
+		delete(children, child)
+	}
+	if len(children) == 0 {
+		delete(con.runEdges, parent)
+	}
+}
+
+// findRunPath returns a path of run edges from `from` to `to`,
+// or nil if there is none.
+// The caller must hold con.mu.
+func (con *Controller) findRunPath(from, to uintptr, seen map[uintptr]bool) []uintptr {
+	if from == to {
+		return []uintptr{from}
+	}
+	if seen[from] {
+		return nil
+	}
+	seen[from] = true
+	for child := range con.runEdges[from] {
+		if path := con.findRunPath(child, to, seen); path != nil {
+			return append([]uintptr{from}, path...)
+		}
+	}
+	return nil
+}
+
+// describeLocked is like [Controller.Describe]
+// for a caller that holds con.mu.
+func (con *Controller) describeLocked(addr uintptr, target Target) string {
+	if tuple, ok := con.targetsByAddr[addr]; ok {
+		return tuple.name
+	}
+	return "unnamed " + target.Desc()
+}
@@ -0,0 +1,118 @@
+package fab
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCycle(t *testing.T) {
+	t.Parallel()
+
+	const yml = `
+A: !Seq
+  - B
+B: !Seq
+  - A
+
+Self: !Seq
+  - Self
+
+Top: !All
+  - C
+  - D
+C: !Seq
+  - D
+D: !Seq
+  - C
+
+Fine: !All
+  - E
+  - E
+  - !Seq
+    - E
+E: !Command
+  Shell: "true"
+`
+
+	cases := []struct {
+		name string
+		want []string
+	}{{
+		name: "A",
+		want: []string{"A", "B", "A"},
+	}, {
+		name: "Self",
+		want: []string{"Self", "Self"},
+	}, {
+		name: "Top",
+	}, {
+		name: "Fine",
+	}}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			con := NewController("")
+			if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+				t.Fatal(err)
+			}
+			target, _ := con.RegistryTarget(tc.name)
+
+			errch := make(chan error, 1)
+			go func() {
+				errch <- con.Run(context.Background(), target)
+			}()
+
+			var err error
+			select {
+			case err = <-errch:
+			case <-time.After(10 * time.Second):
+				t.Fatal("deadlock")
+			}
+
+			if tc.name == "Fine" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			var cerr CycleError
+			if !errors.As(err, &cerr) {
+				t.Fatalf("got error %v, want CycleError", err)
+			}
+			if tc.want != nil && !reflect.DeepEqual(cerr.Names, tc.want) {
+				t.Errorf("got cycle %v, want %v", cerr.Names, tc.want)
+			}
+			if n := len(cerr.Names); n < 2 || cerr.Names[0] != cerr.Names[n-1] {
+				t.Errorf("cycle %v does not begin and end with the same target", cerr.Names)
+			}
+		})
+	}
+}
+
+func TestCycleForgotten(t *testing.T) {
+	// The run edges 1 -> 2 -> 3 remain,
+	// but the controller has forgotten targets 2 and 3
+	// (as after forgetAll).
+	con := NewController("")
+	con.runEdges = map[uintptr]map[uintptr]int{
+		1: {2: 1},
+		2: {3: 1},
+	}
+
+	err := con.addRunEdge(3, &Command{Shell: "true"}, 1)
+
+	var e CycleError
+	if !errors.As(err, &e) {
+		t.Fatalf("got error %v, want CycleError", err)
+	}
+	want := []string{"unnamed Command", "target at 0x2", "target at 0x3", "unnamed Command"}
+	if !reflect.DeepEqual(e.Names, want) {
+		t.Errorf("got %v, want %v", e.Names, want)
+	}
+}
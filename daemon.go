@@ -0,0 +1,442 @@
+package fab
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/slices"
+)
+
+// runDaemon is the -daemon mode of the fab command.
+// It keeps the project's compiled driver up to date,
+// recompiling it when the files in its _fab directories change,
+// and runs it on behalf of other fab processes
+// that connect to a Unix-domain socket in the fab directory
+// (see [Main.runViaDaemon]).
+// This saves those processes the time needed to check whether the driver must be recompiled.
+//
+// There is nothing to watch for fab.yaml files,
+// since the driver reads them anew each time it runs.
+// But the project is rescanned for _fab directories each time the daemon checks for changes,
+// so that one added to a subdirectory is noticed.
+//
+// runDaemon returns when ctx is canceled.
+func (m *Main) runDaemon(ctx context.Context) error {
+	d := &daemon{
+		driver:   func(ctx context.Context) (string, error) { return m.getDriver(ctx, false) },
+		dir:      m.Topdir,
+		watch:    func() ([]string, error) { return fabWatchDirs(m.Topdir) },
+		interval: WatchInterval,
+		verbose:  m.Verbose,
+	}
+	if _, err := d.currentDriver(ctx); err != nil {
+		if errors.Is(err, errNoDriver) {
+			return fmt.Errorf("daemon mode requires a _fab directory in %s", m.Topdir)
+		}
+		return errors.Wrap(err, "ensuring driver is up to date")
+	}
+	return d.serve(ctx, m.daemonSocket())
+}
+
+// fabWatchDirs returns the _fab directories in the project at topdir
+// (see [fabPackageDirs])
+// joined to topdir.
+func fabWatchDirs(topdir string) ([]string, error) {
+	dirs, err := fabPackageDirs(topdir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "finding _fab dirs in %s", topdir)
+	}
+	return slices.Map(dirs, func(dir string) string { return filepath.Join(topdir, dir) }), nil
+}
+
+// useDaemon tells whether m can run via the daemon
+// when its standard input and output are stdin and stdout.
+// The driver run by the daemon has neither the terminal
+// nor m's standard input,
+// only a copy of what can be read from it.
+// So the daemon is not used for the -ui display,
+// for the "status" progress format,
+// or when stdin is a terminal
+// (from which a command could read interactively,
+// see [Command]).
+func (m *Main) useDaemon(stdin, stdout *os.File) bool {
+	if m.UI {
+		return false
+	}
+	switch m.Progress {
+	case "status":
+		return false
+	case "auto":
+		if !m.Verbose && IsTerminal(stdout) {
+			return false
+		}
+	}
+	return !IsTerminal(stdin) || isDevNull(stdin)
+}
+
+// isDevNull tells whether f is the null device
+// (which [IsTerminal] cannot tell from a terminal).
+func isDevNull(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	nullInfo, err := os.Stat(os.DevNull)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(info, nullInfo)
+}
+
+// daemonSocket returns the path of the socket used by the daemon for m.Topdir.
+// There is one per project,
+// named for a hash of the project's top directory.
+func (m *Main) daemonSocket() string {
+	topdir, err := filepath.Abs(m.Topdir)
+	if err != nil {
+		topdir = m.Topdir
+	}
+	h := sha256.Sum256([]byte(topdir))
+	return filepath.Join(m.Fabdir, "daemon", hex.EncodeToString(h[:8])+".sock")
+}
+
+// runViaDaemon asks the daemon for m.Topdir,
+// if there is one,
+// to run the driver with the arguments for m,
+// copying stdin (if not nil) to the driver's standard input
+// and its output to stdout and stderr.
+// It reports false if no daemon is running,
+// in which case the caller should run the driver itself.
+//
+// Copying stdin happens in a goroutine
+// that may still be blocked reading it when runViaDaemon returns.
+func (m *Main) runViaDaemon(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) (bool, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", m.daemonSocket())
+	if err != nil {
+		return false, nil
+	}
+	defer conn.Close()
+
+	if m.Verbose {
+		fmt.Fprintln(stdout, "Running via daemon")
+	}
+
+	var (
+		enc = json.NewEncoder(conn)
+		req = daemonRequest{Args: m.driverArgs(), Env: os.Environ()}
+	)
+	if err := enc.Encode(req); err != nil {
+		return true, errors.Wrap(err, "sending request to daemon")
+	}
+
+	go func() {
+		if stdin != nil {
+			buf := make([]byte, 32*1024)
+			for {
+				n, err := stdin.Read(buf)
+				if n > 0 {
+					if err := enc.Encode(daemonFrame{Stream: "stdin", Data: buf[:n]}); err != nil {
+						return
+					}
+				}
+				if err != nil {
+					break
+				}
+			}
+		}
+		enc.Encode(daemonFrame{Stream: "stdin", EOF: true})
+	}()
+
+	// Closing conn when ctx is canceled
+	// tells the daemon to stop the driver.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	dec := json.NewDecoder(conn)
+	for {
+		var frame daemonFrame
+		if err := dec.Decode(&frame); err != nil {
+			if ctx.Err() != nil {
+				return true, ctx.Err()
+			}
+			return true, errors.Wrap(err, "receiving from daemon")
+		}
+		switch {
+		case frame.Error != "":
+			return true, fmt.Errorf("daemon: %s", frame.Error)
+		case frame.Exit != nil:
+			if *frame.Exit != 0 {
+				return true, fmt.Errorf("driver exited with status %d", *frame.Exit)
+			}
+			return true, nil
+		case frame.Stream == "stderr":
+			stderr.Write(frame.Data)
+		default:
+			stdout.Write(frame.Data)
+		}
+	}
+}
+
+// daemonRequest is what a fab process sends to the daemon.
+// It is followed by [daemonFrame]s with Stream "stdin"
+// carrying the process's standard input,
+// the last of which has EOF set.
+type daemonRequest struct {
+	Args []string `json:"args"` // the driver's command-line arguments
+	Env  []string `json:"env"`  // the driver's environment
+}
+
+// daemonFrame is one of the messages the daemon sends in response to a [daemonRequest]:
+// a chunk of the driver's output,
+// the driver's exit status,
+// or an error that prevented running the driver.
+// A fab process also uses it to send its standard input to the daemon.
+type daemonFrame struct {
+	Stream string `json:"stream,omitempty"` // "stdin", "stdout", or "stderr"
+	Data   []byte `json:"data,omitempty"`
+	EOF    bool   `json:"eof,omitempty"` // the end of stdin
+	Exit   *int   `json:"exit,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type daemon struct {
+	driver   func(context.Context) (string, error) // returns the path of the up-to-date driver
+	dir      string                                // the directory in which to run the driver
+	watch    func() ([]string, error)              // returns the files and directories that cause recompilation when they change
+	interval time.Duration
+	verbose  bool
+
+	mu    sync.Mutex
+	path  string // the driver, once known
+	stale bool   // whether the watched files have changed since the driver was last checked
+}
+
+// serve listens for requests on a Unix-domain socket at path
+// until ctx is canceled.
+func (d *daemon) serve(ctx context.Context, path string) error {
+	if err := mkdirParent(path); err != nil {
+		return err
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("a daemon is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrapf(err, "removing stale socket %s", path)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return errors.Wrapf(err, "listening on %s", path)
+	}
+	defer os.Remove(path)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	if d.verbose {
+		fmt.Printf("Listening on %s\n", path)
+	}
+
+	watchErr := make(chan error, 1)
+	go func() {
+		if err := d.watchFiles(ctx); err != nil {
+			watchErr <- err
+			cancel()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				return errors.Wrap(err, "accepting connection")
+			}
+			select {
+			case err := <-watchErr:
+				return errors.Wrap(err, "watching for changes")
+			default:
+				return nil
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			d.handle(ctx, conn)
+		}()
+	}
+}
+
+// watchFiles marks the driver stale when any of the watched files changes.
+// The driver is then recompiled before it next runs.
+// The list of watched files and directories is refreshed each time,
+// so files in a newly added directory count as changed.
+func (d *daemon) watchFiles(ctx context.Context) error {
+	before, err := d.watchState()
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(d.interval):
+		}
+
+		after, err := d.watchState()
+		if err != nil {
+			return err
+		}
+		if changed := watchChanged(before, after); len(changed) > 0 {
+			if d.verbose {
+				fmt.Printf("Change detected in %v\n", changed)
+			}
+			d.mu.Lock()
+			d.stale = true
+			d.mu.Unlock()
+		}
+		before = after
+	}
+}
+
+func (d *daemon) watchState() (map[string]watchFileState, error) {
+	paths, err := d.watch()
+	if err != nil {
+		return nil, err
+	}
+	return watchState(paths)
+}
+
+// currentDriver returns the path of the driver,
+// checking it
+// (and recompiling it if necessary)
+// only the first time and after the watched files have changed.
+// Skipping the check the rest of the time is the point of the daemon.
+func (d *daemon) currentDriver(ctx context.Context) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.path == "" || d.stale {
+		path, err := d.driver(ctx)
+		if err != nil {
+			return "", err
+		}
+		d.path, d.stale = path, false
+	}
+	return d.path, nil
+}
+
+// handle serves a single request on conn.
+func (d *daemon) handle(ctx context.Context, conn net.Conn) {
+	var (
+		dec = json.NewDecoder(conn)
+		enc = json.NewEncoder(conn)
+		mu  sync.Mutex // protects enc
+		req daemonRequest
+	)
+
+	send := func(frame daemonFrame) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return enc.Encode(frame)
+	}
+
+	if err := dec.Decode(&req); err != nil {
+		send(daemonFrame{Error: fmt.Sprintf("decoding request: %s", err)})
+		return
+	}
+
+	driver, err := d.currentDriver(ctx)
+	if err != nil {
+		send(daemonFrame{Error: fmt.Sprintf("ensuring driver is up to date: %s", err)})
+		return
+	}
+
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		send(daemonFrame{Error: fmt.Sprintf("creating pipe for stdin: %s", err)})
+		return
+	}
+	defer stdinR.Close()
+	defer stdinW.Close()
+
+	// After the request the client sends only its standard input,
+	// so a failed read means it has gone away
+	// and the driver should be stopped.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			var frame daemonFrame
+			if err := dec.Decode(&frame); err != nil {
+				return
+			}
+			if frame.EOF {
+				stdinW.Close()
+				continue
+			}
+			stdinW.Write(frame.Data)
+		}
+	}()
+
+	cmd := exec.CommandContext(ctx, driver, req.Args...)
+	cmd.Dir = d.dir
+	cmd.Env = req.Env
+	cmd.Stdin = stdinR
+	cmd.Stdout = &daemonWriter{stream: "stdout", send: send}
+	cmd.Stderr = &daemonWriter{stream: "stderr", send: send}
+
+	exit := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			send(daemonFrame{Error: fmt.Sprintf("running driver: %s", err)})
+			return
+		}
+		exit = exitErr.ExitCode()
+	}
+	send(daemonFrame{Exit: &exit})
+}
+
+// daemonWriter is an [io.Writer] that sends what is written to it
+// to a daemon client.
+type daemonWriter struct {
+	stream string
+	send   func(daemonFrame) error
+}
+
+func (w *daemonWriter) Write(p []byte) (int, error) {
+	if err := w.send(daemonFrame{Stream: w.stream, Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
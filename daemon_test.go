@@ -0,0 +1,207 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDaemon(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	t.Setenv("FAB_DAEMON_TEST", "xyz")
+
+	var (
+		script  = filepath.Join(tmpdir, "driver.sh")
+		fabdir  = filepath.Join(tmpdir, "_fab")
+		watched = filepath.Join(fabdir, "main.go")
+	)
+	const scriptText = `#!/bin/sh
+echo "args: $*"
+echo "env: $FAB_DAEMON_TEST" >&2
+for arg; do last=$arg; done
+[ "$last" = fail ] && exit 3
+[ "$last" = stdin ] && cat
+exit 0
+`
+	if err := os.WriteFile(script, []byte(scriptText), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(fabdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(watched, []byte("package x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	d := &daemon{
+		driver: func(context.Context) (string, error) {
+			mu.Lock()
+			calls++
+			mu.Unlock()
+			return script, nil
+		},
+		dir:      tmpdir,
+		watch:    func() ([]string, error) { return fabWatchDirs(tmpdir) },
+		interval: 10 * time.Millisecond,
+	}
+	getCalls := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+
+	m := &Main{Fabdir: filepath.Join(tmpdir, "cache"), Topdir: tmpdir}
+
+	// With no daemon running,
+	// runViaDaemon declines.
+	if ok, err := m.runViaDaemon(context.Background(), nil, new(bytes.Buffer), new(bytes.Buffer)); ok || err != nil {
+		t.Fatalf("got ok %v, err %v with no daemon running; want false, nil", ok, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- d.serve(ctx, m.daemonSocket())
+	}()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Errorf("serving: %s", err)
+		}
+		if _, err := os.Stat(m.daemonSocket()); !os.IsNotExist(err) {
+			t.Errorf("socket %s still exists after daemon exited", m.daemonSocket())
+		}
+	}()
+
+	waitFor := func(what string, cond func() bool) {
+		for i := 0; i < 500; i++ {
+			if cond() {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("timed out waiting for %s", what)
+	}
+	waitFor("socket", func() bool {
+		_, err := os.Stat(m.daemonSocket())
+		return err == nil
+	})
+
+	runStdin := func(stdin io.Reader, args ...string) (string, string, error) {
+		var stdout, stderr bytes.Buffer
+		m.Args = args
+		ok, err := m.runViaDaemon(context.Background(), stdin, &stdout, &stderr)
+		if !ok {
+			t.Fatal("daemon did not handle request")
+		}
+		return stdout.String(), stderr.String(), err
+	}
+	run := func(args ...string) (string, string, error) {
+		return runStdin(nil, args...)
+	}
+
+	stdout, stderr, err := run("Build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "args: -fab " + m.Fabdir + " -top " + tmpdir + " Build\n"; stdout != want {
+		t.Errorf("got stdout %q, want %q", stdout, want)
+	}
+	if want := "env: xyz\n"; stderr != want {
+		t.Errorf("got stderr %q, want %q", stderr, want)
+	}
+
+	if _, _, err = run("fail"); err == nil || !strings.Contains(err.Error(), "status 3") {
+		t.Errorf("got error %v, want one about exit status 3", err)
+	}
+
+	// The driver gets the client's standard input.
+	stdout, _, err = runStdin(strings.NewReader("hello\n"), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "args: -fab " + m.Fabdir + " -top " + tmpdir + " stdin\nhello\n"; stdout != want {
+		t.Errorf("got stdout %q, want %q", stdout, want)
+	}
+
+	if got := getCalls(); got != 1 {
+		t.Errorf("got %d driver checks, want 1", got)
+	}
+
+	// Changing the driver's source makes the daemon check the driver again.
+	if err := os.WriteFile(watched, []byte("package xyz\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("change detection", func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.stale
+	})
+	if _, _, err = run("Build"); err != nil {
+		t.Fatal(err)
+	}
+	if got := getCalls(); got != 2 {
+		t.Errorf("got %d driver checks, want 2", got)
+	}
+
+	// So does adding a _fab directory in a subdirectory.
+	subfab := filepath.Join(tmpdir, "sub", "_fab")
+	if err := os.MkdirAll(subfab, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(subfab, "sub.go"), []byte("package sub\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("change detection in new _fab dir", func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.stale
+	})
+}
+
+func TestUseDaemon(t *testing.T) {
+	devnull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devnull.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	cases := []struct {
+		m     Main
+		stdin *os.File
+		want  bool
+	}{
+		{m: Main{}, stdin: devnull, want: true},
+		{m: Main{}, stdin: r, want: true},
+		{m: Main{Progress: "auto"}, stdin: devnull, want: true}, // stdout is not a terminal
+		{m: Main{UI: true}, stdin: devnull, want: false},
+		{m: Main{Progress: "status"}, stdin: devnull, want: false},
+	}
+	for i, tc := range cases {
+		if got := tc.m.useDaemon(tc.stdin, w); got != tc.want {
+			t.Errorf("case %d: got %v, want %v", i+1, got, tc.want)
+		}
+	}
+}
@@ -92,4 +92,5 @@ func depsDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
 
 func init() {
 	RegisterYAMLTarget("Deps", depsDecoder)
+	SetYAMLTagDoc("Deps", "Run a target after its dependencies.")
 }
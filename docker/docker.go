@@ -0,0 +1,399 @@
+package docker
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bobg/fab"
+)
+
+// BuildOpts are the options for [Build].
+type BuildOpts struct {
+	// Dockerfile is the Dockerfile to use.
+	// The default is the file named Dockerfile in the build context.
+	Dockerfile string
+
+	// Tags are the image references to apply to the image,
+	// e.g. "registry.example.com/app:latest".
+	Tags []string
+
+	// Platforms are the platforms to build for,
+	// e.g. "linux/amd64" and "linux/arm64".
+	// When there is more than one,
+	// the result is a manifest list with an image for each platform.
+	// The default is the platform of the build host.
+	Platforms []string
+
+	// Push tells whether to push the image
+	// (or manifest list)
+	// to the registries named in Tags.
+	// Docker can keep a multi-platform image only in a registry,
+	// so a build with more than one platform normally requires Push.
+	Push bool
+
+	// DigestFile, if set,
+	// is a file to which the digest of the image
+	// (or manifest list)
+	// is written after a successful build,
+	// e.g. "sha256:0123...".
+	// It is an output of the Build target,
+	// so a downstream target that lists it as an input
+	// runs after the build and reruns when the digest changes.
+	// A shell command can refer to the pushed image as repo@$(cat DIGESTFILE).
+	DigestFile string
+
+	// CacheDir, if set,
+	// is a directory in which to keep a buildx layer cache
+	// (of type local).
+	// If it is relative,
+	// it is interpreted relative to the fab directory
+	// (see [fab.GetFabdir]).
+	// Old caches in it are not removed automatically.
+	CacheDir string
+
+	// CacheRef, if set,
+	// is a registry repository in which to keep a buildx layer cache
+	// (of type registry),
+	// e.g. "registry.example.com/app-cache".
+	// It must not include a tag.
+	CacheRef string
+
+	// Flags are additional command-line flags for `docker buildx build`.
+	Flags []string
+}
+
+// LatestCache is the name under which [Build] keeps the most recent build's cache
+// in a CacheDir or CacheRef.
+const LatestCache = "latest"
+
+// Build produces a target that builds a container image from the build context in `dir`
+// using `docker buildx build`.
+//
+// Build is implemented in terms of [fab.Files],
+// with the build context and the Dockerfile as inputs
+// and the digest file
+// (if any)
+// as output.
+// Any filesOpts are passed through to that function.
+// So the image is rebuilt only when something in the build context,
+// the Dockerfile,
+// or the options change.
+//
+// A Build target may be specified in YAML using the tag !docker.Build,
+// which introduces a mapping whose fields are:
+//
+//   - Dir: the build context directory
+//   - Dockerfile: the Dockerfile, by default Dockerfile in Dir
+//   - Tags: a sequence of image references
+//   - Platforms: a sequence of platforms
+//   - Push: a boolean, true for pushing the image to the registries named in Tags
+//   - DigestFile: the file to which to write the image digest
+//   - Flags: a sequence of additional command-line flags for `docker buildx build`
+//
+// Dir, Dockerfile, and DigestFile are either absolute or relative to the directory containing the YAML file.
+//
+// With CacheDir or CacheRef,
+// the build imports and exports a buildx layer cache,
+// so that rebuilds reuse layers even on a machine
+// (e.g. a CI runner)
+// with no local build state.
+// Each cache is keyed by the target's input hash
+// (see [fab.GetInputHash]):
+// the build imports the cache for its own key
+// and the cache of the latest build
+// (see [LatestCache]),
+// and exports the cache under both.
+// A build from inputs that were built before
+// thus gets all of its layers from the cache,
+// and other builds get the layers they share with the latest one.
+//
+// In YAML the cache options are given by these additional fields:
+//
+//   - CacheDir: the local cache directory, absolute or relative to the fab directory
+//   - CacheRef: the registry cache repository
+func Build(dir string, opts BuildOpts, filesOpts ...fab.FilesOpt) fab.Target {
+	dockerfile := opts.Dockerfile
+	if dockerfile == "" {
+		dockerfile = filepath.Join(dir, "Dockerfile")
+	}
+
+	in := []string{dir}
+	if rel, err := filepath.Rel(dir, dockerfile); err != nil || !filepath.IsLocal(rel) {
+		in = append(in, dockerfile)
+	}
+
+	var out []string
+	if opts.DigestFile != "" {
+		out = append(out, opts.DigestFile)
+	}
+
+	b := &buildType{
+		Dir:        dir,
+		Dockerfile: opts.Dockerfile,
+		Tags:       opts.Tags,
+		Platforms:  opts.Platforms,
+		Push:       opts.Push,
+		DigestFile: opts.DigestFile,
+		CacheDir:   opts.CacheDir,
+		CacheRef:   opts.CacheRef,
+		Flags:      opts.Flags,
+	}
+	return fab.Files(b, in, out, filesOpts...)
+}
+
+type buildType struct {
+	Dir        string   `json:"dir"`
+	Dockerfile string   `json:"dockerfile,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Platforms  []string `json:"platforms,omitempty"`
+	Push       bool     `json:"push,omitempty"`
+	DigestFile string   `json:"digest_file,omitempty"`
+	CacheDir   string   `json:"cache_dir,omitempty"`
+	CacheRef   string   `json:"cache_ref,omitempty"`
+	Flags      []string `json:"flags,omitempty"`
+}
+
+var _ fab.Target = &buildType{}
+
+func (b *buildType) Run(ctx context.Context, con *fab.Controller) error {
+	var metadataFile string
+	if b.DigestFile != "" && !fab.GetDryRun(ctx) {
+		f, err := os.CreateTemp("", "fab-docker")
+		if err != nil {
+			return errors.Wrap(err, "creating metadata file")
+		}
+		metadataFile = f.Name()
+		defer os.Remove(metadataFile)
+		if err := f.Close(); err != nil {
+			return errors.Wrapf(err, "closing %s", metadataFile)
+		}
+	}
+
+	cache, err := b.cache(ctx)
+	if err != nil {
+		return errors.Wrap(err, "preparing layer cache")
+	}
+
+	c := &fab.Command{
+		Cmd:  "docker",
+		Args: b.args(metadataFile, cache),
+	}
+	if err := c.Run(ctx, con); err != nil {
+		return err
+	}
+
+	if !fab.GetDryRun(ctx) {
+		if err := cache.finish(); err != nil {
+			return errors.Wrap(err, "updating layer cache")
+		}
+	}
+
+	if metadataFile == "" {
+		return nil
+	}
+	digest, err := readDigest(metadataFile)
+	if err != nil {
+		return errors.Wrap(err, "reading image digest")
+	}
+	if err := os.MkdirAll(filepath.Dir(b.DigestFile), 0755); err != nil {
+		return errors.Wrapf(err, "creating directory for %s", b.DigestFile)
+	}
+	return os.WriteFile(b.DigestFile, []byte(digest+"\n"), 0644)
+}
+
+// args produces the command-line arguments for `docker`.
+// If metadataFile is not empty,
+// buildx is asked to write its build metadata there.
+func (b *buildType) args(metadataFile string, cache *buildCache) []string {
+	args := []string{"buildx", "build"}
+	if b.Dockerfile != "" {
+		args = append(args, "--file", b.Dockerfile)
+	}
+	for _, tag := range b.Tags {
+		args = append(args, "--tag", tag)
+	}
+	if len(b.Platforms) > 0 {
+		args = append(args, "--platform", strings.Join(b.Platforms, ","))
+	}
+	if b.Push {
+		args = append(args, "--push")
+	}
+	if metadataFile != "" {
+		args = append(args, "--metadata-file", metadataFile)
+	}
+	for _, from := range cache.from {
+		args = append(args, "--cache-from", from)
+	}
+	for _, to := range cache.to {
+		args = append(args, "--cache-to", to)
+	}
+	args = append(args, b.Flags...)
+	return append(args, b.Dir)
+}
+
+// buildCache is the layer cache configuration of a build.
+type buildCache struct {
+	from, to []string // values for --cache-from and --cache-to
+
+	// If set, the local cache directory
+	// and the name in it of the cache exported by this build.
+	dir, key string
+}
+
+// cache computes the layer cache configuration of b.
+func (b *buildType) cache(ctx context.Context) (*buildCache, error) {
+	result := new(buildCache)
+	if b.CacheDir == "" && b.CacheRef == "" {
+		return result, nil
+	}
+
+	h, err := fab.GetInputHash(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting input hash")
+	}
+	key := LatestCache
+	if len(h) > 0 {
+		key = hex.EncodeToString(h)
+	}
+
+	if b.CacheDir != "" {
+		dir := b.CacheDir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(fab.GetFabdir(ctx), dir)
+		}
+		for _, name := range []string{key, LatestCache} {
+			if _, err := os.Stat(filepath.Join(dir, name, "index.json")); err == nil {
+				result.from = append(result.from, "type=local,src="+filepath.Join(dir, name))
+			}
+			if name == LatestCache {
+				break
+			}
+		}
+		result.to = append(result.to, "type=local,mode=max,dest="+filepath.Join(dir, key))
+		result.dir, result.key = dir, key
+	}
+
+	if b.CacheRef != "" {
+		for _, name := range []string{key, LatestCache} {
+			result.from = append(result.from, "type=registry,ref="+b.CacheRef+":"+name)
+			result.to = append(result.to, "type=registry,mode=max,ref="+b.CacheRef+":"+name)
+			if name == LatestCache {
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// finish updates the local cache directory (if any) after a successful build,
+// making the cache exported by the build the latest one.
+// Rather than exporting the cache a second time,
+// the latest one is a symlink to it.
+func (c *buildCache) finish() error {
+	if c.dir == "" || c.key == LatestCache {
+		return nil
+	}
+	var (
+		latest = filepath.Join(c.dir, LatestCache)
+		tmp    = latest + ".tmp"
+	)
+	_ = os.Remove(tmp)
+	if err := os.Symlink(c.key, tmp); err != nil {
+		return errors.Wrapf(err, "creating symlink %s", tmp)
+	}
+	if info, err := os.Lstat(latest); err == nil && info.IsDir() {
+		// Rename can't replace a directory with a symlink.
+		if err := os.RemoveAll(latest); err != nil {
+			return errors.Wrapf(err, "removing %s", latest)
+		}
+	}
+	return errors.Wrapf(os.Rename(tmp, latest), "renaming %s to %s", tmp, latest)
+}
+
+func (*buildType) Desc() string {
+	return "docker.Build"
+}
+
+// readDigest reads the digest of the built image
+// (or manifest list)
+// from a metadata file written by `docker buildx build --metadata-file`.
+func readDigest(metadataFile string) (string, error) {
+	data, err := os.ReadFile(metadataFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "reading %s", metadataFile)
+	}
+	var metadata struct {
+		Digest string `json:"containerimage.digest"`
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return "", errors.Wrapf(err, "decoding %s", metadataFile)
+	}
+	if metadata.Digest == "" {
+		return "", errors.New("no digest in build metadata (is the build output an image?)")
+	}
+	return metadata.Digest, nil
+}
+
+func buildDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var b struct {
+		Dir        string    `yaml:"Dir"`
+		Dockerfile string    `yaml:"Dockerfile"`
+		Tags       yaml.Node `yaml:"Tags"`
+		Platforms  yaml.Node `yaml:"Platforms"`
+		Push       bool      `yaml:"Push"`
+		DigestFile string    `yaml:"DigestFile"`
+		CacheDir   string    `yaml:"CacheDir"`
+		CacheRef   string    `yaml:"CacheRef"`
+		Flags      yaml.Node `yaml:"Flags"`
+	}
+	if err := node.Decode(&b); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding docker.Build")
+	}
+
+	tags, err := con.YAMLStringList(&b.Tags, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding docker.Build.Tags")
+	}
+	platforms, err := con.YAMLStringList(&b.Platforms, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding docker.Build.Platforms")
+	}
+	flags, err := con.YAMLStringList(&b.Flags, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding docker.Build.Flags")
+	}
+
+	opts := BuildOpts{
+		Tags:      tags,
+		Platforms: platforms,
+		Push:      b.Push,
+		CacheDir:  b.CacheDir,
+		CacheRef:  b.CacheRef,
+		Flags:     flags,
+	}
+	if b.Dockerfile != "" {
+		opts.Dockerfile = con.JoinPath(dir, b.Dockerfile)
+	}
+	if b.DigestFile != "" {
+		opts.DigestFile = con.JoinPath(dir, b.DigestFile)
+	}
+
+	return Build(con.JoinPath(dir, b.Dir), opts), nil
+}
+
+func init() {
+	fab.RegisterYAMLTarget("docker.Build", buildDecoder)
+	fab.SetYAMLTagDoc("docker.Build", "Build a container image.")
+}
@@ -0,0 +1,145 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bobg/fab"
+	"github.com/bobg/fab/internal/faketool"
+)
+
+func TestBuild(t *testing.T) {
+	e := faketool.New(t, "_testdata")
+
+	log := strings.Join(e.Run(t, "Image"), "\n")
+
+	digest, err := os.ReadFile(e.Path("out", "digest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(digest) != "sha256:0123456789abcdef\n" {
+		t.Errorf("got digest %q, want %q", digest, "sha256:0123456789abcdef\n")
+	}
+
+	fields := strings.Fields(log)
+	if len(fields) < 3 || fields[0] != "docker" || fields[1] != "buildx" || fields[2] != "build" {
+		t.Fatalf("got docker command %v, want docker buildx build ...", fields)
+	}
+	for _, want := range []string{"--tag registry.example.com/app:latest", "--platform linux/amd64,linux/arm64", "--push", "--metadata-file"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("docker command %q does not contain %q", log, want)
+		}
+	}
+	if last := fields[len(fields)-1]; last != "context" {
+		t.Errorf("got build context %s, want context", last)
+	}
+}
+
+func TestBuildCache(t *testing.T) {
+	e := faketool.New(t, "_testdata")
+
+	// These are relative to e.Dir,
+	// as file names appear in the log.
+	var (
+		cachedir = filepath.Join("fab", "docker-cache")
+		latest   = filepath.Join(cachedir, LatestCache)
+	)
+
+	// Without a hash DB, every build runs.
+	ctx := context.Background()
+	ctx = fab.WithVerbose(ctx, testing.Verbose())
+	e.Ctx = fab.WithFabdir(ctx, e.Path("fab"))
+
+	// build builds the image with the given Dockerfile
+	// and returns the docker command line
+	// and the key of the resulting latest cache.
+	build := func(content string) (string, string) {
+		t.Helper()
+
+		e.WriteFile(t, "context/Dockerfile", content)
+		target := Build(e.Path("context"), BuildOpts{CacheDir: "docker-cache", CacheRef: "registry.example.com/cache"})
+		log := strings.Join(e.RunTarget(t, target), "\n")
+
+		key, err := os.Readlink(e.Path(latest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return log, key
+	}
+
+	log1, key1 := build("FROM scratch\n")
+	if strings.Contains(log1, "type=local,src=") {
+		t.Errorf("first build imports a local cache: %s", log1)
+	}
+	for _, want := range []string{
+		"--cache-to type=local,mode=max,dest=" + filepath.Join(cachedir, key1),
+		"--cache-from type=registry,ref=registry.example.com/cache:" + key1,
+		"--cache-from type=registry,ref=registry.example.com/cache:latest",
+		"--cache-to type=registry,mode=max,ref=registry.example.com/cache:" + key1,
+		"--cache-to type=registry,mode=max,ref=registry.example.com/cache:latest",
+	} {
+		if !strings.Contains(log1, want) {
+			t.Errorf("first build args %q do not contain %q", log1, want)
+		}
+	}
+
+	log2, key2 := build("FROM scratch\nCOPY . .\n")
+	if key2 == key1 {
+		t.Errorf("cache key %s unchanged after changing the Dockerfile", key1)
+	}
+	for _, want := range []string{
+		"--cache-from type=local,src=" + latest,
+		"--cache-to type=local,mode=max,dest=" + filepath.Join(cachedir, key2),
+	} {
+		if !strings.Contains(log2, want) {
+			t.Errorf("second build args %q do not contain %q", log2, want)
+		}
+	}
+
+	log3, key3 := build("FROM scratch\n")
+	if key3 != key1 {
+		t.Errorf("got cache key %s for the first Dockerfile again, want %s", key3, key1)
+	}
+	if !strings.Contains(log3, "--cache-from type=local,src="+filepath.Join(cachedir, key1)) {
+		t.Errorf("third build args %q do not import the cache of the first build", log3)
+	}
+}
+
+func TestArgs(t *testing.T) {
+	t.Parallel()
+
+	b := &buildType{
+		Dir:        "ctx",
+		Dockerfile: "ctx/Dockerfile.prod",
+		Tags:       []string{"a:1", "a:latest"},
+		Platforms:  []string{"linux/amd64"},
+		Flags:      []string{"--pull"},
+	}
+	got := b.args("", new(buildCache))
+	want := []string{"buildx", "build", "--file", "ctx/Dockerfile.prod", "--tag", "a:1", "--tag", "a:latest", "--platform", "linux/amd64", "--pull", "ctx"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestReadDigest(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	metadataFile := filepath.Join(tmpdir, "metadata.json")
+	if err := os.WriteFile(metadataFile, []byte(`{"buildx.build.ref": "x"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readDigest(metadataFile); err == nil {
+		t.Error("got no error for metadata without a digest")
+	}
+}
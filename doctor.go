@@ -0,0 +1,345 @@
+package fab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+)
+
+// DoctorArg is the command-line argument
+// that makes fab check for problems with its state and the project's configuration,
+// as in:
+//
+//	fab doctor [-fix]
+//
+// See [Doctor] and [Controller.CheckProject].
+const DoctorArg = "doctor"
+
+// Doctor checks fabdir and the tools fab needs for problems,
+// writing a report to w.
+// It returns the number of problems found and not fixed.
+//
+// It checks:
+//
+//   - the integrity of the hash DB;
+//   - the directories of compiled drivers,
+//     which are incomplete if the driver binary or its hash is missing
+//     (e.g. after an interrupted compilation);
+//   - the version files of compiled drivers,
+//     which must be readable;
+//   - that the go command and the shell used by [Command] are available.
+//
+// If fix is true,
+// problems with safe automatic repairs are repaired.
+// A corrupt hash DB is renamed out of the way
+// (it is only a cache, so this causes nothing worse than some rebuilding),
+// and incomplete driver directories and unreadable version files are removed
+// (so the affected drivers will be recompiled).
+func Doctor(ctx context.Context, w io.Writer, fabdir string, fix bool) (int, error) {
+	d := &doctor{w: w, fix: fix}
+
+	d.printf("Checking %s\n", fabdir)
+	d.checkHashDB(ctx, fabdir)
+	if err := d.checkDrivers(fabdir); err != nil {
+		return d.problems, err
+	}
+
+	d.printf("Checking tools\n")
+	d.checkProgram("go")
+	d.checkProgram(shellProgram())
+
+	return d.problems, d.err
+}
+
+// CheckProject checks the targets registered in con for problems,
+// writing a report to w.
+// It returns the number of problems found.
+//
+// It checks that references to other targets by name can be resolved,
+// and that the programs run by [Command] targets
+// (and any command wrapper, see [Controller.SetCommandWrapper])
+// are available.
+func (con *Controller) CheckProject(w io.Writer) (int, error) {
+	d := &doctor{w: w}
+
+	d.printf("Checking targets in %s\n", con.topdir)
+
+	if wrapper := con.CommandWrapper(); len(wrapper) > 0 {
+		d.checkProgram(wrapper[0])
+	}
+
+	var (
+		seen     = set.New[uintptr]()
+		programs = set.New[string]()
+	)
+	for _, name := range con.RegistryNames() {
+		target, _ := con.RegistryTarget(name)
+		err := con.walkHelper([]Target{target}, seen, func(t Target) error {
+			if c, ok := t.(*Command); ok && c.Cmd != "" && !programs.Has(c.Cmd) {
+				programs.Add(c.Cmd)
+				if _, err := exec.LookPath(c.Cmd); err != nil {
+					d.problem(fmt.Sprintf("%s runs %s, which is not available: %s", con.Describe(c), c.Cmd, err), "", nil)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			d.problem(fmt.Sprintf("target %s: %s", name, err), "", nil)
+		}
+	}
+	if d.problems == 0 {
+		d.ok("all targets resolve")
+	}
+
+	return d.problems, d.err
+}
+
+// doctor accumulates the results of [Doctor] and [Controller.CheckProject].
+type doctor struct {
+	w        io.Writer
+	fix      bool
+	problems int
+	err      error // the first error writing to w
+}
+
+func (d *doctor) printf(format string, args ...any) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = fmt.Fprintf(d.w, format, args...)
+}
+
+func (d *doctor) ok(desc string) {
+	d.printf("  ok: %s\n", desc)
+}
+
+// problem reports a problem.
+// If repair is non-nil,
+// it is a safe automatic repair described by repairDesc,
+// which is performed if d.fix is true.
+func (d *doctor) problem(desc, repairDesc string, repair func() error) {
+	d.printf("  PROBLEM: %s\n", desc)
+	if repair == nil {
+		d.problems++
+		return
+	}
+	if !d.fix {
+		d.printf("    (fix with fab doctor -fix: %s)\n", repairDesc)
+		d.problems++
+		return
+	}
+	if err := repair(); err != nil {
+		d.printf("    could not %s: %s\n", repairDesc, err)
+		d.problems++
+		return
+	}
+	d.printf("    fixed: %s\n", repairDesc)
+}
+
+func (d *doctor) checkProgram(name string) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		d.problem(fmt.Sprintf("%s is not available: %s", name, err), "", nil)
+		return
+	}
+	d.ok(fmt.Sprintf("%s is %s", name, path))
+}
+
+func (d *doctor) checkHashDB(ctx context.Context, fabdir string) {
+	dbfile := filepath.Join(fabdir, "hash.db")
+	if _, err := os.Stat(dbfile); errors.Is(err, fs.ErrNotExist) {
+		d.ok("no hash DB yet")
+		return
+	}
+
+	err := func() error {
+		db, err := OpenHashDB(fabdir)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return db.Check(ctx)
+	}()
+	if err == nil {
+		d.ok("hash DB " + dbfile)
+		return
+	}
+
+	aside := dbfile + ".corrupt"
+	d.problem(
+		fmt.Sprintf("hash DB %s: %s", dbfile, err),
+		fmt.Sprintf("rename it to %s", aside),
+		func() error { return os.Rename(dbfile, aside) },
+	)
+}
+
+// checkDrivers looks for problems in the driver directories in fabdir.
+// A driver directory is one containing any of the files written by [Main.getDriver].
+func (d *doctor) checkDrivers(fabdir string) error {
+	var (
+		driverFiles = []string{"fab.bin", "hash", fabVersionBasename}
+		ndrivers    int
+	)
+
+	err := filepath.WalkDir(fabdir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if entry.Name() == driverBuildBasename {
+			if _, err := os.Stat(filepath.Join(path, "driver.go")); err == nil {
+				// The build dir of a driver, which holds a copy of Fab's own code.
+				return filepath.SkipDir
+			}
+		}
+
+		var present []string
+		for _, f := range driverFiles {
+			if _, err := os.Stat(filepath.Join(path, f)); err == nil {
+				present = append(present, f)
+			}
+		}
+		if len(present) == 0 {
+			return nil
+		}
+		ndrivers++
+
+		rel, err := filepath.Rel(fabdir, path)
+		if err != nil {
+			return errors.Wrapf(err, "getting relative path to %s", path)
+		}
+
+		var (
+			bin, hash  = filepath.Join(path, "fab.bin"), filepath.Join(path, "hash")
+			_, binErr  = os.Stat(bin)
+			_, hashErr = os.Stat(hash)
+		)
+		if binErr != nil || hashErr != nil {
+			d.problem(
+				fmt.Sprintf("driver directory %s is incomplete", rel),
+				"remove its files so the driver is recompiled",
+				func() error {
+					for _, f := range present {
+						if err := os.Remove(filepath.Join(path, f)); err != nil {
+							return err
+						}
+					}
+					// Remove the directory too, if that leaves it empty.
+					_ = os.Remove(path)
+					return nil
+				},
+			)
+			return nil
+		}
+
+		versionfile := filepath.Join(path, fabVersionBasename)
+		if err := checkVersionFile(versionfile); err != nil {
+			d.problem(
+				fmt.Sprintf("driver version file %s: %s", filepath.Join(rel, fabVersionBasename), err),
+				"remove it so the driver is recompiled",
+				func() error { return os.Remove(versionfile) },
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "walking %s", fabdir)
+	}
+
+	if ndrivers == 1 {
+		d.ok("1 compiled driver")
+	} else {
+		d.ok(fmt.Sprintf("%d compiled drivers", ndrivers))
+	}
+	return nil
+}
+
+// checkVersionFile checks that a driver's version file,
+// if present,
+// is readable.
+func checkVersionFile(versionfile string) error {
+	f, err := os.Open(versionfile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var info debug.BuildInfo
+	return errors.Wrap(json.NewDecoder(f).Decode(&info), "decoding")
+}
+
+// doctor implements [Main.Run] when m.Doctor is true.
+func (m *Main) doctor(ctx context.Context) error {
+	problems, err := Doctor(ctx, os.Stdout, m.Fabdir, m.Fix)
+	if err != nil {
+		return err
+	}
+
+	projectProblems, err := m.checkProject(ctx)
+	if err != nil {
+		return err
+	}
+	problems += projectProblems
+
+	if problems > 0 {
+		return fmt.Errorf("found %d problem(s)", problems)
+	}
+	return nil
+}
+
+// checkProject runs [Controller.CheckProject] in the driver,
+// or in driverless mode if there is no _fab directory.
+// It returns the number of problems found.
+func (m *Main) checkProject(ctx context.Context) (int, error) {
+	if m.Topdir == "" {
+		var err error
+		if m.Topdir, err = TopDir("."); err != nil {
+			fmt.Printf("No project found: %s\n", err)
+			return 0, nil
+		}
+	}
+
+	driver, err := m.getDriver(ctx, false)
+	if errors.Is(err, errNoDriver) {
+		con := NewController(m.Topdir)
+		if err := con.ReadYAMLFile(""); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Printf("Checking targets in %s\n  PROBLEM: reading YAML file: %s\n", m.Topdir, err)
+			return 1, nil
+		}
+		return con.CheckProject(os.Stdout)
+	}
+	if err != nil {
+		fmt.Printf("Checking targets in %s\n  PROBLEM: preparing driver: %s\n", m.Topdir, err)
+		return 1, nil
+	}
+
+	cmd := exec.CommandContext(ctx, driver, "-fab", m.Fabdir, "-top", m.Topdir, "-doctor")
+	cmd.Dir = m.Topdir
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		// The driver has reported the problems.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), nil
+		}
+		return 0, errors.Wrapf(err, "running %s", driver)
+	}
+	return 0, nil
+}
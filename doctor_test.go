@@ -0,0 +1,120 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	t.Parallel()
+
+	fabdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fabdir)
+
+	var (
+		dbfile     = filepath.Join(fabdir, "hash.db")
+		incomplete = filepath.Join(fabdir, "example.com", "a", "_fab")
+		badVersion = filepath.Join(fabdir, "example.com", "b", "_fab")
+	)
+
+	if err := os.WriteFile(dbfile, []byte(strings.Repeat("not a database\n", 1000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{incomplete, badVersion} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(incomplete, "hash"), []byte("xyz"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"hash": "xyz", "fab.bin": "", fabVersionBasename: "{"} {
+		if err := os.WriteFile(filepath.Join(badVersion, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+
+	var buf strings.Builder
+	problems, err := Doctor(ctx, &buf, fabdir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems != 3 {
+		t.Errorf("got %d problems, want 3; report is:\n%s", problems, buf.String())
+	}
+
+	buf.Reset()
+	problems, err = Doctor(ctx, &buf, fabdir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems != 0 {
+		t.Errorf("got %d problems not fixed, want 0; report is:\n%s", problems, buf.String())
+	}
+	if got := strings.Count(buf.String(), "fixed:"); got != 3 {
+		t.Errorf("got %d fixes, want 3; report is:\n%s", got, buf.String())
+	}
+
+	if _, err := os.Stat(dbfile + ".corrupt"); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(incomplete); !os.IsNotExist(err) {
+		t.Errorf("incomplete driver directory remains (err is %v)", err)
+	}
+	if _, err := os.Stat(filepath.Join(badVersion, fabVersionBasename)); !os.IsNotExist(err) {
+		t.Errorf("bad version file remains (err is %v)", err)
+	}
+
+	buf.Reset()
+	problems, err = Doctor(ctx, &buf, fabdir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems != 0 {
+		t.Errorf("got %d problems after fixing, want 0; report is:\n%s", problems, buf.String())
+	}
+}
+
+func TestCheckProject(t *testing.T) {
+	t.Parallel()
+
+	const yml = `
+Good: !Command
+  Shell: echo hello
+
+Missing: !All
+  - Good
+  - Nonexistent
+
+Unavailable: !Command
+  Cmd: fab-test-no-such-program
+`
+
+	con := NewController("")
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf strings.Builder
+	problems, err := con.CheckProject(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := buf.String()
+	if problems != 2 {
+		t.Errorf("got %d problems, want 2; report is:\n%s", problems, report)
+	}
+	for _, want := range []string{"target Missing: ", "fab-test-no-such-program"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report does not contain %q; report is:\n%s", want, report)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package fab
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Download creates a target that downloads a file over HTTP or HTTPS.
+//
+// If sha256 is non-empty,
+// it is the expected hex-encoded SHA-256 hash of the file,
+// and the download fails if the file does not match.
+//
+// The file is downloaded to out.part and renamed to out when complete.
+// If out.part exists,
+// e.g. from an earlier interrupted download,
+// the download resumes where it left off,
+// if the server supports that.
+//
+// The result is a [Files] target whose only output is out,
+// so it is skipped when the hash database shows it is up to date,
+// and it runs as a prerequisite of any Files target that has out as an input.
+// Any opts are applied as they are in Files.
+// It is also skipped when out already exists with the expected hash.
+//
+// A Download target may be specified in YAML using the !Download tag,
+// which introduces a mapping whose fields are:
+//
+//   - URL: the URL to download
+//   - Out: the output file,
+//     either absolute or relative to the directory containing the YAML file
+//   - SHA256: the expected hash of the file
+//
+// Example:
+//
+//	Protoc: !Download
+//	  URL: https://github.com/protocolbuffers/protobuf/releases/download/v25.1/protoc-25.1-linux-x86_64.zip
+//	  Out: _tools/protoc.zip
+//	  SHA256: ed8fca87a11c888fed329d6a59c34c7d436165f662a2c875246ddb1ac2b6dd50
+func Download(url, out, sha256 string, opts ...FilesOpt) Target {
+	result := Files(&download{URL: url, Out: out, SHA256: sha256}, nil, []string{out}, opts...)
+	result.(*files).desc = "Download"
+	return result
+}
+
+type download struct {
+	URL    string `json:"url"`
+	Out    string `json:"out"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+var _ Target = &download{}
+
+// Run implements Target.Run.
+func (d *download) Run(ctx context.Context, con *Controller) error {
+	if d.SHA256 != "" {
+		if got, err := fileSHA256(d.Out); err == nil && got == d.SHA256 {
+			if GetVerbose(ctx) {
+				con.Indentf("  %s is already present", d.Out)
+			}
+			return nil
+		}
+	}
+
+	if GetDryRun(ctx) {
+		if GetVerbose(ctx) {
+			con.Indentf("  Would download %s to %s", d.URL, d.Out)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.Out), 0755); err != nil {
+		return errors.Wrapf(err, "creating directory for %s", d.Out)
+	}
+
+	part := d.Out + ".part"
+	if err := d.fetch(ctx, con, part); err != nil {
+		return err
+	}
+
+	if d.SHA256 != "" {
+		got, err := fileSHA256(part)
+		if err != nil {
+			return err
+		}
+		if got != d.SHA256 {
+			// Don't try to resume from a bad file next time.
+			_ = os.Remove(part)
+			return ChecksumError{URL: d.URL, Want: d.SHA256, Got: got}
+		}
+	}
+
+	return errors.Wrapf(os.Rename(part, d.Out), "renaming %s to %s", part, d.Out)
+}
+
+// fetch downloads d.URL to the file part,
+// resuming from the end of the file if it exists.
+func (d *download) fetch(ctx context.Context, con *Controller, part string) error {
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", part)
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return errors.Wrapf(err, "seeking to end of %s", part)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.URL, nil)
+	if err != nil {
+		return errors.Wrapf(err, "creating request for %s", d.URL)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	if GetVerbose(ctx) {
+		if offset > 0 {
+			con.Indentf("  Resuming download of %s at byte %d", d.URL, offset)
+		} else {
+			con.Indentf("  Downloading %s", d.URL)
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "requesting %s", d.URL)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// The server sent the whole file.
+		if err = f.Truncate(0); err != nil {
+			return errors.Wrapf(err, "truncating %s", part)
+		}
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return errors.Wrapf(err, "seeking to start of %s", part)
+		}
+
+	case http.StatusPartialContent:
+		// The server sent the rest of the file.
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The earlier download was already complete.
+		if offset > 0 {
+			return nil
+		}
+		fallthrough
+
+	default:
+		return fmt.Errorf("requesting %s: %s", d.URL, resp.Status)
+	}
+
+	if _, err = io.Copy(f, resp.Body); err != nil {
+		return errors.Wrapf(err, "downloading %s", d.URL)
+	}
+	return errors.Wrapf(f.Close(), "closing %s", part)
+}
+
+// Desc implements Target.Desc.
+func (*download) Desc() string {
+	return "Download"
+}
+
+// ChecksumError is the error returned by a [Download] target
+// when the downloaded file does not have the expected hash.
+type ChecksumError struct {
+	URL       string
+	Want, Got string // hex-encoded SHA-256 hashes
+}
+
+func (e ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch for %s: got %s, want %s", e.URL, e.Got, e.Want)
+}
+
+func fileSHA256(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", errors.Wrapf(err, "opening %s", filename)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "hashing %s", filename)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func downloadDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var ydownload struct {
+		URL    string `yaml:"URL"`
+		Out    string `yaml:"Out"`
+		SHA256 string `yaml:"SHA256"`
+	}
+	if err := node.Decode(&ydownload); err != nil {
+		return nil, errors.Wrap(err, "YAML error in Download node")
+	}
+	if ydownload.URL == "" || ydownload.Out == "" {
+		return nil, fmt.Errorf("Download node requires URL and Out")
+	}
+
+	return Download(ydownload.URL, con.JoinPath(dir, ydownload.Out), ydownload.SHA256), nil
+}
+
+func init() {
+	RegisterYAMLTarget("Download", downloadDecoder)
+	SetYAMLTagDoc("Download", "Download a file over HTTP or HTTPS, verifying its hash.")
+}
@@ -0,0 +1,123 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestDownload(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	var (
+		mu       sync.Mutex
+		requests []string // Range headers
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		requests = append(requests, req.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	ctx := context.Background()
+	ctx = WithVerbose(ctx, testing.Verbose())
+	ctx = WithHashDB(ctx, memdb(set.New[string]()))
+
+	check := func(out string) {
+		t.Helper()
+		got, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("got %d bytes, want %d", len(got), len(content))
+		}
+	}
+	lastRequests := func(n int) []string {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(requests) < n {
+			return nil
+		}
+		return requests[len(requests)-n:]
+	}
+
+	t.Run("full", func(t *testing.T) {
+		out := filepath.Join(tmpdir, "full", "file")
+		if err := NewController(tmpdir).Run(ctx, Download(server.URL, out, hash)); err != nil {
+			t.Fatal(err)
+		}
+		check(out)
+		if _, err := os.Stat(out + ".part"); !os.IsNotExist(err) {
+			t.Errorf("partial file remains (err is %v)", err)
+		}
+
+		// Up to date: no new request.
+		mu.Lock()
+		n := len(requests)
+		mu.Unlock()
+		if err := NewController(tmpdir).Run(ctx, Download(server.URL, out, hash)); err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(requests) != n {
+			t.Errorf("got %d new requests, want 0", len(requests)-n)
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		out := filepath.Join(tmpdir, "resume")
+		if err := os.WriteFile(out+".part", content[:4000], 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewController(tmpdir).Run(ctx, Download(server.URL, out, hash)); err != nil {
+			t.Fatal(err)
+		}
+		check(out)
+		if got := lastRequests(1); len(got) != 1 || got[0] != "bytes=4000-" {
+			t.Errorf("got Range %v, want bytes=4000-", got)
+		}
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		out := filepath.Join(tmpdir, "bad")
+		err := NewController(tmpdir).Run(ctx, Download(server.URL, out, "0123"))
+
+		var cerr ChecksumError
+		if !errors.As(err, &cerr) {
+			t.Fatalf("got error %v, want ChecksumError", err)
+		}
+		if cerr.Got != hash {
+			t.Errorf("got hash %s, want %s", cerr.Got, hash)
+		}
+		for _, f := range []string{out, out + ".part"} {
+			if _, err := os.Stat(f); !os.IsNotExist(err) {
+				t.Errorf("%s exists (err is %v)", f, err)
+			}
+		}
+	})
+}
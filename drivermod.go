@@ -0,0 +1,319 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/tools/go/packages"
+)
+
+// driverModulePath is the module path of the synthesized driver module.
+// It is also the name of the executable produced in the build directory.
+const driverModulePath = "x"
+
+// fabModulePath is the module path of Fab itself.
+const fabModulePath = "github.com/bobg/fab"
+
+// writeDriverModule writes the go.mod and go.sum files of the synthesized driver module in tree.
+//
+// Rather than discovering the module's requirements with "go mod tidy,"
+// which may need the network,
+// it combines the requirements of Fab itself
+// (from its embedded go.mod file)
+// with those of userMod,
+// the module containing the user's _fab package
+// (which may be nil),
+// taking the higher version of any module required by both.
+// The user module's replace directives are carried over,
+// and github.com/bobg/fab is replaced with the embedded copy of Fab in the tree's fab subdirectory.
+// The go.sum file is the union of Fab's and the user module's.
+//
+// Since the user's own builds have already put the required modules in the module cache,
+// this is normally enough to build the driver offline.
+func writeDriverModule(tree *driverTree, userMod *packages.Module) error {
+	fabGoMod, err := embeds.ReadFile("go.mod")
+	if err != nil {
+		return errors.Wrap(err, "reading embedded go.mod")
+	}
+	fabGoSum, err := embeds.ReadFile("go.sum")
+	if err != nil {
+		return errors.Wrap(err, "reading embedded go.sum")
+	}
+
+	var (
+		userGoModPath        string
+		userGoMod, userGoSum []byte
+	)
+	if userMod != nil && userMod.GoMod != "" {
+		userGoModPath = userMod.GoMod
+		if userGoMod, err = os.ReadFile(userGoModPath); err != nil {
+			return errors.Wrapf(err, "reading %s", userGoModPath)
+		}
+		userGoSumPath := strings.TrimSuffix(userGoModPath, ".mod") + ".sum"
+		if userGoSum, err = os.ReadFile(userGoSumPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrapf(err, "reading %s", userGoSumPath)
+		}
+	}
+
+	gomod, err := driverGoMod(fabGoMod, userGoModPath, userGoMod)
+	if err != nil {
+		return err
+	}
+	if err := tree.writeFile("go.mod", gomod); err != nil {
+		return errors.Wrap(err, "writing go.mod")
+	}
+
+	gosum := mergeGoSums(fabGoSum, userGoSum)
+	return errors.Wrap(tree.writeFile("go.sum", gosum), "writing go.sum")
+}
+
+// driverGoMod produces the go.mod file of the driver module
+// from the go.mod files of Fab and of the user's module
+// (if userGoModPath is not empty).
+// See writeDriverModule.
+func driverGoMod(fabGoMod []byte, userGoModPath string, userGoMod []byte) ([]byte, error) {
+	fabmf, err := modfile.Parse("go.mod", fabGoMod, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing embedded go.mod")
+	}
+
+	var (
+		goVersion string
+		versions  = make(map[string]string) // module path -> version
+		indirect  = make(map[string]bool)
+		order     []string
+	)
+	addRequires := func(mf *modfile.File) {
+		if mf.Go != nil && (goVersion == "" || semver.Compare("v"+mf.Go.Version, "v"+goVersion) > 0) {
+			goVersion = mf.Go.Version
+		}
+		for _, req := range mf.Require {
+			path := req.Mod.Path
+			if path == fabmf.Module.Mod.Path {
+				continue
+			}
+			v, ok := versions[path]
+			if !ok {
+				order = append(order, path)
+				indirect[path] = req.Indirect
+			} else {
+				indirect[path] = indirect[path] && req.Indirect
+			}
+			if !ok || semver.Compare(req.Mod.Version, v) > 0 {
+				versions[path] = req.Mod.Version
+			}
+		}
+	}
+
+	addRequires(fabmf)
+
+	var usermf *modfile.File
+	if userGoModPath != "" {
+		usermf, err = modfile.Parse(userGoModPath, userGoMod, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", userGoModPath)
+		}
+		addRequires(usermf)
+	}
+
+	mf := new(modfile.File)
+	if err := mf.AddModuleStmt(driverModulePath); err != nil {
+		return nil, errors.Wrap(err, "adding module statement")
+	}
+	if goVersion != "" {
+		if err := mf.AddGoStmt(goVersion); err != nil {
+			return nil, errors.Wrap(err, "adding go statement")
+		}
+	}
+	reqs := []*modfile.Require{{Mod: module.Version{Path: fabmf.Module.Mod.Path, Version: "v0.0.0"}}}
+	for _, path := range order {
+		reqs = append(reqs, &modfile.Require{Mod: module.Version{Path: path, Version: versions[path]}, Indirect: indirect[path]})
+	}
+	mf.SetRequireSeparateIndirect(reqs)
+	if err := mf.AddReplace(fabmf.Module.Mod.Path, "", "./fab", ""); err != nil {
+		return nil, errors.Wrap(err, "adding replace directive for fab")
+	}
+
+	if usermf != nil {
+		userDir := filepath.Dir(userGoModPath)
+		for _, rep := range usermf.Replace {
+			if rep.Old.Path == fabmf.Module.Mod.Path {
+				continue
+			}
+			if err := mf.AddReplace(rep.Old.Path, rep.Old.Version, replacementPath(userDir, rep), rep.New.Version); err != nil {
+				return nil, errors.Wrapf(err, "adding replace directive for %s", rep.Old.Path)
+			}
+		}
+	}
+
+	mf.Cleanup()
+	return mf.Format()
+}
+
+// replacementPath returns the path that rep replaces its module with,
+// made absolute (relative to dir) if it is a local directory.
+func replacementPath(dir string, rep *modfile.Replace) string {
+	if rep.New.Version == "" && !filepath.IsAbs(rep.New.Path) {
+		return filepath.Join(dir, rep.New.Path)
+	}
+	return rep.New.Path
+}
+
+// writeUserDriverModule writes the go.mod and go.sum files
+// used (via the go compiler's -modfile flag)
+// for compiling the driver as part of userMod,
+// the module containing the user's _fab package.
+// See userDriverGoMod.
+func writeUserDriverModule(tree *driverTree, userMod *packages.Module) error {
+	userGoMod, err := os.ReadFile(userMod.GoMod)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s", userMod.GoMod)
+	}
+	userGoSumPath := strings.TrimSuffix(userMod.GoMod, ".mod") + ".sum"
+	userGoSum, err := os.ReadFile(userGoSumPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrapf(err, "reading %s", userGoSumPath)
+	}
+
+	var fabDir string
+	if userMod.Path != fabModulePath {
+		fabDir = filepath.Join(tree.dir, "fab")
+	}
+	gomod, err := userDriverGoMod(userMod.GoMod, userGoMod, fabDir)
+	if err != nil {
+		return err
+	}
+	if err := tree.writeFile("go.mod", gomod); err != nil {
+		return errors.Wrap(err, "writing go.mod")
+	}
+
+	fabGoSum, err := embeds.ReadFile("go.sum")
+	if err != nil {
+		return errors.Wrap(err, "reading embedded go.sum")
+	}
+	gosum := mergeGoSums(userGoSum, fabGoSum)
+	return errors.Wrap(tree.writeFile("go.sum", gosum), "writing go.sum")
+}
+
+// userDriverGoMod produces a copy of the user's go.mod file
+// for compiling the driver as part of the user's module.
+// Since the copy lives elsewhere,
+// its replace directives that refer to local directories
+// are made absolute.
+// If fabDir is not empty,
+// github.com/bobg/fab is replaced with the copy of Fab in that directory
+// (and required, if the user's module does not already require it).
+func userDriverGoMod(userGoModPath string, userGoMod []byte, fabDir string) ([]byte, error) {
+	mf, err := modfile.Parse(userGoModPath, userGoMod, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", userGoModPath)
+	}
+
+	userDir := filepath.Dir(userGoModPath)
+	for _, rep := range mf.Replace {
+		if fabDir != "" && rep.Old.Path == fabModulePath {
+			if err := mf.DropReplace(rep.Old.Path, rep.Old.Version); err != nil {
+				return nil, errors.Wrapf(err, "dropping replace directive for %s", rep.Old.Path)
+			}
+			continue
+		}
+		newPath := replacementPath(userDir, rep)
+		if newPath == rep.New.Path {
+			continue
+		}
+		if err := mf.AddReplace(rep.Old.Path, rep.Old.Version, newPath, rep.New.Version); err != nil {
+			return nil, errors.Wrapf(err, "adding replace directive for %s", rep.Old.Path)
+		}
+	}
+
+	if fabDir != "" {
+		var found bool
+		for _, req := range mf.Require {
+			if req.Mod.Path == fabModulePath {
+				found = true
+				break
+			}
+		}
+		if !found {
+			mf.AddNewRequire(fabModulePath, "v0.0.0", false)
+		}
+		if err := mf.AddReplace(fabModulePath, "", fabDir, ""); err != nil {
+			return nil, errors.Wrap(err, "adding replace directive for fab")
+		}
+	}
+
+	mf.Cleanup()
+	return mf.Format()
+}
+
+// mergeGoSums returns the lines of the given go.sum files,
+// without duplicates.
+func mergeGoSums(sums ...[]byte) []byte {
+	var (
+		buf  bytes.Buffer
+		seen = set.New[string]()
+	)
+	for _, sum := range sums {
+		for _, line := range strings.Split(string(sum), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || seen.Has(line) {
+				continue
+			}
+			seen.Add(line)
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+// buildDriver runs "go build" in dir with the given arguments.
+// It first tries to build offline
+// (with GOPROXY=off, using only the module cache).
+// If that fails,
+// and the environment does not also say GOPROXY=off,
+// it tries again with the network allowed,
+// first running "go mod tidy" if tidy is true.
+func buildDriver(ctx context.Context, dir string, tidy bool, args ...string) error {
+	args = append([]string{"build"}, args...)
+
+	offline, err := goCommand(ctx, dir, []string{"GOPROXY=off"}, args...)
+	if err == nil {
+		return nil
+	}
+	if os.Getenv("GOPROXY") == "off" {
+		return CommandErr{Err: errors.Wrap(err, "in go build"), Output: offline}
+	}
+
+	if tidy {
+		if output, err := goCommand(ctx, dir, nil, "mod", "tidy"); err != nil {
+			return CommandErr{Err: errors.Wrap(err, "in go mod tidy"), Output: output}
+		}
+	}
+	if output, err := goCommand(ctx, dir, nil, args...); err != nil {
+		return CommandErr{Err: errors.Wrap(err, "in go build"), Output: output}
+	}
+	return nil
+}
+
+// goCommand runs the go command in dir with the given arguments,
+// adding env to its environment,
+// and returns its combined output.
+// Workspace mode is disabled,
+// since the driver's go.mod file is not part of any go.work file.
+func goCommand(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOWORK=off")
+	cmd.Env = append(cmd.Env, env...)
+	return cmd.CombinedOutput()
+}
@@ -0,0 +1,162 @@
+package fab
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDriverGoMod(t *testing.T) {
+	t.Parallel()
+
+	const fabGoMod = `module github.com/bobg/fab
+
+go 1.20
+
+require (
+	github.com/bobg/errors v0.10.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.21.0 // indirect
+`
+
+	const userGoMod = `module example.com/proj
+
+go 1.22.0
+
+require (
+	github.com/bobg/fab v0.48.4
+	gopkg.in/yaml.v3 v3.0.0
+	golang.org/x/sys v0.29.0
+	example.com/lib v1.2.3
+)
+
+replace example.com/lib => ../lib
+
+replace github.com/bobg/fab => ../fab
+`
+
+	userGoModPath := filepath.Join(string(filepath.Separator), "src", "proj", "go.mod")
+	got, err := driverGoMod([]byte(fabGoMod), userGoModPath, []byte(userGoMod))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `module x
+
+go 1.22.0
+
+require (
+	example.com/lib v1.2.3
+	github.com/bobg/errors v0.10.0
+	github.com/bobg/fab v0.0.0
+	golang.org/x/sys v0.29.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+replace github.com/bobg/fab => ./fab
+
+replace example.com/lib => ` + filepath.Join(string(filepath.Separator), "src", "lib") + "\n"
+
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Without a user module, only Fab's requirements are used.
+	got, err = driverGoMod([]byte(fabGoMod), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `module x
+
+go 1.20
+
+require (
+	github.com/bobg/errors v0.10.0
+	github.com/bobg/fab v0.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.21.0 // indirect
+
+replace github.com/bobg/fab => ./fab
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUserDriverGoMod(t *testing.T) {
+	t.Parallel()
+
+	const userGoMod = `module example.com/proj
+
+go 1.22.0
+
+require (
+	example.com/lib v1.2.3
+	example.com/other v1.0.0
+)
+
+replace example.com/lib => ../lib
+
+replace example.com/other => example.com/fork v1.0.1
+
+replace github.com/bobg/fab => ../fab
+`
+
+	var (
+		root          = string(filepath.Separator)
+		userGoModPath = filepath.Join(root, "src", "proj", "go.mod")
+		fabDir        = filepath.Join(root, "cache", "build", "fab")
+	)
+
+	got, err := userDriverGoMod(userGoModPath, []byte(userGoMod), fabDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `module example.com/proj
+
+go 1.22.0
+
+require (
+	example.com/lib v1.2.3
+	example.com/other v1.0.0
+	github.com/bobg/fab v0.0.0
+)
+
+replace example.com/lib => ` + filepath.Join(root, "src", "lib") + `
+
+replace example.com/other => example.com/fork v1.0.1
+
+replace github.com/bobg/fab => ` + fabDir + "\n"
+
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// With no fabDir (when the user's module is Fab itself),
+	// only the local replacements are changed.
+	got, err = userDriverGoMod(userGoModPath, []byte(userGoMod), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = strings.NewReplacer(
+		"../lib", filepath.Join(root, "src", "lib"),
+		"../fab", filepath.Join(root, "src", "fab"),
+	).Replace(userGoMod)
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMergeGoSums(t *testing.T) {
+	t.Parallel()
+
+	got := mergeGoSums([]byte("a h1:x\nb h1:y\n"), []byte("b h1:y\n\nc h1:z"))
+	if want := "a h1:x\nb h1:y\nc h1:z\n"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -2,7 +2,7 @@ package fab
 
 import "embed"
 
-//go:embed *.go go.* driver.go.tmpl golang/*.go proto/*.go sqlite/*.go sqlite/*.sql ts/*.go
+//go:embed *.go go.* driver.go.tmpl golang/*.go httpdb/*.go proto/*.go sqlite/*.go sqlite/*.sql ts/*.go
 var embeds embed.FS
 
 //go:embed driver.go.tmpl
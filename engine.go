@@ -0,0 +1,206 @@
+package fab
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/bobg/errors"
+)
+
+// Engine runs Fab targets in-process,
+// for Go programs that use Fab as a library
+// rather than running the fab command
+// (see [Main])
+// with its compiled driver.
+//
+// Create one with [NewEngine],
+// add targets to it with [Engine.AddTarget], [Engine.AddYAML], and [Engine.AddYAMLFile],
+// and run them by name with [Engine.Run].
+// Call [Engine.Close] when finished.
+type Engine struct {
+	con    *Controller
+	opts   EngineOptions
+	db     HashDB
+	closer io.Closer
+
+	mu sync.Mutex // serializes calls to Run
+}
+
+// EngineOptions are the options for [NewEngine].
+// The zero value is usable.
+type EngineOptions struct {
+	// Topdir is the top directory of the project.
+	// Target names in YAML files in its subdirectories
+	// are qualified by the subdirectory names.
+	// The default is the current directory.
+	Topdir string
+
+	// Fabdir is the directory where Fab keeps its persistent state,
+	// such as the hash DB.
+	// See [WithFabdir].
+	Fabdir string
+
+	// Cache is the URL of the hash DB,
+	// as in [OpenHashDBURL].
+	// If Cache is empty but Fabdir is not,
+	// the local hash DB in Fabdir is used.
+	// If both are empty and HashDB is nil,
+	// there is no hash DB,
+	// and [Files] targets always run.
+	Cache string
+
+	// HashDB, if non-nil,
+	// is the hash DB to use,
+	// instead of one opened according to Cache and Fabdir.
+	HashDB HashDB
+
+	// These options have the same meanings as the corresponding fields of [Main].
+	Verbose, Force, DryRun, KeepGoing, FailFast bool
+
+	// Limits bounds the targets that are run.
+	// See [Controller.SetLimits].
+	Limits Limits
+
+	// Progress, if non-nil,
+	// receives the progress events of the engine.
+	// See [Controller.SetProgressSink].
+	Progress ProgressSink
+}
+
+// NewEngine creates a new [Engine] with the given options.
+// The context is used for opening the hash DB, if any.
+func NewEngine(ctx context.Context, opts EngineOptions) (*Engine, error) {
+	e := &Engine{
+		con:  NewController(opts.Topdir),
+		opts: opts,
+		db:   opts.HashDB,
+	}
+	e.con.SetLimits(opts.Limits)
+	if opts.Progress != nil {
+		e.con.SetProgressSink(opts.Progress)
+	}
+
+	if e.db == nil && (opts.Cache != "" || opts.Fabdir != "") {
+		db, err := OpenHashDBURL(ctx, opts.Cache, opts.Fabdir)
+		if err != nil {
+			return nil, errors.Wrap(err, "opening hash DB")
+		}
+		e.db = db
+		if c, ok := db.(io.Closer); ok {
+			e.closer = c
+		}
+	}
+
+	return e, nil
+}
+
+// Close releases the resources of the engine,
+// such as the hash DB it opened.
+func (e *Engine) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
+
+// Controller returns the engine's underlying [Controller],
+// for access to features not covered by the Engine API.
+func (e *Engine) Controller() *Controller {
+	return e.con
+}
+
+// AddTarget adds a target to the engine with the given name and options.
+// See [Controller.Register].
+func (e *Engine) AddTarget(name string, target Target, opts ...RegisterOption) error {
+	_, err := e.con.Register(name, target, opts...)
+	return err
+}
+
+// AddYAML adds the targets in the YAML document read from r.
+// The dir argument is the directory, relative to the engine's top directory,
+// whose name qualifies the names of the targets
+// (empty for the top directory itself).
+// See [Controller.ReadYAML].
+func (e *Engine) AddYAML(r io.Reader, dir string) error {
+	return e.con.ReadYAML(r, dir)
+}
+
+// AddYAMLFile adds the targets in the fab.yaml file
+// in dir,
+// a directory relative to the engine's top directory
+// (empty for the top directory itself).
+// See [Controller.ReadYAMLFile].
+func (e *Engine) AddYAMLFile(dir string) error {
+	return e.con.ReadYAMLFile(dir)
+}
+
+// TargetInfo describes a target for [Engine.List].
+type TargetInfo struct {
+	Name   string
+	Doc    string
+	Tags   []string
+	Params []Param
+}
+
+// List describes the targets that have been added to the engine,
+// sorted by name,
+// except for hidden ones (see [WithHidden]).
+func (e *Engine) List() []TargetInfo {
+	var result []TargetInfo
+	for _, name := range e.con.listedNames() {
+		target, doc := e.con.RegistryTarget(name)
+		result = append(result, TargetInfo{
+			Name:   name,
+			Doc:    doc,
+			Tags:   e.con.Tags(name),
+			Params: e.con.targetParams(target),
+		})
+	}
+	return result
+}
+
+// Run runs the targets named in args,
+// which are parsed as on the fab command line
+// (see [Controller.ParseArgs]).
+//
+// Unlike [Controller.Run],
+// each call to Run runs its targets afresh
+// (subject to the hash DB, for [Files] targets),
+// rather than reusing the results of earlier calls.
+// Calls to Run do not overlap;
+// a call waits for any that is already in progress.
+func (e *Engine) Run(ctx context.Context, args ...string) error {
+	targets, err := e.con.ParseArgs(args)
+	if err != nil {
+		return errors.Wrap(err, "parsing args")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.con.forgetAll()
+	return e.con.Run(e.context(ctx), targets...)
+}
+
+// Results returns the results of the targets run by the latest call to [Engine.Run].
+// See [Controller.Results].
+func (e *Engine) Results() []Result {
+	return e.con.Results()
+}
+
+// context decorates ctx according to the engine's options.
+func (e *Engine) context(ctx context.Context) context.Context {
+	ctx = WithVerbose(ctx, e.opts.Verbose)
+	ctx = WithForce(ctx, e.opts.Force)
+	ctx = WithDryRun(ctx, e.opts.DryRun)
+	ctx = WithKeepGoing(ctx, e.opts.KeepGoing)
+	ctx = WithFailFast(ctx, e.opts.FailFast)
+	if e.opts.Fabdir != "" {
+		ctx = WithFabdir(ctx, e.opts.Fabdir)
+	}
+	if e.db != nil {
+		ctx = WithHashDB(ctx, e.db)
+	}
+	return ctx
+}
@@ -0,0 +1,93 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEngine(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	ctx := context.Background()
+
+	e, err := NewEngine(ctx, EngineOptions{Topdir: tmpdir, Fabdir: filepath.Join(tmpdir, ".fab")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	const yml = `
+# Write out.
+Out: !Files
+  In: [in]
+  Out: [out]
+  Target: !Command
+    Shell: cp in out
+`
+	if err := e.AddYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	count := &countTarget{}
+	if err := e.AddTarget("Count", count, WithDoc("Count runs."), WithTags("test")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddTarget("helper", &countTarget{}, WithHidden()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []TargetInfo{
+		{Name: "Count", Doc: "Count runs.", Tags: []string{"test"}},
+		{Name: "Out", Doc: "Write out."},
+	}
+	if got := e.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpdir, "in"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each call to Run runs the targets again.
+	for i := 1; i <= 2; i++ {
+		if err := e.Run(ctx, "Count", "Out"); err != nil {
+			t.Fatalf("run %d: %s", i, err)
+		}
+		if int(count.count) != i {
+			t.Errorf("after run %d got count %d, want %d", i, count.count, i)
+		}
+	}
+
+	got, err := os.ReadFile(filepath.Join(tmpdir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello\n" {
+		t.Errorf("got %q in out, want %q", got, "hello\n")
+	}
+
+	// The second run of Out found it up to date in the hash DB.
+	var cached bool
+	for _, res := range e.Results() {
+		if res.Name == "Out" {
+			cached = res.Status == StatusCached
+		}
+	}
+	if !cached {
+		t.Errorf("Out not cached in second run; results %+v", e.Results())
+	}
+
+	if err := e.Run(ctx, "Nonesuch"); err == nil {
+		t.Error("got no error for an unknown target")
+	}
+}
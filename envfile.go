@@ -0,0 +1,179 @@
+package fab
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+	"github.com/bobg/go-generics/v2/slices"
+)
+
+// readEnvFile reads the .env-style file named by c.EnvFile
+// and returns its settings as VAR=VALUE strings,
+// for adding to env
+// (the command's environment so far).
+// See Command.EnvFile for the syntax.
+func (c *Command) readEnvFile(sb *sandbox, env []string) ([]string, error) {
+	filename := c.EnvFile
+	if sb != nil {
+		filename = sb.path(filename)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening env file %s", filename)
+	}
+	defer f.Close()
+
+	result, err := parseEnvFile(f, env)
+	return result, errors.Wrapf(err, "in env file %s", filename)
+}
+
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseEnvFile parses the contents of a .env-style file,
+// returning its settings as VAR=VALUE strings.
+// A ${NAME} reference in a value is replaced with the value of NAME
+// from an earlier line of the file,
+// or else from env,
+// or else with the empty string.
+func parseEnvFile(r io.Reader, env []string) ([]string, error) {
+	values := make(map[string]string)
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		values[envKey(name)] = value
+	}
+	interpolate := func(s string) string {
+		return varRefRegex.ReplaceAllStringFunc(s, func(ref string) string {
+			if strings.HasPrefix(ref, "$$") {
+				return ref[1:]
+			}
+			return values[envKey(ref[2:len(ref)-1])]
+		})
+	}
+
+	var (
+		result []string
+		sc     = bufio.NewScanner(r)
+		lineno int
+	)
+	for sc.Scan() {
+		lineno++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: no = sign", lineno)
+		}
+		name = strings.TrimSpace(name)
+		if !envNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", lineno, name)
+		}
+		value = strings.TrimSpace(value)
+
+		switch {
+		case strings.HasPrefix(value, "'"):
+			end := strings.Index(value[1:], "'")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated single quote", lineno)
+			}
+			if !isEnvFileComment(value[end+2:]) {
+				return nil, fmt.Errorf("line %d: unexpected text after closing single quote", lineno)
+			}
+			value = value[1 : end+1]
+
+		case strings.HasPrefix(value, `"`):
+			// Only the text between \$ escapes is interpolated,
+			// so that \${NAME} is a literal ${NAME}.
+			var (
+				out, buf strings.Builder
+				end      = -1
+			)
+			for i := 1; i < len(value) && end < 0; i++ {
+				switch ch := value[i]; ch {
+				case '"':
+					end = i
+				case '\\':
+					if i+1 < len(value) {
+						i++
+						switch value[i] {
+						case 'n':
+							buf.WriteByte('\n')
+						case 't':
+							buf.WriteByte('\t')
+						case '$':
+							out.WriteString(interpolate(buf.String()))
+							out.WriteByte('$')
+							buf.Reset()
+						default:
+							buf.WriteByte(value[i])
+						}
+					}
+				default:
+					buf.WriteByte(ch)
+				}
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated double quote", lineno)
+			}
+			if !isEnvFileComment(value[end+1:]) {
+				return nil, fmt.Errorf("line %d: unexpected text after closing double quote", lineno)
+			}
+			out.WriteString(interpolate(buf.String()))
+			value = out.String()
+
+		default:
+			// A # preceded by whitespace begins a comment.
+			for i := 1; i < len(value); i++ {
+				if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+					value = strings.TrimSpace(value[:i])
+					break
+				}
+			}
+			value = interpolate(value)
+		}
+
+		values[envKey(name)] = value
+		result = append(result, name+"="+value)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading env file")
+	}
+	return result, nil
+}
+
+// isEnvFileComment tells whether s,
+// the text following a quoted value in an env file,
+// is empty or a comment.
+func isEnvFileComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || strings.HasPrefix(s, "#")
+}
+
+// hashedIn returns the input files of ft for hashing
+// (and for linking into a hermetic sandbox):
+// ft.In,
+// plus the env files of the commands in its subtarget
+// (see Command.EnvFile),
+// so that changing one causes ft to run again.
+func (ft *files) hashedIn(con *Controller) []string {
+	var (
+		result = ft.In
+		seen   = set.New(ft.In...)
+	)
+	for _, c := range con.commands(ft.Target) {
+		if c.EnvFile != "" && !seen.Has(c.EnvFile) {
+			seen.Add(c.EnvFile)
+			result = append(slices.Clip(result), c.EnvFile)
+		}
+	}
+	return result
+}
@@ -0,0 +1,162 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	const input = `
+# A comment.
+A=1
+export B = two words  # trailing comment
+C='single ${A} # quoted'
+D="double ${A}\t${B}\n\"q\" \$ $${A}"
+E=${A}-${HOME_DIR}-${UNDEFINED}
+F=a#b
+G="\${A} ${A}\$${A}" # comment
+H='x' # comment
+`
+	got, err := parseEnvFile(strings.NewReader(input), []string{"HOME_DIR=/home/x", "A=0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"A=1",
+		"B=two words",
+		"C=single ${A} # quoted",
+		"D=double 1\ttwo words\n\"q\" $ ${A}",
+		"E=1-/home/x-",
+		"F=a#b",
+		"G=${A} 1$1",
+		"H=x",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	bad := []string{
+		"NOEQUALS",
+		"1A=x",
+		"A='unterminated",
+		`A="unterminated`,
+		"A='abc'def",
+		`A="abc"def`,
+	}
+	for _, b := range bad {
+		if _, err := parseEnvFile(strings.NewReader(b), nil); err == nil {
+			t.Errorf("%q: got no error", b)
+		}
+	}
+}
+
+func TestEnvFile(t *testing.T) {
+	tmpdir := t.TempDir()
+
+	var (
+		envfile = filepath.Join(tmpdir, "test.env")
+		outfile = filepath.Join(tmpdir, "out")
+	)
+	if err := os.WriteFile(envfile, []byte("FAB_TEST_ENVFILE_A=a\nFAB_TEST_ENVFILE_B=b-${FAB_TEST_ENVFILE_A}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &Command{
+		Shell:      `echo "$FAB_TEST_ENVFILE_A $FAB_TEST_ENVFILE_B"`,
+		EnvFile:    envfile,
+		Env:        []string{"FAB_TEST_ENVFILE_A=override"},
+		StdoutFile: outfile,
+	}
+	target := Files(cmd, nil, []string{outfile})
+
+	var (
+		db  = memdb(set.New[string]())
+		ctx = WithHashDB(context.Background(), db)
+	)
+
+	run := func(wantOut string, wantStatus Status) {
+		t.Helper()
+
+		con := NewController("")
+		if err := con.Run(ctx, target); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range con.Results() {
+			if r.Target == target && r.Status != wantStatus {
+				t.Errorf("got status %s, want %s", r.Status, wantStatus)
+			}
+		}
+		got, err := os.ReadFile(outfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, []byte(wantOut)) {
+			t.Errorf("got output %q, want %q", got, wantOut)
+		}
+	}
+
+	// Env overrides the env file,
+	// but the env file's own references see its own value.
+	run("override b-a\n", StatusRan)
+	run("override b-a\n", StatusCached)
+
+	// Changing the env file causes the Files target to run again.
+	if err := os.WriteFile(envfile, []byte("FAB_TEST_ENVFILE_B=c\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run("override c\n", StatusRan)
+}
+
+func TestEnvFileDryRun(t *testing.T) {
+	tmpdir := t.TempDir()
+
+	// The env file is the output of a target
+	// that a dry run does not run.
+	cmd := &Command{
+		Shell:   "true",
+		EnvFile: filepath.Join(tmpdir, "missing.env"),
+	}
+	target := Files(cmd, nil, []string{filepath.Join(tmpdir, "out")})
+
+	var (
+		db  = memdb(set.New[string]())
+		ctx = WithHashDB(context.Background(), db)
+	)
+
+	con := NewController("")
+	if err := con.Run(WithDryRun(ctx, true), target); err != nil {
+		t.Errorf("dry run: %s", err)
+	}
+
+	con = NewController("")
+	if err := con.Run(context.Background(), cmd); err == nil {
+		t.Error("got no error for a missing env file")
+	}
+}
+
+func TestEnvFileYAML(t *testing.T) {
+	con := NewController("")
+	const yml = `
+X: !Command
+  Shell: true
+  EnvFile: vars.env
+`
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+	target, _ := con.RegistryTarget("X")
+	cmd, ok := target.(*Command)
+	if !ok {
+		t.Fatalf("got %T, want *Command", target)
+	}
+	if want := "vars.env"; cmd.EnvFile != want {
+		t.Errorf("got EnvFile %q, want %q", cmd.EnvFile, want)
+	}
+}
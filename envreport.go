@@ -0,0 +1,258 @@
+package fab
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/maps"
+	"github.com/bobg/go-generics/v2/set"
+)
+
+// EnvArg is the command-line argument
+// that makes fab describe the environment of some targets instead of running them,
+// as in:
+//
+//	fab env TARGET ...
+//
+// See [Controller.WriteEnv].
+const EnvArg = "env"
+
+// WriteEnv writes to w a description of everything that can affect
+// how the given targets and their subtargets would run:
+// the working directory;
+// the variables available for interpolation in YAML files
+// (see [Controller.Var]);
+// the environment given to commands;
+// for each [Command],
+// the resolved program and arguments, its directory, and its additions to the environment;
+// and for each [Files] target,
+// the inputs to its hash and whether that hash is in the hash DB.
+//
+// It is a "why is this behaving differently on my machine" debugging aid.
+// Nothing is run.
+func (con *Controller) WriteEnv(ctx context.Context, w io.Writer, targets ...Target) error {
+	ew := &errWriter{w: w}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return errors.Wrap(err, "getting working directory")
+	}
+	ew.printf("Top directory: %s\n", con.topdir)
+	ew.printf("Working directory: %s\n", wd)
+
+	ew.printf("\nVariables:\n")
+	for _, line := range con.varLines() {
+		ew.printf("  %s\n", line)
+	}
+
+	ew.printf("\nEnvironment:\n")
+	for _, kv := range mergeEnv(append(con.baseEnv(false, nil), GetEnv(ctx)...)) {
+		ew.printf("  %s\n", kv)
+	}
+
+	err = con.walk(targets, func(target Target) error {
+		switch t := target.(type) {
+		case *Command:
+			con.writeCommandEnv(ew, t)
+		case *files:
+			return con.writeFilesEnv(ctx, ew, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return ew.err
+}
+
+func (con *Controller) writeCommandEnv(ew *errWriter, c *Command) {
+	ew.printf("\n%s:\n", con.Describe(c))
+
+	cmdname, args := c.argv(con, c.Shell)
+	ew.printf("  Command line: %s\n", quoteArgs(append([]string{cmdname}, args...)))
+	if path, err := exec.LookPath(cmdname); err != nil {
+		ew.printf("  Program: %s\n", err)
+	} else {
+		ew.printf("  Program: %s\n", path)
+	}
+
+	dir := c.Dir
+	if dir == "" {
+		dir = "(working directory)"
+	}
+	ew.printf("  Directory: %s\n", dir)
+
+	if c.CleanEnv {
+		ew.printf("  Clean environment\n")
+		if len(c.EnvAllow) > 0 {
+			ew.printf("  Also allowed: %s\n", strings.Join(c.EnvAllow, ", "))
+		}
+	}
+	if len(c.Env) > 0 {
+		ew.printf("  Environment additions:\n")
+		for _, kv := range c.Env {
+			ew.printf("    %s\n", kv)
+		}
+	}
+	if c.Timeout > 0 {
+		ew.printf("  Timeout: %s\n", c.Timeout)
+	}
+	if c.Retries > 0 {
+		ew.printf("  Retries: %d\n", c.Retries)
+	}
+}
+
+func (con *Controller) writeFilesEnv(ctx context.Context, ew *errWriter, ft *files) error {
+	ew.printf("\n%s:\n", con.Describe(ft))
+
+	hi, err := ft.hashInputs(ctx, con)
+	if err != nil {
+		return err
+	}
+	j, err := json.Marshal(hi.Target)
+	if err != nil {
+		return errors.Wrap(err, "in JSON marshaling")
+	}
+	ew.printf("  Subtarget type: %s\n", hi.TargetType)
+	ew.printf("  Subtarget: %s\n", j)
+
+	writeHashes := func(label string, hashes []string) {
+		if len(hashes) == 0 {
+			return
+		}
+		ew.printf("  %s:\n", label)
+		for i := 0; i+1 < len(hashes); i += 2 {
+			h := hashes[i+1]
+			if h == "" {
+				h = "(missing)"
+			}
+			ew.printf("    %s %s\n", h, hashes[i])
+		}
+	}
+	writeHashes("Inputs", hi.In)
+	writeHashes("Outputs", hi.Out)
+	writeHashes("Tools", hi.Tools)
+	if len(hi.Env) > 0 {
+		ew.printf("  Hashed environment:\n")
+		for _, kv := range hi.Env {
+			if !strings.Contains(kv, "=") {
+				kv += " (unset)"
+			}
+			ew.printf("    %s\n", kv)
+		}
+	}
+
+	h, err := hi.sum()
+	if err != nil {
+		return err
+	}
+	status := "no hash DB"
+	if db := GetHashDB(ctx); db != nil {
+		has, err := db.Has(ctx, h)
+		if err != nil {
+			return errors.Wrap(err, "checking hash db")
+		}
+		if has {
+			status = "up to date"
+		} else {
+			status = "not in hash DB, would run"
+		}
+	}
+	ew.printf("  Hash: %s (%s)\n", hex.EncodeToString(h), status)
+
+	return nil
+}
+
+// varLines describes the variables known to con,
+// one per line,
+// sorted by name.
+func (con *Controller) varLines() []string {
+	type decl struct{ name, dir string }
+
+	con.mu.Lock()
+	var decls []decl
+	for dir, vars := range con.vars {
+		for name := range vars {
+			decls = append(decls, decl{name: name, dir: dir})
+		}
+	}
+	overrides := set.New(maps.Keys(con.varOverrides)...)
+	con.mu.Unlock()
+
+	var result []string
+	for name := range overrides {
+		value, _ := con.Var(name, "")
+		result = append(result, fmt.Sprintf("%s=%s (set on the command line)", name, value))
+	}
+	for _, d := range decls {
+		value, _ := con.Var(d.name, d.dir)
+		dir := d.dir
+		if dir == "" {
+			dir = "."
+		}
+		source := "_vars in " + dir
+		if overrides.Has(d.name) {
+			source += ", overridden on the command line"
+		} else if _, ok := os.LookupEnv(d.name); ok {
+			source += ", overridden by the environment"
+		}
+		result = append(result, fmt.Sprintf("%s=%s (%s)", d.name, value, source))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// mergeEnv returns env sorted by variable name,
+// keeping only the last setting of each variable,
+// which is the one a subprocess sees.
+func mergeEnv(env []string) []string {
+	m := make(map[string]string)
+	for _, kv := range env {
+		k, _, _ := strings.Cut(kv, "=")
+		m[k] = kv
+	}
+	keys := maps.Keys(m)
+	sort.Strings(keys)
+
+	result := make([]string, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, m[k])
+	}
+	return result
+}
+
+func quoteArgs(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$`*?[]{}()<>|&;#~") {
+			arg = strconv.Quote(arg)
+		}
+		quoted = append(quoted, arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// errWriter wraps an io.Writer,
+// remembering the first error from writing to it,
+// after which writing is a no-op.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...any) {
+	if ew.err != nil {
+		return
+	}
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
@@ -0,0 +1,81 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestWriteEnv(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	if err := os.WriteFile(filepath.Join(tmpdir, "in.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("FAB_TEST_ENVREPORT", "from-env")
+
+	const yml = `
+_vars:
+  OUT: out.txt
+  MODE: fast
+
+Build: !Files
+  Target: !Command
+    Shell: cp in.txt ${OUT}
+    Env: [GREETING=hi]
+  In: [in.txt]
+  Out: ["${OUT}"]
+`
+
+	con := NewController(tmpdir)
+	con.SetVar("MODE", "slow")
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+	build, _ := con.RegistryTarget("Build")
+
+	ctx := context.Background()
+	ctx = WithEnv(ctx, []string{"FAB_TEST_ENVREPORT=from-ctx"})
+	ctx = WithHashDB(ctx, memdb(set.New[string]()))
+
+	var buf strings.Builder
+	if err := con.WriteEnv(ctx, &buf, build); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	for _, want := range []string{
+		"Top directory: " + tmpdir + "\n",
+		"  MODE=slow (set on the command line)\n",
+		"  MODE=slow (_vars in ., overridden on the command line)\n",
+		"  OUT=out.txt (_vars in .)\n",
+		"  FAB_TEST_ENVREPORT=from-ctx\n",
+		"Build:\n",
+		"  Subtarget type: *fab.Command\n",
+		"in.txt\n",
+		"    (missing) " + filepath.Join(tmpdir, "out.txt") + "\n",
+		"(not in hash DB, would run)\n",
+		`-c "cp in.txt out.txt"` + "\n",
+		"  Environment additions:\n    GREETING=hi\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q; output is:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "FAB_TEST_ENVREPORT=from-env") {
+		t.Error("output contains overridden environment variable")
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpdir, "out.txt")); !os.IsNotExist(err) {
+		t.Errorf("WriteEnv ran the target (err is %v)", err)
+	}
+}
@@ -0,0 +1,68 @@
+package fab
+
+import (
+	"path/filepath"
+
+	"github.com/bobg/errors"
+)
+
+// Exclude is an option for passing to [Files].
+// It leaves out of the Files target's hash
+// the files and directories inside its input directories
+// whose paths,
+// relative to the input directory containing them,
+// match any of the given patterns.
+// This keeps editor temp files, build junk, and the like
+// from making the target look out of date.
+//
+// The patterns are as for [path.Match],
+// with slash separators,
+// except that a path element of ** matches zero or more path elements.
+// So **/*.swp excludes .swp files at any depth,
+// and node_modules/** excludes the node_modules directory and everything in it.
+//
+// Files listed explicitly in the input list are never excluded.
+//
+// Exclude affects only the hash.
+// Options such as [ReadOnlyIn] and [Hermetic]
+// still apply to all the files in the input directories.
+//
+// In YAML,
+// the patterns are given in the Exclude field of a Files mapping:
+//
+//	Build: !Files
+//	  Target: !Command
+//	    Shell: npm run build
+//	  In: [src, package.json]
+//	  Exclude: ["**/*.swp", "node_modules/**"]
+//	  Out: [dist]
+func Exclude(patterns ...string) FilesOpt {
+	return func(f *files) {
+		f.exclude = append(f.exclude, patterns...)
+	}
+}
+
+// excluded tells whether the file or directory at name,
+// inside the input directory root,
+// matches one of the patterns in exclude
+// (see [Exclude]).
+func excluded(exclude []string, root, name string) (bool, error) {
+	if len(exclude) == 0 || name == root {
+		return false, nil
+	}
+	rel, err := filepath.Rel(root, name)
+	if err != nil {
+		return false, errors.Wrapf(err, "getting path of %s relative to %s", name, root)
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range exclude {
+		ok, err := matchGlob(pattern, rel)
+		if err != nil {
+			return false, errors.Wrapf(err, "in exclude pattern %s", pattern)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
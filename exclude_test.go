@@ -0,0 +1,103 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestExclude(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	src := filepath.Join(tmpdir, "src")
+	write := func(name, content string) {
+		t.Helper()
+		name = filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("main.go", "package main\n")
+	write("node_modules/x/index.js", "x\n")
+
+	var (
+		ctx = WithHashDB(context.Background(), memdb(set.New[string]()))
+		ct  = &countTarget{}
+		ft  = Files(ct, []string{src}, nil, Exclude("**/*.swp", "node_modules/**"))
+	)
+
+	run := func(wantCount uint32) {
+		t.Helper()
+		con := NewController(tmpdir)
+		if err := con.Run(ctx, ft); err != nil {
+			t.Fatal(err)
+		}
+		if ct.count != wantCount {
+			t.Errorf("got count %d, want %d", ct.count, wantCount)
+		}
+	}
+
+	run(1)
+
+	write("main.go.swp", "junk\n")
+	write("sub/.main.go.swp", "junk\n")
+	write("node_modules/y/index.js", "y\n")
+	run(1)
+
+	write("main.go", "package main\n\nfunc main() {}\n")
+	run(2)
+
+	hashes, err := fileHashes(ctx, []string{src, filepath.Join(src, "main.go.swp")}, "**/*.swp", "node_modules/**")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for i := 0; i < len(hashes); i += 2 {
+		rel, err := filepath.Rel(src, hashes[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, filepath.ToSlash(rel))
+	}
+	if got, want := strings.Join(names, " "), "main.go main.go.swp"; got != want {
+		t.Errorf("got hashed files %s, want %s (explicitly listed files are not excluded)", got, want)
+	}
+}
+
+func TestExcludeYAML(t *testing.T) {
+	t.Parallel()
+
+	const yml = `
+Build: !Files
+  Target: !Command
+    Shell: echo build
+  In: [src]
+  Exclude: ["**/*.swp", node_modules/**]
+`
+
+	con := NewController("")
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+	target, _ := con.RegistryTarget("Build")
+	ft, ok := target.(*files)
+	if !ok {
+		t.Fatalf("got %T, want *files", target)
+	}
+	if got, want := strings.Join(ft.exclude, " "), "**/*.swp node_modules/**"; got != want {
+		t.Errorf("got exclude %s, want %s", got, want)
+	}
+}
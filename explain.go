@@ -0,0 +1,236 @@
+package fab
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bobg/errors"
+)
+
+// Description is the resolved structure of a target,
+// as produced by [Controller.Explain].
+type Description struct {
+	// Name is the target's name in the registry,
+	// or empty if it is unnamed.
+	Name string `json:"name,omitempty"`
+
+	// Type is the result of the target's Desc method,
+	// e.g. "Files" or "Command".
+	Type string `json:"type"`
+
+	// Doc is the target's docstring in the registry, if any.
+	Doc string `json:"doc,omitempty"`
+
+	// Command is the command line of a [Command] target,
+	// and Dir is the directory it runs in.
+	Command string `json:"command,omitempty"`
+	Dir     string `json:"dir,omitempty"`
+
+	// In and Out are the target's input and output files,
+	// relative to the top directory where possible,
+	// for a [Files] target
+	// or one implementing [InputsProvider] or [OutputsProvider].
+	In  []string `json:"in,omitempty"`
+	Out []string `json:"out,omitempty"`
+
+	// Producers maps each input file that is produced by another target
+	// to the name of that target
+	// (see [Controller.Describe]).
+	Producers map[string]string `json:"producers,omitempty"`
+
+	// Subtargets describes the targets that this one runs,
+	// not including the producers of its inputs.
+	Subtargets []Description `json:"subtargets,omitempty"`
+}
+
+// Explain produces the resolved structure of a target:
+// its type and docstring,
+// its input and output files and the targets that produce its inputs,
+// and, recursively, the same information for its subtargets.
+// Targets named in YAML by reference are resolved.
+// Nothing is run.
+//
+// The fab command's -describe flag prints the descriptions of the targets named on its command line,
+// in the format of [Description.Write]
+// or,
+// with -json,
+// as JSON.
+func (con *Controller) Explain(target Target) (Description, error) {
+	return con.explain(target, nil)
+}
+
+func (con *Controller) explain(target Target, path []uintptr) (Description, error) {
+	var result Description
+
+	if t, ok := target.(*deferredResolutionTarget); ok {
+		resolved, err := t.resolve(con)
+		if err != nil {
+			return result, err
+		}
+		target = resolved
+	}
+
+	addr, err := targetAddr(target)
+	if err != nil {
+		return result, err
+	}
+	for _, a := range path {
+		if a == addr {
+			return result, fmt.Errorf("cycle at %s", con.Describe(target))
+		}
+	}
+	path = append(path, addr)
+
+	result.Type = target.Desc()
+	con.mu.Lock()
+	if tuple, ok := con.targetsByAddr[addr]; ok {
+		result.Name, result.Doc = tuple.name, tuple.doc
+	}
+	con.mu.Unlock()
+
+	if c, ok := target.(*Command); ok {
+		result.Command, result.Dir = c.commandLine(), c.Dir
+	}
+
+	if p, ok := target.(InputsProvider); ok {
+		result.In = con.relPaths(p.Inputs())
+		for i, in := range p.Inputs() {
+			prereq, err := findPrereq(in)
+			if err != nil {
+				return result, errors.Wrapf(err, "finding producer of %s", in)
+			}
+			if prereq == nil {
+				continue
+			}
+			if result.Producers == nil {
+				result.Producers = make(map[string]string)
+			}
+			result.Producers[result.In[i]] = con.Describe(prereq)
+		}
+	}
+	if p, ok := target.(OutputsProvider); ok {
+		result.Out = con.relPaths(p.Outputs())
+	}
+
+	var subs []Target
+	if ft, ok := target.(*files); ok {
+		subs = []Target{ft.Target}
+	} else if subs, err = con.subtargets(target); err != nil {
+		return result, errors.Wrapf(err, "getting subtargets of %s", con.Describe(target))
+	}
+	for _, sub := range subs {
+		if sub == nil {
+			continue
+		}
+		d, err := con.explain(sub, path)
+		if err != nil {
+			return result, err
+		}
+		result.Subtargets = append(result.Subtargets, d)
+	}
+
+	return result, nil
+}
+
+// relPaths returns the given paths relative to con's top directory,
+// where that is possible.
+func (con *Controller) relPaths(paths []string) []string {
+	result := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if rel, err := con.RelPath(p); err == nil && !strings.HasPrefix(rel, "..") {
+			p = rel
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// commandLine returns the command that c runs,
+// as a single string.
+func (c *Command) commandLine() string {
+	if c.Cmd == "" {
+		return c.Shell
+	}
+	return strings.Join(append([]string{c.Cmd}, c.Args...), " ")
+}
+
+// Write writes d to w in human-readable form,
+// indenting its subtargets.
+func (d Description) Write(w io.Writer) error {
+	ew := &errWriter{w: w}
+	d.write(ew, "")
+	return ew.err
+}
+
+func (d Description) write(ew *errWriter, indent string) {
+	if d.Name != "" {
+		ew.printf("%s%s (%s)\n", indent, d.Name, d.Type)
+	} else {
+		ew.printf("%sunnamed %s\n", indent, d.Type)
+	}
+	if d.Doc != "" {
+		ew.printf("%s  %s\n", indent, strings.ReplaceAll(d.Doc, "\n", "\n"+indent+"  "))
+	}
+	if d.Command != "" {
+		ew.printf("%s  Command: %s\n", indent, d.Command)
+	}
+	if d.Dir != "" {
+		ew.printf("%s  Dir: %s\n", indent, d.Dir)
+	}
+	if len(d.In) > 0 {
+		ew.printf("%s  In:\n", indent)
+		for _, in := range d.In {
+			if producer, ok := d.Producers[in]; ok {
+				ew.printf("%s    %s (from %s)\n", indent, in, producer)
+			} else {
+				ew.printf("%s    %s\n", indent, in)
+			}
+		}
+	}
+	if len(d.Out) > 0 {
+		ew.printf("%s  Out:\n", indent)
+		for _, out := range d.Out {
+			ew.printf("%s    %s\n", indent, out)
+		}
+	}
+	for _, sub := range d.Subtargets {
+		sub.write(ew, indent+"  ")
+	}
+}
+
+// WriteDescriptions writes the descriptions of the given targets to w
+// (see [Controller.Explain]),
+// in the format of [Description.Write]
+// or,
+// if asJSON is true,
+// as a JSON array.
+func (con *Controller) WriteDescriptions(w io.Writer, asJSON bool, targets ...Target) error {
+	descs := make([]Description, 0, len(targets))
+	for _, target := range targets {
+		d, err := con.Explain(target)
+		if err != nil {
+			return errors.Wrapf(err, "describing %s", con.Describe(target))
+		}
+		descs = append(descs, d)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(descs)
+	}
+
+	for i, d := range descs {
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := d.Write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package fab
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	t.Parallel()
+
+	const yml = `
+Gen: !Files
+  Target: !Command
+    Shell: echo gen > gen.out
+  In: [gen.in]
+  Out: [gen.out]
+
+# Build the program.
+Build: !Files
+  Target: !Seq
+    - !Command
+      Shell: cat gen.out > prog
+  In: [gen.out, main.c]
+  Out: [prog]
+`
+
+	con := NewController("/top")
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+	target, _ := con.RegistryTarget("Build")
+
+	got, err := con.Explain(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Description{
+		Name:      "Build",
+		Type:      "Files",
+		Doc:       "Build the program.",
+		In:        []string{"gen.out", "main.c"},
+		Out:       []string{"prog"},
+		Producers: map[string]string{"gen.out": "Gen"},
+		Subtargets: []Description{{
+			Type: "Seq",
+			Subtargets: []Description{{
+				Type:    "Command",
+				Command: "cat gen.out > prog",
+				Dir:     "/top",
+			}},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%+v\nwant:\n%+v", got, want)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := got.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	const wantText = `Build (Files)
+  Build the program.
+  In:
+    gen.out (from Gen)
+    main.c
+  Out:
+    prog
+  unnamed Seq
+    unnamed Command
+      Command: cat gen.out > prog
+      Dir: /top
+`
+	if buf.String() != wantText {
+		t.Errorf("got text:\n%s\nwant:\n%s", buf, wantText)
+	}
+
+	buf.Reset()
+	if err := con.WriteDescriptions(buf, true, target); err != nil {
+		t.Fatal(err)
+	}
+	var descs []Description
+	if err := json.Unmarshal(buf.Bytes(), &descs); err != nil {
+		t.Fatal(err)
+	}
+	if len(descs) != 1 || !reflect.DeepEqual(descs[0], want) {
+		t.Errorf("got JSON %s", buf)
+	}
+}
@@ -5,6 +5,7 @@ import "context"
 // F produces a target whose Run function invokes the given function.
 // It is not JSON-encodable,
 // so it should not be used as the subtarget in a [Files] rule.
+// (A target type that also implements [Hasher] can be.)
 //
 // The behavior of F does not change according to [GetDryRun].
 // It's up to the function you pass to F to detect dry-run mode
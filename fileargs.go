@@ -0,0 +1,87 @@
+package fab
+
+import (
+	"bufio"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/bobg/errors"
+)
+
+// ParseFileArgs parses the arguments of a target
+// (see [ArgTarget] and [GetArgs])
+// that can be restricted to a list of files,
+// as by a [PreCommit] target.
+// This is the convention for such targets:
+// after any flags,
+// the remaining arguments are the names of the files to operate on.
+// The files may also be given with one or more -files flags.
+// An argument
+// (or -files value)
+// of the form @FILE names a file containing a list of file names,
+// one per line.
+// Blank lines in that file are ignored.
+//
+// Callers define any flags of their own in fs before calling ParseFileArgs.
+// ParseFileArgs adds the -files flag and parses args.
+//
+// The result is nil if no files are given,
+// meaning the target should operate on all its files.
+//
+// Example:
+//
+//	fab Format -check -files @changed.txt
+//	fab Lint -- foo.go bar/baz.go
+func ParseFileArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var files fileListFlag
+	fs.Var(&files, "files", "a file to operate on, or @FILE for a file containing a list of them (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return nil, errors.Wrap(err, "parsing args")
+	}
+
+	var result []string
+	for _, arg := range append(files, fs.Args()...) {
+		if !strings.HasPrefix(arg, "@") {
+			result = append(result, arg)
+			continue
+		}
+		listed, err := readFileList(arg[1:])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, listed...)
+	}
+	return result, nil
+}
+
+// readFileList reads the file names in filename,
+// one per line.
+func readFileList(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening file list %s", filename)
+	}
+	defer f.Close()
+
+	var result []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			result = append(result, line)
+		}
+	}
+	return result, errors.Wrapf(sc.Err(), "reading file list %s", filename)
+}
+
+// fileListFlag is a [flag.Value] accumulating the values of a repeated flag.
+type fileListFlag []string
+
+func (f *fileListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileListFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
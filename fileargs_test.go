@@ -0,0 +1,79 @@
+package fab
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseFileArgs(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	list := filepath.Join(tmpdir, "list.txt")
+	if err := os.WriteFile(list, []byte("a.go\n\n  b/c.go\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		args    []string
+		want    []string
+		wantFix bool
+		wantErr bool
+	}{{
+		args: nil,
+	}, {
+		args:    []string{"-fix"},
+		wantFix: true,
+	}, {
+		args: []string{"x.go", "y.go"},
+		want: []string{"x.go", "y.go"},
+	}, {
+		args:    []string{"-fix", "--", "x.go"},
+		want:    []string{"x.go"},
+		wantFix: true,
+	}, {
+		args: []string{"@" + list},
+		want: []string{"a.go", "b/c.go"},
+	}, {
+		args: []string{"--files", "@" + list, "-files", "d.go", "x.go"},
+		want: []string{"a.go", "b/c.go", "d.go", "x.go"},
+	}, {
+		args:    []string{"@" + filepath.Join(tmpdir, "nonexistent")},
+		wantErr: true,
+	}, {
+		args:    []string{"-bogus"},
+		wantErr: true,
+	}}
+
+	for i, c := range cases {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fix := fs.Bool("fix", false, "fix mode")
+		got, err := ParseFileArgs(fs, c.args)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("case %d: got no error, want one", i+1)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: %s", i+1, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("case %d: got %v, want %v", i+1, got, c.want)
+		}
+		if *fix != c.wantFix {
+			t.Errorf("case %d: got fix %v, want %v", i+1, *fix, c.wantFix)
+		}
+	}
+}
@@ -4,12 +4,16 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"sort"
+	"strings"
+	"sync"
 
 	"github.com/bobg/errors"
 	"github.com/bobg/go-generics/v2/maps"
@@ -46,6 +50,12 @@ var filesRegistry = newRegistry[*files]()
 //     that this collection of input and output files
 //     can be considered up-to-date.
 //
+// If an [ArtifactStore] is available (see [GetArtifactStore]),
+// the output files are also saved there after the subtarget runs.
+// When the hash is not found in the hash database,
+// but outputs from an earlier run with the same inputs are in the artifact store,
+// they are restored from there instead of running the subtarget.
+//
 // The nested subtarget must be of a type that can be JSON-marshaled.
 // Notably this excludes [F].
 //
@@ -61,6 +71,10 @@ var filesRegistry = newRegistry[*files]()
 // (instead of, or in addition to, any explicitly listed files)
 // by setting _its_ Autoclean field to true.
 //
+// Before the subtarget runs,
+// any missing parent directories of the output files are created,
+// unless MkdirOut(false) is one of the options.
+//
 // The list of input and output files may include directories too.
 // These are walked recursively for computing the hash described above.
 // Be careful when using directories in the output-file list
@@ -77,6 +91,14 @@ var filesRegistry = newRegistry[*files]()
 //   - In: the list of input files, interpreted with [YAMLFilesList]
 //   - Out: the list of output files, interpreted with [YAMLFilesList]
 //   - Autoclean: a boolean
+//   - MkdirOut: a boolean, true by default
+//   - ReadOnlyIn: a boolean
+//   - StrictOutputs: a boolean
+//   - Hermetic: a boolean
+//   - Exclude: a sequence of patterns, see [Exclude]
+//
+// The In list may include a !Volatile entry;
+// see [Volatile].
 //
 // Example:
 //
@@ -92,6 +114,11 @@ var filesRegistry = newRegistry[*files]()
 // which runs the given `go build` command
 // to update the output file `thingify`
 // when any files depended on by the Go package in `cmd` change.
+//
+// The entries in a YAML Out list may be [text/template] templates
+// referring to the name of the target and to YAML variables,
+// as in `dist/{{.TargetName}}/{{.GOOS}}/app`.
+// This is true of the Out field of other target types too.
 func Files(target Target, in, out []string, opts ...FilesOpt) Target {
 	result := &files{
 		Target: target,
@@ -114,6 +141,15 @@ type files struct {
 	Target Target
 	In     []string
 	Out    []string
+
+	desc       string   // if non-empty, overrides "Files" as the result of Desc
+	noMkdir    bool     // see MkdirOut
+	readOnlyIn bool     // see ReadOnlyIn
+	strictOut  bool     // see StrictOutputs
+	hermetic   bool     // see Hermetic
+	volatile   string   // see Volatile
+	exclude    []string // see Exclude
+	hashEnv    []string // see HashEnv
 }
 
 var _ Target = &files{}
@@ -121,13 +157,39 @@ var _ Target = &files{}
 // Run implements Target.Run.
 func (ft *files) Run(ctx context.Context, con *Controller) error {
 	if err := ft.runPrereqs(ctx, con); err != nil {
+		con.setSkipped(ft)
 		return errors.Wrap(err, "in prerequisites")
 	}
 
 	db := GetHashDB(ctx)
+	if ft.volatile != "" {
+		if GetVerbose(ctx) {
+			con.Indentf("%s is volatile: %s", con.Describe(ft), ft.volatile)
+		}
+		db = nil
+	}
+	restricted, err := ft.restricted(ctx)
+	if err != nil {
+		return err
+	}
+	if restricted {
+		if GetVerbose(ctx) {
+			con.Indentf("%s is restricted to some of its files", con.Describe(ft))
+		}
+		db = nil
+	}
 
-	if db != nil && !GetForce(ctx) && !GetDryRun(ctx) {
-		h, err := ft.computeHash(con)
+	if GetDryRun(ctx) {
+		upToDate, err := ft.reportPlan(ctx, con, db)
+		if err != nil {
+			return err
+		}
+		if upToDate {
+			con.setCached(ft)
+			return nil
+		}
+	} else if db != nil && !GetForce(ctx) {
+		h, err := ft.computeHash(ctx, con)
 		if err != nil {
 			return errors.Wrap(err, "computing hash before running subtarget")
 		}
@@ -136,56 +198,230 @@ func (ft *files) Run(ctx context.Context, con *Controller) error {
 			return errors.Wrap(err, "checking hash db")
 		}
 		if has {
-			if GetVerbose(ctx) {
-				con.Indentf("%s is up to date", con.Describe(ft))
-			}
+			con.setCached(ft)
 			return nil
 		}
 	}
 
-	if err := con.Run(ctx, ft.Target); err != nil {
+	var (
+		store = GetArtifactStore(ctx)
+		akey  []byte
+	)
+	if store != nil && len(ft.Out) > 0 && ft.volatile == "" && !restricted && !GetDryRun(ctx) {
+		var err error
+		akey, err = ft.artifactKey(ctx, con)
+		if err != nil {
+			return errors.Wrap(err, "computing artifact key")
+		}
+		if !GetForce(ctx) {
+			restored, err := ft.restoreArtifacts(ctx, store, akey)
+			if err != nil {
+				return errors.Wrap(err, "restoring outputs from artifact store")
+			}
+			if restored {
+				if GetVerbose(ctx) {
+					con.Indentf("Restored outputs of %s from artifact store", con.Describe(ft))
+				}
+				con.setCached(ft)
+				return ft.addHash(ctx, con, db)
+			}
+		}
+	}
+
+	var before inputSnapshot
+	if GetInputGuard(ctx) && !GetDryRun(ctx) {
+		var err error
+		if before, err = snapshotInputs(ft.In); err != nil {
+			return errors.Wrap(err, "noting input files")
+		}
+	}
+
+	if !ft.noMkdir && !GetDryRun(ctx) {
+		for _, file := range ft.Out {
+			if err := mkdirParent(file); err != nil {
+				return err
+			}
+		}
+	}
+
+	var checkReadOnly func() error
+	if ft.readOnlyIn && !GetDryRun(ctx) {
+		var err error
+		if checkReadOnly, err = ft.protectInputs(); err != nil {
+			return errors.Wrap(err, "making input files read-only")
+		}
+	}
+
+	subctx := withInputHash(ctx, func() ([]byte, error) {
+		if akey != nil {
+			return akey, nil
+		}
+		return ft.artifactKey(ctx, con)
+	})
+
+	var tracer *fileTracer
+	if GetFileTrace(ctx) && !GetDryRun(ctx) {
+		var err error
+		if tracer, err = newFileTracer(); err != nil {
+			return err
+		}
+		defer tracer.close()
+		subctx = withFileTracer(subctx, tracer)
+	}
+
+	if ft.hermetic && !GetDryRun(ctx) {
+		err = ft.runHermetic(subctx, con)
+	} else {
+		err = con.Run(subctx, ft.Target)
+	}
+	if checkReadOnly != nil {
+		err = errors.Join(err, checkReadOnly())
+	}
+	if err != nil {
 		return errors.Wrap(err, "running subtarget")
 	}
 
-	if db == nil || GetDryRun(ctx) {
+	if tracer != nil {
+		if err := ft.checkTrace(con, tracer); err != nil {
+			return err
+		}
+	}
+
+	if ft.strictOut && !GetDryRun(ctx) {
+		if err := checkOutputs(ft.Out); err != nil {
+			return err
+		}
+	}
+
+	if before != nil {
+		ok, err := ft.checkInputs(con, before)
+		if err != nil || !ok {
+			return err
+		}
+	}
+
+	if akey != nil {
+		if err := ft.saveArtifacts(ctx, con, store, akey); err != nil {
+			return errors.Wrap(err, "saving outputs to artifact store")
+		}
+	}
+
+	if GetDryRun(ctx) {
+		return nil
+	}
+	if err := ft.recordOutputs(ctx, con); err != nil {
+		return errors.Wrap(err, "recording outputs")
+	}
+	return ft.addHash(ctx, con, db)
+}
+
+// restricted tells whether the subtarget of ft
+// is restricted to some of its files by the args in ctx
+// (see [FileRestricter]).
+func (ft *files) restricted(ctx context.Context) (bool, error) {
+	r, ok := ft.Target.(FileRestricter)
+	if !ok {
+		return false, nil
+	}
+	only, err := r.Restriction(ctx)
+	if err != nil {
+		return false, errors.Wrapf(err, "parsing args of %s", ft.Target.Desc())
+	}
+	return len(only) > 0, nil
+}
+
+// addHash computes the hash of ft and adds it to db,
+// if db is non-nil,
+// along with the breakdown of the hash
+// if db is a [HashRecorder].
+func (ft *files) addHash(ctx context.Context, con *Controller, db HashDB) error {
+	if db == nil {
 		return nil
 	}
 
-	h, err := ft.computeHash(con)
+	hi, err := ft.hashInputs(ctx, con)
+	if err != nil {
+		return errors.Wrap(err, "computing hash after running subtarget")
+	}
+	h, err := hi.sum()
 	if err != nil {
 		return errors.Wrap(err, "computing hash after running subtarget")
 	}
-	err = db.Add(ctx, h)
-	return errors.Wrap(err, "adding hash to db")
+	if err := db.Add(ctx, h); err != nil {
+		return errors.Wrap(err, "adding hash to db")
+	}
+	return ft.saveHashRecord(ctx, con, db, hi)
+}
+
+// Inputs implements InputsProvider.
+func (ft *files) Inputs() []string {
+	return ft.In
+}
+
+// Outputs implements OutputsProvider.
+func (ft *files) Outputs() []string {
+	return ft.Out
 }
 
 // Desc implements Target.Desc.
-func (*files) Desc() string {
+func (ft *files) Desc() string {
+	if ft.desc != "" {
+		return ft.desc
+	}
 	return "Files"
 }
 
-func (ft *files) computeHash(con *Controller) ([]byte, error) {
-	inHashes, err := fileHashes(ft.In)
+func (ft *files) computeHash(ctx context.Context, con *Controller) ([]byte, error) {
+	hi, err := ft.hashInputs(ctx, con)
+	if err != nil {
+		return nil, err
+	}
+	return hi.sum()
+}
+
+// filesHashInputs is everything that goes into the hash of a [Files] target.
+type filesHashInputs struct {
+	Target     any      `json:"target"` // see targetHashValue
+	TargetType string   `json:"target_type"`
+	In         []string `json:"in,omitempty"`    // [filename, hash, filename, hash, ...]
+	Out        []string `json:"out,omitempty"`   // [filename, hash, filename, hash, ...]
+	Env        []string `json:"env,omitempty"`   // see HashEnv
+	Tools      []string `json:"tools,omitempty"` // [path, hash, path, hash, ...]; see Command.HashTool
+}
+
+// hashInputs includes the values of the variables named with [HashEnv]
+// and the identities of tools named with Command.HashTool,
+// since they can change what the subtarget does.
+func (ft *files) hashInputs(ctx context.Context, con *Controller) (*filesHashInputs, error) {
+	inHashes, err := fileHashes(ctx, ft.hashedIn(con), ft.exclude...)
 	if err != nil {
 		return nil, errors.Wrapf(err, "computing input hash(es) for %s", con.Describe(ft))
 	}
-	outHashes, err := fileHashes(ft.Out)
+	outHashes, err := fileHashes(ctx, ft.Out)
 	if err != nil {
 		return nil, errors.Wrapf(err, "computing output hash(es) for %s", con.Describe(ft))
 	}
-	tt := reflect.TypeOf(ft.Target)
-	s := struct {
-		Target     Target   `json:"target"`
-		TargetType string   `json:"target_type"`
-		In         []string `json:"in,omitempty"`  // [filename, hash, filename, hash, ...]
-		Out        []string `json:"out,omitempty"` // [filename, hash, filename, hash, ...]
-	}{
-		Target:     ft.Target,
-		TargetType: tt.String(),
+	target, err := targetHashValue(ft.Target)
+	if err != nil {
+		return nil, errors.Wrapf(err, "hashing subtarget of %s", con.Describe(ft))
+	}
+	env := ft.envHashInputs(ctx, con)
+	tools, err := ft.toolHashInputs(ctx, con)
+	if err != nil {
+		return nil, errors.Wrapf(err, "hashing tools of %s", con.Describe(ft))
+	}
+	return &filesHashInputs{
+		Target:     target,
+		TargetType: reflect.TypeOf(ft.Target).String(),
 		In:         inHashes,
 		Out:        outHashes,
-	}
-	j, err := json.Marshal(s)
+		Env:        env,
+		Tools:      tools,
+	}, nil
+}
+
+func (hi *filesHashInputs) sum() ([]byte, error) {
+	j, err := json.Marshal(hi)
 	if err != nil {
 		return nil, errors.Wrap(err, "in JSON marshaling")
 	}
@@ -198,7 +434,11 @@ func (ft *files) runPrereqs(ctx context.Context, con *Controller) error {
 	var prereqs []Target
 
 	for _, in := range ft.In {
-		if target := findInFilesRegistry(in); target != nil {
+		target, err := findPrereq(in)
+		if err != nil {
+			return errors.Wrapf(err, "finding prerequisite for %s", in)
+		}
+		if target != nil {
 			prereqs = append(prereqs, target)
 		}
 	}
@@ -244,13 +484,94 @@ func Autoclean(autoclean bool) FilesOpt {
 	}
 }
 
+// MkdirOut is an option for passing to [Files].
+// It tells whether to create any missing parent directories of the output files
+// before running the subtarget.
+// The default is true.
+func MkdirOut(mkdir bool) FilesOpt {
+	return func(f *files) {
+		f.noMkdir = !mkdir
+	}
+}
+
+// StrictOutputs is an option for passing to [Files].
+// When it is true,
+// it is an error if any of the output files does not exist
+// after the subtarget runs.
+// The error is a [MissingOutputsError].
+// This catches a Files target whose output list does not match what its subtarget produces.
+func StrictOutputs(strict bool) FilesOpt {
+	return func(f *files) {
+		f.strictOut = strict
+	}
+}
+
+// MissingOutputsError is the error produced by a [Files] target with [StrictOutputs]
+// when its subtarget does not produce some of the declared output files.
+type MissingOutputsError struct {
+	Files []string
+}
+
+func (e MissingOutputsError) Error() string {
+	return fmt.Sprintf("missing output files: %s", strings.Join(e.Files, ", "))
+}
+
+// checkOutputs returns a [MissingOutputsError] if any of the given files does not exist.
+func checkOutputs(out []string) error {
+	var missing []string
+	for _, file := range out {
+		_, err := os.Stat(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			missing = append(missing, file)
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "statting output %s", file)
+		}
+	}
+	if len(missing) > 0 {
+		return MissingOutputsError{Files: missing}
+	}
+	return nil
+}
+
+// mkdirParent creates the parent directory of file,
+// and any of its missing parents,
+// if it does not already exist.
+func mkdirParent(file string) error {
+	if file == "" {
+		return nil
+	}
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "creating directory %s", dir)
+	}
+	return nil
+}
+
 // Returns [filename, hash, filename, hash, ...],
 // with filenames sorted.
 // Input is a list of file or directory names.
-func fileHashes(items []string) ([]string, error) {
-	hashes := make(map[string]string)
+// Files and directories inside the directories
+// matching any of the patterns in exclude are left out
+// (see [Exclude]).
+// Files are hashed concurrently
+// (see [HashWorkers]),
+// and their hashes are remembered in the stat cache,
+// if there is one
+// (see [FileHashCache]).
+func fileHashes(ctx context.Context, items []string, exclude ...string) ([]string, error) {
+	var (
+		hashes = make(map[string]string)
+		infos  = make(map[string]fs.FileInfo) // files to hash
+	)
 
-	if err := fileHashesHelper(items, hashes); err != nil {
+	for _, item := range items {
+		if err := fileHashesItemHelper(item, item, exclude, hashes, infos); err != nil {
+			return nil, err
+		}
+	}
+	if err := hashFiles(ctx, infos, hashes); err != nil {
 		return nil, err
 	}
 
@@ -265,44 +586,96 @@ func fileHashes(items []string) ([]string, error) {
 	return result, nil
 }
 
-func fileHashesHelper(items []string, hashes map[string]string) error {
-	for _, item := range items {
-		if err := fileHashesItemHelper(item, hashes); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func fileHashesItemHelper(item string, hashes map[string]string) error {
+// fileHashesItemHelper walks item,
+// which is root or is inside the directory root,
+// adding an empty hash to hashes if it does not exist
+// and adding the info for each file found to infos.
+func fileHashesItemHelper(item, root string, exclude []string, hashes map[string]string, infos map[string]fs.FileInfo) error {
 	if _, ok := hashes[item]; ok {
-		// Already computed.
+		// Already seen.
 		// (There can be duplicates or overlaps in the input.)
 		return nil
 	}
+	if _, ok := infos[item]; ok {
+		return nil
+	}
+
+	if ok, err := excluded(exclude, root, item); err != nil || ok {
+		return err
+	}
 
 	info, err := os.Stat(item)
 	if errors.Is(err, fs.ErrNotExist) {
 		hashes[item] = ""
 		return nil
 	}
+	if err != nil {
+		return errors.Wrapf(err, "statting %s", item)
+	}
 
 	if info.IsDir() {
 		entries, err := os.ReadDir(item)
 		if err != nil {
 			return errors.Wrapf(err, "reading directory %s", item)
 		}
-		subitems := slices.Map(entries, func(s os.DirEntry) string { return filepath.Join(item, s.Name()) })
-		return fileHashesHelper(subitems, hashes)
+		for _, entry := range entries {
+			if err := fileHashesItemHelper(filepath.Join(item, entry.Name()), root, exclude, hashes, infos); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	h, err := hashFile(item)
-	if err != nil {
-		return errors.Wrapf(err, "hashing file %s", item)
+	infos[item] = info
+
+	return nil
+}
+
+// HashWorkers is the number of files that Fab hashes at once
+// when computing the hash of a [Files] target.
+var HashWorkers = runtime.NumCPU()
+
+// hashFiles hashes the files in infos concurrently,
+// using up to [HashWorkers] goroutines,
+// and adds their hashes to hashes.
+func hashFiles(ctx context.Context, infos map[string]fs.FileInfo, hashes map[string]string) error {
+	var (
+		paths   = maps.Keys(infos)
+		results = make([]string, len(paths))
+		errs    = make([]error, len(paths))
+		ch      = make(chan int)
+		wg      sync.WaitGroup
+	)
+	sort.Strings(paths) // for deterministic error reporting
+
+	workers := HashWorkers
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ch {
+				results[i], errs[i] = cachedHashFile(ctx, paths[i], infos[paths[i]])
+			}
+		}()
 	}
-	hashes[item] = h
+	for i := range paths {
+		ch <- i
+	}
+	close(ch)
+	wg.Wait()
 
+	for i, path := range paths {
+		if errs[i] != nil {
+			return errors.Wrapf(errs[i], "hashing file %s", path)
+		}
+		hashes[path] = results[i]
+	}
 	return nil
 }
 
@@ -327,10 +700,16 @@ func filesDecoder(con *Controller, node *yaml.Node, dir string) (Target, error)
 	}
 
 	var yfiles struct {
-		In        yaml.Node `yaml:"In"`
-		Out       yaml.Node `yaml:"Out"`
-		Target    yaml.Node `yaml:"Target"`
-		Autoclean bool      `yaml:"Autoclean"`
+		In            yaml.Node `yaml:"In"`
+		Out           yaml.Node `yaml:"Out"`
+		Target        yaml.Node `yaml:"Target"`
+		Autoclean     bool      `yaml:"Autoclean"`
+		MkdirOut      *bool     `yaml:"MkdirOut"`
+		ReadOnlyIn    bool      `yaml:"ReadOnlyIn"`
+		StrictOutputs bool      `yaml:"StrictOutputs"`
+		Hermetic      bool      `yaml:"Hermetic"`
+		Exclude       yaml.Node `yaml:"Exclude"`
+		HashEnv       yaml.Node `yaml:"HashEnv"`
 	}
 	if err := node.Decode(&yfiles); err != nil {
 		return nil, errors.Wrap(err, "YAML error in Files node")
@@ -341,7 +720,7 @@ func filesDecoder(con *Controller, node *yaml.Node, dir string) (Target, error)
 		return nil, errors.Wrap(err, "YAML error in Target child of Files node")
 	}
 
-	in, err := con.YAMLFileList(&yfiles.In, dir)
+	in, volatile, err := con.yamlFilesIn(&yfiles.In, dir)
 	if err != nil {
 		return nil, errors.Wrap(err, "YAML error in Files.In node")
 	}
@@ -351,7 +730,29 @@ func filesDecoder(con *Controller, node *yaml.Node, dir string) (Target, error)
 		return nil, errors.Wrap(err, "YAML error in Files.Out node")
 	}
 
-	return Files(target, in, out, Autoclean(yfiles.Autoclean)), nil
+	opts := []FilesOpt{Autoclean(yfiles.Autoclean), ReadOnlyIn(yfiles.ReadOnlyIn), StrictOutputs(yfiles.StrictOutputs), Hermetic(yfiles.Hermetic)}
+	if yfiles.MkdirOut != nil {
+		opts = append(opts, MkdirOut(*yfiles.MkdirOut))
+	}
+	if len(volatile) > 0 {
+		opts = append(opts, Volatile(strings.Join(volatile, "; ")))
+	}
+	if yfiles.Exclude.Kind != 0 {
+		exclude, err := con.YAMLStringList(&yfiles.Exclude, dir)
+		if err != nil {
+			return nil, errors.Wrap(err, "YAML error in Files.Exclude node")
+		}
+		opts = append(opts, Exclude(exclude...))
+	}
+	if yfiles.HashEnv.Kind != 0 {
+		names, err := con.YAMLStringList(&yfiles.HashEnv, dir)
+		if err != nil {
+			return nil, errors.Wrap(err, "YAML error in Files.HashEnv node")
+		}
+		opts = append(opts, HashEnv(names...))
+	}
+
+	return Files(target, in, out, opts...), nil
 }
 
 func globDecoder(con *Controller, node *yaml.Node, dir string) ([]string, error) {
@@ -369,21 +770,17 @@ func globDecoder(con *Controller, node *yaml.Node, dir string) ([]string, error)
 	if dir == "" {
 		dir = "."
 	}
-	fsys := os.DirFS(dir)
 
-	var result []string
-	for _, pattern := range patterns {
-		matches, err := fs.Glob(fsys, pattern)
-		if err != nil {
-			return nil, errors.Wrap(err, "in Glob pattern")
-		}
-		result = append(result, matches...)
+	result, err := globFS(os.DirFS(dir), patterns)
+	if err != nil {
+		return nil, errors.Wrap(err, "in Glob pattern")
 	}
-
-	return result, nil
+	return slices.Map(result, filepath.FromSlash), nil
 }
 
 func init() {
 	RegisterYAMLTarget("Files", filesDecoder)
+	SetYAMLTagDoc("Files", "Run a target only when its input files have changed or its output files are missing.")
 	RegisterYAMLStringList("Glob", globDecoder)
+	SetYAMLTagDoc("Glob", "List the files matching glob patterns, which may use **, braces, and ! for negation.")
 }
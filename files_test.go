@@ -2,12 +2,15 @@ package fab
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"testing"
 
+	"github.com/bobg/go-generics/v2/maps"
 	"github.com/bobg/go-generics/v2/set"
 	"github.com/davecgh/go-spew/spew"
 )
@@ -153,7 +156,7 @@ func fileCopyTarget(from, to string) Target {
 func TestFileHashes(t *testing.T) {
 	t.Parallel()
 
-	got, err := fileHashes([]string{
+	got, err := fileHashes(context.Background(), []string{
 		"_testdata/filehashes/file2",
 		"_testdata/filehashes/dir",
 		"_testdata/filehashes/file1",
@@ -174,6 +177,50 @@ func TestFileHashes(t *testing.T) {
 	}
 }
 
+func TestFileHashesMany(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	hashes := make(map[string]string)
+	for i := 0; i < 200; i++ {
+		dir := filepath.Join(tmpdir, fmt.Sprintf("d%d", i%7))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(dir, fmt.Sprintf("f%03d", i))
+		if err := os.WriteFile(file, []byte(fmt.Sprintf("file %d\n", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		h, err := hashFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[file] = h
+	}
+	missing := filepath.Join(tmpdir, "missing")
+	hashes[missing] = ""
+
+	names := maps.Keys(hashes)
+	sort.Strings(names)
+	var want []string
+	for _, name := range names {
+		want = append(want, name, hashes[name])
+	}
+
+	got, err := fileHashes(context.Background(), []string{missing, tmpdir, filepath.Join(tmpdir, "d3")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
 func TestFilesRegistry(t *testing.T) {
 	targ := &files{}
 	filesRegistry.add("TestFilesRegistry/a/b/c.d", targ)
@@ -229,4 +276,90 @@ func TestGlob(t *testing.T) {
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("got:\n%s\nwant:\n%s", spew.Sdump(got), spew.Sdump(want))
 	}
+
+	got, _ = con.RegistryTarget("Negating")
+	want = Files(
+		&Command{
+			Shell: "echo Hello",
+			Dir:   "_testdata/glob",
+		},
+		[]string{
+			"_testdata/glob/x1",
+			"_testdata/glob/z1",
+		},
+		nil,
+	)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", spew.Sdump(got), spew.Sdump(want))
+	}
+}
+
+func TestMkdirOut(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		ctx    = context.Background()
+		outdir = filepath.Join(tmpdir, "a", "b")
+	)
+
+	// The subtarget fails if its output directory does not exist.
+	touch := F(func(context.Context, *Controller) error {
+		return os.WriteFile(filepath.Join(outdir, "out"), nil, 0644)
+	})
+
+	con := NewController("")
+	if err := con.Run(ctx, Files(touch, nil, []string{filepath.Join(outdir, "out")}, MkdirOut(false))); err == nil {
+		t.Error("got no error with MkdirOut(false)")
+	}
+
+	con = NewController("")
+	if err := con.Run(ctx, Files(touch, nil, []string{filepath.Join(outdir, "out")})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(outdir, "out")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStrictOutputs(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		ctx  = context.Background()
+		out1 = filepath.Join(tmpdir, "out1")
+		out2 = filepath.Join(tmpdir, "out2")
+		out3 = filepath.Join(tmpdir, "out3")
+	)
+
+	writeOut1 := F(func(context.Context, *Controller) error {
+		return os.WriteFile(out1, nil, 0644)
+	})
+
+	con := NewController("")
+	if err := con.Run(ctx, Files(writeOut1, nil, []string{out1, out2, out3})); err != nil {
+		t.Fatal(err)
+	}
+
+	con = NewController("")
+	err = con.Run(ctx, Files(writeOut1, nil, []string{out1, out2, out3}, StrictOutputs(true)))
+	var merr MissingOutputsError
+	if !errors.As(err, &merr) {
+		t.Fatalf("got error %v, want MissingOutputsError", err)
+	}
+	if want := []string{out2, out3}; !reflect.DeepEqual(merr.Files, want) {
+		t.Errorf("got missing files %v, want %v", merr.Files, want)
+	}
 }
@@ -0,0 +1,327 @@
+package fab
+
+import (
+	"bufio"
+	"context"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+)
+
+type fileTraceKeyType struct{}
+
+// WithFileTrace decorates a context with the value of a "file trace" boolean.
+// When it is true,
+// a [Files] target traces the [Command]s run by its subtarget
+// (using strace,
+// so this works only on Linux with strace installed),
+// recording the files in the project that they actually read and write.
+// Afterwards,
+// a warning is printed for each file that was read but is not among the declared input files,
+// or written but is not among the declared output files.
+// These usually mean the In and Out lists of the Files target are incomplete,
+// so that it can be wrongly considered up to date.
+//
+// Only files inside the project's top directory are checked.
+// Relative pathnames are resolved against each Command's Dir,
+// so the results may be wrong for a subprocess that changes its directory.
+//
+// Retrieve it with [GetFileTrace].
+func WithFileTrace(ctx context.Context, trace bool) context.Context {
+	return context.WithValue(ctx, fileTraceKeyType{}, trace)
+}
+
+// GetFileTrace returns the value of the file-trace boolean added to `ctx` with [WithFileTrace].
+// The default, if WithFileTrace was not used, is false.
+func GetFileTrace(ctx context.Context) bool {
+	val, _ := ctx.Value(fileTraceKeyType{}).(bool)
+	return val
+}
+
+// fileTracer collects strace output for the commands run by one Files target.
+type fileTracer struct {
+	dir string // temporary directory for strace output
+
+	mu   sync.Mutex
+	runs []tracedRun
+}
+
+// tracedRun is one command run under strace.
+type tracedRun struct {
+	prefix string   // strace output goes to files named prefix.PID
+	dir    string   // the command's working directory
+	sb     *sandbox // the sandbox the command ran in, if any (see Hermetic)
+}
+
+type fileTracerKeyType struct{}
+
+func withFileTracer(ctx context.Context, tr *fileTracer) context.Context {
+	return context.WithValue(ctx, fileTracerKeyType{}, tr)
+}
+
+func getFileTracer(ctx context.Context) *fileTracer {
+	tr, _ := ctx.Value(fileTracerKeyType{}).(*fileTracer)
+	return tr
+}
+
+var errNoStrace = errors.New("file tracing requires strace on Linux")
+
+func newFileTracer() (*fileTracer, error) {
+	if runtime.GOOS != "linux" {
+		return nil, errNoStrace
+	}
+	if _, err := exec.LookPath("strace"); err != nil {
+		return nil, errNoStrace
+	}
+	dir, err := os.MkdirTemp("", "fab-trace-*")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating directory for trace output")
+	}
+	return &fileTracer{dir: dir}, nil
+}
+
+func (tr *fileTracer) close() error {
+	return os.RemoveAll(tr.dir)
+}
+
+// wrap returns the command name and args
+// for running cmdname with args under strace,
+// in the working directory dir
+// and the sandbox sb (which may be nil).
+func (tr *fileTracer) wrap(cmdname string, args []string, dir string, sb *sandbox) (string, []string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	prefix := filepath.Join(tr.dir, strconv.Itoa(len(tr.runs)))
+	tr.runs = append(tr.runs, tracedRun{prefix: prefix, dir: dir, sb: sb})
+
+	// -f follows child processes,
+	// -ff puts each process's trace in its own file
+	// (so that syscalls from different processes are not interleaved),
+	// and -qq suppresses messages about processes attaching and exiting.
+	straceArgs := []string{"-f", "-ff", "-qq", "-e", "trace=%file", "-o", prefix, "--", cmdname}
+	return "strace", append(straceArgs, args...)
+}
+
+// tracedFiles parses the strace output collected by tr.
+// It returns the absolute paths of files that were read and written,
+// mapped out of any sandbox.
+func (tr *fileTracer) tracedFiles() (reads, writes set.Of[string], err error) {
+	tr.mu.Lock()
+	runs := tr.runs
+	tr.mu.Unlock()
+
+	reads, writes = set.New[string](), set.New[string]()
+
+	for _, run := range runs {
+		dir, err := filepath.Abs(run.dir) // Abs("") is the current directory
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "getting absolute path of %s", run.dir)
+		}
+		traceFiles, err := filepath.Glob(run.prefix + ".*")
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "finding trace output")
+		}
+		for _, traceFile := range traceFiles {
+			if err := parseTraceFile(traceFile, dir, run.sb, reads, writes); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return reads, writes, nil
+}
+
+func parseTraceFile(filename, dir string, sb *sandbox, reads, writes set.Of[string]) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", filename)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1024*1024)
+	for sc.Scan() {
+		parseTraceLine(sc.Text(), dir, sb, reads, writes)
+	}
+	return errors.Wrapf(sc.Err(), "reading %s", filename)
+}
+
+var (
+	traceLineRegex   = regexp.MustCompile(`^(\w+)\((.*)\)\s+=\s+(-?\d+)`)
+	traceStringRegex = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+)
+
+// parseTraceLine adds the file read or written by the syscall
+// in one line of strace output
+// to reads or writes.
+// Failed syscalls,
+// and those other than the ones that open and rename files,
+// are ignored.
+// Relative pathnames are resolved against dir,
+// and pathnames in the sandbox sb (if it is non-nil)
+// are mapped to the corresponding places in the project.
+func parseTraceLine(line, dir string, sb *sandbox, reads, writes set.Of[string]) {
+	m := traceLineRegex.FindStringSubmatch(line)
+	if m == nil {
+		return
+	}
+	syscall, args := m[1], m[2]
+	if strings.HasPrefix(m[3], "-") {
+		return
+	}
+
+	var paths []string
+	for _, quoted := range traceStringRegex.FindAllString(args, -1) {
+		path, err := strconv.Unquote(quoted)
+		if err != nil {
+			return
+		}
+		paths = append(paths, path)
+	}
+
+	var (
+		path  string
+		write bool
+	)
+
+	switch syscall {
+	case "open", "openat", "openat2", "creat":
+		if len(paths) == 0 {
+			return
+		}
+		if strings.Contains(args, "O_DIRECTORY") {
+			return
+		}
+		if syscall == "openat" || syscall == "openat2" {
+			if !strings.HasPrefix(args, "AT_FDCWD") && !filepath.IsAbs(paths[0]) {
+				// Relative to some other directory.
+				return
+			}
+		}
+		path = paths[0]
+		write = syscall == "creat" || strings.Contains(args, "O_WRONLY") || strings.Contains(args, "O_RDWR") || strings.Contains(args, "O_CREAT")
+
+	case "rename", "renameat", "renameat2":
+		if len(paths) < 2 {
+			return
+		}
+		path, write = paths[1], true
+
+	default:
+		return
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = sb.unpath(filepath.Clean(path))
+	if write {
+		writes.Add(path)
+	} else {
+		reads.Add(path)
+	}
+}
+
+// checkTrace compares the files that ft's subtarget was traced reading and writing
+// with ft's declared input and output files,
+// printing a warning about any that are undeclared.
+// See [WithFileTrace].
+func (ft *files) checkTrace(con *Controller, tr *fileTracer) error {
+	reads, writes, err := tr.tracedFiles()
+	if err != nil {
+		return errors.Wrap(err, "parsing file trace")
+	}
+
+	topdir, err := filepath.Abs(con.JoinPath())
+	if err != nil {
+		return errors.Wrap(err, "getting absolute path of top directory")
+	}
+	var (
+		in     = absPaths(ft.In)
+		out    = absPaths(ft.Out)
+		inTree = func(path string, items []string) bool {
+			for _, item := range items {
+				if path == item || strings.HasPrefix(path, item+string(filepath.Separator)) {
+					return true
+				}
+			}
+			return false
+		}
+	)
+
+	// rel returns the path of a traced file relative to the top directory,
+	// and false if it is not in the project.
+	rel := func(path string) (string, bool) {
+		r, err := filepath.Rel(topdir, path)
+		if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+			return "", false
+		}
+		return r, true
+	}
+
+	var undeclaredIn, undeclaredOut []string
+
+	for path := range writes {
+		r, ok := rel(path)
+		if !ok {
+			continue
+		}
+		abs := filepath.Join(topdir, r)
+		if inTree(abs, out) {
+			continue
+		}
+		if _, err := os.Stat(abs); errors.Is(err, fs.ErrNotExist) {
+			// A temporary file.
+			continue
+		}
+		undeclaredOut = append(undeclaredOut, r)
+	}
+
+	for path := range reads {
+		r, ok := rel(path)
+		if !ok {
+			continue
+		}
+		abs := filepath.Join(topdir, r)
+		if inTree(abs, in) || inTree(abs, out) || writes.Has(path) {
+			continue
+		}
+		if info, err := os.Stat(abs); err != nil || info.IsDir() {
+			continue
+		}
+		undeclaredIn = append(undeclaredIn, r)
+	}
+
+	if len(undeclaredIn) > 0 {
+		sort.Strings(undeclaredIn)
+		con.message("stderr", "Warning: %s read undeclared input files: %s", con.Describe(ft), strings.Join(undeclaredIn, ", "))
+	}
+	if len(undeclaredOut) > 0 {
+		sort.Strings(undeclaredOut)
+		con.message("stderr", "Warning: %s wrote undeclared output files: %s", con.Describe(ft), strings.Join(undeclaredOut, ", "))
+	}
+	return nil
+}
+
+// absPaths returns the absolute forms of the given paths.
+// Any that cannot be made absolute are omitted.
+func absPaths(paths []string) []string {
+	var result []string
+	for _, path := range paths {
+		if abs, err := filepath.Abs(path); err == nil {
+			result = append(result, abs)
+		}
+	}
+	return result
+}
@@ -0,0 +1,148 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestParseTraceLine(t *testing.T) {
+	t.Parallel()
+
+	const trace = `execve("/bin/sh", ["sh", "-c", "cat a > b"], 0x7ffc /* 20 vars */) = 0
+openat(AT_FDCWD, "/etc/ld.so.cache", O_RDONLY|O_CLOEXEC) = 3
+openat(AT_FDCWD, "a", O_RDONLY) = 3
+openat(AT_FDCWD, "sub/../b", O_WRONLY|O_CREAT|O_TRUNC, 0666) = 3
+openat(AT_FDCWD, "missing", O_RDONLY) = -1 ENOENT (No such file or directory)
+openat(AT_FDCWD, ".", O_RDONLY|O_NONBLOCK|O_CLOEXEC|O_DIRECTORY) = 3
+openat(3, "relative", O_RDONLY) = 4
+open("/abs/c", O_RDWR) = 5
+creat("d", 0644) = 6
+rename("tmp", "e") = 0
+stat("f", {st_mode=S_IFREG|0644, st_size=0, ...}) = 0
+`
+
+	reads, writes := set.New[string](), set.New[string]()
+	for _, line := range strings.Split(trace, "\n") {
+		parseTraceLine(line, "/dir", nil, reads, writes)
+	}
+
+	gotReads, gotWrites := reads.Slice(), writes.Slice()
+	sort.Strings(gotReads)
+	sort.Strings(gotWrites)
+
+	if want := []string{"/dir/a", "/etc/ld.so.cache"}; !reflect.DeepEqual(gotReads, want) {
+		t.Errorf("got reads %v, want %v", gotReads, want)
+	}
+	if want := []string{"/abs/c", "/dir/b", "/dir/d", "/dir/e"}; !reflect.DeepEqual(gotWrites, want) {
+		t.Errorf("got writes %v, want %v", gotWrites, want)
+	}
+
+	// Paths in a sandbox are mapped back to the project.
+	reads = set.New[string]()
+	sb := &sandbox{topdir: "/proj", dir: "/tmp/sandbox/top"}
+	parseTraceLine(`openat(AT_FDCWD, "x", O_RDONLY) = 3`, "/tmp/sandbox/top/sub", sb, reads, writes)
+	if !reads.Has("/proj/sub/x") {
+		t.Errorf("got reads %v, want /proj/sub/x", reads.Slice())
+	}
+}
+
+func TestCheckTrace(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	for _, name := range []string{"in", "undeclared-in", "out", "undeclared-out"} {
+		if err := os.WriteFile(filepath.Join(tmpdir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tr := &fileTracer{dir: filepath.Join(tmpdir, "trace")}
+	if err := os.Mkdir(tr.dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	tr.wrap("sh", nil, tmpdir, nil)
+	const trace = `openat(AT_FDCWD, "in", O_RDONLY) = 3
+openat(AT_FDCWD, "undeclared-in", O_RDONLY) = 3
+openat(AT_FDCWD, "/etc/passwd", O_RDONLY) = 3
+openat(AT_FDCWD, "out", O_WRONLY|O_CREAT|O_TRUNC, 0666) = 4
+openat(AT_FDCWD, "out", O_RDONLY) = 4
+openat(AT_FDCWD, "undeclared-out", O_WRONLY|O_CREAT|O_TRUNC, 0666) = 4
+openat(AT_FDCWD, "temp", O_WRONLY|O_CREAT|O_TRUNC, 0666) = 4
+`
+	if err := os.WriteFile(tr.runs[0].prefix+".1234", []byte(trace), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		buf = new(bytes.Buffer)
+		con = NewController(tmpdir)
+		ft  = &files{
+			Target: &Command{Shell: "true"},
+			In:     []string{filepath.Join(tmpdir, "in")},
+			Out:    []string{filepath.Join(tmpdir, "out")},
+		}
+	)
+	con.SetProgressSink(NewTextProgressSink(con, buf, buf))
+
+	if err := ft.checkTrace(con, tr); err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	if !strings.Contains(got, "read undeclared input files: undeclared-in\n") {
+		t.Errorf("got %q, want warning about undeclared-in", got)
+	}
+	if !strings.Contains(got, "wrote undeclared output files: undeclared-out\n") {
+		t.Errorf("got %q, want warning about undeclared-out", got)
+	}
+}
+
+func TestFileTrace(t *testing.T) {
+	if _, err := exec.LookPath("strace"); err != nil {
+		t.Skip("strace not available")
+	}
+
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	for _, name := range []string{"a", "b"} {
+		if err := os.WriteFile(filepath.Join(tmpdir, name), []byte(name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		buf = new(bytes.Buffer)
+		con = NewController(tmpdir)
+		ctx = WithFileTrace(context.Background(), true)
+		cmd = &Command{Shell: "cat a b > ab", Dir: tmpdir}
+	)
+	con.SetProgressSink(NewTextProgressSink(con, buf, buf))
+
+	target := Files(cmd, []string{filepath.Join(tmpdir, "a")}, []string{filepath.Join(tmpdir, "ab")})
+	if err := con.Run(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "read undeclared input files: b\n") {
+		t.Errorf("got %q, want warning about b", got)
+	}
+}
@@ -0,0 +1,129 @@
+package fab
+
+import (
+	"context"
+	"time"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Finally produces a target that runs target and then cleanup,
+// even if target fails
+// or ctx is canceled or passes its deadline
+// (e.g. because of the -timeout flag).
+//
+// The cleanup target runs with a context that is not canceled along with ctx.
+// Instead it is canceled after the grace period added to ctx with [WithGracePeriod]
+// has elapsed following the cancellation of ctx,
+// or immediately if there is no grace period.
+//
+// The result is the error from target, if any,
+// joined with the error from cleanup, if any.
+//
+// A Finally target may be specified in YAML using the tag !Finally,
+// which introduces a mapping with the fields Target and Cleanup.
+// Each is a target or target name.
+func Finally(target, cleanup Target) Target {
+	return &finally{Target: target, Cleanup: cleanup}
+}
+
+type finally struct {
+	Target  Target
+	Cleanup Target
+}
+
+var _ Target = &finally{}
+
+// Run implements Target.Run.
+func (f *finally) Run(ctx context.Context, con *Controller) error {
+	err := con.Run(ctx, f.Target)
+
+	cctx, cancel := graceContext(ctx)
+	defer cancel()
+	cctx = withFailureScope(cctx)
+
+	if cleanupErr := con.Run(cctx, f.Cleanup); cleanupErr != nil {
+		err = errors.Join(err, errors.Wrap(cleanupErr, "in cleanup"))
+	}
+	return err
+}
+
+// Desc implements Target.Desc.
+func (*finally) Desc() string {
+	return "Finally"
+}
+
+// Children implements GraphChildren.
+func (f *finally) Children() []Target {
+	return []Target{f.Target, f.Cleanup}
+}
+
+// graceContext returns a context with the same values as ctx
+// that is canceled only after the grace period in ctx
+// (see [WithGracePeriod])
+// has elapsed following the cancellation of ctx.
+func graceContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	result, cancel := context.WithCancel(detachedContext{ctx})
+	grace := GetGracePeriod(ctx)
+
+	go func() {
+		select {
+		case <-result.Done():
+			return
+		case <-ctx.Done():
+		}
+
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+
+		select {
+		case <-result.Done():
+		case <-timer.C:
+			cancel()
+		}
+	}()
+
+	return result, cancel
+}
+
+// detachedContext has the values of its parent
+// but not its deadline or cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+func (d detachedContext) Value(key any) any         { return d.parent.Value(key) }
+
+func finallyDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var yfinally struct {
+		Target  yaml.Node `yaml:"Target"`
+		Cleanup yaml.Node `yaml:"Cleanup"`
+	}
+	if err := node.Decode(&yfinally); err != nil {
+		return nil, errors.Wrap(err, "YAML error in Finally node")
+	}
+
+	target, err := con.YAMLTarget(&yfinally.Target, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Finally.Target node")
+	}
+	cleanup, err := con.YAMLTarget(&yfinally.Cleanup, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Finally.Cleanup node")
+	}
+
+	return Finally(target, cleanup), nil
+}
+
+func init() {
+	RegisterYAMLTarget("Finally", finallyDecoder)
+	SetYAMLTagDoc("Finally", "Run a target, then run a cleanup target whether or not the first one succeeded.")
+}
@@ -0,0 +1,96 @@
+package fab
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFinally(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ran     bool
+		fail    = F(func(context.Context, *Controller) error { return fmt.Errorf("failed") })
+		cleanup = F(func(context.Context, *Controller) error { ran = true; return nil })
+		con     = NewController("")
+	)
+
+	err := con.Run(context.Background(), Finally(fail, cleanup))
+	if err == nil {
+		t.Error("got no error")
+	}
+	if !ran {
+		t.Error("cleanup did not run")
+	}
+}
+
+func TestFinallyTimeout(t *testing.T) {
+	t.Parallel()
+
+	const grace = 100 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	ctx = WithGracePeriod(ctx, grace)
+
+	var (
+		cleanupErr  error
+		cleanupTime time.Duration
+		cleanup     = F(func(ctx context.Context, _ *Controller) error {
+			// The cleanup target starts out with an uncanceled context,
+			// which is canceled after the grace period.
+			cleanupErr = ctx.Err()
+			start := time.Now()
+			<-ctx.Done()
+			cleanupTime = time.Since(start)
+			return nil
+		})
+		con   = NewController("")
+		start = time.Now()
+	)
+
+	err := con.Run(ctx, Finally(Shellf("sleep 10"), cleanup))
+	if err == nil {
+		t.Error("got no error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %s, command was not interrupted", elapsed)
+	}
+	if cleanupErr != nil {
+		t.Errorf("cleanup context was already done: %s", cleanupErr)
+	}
+	if cleanupTime < grace/2 {
+		t.Errorf("cleanup got %s, want about %s", cleanupTime, grace)
+	}
+}
+
+func TestFinallyYAML(t *testing.T) {
+	t.Parallel()
+
+	const yml = `
+Build: !Finally
+  Target: !Command
+    Shell: echo build
+  Cleanup: Clean
+Clean: !Command
+  Shell: echo clean
+`
+	con := NewController("")
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+	target, _ := con.RegistryTarget("Build")
+	f, ok := target.(*finally)
+	if !ok {
+		t.Fatalf("got %T, want *finally", target)
+	}
+	if _, ok := f.Target.(*Command); !ok {
+		t.Errorf("got target %T, want *Command", f.Target)
+	}
+	if f.Cleanup == nil {
+		t.Error("no cleanup target")
+	}
+}
@@ -0,0 +1,281 @@
+package fab
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/maps"
+	"gopkg.in/yaml.v3"
+)
+
+// Flaky produces a target that runs a subtarget,
+// retrying it up to `retries` times if it fails.
+// This is intended for test targets that sometimes fail for reasons unrelated to the code being tested.
+//
+// When the subtarget fails and then succeeds on a retry,
+// or when it fails on every attempt,
+// a record of the event is appended to a file in the Fab directory
+// (see [GetFabdir]).
+// Those records can be summarized with [FlakyReport],
+// which is what `fab -flaky` does.
+//
+// If `quarantine` is true,
+// a subtarget that fails on every attempt
+// is recorded and reported in verbose mode,
+// but the Flaky target itself does not fail.
+//
+// It is JSON-encodable
+// (and therefore usable as the subtarget in [Files])
+// if its subtarget is.
+//
+// A Flaky target may be specified in YAML using the tag !Flaky,
+// which introduces a mapping whose fields are:
+//
+//   - Target: the subtarget, or target name
+//   - Retries: the number of times to retry the subtarget after a failure
+//   - Quarantine: a boolean
+//
+// Example:
+//
+//	Test: !Flaky
+//	  Target: !Command
+//	    Shell: go test ./...
+//	  Retries: 2
+func Flaky(target Target, retries int, quarantine bool) Target {
+	return &flaky{
+		Target:     target,
+		Retries:    retries,
+		Quarantine: quarantine,
+	}
+}
+
+type flaky struct {
+	Target     Target
+	Retries    int
+	Quarantine bool
+}
+
+var _ Target = &flaky{}
+
+// Run implements Target.Run.
+func (f *flaky) Run(ctx context.Context, con *Controller) error {
+	var (
+		verbose  = GetVerbose(ctx)
+		attempts = 1 + f.Retries
+		err      error
+	)
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 && verbose {
+			con.Indentf("Retrying %s (attempt %d of %d)", con.Describe(f), attempt, attempts)
+		}
+
+		snapshot := con.ranSnapshot()
+
+		if err = con.Run(withFailureScope(ctx), f.Target); err == nil {
+			if attempt > 1 {
+				return f.record(ctx, con, attempt, false)
+			}
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return err
+		}
+
+		// Allow the subtarget (and any of its failed subtargets) to run again.
+		con.forgetFailures(snapshot)
+	}
+
+	if recErr := f.record(ctx, con, attempts, true); recErr != nil {
+		return errors.Join(err, recErr)
+	}
+
+	if f.Quarantine {
+		if verbose {
+			con.Indentf("%s is quarantined, ignoring failure: %s", con.Describe(f), err)
+		}
+		return nil
+	}
+
+	return err
+}
+
+// Desc implements Target.Desc.
+func (*flaky) Desc() string {
+	return "Flaky"
+}
+
+// Children implements GraphChildren.
+func (f *flaky) Children() []Target {
+	return []Target{f.Target}
+}
+
+// FlakyRecord is a record of a flaky target's behavior on one run.
+type FlakyRecord struct {
+	// Target is the name of the flaky target.
+	Target string `json:"target"`
+
+	// Time is when the target ran.
+	Time time.Time `json:"time"`
+
+	// Attempts is the number of times the subtarget was run.
+	Attempts int `json:"attempts"`
+
+	// Failed tells whether the subtarget failed on every attempt.
+	Failed bool `json:"failed,omitempty"`
+
+	// Quarantined tells whether the failure was ignored.
+	Quarantined bool `json:"quarantined,omitempty"`
+}
+
+const flakyBasename = "flaky.json"
+
+var flakyMu sync.Mutex // protects the flaky-record file
+
+func (f *flaky) record(ctx context.Context, con *Controller, attempts int, failed bool) error {
+	fabdir := GetFabdir(ctx)
+	if fabdir == "" || GetDryRun(ctx) {
+		return nil
+	}
+
+	rec := FlakyRecord{
+		Target:      con.Describe(f),
+		Time:        time.Now(),
+		Attempts:    attempts,
+		Failed:      failed,
+		Quarantined: failed && f.Quarantine,
+	}
+	j, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "encoding flaky record")
+	}
+
+	flakyMu.Lock()
+	defer flakyMu.Unlock()
+
+	filename := filepath.Join(fabdir, flakyBasename)
+	out, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s for appending", filename)
+	}
+	defer out.Close()
+
+	if _, err = fmt.Fprintln(out, string(j)); err != nil {
+		return errors.Wrapf(err, "writing to %s", filename)
+	}
+	return out.Close()
+}
+
+// ReadFlakyRecords reads the records written by [Flaky] targets
+// to the file in the given Fab directory.
+// It is not an error for the file not to exist.
+func ReadFlakyRecords(fabdir string) ([]FlakyRecord, error) {
+	filename := filepath.Join(fabdir, flakyBasename)
+	f, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %s", filename)
+	}
+	defer f.Close()
+
+	var (
+		result []FlakyRecord
+		sc     = bufio.NewScanner(f)
+	)
+	for sc.Scan() {
+		var rec FlakyRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, errors.Wrapf(err, "decoding record in %s", filename)
+		}
+		result = append(result, rec)
+	}
+	return result, errors.Wrapf(sc.Err(), "reading %s", filename)
+}
+
+// FlakyReport writes a summary of the records written by [Flaky] targets
+// to the file in the given Fab directory.
+// For each target it shows how many times it needed a retry to succeed,
+// how many times it failed outright,
+// and when it was last seen misbehaving.
+func FlakyReport(w io.Writer, fabdir string) error {
+	recs, err := ReadFlakyRecords(fabdir)
+	if err != nil {
+		return err
+	}
+
+	type summary struct {
+		flaky, failed, quarantined int
+		last                       time.Time
+	}
+	summaries := make(map[string]*summary)
+	for _, rec := range recs {
+		s, ok := summaries[rec.Target]
+		if !ok {
+			s = &summary{}
+			summaries[rec.Target] = s
+		}
+		switch {
+		case rec.Quarantined:
+			s.quarantined++
+		case rec.Failed:
+			s.failed++
+		default:
+			s.flaky++
+		}
+		if rec.Time.After(s.last) {
+			s.last = rec.Time
+		}
+	}
+
+	names := maps.Keys(summaries)
+	sort.Strings(names)
+	for _, name := range names {
+		s := summaries[name]
+		fmt.Fprintln(w, name)
+		fmt.Fprintf(w, "    passed on retry: %d, failed: %d, quarantined: %d, last: %s\n", s.flaky, s.failed, s.quarantined, s.last.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func flakyDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var yflaky struct {
+		Target     yaml.Node `yaml:"Target"`
+		Retries    int       `yaml:"Retries"`
+		Quarantine bool      `yaml:"Quarantine"`
+	}
+	if err := node.Decode(&yflaky); err != nil {
+		return nil, errors.Wrap(err, "YAML error in Flaky node")
+	}
+	if yflaky.Retries < 0 {
+		return nil, fmt.Errorf("negative Retries value %d in Flaky node", yflaky.Retries)
+	}
+
+	target, err := con.YAMLTarget(&yflaky.Target, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Target child of Flaky node")
+	}
+
+	return Flaky(target, yflaky.Retries, yflaky.Quarantine), nil
+}
+
+func init() {
+	RegisterYAMLTarget("Flaky", flakyDecoder)
+	SetYAMLTagDoc("Flaky", "Run a target, retrying it when it fails, and record how flaky it is.")
+}
@@ -0,0 +1,99 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFlaky(t *testing.T) {
+	t.Parallel()
+
+	fabdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fabdir)
+
+	ctx := context.Background()
+	ctx = WithVerbose(ctx, testing.Verbose())
+	ctx = WithFabdir(ctx, fabdir)
+
+	failUntil := func(n uint32) (Target, *uint32) {
+		var count uint32
+		return F(func(context.Context, *Controller) error {
+			if atomic.AddUint32(&count, 1) < n {
+				return errors.New("flake")
+			}
+			return nil
+		}), &count
+	}
+
+	t.Run("passes_on_retry", func(t *testing.T) {
+		sub, count := failUntil(3)
+		con := NewController("")
+		targ, err := con.RegisterTarget("PassesOnRetry", "", Flaky(Seq(sub), 2, false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = con.Run(ctx, targ); err != nil {
+			t.Fatal(err)
+		}
+		if *count != 3 {
+			t.Errorf("got %d attempts, want 3", *count)
+		}
+	})
+
+	t.Run("fails", func(t *testing.T) {
+		sub, count := failUntil(10)
+		con := NewController("")
+		targ, err := con.RegisterTarget("Fails", "", Flaky(sub, 2, false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = con.Run(ctx, targ); err == nil {
+			t.Fatal("got no error but wanted one")
+		}
+		if *count != 3 {
+			t.Errorf("got %d attempts, want 3", *count)
+		}
+	})
+
+	t.Run("quarantined", func(t *testing.T) {
+		sub, _ := failUntil(10)
+		con := NewController("")
+		targ, err := con.RegisterTarget("Quarantined", "", Flaky(sub, 1, true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = con.Run(ctx, targ); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	recs, err := ReadFlakyRecords(fabdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("got %d records, want 3", len(recs))
+	}
+
+	buf := new(bytes.Buffer)
+	if err = FlakyReport(buf, fabdir); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Fails\n    passed on retry: 0, failed: 1, quarantined: 0",
+		"PassesOnRetry\n    passed on retry: 1, failed: 0, quarantined: 0",
+		"Quarantined\n    passed on retry: 0, failed: 0, quarantined: 1",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("report does not contain %q; report is:\n%s", want, buf)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package fab
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ForeachArg is the command-line argument
+// that introduces a list of target names to run in every subdirectory.
+// See [Controller.ParseArgs].
+const ForeachArg = "foreach"
+
+// Foreach produces a target that runs the target with the given name
+// in every subdirectory whose YAML file defines one.
+// All of the project's YAML files are read first
+// (see [Controller.ReadAllYAMLFiles]).
+//
+// The subdirectory targets run concurrently.
+// When they are done,
+// a report of the outcome in each subdirectory is printed,
+// and the error from each failing subdirectory is returned.
+//
+// A foreach target may be requested on the command line
+// as either `fab foreach NAME` or `fab '*/NAME'`.
+func (con *Controller) Foreach(name string) (Target, error) {
+	if err := con.ReadAllYAMLFiles(); err != nil {
+		return nil, err
+	}
+
+	result := &foreach{Name: name}
+	for _, qname := range con.RegistryNames() {
+		dir, base := filepath.Split(qname)
+		if dir == "" || base != name {
+			continue
+		}
+		target, _ := con.RegistryTarget(qname)
+		result.Dirs = append(result.Dirs, filepath.Clean(dir))
+		result.Targets = append(result.Targets, target)
+	}
+	if len(result.Targets) == 0 {
+		return nil, fmt.Errorf("no subdirectory defines target %s", name)
+	}
+
+	return result, nil
+}
+
+type foreach struct {
+	Name    string
+	Dirs    []string // relative to topdir, parallel to Targets
+	Targets []Target
+}
+
+var _ Target = &foreach{}
+
+// Run implements Target.Run.
+func (f *foreach) Run(ctx context.Context, con *Controller) error {
+	var (
+		errs = make([]error, len(f.Targets))
+		wg   sync.WaitGroup
+	)
+	for i, target := range f.Targets {
+		i, target := i, target // Go loop-var pitfall
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = con.Run(ctx, target)
+		}()
+	}
+	wg.Wait()
+
+	var (
+		result error
+		failed int
+	)
+	con.Indentf("Results for %s:", f.Name)
+	for i, dir := range f.Dirs {
+		if errs[i] == nil {
+			con.Indentf("  ok      %s", dir)
+			continue
+		}
+		failed++
+		con.Indentf("  FAILED  %s: %s", dir, errs[i])
+		result = errors.Join(result, errors.Wrapf(errs[i], "in %s", dir))
+	}
+	if failed > 0 {
+		con.Indentf("%d of %d failed", failed, len(f.Dirs))
+	}
+
+	return result
+}
+
+// Desc implements Target.Desc.
+func (*foreach) Desc() string {
+	return "Foreach"
+}
+
+// Children implements GraphChildren.
+func (f *foreach) Children() []Target {
+	return f.Targets
+}
+
+// ReadAllYAMLFiles reads every fab.yaml (or fab.yml) file
+// in con's top directory and its subdirectories,
+// except for those that have already been read.
+// Directories whose names begin with . or _,
+// and directories named vendor or node_modules,
+// are skipped.
+func (con *Controller) ReadAllYAMLFiles() error {
+	topdir := con.JoinPath()
+
+	var dirs []string
+	err := filepath.WalkDir(topdir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != topdir {
+			name := entry.Name()
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "node_modules" {
+				return fs.SkipDir
+			}
+		}
+		rel, err := filepath.Rel(topdir, path)
+		if err != nil {
+			return errors.Wrapf(err, "getting relative path from %s to %s", topdir, path)
+		}
+		if rel == "." {
+			rel = ""
+		}
+		dirs = append(dirs, rel)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "walking %s", topdir)
+	}
+
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		con.mu.Lock()
+		seen := con.yamlDirs.Has(dir)
+		con.mu.Unlock()
+		if seen {
+			continue
+		}
+
+		err := con.ReadYAMLFile(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// foreachDecoder handles the YAML !Foreach tag,
+// which expands a templated subtarget into an [All] of concrete targets,
+// one for each value in a list:
+//
+//	Protos: !Foreach
+//	  Var: proto
+//	  Values: !Glob ["*.proto"]
+//	  Target: !Command
+//	    Shell: protoc --go_out=. ${proto}
+//
+// Each ${NAME} in the scalars of the Target node,
+// where NAME is Var,
+// is replaced by the value.
+// Var defaults to "item".
+// Values is a string list,
+// and may use tags like !Glob and !CommandOutput.
+// Since those produce paths relative to the directory of the YAML file,
+// where a !Command runs,
+// the values can be used in commands as is.
+//
+// Instead of Var and Values,
+// a Matrix mapping from variable names to string lists
+// expands the target for every combination of values:
+//
+//	Binaries: !Foreach
+//	  Matrix:
+//	    GOOS: [linux, darwin, windows]
+//	    GOARCH: [amd64, arm64]
+//	  Target: !Command
+//	    Shell: go build -o bin/${GOOS}_${GOARCH}/ ./cmd/...
+//	    Env: [GOOS=${GOOS}, GOARCH=${GOARCH}]
+//
+// An escaped reference of the form $${NAME} is left unchanged.
+func foreachDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var yforeach struct {
+		Var    string    `yaml:"Var"`
+		Values yaml.Node `yaml:"Values"`
+		Matrix yaml.Node `yaml:"Matrix"`
+		Target yaml.Node `yaml:"Target"`
+	}
+	if err := node.Decode(&yforeach); err != nil {
+		return nil, errors.Wrap(err, "YAML error in Foreach node")
+	}
+
+	var (
+		names  []string
+		values [][]string
+	)
+	switch {
+	case yforeach.Matrix.Kind != 0 && (yforeach.Values.Kind != 0 || yforeach.Var != ""):
+		return nil, fmt.Errorf("Foreach node may have Matrix or Var and Values, but not both")
+
+	case yforeach.Matrix.Kind != 0:
+		if yforeach.Matrix.Kind != yaml.MappingNode {
+			return nil, errors.Wrap(BadYAMLNodeKindError{Got: yforeach.Matrix.Kind, Want: yaml.MappingNode}, "in Foreach.Matrix node")
+		}
+		for i := 0; i+1 < len(yforeach.Matrix.Content); i += 2 {
+			name := yforeach.Matrix.Content[i].Value
+			vals, err := con.YAMLStringList(yforeach.Matrix.Content[i+1], dir)
+			if err != nil {
+				return nil, errors.Wrapf(err, "YAML error in Foreach.Matrix.%s node", name)
+			}
+			names = append(names, name)
+			values = append(values, vals)
+		}
+
+	default:
+		name := yforeach.Var
+		if name == "" {
+			name = "item"
+		}
+		vals, err := con.YAMLStringList(&yforeach.Values, dir)
+		if err != nil {
+			return nil, errors.Wrap(err, "YAML error in Foreach.Values node")
+		}
+		names = []string{name}
+		values = [][]string{vals}
+	}
+
+	for _, name := range names {
+		if !varNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("bad variable name %q in Foreach node", name)
+		}
+	}
+
+	var targets []Target
+	for _, combo := range combinations(values) {
+		bindings := make(map[string]string, len(names))
+		for i, name := range names {
+			bindings[name] = combo[i]
+		}
+		subst := func(s string) string {
+			return varRefRegex.ReplaceAllStringFunc(s, func(ref string) string {
+				if strings.HasPrefix(ref, "$$") {
+					return ref
+				}
+				if value, ok := bindings[ref[2:len(ref)-1]]; ok {
+					return value
+				}
+				return ref
+			})
+		}
+		target, err := con.YAMLTarget(substYAML(&yforeach.Target, subst), dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "YAML error in Foreach.Target node for %v", combo)
+		}
+		targets = append(targets, target)
+	}
+
+	return All(targets...), nil
+}
+
+// combinations returns every combination of one value from each of the given lists,
+// varying the last list fastest.
+func combinations(lists [][]string) [][]string {
+	result := [][]string{nil}
+	for _, list := range lists {
+		var next [][]string
+		for _, prefix := range result {
+			for _, val := range list {
+				combo := append(append([]string{}, prefix...), val)
+				next = append(next, combo)
+			}
+		}
+		result = next
+	}
+	return result
+}
+
+func init() {
+	RegisterYAMLTarget("Foreach", foreachDecoder)
+	SetYAMLTagDoc("Foreach", "Expand a templated target once for each value in a list, or each combination in a matrix, and run them all.")
+}
@@ -0,0 +1,152 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestForeach(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		args     []string
+		wantDirs [][]string
+		wantErr  bool
+	}{{
+		args:     []string{"foreach", "Build"},
+		wantDirs: [][]string{{"a", "b/c"}},
+		wantErr:  true,
+	}, {
+		args:     []string{"*/Build"},
+		wantDirs: [][]string{{"a", "b/c"}},
+		wantErr:  true,
+	}, {
+		args:     []string{"foreach", "Test", "Build"},
+		wantDirs: [][]string{{"a", "d"}, {"a", "b/c"}},
+		wantErr:  true,
+	}, {
+		args:     []string{"*/Test"},
+		wantDirs: [][]string{{"a", "d"}},
+	}}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(strings.Join(tc.args, "_"), func(t *testing.T) {
+			t.Parallel()
+
+			con := NewController("_testdata/foreach")
+			if err := con.ReadYAMLFile(""); err != nil {
+				t.Fatal(err)
+			}
+
+			targets, err := con.ParseArgs(tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gotDirs [][]string
+			for _, target := range targets {
+				f, ok := target.(*foreach)
+				if !ok {
+					t.Fatalf("got %T, want *foreach", target)
+				}
+				gotDirs = append(gotDirs, f.Dirs)
+			}
+			if !reflect.DeepEqual(gotDirs, tc.wantDirs) {
+				t.Errorf("got dirs %v, want %v", gotDirs, tc.wantDirs)
+			}
+
+			ctx := context.Background()
+			err = con.Run(ctx, targets...)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("got no error, want one")
+				} else if !strings.Contains(err.Error(), "in b/c") {
+					t.Errorf("error %q does not mention b/c", err)
+				}
+			} else if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		t.Parallel()
+
+		con := NewController("_testdata/foreach")
+		if _, err := con.ParseArgs([]string{"*/Deploy"}); err == nil {
+			t.Error("got no error, want one")
+		}
+	})
+}
+
+func TestForeachYAML(t *testing.T) {
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	for _, name := range []string{"a.in", "b.in"} {
+		if err := os.WriteFile(filepath.Join(tmpdir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const yml = `
+Copies: !Foreach
+  Var: file
+  Values: !Glob ["*.in"]
+  Target: !Command
+    Shell: cp ${file} ${file}.out
+
+Matrix: !Foreach
+  Matrix:
+    X: [x1, x2]
+    Y: [y1, y2]
+  Target: !Command
+    Shell: touch ${X}_${Y}
+`
+
+	con := NewController(tmpdir)
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Copies", "Matrix"} {
+		target, _ := con.RegistryTarget(name)
+		if err := con.Run(context.Background(), target); err != nil {
+			t.Fatalf("running %s: %s", name, err)
+		}
+	}
+
+	for _, name := range []string{"a.in.out", "b.in.out", "x1_y1", "x1_y2", "x2_y1", "x2_y2"} {
+		if _, err := os.Stat(filepath.Join(tmpdir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	const bad = `
+Bad: !Foreach
+  Var: x
+  Values: [a]
+  Matrix:
+    y: [b]
+  Target: !Command
+    Shell: echo hello
+`
+	con = NewController(tmpdir)
+	if err := con.ReadYAML(strings.NewReader(bad), ""); err == nil {
+		t.Error("got no error for Foreach with both Values and Matrix")
+	}
+}
+
+func TestCombinations(t *testing.T) {
+	t.Parallel()
+
+	got := combinations([][]string{{"a", "b"}, {"1", "2", "3"}})
+	want := [][]string{{"a", "1"}, {"a", "2"}, {"a", "3"}, {"b", "1"}, {"b", "2"}, {"b", "3"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,322 @@
+package fab
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+	"gopkg.in/yaml.v3"
+)
+
+// Formatter describes a source-code formatting tool,
+// for use with [Format].
+type Formatter struct {
+	// List is a command and its arguments.
+	// When invoked with the names of some files as additional arguments,
+	// it must print the names of the ones that are not properly formatted,
+	// one per line.
+	// It may exit with a non-zero status when there are such files.
+	List []string `json:"list"`
+
+	// Fix is a command and its arguments.
+	// When invoked with the names of some files as additional arguments,
+	// it must rewrite them in place with proper formatting.
+	Fix []string `json:"fix"`
+}
+
+// Some predefined Formatters.
+var (
+	Gofmt    = Formatter{List: []string{"gofmt", "-l"}, Fix: []string{"gofmt", "-w"}}
+	Gofumpt  = Formatter{List: []string{"gofumpt", "-l"}, Fix: []string{"gofumpt", "-w"}}
+	Prettier = Formatter{List: []string{"prettier", "--list-different"}, Fix: []string{"prettier", "--write"}}
+)
+
+var formatters = map[string]Formatter{
+	"gofmt":    Gofmt,
+	"gofumpt":  Gofumpt,
+	"prettier": Prettier,
+}
+
+// Format produces a target that checks or fixes the formatting of some files
+// using the given [Formatter].
+//
+// In "check" mode
+// (when fix is false),
+// the target fails with an [UnformattedError]
+// listing any files that are not properly formatted.
+// In "fix" mode
+// (when fix is true),
+// such files are rewritten in place.
+// The mode can be overridden on the command line with the -check and -fix flags
+// (see [ArgTarget]),
+// e.g. `fab Format -fix`.
+// File names following the flags restrict the target to those files
+// (see [ParseFileArgs] and [PreCommit]),
+// e.g. `fab Format -check foo.go bar.go`
+// or `fab Format -files @changed.txt`.
+//
+// Format is implemented in terms of [Check],
+// so when none of the files has changed
+// since the last time they were found to be properly formatted
+// (or were fixed),
+// running the formatter is skipped.
+// A run restricted to some of the files
+// neither consults nor updates the hash DB
+// (see [FileRestricter]).
+//
+// A Format target may be specified in YAML using the tag !Format,
+// which introduces a mapping whose fields are:
+//
+//   - Formatter: the name of a predefined formatter
+//     (gofmt, gofumpt, or prettier),
+//     or a mapping with List and Fix fields,
+//     each of which is a command and its arguments as a sequence of strings
+//   - Files: the files to format, interpreted with [YAMLFileList]
+//   - Fix: a boolean, true for fix mode and false for check mode
+func Format(formatter Formatter, files []string, fix bool) Target {
+	sorted := append([]string{}, files...)
+	sort.Strings(sorted)
+
+	return Check(&formatTarget{
+		Formatter: formatter,
+		Files:     sorted,
+		Fix:       fix,
+	}, sorted)
+}
+
+type formatTarget struct {
+	Formatter Formatter `json:"formatter"`
+	Files     []string  `json:"files"`
+	Fix       bool      `json:"fix,omitempty"`
+}
+
+var (
+	_ Target         = &formatTarget{}
+	_ FileRestricter = &formatTarget{}
+)
+
+// Run implements Target.Run.
+func (f *formatTarget) Run(ctx context.Context, con *Controller) error {
+	if len(f.Files) == 0 {
+		return nil
+	}
+	if len(f.Formatter.List) == 0 {
+		return fmt.Errorf("formatter has no List command")
+	}
+
+	fix, only, err := fixMode(ctx, "Format", f.Fix)
+	if err != nil {
+		return err
+	}
+	files := onlyFiles(f.Files, only)
+	if len(files) == 0 {
+		return nil
+	}
+
+	unformatted, err := f.list(ctx, files)
+	if err != nil {
+		return err
+	}
+	if len(unformatted) == 0 {
+		return nil
+	}
+
+	if !fix {
+		return UnformattedError{Files: unformatted}
+	}
+
+	if len(f.Formatter.Fix) == 0 {
+		return fmt.Errorf("formatter has no Fix command")
+	}
+
+	if GetDryRun(ctx) {
+		if GetVerbose(ctx) {
+			con.Indentf("  would reformat %v", unformatted)
+		}
+		return nil
+	}
+	if GetVerbose(ctx) {
+		con.Indentf("  reformatting %v", unformatted)
+	}
+
+	args := append(f.Formatter.Fix[1:len(f.Formatter.Fix):len(f.Formatter.Fix)], unformatted...)
+	cmd := exec.CommandContext(ctx, f.Formatter.Fix[0], args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return CommandErr{Err: err, Output: output}
+	}
+	return nil
+}
+
+// Restriction implements FileRestricter.
+func (f *formatTarget) Restriction(ctx context.Context) ([]string, error) {
+	_, only, err := fixMode(ctx, "Format", f.Fix)
+	return only, err
+}
+
+func (f *formatTarget) list(ctx context.Context, files []string) ([]string, error) {
+	var (
+		args           = append(f.Formatter.List[1:len(f.Formatter.List):len(f.Formatter.List)], files...)
+		cmd            = exec.CommandContext(ctx, f.Formatter.List[0], args...)
+		stdout, stderr bytes.Buffer
+	)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	err := cmd.Run()
+
+	var result []string
+	sc := bufio.NewScanner(&stdout)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			result = append(result, line)
+		}
+	}
+	if err != nil && len(result) == 0 {
+		// Some formatters exit non-zero when they find unformatted files,
+		// so only consider it an error when nothing was listed.
+		return nil, CommandErr{Err: err, Output: stderr.Bytes()}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// fixMode returns the fix-or-check mode for a target,
+// which is dflt unless overridden by a -fix or -check flag in the target's args
+// (see [ArgTarget]).
+// It also returns any files named in the args,
+// to which the target should restrict itself
+// (see [ParseFileArgs] and [onlyFiles]).
+func fixMode(ctx context.Context, name string, dflt bool) (bool, []string, error) {
+	args := GetArgs(ctx)
+	if len(args) == 0 {
+		return dflt, nil, nil
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fixFlag := fs.Bool("fix", false, "fix mode")
+	checkFlag := fs.Bool("check", false, "check mode")
+	only, err := ParseFileArgs(fs, args)
+	if err != nil {
+		return false, nil, err
+	}
+	switch {
+	case *fixFlag && *checkFlag:
+		return false, nil, fmt.Errorf("-fix and -check are mutually exclusive")
+	case *fixFlag:
+		return true, only, nil
+	case *checkFlag:
+		return false, only, nil
+	}
+	return dflt, only, nil
+}
+
+// onlyFiles returns the members of files that are named in only,
+// or all of files if only is empty.
+// This lets a target that operates on a list of files
+// be restricted to some of them,
+// as by a [PreCommit] target.
+func onlyFiles(files, only []string) []string {
+	if len(only) == 0 {
+		return files
+	}
+	named := set.New[string]()
+	for _, file := range only {
+		if abs, err := filepath.Abs(file); err == nil {
+			named.Add(abs)
+		}
+	}
+	var result []string
+	for _, file := range files {
+		if abs, err := filepath.Abs(file); err == nil && named.Has(abs) {
+			result = append(result, file)
+		}
+	}
+	return result
+}
+
+// Desc implements Target.Desc.
+func (*formatTarget) Desc() string {
+	return "Format"
+}
+
+// UnformattedError is the type of error produced by a [Format] target in check mode
+// when some files are not properly formatted.
+type UnformattedError struct {
+	Files []string
+}
+
+func (e UnformattedError) Error() string {
+	return fmt.Sprintf("unformatted file(s): %s", strings.Join(e.Files, " "))
+}
+
+func formatDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var yformat struct {
+		Formatter yaml.Node `yaml:"Formatter"`
+		Files     yaml.Node `yaml:"Files"`
+		Fix       bool      `yaml:"Fix"`
+	}
+	if err := node.Decode(&yformat); err != nil {
+		return nil, errors.Wrap(err, "YAML error in Format node")
+	}
+
+	formatter, err := YAMLFormatter(&yformat.Formatter)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Format.Formatter node")
+	}
+
+	files, err := con.YAMLFileList(&yformat.Files, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Format.Files node")
+	}
+
+	return Format(formatter, files, yformat.Fix), nil
+}
+
+// YAMLFormatter parses a [Formatter] from a YAML node.
+// The node may be a scalar naming a predefined formatter
+// (gofmt, gofumpt, or prettier),
+// or a mapping with List and Fix fields,
+// each of which is a sequence of strings.
+func YAMLFormatter(node *yaml.Node) (Formatter, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		formatter, ok := formatters[node.Value]
+		if !ok {
+			return Formatter{}, fmt.Errorf("unknown formatter %s", node.Value)
+		}
+		return formatter, nil
+
+	case yaml.MappingNode:
+		var yf struct {
+			List []string `yaml:"List"`
+			Fix  []string `yaml:"Fix"`
+		}
+		if err := node.Decode(&yf); err != nil {
+			return Formatter{}, errors.Wrap(err, "decoding formatter")
+		}
+		if len(yf.List) == 0 {
+			return Formatter{}, fmt.Errorf("formatter has no List command")
+		}
+		return Formatter{List: yf.List, Fix: yf.Fix}, nil
+
+	default:
+		return Formatter{}, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.ScalarNode | yaml.MappingNode}
+	}
+}
+
+func init() {
+	RegisterYAMLTarget("Format", formatDecoder)
+	SetYAMLTagDoc("Format", "Check or fix the formatting of files with a formatting command.")
+}
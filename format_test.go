@@ -0,0 +1,187 @@
+package fab
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+	"gopkg.in/yaml.v3"
+)
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		good = filepath.Join(tmpdir, "good.go")
+		bad  = filepath.Join(tmpdir, "bad.go")
+	)
+	if err = os.WriteFile(good, []byte("package x\n\nvar X = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(bad, []byte("package x\nvar  Y=2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	ctx = WithVerbose(ctx, testing.Verbose())
+	ctx = WithHashDB(ctx, memdb(set.New[string]()))
+
+	files := []string{good, bad}
+
+	t.Run("check", func(t *testing.T) {
+		con := NewController("")
+		err := con.Run(ctx, Format(Gofmt, files, false))
+
+		var uerr UnformattedError
+		if !errors.As(err, &uerr) {
+			t.Fatalf("got error %v, want UnformattedError", err)
+		}
+		if !reflect.DeepEqual(uerr.Files, []string{bad}) {
+			t.Errorf("got unformatted files %v, want [%s]", uerr.Files, bad)
+		}
+	})
+
+	t.Run("fix_via_args", func(t *testing.T) {
+		con := NewController("")
+		if err := con.Run(ctx, ArgTarget(Format(Gofmt, files, false), "-fix")); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(bad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "package x\n\nvar Y = 2\n"; string(got) != want {
+			t.Errorf("got %q, want %q", string(got), want)
+		}
+	})
+
+	t.Run("check_after_fix", func(t *testing.T) {
+		con := NewController("")
+		if err := con.Run(ctx, Format(Gofmt, files, false)); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("skipped_when_unchanged", func(t *testing.T) {
+		// A formatter that records each invocation and lists no files.
+		marker := filepath.Join(tmpdir, "marker")
+		counter := Formatter{List: []string{"sh", "-c", "echo run >> " + marker}}
+		for i := 0; i < 2; i++ {
+			con := NewController("")
+			if err := con.Run(ctx, Format(counter, files, false)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := os.ReadFile(marker)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(string(got), "run"); n != 1 {
+			t.Errorf("formatter ran %d times, want 1", n)
+		}
+	})
+}
+
+func TestFormatRestricted(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		good = filepath.Join(tmpdir, "good.go")
+		bad  = filepath.Join(tmpdir, "bad.go")
+	)
+	if err = os.WriteFile(good, []byte("package x\n\nvar X = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(bad, []byte("package x\nvar  Y=2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	ctx = WithVerbose(ctx, testing.Verbose())
+	ctx = WithHashDB(ctx, memdb(set.New[string]()))
+
+	files := []string{good, bad}
+
+	// A run restricted to the formatted file succeeds...
+	con := NewController("")
+	if err := con.Run(ctx, ArgTarget(Format(Gofmt, files, false), "--", good)); err != nil {
+		t.Fatal(err)
+	}
+
+	// ...but doesn't make a full run up to date.
+	con = NewController("")
+	err = con.Run(ctx, Format(Gofmt, files, false))
+
+	var uerr UnformattedError
+	if !errors.As(err, &uerr) {
+		t.Fatalf("got error %v, want UnformattedError", err)
+	}
+	if !reflect.DeepEqual(uerr.Files, []string{bad}) {
+		t.Errorf("got unformatted files %v, want [%s]", uerr.Files, bad)
+	}
+}
+
+func TestYAMLFormatter(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		yml     string
+		want    Formatter
+		wantErr bool
+	}{{
+		yml:  "gofumpt",
+		want: Gofumpt,
+	}, {
+		yml:  "{List: [black, --check, -q], Fix: [black, -q]}",
+		want: Formatter{List: []string{"black", "--check", "-q"}, Fix: []string{"black", "-q"}},
+	}, {
+		yml:     "nosuchformatter",
+		wantErr: true,
+	}, {
+		yml:     "{Fix: [black]}",
+		wantErr: true,
+	}, {
+		yml:     "[gofmt]",
+		wantErr: true,
+	}}
+
+	for i, tc := range cases {
+		tc := tc
+		t.Run(strings.ReplaceAll(tc.yml, "/", "_"), func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tc.yml), &doc); err != nil {
+				t.Fatal(err)
+			}
+			got, err := YAMLFormatter(doc.Content[0])
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("case %d: got no error but wanted one", i)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("case %d: got %+v, want %+v", i, got, tc.want)
+			}
+		})
+	}
+}
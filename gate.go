@@ -35,3 +35,10 @@ func (g *gate) wait() {
 	}
 	g.c.L.Unlock()
 }
+
+// Tells whether the gate is open.
+func (g *gate) isOpen() bool {
+	g.c.L.Lock()
+	defer g.c.L.Unlock()
+	return g.open
+}
@@ -0,0 +1,162 @@
+package fab
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Generate creates a target for running a code generator -
+// sqlc, protoc, stringer, etc. -
+// that produces the output files `out` from the input files `in`.
+//
+// It works like [Files],
+// with one addition:
+// after the subtarget runs,
+// Generate verifies that it actually wrote each of the output files
+// (which may include directories).
+// An output file that does not exist
+// (or an output directory that is empty),
+// or one that exists but was not written
+// (its modification time and size are unchanged),
+// is an error.
+// This catches generators that exit successfully
+// after silently writing nothing,
+// e.g. because of a misconfigured output path.
+// In verbose mode,
+// Generate reports which outputs changed
+// and which were rewritten with the same content.
+//
+// As with Files,
+// the subtarget must be of a type that can be JSON-marshaled.
+// Any opts are applied as they are in Files.
+//
+// A Generate target may be specified in YAML using the !Generate tag,
+// which introduces a mapping whose fields are:
+//
+//   - Target: the nested subtarget, or target name
+//   - In: the list of input files, interpreted with [YAMLFilesList]
+//   - Out: the list of output files, interpreted with [YAMLFilesList]
+//   - Autoclean: a boolean
+//
+// Example:
+//
+//	Queries: !Generate
+//	  Target: !Command
+//	    Shell: sqlc generate
+//	  In: [sqlc.yaml, query.sql, schema.sql]
+//	  Out: [db/query.sql.go, db/models.go]
+func Generate(target Target, in, out []string, opts ...FilesOpt) Target {
+	result := Files(&generate{Target: target, Out: out}, in, out, opts...)
+	result.(*files).desc = "Generate"
+	return result
+}
+
+type generate struct {
+	Target Target
+	Out    []string
+}
+
+var _ Target = &generate{}
+
+// Run implements Target.Run.
+func (g *generate) Run(ctx context.Context, con *Controller) error {
+	if GetDryRun(ctx) {
+		return con.Run(ctx, g.Target)
+	}
+
+	var (
+		stamps = make([]inputSnapshot, len(g.Out))
+		hashes = make([][]string, len(g.Out))
+	)
+	for i, out := range g.Out {
+		var err error
+		if stamps[i], err = snapshotInputs([]string{out}); err != nil {
+			return errors.Wrapf(err, "noting output %s", out)
+		}
+		if hashes[i], err = fileHashes(ctx, []string{out}); err != nil {
+			return errors.Wrapf(err, "hashing output %s", out)
+		}
+	}
+
+	if err := con.Run(ctx, g.Target); err != nil {
+		return err
+	}
+
+	var result error
+	for i, out := range g.Out {
+		after, err := snapshotInputs([]string{out})
+		if err != nil {
+			return errors.Wrapf(err, "checking output %s", out)
+		}
+		if len(after) == 0 {
+			// The file does not exist, or is an empty directory.
+			result = errors.Join(result, fmt.Errorf("generator did not produce %s", out))
+			continue
+		}
+		if len(stamps[i].changed(after)) == 0 {
+			result = errors.Join(result, fmt.Errorf("generator did not write %s", out))
+			continue
+		}
+		if !GetVerbose(ctx) {
+			continue
+		}
+		h, err := fileHashes(ctx, []string{out})
+		if err != nil {
+			return errors.Wrapf(err, "hashing output %s", out)
+		}
+		if reflect.DeepEqual(h, hashes[i]) {
+			con.Indentf("  %s unchanged", out)
+		} else {
+			con.Indentf("  %s changed", out)
+		}
+	}
+
+	return result
+}
+
+// Desc implements Target.Desc.
+func (*generate) Desc() string {
+	return "Generate"
+}
+
+func generateDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var ygen struct {
+		In        yaml.Node `yaml:"In"`
+		Out       yaml.Node `yaml:"Out"`
+		Target    yaml.Node `yaml:"Target"`
+		Autoclean bool      `yaml:"Autoclean"`
+	}
+	if err := node.Decode(&ygen); err != nil {
+		return nil, errors.Wrap(err, "YAML error in Generate node")
+	}
+
+	target, err := con.YAMLTarget(&ygen.Target, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Target child of Generate node")
+	}
+
+	in, err := con.YAMLFileList(&ygen.In, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Generate.In node")
+	}
+
+	out, err := con.YAMLFileList(&ygen.Out, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Generate.Out node")
+	}
+
+	return Generate(target, in, out, Autoclean(ygen.Autoclean)), nil
+}
+
+func init() {
+	RegisterYAMLTarget("Generate", generateDecoder)
+	SetYAMLTagDoc("Generate", "Run a code generator and verify that it wrote its outputs.")
+}
@@ -0,0 +1,62 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		ctx  = context.Background()
+		in   = filepath.Join(tmpdir, "in")
+		out1 = filepath.Join(tmpdir, "gen", "out1")
+		out2 = filepath.Join(tmpdir, "gen", "out2")
+	)
+	if err := os.WriteFile(in, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		shell   string
+		wantErr string
+	}{{
+		name:  "ok",
+		shell: "cp in gen/out1; cp in gen/out2",
+	}, {
+		name:  "unchanged_content",
+		shell: "cp in gen/out1; cp in gen/out2",
+	}, {
+		name:    "missing",
+		shell:   "rm gen/out2; cp in gen/out1",
+		wantErr: "did not produce " + out2,
+	}, {
+		name:    "not_written",
+		shell:   "echo y > gen/out2",
+		wantErr: "did not write " + out1,
+	}}
+
+	for _, tc := range cases {
+		c := &Command{Shell: tc.shell, Dir: tmpdir}
+		err := NewController("").Run(ctx, Generate(c, []string{in}, []string{out1, out2}))
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: %s", tc.name, err)
+		case tc.wantErr != "" && err == nil:
+			t.Errorf("%s: got no error, want %q", tc.name, tc.wantErr)
+		case tc.wantErr != "" && !strings.Contains(err.Error(), tc.wantErr):
+			t.Errorf("%s: got error %q, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package fab
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+)
+
+// Glob returns the names of the files and directories in dir
+// matching the given patterns.
+// The names are joined with dir.
+//
+// Each pattern is as for [path.Match],
+// with slash separators,
+// with two extensions:
+// a path element of ** matches zero or more path elements,
+// as in **/*.go;
+// and a comma-separated list in braces matches any of its alternatives,
+// as in *.{c,h}.
+//
+// A pattern beginning with ! is a negative pattern.
+// It removes the names matching it
+// from the matches of the patterns before it,
+// as in:
+//
+//	fab.Glob("src", "**/*.go", "!**/*_test.go")
+//
+// Matches are listed in the order of the patterns that produce them,
+// sorted for each pattern,
+// without duplicates.
+//
+// In YAML,
+// the same patterns may be given in a sequence tagged !Glob.
+// A negative pattern must be quoted,
+// since an unquoted ! introduces a YAML tag:
+//
+//	In: !Glob
+//	  - "**/*.go"
+//	  - "!**/*_test.go"
+func Glob(dir string, patterns ...string) ([]string, error) {
+	if dir == "" {
+		dir = "."
+	}
+	matches, err := globFS(os.DirFS(dir), patterns)
+	if err != nil {
+		return nil, err
+	}
+	for i, m := range matches {
+		matches[i] = filepath.Join(dir, filepath.FromSlash(m))
+	}
+	return matches, nil
+}
+
+// globFS is the implementation of [Glob],
+// producing slash-separated names relative to the root of fsys.
+func globFS(fsys fs.FS, patterns []string) ([]string, error) {
+	var (
+		result []string
+		seen   = set.New[string]()
+	)
+	for _, pattern := range patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		if negate {
+			pattern = pattern[1:]
+		}
+		for _, p := range expandBraces(pattern) {
+			if negate {
+				var kept []string
+				for _, name := range result {
+					ok, err := matchGlob(p, name)
+					if err != nil {
+						return nil, errors.Wrapf(err, "in pattern %s", pattern)
+					}
+					if ok {
+						seen.Del(name)
+					} else {
+						kept = append(kept, name)
+					}
+				}
+				result = kept
+				continue
+			}
+
+			matches, err := globOne(fsys, p)
+			if err != nil {
+				return nil, errors.Wrapf(err, "in pattern %s", pattern)
+			}
+			for _, m := range matches {
+				if !seen.Has(m) {
+					seen.Add(m)
+					result = append(result, m)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// globOne returns the sorted names in fsys matching a single pattern,
+// which has no braces.
+func globOne(fsys fs.FS, pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		return fs.Glob(fsys, pattern)
+	}
+
+	// Walk from the longest leading part of the pattern with no metacharacters.
+	var (
+		elems = strings.Split(pattern, "/")
+		root  = "."
+	)
+	for i, elem := range elems[:len(elems)-1] {
+		if strings.ContainsAny(elem, `*?[\`) {
+			break
+		}
+		root = path.Join(elems[:i+1]...)
+	}
+
+	var result []string
+	err := fs.WalkDir(fsys, root, func(name string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			if name == root && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		ok, err := matchGlob(pattern, name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			result = append(result, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// expandBraces expands the first brace-enclosed, comma-separated list in pattern,
+// and recursively any others,
+// into a list of patterns without braces.
+// Braces may be nested,
+// as in {a,b{c,d}}.
+// A pattern with unbalanced braces is returned as is.
+func expandBraces(pattern string) []string {
+	start := strings.Index(pattern, "{")
+	if start < 0 {
+		return []string{pattern}
+	}
+
+	var (
+		depth = 0
+		alts  []string
+		last  = start + 1
+	)
+	for i := start; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case ',':
+			if depth == 1 {
+				alts = append(alts, pattern[last:i])
+				last = i + 1
+			}
+		case '}':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			alts = append(alts, pattern[last:i])
+			var (
+				prefix = pattern[:start]
+				suffix = pattern[i+1:]
+				result []string
+			)
+			for _, alt := range alts {
+				result = append(result, expandBraces(prefix+alt+suffix)...)
+			}
+			return result
+		}
+	}
+	return []string{pattern}
+}
+
+// matchGlob tells whether name,
+// a slash-separated path,
+// matches pattern.
+// The pattern is as for [path.Match],
+// except that a path element of ** matches zero or more path elements,
+// as in **/*.swp or node_modules/**.
+func matchGlob(pattern, name string) (bool, error) {
+	return matchGlobElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobElems(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if ok, err := matchGlobElems(pattern[1:], name[i:]); err != nil || ok {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
@@ -0,0 +1,106 @@
+package fab
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.swp", "a.swp", true},
+		{"*.swp", "x/a.swp", false},
+		{"**/*.swp", "a.swp", true},
+		{"**/*.swp", "x/y/a.swp", true},
+		{"**/*.swp", "x/y/a.go", false},
+		{"node_modules/**", "node_modules", true},
+		{"node_modules/**", "node_modules/a/b.js", true},
+		{"node_modules/**", "src/node_modules/a.js", false},
+		{"**/node_modules/**", "src/node_modules/a.js", true},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/y/c", false},
+		{"a/?/c", "a/b/c", true},
+	}
+	for _, c := range cases {
+		got, err := matchGlob(c.pattern, c.name)
+		if err != nil {
+			t.Errorf("matchGlob(%q, %q): %s", c.pattern, c.name, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+
+	if _, err := matchGlob("[", "x"); err == nil {
+		t.Error("got no error for bad pattern")
+	}
+}
+
+func TestExpandBraces(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		pattern string
+		want    []string
+	}{
+		{"a.go", []string{"a.go"}},
+		{"*.{c,h}", []string{"*.c", "*.h"}},
+		{"{a,b}/{c,d}", []string{"a/c", "a/d", "b/c", "b/d"}},
+		{"x{a,b{c,d}}", []string{"xa", "xbc", "xbd"}},
+		{"x{a,b", []string{"x{a,b"}},
+	}
+	for _, c := range cases {
+		got := expandBraces(c.pattern)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("expandBraces(%q) = %v, want %v", c.pattern, got, c.want)
+		}
+	}
+}
+
+func TestGlobPatterns(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "a_test.go", "b.c", "b.h", "sub/c.go", "sub/c_test.go", "sub/deep/d.go"} {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		patterns []string
+		want     []string
+	}{
+		{[]string{"*.go"}, []string{"a.go", "a_test.go"}},
+		{[]string{"**/*.go", "!**/*_test.go"}, []string{"a.go", "sub/c.go", "sub/deep/d.go"}},
+		{[]string{"*.{c,h}"}, []string{"b.c", "b.h"}},
+		{[]string{"sub/**/*.go"}, []string{"sub/c.go", "sub/c_test.go", "sub/deep/d.go"}},
+		{[]string{"*.go", "**/a.go"}, []string{"a.go", "a_test.go"}},
+		{[]string{"missing/**"}, nil},
+	}
+	for _, c := range cases {
+		got, err := Glob(dir, c.patterns...)
+		if err != nil {
+			t.Fatalf("Glob(%v): %s", c.patterns, err)
+		}
+		var want []string
+		for _, w := range c.want {
+			want = append(want, filepath.Join(dir, filepath.FromSlash(w)))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Glob(%v) = %v, want %v", c.patterns, got, want)
+		}
+	}
+}
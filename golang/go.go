@@ -1,8 +1,13 @@
 package golang
 
 import (
+	"context"
+	"flag"
+	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/bobg/errors"
 	"github.com/bobg/go-generics/v2/set"
@@ -28,6 +33,7 @@ import (
 //   - Dir: the directory containing the main Go package
 //   - Out: the output file that will contain the compiled binary,
 //   - Flags: a sequence of additional command-line flags for `go build`
+//   - Stamp: a sequence of variables to set at link time (see [StampedBinary])
 //
 // Both Dir and Out are either absolute or relative to the directory containing the YAML file.
 // If Out is unspecified,
@@ -69,6 +75,7 @@ func binaryDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target
 		Dir   string    `yaml:"Dir"`
 		Out   string    `yaml:"Out"`
 		Flags yaml.Node `yaml:"Flags"`
+		Stamp yaml.Node `yaml:"Stamp"`
 	}
 
 	if err := node.Decode(&b); err != nil {
@@ -85,12 +92,456 @@ func binaryDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target
 		return nil, errors.Wrap(err, "YAML error decoding go.Binary.Flags")
 	}
 
+	if b.Stamp.Kind != 0 {
+		vars, err := yamlStampVars(&b.Stamp)
+		if err != nil {
+			return nil, errors.Wrap(err, "YAML error decoding go.Binary.Stamp")
+		}
+		return StampedBinary(con.JoinPath(dir, b.Dir), con.JoinPath(dir, out), vars, flags...)
+	}
+
 	return Binary(con.JoinPath(dir, b.Dir), con.JoinPath(dir, out), flags...)
 }
 
+// Test is a target that runs `go test` on the Go package in `dir`.
+// Additional command-line arguments for `go test` can be specified with `flags`.
+//
+// Test is implemented in terms of [fab.Files],
+// with the package's files and its tests' files
+// (as computed by [Deps] with tests=true)
+// as inputs,
+// and no outputs.
+// When the tests pass,
+// a record of that is added to the hash DB,
+// so they are not rerun until the package, its tests, or the flags change.
+//
+// A Test target may be specified in YAML using the tag !go.Test,
+// which introduces a mapping whose fields are:
+//
+//   - Dir: the directory containing the Go package,
+//     either absolute or relative to the directory containing the YAML file
+//   - Flags: a sequence of additional command-line flags for `go test`
+func Test(dir string, flags ...string) (fab.Target, error) {
+	deps, err := Deps(dir, false, true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "computing dependencies")
+	}
+	args := append([]string{"test"}, flags...)
+	args = append(args, ".")
+	c := &fab.Command{
+		Cmd:  "go",
+		Args: args,
+		Dir:  dir,
+	}
+	return fab.Files(c, deps, nil), nil
+}
+
+// MustTest is the same as [Test] but panics on error.
+func MustTest(dir string, flags ...string) fab.Target {
+	target, err := Test(dir, flags...)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+func testDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	var t struct {
+		Dir   string    `yaml:"Dir"`
+		Flags yaml.Node `yaml:"Flags"`
+	}
+
+	if err := node.Decode(&t); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding go.Test")
+	}
+
+	flags, err := con.YAMLStringList(&t.Flags, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding go.Test.Flags")
+	}
+
+	return Test(con.JoinPath(dir, t.Dir), flags...)
+}
+
+// Vet is a target that runs `go vet` on the Go package in `dir`,
+// or on the packages in the tree rooted there if recursive is true.
+// Additional command-line arguments for `go vet` can be specified with `flags`.
+//
+// Like [Test],
+// Vet is implemented in terms of [fab.Files]
+// with the packages' files
+// (including test files)
+// as inputs and no outputs,
+// so it reruns only when those files or the flags change.
+//
+// A Vet target may be specified in YAML using the tag !go.Vet,
+// which introduces a mapping whose fields are:
+//
+//   - Dir: the directory containing the Go package,
+//     either absolute or relative to the directory containing the YAML file
+//   - Recursive: a boolean, true for including subpackages
+//   - Flags: a sequence of additional command-line flags for `go vet`
+func Vet(dir string, recursive bool, flags ...string) (fab.Target, error) {
+	deps, err := Deps(dir, recursive, true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "computing dependencies")
+	}
+	arg := "."
+	if recursive {
+		arg = "./..."
+	}
+	args := append([]string{"vet"}, flags...)
+	args = append(args, arg)
+	c := &fab.Command{
+		Cmd:  "go",
+		Args: args,
+		Dir:  dir,
+	}
+	return fab.Files(c, deps, nil), nil
+}
+
+func vetDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	var v struct {
+		Dir       string    `yaml:"Dir"`
+		Recursive bool      `yaml:"Recursive"`
+		Flags     yaml.Node `yaml:"Flags"`
+	}
+
+	if err := node.Decode(&v); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding go.Vet")
+	}
+
+	flags, err := con.YAMLStringList(&v.Flags, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding go.Vet.Flags")
+	}
+
+	return Vet(con.JoinPath(dir, v.Dir), v.Recursive, flags...)
+}
+
+// LintConfigs are the golangci-lint configuration files
+// that [Lint] includes among its inputs
+// when they are present in the linted directory.
+var LintConfigs = []string{".golangci.yml", ".golangci.yaml", ".golangci.toml", ".golangci.json"}
+
+// Lint is a target that runs golangci-lint on the Go packages in the tree rooted at `dir`.
+// Additional command-line arguments for `golangci-lint run` can be specified with `flags`.
+//
+// Lint is implemented in terms of [fab.Files],
+// with the packages' files
+// (including test files)
+// and any golangci-lint configuration file in dir
+// (see [LintConfigs])
+// as inputs,
+// and no outputs.
+//
+// Lint can be restricted to some files
+// by naming them in its arguments
+// (see [fab.ParseFileArgs] and [fab.PreCommit]),
+// e.g. `fab Lint -- foo.go bar/baz.go`.
+// It then lints only the packages containing those of the files that are Go files in the tree,
+// and does nothing if there are none.
+// A restricted Lint always runs,
+// without consulting or updating the hash DB
+// (see [fab.FileRestricter]).
+//
+// A Lint target may be specified in YAML using the tag !go.Lint,
+// which introduces a mapping whose fields are:
+//
+//   - Dir: the directory at the root of the tree to lint,
+//     either absolute or relative to the directory containing the YAML file
+//   - Flags: a sequence of additional command-line flags for `golangci-lint run`
+func Lint(dir string, flags ...string) (fab.Target, error) {
+	deps, err := Deps(dir, true, true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "computing dependencies")
+	}
+	for _, config := range LintConfigs {
+		config = filepath.Join(dir, config)
+		if _, err := os.Stat(config); err == nil {
+			deps = append(deps, config)
+		}
+	}
+	return fab.Files(&lint{Dir: dir, Flags: flags}, deps, nil), nil
+}
+
+// lint is the subtarget of a [Lint] target.
+type lint struct {
+	Dir   string   `json:"dir"`
+	Flags []string `json:"flags,omitempty"`
+}
+
+var (
+	_ fab.Target         = &lint{}
+	_ fab.FileRestricter = &lint{}
+)
+
+// Run implements fab.Target.Run.
+func (l *lint) Run(ctx context.Context, con *fab.Controller) error {
+	only, err := l.Restriction(ctx)
+	if err != nil {
+		return err
+	}
+
+	pkgs := []string{"./..."}
+	if len(only) > 0 {
+		if pkgs, err = lintDirs(l.Dir, only); err != nil {
+			return err
+		}
+		if len(pkgs) == 0 {
+			if fab.GetVerbose(ctx) {
+				con.Indentf("  no Go files to lint")
+			}
+			return nil
+		}
+	}
+
+	args := append([]string{"run"}, l.Flags...)
+	args = append(args, pkgs...)
+	c := &fab.Command{
+		Cmd:  "golangci-lint",
+		Args: args,
+		Dir:  l.Dir,
+	}
+	return con.Run(ctx, c)
+}
+
+// Restriction implements fab.FileRestricter.
+func (*lint) Restriction(ctx context.Context) ([]string, error) {
+	fs := flag.NewFlagSet("Lint", flag.ContinueOnError)
+	return fab.ParseFileArgs(fs, fab.GetArgs(ctx))
+}
+
+// Desc implements fab.Target.Desc.
+func (*lint) Desc() string {
+	return "go.Lint"
+}
+
+// lintDirs returns the directories,
+// relative to dir and in the form ./x/y,
+// of the Go files among files that are in the tree rooted at dir.
+func lintDirs(dir string, files []string) ([]string, error) {
+	absdir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting absolute path of %s", dir)
+	}
+	dirs := set.New[string]()
+	for _, file := range files {
+		if filepath.Ext(file) != ".go" {
+			continue
+		}
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting absolute path of %s", file)
+		}
+		rel, err := filepath.Rel(absdir, filepath.Dir(abs))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if rel == "." {
+			dirs.Add(".")
+		} else {
+			dirs.Add("./" + filepath.ToSlash(rel))
+		}
+	}
+	result := dirs.Slice()
+	sort.Strings(result)
+	return result, nil
+}
+
+func lintDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	var l struct {
+		Dir   string    `yaml:"Dir"`
+		Flags yaml.Node `yaml:"Flags"`
+	}
+
+	if err := node.Decode(&l); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding go.Lint")
+	}
+
+	flags, err := con.YAMLStringList(&l.Flags, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding go.Lint.Flags")
+	}
+
+	return Lint(con.JoinPath(dir, l.Dir), flags...)
+}
+
+// Generate is a target that runs `go generate` on the Go package in `dir`,
+// producing the files in `outfiles`.
+// Additional command-line arguments for `go generate` can be specified with `flags`.
+//
+// Generate is implemented in terms of [fab.Files],
+// with outfiles as outputs
+// (which are automatically selected for "autocleaning,"
+// see [fab.Autoclean]).
+// The inputs are the package's files
+// plus the inputs of its //go:generate directives
+// (see [GenerateDeps]).
+//
+// A Generate target may be specified in YAML using the tag !go.Generate,
+// which introduces a mapping whose fields are:
+//
+//   - Dir: the directory containing the Go package
+//   - Out: a sequence of the files that `go generate` produces
+//   - Flags: a sequence of additional command-line flags for `go generate`
+//
+// Dir and the files in Out are either absolute or relative to the directory containing the YAML file.
+func Generate(dir string, outfiles []string, flags ...string) (fab.Target, error) {
+	deps, err := GenerateDeps(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "computing dependencies")
+	}
+
+	// A generated file may also be a file of the package.
+	// Don't count it as an input too.
+	outs := set.New[string]()
+	for _, outfile := range outfiles {
+		if abs, err := filepath.Abs(outfile); err == nil {
+			outs.Add(abs)
+		}
+	}
+	var in []string
+	for _, dep := range deps {
+		if abs, err := filepath.Abs(dep); err == nil && outs.Has(abs) {
+			continue
+		}
+		in = append(in, dep)
+	}
+
+	args := append([]string{"generate"}, flags...)
+	args = append(args, ".")
+	c := &fab.Command{
+		Cmd:  "go",
+		Args: args,
+		Dir:  dir,
+	}
+	return fab.Files(c, in, outfiles, fab.Autoclean(true)), nil
+}
+
+func generateDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	var g struct {
+		Dir   string    `yaml:"Dir"`
+		Out   yaml.Node `yaml:"Out"`
+		Flags yaml.Node `yaml:"Flags"`
+	}
+
+	if err := node.Decode(&g); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding go.Generate")
+	}
+
+	out, err := con.YAMLFileList(&g.Out, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding go.Generate.Out")
+	}
+
+	flags, err := con.YAMLStringList(&g.Flags, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding go.Generate.Flags")
+	}
+
+	return Generate(con.JoinPath(dir, g.Dir), out, flags...)
+}
+
+// GenerateDeps produces the list of files that `go generate` depends on
+// in the Go package in the given directory.
+// These are the package's own files
+// (including test files)
+// plus, for each //go:generate directive:
+//
+//   - any argument naming an existing file in the package directory;
+//   - the files of the generator itself,
+//     when it is a package or file in the same module run with `go run ./path`.
+//
+// Arguments containing $ (which refer to variables expanded by `go generate`)
+// are not examined.
+// The list is sorted for consistent, predictable results.
+func GenerateDeps(dir string) ([]string, error) {
+	config := &packages.Config{
+		Mode:  packages.NeedName | packages.NeedFiles,
+		Dir:   dir,
+		Tests: true,
+	}
+	pkgs, err := packages.Load(config, ".")
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading from %s", dir)
+	}
+
+	files := set.New[string]()
+	for _, pkg := range pkgs {
+		if strings.HasSuffix(pkg.ID, ".test") {
+			// Skip the synthesized test-main package.
+			continue
+		}
+		files.Add(pkg.GoFiles...)
+		files.Add(pkg.OtherFiles...)
+	}
+
+	for _, gofile := range files.Slice() {
+		if err := generateDirectiveDeps(gofile, files); err != nil {
+			return nil, errors.Wrapf(err, "in %s", gofile)
+		}
+	}
+
+	slice := files.Slice()
+	sort.Strings(slice)
+	return slice, nil
+}
+
+// generateDirectiveDeps adds to files the inputs of the //go:generate directives in gofile.
+// Like `go generate`,
+// it interprets relative paths with respect to the directory containing gofile.
+func generateDirectiveDeps(gofile string, files set.Of[string]) error {
+	dir := filepath.Dir(gofile)
+
+	data, err := os.ReadFile(gofile)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s", gofile)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		directive, ok := strings.CutPrefix(line, "//go:generate ")
+		if !ok {
+			continue
+		}
+		words := strings.Fields(directive)
+
+		if len(words) > 2 && words[0] == "go" && words[1] == "run" {
+			for _, word := range words[2:] {
+				if strings.HasPrefix(word, "-") {
+					continue
+				}
+				// A generator that is a .go file in dir is handled below.
+				if strings.HasPrefix(word, ".") && !strings.HasSuffix(word, ".go") {
+					deps, err := Deps(filepath.Join(dir, word), false, false)
+					if err != nil {
+						return errors.Wrapf(err, "computing dependencies of generator %s", word)
+					}
+					files.Add(deps...)
+				}
+				break
+			}
+		}
+
+		for _, word := range words[1:] {
+			if strings.Contains(word, "$") {
+				continue
+			}
+			path := filepath.Join(dir, word)
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				files.Add(path)
+			}
+		}
+	}
+
+	return nil
+}
+
 // Deps produces the list of files involved in building the Go package in the given directory.
 // It traverses package dependencies transitively,
 // but only within the original package's module.
+// It includes files matched by go:embed patterns
+// (see embedFiles for some differences from the go tool).
 // The list is sorted for consistent, predictable results.
 func Deps(dir string, recursive, tests bool) ([]string, error) {
 	config := &packages.Config{
@@ -111,6 +562,11 @@ func Deps(dir string, recursive, tests bool) ([]string, error) {
 
 	for _, pkg := range pkgs {
 		for _, e := range pkg.Errors {
+			if isMissingEmbedError(pkg, e) {
+				// The embedded file may be generated by another target.
+				// See embedFiles.
+				continue
+			}
 			err = errors.Join(err, e)
 		}
 	}
@@ -141,12 +597,15 @@ func gopkgAdd(pkg *packages.Package, modpath string, files set.Of[string]) error
 	files.Add(pkg.CompiledGoFiles...)
 	files.Add(pkg.OtherFiles...)
 	files.Add(pkg.EmbedFiles...)
-	for _, pattern := range pkg.EmbedPatterns {
-		matches, err := filepath.Glob(pattern)
-		if err != nil {
-			return errors.Wrapf(err, "in pattern %s", pattern)
+	if len(pkg.EmbedPatterns) > 0 {
+		dir := pkgDir(pkg)
+		for _, pattern := range pkg.EmbedPatterns {
+			matches, err := embedFiles(dir, pattern)
+			if err != nil {
+				return errors.Wrapf(err, "in pattern %s", pattern)
+			}
+			files.Add(matches...)
 		}
-		files.Add(matches...)
 	}
 	for _, imp := range pkg.Imports {
 		if err := gopkgAdd(imp, modpath, files); err != nil {
@@ -156,6 +615,237 @@ func gopkgAdd(pkg *packages.Package, modpath string, files set.Of[string]) error
 	return nil
 }
 
+// pkgDir returns the directory of the given package.
+func pkgDir(pkg *packages.Package) string {
+	for _, list := range [][]string{pkg.GoFiles, pkg.OtherFiles, pkg.CompiledGoFiles} {
+		if len(list) > 0 {
+			return filepath.Dir(list[0])
+		}
+	}
+	return ""
+}
+
+// embedFiles returns the files matching the go:embed pattern
+// in the package directory dir.
+// As in Go,
+// a matching directory contributes the files in it,
+// recursively,
+// except for those whose names begin with . or _
+// (unless the pattern begins with all:).
+// Unlike in Go,
+// symbolic links to directories are followed.
+//
+// A pattern without wildcards that matches nothing
+// is assumed to name a file that is generated by some other target,
+// so it is included as is.
+// This lets [fab.Files] find the target that produces it.
+func embedFiles(dir, pattern string) ([]string, error) {
+	pattern = embedPattern(dir, pattern)
+	all := strings.HasPrefix(pattern, "all:")
+	pattern = strings.TrimPrefix(pattern, "all:")
+
+	full := filepath.Join(dir, filepath.FromSlash(pattern))
+	matches, err := filepath.Glob(full)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 && !strings.ContainsAny(pattern, `*?[\`) {
+		return []string{full}, nil
+	}
+
+	var (
+		result []string
+		seen   = set.New[string]() // directories visited, to avoid symlink cycles
+	)
+
+	var walk func(string) error
+	walk = func(path string) error {
+		info, err := os.Stat(path) // follows symlinks
+		if err != nil {
+			return errors.Wrapf(err, "statting %s", path)
+		}
+		if !info.IsDir() {
+			result = append(result, path)
+			return nil
+		}
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return errors.Wrapf(err, "resolving %s", path)
+		}
+		if seen.Has(real) {
+			return nil
+		}
+		seen.Add(real)
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return errors.Wrapf(err, "reading directory %s", path)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !all && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				continue
+			}
+			if err := walk(filepath.Join(path, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, match := range matches {
+		if err := walk(match); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// embedPattern returns the go:embed pattern as written in the source of the package in dir.
+// The packages library reports patterns as absolute paths,
+// even ones beginning with all:.
+func embedPattern(dir, pattern string) string {
+	if !filepath.IsAbs(pattern) {
+		return pattern
+	}
+	rel, err := filepath.Rel(dir, pattern)
+	if err != nil {
+		return pattern
+	}
+	return filepath.ToSlash(rel)
+}
+
+// isMissingEmbedError tells whether e is the error
+// for a go:embed pattern in pkg that matches no files.
+func isMissingEmbedError(pkg *packages.Package, e packages.Error) bool {
+	dir := pkgDir(pkg)
+	for _, pattern := range pkg.EmbedPatterns {
+		pattern = embedPattern(dir, pattern)
+		if strings.Contains(e.Msg, "pattern "+pattern+": no matching files found") {
+			return true
+		}
+	}
+	return false
+}
+
+// Format produces a target that checks or fixes the formatting of the Go files
+// (including test files)
+// in the package in the given directory,
+// or in the tree rooted there if recursive is true.
+// The formatter is normally [fab.Gofmt] or [fab.Gofumpt].
+// See [fab.Format] for details about check and fix modes.
+//
+// A Format target may be specified in YAML using the tag !go.Format,
+// which introduces a mapping whose fields are:
+//
+//   - Dir: the directory containing the Go package,
+//     either absolute or relative to the directory containing the YAML file
+//   - Recursive: a boolean, true for including subpackages
+//   - Formatter: as in !Format (see [fab.YAMLFormatter]); the default is gofmt
+//   - Fix: a boolean, true for fix mode and false for check mode
+func Format(dir string, recursive bool, formatter fab.Formatter, fix bool) (fab.Target, error) {
+	config := &packages.Config{
+		Mode:  packages.NeedName | packages.NeedFiles,
+		Dir:   dir,
+		Tests: true,
+	}
+
+	arg := "."
+	if recursive {
+		arg = "./..."
+	}
+
+	pkgs, err := packages.Load(config, arg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading from %s", dir)
+	}
+
+	files := set.New[string]()
+	for _, pkg := range pkgs {
+		if strings.HasSuffix(pkg.ID, ".test") {
+			// Skip the synthesized test-main package.
+			continue
+		}
+		files.Add(pkg.GoFiles...)
+	}
+
+	return fab.Format(formatter, files.Slice(), fix), nil
+}
+
+func formatDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	var f struct {
+		Dir       string    `yaml:"Dir"`
+		Recursive bool      `yaml:"Recursive"`
+		Formatter yaml.Node `yaml:"Formatter"`
+		Fix       bool      `yaml:"Fix"`
+	}
+
+	if err := node.Decode(&f); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding go.Format")
+	}
+
+	formatter := fab.Gofmt
+	if f.Formatter.Kind != 0 {
+		var err error
+		if formatter, err = fab.YAMLFormatter(&f.Formatter); err != nil {
+			return nil, errors.Wrap(err, "YAML error decoding go.Format.Formatter")
+		}
+	}
+
+	return Format(con.JoinPath(dir, f.Dir), f.Recursive, formatter, f.Fix)
+}
+
+// VulncheckPeriod is the period used by [Vulncheck].
+var VulncheckPeriod = 24 * time.Hour
+
+// Vulncheck produces a target that runs govulncheck
+// on the Go packages in the tree rooted at the given directory.
+// Additional command-line arguments for govulncheck can be specified with `flags`.
+//
+// Vulncheck is implemented in terms of [fab.Periodic],
+// with inputs that include go.mod and go.sum.
+// So the scan reruns when the code or its dependencies change,
+// and otherwise once per [VulncheckPeriod]
+// to pick up new entries in the vulnerability database.
+//
+// A Vulncheck target may be specified in YAML using the tag !go.Vulncheck,
+// which introduces a mapping whose fields are:
+//
+//   - Dir: the directory at the root of the tree to scan,
+//     either absolute or relative to the directory containing the YAML file
+//   - Flags: a sequence of additional command-line flags for govulncheck
+func Vulncheck(dir string, flags ...string) (fab.Target, error) {
+	deps, err := Deps(dir, true, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "computing dependencies")
+	}
+	args := append(flags[:len(flags):len(flags)], "./...")
+	c := &fab.Command{
+		Cmd:  "govulncheck",
+		Args: args,
+		Dir:  dir,
+	}
+	return fab.Periodic(c, deps, VulncheckPeriod), nil
+}
+
+func vulncheckDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	var v struct {
+		Dir   string    `yaml:"Dir"`
+		Flags yaml.Node `yaml:"Flags"`
+	}
+
+	if err := node.Decode(&v); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding go.Vulncheck")
+	}
+
+	flags, err := con.YAMLStringList(&v.Flags, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding go.Vulncheck.Flags")
+	}
+
+	return Vulncheck(con.JoinPath(dir, v.Dir), flags...)
+}
+
 func depsDecoder(con *fab.Controller, node *yaml.Node, dir string) ([]string, error) {
 	var gd struct {
 		Dir       string `yaml:"Dir"`
@@ -172,5 +862,19 @@ func depsDecoder(con *fab.Controller, node *yaml.Node, dir string) ([]string, er
 
 func init() {
 	fab.RegisterYAMLTarget("go.Binary", binaryDecoder)
+	fab.SetYAMLTagDoc("go.Binary", "Compile a Go binary.")
+	fab.RegisterYAMLTarget("go.Format", formatDecoder)
+	fab.SetYAMLTagDoc("go.Format", "Check or fix the formatting of Go files.")
+	fab.RegisterYAMLTarget("go.Generate", generateDecoder)
+	fab.SetYAMLTagDoc("go.Generate", "Run go generate, producing the given output files.")
+	fab.RegisterYAMLTarget("go.Lint", lintDecoder)
+	fab.SetYAMLTagDoc("go.Lint", "Run golangci-lint on a tree of Go packages.")
+	fab.RegisterYAMLTarget("go.Test", testDecoder)
+	fab.SetYAMLTagDoc("go.Test", "Run go test on a Go package.")
+	fab.RegisterYAMLTarget("go.Vet", vetDecoder)
+	fab.SetYAMLTagDoc("go.Vet", "Run go vet on a Go package.")
+	fab.RegisterYAMLTarget("go.Vulncheck", vulncheckDecoder)
+	fab.SetYAMLTagDoc("go.Vulncheck", "Run govulncheck on a tree of Go packages, rerunning periodically.")
 	fab.RegisterYAMLStringList("go.Deps", depsDecoder)
+	fab.SetYAMLTagDoc("go.Deps", "List the files that a Go package depends on.")
 }
@@ -5,9 +5,12 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"sort"
+	"strings"
 	"testing"
 
+	"github.com/bobg/go-generics/v2/set"
 	"github.com/bobg/go-generics/v2/slices"
 	"github.com/otiai10/copy"
 
@@ -55,61 +58,370 @@ func TestBinary(t *testing.T) {
 }
 
 var testGoDeps = []string{
+	"../aliases.go",
+	"../aliases_test.go",
 	"../all.go",
 	"../all_test.go",
+	"../archive.go",
+	"../archive_test.go",
 	"../argtarg.go",
 	"../argtarg_test.go",
+	"../artifacts.go",
+	"../artifacts_test.go",
+	"../audit.go",
+	"../audit_test.go",
 	"../badyaml_test.go",
+	"../capability.go",
+	"../capability_test.go",
+	"../check.go",
+	"../check_test.go",
 	"../clean.go",
 	"../clean_test.go",
+	"../cleanenv.go",
+	"../cleanenv_test.go",
+	"../cmdoutput.go",
+	"../cmdoutput_test.go",
 	"../command.go",
 	"../command_test.go",
 	"../compile.go",
 	"../compile_test.go",
+	"../completion.go",
+	"../completion_test.go",
 	"../context.go",
 	"../context_test.go",
 	"../controller.go",
 	"../controller_test.go",
+	"../copy.go",
+	"../copy_test.go",
+	"../cycle.go",
+	"../cycle_test.go",
+	"../daemon.go",
+	"../daemon_test.go",
 	"../deps.go",
 	"../deps_test.go",
 	"../dirhash.go",
+	"../doctor.go",
+	"../doctor_test.go",
+	"../download.go",
+	"../download_test.go",
 	"../driver.go.tmpl",
+	"../drivermod.go",
+	"../drivermod_test.go",
 	"../embeds.go",
+	"../engine.go",
+	"../engine_test.go",
+	"../envfile.go",
+	"../envfile_test.go",
+	"../envreport.go",
+	"../envreport_test.go",
+	"../exclude.go",
+	"../exclude_test.go",
+	"../explain.go",
+	"../explain_test.go",
 	"../f.go",
+	"../fileargs.go",
+	"../fileargs_test.go",
 	"../files.go",
 	"../files_test.go",
+	"../filetrace.go",
+	"../filetrace_test.go",
+	"../finally.go",
+	"../finally_test.go",
+	"../flaky.go",
+	"../flaky_test.go",
+	"../foreach.go",
+	"../foreach_test.go",
+	"../format.go",
+	"../format_test.go",
 	"../gate.go",
 	"../gate_test.go",
+	"../generate.go",
+	"../generate_test.go",
+	"../glob.go",
+	"../glob_test.go",
 	"../go.mod",
 	"../go.sum",
+	"../graph.go",
+	"../graph_test.go",
+	"../guard.go",
+	"../guard_test.go",
 	"../hash.go",
 	"../hash_test.go",
+	"../hashenv.go",
+	"../hashenv_test.go",
+	"../hermetic.go",
+	"../hermetic_test.go",
+	"../httpdb/db.go",
+	"../httpdb/db_test.go",
+	"../if.go",
+	"../if_test.go",
+	"../include.go",
+	"../include_test.go",
+	"../inode_other.go",
+	"../inode_unix.go",
+	"../lazy.go",
+	"../lazy_test.go",
+	"../license.go",
+	"../license_test.go",
+	"../limits.go",
+	"../limits_test.go",
 	"../main.go",
 	"../main_test.go",
+	"../namespace.go",
+	"../namespace_test.go",
+	"../params.go",
+	"../params_test.go",
+	"../pattern.go",
+	"../pattern_test.go",
+	"../periodic.go",
+	"../periodic_test.go",
+	"../platform_other.go",
+	"../platform_windows.go",
+	"../platform_windows_test.go",
+	"../precommit.go",
+	"../precommit_test.go",
+	"../progress.go",
+	"../progress_test.go",
+	"../projects.go",
+	"../projects_test.go",
+	"../promote.go",
+	"../promote_test.go",
 	"../proto/proto.go",
 	"../proto/proto_test.go",
+	"../proto/toolchain.go",
+	"../proto/toolchain_test.go",
+	"../prune.go",
+	"../prune_test.go",
+	"../readonly.go",
+	"../readonly_test.go",
+	"../rebuild.go",
+	"../rebuild_test.go",
 	"../register.go",
 	"../register_test.go",
 	"../registry.go",
+	"../release.go",
+	"../release_test.go",
+	"../remote.go",
+	"../remote_test.go",
+	"../results.go",
+	"../results_test.go",
+	"../retry.go",
+	"../retry_test.go",
 	"../runner.go",
 	"../runner_test.go",
+	"../secrets.go",
+	"../secrets_test.go",
 	"../seq.go",
 	"../seq_test.go",
+	"../shell.go",
+	"../shell_test.go",
+	"../spill.go",
+	"../spill_test.go",
 	"../sqlite/db.go",
 	"../sqlite/db_test.go",
 	"../sqlite/schema.sql",
+	"../statcache.go",
+	"../statcache_test.go",
+	"../statusline.go",
+	"../statusline_test.go",
 	"../subdirs_test.go",
+	"../tags.go",
+	"../tags_test.go",
 	"../target.go",
+	"../textstyle.go",
+	"../textstyle_test.go",
+	"../throttle.go",
+	"../throttle_test.go",
+	"../timings.go",
+	"../timings_test.go",
+	"../toolenv.go",
+	"../toolenv_test.go",
+	"../toolhash.go",
+	"../toolhash_test.go",
 	"../top.go",
 	"../top_test.go",
 	"../ts/tsdecls.go",
 	"../ts/tsdecls_test.go",
+	"../tui.go",
+	"../tui_test.go",
 	"../types.go",
 	"../types_test.go",
+	"../vars.go",
+	"../vars_test.go",
+	"../volatile.go",
+	"../volatile_test.go",
+	"../walk.go",
+	"../watch.go",
+	"../watch_test.go",
+	"../wrapper.go",
+	"../wrapper_test.go",
 	"../yaml.go",
 	"../yaml_test.go",
 	"go.go",
 	"go_test.go",
+	"stamp.go",
+	"stamp_test.go",
+}
+
+func TestTest(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		ctx     = context.Background()
+		fabdir  = filepath.Join(tmpdir, "fab")
+		testdir = filepath.Join(tmpdir, "binary")
+	)
+	ctx = fab.WithVerbose(ctx, testing.Verbose())
+
+	db, err := fab.OpenHashDB(fabdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx = fab.WithHashDB(ctx, db)
+
+	if err = copy.Copy("_testdata/binary", testdir); err != nil {
+		t.Fatal(err)
+	}
+	testfile := filepath.Join(testdir, "main_test.go")
+	if err := os.WriteFile(testfile, []byte("package main\n\nimport \"testing\"\n\nfunc TestX(t *testing.T) {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	status := func() fab.Status {
+		t.Helper()
+
+		target, err := Test(testdir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := fab.NewController("").RunWithResults(ctx, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range results {
+			if r.Target == target {
+				return r.Status
+			}
+		}
+		t.Fatal("no result for test target")
+		return ""
+	}
+
+	if got := status(); got != fab.StatusRan {
+		t.Errorf("first run: got status %s, want %s", got, fab.StatusRan)
+	}
+	if got := status(); got != fab.StatusCached {
+		t.Errorf("second run: got status %s, want %s", got, fab.StatusCached)
+	}
+
+	if err := os.WriteFile(testfile, []byte("package main\n\nimport \"testing\"\n\nfunc TestY(t *testing.T) {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != fab.StatusRan {
+		t.Errorf("after changing test: got status %s, want %s", got, fab.StatusRan)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		ctx      = context.Background()
+		gendir   = filepath.Join(tmpdir, "binary")
+		datafile = filepath.Join(gendir, "data.txt")
+		outfile  = filepath.Join(gendir, "out.txt")
+	)
+	ctx = fab.WithVerbose(ctx, testing.Verbose())
+
+	db, err := fab.OpenHashDB(filepath.Join(tmpdir, "fab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx = fab.WithHashDB(ctx, db)
+
+	if err = copy.Copy("_testdata/binary", gendir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(gendir, "gen"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"gen.go":      "package main\n\n//go:generate go run ./gen\n//go:generate cp data.txt out.txt\n",
+		"gen/main.go": "package main\n\nfunc main() {}\n",
+		"data.txt":    "hello\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(gendir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deps, err := GenerateDeps(gendir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	depset := set.New(deps...)
+	for _, want := range []string{"main.go", "gen.go", "gen/main.go", "data.txt"} {
+		want = filepath.Join(gendir, want)
+		if !depset.Has(want) {
+			t.Errorf("deps %v do not include %s", deps, want)
+		}
+	}
+
+	status := func() fab.Status {
+		t.Helper()
+
+		target, err := Generate(gendir, []string{outfile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := fab.NewController("").RunWithResults(ctx, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range results {
+			if r.Target == target {
+				return r.Status
+			}
+		}
+		t.Fatal("no result for generate target")
+		return ""
+	}
+
+	if got := status(); got != fab.StatusRan {
+		t.Errorf("first run: got status %s, want %s", got, fab.StatusRan)
+	}
+	got, err := os.ReadFile(outfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello\n" {
+		t.Errorf("got %q, want %q", got, "hello\n")
+	}
+	if got := status(); got != fab.StatusCached {
+		t.Errorf("second run: got status %s, want %s", got, fab.StatusCached)
+	}
+
+	if err := os.WriteFile(datafile, []byte("goodbye\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != fab.StatusRan {
+		t.Errorf("after changing generator input: got status %s, want %s", got, fab.StatusRan)
+	}
 }
 
 func TestDeps(t *testing.T) {
@@ -138,6 +450,132 @@ func TestDeps(t *testing.T) {
 	}
 }
 
+func TestFormat(t *testing.T) {
+	t.Parallel()
+
+	target, err := Format(".", false, fab.Gofmt, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	ctx = fab.WithVerbose(ctx, testing.Verbose())
+
+	con := fab.NewController("")
+	if err = con.Run(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLintDirs(t *testing.T) {
+	t.Parallel()
+
+	got, err := lintDirs("_testdata", []string{
+		"_testdata/a.go",
+		"_testdata/binary/main.go",
+		"_testdata/binary/gen.go",
+		"_testdata/binary/README.md",
+		"go.go",
+		"../fab.go",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{".", "./binary"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLintArgs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake golangci-lint is a shell script")
+	}
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		bindir  = filepath.Join(tmpdir, "bin")
+		testdir = filepath.Join(tmpdir, "binary")
+		logfile = filepath.Join(tmpdir, "log")
+	)
+	if err := copy.Copy("_testdata/binary", testdir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(bindir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(bindir, "golangci-lint"), []byte("#!/bin/sh\necho \"$@\" >> \"$FAKE_LINT_LOG\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bindir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_LINT_LOG", logfile)
+
+	db, err := fab.OpenHashDB(filepath.Join(tmpdir, "fab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	ctx = fab.WithVerbose(ctx, testing.Verbose())
+	ctx = fab.WithHashDB(ctx, db)
+
+	target, err := Lint(testdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// run runs target with the given args
+	// and returns the golangci-lint argument lists that ran.
+	run := func(args ...string) []string {
+		t.Helper()
+
+		if err := os.Remove(logfile); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		if err := fab.NewController("").Run(ctx, fab.ArgTarget(target, args...)); err != nil {
+			t.Fatal(err)
+		}
+		log, err := os.ReadFile(logfile)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSpace(string(log)), "\n")
+	}
+
+	cases := []struct {
+		args []string
+		want []string
+	}{{
+		// A restricted lint does not update the hash DB...
+		args: []string{filepath.Join(testdir, "main.go")},
+		want: []string{"run ."},
+	}, {
+		// ...so a full lint still runs...
+		want: []string{"run ./..."},
+	}, {
+		// ...and is then cached.
+		want: nil,
+	}, {
+		// A restricted lint always runs.
+		args: []string{filepath.Join(testdir, "main.go")},
+		want: []string{"run ."},
+	}}
+
+	for i, tc := range cases {
+		if got := run(tc.args...); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("case %d: got %q, want %q", i, got, tc.want)
+		}
+	}
+}
+
 func TestGoYAML(t *testing.T) {
 	t.Parallel()
 
@@ -183,4 +621,136 @@ func TestGoYAML(t *testing.T) {
 			t.Errorf("got %+v, want %+v", got, want)
 		}
 	})
+	t.Run("format", func(t *testing.T) {
+		t.Parallel()
+
+		got, _ := con.RegistryTarget("_testdata/Baz")
+		want, err := Format(".", false, fab.Gofmt, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+	t.Run("test", func(t *testing.T) {
+		t.Parallel()
+
+		got, _ := con.RegistryTarget("_testdata/Plugh")
+		want, err := Test("_testdata/binary", "-race")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+	t.Run("vet", func(t *testing.T) {
+		t.Parallel()
+
+		got, _ := con.RegistryTarget("_testdata/Xyzzy")
+		want, err := Vet("_testdata/binary", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+	t.Run("lint", func(t *testing.T) {
+		t.Parallel()
+
+		got, _ := con.RegistryTarget("_testdata/Thud")
+		want, err := Lint("_testdata/binary", "--fast")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+	t.Run("generate", func(t *testing.T) {
+		t.Parallel()
+
+		got, _ := con.RegistryTarget("_testdata/Grault")
+		want, err := Generate("_testdata/binary", []string{"_testdata/binary/gen.go"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+	t.Run("vulncheck", func(t *testing.T) {
+		t.Parallel()
+
+		got, _ := con.RegistryTarget("_testdata/Quux")
+		want, err := Vulncheck(".", "-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+}
+
+func TestDepsEmbed(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	files := map[string]string{
+		"go.mod":               "module example.com/emb\n\ngo 1.20\n",
+		"emb.go":               "package emb\n\nimport \"embed\"\n\n//go:embed static gen.txt all:extra\nvar fs embed.FS\n",
+		"static/a.txt":         "a",
+		"static/.hidden":       "hidden",
+		"static/_underscore":   "underscore",
+		"static/sub/b.txt":     "b",
+		"other/o.txt":          "o",
+		"extra/.included":      "included",
+		"unrelated/ignored.go": "package unrelated\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpdir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("../other", filepath.Join(tmpdir, "static", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The current directory is not tmpdir,
+	// so this checks that embed patterns are interpreted relative to the package.
+	got, err := Deps(tmpdir, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = slices.Mapx(got, func(_ int, full string) (string, error) {
+		return filepath.Rel(tmpdir, full)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+
+	want := []string{
+		"emb.go",
+		"extra/.included",
+		"gen.txt", // not (yet) generated
+		"static/a.txt",
+		"static/link/o.txt",
+		"static/sub/b.txt",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
 }
@@ -0,0 +1,331 @@
+package golang
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bobg/fab"
+)
+
+// StampVar is a string variable in a Go program
+// whose value is set at link time,
+// with the -X linker flag.
+// See [Stamp] and [StampedBinary].
+type StampVar struct {
+	// Var is the package-qualified name of the variable,
+	// such as main.version
+	// or github.com/example/project/internal/build.Commit.
+	Var string
+
+	// Source produces the variable's value.
+	Source StampSource
+
+	// Volatile, if true,
+	// means that the variable's value does not go into the hash
+	// of a [StampedBinary] target,
+	// so that a change in it alone does not cause the binary to be rebuilt.
+	// This is normally the right choice for a build time,
+	// which changes on every run.
+	Volatile bool
+}
+
+// StampSource computes the value of a [StampVar].
+// The dir argument is the directory of the main package being built.
+type StampSource func(ctx context.Context, dir string) (string, error)
+
+// GitDescribe is a [StampSource] producing a version string from git,
+// in the form of `git describe --tags --always --dirty`,
+// e.g. v1.2.3-4-gabcdef0-dirty.
+func GitDescribe(ctx context.Context, dir string) (string, error) {
+	return gitOutput(ctx, dir, "describe", "--tags", "--always", "--dirty")
+}
+
+// GitCommit is a [StampSource] producing the hash of the current git commit.
+func GitCommit(ctx context.Context, dir string) (string, error) {
+	return gitOutput(ctx, dir, "rev-parse", "HEAD")
+}
+
+// BuildTime is a [StampSource] producing the current time in UTC,
+// formatted as in RFC 3339.
+// If the environment variable SOURCE_DATE_EPOCH is set
+// (see reproducible-builds.org),
+// it is the time used instead.
+func BuildTime(context.Context, string) (string, error) {
+	t := time.Now()
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		secs, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return "", errors.Wrapf(err, "parsing SOURCE_DATE_EPOCH value %s", epoch)
+		}
+		t = time.Unix(secs, 0)
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// StampValue produces a [StampSource] with a fixed value.
+func StampValue(value string) StampSource {
+	return func(context.Context, string) (string, error) {
+		return value, nil
+	}
+}
+
+// StampEnv produces a [StampSource] whose value is that of the given environment variable.
+func StampEnv(name string) StampSource {
+	return func(context.Context, string) (string, error) {
+		return os.Getenv(name), nil
+	}
+}
+
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fab.CommandErr{Err: errors.Wrapf(err, "running git %s", strings.Join(args, " ")), Output: stderr.Bytes()}
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Stamp computes the values of the given variables
+// for the main package in dir,
+// and returns the value of a -ldflags flag for `go build`
+// that sets them.
+//
+// Example:
+//
+//	ldflags, err := golang.Stamp(ctx, "cmd/app",
+//	  golang.StampVar{Var: "main.version", Source: golang.GitDescribe},
+//	  golang.StampVar{Var: "main.date", Source: golang.BuildTime, Volatile: true},
+//	)
+//	// ldflags is e.g. "-X 'main.version=v1.2.3' -X 'main.date=2024-05-01T12:00:00Z'"
+func Stamp(ctx context.Context, dir string, vars ...StampVar) (string, error) {
+	values, err := stampValues(ctx, dir, vars, true)
+	if err != nil {
+		return "", err
+	}
+	var words []string
+	for i, v := range vars {
+		words = append(words, "-X", quoteLDFlag(v.Var+"="+values[i]))
+	}
+	return strings.Join(words, " "), nil
+}
+
+// stampValues computes the values of vars,
+// leaving the volatile ones empty unless volatile is true.
+func stampValues(ctx context.Context, dir string, vars []StampVar, volatile bool) ([]string, error) {
+	values := make([]string, len(vars))
+	for i, v := range vars {
+		if v.Volatile && !volatile {
+			continue
+		}
+		if v.Source == nil {
+			return nil, fmt.Errorf("no source for stamp variable %s", v.Var)
+		}
+		val, err := v.Source(ctx, dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "computing value of stamp variable %s", v.Var)
+		}
+		values[i] = val
+	}
+	return values, nil
+}
+
+// quoteLDFlag quotes s as needed for a word in the value of -ldflags,
+// which the go command splits like a shell would.
+func quoteLDFlag(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// addLDFlags adds ldflags to the value of any -ldflags flag in flags,
+// or adds a new -ldflags flag if there isn't one.
+// (When -ldflags is given more than once,
+// the go command uses only the last one.)
+func addLDFlags(flags []string, ldflags string) []string {
+	result := make([]string, 0, len(flags)+1)
+	var found bool
+	for i := 0; i < len(flags); i++ {
+		flag := flags[i]
+		name, val, hasVal := strings.Cut(flag, "=")
+		if name != "-ldflags" && name != "--ldflags" {
+			result = append(result, flag)
+			continue
+		}
+		if !hasVal && i+1 < len(flags) {
+			i++
+			val = flags[i]
+		}
+		found = true
+		result = append(result, "-ldflags="+strings.TrimSpace(val+" "+ldflags))
+	}
+	if !found {
+		result = append(result, "-ldflags="+ldflags)
+	}
+	return result
+}
+
+// StampedBinary is like [Binary],
+// but additionally sets the given variables in the binary
+// with the linker's -X flag
+// (see [Stamp]).
+// Their values are computed when the target runs.
+// The values of the non-volatile ones also go into the hash of the target,
+// so that e.g. a new git commit causes the binary to be rebuilt.
+// Any -ldflags flag among flags is combined with the -X flags.
+//
+// In YAML,
+// the mapping introduced by the !go.Binary tag may include a Stamp field,
+// a sequence of mappings whose fields are:
+//
+//   - Var: the package-qualified name of the variable
+//   - Source: git-describe (see [GitDescribe]), git-commit (see [GitCommit]), or build-time (see [BuildTime])
+//   - Env: the name of an environment variable supplying the value, instead of Source
+//   - Value: a literal value, instead of Source
+//   - Volatile: a boolean, true for keeping the value out of the hash
+//
+// Example:
+//
+//	App: !go.Binary
+//	  Dir: cmd/app
+//	  Stamp:
+//	    - Var: main.version
+//	      Source: git-describe
+//	    - Var: main.date
+//	      Source: build-time
+//	      Volatile: true
+func StampedBinary(dir, outfile string, vars []StampVar, flags ...string) (fab.Target, error) {
+	if outfile == "" {
+		outfile = filepath.Base(dir)
+	}
+
+	relOutfile, err := filepath.Rel(dir, outfile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting relative path from %s to %s", dir, outfile)
+	}
+
+	deps, err := Deps(dir, false, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "computing dependencies")
+	}
+	b := &stampedBuild{
+		Dir:   dir,
+		Out:   relOutfile,
+		Flags: flags,
+		vars:  vars,
+	}
+	return fab.Files(b, deps, []string{outfile}, fab.Autoclean(true)), nil
+}
+
+// stampedBuild is the subtarget of a [StampedBinary] target.
+type stampedBuild struct {
+	Dir   string
+	Out   string
+	Flags []string
+	vars  []StampVar
+}
+
+var (
+	_ fab.Target = &stampedBuild{}
+	_ fab.Hasher = &stampedBuild{}
+)
+
+// Run implements fab.Target.Run.
+func (b *stampedBuild) Run(ctx context.Context, con *fab.Controller) error {
+	ldflags, err := Stamp(ctx, b.Dir, b.vars...)
+	if err != nil {
+		return err
+	}
+	args := append([]string{"build", "-C", b.Dir, "-o", b.Out}, addLDFlags(b.Flags, ldflags)...)
+	args = append(args, ".")
+	c := &fab.Command{
+		Cmd:  "go",
+		Args: args,
+	}
+	return con.Run(ctx, c)
+}
+
+// Desc implements fab.Target.Desc.
+func (*stampedBuild) Desc() string {
+	return "go.Binary"
+}
+
+// Hash implements fab.Hasher.
+// It includes the values of the non-volatile stamp variables.
+func (b *stampedBuild) Hash() ([]byte, error) {
+	values, err := stampValues(context.Background(), b.Dir, b.vars, false)
+	if err != nil {
+		return nil, err
+	}
+	type hashVar struct {
+		Var   string `json:"var"`
+		Value string `json:"value,omitempty"`
+	}
+	s := struct {
+		Dir   string    `json:"dir"`
+		Out   string    `json:"out"`
+		Flags []string  `json:"flags,omitempty"`
+		Vars  []hashVar `json:"vars,omitempty"`
+	}{
+		Dir:   b.Dir,
+		Out:   b.Out,
+		Flags: b.Flags,
+	}
+	for i, v := range b.vars {
+		s.Vars = append(s.Vars, hashVar{Var: v.Var, Value: values[i]})
+	}
+	return json.Marshal(s)
+}
+
+// yamlStampVars decodes the Stamp field of a !go.Binary node.
+// See [StampedBinary].
+func yamlStampVars(node *yaml.Node) ([]StampVar, error) {
+	var ys []struct {
+		Var      string `yaml:"Var"`
+		Source   string `yaml:"Source"`
+		Env      string `yaml:"Env"`
+		Value    string `yaml:"Value"`
+		Volatile bool   `yaml:"Volatile"`
+	}
+	if err := node.Decode(&ys); err != nil {
+		return nil, errors.Wrap(err, "decoding Stamp")
+	}
+
+	var result []StampVar
+	for _, y := range ys {
+		if y.Var == "" {
+			return nil, fmt.Errorf("stamp variable with no Var")
+		}
+		v := StampVar{Var: y.Var, Volatile: y.Volatile}
+		switch {
+		case y.Env != "":
+			v.Source = StampEnv(y.Env)
+		case y.Value != "":
+			v.Source = StampValue(y.Value)
+		case y.Source == "git-describe":
+			v.Source = GitDescribe
+		case y.Source == "git-commit":
+			v.Source = GitCommit
+		case y.Source == "build-time":
+			v.Source = BuildTime
+		default:
+			return nil, fmt.Errorf("unknown Source %q for stamp variable %s", y.Source, y.Var)
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
@@ -0,0 +1,193 @@
+package golang
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bobg/fab"
+)
+
+func TestStamp(t *testing.T) {
+	ctx := context.Background()
+	got, err := Stamp(ctx, ".",
+		StampVar{Var: "main.version", Source: StampValue("v1.2.3")},
+		StampVar{Var: "main.note", Source: StampValue("it's here")},
+		StampVar{Var: "main.empty", Source: StampValue(""), Volatile: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `-X main.version=v1.2.3 -X 'main.note=it'"'"'s here' -X main.empty=`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if _, err := Stamp(ctx, ".", StampVar{Var: "main.x"}); err == nil {
+		t.Error("got no error for a variable with no source")
+	}
+}
+
+func TestBuildTime(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	got, err := BuildTime(context.Background(), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2023-11-14T22:13:20Z"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestAddLDFlags(t *testing.T) {
+	cases := []struct {
+		flags []string
+		want  []string
+	}{{
+		flags: nil,
+		want:  []string{"-ldflags=-X a=b"},
+	}, {
+		flags: []string{"-trimpath", "-ldflags", "-s -w"},
+		want:  []string{"-trimpath", "-ldflags=-s -w -X a=b"},
+	}, {
+		flags: []string{"-ldflags=-s", "-v"},
+		want:  []string{"-ldflags=-s -X a=b", "-v"},
+	}}
+	for _, tc := range cases {
+		if got := addLDFlags(tc.flags, "-X a=b"); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("with %v got %v, want %v", tc.flags, got, tc.want)
+		}
+	}
+}
+
+func TestStampHash(t *testing.T) {
+	var version, date string
+	b := &stampedBuild{
+		Dir: ".",
+		Out: "x",
+		vars: []StampVar{{
+			Var:    "main.version",
+			Source: func(context.Context, string) (string, error) { return version, nil },
+		}, {
+			Var:      "main.date",
+			Source:   func(context.Context, string) (string, error) { return date, nil },
+			Volatile: true,
+		}},
+	}
+
+	hash := func() string {
+		t.Helper()
+		h, err := b.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(h)
+	}
+
+	version, date = "v1", "monday"
+	h1 := hash()
+
+	date = "tuesday"
+	if h2 := hash(); h2 != h1 {
+		t.Error("hash changed with volatile value")
+	}
+
+	version = "v2"
+	if h3 := hash(); h3 == h1 {
+		t.Error("hash did not change with non-volatile value")
+	}
+}
+
+func TestYAMLStampVars(t *testing.T) {
+	const doc = `
+- Var: main.version
+  Source: git-describe
+- Var: main.date
+  Source: build-time
+  Volatile: true
+- Var: main.user
+  Env: USER
+- Var: main.flavor
+  Value: vanilla
+`
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(doc), &node); err != nil {
+		t.Fatal(err)
+	}
+	vars, err := yamlStampVars(node.Content[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		names    []string
+		volatile []bool
+	)
+	for _, v := range vars {
+		names = append(names, v.Var)
+		volatile = append(volatile, v.Volatile)
+	}
+	if want := []string{"main.version", "main.date", "main.user", "main.flavor"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got vars %v, want %v", names, want)
+	}
+	if want := []bool{false, true, false, false}; !reflect.DeepEqual(volatile, want) {
+		t.Errorf("got volatile %v, want %v", volatile, want)
+	}
+	if val, err := vars[3].Source(context.Background(), "."); err != nil || val != "vanilla" {
+		t.Errorf("got %q, %v; want vanilla, nil", val, err)
+	}
+
+	if err := yaml.Unmarshal([]byte("- Var: main.x\n  Source: bogus\n"), &node); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := yamlStampVars(node.Content[0]); err == nil {
+		t.Error("got no error for unknown source")
+	}
+}
+
+func TestStampedBinary(t *testing.T) {
+	t.Parallel()
+
+	var (
+		tmpdir  = t.TempDir()
+		maindir = filepath.Join(tmpdir, "stamped")
+		outfile = filepath.Join(tmpdir, "out")
+	)
+	if err := os.Mkdir(maindir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"go.mod":  "module stamped\n\ngo 1.20\n",
+		"main.go": "package main\n\nimport \"fmt\"\n\nvar version = \"dev\"\n\nfunc main() { fmt.Print(version) }\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(maindir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	targ, err := StampedBinary(maindir, outfile, []StampVar{{Var: "main.version", Source: StampValue("v1.2.3")}}, "-trimpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	con := fab.NewController("")
+	if err := con.Run(context.Background(), targ); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	cmd := exec.Command(outfile)
+	cmd.Stdout = &buf
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "v1.2.3" {
+		t.Errorf("got %q, want v1.2.3", got)
+	}
+}
@@ -0,0 +1,161 @@
+package fab
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/slices"
+)
+
+// Graph writes the dependency graph of the given targets to w.
+// If no targets are given,
+// the graph of all the targets in the registry is written.
+//
+// The format is either "dot",
+// for input to the Graphviz tools,
+// or "json".
+//
+// Each node in the graph is a target,
+// labeled with its name (see [Controller.Describe])
+// and its type (from its Desc method).
+// There is an edge from each target to each of its subtargets,
+// including from a [Files] target to the targets that produce its input files.
+// References to targets by name are resolved,
+// so they appear as edges to the named targets.
+func (con *Controller) Graph(w io.Writer, format string, targets ...Target) error {
+	if len(targets) == 0 {
+		for _, name := range con.RegistryNames() {
+			target, _ := con.RegistryTarget(name)
+			targets = append(targets, target)
+		}
+	}
+
+	g, err := con.buildGraph(targets)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "dot":
+		return g.writeDOT(w)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(g), "encoding graph")
+	default:
+		return fmt.Errorf("unknown graph format %s", format)
+	}
+}
+
+// GraphNode is a node in the graph produced by [Controller.Graph] in JSON format.
+type GraphNode struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Registered bool   `json:"registered,omitempty"`
+}
+
+// GraphEdge is an edge in the graph produced by [Controller.Graph] in JSON format.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+func (con *Controller) buildGraph(targets []Target) (*graph, error) {
+	var (
+		g   = &graph{}
+		ids = make(map[uintptr]string)
+	)
+
+	var visit func(Target) (string, error)
+	visit = func(target Target) (string, error) {
+		if d, ok := target.(*deferredResolutionTarget); ok {
+			resolved, err := d.resolve(con)
+			if err != nil {
+				return "", err
+			}
+			return visit(resolved)
+		}
+
+		addr, err := targetAddr(target)
+		if err != nil {
+			return "", err
+		}
+		if id, ok := ids[addr]; ok {
+			return id, nil
+		}
+
+		id := "n" + strconv.Itoa(len(ids)+1)
+		ids[addr] = id
+
+		con.mu.Lock()
+		_, registered := con.targetsByAddr[addr]
+		con.mu.Unlock()
+
+		g.Nodes = append(g.Nodes, GraphNode{
+			ID:         id,
+			Name:       con.Describe(target),
+			Type:       target.Desc(),
+			Registered: registered,
+		})
+
+		subs, err := con.subtargets(target)
+		if err != nil {
+			return "", errors.Wrapf(err, "getting subtargets of %s", con.Describe(target))
+		}
+		for _, sub := range subs {
+			if sub == nil {
+				continue
+			}
+			subID, err := visit(sub)
+			if err != nil {
+				return "", err
+			}
+			g.Edges = append(g.Edges, GraphEdge{From: id, To: subID})
+		}
+
+		return id, nil
+	}
+
+	for _, target := range targets {
+		if _, err := visit(target); err != nil {
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
+
+func (g *graph) writeDOT(w io.Writer) error {
+	lines := []string{"digraph fab {"}
+	lines = append(lines, slices.Map(g.Nodes, func(n GraphNode) string {
+		label := n.Name
+		if label != "unnamed "+n.Type {
+			label += "\n(" + n.Type + ")"
+		}
+		attrs := "label=" + strconv.Quote(label)
+		if !n.Registered {
+			attrs += ", style=dashed"
+		}
+		return fmt.Sprintf("  %s [%s];", n.ID, attrs)
+	})...)
+	lines = append(lines, slices.Map(g.Edges, func(e GraphEdge) string {
+		return fmt.Sprintf("  %s -> %s;", e.From, e.To)
+	})...)
+	lines = append(lines, "}")
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return errors.Wrap(err, "writing DOT output")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package fab
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy/v2"
+)
+
+func TestGraph(t *testing.T) {
+	t.Parallel()
+
+	con := NewController("")
+
+	gen := Files(&Command{Shell: "generate"}, nil, []string{"TestGraph/gen.go"})
+	if _, err := con.RegisterTarget("Gen", "", gen); err != nil {
+		t.Fatal(err)
+	}
+	build := Files(&Command{Shell: "go build"}, []string{"TestGraph/gen.go"}, []string{"TestGraph/out"})
+	if _, err := con.RegisterTarget("Build", "", build); err != nil {
+		t.Fatal(err)
+	}
+	test := Seq(&deferredResolutionTarget{Name: "Build"}, &Command{Shell: "go test"})
+	if _, err := con.RegisterTarget("Test", "", test); err != nil {
+		t.Fatal(err)
+	}
+
+	snaps := cupaloy.New(cupaloy.SnapshotSubdirectory("_testdata"))
+
+	for _, format := range []string{"dot", "json"} {
+		format := format
+		t.Run(format, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			if err := con.Graph(buf, format); err != nil {
+				t.Fatal(err)
+			}
+			snaps.SnapshotT(t, buf.String())
+		})
+	}
+
+	t.Run("bad_format", func(t *testing.T) {
+		if err := con.Graph(new(bytes.Buffer), "xml"); err == nil {
+			t.Error("got no error but wanted one")
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package fab
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+)
+
+type inputGuardKeyType struct{}
+
+// WithInputGuard decorates a context with the value of an "input guard" boolean.
+// When it is true,
+// a [Files] target notes the modification times and sizes of its input files
+// before running its subtarget,
+// and checks them again afterwards.
+// If any input changed while the subtarget was running
+// (e.g. because an editor saved a file),
+// the outputs may not correspond to the inputs that will be hashed,
+// so a warning is printed
+// and the Files target's hash is not recorded in the hash DB.
+// The target will therefore run again the next time.
+//
+// Retrieve it with [GetInputGuard].
+func WithInputGuard(ctx context.Context, guard bool) context.Context {
+	return context.WithValue(ctx, inputGuardKeyType{}, guard)
+}
+
+// GetInputGuard returns the value of the input-guard boolean added to `ctx` with [WithInputGuard].
+// The default, if WithInputGuard was not used, is false.
+func GetInputGuard(ctx context.Context) bool {
+	val, _ := ctx.Value(inputGuardKeyType{}).(bool)
+	return val
+}
+
+// fileStamp is what an input guard knows about a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// inputSnapshot maps file names to their stamps.
+// A file that does not exist is absent.
+type inputSnapshot map[string]fileStamp
+
+// snapshotInputs records the modification time and size of each of the given files,
+// recursing into directories.
+func snapshotInputs(items []string) (inputSnapshot, error) {
+	result := make(inputSnapshot)
+	for _, item := range items {
+		err := filepath.WalkDir(item, func(path string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return errors.Wrapf(err, "statting %s", path)
+			}
+			result[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "walking %s", item)
+		}
+	}
+	return result, nil
+}
+
+// changed returns the sorted names of files that were added, removed, or modified
+// between snapshots s and other.
+func (s inputSnapshot) changed(other inputSnapshot) []string {
+	var result []string
+	for name, stamp := range s {
+		if otherStamp, ok := other[name]; !ok || !otherStamp.modTime.Equal(stamp.modTime) || otherStamp.size != stamp.size {
+			result = append(result, name)
+		}
+	}
+	for name := range other {
+		if _, ok := s[name]; !ok {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// checkInputs compares the current state of ft's inputs to the snapshot taken before running its subtarget.
+// It reports whether they are unchanged,
+// printing a warning if they are not.
+func (ft *files) checkInputs(con *Controller, before inputSnapshot) (bool, error) {
+	after, err := snapshotInputs(ft.In)
+	if err != nil {
+		return false, errors.Wrap(err, "checking input files")
+	}
+	changed := before.changed(after)
+	if len(changed) == 0 {
+		return true, nil
+	}
+	con.message("stderr", "Warning: input files of %s changed while it was running, not recording its hash: %s", con.Describe(ft), strings.Join(changed, ", "))
+	return false, nil
+}
@@ -0,0 +1,92 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestInputGuard(t *testing.T) {
+	t.Parallel()
+
+	for _, guard := range []bool{false, true} {
+		guard := guard
+		name := "off"
+		if guard {
+			name = "on"
+		}
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tmpdir, err := os.MkdirTemp("", "fab")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmpdir)
+
+			var (
+				in  = filepath.Join(tmpdir, "in")
+				out = filepath.Join(tmpdir, "out")
+			)
+			if err := os.WriteFile(in, []byte("x\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			db := set.New[string]()
+
+			ctx := context.Background()
+			ctx = WithHashDB(ctx, memdb(db))
+			ctx = WithInputGuard(ctx, guard)
+
+			// The command modifies its own input,
+			// as an editor saving the file might.
+			target := Files(Shellf("cp %[1]s %[2]s && echo y >> %[1]s", in, out), []string{in}, []string{out})
+			if err := NewController(tmpdir).Run(ctx, target); err != nil {
+				t.Fatal(err)
+			}
+
+			want := 1
+			if guard {
+				want = 0
+			}
+			if db.Len() != want {
+				t.Errorf("got %d hashes in the DB, want %d", db.Len(), want)
+			}
+		})
+	}
+}
+
+func TestInputSnapshotChanged(t *testing.T) {
+	t.Parallel()
+
+	var (
+		t1 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		t2 = t1.Add(time.Second)
+	)
+
+	before := inputSnapshot{
+		"same":     {modTime: t1, size: 1},
+		"touched":  {modTime: t1, size: 1},
+		"resized":  {modTime: t1, size: 1},
+		"removed":  {modTime: t1, size: 1},
+		"whatever": {modTime: t2, size: 2},
+	}
+	after := inputSnapshot{
+		"same":     {modTime: t1, size: 1},
+		"touched":  {modTime: t2, size: 1},
+		"resized":  {modTime: t1, size: 2},
+		"added":    {modTime: t1, size: 1},
+		"whatever": {modTime: t2, size: 2},
+	}
+
+	got := before.changed(after)
+	want := []string{"added", "removed", "resized", "touched"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
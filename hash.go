@@ -1,6 +1,16 @@
 package fab
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/bobg/errors"
+
+	"github.com/bobg/fab/httpdb"
+)
 
 // HashDB is the type of a database for storing hashes.
 // It must permit concurrent operations safely.
@@ -12,3 +22,103 @@ type HashDB interface {
 	// Add adds an entry to the database.
 	Add(context.Context, []byte) error
 }
+
+// HashDBFunc is the type of a function that opens a [HashDB] given its URL.
+// The fabdir argument is the directory holding the user's local fab state
+// (see [Main.Fabdir]).
+//
+// If the resulting HashDB also implements io.Closer,
+// callers should call Close when finished with it.
+type HashDBFunc func(ctx context.Context, u *url.URL, fabdir string) (HashDB, error)
+
+var (
+	hashDBRegistryMu sync.Mutex
+	hashDBRegistry   = make(map[string]HashDBFunc)
+)
+
+// RegisterHashDB places a function in the HashDB registry with the given URL scheme.
+// It is used by [OpenHashDBURL].
+// Any previous function registered with the same scheme is replaced.
+//
+// The schemes file, http, https, and gs are registered by default.
+func RegisterHashDB(scheme string, fn HashDBFunc) {
+	hashDBRegistryMu.Lock()
+	hashDBRegistry[scheme] = fn
+	hashDBRegistryMu.Unlock()
+}
+
+// OpenHashDBURL opens the [HashDB] at the given URL
+// using the function registered for its scheme with [RegisterHashDB].
+// If the URL is empty,
+// this opens the local hash DB in fabdir (see [OpenHashDB]).
+//
+// The predefined schemes are:
+//
+//   - file: a local hash DB in the directory named by the URL's path
+//   - http, https: a remote HTTP service (see [httpdb.DB])
+//   - gs: a Google Cloud Storage bucket, as in gs://BUCKET/PREFIX
+//
+// For http, https, and gs,
+// if the environment variable FAB_CACHE_TOKEN is set,
+// it is sent as a bearer token in the Authorization header of each request.
+//
+// If the resulting HashDB also implements io.Closer,
+// callers should call Close when finished with it.
+func OpenHashDBURL(ctx context.Context, cacheURL, fabdir string) (HashDB, error) {
+	if cacheURL == "" {
+		return openLocalHashDB(fabdir)
+	}
+
+	u, err := url.Parse(cacheURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing cache URL %s", cacheURL)
+	}
+
+	hashDBRegistryMu.Lock()
+	fn, ok := hashDBRegistry[u.Scheme]
+	hashDBRegistryMu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown cache URL scheme %q", u.Scheme)
+	}
+
+	db, err := fn(ctx, u, fabdir)
+	return db, errors.Wrapf(err, "opening cache %s", cacheURL)
+}
+
+// openLocalHashDB is like [OpenHashDB]
+// but avoids producing a non-nil HashDB holding a nil *sqlite.DB on error.
+func openLocalHashDB(dir string) (HashDB, error) {
+	db, err := OpenHashDB(dir)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func httpHashDBOpts() []httpdb.Option {
+	if token := os.Getenv("FAB_CACHE_TOKEN"); token != "" {
+		return []httpdb.Option{httpdb.WithHeader("Authorization", "Bearer "+token)}
+	}
+	return nil
+}
+
+func init() {
+	RegisterHashDB("file", func(_ context.Context, u *url.URL, _ string) (HashDB, error) {
+		return openLocalHashDB(u.Path)
+	})
+
+	openHTTP := func(_ context.Context, u *url.URL, _ string) (HashDB, error) {
+		return httpdb.New(u.String(), httpHashDBOpts()...), nil
+	}
+	RegisterHashDB("http", openHTTP)
+	RegisterHashDB("https", openHTTP)
+
+	RegisterHashDB("gs", func(_ context.Context, u *url.URL, _ string) (HashDB, error) {
+		if u.Host == "" {
+			return nil, fmt.Errorf("no bucket in gs URL")
+		}
+		base := "https://storage.googleapis.com/" + u.Host + u.Path
+		return httpdb.New(base, httpHashDBOpts()...), nil
+	})
+}
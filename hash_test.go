@@ -3,13 +3,17 @@ package fab
 import (
 	"context"
 	"encoding/hex"
+	"io"
 	"io/fs"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/bobg/errors"
 	"github.com/bobg/go-generics/v2/set"
+
+	"github.com/bobg/fab/httpdb"
 )
 
 func TestHashTarget(t *testing.T) {
@@ -144,3 +148,56 @@ func (m memdb) Add(_ context.Context, h []byte) error {
 	(set.Of[string])(m).Add(hex.EncodeToString(h))
 	return nil
 }
+
+func TestOpenHashDBURL(t *testing.T) {
+	t.Parallel()
+
+	dir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		ctx    = context.Background()
+		store  = memdb(set.New[string]())
+		server = httptest.NewServer(httpdb.Handler(store))
+	)
+	defer server.Close()
+
+	try := func(cacheURL string) {
+		t.Helper()
+
+		db, err := OpenHashDBURL(ctx, cacheURL, filepath.Join(dir, "fabdir"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c, ok := db.(io.Closer); ok {
+			defer c.Close()
+		}
+
+		h := []byte(cacheURL + "x")
+		if err = db.Add(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+		has, err := db.Has(ctx, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !has {
+			t.Errorf("%s: added hash not found", cacheURL)
+		}
+	}
+
+	try("")
+	try("file://" + filepath.Join(dir, "other"))
+	try(server.URL + "/cache")
+
+	if has, _ := store.Has(ctx, []byte(server.URL+"/cachex")); !has {
+		t.Error("hash not found in server's store")
+	}
+
+	if _, err := OpenHashDBURL(ctx, "bogus://foo", dir); err == nil {
+		t.Error("got no error for unknown scheme, want one")
+	}
+}
@@ -0,0 +1,132 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+// HashEnv is an option for passing to [Files].
+// It names environment variables whose values go into the hash of the Files target,
+// so that changing one of them
+// (such as CFLAGS)
+// causes the target to run again
+// instead of reusing outputs built with the old value.
+// A variable that is unset is distinguished from one that is set to the empty string.
+//
+// The value of a variable is the one a [Command] would see:
+// Fab's own environment,
+// overridden by any settings from [WithEnv].
+//
+// The HashEnv field of each Command in the subtarget
+// (or among its descendants)
+// also names variables for the hash.
+func HashEnv(names ...string) FilesOpt {
+	return func(f *files) {
+		f.hashEnv = append(f.hashEnv, names...)
+	}
+}
+
+// envHashInputs returns the environment variables that go into the hash of ft,
+// as a sorted list of VAR=VALUE strings
+// (or VAR alone for a variable that is unset).
+// See [HashEnv].
+func (ft *files) envHashInputs(ctx context.Context, con *Controller) []string {
+	names := set.New(ft.hashEnv...)
+	for _, c := range con.commands(ft.Target) {
+		names.Add(c.HashEnv...)
+	}
+	if names.Len() == 0 {
+		return nil
+	}
+
+	values := make(map[string]string)
+	for _, kv := range append(os.Environ(), GetEnv(ctx)...) {
+		name, value, _ := strings.Cut(kv, "=")
+		values[envKey(name)] = value
+	}
+
+	result := make([]string, 0, names.Len())
+	for name := range names {
+		if value, ok := values[envKey(name)]; ok {
+			result = append(result, name+"="+value)
+		} else {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// commands returns each [Command] among target and its descendants.
+// Unlike [Controller.walk],
+// it does not descend into the prerequisites of [Files] targets,
+// whose own hashes cover them,
+// and it quietly skips subtargets that cannot be resolved.
+func (con *Controller) commands(target Target) []*Command {
+	var (
+		result []*Command
+		seen   = set.New[uintptr]()
+		walk   func(Target)
+	)
+	walk = func(target Target) {
+		if target == nil {
+			return
+		}
+		if addr, err := targetAddr(target); err == nil {
+			if seen.Has(addr) {
+				return
+			}
+			seen.Add(addr)
+		}
+
+		var subs []Target
+		switch t := target.(type) {
+		case *Command:
+			result = append(result, t)
+			return
+		case *files:
+			subs = []Target{t.Target}
+		default:
+			subs, _ = con.subtargets(target)
+		}
+		for _, sub := range subs {
+			walk(sub)
+		}
+	}
+	walk(target)
+	return result
+}
+
+// changedEnv compares two lists produced by envHashInputs,
+// returning the names of the variables that differ between them,
+// sorted.
+func changedEnv(prev, cur []string) []string {
+	toMap := func(env []string) map[string]string {
+		m := make(map[string]string, len(env))
+		for _, kv := range env {
+			name, _, _ := strings.Cut(kv, "=")
+			m[name] = kv
+		}
+		return m
+	}
+	prevMap, curMap := toMap(prev), toMap(cur)
+
+	changed := set.New[string]()
+	for name, kv := range curMap {
+		if prevMap[name] != kv {
+			changed.Add(name)
+		}
+	}
+	for name := range prevMap {
+		if _, ok := curMap[name]; !ok {
+			changed.Add(name)
+		}
+	}
+	result := changed.Slice()
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,85 @@
+package fab
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestHashEnv(t *testing.T) {
+	t.Parallel()
+
+	ct := &countTarget{}
+	cmd := &Command{Shell: "true", HashEnv: []string{"FAB_TEST_HASH_ENV_B"}}
+
+	cases := []struct {
+		name   string
+		target Target
+	}{{
+		name:   "files_opt",
+		target: Files(ct, nil, nil, HashEnv("FAB_TEST_HASH_ENV_A")),
+	}, {
+		name:   "command",
+		target: Files(Seq(cmd), nil, nil),
+	}}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				db  = memdb(set.New[string]())
+				ctx = WithHashDB(context.Background(), db)
+			)
+
+			steps := []struct {
+				env     []string
+				wantRun bool
+			}{
+				{env: nil, wantRun: true},
+				{env: nil, wantRun: false},
+				{env: []string{"FAB_TEST_HASH_ENV_A=1", "FAB_TEST_HASH_ENV_B=1"}, wantRun: true},
+				{env: []string{"FAB_TEST_HASH_ENV_A=1", "FAB_TEST_HASH_ENV_B=1"}, wantRun: false},
+				{env: []string{"FAB_TEST_HASH_ENV_A=", "FAB_TEST_HASH_ENV_B="}, wantRun: true},
+				{env: []string{"FAB_TEST_HASH_ENV_A=", "FAB_TEST_HASH_ENV_B=", "FAB_TEST_HASH_ENV_C=1"}, wantRun: false},
+			}
+			for i, step := range steps {
+				con := NewController("")
+				if err := con.Run(WithEnv(ctx, step.env), tc.target); err != nil {
+					t.Fatal(err)
+				}
+				want := StatusCached
+				if step.wantRun {
+					want = StatusRan
+				}
+				var found bool
+				for _, r := range con.Results() {
+					if r.Target != tc.target {
+						continue
+					}
+					found = true
+					if r.Status != want {
+						t.Errorf("step %d: got status %s, want %s", i, r.Status, want)
+					}
+				}
+				if !found {
+					t.Errorf("step %d: no result for target", i)
+				}
+			}
+		})
+	}
+}
+
+func TestChangedEnv(t *testing.T) {
+	var (
+		prev = []string{"A=1", "B=2", "C", "D=4"}
+		cur  = []string{"A=1", "B=3", "C=", "E=5"}
+		want = []string{"B", "C", "D", "E"}
+	)
+	if got := changedEnv(prev, cur); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,219 @@
+package fab
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+)
+
+// Hermetic is an option for passing to [Files].
+// When it is true,
+// the subtarget runs in a "sandbox":
+// a temporary directory laid out like the project's top directory
+// but containing only symbolic links to the declared input files.
+// Afterwards,
+// the declared output files are moved from the sandbox
+// to their places in the project.
+// A subtarget that reads an undeclared input,
+// or writes an undeclared output,
+// therefore fails
+// (or at least does not produce its result)
+// instead of silently working.
+//
+// Inputs and outputs outside the top directory are not sandboxed.
+//
+// The sandbox applies to the Dir, StdinFile, StdoutFile, and StderrFile of each [Command]
+// run by the subtarget,
+// which are mapped to the corresponding places in the sandbox.
+// (A Command with no Dir runs in the sandbox's counterpart of the current directory.)
+// An absolute path to a file in the project
+// mentioned in a Command's Shell or Args
+// is not mapped,
+// and escapes the sandbox.
+func Hermetic(hermetic bool) FilesOpt {
+	return func(f *files) {
+		f.hermetic = hermetic
+	}
+}
+
+// sandbox is the temporary directory
+// in which the subtarget of a [Hermetic] Files target runs.
+type sandbox struct {
+	topdir string // the absolute path of the project's top directory
+	dir    string // the sandbox's counterpart of topdir
+}
+
+type sandboxKeyType struct{}
+
+func withSandbox(ctx context.Context, sb *sandbox) context.Context {
+	return context.WithValue(ctx, sandboxKeyType{}, sb)
+}
+
+func getSandbox(ctx context.Context) *sandbox {
+	sb, _ := ctx.Value(sandboxKeyType{}).(*sandbox)
+	return sb
+}
+
+// path maps a path in the project to the corresponding path in the sandbox.
+// A relative path is taken to be relative to the current directory,
+// and an empty one means the current directory.
+// A path outside the project's top directory is returned unchanged.
+func (sb *sandbox) path(path string) string {
+	if sb == nil {
+		return path
+	}
+	abs, err := filepath.Abs(path) // Abs("") is the current directory
+	if err != nil {
+		return path
+	}
+	rel, ok := sb.rel(abs)
+	if !ok {
+		return path
+	}
+	return filepath.Join(sb.dir, rel)
+}
+
+// unpath is the inverse of path:
+// it maps an absolute path in the sandbox
+// to the corresponding path in the project.
+// Any other path is returned unchanged.
+func (sb *sandbox) unpath(abs string) string {
+	if sb == nil {
+		return abs
+	}
+	rel, err := filepath.Rel(sb.dir, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return abs
+	}
+	return filepath.Join(sb.topdir, rel)
+}
+
+// rel returns the path of abs relative to the project's top directory,
+// and false if abs is outside it.
+func (sb *sandbox) rel(abs string) (string, bool) {
+	rel, err := filepath.Rel(sb.topdir, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// runHermetic runs the subtarget of ft in a sandbox
+// (see [Hermetic]).
+func (ft *files) runHermetic(ctx context.Context, con *Controller) error {
+	topdir, err := filepath.Abs(con.JoinPath())
+	if err != nil {
+		return errors.Wrap(err, "getting absolute path of top directory")
+	}
+	tmpdir, err := os.MkdirTemp("", "fab-sandbox-*")
+	if err != nil {
+		return errors.Wrap(err, "creating sandbox")
+	}
+	defer os.RemoveAll(tmpdir)
+
+	sb := &sandbox{topdir: topdir, dir: filepath.Join(tmpdir, "top")}
+
+	for _, in := range ft.hashedIn(con) {
+		if err := sb.link(in); err != nil {
+			return err
+		}
+	}
+
+	// The counterpart of the current directory
+	// (if it is in the project)
+	// must exist,
+	// since commands run there by default.
+	if cwd := sb.path(""); cwd != "" {
+		if err := os.MkdirAll(cwd, 0755); err != nil {
+			return errors.Wrap(err, "creating directory in sandbox")
+		}
+	}
+	if !ft.noMkdir {
+		for _, out := range ft.Out {
+			if err := mkdirParent(sb.path(out)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if GetVerbose(ctx) {
+		con.Indentf("  Running %s in sandbox %s", con.Describe(ft.Target), sb.dir)
+	}
+
+	if err := con.Run(withSandbox(ctx, sb), ft.Target); err != nil {
+		return err
+	}
+
+	for _, out := range ft.Out {
+		if err := sb.moveOut(ctx, con, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// link adds symbolic links to the input file `in`
+// (or to the files in it, if it is a directory)
+// to the sandbox.
+func (sb *sandbox) link(in string) error {
+	abs, err := filepath.Abs(in)
+	if err != nil {
+		return errors.Wrapf(err, "getting absolute path of %s", in)
+	}
+	if _, ok := sb.rel(abs); !ok {
+		return nil
+	}
+	err = filepath.WalkDir(abs, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		dest := sb.path(path)
+		if d.IsDir() {
+			return errors.Wrapf(os.MkdirAll(dest, 0755), "creating directory %s", dest)
+		}
+		if err := mkdirParent(dest); err != nil {
+			return err
+		}
+		if err := os.Symlink(path, dest); err != nil && !errors.Is(err, fs.ErrExist) {
+			return errors.Wrapf(err, "creating symlink %s", dest)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		// A missing input is the subtarget's problem.
+		return nil
+	}
+	return errors.Wrapf(err, "linking %s into sandbox", in)
+}
+
+// moveOut moves the output file `out`
+// from the sandbox to its place in the project,
+// replacing anything already there.
+// It is not an error for out not to exist in the sandbox
+// (but see [StrictOutputs]).
+func (sb *sandbox) moveOut(ctx context.Context, con *Controller, out string) error {
+	src := sb.path(out)
+	if src == out {
+		return nil // not sandboxed
+	}
+	if _, err := os.Lstat(src); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err := os.RemoveAll(out); err != nil {
+		return errors.Wrapf(err, "removing %s", out)
+	}
+	if err := mkdirParent(out); err != nil {
+		return err
+	}
+	if err := os.Rename(src, out); err == nil {
+		return nil
+	}
+
+	// Perhaps the sandbox is on a different filesystem.
+	c := &copyTarget{Src: src, Dest: out}
+	return errors.Wrapf(c.Run(WithVerbose(ctx, false), con), "moving %s out of sandbox", out)
+}
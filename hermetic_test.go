@@ -0,0 +1,74 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHermetic(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		a   = filepath.Join(tmpdir, "src", "a")
+		b   = filepath.Join(tmpdir, "src", "b")
+		out = filepath.Join(tmpdir, "out", "ab")
+		ctx = context.Background()
+	)
+	if err := os.Mkdir(filepath.Join(tmpdir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(a, []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The subtarget reads the undeclared input b,
+	// which is missing from the sandbox.
+	con := NewController(tmpdir)
+	cmd := &Command{Shell: "cat src/a src/b > out/ab", Dir: tmpdir}
+	if err := con.Run(ctx, Files(cmd, []string{a}, []string{out}, Hermetic(true))); err == nil {
+		t.Error("got no error for undeclared input")
+	}
+
+	// Now with both inputs declared,
+	// and an undeclared output.
+	con = NewController(tmpdir)
+	cmd = &Command{Shell: "cat src/a src/b > out/ab; touch extra", Dir: tmpdir}
+	if err := con.Run(ctx, Files(cmd, []string{a, b}, []string{out}, Hermetic(true))); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "a\nb\n" {
+		t.Errorf("got %q, want %q", got, "a\nb\n")
+	}
+	if _, err := os.Stat(filepath.Join(tmpdir, "extra")); err == nil {
+		t.Error("undeclared output escaped the sandbox")
+	}
+
+	// Output written with StdoutFile,
+	// replacing the existing output.
+	con = NewController(tmpdir)
+	cmd = &Command{Shell: "cat a", Dir: filepath.Join(tmpdir, "src"), StdoutFile: out}
+	if err := con.Run(ctx, Files(cmd, []string{a}, []string{out}, Hermetic(true))); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = os.ReadFile(out); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "a\n" {
+		t.Errorf("got %q, want %q", got, "a\n")
+	}
+}
@@ -0,0 +1,156 @@
+// Package httpdb implements a hash database
+// (see fab.HashDB)
+// backed by a remote HTTP service,
+// so that the "already built" state can be shared
+// among CI workers and developers.
+//
+// The protocol is simple:
+// each hash is a resource named by its hex encoding under a base URL.
+// A HEAD request for the resource tells whether the hash is present
+// (status 200 for yes, 404 for no),
+// and a PUT request adds it.
+// This is compatible with plain object stores,
+// such as Google Cloud Storage,
+// as well as with [Handler],
+// which serves the protocol from any other hash database.
+package httpdb
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bobg/errors"
+)
+
+// DB is an implementation of fab.HashDB that uses a remote HTTP service for storage.
+type DB struct {
+	base   string
+	client *http.Client
+	header http.Header
+}
+
+// New creates a new *DB whose hashes live under the given base URL.
+func New(base string, opts ...Option) *DB {
+	result := &DB{
+		base:   strings.TrimSuffix(base, "/"),
+		client: http.DefaultClient,
+		header: make(http.Header),
+	}
+	for _, opt := range opts {
+		opt(result)
+	}
+	return result
+}
+
+// Option is the type of a config option that can be passed to New.
+type Option func(*DB)
+
+// WithClient is an Option that sets the HTTP client used for requests.
+// The default is http.DefaultClient.
+func WithClient(client *http.Client) Option {
+	return func(db *DB) {
+		db.client = client
+	}
+}
+
+// WithHeader is an Option that adds a header to every request,
+// e.g. for authorization.
+func WithHeader(key, val string) Option {
+	return func(db *DB) {
+		db.header.Add(key, val)
+	}
+}
+
+// Has tells whether db contains the given hash.
+func (db *DB) Has(ctx context.Context, h []byte) (bool, error) {
+	resp, err := db.do(ctx, http.MethodHead, h)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected status %s from %s", resp.Status, resp.Request.URL)
+	}
+}
+
+// Add adds a hash to db.
+func (db *DB) Add(ctx context.Context, h []byte) error {
+	resp, err := db.do(ctx, http.MethodPut, h)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, resp.Request.URL)
+	}
+	return nil
+}
+
+func (db *DB) do(ctx context.Context, method string, h []byte) (*http.Response, error) {
+	u := db.base + "/" + hex.EncodeToString(h)
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating %s request for %s", method, u)
+	}
+	for key, vals := range db.header {
+		req.Header[key] = vals
+	}
+	resp, err := db.client.Do(req)
+	return resp, errors.Wrapf(err, "in %s request for %s", method, u)
+}
+
+// Store is the interface of a hash database served by [Handler].
+// It is the same as fab.HashDB.
+type Store interface {
+	Has(context.Context, []byte) (bool, error)
+	Add(context.Context, []byte) error
+}
+
+// Handler produces an http.Handler that serves the contents of the given Store
+// using the protocol understood by [DB].
+// The hex-encoded hash is the last element of the request path.
+func Handler(store Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+		h, err := hex.DecodeString(name)
+		if err != nil || len(h) == 0 {
+			http.Error(w, "bad hash", http.StatusBadRequest)
+			return
+		}
+
+		switch req.Method {
+		case http.MethodHead, http.MethodGet:
+			has, err := store.Has(req.Context(), h)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !has {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+
+		case http.MethodPut:
+			if err := store.Add(req.Context(), h); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
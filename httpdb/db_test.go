@@ -0,0 +1,89 @@
+package httpdb_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"testing/quick"
+
+	"github.com/bobg/fab"
+	. "github.com/bobg/fab/httpdb"
+)
+
+type memStore struct {
+	mu sync.Mutex
+	m  map[string]bool
+}
+
+func (s *memStore) Has(_ context.Context, h []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m[string(h)], nil
+}
+
+func (s *memStore) Add(_ context.Context, h []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[string(h)] = true
+	return nil
+}
+
+func TestDB(t *testing.T) {
+	t.Parallel()
+
+	var (
+		store  = &memStore{m: make(map[string]bool)}
+		server = httptest.NewServer(Handler(store))
+		ctx    = context.Background()
+	)
+	defer server.Close()
+
+	var db fab.HashDB = New(server.URL+"/prefix/", WithClient(server.Client()))
+
+	err := quick.Check(func(s string) bool {
+		if len(s) == 0 {
+			return true
+		}
+		h := []byte(s)
+
+		has, err := db.Has(ctx, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has {
+			return true
+		}
+		if err = db.Add(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+		has, err = db.Has(ctx, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return has
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	t.Parallel()
+
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotAuth = req.Header.Get("Authorization")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	db := New(server.URL, WithClient(server.Client()), WithHeader("Authorization", "Bearer xyzzy"))
+	if _, err := db.Has(context.Background(), []byte("foo")); err == nil {
+		t.Error("got no error but wanted one")
+	}
+	if gotAuth != "Bearer xyzzy" {
+		t.Errorf("got Authorization %q, want %q", gotAuth, "Bearer xyzzy")
+	}
+}
@@ -0,0 +1,377 @@
+package fab
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// If produces a target that evaluates cond
+// and runs then if it is true,
+// or els if it is false.
+// Either target may be nil,
+// meaning do nothing in that case.
+//
+// This lets a platform- or environment-specific step
+// live alongside the others,
+// without shell conditionals in a [Command].
+//
+// An If target may be specified in YAML using the tag !If,
+// which introduces a mapping with Then and Else fields,
+// each a target or target name (and each optional),
+// and one or more of these condition fields:
+//
+//   - Env, the name of an environment variable that must be set to a non-empty value
+//     (see [EnvSet]);
+//   - Exists, a file that must exist,
+//     relative to the directory of the YAML file
+//     (see [FileExists]);
+//   - OS and Arch, values that runtime.GOOS and runtime.GOARCH must have
+//     (see [Platform]);
+//   - Command, a shell command that must exit successfully,
+//     run in the directory of the YAML file
+//     (see [CommandSucceeds]).
+//
+// When more than one condition is given,
+// all must be true.
+// Example:
+//
+//	Installer: !If
+//	  OS: windows
+//	  Then: !Command
+//	    Shell: makensis installer.nsi
+//	  Else: !Command
+//	    Shell: ./make-pkg.sh
+//
+// The tag !Unless takes the same condition fields
+// and a Target field,
+// and is the same as [Unless].
+func If(cond Condition, then, els Target) Target {
+	return &ifTarget{Cond: cond, Then: then, Else: els}
+}
+
+// Unless produces a target that runs target
+// only when cond is false.
+// It is the same as If(cond, nil, target).
+func Unless(cond Condition, target Target) Target {
+	return If(cond, nil, target)
+}
+
+type ifTarget struct {
+	Cond Condition
+	Then Target `json:",omitempty"`
+	Else Target `json:",omitempty"`
+}
+
+var _ Target = &ifTarget{}
+
+// Run implements Target.Run.
+func (t *ifTarget) Run(ctx context.Context, con *Controller) error {
+	ok, err := t.Cond.Eval(ctx, con)
+	if err != nil {
+		return errors.Wrapf(err, "evaluating condition %s", t.Cond)
+	}
+	if GetVerbose(ctx) {
+		con.Indentf("  Condition %s is %v", t.Cond, ok)
+	}
+
+	target := t.Else
+	if ok {
+		target = t.Then
+	}
+	if target == nil {
+		return nil
+	}
+	return con.Run(ctx, target)
+}
+
+// Desc implements Target.Desc.
+func (*ifTarget) Desc() string {
+	return "If"
+}
+
+// Children implements GraphChildren.
+func (t *ifTarget) Children() []Target {
+	var result []Target
+	if t.Then != nil {
+		result = append(result, t.Then)
+	}
+	if t.Else != nil {
+		result = append(result, t.Else)
+	}
+	return result
+}
+
+// Condition is the type of the test in an [If] target.
+type Condition interface {
+	// Eval tells whether the condition is true.
+	Eval(context.Context, *Controller) (bool, error)
+
+	// String describes the condition,
+	// for verbose output and error messages.
+	String() string
+}
+
+// EnvSet produces a [Condition] that is true
+// when the environment variable with the given name
+// is set to a non-empty value,
+// either in the process environment
+// or in the context (see [WithEnv]).
+func EnvSet(name string) Condition {
+	return envSetCond{Env: name}
+}
+
+type envSetCond struct {
+	Env string
+}
+
+func (c envSetCond) Eval(ctx context.Context, _ *Controller) (bool, error) {
+	val := os.Getenv(c.Env)
+	for _, kv := range GetEnv(ctx) {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == c.Env {
+			val = v
+		}
+	}
+	return val != "", nil
+}
+
+func (c envSetCond) String() string {
+	return fmt.Sprintf("$%s is set", c.Env)
+}
+
+// FileExists produces a [Condition] that is true
+// when the given file or directory exists.
+func FileExists(path string) Condition {
+	return fileExistsCond{Exists: path}
+}
+
+type fileExistsCond struct {
+	Exists string
+}
+
+func (c fileExistsCond) Eval(context.Context, *Controller) (bool, error) {
+	_, err := os.Stat(c.Exists)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c fileExistsCond) String() string {
+	return fmt.Sprintf("%s exists", c.Exists)
+}
+
+// Platform produces a [Condition] that is true
+// when runtime.GOOS is goos
+// and runtime.GOARCH is goarch.
+// An empty string for either one matches any value.
+func Platform(goos, goarch string) Condition {
+	return platformCond{OS: goos, Arch: goarch}
+}
+
+type platformCond struct {
+	OS   string `json:",omitempty"`
+	Arch string `json:",omitempty"`
+}
+
+func (c platformCond) Eval(context.Context, *Controller) (bool, error) {
+	return (c.OS == "" || c.OS == runtime.GOOS) && (c.Arch == "" || c.Arch == runtime.GOARCH), nil
+}
+
+func (c platformCond) String() string {
+	switch {
+	case c.OS == "":
+		return "arch is " + c.Arch
+	case c.Arch == "":
+		return "OS is " + c.OS
+	default:
+		return fmt.Sprintf("platform is %s/%s", c.OS, c.Arch)
+	}
+}
+
+// CommandSucceeds produces a [Condition] that is true
+// when the given shell command,
+// run in dir,
+// exits with a zero status.
+// The command runs with $SHELL,
+// or /bin/sh if that is not set
+// (see [Command] for Windows).
+//
+// The command runs even in dry-run mode (see [WithDryRun]),
+// so it should only test things,
+// not change them.
+func CommandSucceeds(dir, shell string) Condition {
+	return commandCond{Command: shell, Dir: dir}
+}
+
+type commandCond struct {
+	Command string
+	Dir     string `json:",omitempty"`
+}
+
+func (c commandCond) Eval(ctx context.Context, con *Controller) (bool, error) {
+	sh, args := shellArgv(shellProgram(), c.Command)
+	cmd := exec.CommandContext(ctx, sh, args...)
+	setShellCmdLine(cmd)
+	cmd.Dir = c.Dir
+	cmd.Env = append(con.baseEnv(false, nil), GetEnv(ctx)...)
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c commandCond) String() string {
+	return fmt.Sprintf("command %q succeeds", c.Command)
+}
+
+// Not produces a [Condition] that is true when cond is false.
+func Not(cond Condition) Condition {
+	return notCond{Not: cond}
+}
+
+type notCond struct {
+	Not Condition
+}
+
+func (c notCond) Eval(ctx context.Context, con *Controller) (bool, error) {
+	ok, err := c.Not.Eval(ctx, con)
+	return !ok, err
+}
+
+func (c notCond) String() string {
+	return fmt.Sprintf("not (%s)", c.Not)
+}
+
+// allCond is true when all of its conditions are.
+// It is what a YAML !If node with more than one condition field produces.
+type allCond struct {
+	All []Condition
+}
+
+func (c allCond) Eval(ctx context.Context, con *Controller) (bool, error) {
+	for _, cond := range c.All {
+		if ok, err := cond.Eval(ctx, con); err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (c allCond) String() string {
+	strs := make([]string, 0, len(c.All))
+	for _, cond := range c.All {
+		strs = append(strs, cond.String())
+	}
+	return strings.Join(strs, " and ")
+}
+
+// yamlCond holds the condition fields of an !If or !Unless node.
+type yamlCond struct {
+	Env     string `yaml:"Env"`
+	Exists  string `yaml:"Exists"`
+	OS      string `yaml:"OS"`
+	Arch    string `yaml:"Arch"`
+	Command string `yaml:"Command"`
+}
+
+func (y yamlCond) toCondition(con *Controller, dir string) (Condition, error) {
+	var conds []Condition
+	if y.Env != "" {
+		conds = append(conds, EnvSet(y.Env))
+	}
+	if y.Exists != "" {
+		conds = append(conds, FileExists(con.JoinPath(dir, y.Exists)))
+	}
+	if y.OS != "" || y.Arch != "" {
+		conds = append(conds, Platform(y.OS, y.Arch))
+	}
+	if y.Command != "" {
+		conds = append(conds, CommandSucceeds(con.JoinPath(dir), y.Command))
+	}
+
+	switch len(conds) {
+	case 0:
+		return nil, fmt.Errorf("no condition (one or more of Env, Exists, OS, Arch, Command)")
+	case 1:
+		return conds[0], nil
+	default:
+		return allCond{All: conds}, nil
+	}
+}
+
+func ifDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var yif struct {
+		yamlCond `yaml:",inline"`
+		Then     yaml.Node `yaml:"Then"`
+		Else     yaml.Node `yaml:"Else"`
+	}
+	if err := node.Decode(&yif); err != nil {
+		return nil, errors.Wrap(err, "YAML error in If node")
+	}
+
+	cond, err := yif.toCondition(con, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "in If node")
+	}
+
+	var then, els Target
+	if yif.Then.Kind != 0 {
+		if then, err = con.YAMLTarget(&yif.Then, dir); err != nil {
+			return nil, errors.Wrap(err, "YAML error in If.Then node")
+		}
+	}
+	if yif.Else.Kind != 0 {
+		if els, err = con.YAMLTarget(&yif.Else, dir); err != nil {
+			return nil, errors.Wrap(err, "YAML error in If.Else node")
+		}
+	}
+
+	return If(cond, then, els), nil
+}
+
+func unlessDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var yunless struct {
+		yamlCond `yaml:",inline"`
+		Target   yaml.Node `yaml:"Target"`
+	}
+	if err := node.Decode(&yunless); err != nil {
+		return nil, errors.Wrap(err, "YAML error in Unless node")
+	}
+
+	cond, err := yunless.toCondition(con, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "in Unless node")
+	}
+	target, err := con.YAMLTarget(&yunless.Target, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Unless.Target node")
+	}
+
+	return Unless(cond, target), nil
+}
+
+func init() {
+	RegisterYAMLTarget("If", ifDecoder)
+	SetYAMLTagDoc("If", "Run one of two targets according to a condition on the environment, files, platform, or a command.")
+	RegisterYAMLTarget("Unless", unlessDecoder)
+	SetYAMLTagDoc("Unless", "Run a target unless a condition on the environment, files, platform, or a command holds.")
+}
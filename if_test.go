@@ -0,0 +1,132 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestIf(t *testing.T) {
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpdir, "present"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithEnv(context.Background(), []string{"FAB_IF_TEST=1"})
+
+	cases := []struct {
+		name string
+		cond Condition
+		want bool
+	}{
+		{"env set", EnvSet("FAB_IF_TEST"), true},
+		{"env unset", EnvSet("FAB_IF_TEST_UNSET"), false},
+		{"file exists", FileExists(filepath.Join(tmpdir, "present")), true},
+		{"file missing", FileExists(filepath.Join(tmpdir, "absent")), false},
+		{"this os", Platform(runtime.GOOS, ""), true},
+		{"this platform", Platform(runtime.GOOS, runtime.GOARCH), true},
+		{"other arch", Platform("", "no-such-arch"), false},
+		{"command succeeds", CommandSucceeds(tmpdir, "test -f present"), true},
+		{"command fails", CommandSucceeds(tmpdir, "test -f absent"), false},
+		{"not", Not(EnvSet("FAB_IF_TEST")), false},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			var then, els countTarget
+			if err := NewController("").Run(ctx, If(c.cond, &then, &els)); err != nil {
+				t.Fatal(err)
+			}
+			wantThen, wantElse := uint32(0), uint32(1)
+			if c.want {
+				wantThen, wantElse = 1, 0
+			}
+			if then.count != wantThen || els.count != wantElse {
+				t.Errorf("got then=%d else=%d, want then=%d else=%d", then.count, els.count, wantThen, wantElse)
+			}
+		})
+	}
+}
+
+func TestUnless(t *testing.T) {
+	t.Parallel()
+
+	var ct countTarget
+	if err := NewController("").Run(context.Background(), Unless(Platform("no-such-os", ""), &ct)); err != nil {
+		t.Fatal(err)
+	}
+	if ct.count != 1 {
+		t.Errorf("got count %d, want 1", ct.count)
+	}
+}
+
+func TestIfYAML(t *testing.T) {
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpdir, "present"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	yml := `
+Both: !If
+  Exists: present
+  OS: ` + runtime.GOOS + `
+  Then: !Command
+    Shell: echo then > out1
+  Else: !Command
+    Shell: echo else > out1
+
+NoElse: !If
+  Command: test -f absent
+  Then: !Command
+    Shell: echo then > out2
+
+Skipped: !Unless
+  Exists: present
+  Target: !Command
+    Shell: echo unless > out3
+`
+
+	con := NewController(tmpdir)
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"Both", "NoElse", "Skipped"} {
+		target, _ := con.RegistryTarget(name)
+		if err := con.Run(context.Background(), target); err != nil {
+			t.Fatalf("running %s: %s", name, err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpdir, "out1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "then" {
+		t.Errorf("got %q in out1, want then", got)
+	}
+	for _, name := range []string{"out2", "out3"} {
+		if _, err := os.Stat(filepath.Join(tmpdir, name)); err == nil {
+			t.Errorf("%s exists but should not", name)
+		}
+	}
+
+	const bad = `
+Bad: !If
+  Then: !Command
+    Shell: echo hello
+`
+	con = NewController(tmpdir)
+	if err := con.ReadYAML(strings.NewReader(bad), ""); err == nil {
+		t.Error("got no error for If without a condition")
+	}
+}
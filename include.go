@@ -0,0 +1,171 @@
+package fab
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/slices"
+	"gopkg.in/yaml.v3"
+)
+
+// readIncludeDecl handles the _include declaration in a YAML file.
+// It names one or more other YAML files
+// whose targets are to be read as if they appeared in this one.
+// Each entry is either the name of a file,
+// or a mapping with these fields:
+//
+//   - File: the name of the file
+//   - Prefix: a string to add to the beginning of the name of each target in the file
+//
+// File names are relative to the directory of the including file.
+// Within an included file with a prefix,
+// references to the file's own targets by bare name
+// refer to the prefixed targets.
+//
+// An included file is like a fab.yaml file,
+// except that it may not have a _dir declaration.
+// Its targets are registered in the including file's directory,
+// and relative file names in its targets
+// are relative to that directory too.
+//
+// Example:
+//
+//	_include:
+//	  - ../shared/ci.yaml
+//	  - File: generated/rules.yaml
+//	    Prefix: gen_
+//
+// A single file may also be included using the !Include tag,
+// with the name of the entry (followed by a period) as the prefix.
+// In this example,
+// the target Build in rules.yaml becomes gen.Build:
+//
+//	gen: !Include generated/rules.yaml
+func (con *Controller) readIncludeDecl(node *yaml.Node, dir, filedir, prefix string, including []string) error {
+	var entries []*yaml.Node
+
+	switch node.Kind {
+	case yaml.ScalarNode, yaml.MappingNode:
+		entries = []*yaml.Node{node}
+	case yaml.SequenceNode:
+		entries = node.Content
+	default:
+		return BadYAMLNodeKindError{Got: node.Kind, Want: yaml.SequenceNode}
+	}
+
+	for _, entry := range entries {
+		entry = con.interpolateYAML(entry, dir)
+
+		var file, entryPrefix string
+
+		switch entry.Kind {
+		case yaml.ScalarNode:
+			file = entry.Value
+
+		case yaml.MappingNode:
+			var yinclude struct {
+				File   string `yaml:"File"`
+				Prefix string `yaml:"Prefix"`
+			}
+			if err := entry.Decode(&yinclude); err != nil {
+				return errors.Wrap(err, "decoding _include entry")
+			}
+			file, entryPrefix = yinclude.File, yinclude.Prefix
+
+		default:
+			return BadYAMLNodeKindError{Got: entry.Kind, Want: yaml.ScalarNode}
+		}
+
+		if file == "" {
+			return fmt.Errorf("no file in _include entry")
+		}
+		if strings.Contains(entryPrefix, "/") {
+			return fmt.Errorf("no slashes in _include prefix %s", entryPrefix)
+		}
+
+		if err := con.includeYAMLFile(filepath.Join(filedir, file), dir, prefix+entryPrefix, including); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// includeTagged handles a top-level entry with the !Include tag.
+// See readIncludeDecl.
+func (con *Controller) includeTagged(node *yaml.Node, dir, filedir, prefix string, including []string) error {
+	if node.Kind != yaml.ScalarNode {
+		return BadYAMLNodeKindError{Got: node.Kind, Want: yaml.ScalarNode}
+	}
+	return con.includeYAMLFile(filepath.Join(filedir, node.Value), dir, prefix, including)
+}
+
+// includeYAMLFile reads the targets in an included YAML file.
+// See readIncludeDecl.
+func (con *Controller) includeYAMLFile(filename, dir, prefix string, including []string) error {
+	filename = filepath.Clean(filename)
+	if slices.Index(including, filename) >= 0 {
+		return fmt.Errorf("include cycle: %s", strings.Join(append(including, filename), " -> "))
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrapf(err, "opening included file %s", filename)
+	}
+	defer f.Close()
+
+	con.addYAMLFile(filename)
+
+	m, err := decodeYAMLMapping(f)
+	if err != nil {
+		return errors.Wrapf(err, "in included file %s", filename)
+	}
+
+	// Make bare references to this file's targets
+	// refer to their prefixed names.
+	var renames map[string]string
+	if prefix != "" {
+		renames = make(map[string]string)
+		for i := 0; i < len(m.Content); i += 2 {
+			name := m.Content[i].Value
+			if !strings.HasPrefix(name, "_") {
+				renames[name] = prefix + name
+			}
+		}
+	}
+	old := con.swapYAMLRenames(renames)
+	defer con.swapYAMLRenames(old)
+
+	_, err = con.readYAMLMapping(m, dir, filepath.Dir(filename), prefix, append(including, filename))
+	return errors.Wrapf(err, "in included file %s", filename)
+}
+
+// swapYAMLRenames sets the mapping used by renameYAMLRef,
+// returning the old one.
+func (con *Controller) swapYAMLRenames(renames map[string]string) map[string]string {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	old := con.yamlRenames
+	con.yamlRenames = renames
+	return old
+}
+
+// renameYAMLRef returns the name to use
+// for a bare reference to a target named in a YAML file.
+// This is the name itself,
+// unless the file is included with a prefix
+// (see readIncludeDecl)
+// and defines a target by that name.
+func (con *Controller) renameYAMLRef(name string) string {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	if renamed, ok := con.yamlRenames[name]; ok {
+		return renamed
+	}
+	return name
+}
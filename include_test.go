@@ -0,0 +1,61 @@
+package fab
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInclude(t *testing.T) {
+	t.Parallel()
+
+	con := NewController("_testdata/include")
+	if err := con.ReadYAMLFile(""); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		got  = con.RegistryNames()
+		want = []string{"Common", "Top", "ci_Check", "ci_Lint", "gen.Check", "gen.Lint"}
+	)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got names %v, want %v", got, want)
+	}
+
+	for _, prefix := range []string{"ci_", "gen."} {
+		check, doc := con.RegistryTarget(prefix + "Check")
+		if doc != "Check runs all the CI checks." {
+			t.Errorf("got doc %q for %sCheck", doc, prefix)
+		}
+		a, ok := check.(*all)
+		if !ok {
+			t.Fatalf("got %T for %sCheck, want *all", check, prefix)
+		}
+		d, ok := a.Targets[0].(*deferredResolutionTarget)
+		if !ok {
+			t.Fatalf("got %T for subtarget of %sCheck, want *deferredResolutionTarget", a.Targets[0], prefix)
+		}
+		if d.Name != prefix+"Lint" {
+			t.Errorf("subtarget of %sCheck refers to %s, want %sLint", prefix, d.Name, prefix)
+		}
+	}
+
+	top, _ := con.RegistryTarget("Top")
+	if err := con.Run(context.Background(), top); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	t.Parallel()
+
+	con := NewController("_testdata/include/cycle")
+	err := con.ReadYAMLFile("")
+	if err == nil {
+		t.Fatal("got no error, want one")
+	}
+	if !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("got error %q, want an include cycle", err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package fab
+
+import "io/fs"
+
+// fileInode returns 0,
+// since inode numbers are not available on this platform.
+func fileInode(fs.FileInfo) uint64 {
+	return 0
+}
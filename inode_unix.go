@@ -0,0 +1,17 @@
+//go:build unix
+
+package fab
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileInode returns the inode number of the file described by info,
+// or 0 if it is not available.
+func fileInode(info fs.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,166 @@
+// Package faketool helps test Fab targets that run external tools
+// (compilers, package managers, and so on)
+// by running them against shell-script stand-ins.
+package faketool
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/bobg/errors"
+	"github.com/otiai10/copy"
+
+	"github.com/bobg/fab"
+)
+
+// LogVar is the name of the environment variable
+// holding the file in which fake tools log their invocations.
+// A fake tool does that by starting with:
+//
+//	echo "$(basename "$0") $@" >> "$FAKETOOL_LOG"
+const LogVar = "FAKETOOL_LOG"
+
+// Env is a temporary copy of a test-data tree
+// for running Fab targets against fake tools.
+type Env struct {
+	// Dir is the top directory of the copy.
+	Dir string
+
+	// Ctx is the context for running targets.
+	// It has a hash DB and is verbose when the test is.
+	// Callers may add to it.
+	Ctx context.Context
+
+	logfile string
+}
+
+// New copies the tree at testdata
+// (normally a subdirectory of the calling package's _testdata dir)
+// to a new temporary directory.
+// If the tree has a bin subdirectory of fake tools,
+// it is put at the front of PATH
+// and LogVar is set for the duration of the test.
+// The tree's fab.yaml file, if any, defines the targets for Run.
+//
+// Fake tools are shell scripts,
+// so a test using them is skipped on Windows.
+func New(t *testing.T, testdata string) *Env {
+	t.Helper()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpdir) })
+
+	e := &Env{
+		Dir:     filepath.Join(tmpdir, "top"),
+		logfile: filepath.Join(tmpdir, "log"),
+	}
+	if err := copy.Copy(testdata, e.Dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(e.Path("bin")); err == nil {
+		if runtime.GOOS == "windows" {
+			t.Skip("fake tools are shell scripts")
+		}
+		t.Setenv("PATH", e.Path("bin")+string(os.PathListSeparator)+os.Getenv("PATH"))
+		t.Setenv(LogVar, e.logfile)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal(err)
+	}
+
+	db, err := fab.OpenHashDB(filepath.Join(tmpdir, "fab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+	ctx = fab.WithVerbose(ctx, testing.Verbose())
+	e.Ctx = fab.WithHashDB(ctx, db)
+
+	return e
+}
+
+// Path returns the path of a file in the tree.
+func (e *Env) Path(elems ...string) string {
+	return filepath.Join(append([]string{e.Dir}, elems...)...)
+}
+
+// WriteFile writes a file in the tree,
+// creating its directory if needed.
+func (e *Env) WriteFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	filename := e.Path(name)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Run runs the named target from the tree's fab.yaml file
+// with a new controller
+// and returns the fake-tool invocations it caused.
+// See RunTarget.
+func (e *Env) Run(t *testing.T, name string) []string {
+	t.Helper()
+
+	con := fab.NewController(e.Dir)
+	if err := con.ReadYAMLFile(""); err != nil {
+		t.Fatal(err)
+	}
+	target, _ := con.RegistryTarget(name)
+	if target == nil {
+		t.Fatalf("no target %s", name)
+	}
+	return e.run(t, con, target)
+}
+
+// RunTarget runs target with a new controller
+// and returns the fake-tool invocations it caused,
+// one per line of the log,
+// with the tree's top directory removed from file names
+// (so "$TOP/src/main.c" appears as "src/main.c").
+func (e *Env) RunTarget(t *testing.T, target fab.Target) []string {
+	t.Helper()
+
+	return e.run(t, fab.NewController(e.Dir), target)
+}
+
+func (e *Env) run(t *testing.T, con *fab.Controller, target fab.Target) []string {
+	t.Helper()
+
+	if err := os.Remove(e.logfile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal(err)
+	}
+	if err := con.Run(e.Ctx, target); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := os.ReadFile(e.logfile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		result []string
+		prefix = e.Dir + string(filepath.Separator)
+	)
+	for _, line := range strings.Split(strings.TrimSpace(string(log)), "\n") {
+		result = append(result, strings.ReplaceAll(line, prefix, ""))
+	}
+	return result
+}
@@ -0,0 +1,25 @@
+package faketool
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	e := New(t, "_testdata")
+
+	cases := []struct {
+		desc string
+		want []string
+	}{
+		{desc: "first run", want: []string{"tool hello x"}},
+
+		// Each run sees only its own invocations.
+		{desc: "second run", want: []string{"tool hello x"}},
+	}
+	for _, tc := range cases {
+		if got := e.Run(t, "Tool"); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.desc, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package js
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bobg/fab"
+)
+
+// manager describes a JavaScript package manager as used in a particular directory.
+type manager struct {
+	name     string
+	lockfile string   // relative to the package directory; empty if there is none
+	install  []string // arguments for installing dependencies
+	marker   string   // file written by installing dependencies, relative to the package directory
+}
+
+// detect determines the package manager used in dir
+// from the lockfile present there.
+// Without a lockfile,
+// the package manager is npm.
+func detect(dir string) (*manager, error) {
+	if _, err := os.Stat(filepath.Join(dir, "package.json")); err != nil {
+		return nil, errors.Wrapf(err, "checking for package.json in %s", dir)
+	}
+
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	switch {
+	case exists("pnpm-lock.yaml"):
+		return &manager{
+			name:     "pnpm",
+			lockfile: "pnpm-lock.yaml",
+			install:  []string{"install", "--frozen-lockfile"},
+			marker:   "node_modules/.modules.yaml",
+		}, nil
+
+	case exists("yarn.lock") && exists(".yarnrc.yml"):
+		// Yarn 2 or later.
+		return &manager{
+			name:     "yarn",
+			lockfile: "yarn.lock",
+			install:  []string{"install", "--immutable"},
+			marker:   ".yarn/install-state.gz",
+		}, nil
+
+	case exists("yarn.lock"):
+		return &manager{
+			name:     "yarn",
+			lockfile: "yarn.lock",
+			install:  []string{"install", "--frozen-lockfile"},
+			marker:   "node_modules/.yarn-integrity",
+		}, nil
+
+	case exists("package-lock.json"):
+		return &manager{
+			name:     "npm",
+			lockfile: "package-lock.json",
+			install:  []string{"ci"},
+			marker:   "node_modules/.package-lock.json",
+		}, nil
+	}
+
+	return &manager{
+		name:    "npm",
+		install: []string{"install"},
+		marker:  "node_modules/.package-lock.json",
+	}, nil
+}
+
+// Manager tells which package manager is used for the JavaScript package in dir:
+// "pnpm", "yarn", or "npm".
+// This is determined by the lockfile present in dir
+// (pnpm-lock.yaml, yarn.lock, or package-lock.json).
+// Without one,
+// the package manager is npm.
+func Manager(dir string) (string, error) {
+	m, err := detect(dir)
+	if err != nil {
+		return "", err
+	}
+	return m.name, nil
+}
+
+// packageFiles returns package.json and the lockfile (if any) in dir.
+func (m *manager) packageFiles(dir string) []string {
+	result := []string{filepath.Join(dir, "package.json")}
+	if m.lockfile != "" {
+		result = append(result, filepath.Join(dir, m.lockfile))
+	}
+	return result
+}
+
+// Install produces a target that installs the dependencies of the JavaScript package in `dir`,
+// using the package manager determined by [Manager].
+// When there is a lockfile,
+// the installation uses exactly the versions in it
+// (e.g. with `npm ci`).
+//
+// Install is implemented in terms of [fab.Files],
+// with package.json and the lockfile as inputs.
+// The output is a file that the package manager writes when installing,
+// such as node_modules/.package-lock.json for npm,
+// rather than the whole node_modules directory,
+// which would be costly to hash.
+// Any opts are passed through to fab.Files.
+//
+// A [Script] target in the same directory
+// has that file as an input,
+// so running the Script target
+// runs the Install target first
+// when the dependencies are out of date.
+//
+// An Install target may be specified in YAML using the tag !js.Install,
+// which introduces a mapping whose field is:
+//
+//   - Dir: the directory containing package.json,
+//     either absolute or relative to the directory containing the YAML file
+func Install(dir string, opts ...fab.FilesOpt) (fab.Target, error) {
+	m, err := detect(dir)
+	if err != nil {
+		return nil, err
+	}
+	c := &fab.Command{
+		Cmd:  m.name,
+		Args: m.install,
+		Dir:  dir,
+	}
+	return fab.Files(c, m.packageFiles(dir), []string{filepath.Join(dir, m.marker)}, opts...), nil
+}
+
+// MustInstall is the same as [Install] but panics on error.
+func MustInstall(dir string, opts ...fab.FilesOpt) fab.Target {
+	target, err := Install(dir, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+func installDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var i struct {
+		Dir string `yaml:"Dir"`
+	}
+	if err := node.Decode(&i); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding js.Install")
+	}
+
+	return Install(con.JoinPath(dir, i.Dir))
+}
+
+// Script produces a target that runs the script named `script` in the package.json file in `dir`,
+// using the package manager determined by [Manager],
+// as in `npm run SCRIPT`.
+// Any args are passed to the script.
+//
+// Script is implemented in terms of [fab.Files].
+// Its inputs are package.json,
+// the lockfile,
+// the file that shows the dependencies are installed
+// (see [Install]),
+// and the files matching the patterns in `src`.
+// Each pattern is interpreted relative to dir
+// with the syntax of [fs.Glob];
+// a pattern matching a directory includes all the files in its tree.
+// The script's output files are `out`
+// (absolute or relative to the current directory),
+// which are automatically selected for "autocleaning."
+// See [fab.Autoclean] for more about this feature.
+//
+// A Script target may be specified in YAML using the tag !js.Script,
+// which introduces a mapping whose fields are:
+//
+//   - Dir: the directory containing package.json
+//   - Script: the name of the script
+//   - Src: a sequence of patterns for the script's source files
+//   - Out: a sequence of the script's output files
+//   - Args: a sequence of additional arguments for the script
+//
+// Dir and the files in Out are either absolute or relative to the directory containing the YAML file.
+// The patterns in Src are relative to Dir.
+func Script(dir, script string, src, out []string, args ...string) (fab.Target, error) {
+	m, err := detect(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	in := set.New(m.packageFiles(dir)...)
+	in.Add(filepath.Join(dir, m.marker))
+
+	fsys := os.DirFS(dir)
+	for _, pattern := range src {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "in pattern %s", pattern)
+		}
+		for _, match := range matches {
+			in.Add(filepath.Join(dir, match))
+		}
+	}
+
+	inSlice := in.Slice()
+	sort.Strings(inSlice)
+
+	cmdArgs := []string{"run", script}
+	if len(args) > 0 {
+		if m.name == "npm" {
+			// Without this, npm would take the args as its own options.
+			cmdArgs = append(cmdArgs, "--")
+		}
+		cmdArgs = append(cmdArgs, args...)
+	}
+	c := &fab.Command{
+		Cmd:  m.name,
+		Args: cmdArgs,
+		Dir:  dir,
+	}
+	return fab.Files(c, inSlice, out, fab.Autoclean(true)), nil
+}
+
+// MustScript is the same as [Script] but panics on error.
+func MustScript(dir, script string, src, out []string, args ...string) fab.Target {
+	target, err := Script(dir, script, src, out, args...)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+func scriptDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var s struct {
+		Dir    string    `yaml:"Dir"`
+		Script string    `yaml:"Script"`
+		Src    yaml.Node `yaml:"Src"`
+		Out    yaml.Node `yaml:"Out"`
+		Args   yaml.Node `yaml:"Args"`
+	}
+	if err := node.Decode(&s); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding js.Script")
+	}
+	if s.Script == "" {
+		return nil, errors.New("YAML error decoding js.Script: no Script")
+	}
+
+	src, err := con.YAMLStringList(&s.Src, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding js.Script.Src")
+	}
+	out, err := con.YAMLFileList(&s.Out, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding js.Script.Out")
+	}
+	args, err := con.YAMLStringList(&s.Args, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding js.Script.Args")
+	}
+
+	return Script(con.JoinPath(dir, s.Dir), s.Script, src, out, args...)
+}
+
+func init() {
+	fab.RegisterYAMLTarget("js.Install", installDecoder)
+	fab.SetYAMLTagDoc("js.Install", "Install the dependencies of a JavaScript package.")
+	fab.RegisterYAMLTarget("js.Script", scriptDecoder)
+	fab.SetYAMLTagDoc("js.Script", "Run a script from a JavaScript package.json file.")
+}
@@ -0,0 +1,97 @@
+package js
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bobg/fab/internal/faketool"
+)
+
+func TestManager(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		files []string
+		want  string
+	}{
+		{files: nil, want: "npm"},
+		{files: []string{"package-lock.json"}, want: "npm"},
+		{files: []string{"yarn.lock"}, want: "yarn"},
+		{files: []string{"yarn.lock", ".yarnrc.yml"}, want: "yarn"},
+		{files: []string{"pnpm-lock.yaml"}, want: "pnpm"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.want+"_"+strings.Join(tc.files, "_"), func(t *testing.T) {
+			t.Parallel()
+
+			tmpdir, err := os.MkdirTemp("", "fab")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmpdir)
+
+			for _, name := range append(tc.files, "package.json") {
+				if err := os.WriteFile(filepath.Join(tmpdir, name), []byte("{}"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := Manager(tmpdir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("no_package_json", func(t *testing.T) {
+		t.Parallel()
+
+		tmpdir, err := os.MkdirTemp("", "fab")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(tmpdir)
+
+		if _, err := Manager(tmpdir); err == nil {
+			t.Error("got no error for directory without package.json")
+		}
+	})
+}
+
+func TestInstallScript(t *testing.T) {
+	e := faketool.New(t, "_testdata")
+
+	// run runs the Build target with a new controller
+	// and returns the npm commands that ran.
+	run := func() string {
+		t.Helper()
+		return strings.Join(e.Run(t, "Build"), "\n")
+	}
+
+	if got, want := run(), "npm ci\nnpm run build -- app.js"; got != want {
+		t.Errorf("first run: got npm commands %q, want %q", got, want)
+	}
+	got, err := os.ReadFile(e.Path("web", "dist", "app.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "console.log(1);\n" {
+		t.Errorf("got output %q, want %q", got, "console.log(1);\n")
+	}
+
+	if got := run(); got != "" {
+		t.Errorf("second run: got npm commands %q, want none", got)
+	}
+
+	e.WriteFile(t, "web/src/main.js", "console.log(2);\n")
+	if got, want := run(), "npm run build -- app.js"; got != want {
+		t.Errorf("after changing source: got npm commands %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,305 @@
+// Package jvm contains Fab target types for compiling Java and Kotlin code
+// and packaging it in jar files.
+package jvm
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bobg/fab"
+)
+
+// Javac produces a target that compiles Java source files into class files in outdir,
+// running `javac -d OUTDIR -cp CLASSPATH FLAGS SOURCES`.
+//
+// Each entry in src is a .java file
+// or a directory,
+// which stands for all the .java files in its tree.
+// The entries in classpath are jar files or directories of class files,
+// such as the output of another Javac target.
+//
+// Javac is implemented in terms of [fab.Files].
+// Its inputs are the source files and the classpath entries,
+// and its output is outdir,
+// which is automatically selected for "autocleaning."
+// See [fab.Autoclean] for more about this feature.
+// The version of javac also goes into the hash of the target
+// (see [fab.Command]'s HashTool field).
+// Any existing outdir is removed before javac runs,
+// so that it contains no stale classes from deleted source files.
+//
+// A Javac target may be specified in YAML using the tag !jvm.Javac,
+// which introduces a mapping whose fields are:
+//
+//   - Src: a sequence of source files and directories
+//   - Classpath: a sequence of jar files and directories
+//   - Out: the output directory
+//   - Flags: a sequence of additional flags for javac
+//
+// The files and directories are either absolute or relative to the directory containing the YAML file.
+func Javac(src, classpath []string, outdir string, flags ...string) (fab.Target, error) {
+	return compile("javac", "jvm.Javac", []string{".java"}, src, classpath, outdir, flags)
+}
+
+// MustJavac is the same as [Javac] but panics on error.
+func MustJavac(src, classpath []string, outdir string, flags ...string) fab.Target {
+	target, err := Javac(src, classpath, outdir, flags...)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+// Kotlinc is like [Javac] but compiles Kotlin source files with kotlinc.
+// A directory in src stands for all the .kt and .java files in its tree;
+// kotlinc reads the Java files for references to Java code from Kotlin,
+// but does not compile them.
+// For a module that mixes the two languages,
+// compile it with Kotlinc first
+// and then with Javac,
+// with the Kotlinc output directory in the Javac classpath.
+//
+// A Kotlinc target may be specified in YAML using the tag !jvm.Kotlinc,
+// which introduces a mapping with the same fields as !jvm.Javac.
+func Kotlinc(src, classpath []string, outdir string, flags ...string) (fab.Target, error) {
+	return compile("kotlinc", "jvm.Kotlinc", []string{".kt", ".java"}, src, classpath, outdir, flags)
+}
+
+// MustKotlinc is the same as [Kotlinc] but panics on error.
+func MustKotlinc(src, classpath []string, outdir string, flags ...string) fab.Target {
+	target, err := Kotlinc(src, classpath, outdir, flags...)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+func compile(compiler, desc string, exts, src, classpath []string, outdir string, flags []string) (fab.Target, error) {
+	if outdir == "" {
+		return nil, errors.New("no output directory")
+	}
+
+	sources, err := sourceFiles(src, exts)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return nil, errors.New("no source files")
+	}
+
+	args := []string{"-d", outdir}
+	if len(classpath) > 0 {
+		args = append(args, "-cp", strings.Join(classpath, string(os.PathListSeparator)))
+	}
+	args = append(args, flags...)
+	args = append(args, sources...)
+
+	c := &compileCmd{
+		Command: &fab.Command{
+			Cmd:      compiler,
+			Args:     args,
+			HashTool: "-version",
+		},
+		OutDir: outdir,
+		desc:   desc,
+	}
+
+	in := append(sources, classpath...)
+	return fab.Files(c, in, []string{outdir}, fab.Autoclean(true)), nil
+}
+
+// sourceFiles expands the directories in src
+// to the files in their trees having one of the given extensions.
+// The result is sorted.
+func sourceFiles(src, exts []string) ([]string, error) {
+	extSet := set.New(exts...)
+	result := set.New[string]()
+	for _, s := range src {
+		info, err := os.Stat(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "statting %s", s)
+		}
+		if !info.IsDir() {
+			result.Add(s)
+			continue
+		}
+		err = filepath.WalkDir(s, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.Type().IsRegular() && extSet.Has(filepath.Ext(path)) {
+				result.Add(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "walking %s", s)
+		}
+	}
+	slice := result.Slice()
+	sort.Strings(slice)
+	return slice, nil
+}
+
+// compileCmd is the subtarget of a [Javac] or [Kotlinc] target.
+type compileCmd struct {
+	Command *fab.Command
+	OutDir  string
+	desc    string
+}
+
+var (
+	_ fab.Target        = &compileCmd{}
+	_ fab.GraphChildren = &compileCmd{}
+)
+
+// Run implements fab.Target.Run.
+func (c *compileCmd) Run(ctx context.Context, con *fab.Controller) error {
+	if !fab.GetDryRun(ctx) {
+		if err := os.RemoveAll(c.OutDir); err != nil {
+			return errors.Wrapf(err, "removing %s", c.OutDir)
+		}
+	}
+	return con.Run(ctx, c.Command)
+}
+
+// Desc implements fab.Target.Desc.
+func (c *compileCmd) Desc() string {
+	return c.desc
+}
+
+// Children implements fab.GraphChildren.
+func (c *compileCmd) Children() []fab.Target {
+	return []fab.Target{c.Command}
+}
+
+// Jar produces a target that packages the contents of the directories in dirs
+// (such as the output directory of a [Javac] target,
+// and directories of resources)
+// into the jar file out,
+// running `jar cf OUT -C DIR . ...`.
+// If mainClass is not empty,
+// it is recorded in the jar's manifest as the class to run with `java -jar`.
+//
+// Jar is implemented in terms of [fab.Files],
+// with dirs as inputs and out as the output,
+// which is automatically selected for "autocleaning."
+// See [fab.Autoclean] for more about this feature.
+//
+// A Jar target may be specified in YAML using the tag !jvm.Jar,
+// which introduces a mapping whose fields are:
+//
+//   - Out: the jar file
+//   - Dirs: a sequence of directories whose contents go into the jar
+//   - Main: the main class
+//
+// Out and Dirs are either absolute or relative to the directory containing the YAML file.
+func Jar(out string, dirs []string, mainClass string) (fab.Target, error) {
+	if out == "" {
+		return nil, errors.New("no output file")
+	}
+	if len(dirs) == 0 {
+		return nil, errors.New("no directories")
+	}
+
+	args := []string{"cf", out}
+	if mainClass != "" {
+		args = []string{"cfe", out, mainClass}
+	}
+	for _, dir := range dirs {
+		args = append(args, "-C", dir, ".")
+	}
+
+	c := &fab.Command{
+		Cmd:  "jar",
+		Args: args,
+	}
+	return fab.Files(c, dirs, []string{out}, fab.Autoclean(true)), nil
+}
+
+// MustJar is the same as [Jar] but panics on error.
+func MustJar(out string, dirs []string, mainClass string) fab.Target {
+	target, err := Jar(out, dirs, mainClass)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+func compileDecoder(tag string, fn func(src, classpath []string, outdir string, flags ...string) (fab.Target, error)) fab.YAMLTargetFunc {
+	return func(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+		if node.Kind != yaml.MappingNode {
+			return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+		}
+
+		var c struct {
+			Src       yaml.Node `yaml:"Src"`
+			Classpath yaml.Node `yaml:"Classpath"`
+			Out       string    `yaml:"Out"`
+			Flags     yaml.Node `yaml:"Flags"`
+		}
+		if err := node.Decode(&c); err != nil {
+			return nil, errors.Wrapf(err, "YAML error decoding %s", tag)
+		}
+		if c.Out == "" {
+			return nil, errors.Errorf("YAML error decoding %s: no Out", tag)
+		}
+
+		src, err := con.YAMLFileList(&c.Src, dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "YAML error decoding %s.Src", tag)
+		}
+		classpath, err := con.YAMLFileList(&c.Classpath, dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "YAML error decoding %s.Classpath", tag)
+		}
+		flags, err := con.YAMLStringList(&c.Flags, dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "YAML error decoding %s.Flags", tag)
+		}
+
+		return fn(src, classpath, con.JoinPath(dir, c.Out), flags...)
+	}
+}
+
+func jarDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var j struct {
+		Out  string    `yaml:"Out"`
+		Dirs yaml.Node `yaml:"Dirs"`
+		Main string    `yaml:"Main"`
+	}
+	if err := node.Decode(&j); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding jvm.Jar")
+	}
+	if j.Out == "" {
+		return nil, errors.New("YAML error decoding jvm.Jar: no Out")
+	}
+
+	dirs, err := con.YAMLFileList(&j.Dirs, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding jvm.Jar.Dirs")
+	}
+
+	return Jar(con.JoinPath(dir, j.Out), dirs, j.Main)
+}
+
+func init() {
+	fab.RegisterYAMLTarget("jvm.Javac", compileDecoder("jvm.Javac", Javac))
+	fab.SetYAMLTagDoc("jvm.Javac", "Compile Java source files with javac.")
+	fab.RegisterYAMLTarget("jvm.Kotlinc", compileDecoder("jvm.Kotlinc", Kotlinc))
+	fab.SetYAMLTagDoc("jvm.Kotlinc", "Compile Kotlin source files with kotlinc.")
+	fab.RegisterYAMLTarget("jvm.Jar", jarDecoder)
+	fab.SetYAMLTagDoc("jvm.Jar", "Package directories of class files in a jar file.")
+}
@@ -0,0 +1,86 @@
+package jvm
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/bobg/fab/internal/faketool"
+)
+
+func TestSourceFiles(t *testing.T) {
+	e := faketool.New(t, "_testdata")
+
+	got, err := sourceFiles([]string{e.Path("src")}, []string{".java"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		e.Path("src", "Main.java"),
+		e.Path("src", "util", "Util.java"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestJavacJar(t *testing.T) {
+	e := faketool.New(t, "_testdata")
+
+	// A stale class file from an earlier build.
+	e.WriteFile(t, "build/classes/Stale.class", "")
+
+	var (
+		javac = "javac -d build/classes -cp lib/dep.jar -g src/Main.java src/util/Util.java"
+		jar   = "jar cfe build/app.jar Main -C build/classes ."
+	)
+
+	cases := []struct {
+		desc  string
+		write map[string]string
+		want  []string
+	}{{
+		desc: "first run",
+		want: []string{javac, jar},
+	}, {
+		desc: "second run",
+	}, {
+		// Changing a classpath entry recompiles,
+		// but the jar is rebuilt only if the classes change.
+		desc:  "classpath change",
+		write: map[string]string{"lib/dep.jar": "dep 2\n"},
+		want:  []string{javac},
+	}, {
+		desc:  "source change",
+		write: map[string]string{"src/Main.java": "class Main { int x; }\n"},
+		want:  []string{javac, jar},
+	}}
+
+	for _, tc := range cases {
+		for name, content := range tc.write {
+			e.WriteFile(t, name, content)
+		}
+		if got := e.Run(t, "Build"); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.desc, got, tc.want)
+		}
+		if _, err := os.Stat(e.Path("build", "classes", "Stale.class")); !os.IsNotExist(err) {
+			t.Errorf("%s: stale class file still present (err %v)", tc.desc, err)
+		}
+	}
+}
+
+func TestKotlinc(t *testing.T) {
+	e := faketool.New(t, "_testdata")
+	e.WriteFile(t, "src/App.kt", "fun main() {}\n")
+
+	target, err := Kotlinc([]string{e.Path("src")}, nil, e.Path("out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := e.RunTarget(t, target)
+	want := []string{"kotlinc -d out src/App.kt src/Main.java src/util/Util.java"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
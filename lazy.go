@@ -0,0 +1,72 @@
+package fab
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bobg/errors"
+)
+
+// Lazy produces a target that calls fn to construct the target it runs,
+// the first time it is needed,
+// and runs that.
+// The result of fn (or its error) is reused after that.
+//
+// This is for targets that are expensive to construct,
+// or that can be constructed only at runtime.
+// The driver uses Lazy for exported functions in a _fab package
+// that take no arguments and return a [Target]
+// (optionally with an error),
+// so that such a function is called only if its target is used.
+func Lazy(fn func() (Target, error)) Target {
+	return &lazy{fn: fn}
+}
+
+type lazy struct {
+	fn     func() (Target, error)
+	once   sync.Once
+	target Target
+	err    error
+}
+
+var (
+	_ Target        = &lazy{}
+	_ GraphChildren = &lazy{}
+)
+
+// get returns the target constructed by l.fn,
+// calling l.fn the first time.
+func (l *lazy) get() (Target, error) {
+	l.once.Do(func() {
+		l.target, l.err = l.fn()
+		if l.err == nil && l.target == nil {
+			l.err = errors.New("nil target")
+		}
+		l.err = errors.Wrap(l.err, "constructing target")
+	})
+	return l.target, l.err
+}
+
+// Run implements Target.Run.
+func (l *lazy) Run(ctx context.Context, con *Controller) error {
+	target, err := l.get()
+	if err != nil {
+		return err
+	}
+	return con.Run(ctx, target)
+}
+
+// Desc implements Target.Desc.
+func (*lazy) Desc() string {
+	return "Lazy"
+}
+
+// Children implements GraphChildren.
+// It constructs the target if necessary.
+func (l *lazy) Children() []Target {
+	target, err := l.get()
+	if err != nil {
+		return nil
+	}
+	return []Target{target}
+}
@@ -0,0 +1,66 @@
+package fab
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestLazy(t *testing.T) {
+	t.Parallel()
+
+	var (
+		calls int
+		ct    = &countTarget{}
+		con   = NewController("")
+		ctx   = context.Background()
+	)
+
+	l := Lazy(func() (Target, error) {
+		calls++
+		return ct, nil
+	})
+	if _, err := con.Register("L", l); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 {
+		t.Fatalf("got %d calls before running, want 0", calls)
+	}
+
+	if err := con.Run(ctx, l); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("got %d calls, want 1", calls)
+	}
+	if ct.count != 1 {
+		t.Errorf("got count %d, want 1", ct.count)
+	}
+
+	if children := l.(GraphChildren).Children(); len(children) != 1 || children[0] != ct {
+		t.Errorf("got children %v, want [%v]", children, ct)
+	}
+	if calls != 1 {
+		t.Errorf("got %d calls after Children, want 1", calls)
+	}
+}
+
+func TestLazyErr(t *testing.T) {
+	t.Parallel()
+
+	var (
+		errBoom = errors.New("boom")
+		con     = NewController("")
+		ctx     = context.Background()
+	)
+
+	l := Lazy(func() (Target, error) { return nil, errBoom })
+	if err := con.Run(ctx, l); !errors.Is(err, errBoom) {
+		t.Errorf("got error %v, want %v", err, errBoom)
+	}
+
+	l = Lazy(func() (Target, error) { return nil, nil })
+	if err := con.Run(ctx, l); err == nil {
+		t.Error("got no error for nil target")
+	}
+}
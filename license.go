@@ -0,0 +1,226 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// License produces a target that checks that each of the given files
+// begins with the given license header,
+// or adds the header to files lacking it.
+//
+// The header is literal text,
+// including any comment syntax appropriate to the files,
+// e.g. "// Copyright 2024 Jane Doe.\n".
+// A trailing newline is added if it's missing.
+// In a file beginning with a "#!" line,
+// the header is expected after that line.
+//
+// In "check" mode
+// (when fix is false),
+// the target fails with a [LicenseError]
+// listing any files that lack the header.
+// In "fix" mode
+// (when fix is true),
+// the header is inserted into such files,
+// followed by a blank line.
+// The mode can be overridden on the command line with the -check and -fix flags,
+// and restricted to some of the files by naming them after the flags,
+// as with [Format].
+//
+// License is implemented in terms of [Check],
+// so when none of the files has changed
+// since the last time they were found to have the header
+// (or were fixed),
+// scanning the files is skipped.
+// As with Format,
+// a run restricted to some of the files
+// neither consults nor updates the hash DB.
+//
+// A License target may be specified in YAML using the tag !License,
+// which introduces a mapping whose fields are:
+//
+//   - Header: the text of the license header
+//   - HeaderFile: the name of a file containing the license header,
+//     as an alternative to Header
+//   - Files: the files to check, interpreted with [YAMLFileList]
+//     (typically produced with !Glob)
+//   - Fix: a boolean, true for fix mode and false for check mode
+func License(header string, files []string, fix bool) Target {
+	if !strings.HasSuffix(header, "\n") {
+		header += "\n"
+	}
+
+	sorted := append([]string{}, files...)
+	sort.Strings(sorted)
+
+	return Check(&license{
+		Header: header,
+		Files:  sorted,
+		Fix:    fix,
+	}, sorted)
+}
+
+type license struct {
+	Header string   `json:"header"`
+	Files  []string `json:"files"`
+	Fix    bool     `json:"fix,omitempty"`
+}
+
+var (
+	_ Target         = &license{}
+	_ FileRestricter = &license{}
+)
+
+// Run implements Target.Run.
+func (l *license) Run(ctx context.Context, con *Controller) error {
+	fix, only, err := fixMode(ctx, "License", l.Fix)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, file := range onlyFiles(l.Files, only) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", file)
+		}
+		_, body := splitShebang(data)
+		if !bytes.HasPrefix(body, []byte(l.Header)) {
+			missing = append(missing, file)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if !fix {
+		return LicenseError{Files: missing}
+	}
+
+	if GetDryRun(ctx) {
+		if GetVerbose(ctx) {
+			con.Indentf("  would add license header to %v", missing)
+		}
+		return nil
+	}
+
+	for _, file := range missing {
+		if GetVerbose(ctx) {
+			con.Indentf("  adding license header to %s", file)
+		}
+		if err := l.inject(file); err != nil {
+			return errors.Wrapf(err, "adding license header to %s", file)
+		}
+	}
+
+	return nil
+}
+
+// Restriction implements FileRestricter.
+func (l *license) Restriction(ctx context.Context) ([]string, error) {
+	_, only, err := fixMode(ctx, "License", l.Fix)
+	return only, err
+}
+
+func (l *license) inject(file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	shebang, body := splitShebang(data)
+
+	buf := new(bytes.Buffer)
+	buf.Write(shebang)
+	buf.WriteString(l.Header)
+	if len(body) > 0 {
+		buf.WriteString("\n")
+		buf.Write(body)
+	}
+
+	return os.WriteFile(file, buf.Bytes(), info.Mode().Perm())
+}
+
+// splitShebang splits data into its "#!" line, if any,
+// and the rest.
+func splitShebang(data []byte) (shebang, rest []byte) {
+	if !bytes.HasPrefix(data, []byte("#!")) {
+		return nil, data
+	}
+	idx := bytes.IndexByte(data, '\n')
+	if idx < 0 {
+		return data, nil
+	}
+	return data[:idx+1], data[idx+1:]
+}
+
+// Desc implements Target.Desc.
+func (*license) Desc() string {
+	return "License"
+}
+
+// LicenseError is the type of error produced by a [License] target in check mode
+// when some files lack the license header.
+type LicenseError struct {
+	Files []string
+}
+
+func (e LicenseError) Error() string {
+	return fmt.Sprintf("missing license header in file(s): %s", strings.Join(e.Files, " "))
+}
+
+func licenseDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var ylicense struct {
+		Header     string    `yaml:"Header"`
+		HeaderFile string    `yaml:"HeaderFile"`
+		Files      yaml.Node `yaml:"Files"`
+		Fix        bool      `yaml:"Fix"`
+	}
+	if err := node.Decode(&ylicense); err != nil {
+		return nil, errors.Wrap(err, "YAML error in License node")
+	}
+
+	header := ylicense.Header
+	switch {
+	case header != "" && ylicense.HeaderFile != "":
+		return nil, fmt.Errorf("License node may not specify both Header and HeaderFile")
+
+	case ylicense.HeaderFile != "":
+		data, err := os.ReadFile(con.JoinPath(dir, ylicense.HeaderFile))
+		if err != nil {
+			return nil, errors.Wrap(err, "reading License.HeaderFile")
+		}
+		header = string(data)
+
+	case header == "":
+		return nil, fmt.Errorf("License node must specify Header or HeaderFile")
+	}
+
+	files, err := con.YAMLFileList(&ylicense.Files, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in License.Files node")
+	}
+
+	return License(header, files, ylicense.Fix), nil
+}
+
+func init() {
+	RegisterYAMLTarget("License", licenseDecoder)
+	SetYAMLTagDoc("License", "Check that files begin with a license header, or add it.")
+}
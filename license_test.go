@@ -0,0 +1,149 @@
+package fab
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestLicense(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	const header = "// Copyright 2024 Jane Doe."
+
+	var (
+		good   = filepath.Join(tmpdir, "good.go")
+		bad    = filepath.Join(tmpdir, "bad.go")
+		script = filepath.Join(tmpdir, "script")
+	)
+	if err = os.WriteFile(good, []byte(header+"\n\npackage x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(bad, []byte("package x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(script, []byte("#!/bin/sh\necho hi\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	ctx = WithVerbose(ctx, testing.Verbose())
+	ctx = WithHashDB(ctx, memdb(set.New[string]()))
+
+	files := []string{good, bad, script}
+
+	t.Run("check", func(t *testing.T) {
+		con := NewController("")
+		err := con.Run(ctx, License(header, files, false))
+
+		var lerr LicenseError
+		if !errors.As(err, &lerr) {
+			t.Fatalf("got error %v, want LicenseError", err)
+		}
+		if want := []string{bad, script}; !reflect.DeepEqual(lerr.Files, want) {
+			t.Errorf("got files %v, want %v", lerr.Files, want)
+		}
+	})
+
+	t.Run("fix", func(t *testing.T) {
+		con := NewController("")
+		if err := con.Run(ctx, License(header, files, true)); err != nil {
+			t.Fatal(err)
+		}
+
+		cases := []struct {
+			file, want string
+		}{{
+			file: good,
+			want: header + "\n\npackage x\n",
+		}, {
+			file: bad,
+			want: header + "\n\npackage x\n",
+		}, {
+			file: script,
+			want: "#!/bin/sh\n" + header + "\n\necho hi\n",
+		}}
+		for _, tc := range cases {
+			got, err := os.ReadFile(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("%s: got %q, want %q", tc.file, string(got), tc.want)
+			}
+		}
+
+		info, err := os.Stat(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0755 {
+			t.Errorf("got mode %v for %s, want 0755", info.Mode().Perm(), script)
+		}
+	})
+
+	t.Run("check_after_fix", func(t *testing.T) {
+		con := NewController("")
+		if err := con.Run(ctx, ArgTarget(License(header, files, true), "-check")); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestLicenseRestricted(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	const header = "// Copyright 2024 Jane Doe."
+
+	var (
+		good = filepath.Join(tmpdir, "good.go")
+		bad  = filepath.Join(tmpdir, "bad.go")
+	)
+	if err = os.WriteFile(good, []byte(header+"\n\npackage x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(bad, []byte("package x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	ctx = WithVerbose(ctx, testing.Verbose())
+	ctx = WithHashDB(ctx, memdb(set.New[string]()))
+
+	files := []string{good, bad}
+
+	// A run restricted to the file with the header succeeds...
+	con := NewController("")
+	if err := con.Run(ctx, ArgTarget(License(header, files, false), "-files", good)); err != nil {
+		t.Fatal(err)
+	}
+
+	// ...but doesn't make a full run up to date.
+	con = NewController("")
+	err = con.Run(ctx, License(header, files, false))
+
+	var lerr LicenseError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("got error %v, want LicenseError", err)
+	}
+	if want := []string{bad}; !reflect.DeepEqual(lerr.Files, want) {
+		t.Errorf("got files %v, want %v", lerr.Files, want)
+	}
+}
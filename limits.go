@@ -0,0 +1,120 @@
+package fab
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Limits are limits on the targets run by a [Controller].
+// They protect against runaway target graphs,
+// such as those produced by a buggy function
+// that builds [Seq] or [All] structures without end.
+// A zero value means no limit.
+type Limits struct {
+	// MaxDepth is the greatest nesting depth of running targets:
+	// the length of the longest chain of targets,
+	// each one running the next.
+	// A target passed to a top-level call to [Controller.Run]
+	// has depth 1.
+	MaxDepth int
+
+	// MaxTargets is the greatest number of distinct targets
+	// that the controller will run.
+	MaxTargets int
+}
+
+// SetLimits sets the limits on the targets run by con.
+// When a limit is exceeded,
+// the target exceeding it fails with a [LimitError].
+func (con *Controller) SetLimits(limits Limits) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	con.limits = limits
+}
+
+// Limits returns the limits set with [Controller.SetLimits].
+func (con *Controller) Limits() Limits {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	return con.limits
+}
+
+// LimitError is the error produced by [Controller.Run]
+// when running a target would exceed one of the controller's [Limits].
+type LimitError struct {
+	// Limit is "depth" or "target count".
+	Limit string
+
+	// Max is the value of the limit.
+	Max int
+
+	// Names describes the chain of running targets
+	// that led to the target exceeding the limit,
+	// ending with that target.
+	Names []string
+}
+
+func (e LimitError) Error() string {
+	return fmt.Sprintf("%s limit of %d exceeded: %s", e.Limit, e.Max, strings.Join(e.Names, " -> "))
+}
+
+// runFrame is an entry in the chain of running targets,
+// for reporting in a [LimitError].
+type runFrame struct {
+	target Target
+	parent *runFrame
+	depth  int
+}
+
+type runFrameKeyType struct{}
+
+// withRunFrame decorates a context with the chain of targets being run with it,
+// ending in target.
+func withRunFrame(ctx context.Context, target Target) context.Context {
+	parent := getRunFrame(ctx)
+	frame := &runFrame{target: target, parent: parent, depth: 1}
+	if parent != nil {
+		frame.depth = parent.depth + 1
+	}
+	return context.WithValue(ctx, runFrameKeyType{}, frame)
+}
+
+// getRunFrame returns the last entry in the chain of targets being run with ctx,
+// or nil if there is none.
+func getRunFrame(ctx context.Context) *runFrame {
+	frame, _ := ctx.Value(runFrameKeyType{}).(*runFrame)
+	return frame
+}
+
+// limitError produces a [LimitError] for target,
+// run with ctx.
+func (con *Controller) limitError(ctx context.Context, limit string, max int, target Target) error {
+	names := []string{con.Describe(target)}
+	for frame := getRunFrame(ctx); frame != nil; frame = frame.parent {
+		names = append(names, con.Describe(frame.target))
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return LimitError{Limit: limit, Max: max, Names: names}
+}
+
+// checkDepth tells whether running target with ctx
+// would exceed con's depth limit.
+func (con *Controller) checkDepth(ctx context.Context, target Target) error {
+	max := con.Limits().MaxDepth
+	if max <= 0 {
+		return nil
+	}
+	depth := 1
+	if frame := getRunFrame(ctx); frame != nil {
+		depth = frame.depth + 1
+	}
+	if depth <= max {
+		return nil
+	}
+	return con.limitError(ctx, "depth", max, target)
+}
@@ -0,0 +1,84 @@
+package fab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("depth", func(t *testing.T) {
+		con := NewController("")
+		con.SetLimits(Limits{MaxDepth: 3})
+
+		err := con.Run(ctx, &runaway{})
+
+		var e LimitError
+		if !errors.As(err, &e) {
+			t.Fatalf("got error %v, want LimitError", err)
+		}
+		want := LimitError{
+			Limit: "depth",
+			Max:   3,
+			Names: []string{"unnamed runaway 0", "unnamed runaway 1", "unnamed runaway 2", "unnamed runaway 3"},
+		}
+		if !reflect.DeepEqual(e, want) {
+			t.Errorf("got %+v, want %+v", e, want)
+		}
+	})
+
+	t.Run("targets", func(t *testing.T) {
+		con := NewController("")
+		con.SetLimits(Limits{MaxTargets: 5})
+
+		var targets []Target
+		for i := 0; i < 4; i++ {
+			targets = append(targets, &Command{Shell: fmt.Sprintf("echo %d", i)})
+		}
+		if err := con.Run(ctx, targets...); err != nil {
+			t.Fatal(err)
+		}
+
+		// A Seq and its two subtargets make 7 targets.
+		err := con.Run(ctx, Seq(&Command{Shell: "echo 4"}, &Command{Shell: "echo 5"}))
+
+		var e LimitError
+		if !errors.As(err, &e) {
+			t.Fatalf("got error %v, want LimitError", err)
+		}
+		if e.Limit != "target count" || e.Max != 5 || len(e.Names) != 2 {
+			t.Errorf("got %+v", e)
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		con := NewController("")
+		if err := con.Run(ctx, &runaway{max: 100}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// runaway is a target that runs a new instance of itself
+// until it reaches a depth of max,
+// or forever if max is 0.
+type runaway struct {
+	n, max int
+}
+
+func (r *runaway) Run(ctx context.Context, con *Controller) error {
+	if r.max > 0 && r.n >= r.max {
+		return nil
+	}
+	return con.Run(ctx, &runaway{n: r.n + 1, max: r.max})
+}
+
+func (r *runaway) Desc() string {
+	return fmt.Sprintf("runaway %d", r.n)
+}
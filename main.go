@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"os/exec"
@@ -11,12 +12,11 @@ import (
 	"reflect"
 	"regexp"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/bobg/errors"
-	"github.com/bobg/go-generics/v2/slices"
-	"golang.org/x/tools/go/packages"
 
 	"github.com/bobg/fab/sqlite"
 )
@@ -44,6 +44,209 @@ type Main struct {
 	// DryRun tells whether to run targets in "dry run" mode - i.e., with state-changing operations (like file creation and updating) suppressed.
 	DryRun bool
 
+	// JSON tells whether to list targets in JSON format
+	// when List is true.
+	// See [Controller.ListTargetsJSON].
+	JSON bool
+
+	// Watch tells whether to keep running after the requested targets finish,
+	// rerunning them whenever any of the input files of their [Files] targets changes.
+	// See [Controller.Watch].
+	Watch bool
+
+	// Graph, if non-empty,
+	// tells the driver to write the dependency graph of the targets in Args
+	// (or of all targets, if Args is empty)
+	// to standard output instead of running them.
+	// The value is the output format: "dot" or "json".
+	// See [Controller.Graph].
+	Graph string
+
+	// Flaky tells whether to print a report of flaky targets
+	// (see [Flaky])
+	// instead of running any targets.
+	Flaky bool
+
+	// PruneOutputs tells whether to remove the stale outputs of [Files] targets
+	// instead of running any targets.
+	// See [Controller.PruneOutputs].
+	PruneOutputs bool
+
+	// Cache, if non-empty,
+	// is the URL of a hash DB to use instead of the local one in Fabdir,
+	// e.g. one shared among CI workers and developers.
+	// See [OpenHashDBURL].
+	Cache string
+
+	// Artifacts, if non-empty,
+	// is a directory in which to save the output files of [Files] targets,
+	// so they can be restored instead of rebuilt
+	// when the same inputs are seen again.
+	// See [ArtifactStore].
+	Artifacts string
+
+	// ToolEnv tells whether to give commands the environment
+	// described by the .tool-versions and .envrc files in Topdir.
+	// See [ToolEnv].
+	ToolEnv bool
+
+	// Host, if non-empty,
+	// tells the driver to run the targets in Args on the given remote host
+	// instead of locally.
+	// See [Controller.RunRemote].
+	Host string
+
+	// Timings tells whether to print a table of per-target run times
+	// after running the targets in Args.
+	// See [Controller.WriteTimings].
+	Timings bool
+
+	// Lanes tells whether to label the verbose output of targets
+	// with the "lane" in which each one runs,
+	// and to print a chart of how the targets overlapped in time
+	// after running the targets in Args.
+	// See [TextStyle.Lanes] and [Controller.WriteGantt].
+	Lanes bool
+
+	// Tag, if non-empty,
+	// is a comma-separated list of tags.
+	// The targets having any of them are run
+	// in addition to those in Args.
+	// See [WithTags].
+	Tag string
+
+	// UI tells whether to show a full-screen, interactive display
+	// while running the targets in Args.
+	// See [Controller.RunUI].
+	// It cannot be combined with Audit or AuditURL.
+	UI bool
+
+	// Trace, if non-empty,
+	// is a file to which to write per-target run times
+	// in the Chrome trace-event format
+	// after running the targets in Args.
+	// See [Controller.WriteTrace].
+	Trace string
+
+	// Timeout, if positive,
+	// is a deadline for running the targets in Args.
+	// When it passes,
+	// running commands are interrupted
+	// and the cleanup targets of any [Finally] targets are run,
+	// with Grace to finish before they are killed.
+	Timeout time.Duration
+
+	// Grace is how long to allow for cleanup after Timeout passes.
+	// See [WithGracePeriod].
+	Grace time.Duration
+
+	// Guard tells whether to check that the input files of [Files] targets
+	// do not change while their subtargets are running.
+	// See [WithInputGuard].
+	Guard bool
+
+	// TraceFiles tells whether to trace the files read and written by the subtargets of [Files] targets,
+	// warning about any not among their declared inputs and outputs.
+	// See [WithFileTrace].
+	TraceFiles bool
+
+	// DistrustMtime tells whether to rehash every file
+	// instead of using the stat cache,
+	// for filesystems where modification times are unreliable.
+	// See [FileHashCache].
+	DistrustMtime bool
+
+	// Audit tells whether to record each run of targets in the audit log in Fabdir.
+	// See [Controller.RunAudited].
+	Audit bool
+
+	// AuditURL, if set, is a URL to which audit records are also sent.
+	// It implies Audit.
+	AuditURL string
+
+	// KeepGoing tells whether targets that don't depend on a failing one
+	// should still be started and run to completion.
+	// See [WithKeepGoing].
+	KeepGoing bool
+
+	// FailFast tells whether the first failing target should cancel the others.
+	// See [WithFailFast].
+	FailFast bool
+
+	// Limits are limits on the targets run,
+	// protecting against runaway target graphs.
+	// See [Controller.SetLimits].
+	Limits Limits
+
+	// Doctor tells whether to check for problems with the state in Fabdir,
+	// the tools fab needs,
+	// and the project's targets,
+	// instead of running any targets.
+	// See [Doctor] and [Controller.CheckProject].
+	Doctor bool
+
+	// Fix tells whether to repair the problems found when Doctor is true,
+	// where that can be done safely.
+	Fix bool
+
+	// Progress, if non-empty,
+	// is the format in which the driver reports progress:
+	// "text" (the default), "json", "status", or "auto".
+	// In verbose mode, "auto" means "text".
+	// See [Controller.SetProgressFormat].
+	Progress string
+
+	// Clean tells the driver to remove the output files of the targets in Args
+	// (or of all targets in the registry, if Args is empty)
+	// instead of running them.
+	// See [Controller.CleanOutputs].
+	Clean bool
+
+	// Env tells the driver to describe the environment of the targets in Args
+	// instead of running them.
+	// See [Controller.WriteEnv].
+	Env bool
+
+	// Describe tells the driver to print the resolved structure of the targets in Args
+	// instead of running them,
+	// in JSON format if JSON is true.
+	// See [Controller.Explain].
+	Describe bool
+
+	// Explain tells the driver to report whether the [Files] targets
+	// among the targets in Args and their subtargets are up to date,
+	// and why not,
+	// instead of running them.
+	// See [Controller.WhyRebuild].
+	Explain bool
+
+	// InstallHook tells whether to install a git pre-commit hook
+	// that runs fab with Args
+	// (or [DefaultPreCommitTarget] if Args is empty)
+	// instead of running anything.
+	// See [PreCommitArg].
+	InstallHook bool
+
+	// ForceHook tells whether to replace an existing hook
+	// when InstallHook is true.
+	ForceHook bool
+
+	// PrintHook tells whether to print the hook
+	// instead of installing it
+	// when InstallHook is true.
+	PrintHook bool
+
+	// Daemon tells whether to run as a daemon,
+	// keeping the driver compiled
+	// and running it on behalf of other fab processes
+	// for the same project,
+	// until ctx is canceled.
+	// A fab process for which Force is false
+	// uses the daemon for its project if there is one,
+	// unless it needs the terminal
+	// (for UI, the "status" progress format, or a terminal on standard input).
+	Daemon bool
+
 	// Args contains the additional command-line arguments to pass to the driver, e.g. target names.
 	Args []string
 }
@@ -62,10 +265,40 @@ type Main struct {
 // as defined by the code in _fab
 // and by any fab.yaml files.
 //
+// If m.Flaky is true,
+// Run prints a report of flaky targets (see [FlakyReport])
+// and exits without running anything.
+// Similarly,
+// if m.PruneOutputs is true,
+// Run removes stale outputs (see [Controller.PruneOutputs]),
+// and if m.Doctor is true,
+// Run checks for problems (see [Doctor])
+// and exits without running anything.
+// If m.InstallHook is true,
+// Run installs a git pre-commit hook (see [PreCommitArg])
+// and exits without running anything.
+//
 // If there is no _fab directory,
 // Run operates in "driverless" mode,
 // in which target definitions are found in fab.yaml files only.
+//
+// If m.Daemon is true,
+// Run serves as the daemon for the project,
+// and otherwise it uses the project's daemon if one is running
+// (unless m.Force is true or m needs the terminal, see [Main.Daemon]).
+// The daemon checks and recompiles the driver only when the files in _fab change,
+// instead of on every run.
 func (m *Main) Run(ctx context.Context) error {
+	if m.UI && (m.Audit || m.AuditURL != "") {
+		return errUIAudit
+	}
+	if m.Flaky {
+		return FlakyReport(os.Stdout, m.Fabdir)
+	}
+	if m.Doctor {
+		return m.doctor(ctx)
+	}
+
 	if m.Topdir == "" {
 		var err error
 
@@ -75,6 +308,22 @@ func (m *Main) Run(ctx context.Context) error {
 		}
 	}
 
+	if m.PruneOutputs {
+		return m.pruneOutputs(ctx)
+	}
+	if m.InstallHook {
+		return m.installHook(ctx)
+	}
+
+	if m.Daemon {
+		return m.runDaemon(ctx)
+	}
+	if !m.Force && m.useDaemon(os.Stdin, os.Stdout) {
+		if ok, err := m.runViaDaemon(ctx, os.Stdin, os.Stdout, os.Stderr); ok {
+			return err
+		}
+	}
+
 	driver, err := m.getDriver(ctx, false)
 	if errors.Is(err, errNoDriver) {
 		return m.driverless(ctx)
@@ -83,6 +332,18 @@ func (m *Main) Run(ctx context.Context) error {
 		return errors.Wrap(err, "ensuring driver is up to date")
 	}
 
+	args := m.driverArgs()
+	cmd := exec.CommandContext(ctx, driver, args...)
+	cmd.Dir = m.Topdir
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	err = cmd.Run()
+	return errors.Wrapf(err, "running %s %s", driver, strings.Join(args, " "))
+}
+
+// driverArgs returns the command-line arguments
+// for running a compiled driver
+// according to the settings in m.
+func (m *Main) driverArgs() []string {
 	args := []string{"-fab", m.Fabdir, "-top", m.Topdir}
 	if m.Verbose {
 		args = append(args, "-v")
@@ -90,35 +351,169 @@ func (m *Main) Run(ctx context.Context) error {
 	if m.List {
 		args = append(args, "-list")
 	}
+	if m.JSON {
+		args = append(args, "-json")
+	}
 	if m.Force {
 		args = append(args, "-f")
 	}
 	if m.DryRun {
 		args = append(args, "-n")
 	}
+	if m.Watch {
+		args = append(args, "-watch")
+	}
+	if m.Graph != "" {
+		args = append(args, "-graph", m.Graph)
+	}
+	if m.Cache != "" {
+		args = append(args, "-cache", m.Cache)
+	}
+	if m.Artifacts != "" {
+		args = append(args, "-artifacts", m.Artifacts)
+	}
+	if m.ToolEnv {
+		args = append(args, "-toolenv")
+	}
+	if m.Host != "" {
+		args = append(args, "-host", m.Host)
+	}
+	if m.Timings {
+		args = append(args, "-timings")
+	}
+	if m.Lanes {
+		args = append(args, "-lanes")
+	}
+	if m.UI {
+		args = append(args, "-ui")
+	}
+	if m.Tag != "" {
+		args = append(args, "-tag", m.Tag)
+	}
+	if m.Trace != "" {
+		args = append(args, "-trace", m.Trace)
+	}
+	if m.Timeout > 0 {
+		args = append(args, "-timeout", m.Timeout.String(), "-grace", m.Grace.String())
+	}
+	if m.Guard {
+		args = append(args, "-guard")
+	}
+	if m.TraceFiles {
+		args = append(args, "-trace-files")
+	}
+	if m.DistrustMtime {
+		args = append(args, "-trust-mtime=false")
+	}
+	if m.Audit {
+		args = append(args, "-audit")
+	}
+	if m.AuditURL != "" {
+		args = append(args, "-audit-url", m.AuditURL)
+	}
+	if m.KeepGoing {
+		args = append(args, "-k")
+	}
+	if m.FailFast {
+		args = append(args, "-fail-fast")
+	}
+	if m.Limits.MaxDepth > 0 {
+		args = append(args, "-max-depth", strconv.Itoa(m.Limits.MaxDepth))
+	}
+	if m.Limits.MaxTargets > 0 {
+		args = append(args, "-max-targets", strconv.Itoa(m.Limits.MaxTargets))
+	}
+	if m.Progress != "" {
+		args = append(args, "-progress", m.Progress)
+	}
+	if m.Clean {
+		args = append(args, "-clean")
+	}
+	if m.Env {
+		args = append(args, "-env")
+	}
+	if m.Describe {
+		args = append(args, "-describe")
+	}
+	if m.Explain {
+		args = append(args, "-explain")
+	}
 	args = append(args, m.Args...)
-
-	cmd := exec.CommandContext(ctx, driver, args...)
-	cmd.Dir = m.Topdir
-	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
-	err = cmd.Run()
-	return errors.Wrapf(err, "running %s %s", driver, strings.Join(args, " "))
+	return args
 }
 
 var errNoDriver = errors.New("no driver")
 
+var errUIAudit = errors.New("-audit and -audit-url cannot be combined with -ui")
+
+func (m *Main) pruneOutputs(ctx context.Context) error {
+	ctx = WithDryRun(ctx, m.DryRun)
+
+	con := NewController(m.Topdir)
+	pruned, err := con.PruneOutputs(ctx, m.Fabdir)
+	if err != nil {
+		return err
+	}
+	verb := "Removed"
+	if m.DryRun {
+		verb = "Would remove"
+	}
+	for _, file := range pruned {
+		if rel, err := filepath.Rel(m.Topdir, file); err == nil {
+			file = rel
+		}
+		fmt.Printf("%s %s\n", verb, file)
+	}
+	return nil
+}
+
 func (m *Main) driverless(ctx context.Context) error {
 	if m.Verbose {
 		fmt.Println("Running in driverless mode")
 	}
 
 	con := NewController(m.Topdir)
+	args := con.ParseVarArgs(m.Args)
+	progress := m.Progress
+	if m.Verbose && progress == "auto" {
+		progress = "text"
+	}
+	if err := con.SetProgressFormat(os.Stdout, progress); err != nil {
+		return err
+	}
+	con.SetLimits(m.Limits)
+	if m.Lanes {
+		style := con.TextStyle()
+		style.Lanes = true
+		style.Color = IsTerminal(os.Stdout)
+		con.SetTextStyle(style)
+	}
 
 	if err := con.ReadYAMLFile(""); err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return errors.Wrap(err, "reading YAML file")
 	}
 
+	if m.Tag != "" {
+		names, err := con.TagArgs(m.Tag)
+		if err != nil {
+			return err
+		}
+		args = append(args, names...)
+	}
+
+	if len(args) == 0 && m.Graph == "" && !m.Clean {
+		if dflt := con.Default(); dflt != "" {
+			args = []string{dflt}
+		} else if !m.List {
+			fmt.Print("Specify one or more of the following targets:\n\n")
+			m.List = true
+		}
+	}
+
 	if m.List {
+		if m.JSON {
+			return con.ListTargetsJSON(os.Stdout)
+		}
 		con.ListTargets(os.Stdout)
 		return nil
 	}
@@ -126,20 +521,90 @@ func (m *Main) driverless(ctx context.Context) error {
 	ctx = WithVerbose(ctx, m.Verbose)
 	ctx = WithForce(ctx, m.Force)
 	ctx = WithDryRun(ctx, m.DryRun)
+	ctx = WithFabdir(ctx, m.Fabdir)
+	ctx = WithInputGuard(ctx, m.Guard)
+	ctx = WithFileTrace(ctx, m.TraceFiles)
+	ctx = WithTrustMtime(ctx, !m.DistrustMtime)
+	ctx = WithKeepGoing(ctx, m.KeepGoing)
+	ctx = WithFailFast(ctx, m.FailFast)
+	if m.Artifacts != "" {
+		ctx = WithArtifactStore(ctx, DirArtifactStore{Dir: m.Artifacts})
+	}
+	if m.ToolEnv {
+		env, err := ToolEnv(ctx, m.Topdir)
+		if err != nil {
+			return errors.Wrap(err, "computing tool environment")
+		}
+		ctx = WithEnv(ctx, env)
+	}
 
-	db, err := OpenHashDB(m.Fabdir)
+	db, err := OpenHashDBURL(ctx, m.Cache, m.Fabdir)
 	if err != nil {
 		return errors.Wrap(err, "opening hash db")
 	}
-	defer db.Close()
+	if c, ok := db.(io.Closer); ok {
+		defer c.Close()
+	}
 	ctx = WithHashDB(ctx, db)
 
-	targets, err := con.ParseArgs(m.Args)
+	targets, err := con.ParseArgs(args)
 	if err != nil {
 		return errors.Wrap(err, "parsing args")
 	}
 
-	return con.Run(ctx, targets...)
+	if m.Graph != "" {
+		return con.Graph(os.Stdout, m.Graph, targets...)
+	}
+	if m.Env {
+		return con.WriteEnv(ctx, os.Stdout, targets...)
+	}
+	if m.Describe {
+		return con.WriteDescriptions(os.Stdout, m.JSON, targets...)
+	}
+	if m.Explain {
+		return con.WriteRebuildReasons(ctx, os.Stdout, targets...)
+	}
+	if m.Clean {
+		return con.CleanOutputs(ctx, targets...)
+	}
+
+	if m.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.Timeout)
+		defer cancel()
+	}
+	ctx = WithGracePeriod(ctx, m.Grace)
+
+	if m.Host != "" {
+		return con.RunRemote(ctx, Remote{Host: m.Host}, m.Args, targets...)
+	}
+	if m.Watch {
+		return con.Watch(ctx, WatchInterval, targets...)
+	}
+
+	if m.Audit || m.AuditURL != "" {
+		err = con.RunAudited(ctx, m.AuditURL, targets...)
+	} else if m.UI {
+		err = con.RunUI(ctx, os.Stdin, os.Stdout, targets...)
+	} else {
+		err = con.Run(ctx, targets...)
+	}
+	if err != nil {
+		err = errors.Join(con.WriteSummary(os.Stdout, con.Results()), err)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = errors.Wrapf(err, "timed out after %s", m.Timeout)
+	}
+	if m.Timings {
+		err = errors.Join(err, con.WriteTimings(os.Stdout))
+	}
+	if m.Lanes {
+		err = errors.Join(err, con.WriteGantt(os.Stdout, GanttWidth))
+	}
+	if m.Trace != "" {
+		err = errors.Join(err, con.WriteTraceFile(m.Trace))
+	}
+	return err
 }
 
 var bolRegex = regexp.MustCompile("^")
@@ -157,45 +622,27 @@ func OpenHashDB(dir string) (*sqlite.DB, error) {
 
 const fabVersionBasename = "fab-version.json"
 
+// driverBuildBasename is the name of the subdirectory of a driver directory
+// where the driver's code is assembled and compiled.
+// It persists between compilations
+// so that the go compiler can reuse its build cache.
+const driverBuildBasename = "build"
+
 // TODO: Remove skipVersionCheck, which is here only to help an old test keep running.
 // Update the test instead.
 func (m *Main) getDriver(ctx context.Context, skipVersionCheck bool) (_ string, err error) {
-	pkgdir := filepath.Join(m.Topdir, "_fab")
-	_, err = os.Stat(pkgdir)
-	if errors.Is(err, fs.ErrNotExist) {
-		return "", errNoDriver
-	}
-	config := &packages.Config{
-		Mode:    LoadMode,
-		Context: ctx,
-		Dir:     pkgdir,
-	}
-	pkgs, err := packages.Load(config, ".")
-	if errors.Is(err, fs.ErrNotExist) {
-		return "", errNoDriver
-	}
+	dirs, err := fabPackageDirs(m.Topdir)
 	if err != nil {
-		return "", errors.Wrapf(err, "loading %s", pkgdir)
+		return "", errors.Wrapf(err, "finding _fab dirs in %s", m.Topdir)
 	}
-	if len(pkgs) == 0 {
+	if len(dirs) == 0 {
 		return "", errNoDriver
 	}
-	if len(pkgs) != 1 {
-		return "", fmt.Errorf(
-			"loaded %d packages in %s, want 1 %v",
-			len(pkgs),
-			pkgdir,
-			slices.Map(pkgs, func(p *packages.Package) string { return p.PkgPath }),
-		)
+	pkgs, err := loadFabPackages(ctx, m.Topdir, dirs)
+	if err != nil {
+		return "", err
 	}
 	pkg := pkgs[0]
-	if len(pkg.Errors) > 0 {
-		err = nil
-		for _, e := range pkg.Errors {
-			err = errors.Join(err, e)
-		}
-		return "", errors.Wrapf(err, "loading package %s", pkg.Name)
-	}
 
 	driverdir := filepath.Join(m.Fabdir, pkg.PkgPath)
 	if err = os.MkdirAll(driverdir, 0755); err != nil {
@@ -248,14 +695,16 @@ func (m *Main) getDriver(ctx context.Context, skipVersionCheck bool) (_ string,
 	}
 
 	dh := newDirHasher()
-	for _, filename := range pkg.GoFiles { // TODO: is this the right set of files?
-		if err = addFileToHash(dh, filename); err != nil {
-			return "", errors.Wrapf(err, "hashing file %s", filename)
+	for _, pkg := range pkgs {
+		for _, filename := range driverSourceFiles(pkg) {
+			if err = addFileToHash(dh, filename); err != nil {
+				return "", errors.Wrapf(err, "hashing file %s", filename)
+			}
 		}
 	}
 	newhash, err := dh.hash()
 	if err != nil {
-		return "", errors.Wrapf(err, "computing hash of directory %s", pkgdir)
+		return "", errors.Wrap(err, "computing hash of driver source files")
 	}
 
 	if !compile {
@@ -275,7 +724,7 @@ func (m *Main) getDriver(ctx context.Context, skipVersionCheck bool) (_ string,
 		return driver, nil
 	}
 
-	if err = CompilePackage(ctx, pkg, driver); err != nil {
+	if err = CompilePackages(ctx, m.Topdir, pkgs, filepath.Join(driverdir, driverBuildBasename), driver); err != nil {
 		return "", errors.Wrapf(err, "compiling driver %s", driver)
 	}
 	if err = os.WriteFile(hashfile, []byte(newhash), 0644); err != nil {
@@ -2,6 +2,7 @@ package fab
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -90,3 +91,29 @@ func TestDriverless(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestMainUIAudit(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		m    Main
+	}{{
+		name: "audit",
+		m:    Main{UI: true, Audit: true},
+	}, {
+		name: "audit_url",
+		m:    Main{UI: true, AuditURL: "http://localhost/audit"},
+	}}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tc.m.Run(context.Background()); !errors.Is(err, errUIAudit) {
+				t.Errorf("got error %v, want %v", err, errUIAudit)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package fab
+
+import "path/filepath"
+
+// Namespace is a scoped registrar produced by [Controller.Namespace].
+// It registers targets with names qualified by a prefix,
+// the way the targets in a YAML file in a subdirectory
+// are qualified by the subdirectory's name.
+type Namespace struct {
+	con    *Controller
+	prefix string
+}
+
+// Namespace returns a [Namespace] for registering targets under the given prefix.
+// This lets a Go package define a family of related targets,
+// such as proto/Gen and proto/Lint,
+// without building their names by hand.
+//
+// Example:
+//
+//	ns := con.Namespace("proto")
+//	ns.Register("Gen", gen, fab.WithDoc("Generate code from .proto files."))  // registers proto/Gen
+//	ns.Register("Lint", lint, fab.WithDoc("Lint the .proto files."))          // registers proto/Lint
+func (con *Controller) Namespace(prefix string) *Namespace {
+	return &Namespace{con: con, prefix: filepath.Clean(prefix)}
+}
+
+// Prefix returns the prefix of ns.
+func (ns *Namespace) Prefix() string {
+	return ns.prefix
+}
+
+// Name returns name qualified with the prefix of ns.
+func (ns *Namespace) Name(name string) string {
+	return filepath.Join(ns.prefix, name)
+}
+
+// Register registers target under the qualified form of name
+// (see [Namespace.Name]).
+// It is otherwise the same as [Controller.Register].
+func (ns *Namespace) Register(name string, target Target, opts ...RegisterOption) (Target, error) {
+	return ns.con.Register(ns.Name(name), target, opts...)
+}
+
+// Target returns the target registered under the qualified form of name,
+// and its doc string.
+// See [Controller.RegistryTarget].
+func (ns *Namespace) Target(name string) (Target, string) {
+	return ns.con.RegistryTarget(ns.Name(name))
+}
+
+// Namespace returns a nested [Namespace]
+// whose prefix is the qualified form of prefix.
+func (ns *Namespace) Namespace(prefix string) *Namespace {
+	return ns.con.Namespace(ns.Name(prefix))
+}
@@ -0,0 +1,48 @@
+package fab
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestNamespace(t *testing.T) {
+	t.Parallel()
+
+	var (
+		con   = NewController("")
+		ns    = con.Namespace("proto")
+		gen   = &countTarget{}
+		check = &countTarget{}
+	)
+
+	if _, err := ns.Register("Gen", gen, WithDoc("Generate.")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ns.Namespace("buf").Register("Check", check); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := con.RegistryNames(), []string{"proto/Gen", "proto/buf/Check"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got names %v, want %v", got, want)
+	}
+	if target, doc := ns.Target("Gen"); target != gen || doc != "Generate." {
+		t.Errorf("got %v, %q for Gen; want %v, \"Generate.\"", target, doc, gen)
+	}
+	if got := con.Describe(check); got != "proto/buf/Check" {
+		t.Errorf("got description %s, want proto/buf/Check", got)
+	}
+
+	// Qualified names work on the command line
+	// just like those of YAML targets in subdirectories.
+	targets, err := con.ParseArgs([]string{"proto/Gen"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := con.Run(context.Background(), targets...); err != nil {
+		t.Fatal(err)
+	}
+	if gen.count != 1 {
+		t.Errorf("got count %d, want 1", gen.count)
+	}
+}
@@ -0,0 +1,281 @@
+package fab
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Param declares a command-line parameter of a target.
+// See [WithParams].
+type Param struct {
+	// Name is the name of the parameter,
+	// which is given on the command line as -Name.
+	Name string `json:"name" yaml:"Name"`
+
+	// Type is the type of the parameter:
+	// "string" (the default if Type is empty),
+	// "int", "float", "bool", or "duration"
+	// (in the syntax of [time.ParseDuration]).
+	Type string `json:"type,omitempty" yaml:"Type"`
+
+	// Default is the value of the parameter when it is not given,
+	// in the syntax of its type.
+	// If Default is empty,
+	// the default is the zero value of the type.
+	Default string `json:"default,omitempty" yaml:"Default"`
+
+	// Doc is a short description of the parameter.
+	Doc string `json:"doc,omitempty" yaml:"Doc"`
+}
+
+// WithParams is a [RegisterOption] declaring the command-line parameters of a target.
+//
+// When the target is named on the command line,
+// the parameters may follow it as flags,
+// as in "fab Deploy -env prod -replicas 3".
+// They are parsed according to their types,
+// and the target's Run method can get their values
+// (or their defaults, for those not given)
+// with [GetParams].
+// Any remaining arguments are available with [GetArgs].
+// The same happens when the target is run with [ArgTarget].
+//
+// The parameters of a target are shown by "fab -list."
+//
+// In YAML,
+// parameters are declared in the Params field
+// of the mapping form of a target entry
+// (see [Controller.ReadYAML]).
+//
+// Example:
+//
+//	Deploy:
+//	  Params:
+//	    - Name: env
+//	      Default: staging
+//	      Doc: The environment to deploy to.
+//	    - Name: replicas
+//	      Type: int
+//	      Default: 1
+//	  Target: !Command
+//	    Shell: ./deploy.sh
+func WithParams(params ...Param) RegisterOption {
+	return func(tuple *targetRegistryTuple) {
+		tuple.params = append(tuple.params, params...)
+	}
+}
+
+// Params is the set of parameter values returned by [GetParams],
+// keyed by parameter name.
+// Each value has the Go type corresponding to its [Param] type:
+// string, int, float64, bool, or [time.Duration].
+type Params map[string]any
+
+// String returns the value of the string parameter with the given name,
+// or "" if there is none.
+func (p Params) String(name string) string {
+	val, _ := p[name].(string)
+	return val
+}
+
+// Int returns the value of the int parameter with the given name,
+// or 0 if there is none.
+func (p Params) Int(name string) int {
+	val, _ := p[name].(int)
+	return val
+}
+
+// Float returns the value of the float parameter with the given name,
+// or 0 if there is none.
+func (p Params) Float(name string) float64 {
+	val, _ := p[name].(float64)
+	return val
+}
+
+// Bool returns the value of the bool parameter with the given name,
+// or false if there is none.
+func (p Params) Bool(name string) bool {
+	val, _ := p[name].(bool)
+	return val
+}
+
+// Duration returns the value of the duration parameter with the given name,
+// or 0 if there is none.
+func (p Params) Duration(name string) time.Duration {
+	val, _ := p[name].(time.Duration)
+	return val
+}
+
+// withParams decorates a context with the parameter values of a target.
+// Retrieve them with [GetParams].
+func withParams(ctx context.Context, params Params) context.Context {
+	return context.WithValue(ctx, paramsKeyType{}, params)
+}
+
+// GetParams returns the values of the parameters
+// declared with [WithParams]
+// of the target being run with ctx.
+// The default, for a target with no declared parameters, is nil.
+func GetParams(ctx context.Context) Params {
+	val, _ := ctx.Value(paramsKeyType{}).(Params)
+	return val
+}
+
+// checkParams checks that the types and defaults of params are valid.
+func checkParams(params []Param) error {
+	seen := make(map[string]bool)
+	for _, p := range params {
+		if p.Name == "" {
+			return fmt.Errorf("parameter with no name")
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("duplicate parameter %s", p.Name)
+		}
+		seen[p.Name] = true
+		if _, err := p.parse(p.Default); err != nil {
+			return errors.Wrapf(err, "in default for parameter %s", p.Name)
+		}
+	}
+	return nil
+}
+
+// parse parses s according to the type of p.
+// The empty string produces the zero value of the type.
+func (p Param) parse(s string) (any, error) {
+	switch p.Type {
+	case "", "string":
+		return s, nil
+	case "int":
+		if s == "" {
+			return 0, nil
+		}
+		return strconv.Atoi(s)
+	case "float":
+		if s == "" {
+			return float64(0), nil
+		}
+		return strconv.ParseFloat(s, 64)
+	case "bool":
+		if s == "" {
+			return false, nil
+		}
+		return strconv.ParseBool(s)
+	case "duration":
+		if s == "" {
+			return time.Duration(0), nil
+		}
+		return time.ParseDuration(s)
+	}
+	return nil, fmt.Errorf("unknown parameter type %s", p.Type)
+}
+
+// paramValue is a [flag.Value] for a [Param].
+type paramValue struct {
+	param Param
+	val   any
+}
+
+func (v *paramValue) String() string {
+	if v == nil || v.val == nil {
+		return ""
+	}
+	return fmt.Sprint(v.val)
+}
+
+func (v *paramValue) Set(s string) error {
+	val, err := v.param.parse(s)
+	if err != nil {
+		return err
+	}
+	v.val = val
+	return nil
+}
+
+// IsBoolFlag allows bool parameters to be given as -name without a value.
+func (v *paramValue) IsBoolFlag() bool {
+	return v.param.Type == "bool"
+}
+
+// parseParams parses args according to params,
+// returning the parameter values and the remaining arguments.
+func parseParams(params []Param, args []string) (Params, []string, error) {
+	var (
+		fs     = flag.NewFlagSet("", flag.ContinueOnError)
+		values = make(map[string]*paramValue)
+	)
+	fs.SetOutput(io.Discard)
+	for _, p := range params {
+		val, err := p.parse(p.Default)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "in default for parameter %s", p.Name)
+		}
+		v := &paramValue{param: p, val: val}
+		values[p.Name] = v
+		fs.Var(v, p.Name, p.Doc)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	result := make(Params)
+	for name, v := range values {
+		result[name] = v.val
+	}
+	return result, fs.Args(), nil
+}
+
+// targetParams returns the parameters declared for target
+// when it was registered.
+func (con *Controller) targetParams(target Target) []Param {
+	addr, err := targetAddr(target)
+	if err != nil {
+		return nil
+	}
+
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	return con.targetsByAddr[addr].params
+}
+
+// writeParams writes the parameters of the registry target with the given name
+// for [Controller.ListTargets].
+func (con *Controller) writeParams(w io.Writer, name string) {
+	con.mu.Lock()
+	params := con.targetsByName[name].params
+	con.mu.Unlock()
+
+	for _, p := range params {
+		typ := p.Type
+		if typ == "" {
+			typ = "string"
+		}
+		line := fmt.Sprintf("    -%s %s", p.Name, typ)
+		if p.Default != "" {
+			line += " (default " + p.Default + ")"
+		}
+		if p.Doc != "" {
+			line += ": " + p.Doc
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// yamlParams decodes the Params field of a YAML target entry.
+func yamlParams(node *yaml.Node) ([]Param, error) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.SequenceNode}
+	}
+	var params []Param
+	if err := node.Decode(&params); err != nil {
+		return nil, errors.Wrap(err, "decoding Params")
+	}
+	return params, nil
+}
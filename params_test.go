@@ -0,0 +1,139 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParams(t *testing.T) {
+	t.Parallel()
+
+	var (
+		gotParams Params
+		gotArgs   []string
+	)
+	target := F(func(ctx context.Context, _ *Controller) error {
+		gotParams, gotArgs = GetParams(ctx), GetArgs(ctx)
+		return nil
+	})
+
+	params := []Param{
+		{Name: "env", Default: "staging", Doc: "The environment."},
+		{Name: "replicas", Type: "int", Default: "1"},
+		{Name: "dry", Type: "bool"},
+		{Name: "wait", Type: "duration", Default: "1m"},
+		{Name: "ratio", Type: "float"},
+	}
+
+	cases := []struct {
+		args       []string
+		wantParams Params
+		wantArgs   []string
+		wantErr    bool
+	}{{
+		args:       []string{"Deploy"},
+		wantParams: Params{"env": "staging", "replicas": 1, "dry": false, "wait": time.Minute, "ratio": 0.0},
+	}, {
+		args:       []string{"Deploy", "-env", "prod", "-replicas", "3", "-dry", "-wait=30s", "-ratio", "0.5", "extra"},
+		wantParams: Params{"env": "prod", "replicas": 3, "dry": true, "wait": 30 * time.Second, "ratio": 0.5},
+		wantArgs:   []string{"extra"},
+	}, {
+		args:    []string{"Deploy", "-replicas", "many"},
+		wantErr: true,
+	}, {
+		args:    []string{"Deploy", "-unknown", "x"},
+		wantErr: true,
+	}}
+
+	for i, c := range cases {
+		t.Run(strings.Join(c.args, " "), func(t *testing.T) {
+			con := NewController("")
+			if _, err := con.Register("Deploy", target, WithParams(params...)); err != nil {
+				t.Fatal(err)
+			}
+
+			targets, err := con.ParseArgs(c.args)
+			if c.wantErr {
+				if err == nil {
+					t.Errorf("case %d: got no error", i+1)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotParams, gotArgs = nil, nil
+			if err := con.Run(context.Background(), targets...); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotParams, c.wantParams) {
+				t.Errorf("got params %v, want %v", gotParams, c.wantParams)
+			}
+			if !reflect.DeepEqual(gotArgs, c.wantArgs) {
+				t.Errorf("got args %v, want %v", gotArgs, c.wantArgs)
+			}
+		})
+	}
+}
+
+func TestParamsAccessors(t *testing.T) {
+	t.Parallel()
+
+	p := Params{"s": "x", "i": 2, "f": 1.5, "b": true, "d": time.Second}
+	if p.String("s") != "x" || p.Int("i") != 2 || p.Float("f") != 1.5 || !p.Bool("b") || p.Duration("d") != time.Second {
+		t.Errorf("wrong values from %v", p)
+	}
+	if p.String("i") != "" || p.Int("missing") != 0 {
+		t.Error("got non-zero values for mismatched or missing parameters")
+	}
+}
+
+func TestBadParams(t *testing.T) {
+	t.Parallel()
+
+	for _, params := range [][]Param{
+		{{Name: ""}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", Type: "complex"}},
+		{{Name: "a", Type: "int", Default: "x"}},
+	} {
+		con := NewController("")
+		if _, err := con.Register("X", &countTarget{}, WithParams(params...)); err == nil {
+			t.Errorf("got no error for %v", params)
+		}
+	}
+}
+
+func TestParamsYAML(t *testing.T) {
+	t.Parallel()
+
+	const yml = `
+# Deploy the app.
+Deploy:
+  Params:
+    - Name: env
+      Default: staging
+      Doc: The environment.
+    - Name: replicas
+      Type: int
+  Target: !Command
+    Shell: "true"
+`
+
+	con := NewController("")
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	con.ListTargets(buf)
+	const want = "Deploy\n    Deploy the app.\n    -env string (default staging): The environment.\n    -replicas int\n"
+	if buf.String() != want {
+		t.Errorf("got listing %q, want %q", buf.String(), want)
+	}
+}
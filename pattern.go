@@ -0,0 +1,306 @@
+package fab
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// PatternFunc is the type of the function in a [Pattern] target
+// that makes the subtarget for a given stem.
+// The out and in arguments are the Pattern's output and input file patterns
+// with the stem substituted for the % character.
+// The result is used as the subtarget of a [Files] target with those inputs and outputs.
+type PatternFunc = func(stem string, out, in []string) (Target, error)
+
+// Pattern creates a make-style pattern rule.
+// Each string in out and in is a file name containing a single % character,
+// which matches a non-empty "stem."
+// Strings in "in" may also be plain file names with no %.
+//
+// Whenever a file matching one of the output patterns is needed
+// as an input file of some [Files] target
+// or is named on the command line
+// (see [Controller.ParseArgs]),
+// the pattern is expanded for that file's stem:
+// fn is called to make a subtarget,
+// which is then wrapped in a Files target
+// with the stem substituted into the input and output patterns.
+// Each stem is expanded only once.
+//
+// Running the Pattern target itself
+// expands and runs the pattern for every stem
+// for which a file matching the first input pattern exists.
+//
+// A Pattern target may be specified in YAML using the !Pattern tag,
+// which introduces a mapping whose fields are:
+//
+//   - Out: the list of output file patterns
+//   - In: the list of input file patterns
+//   - Target: the subtarget
+//
+// Within the Target node,
+// the following strings are replaced when the pattern is expanded:
+//
+//   - $* by the stem
+//   - $@ by the first output file
+//   - $< by the first input file
+//   - $^ by all the input files, separated by spaces
+//
+// Example:
+//
+//	Objects: !Pattern
+//	  Out: ["%.o"]
+//	  In: ["%.c", common.h]
+//	  Target: !Command
+//	    Shell: cc -c -o $@ $<
+func Pattern(out, in []string, fn PatternFunc, opts ...FilesOpt) (Target, error) {
+	for _, o := range out {
+		if strings.Count(o, "%") != 1 {
+			return nil, fmt.Errorf("output pattern %s must contain exactly one %%", o)
+		}
+	}
+	for _, i := range in {
+		if strings.Count(i, "%") > 1 {
+			return nil, fmt.Errorf("input pattern %s may contain at most one %%", i)
+		}
+	}
+
+	result := &pattern{
+		Out:       out,
+		In:        in,
+		fn:        fn,
+		opts:      opts,
+		instances: make(map[string]Target),
+	}
+
+	patternsMu.Lock()
+	patterns = append(patterns, result)
+	patternsMu.Unlock()
+
+	return result, nil
+}
+
+var (
+	patternsMu sync.Mutex
+	patterns   []*pattern
+)
+
+type pattern struct {
+	Out []string
+	In  []string
+
+	fn   PatternFunc
+	opts []FilesOpt
+
+	mu        sync.Mutex
+	instances map[string]Target // stem -> Files target
+}
+
+var _ Target = &pattern{}
+
+// Run implements Target.Run.
+func (p *pattern) Run(ctx context.Context, con *Controller) error {
+	if len(p.In) == 0 || !strings.Contains(p.In[0], "%") {
+		return fmt.Errorf("cannot run pattern without a %% in its first input")
+	}
+
+	matches, err := filepath.Glob(strings.Replace(p.In[0], "%", "*", 1))
+	if err != nil {
+		return errors.Wrapf(err, "expanding %s", p.In[0])
+	}
+	sort.Strings(matches)
+
+	var targets []Target
+	for _, match := range matches {
+		stem, ok := matchPattern(p.In[0], match)
+		if !ok {
+			continue
+		}
+		target, err := p.instance(stem)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, target)
+	}
+
+	return con.Run(ctx, targets...)
+}
+
+// Desc implements Target.Desc.
+func (*pattern) Desc() string {
+	return "Pattern"
+}
+
+// instance returns the Files target for the given stem,
+// creating it if necessary.
+func (p *pattern) instance(stem string) (Target, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if target, ok := p.instances[stem]; ok {
+		return target, nil
+	}
+
+	var (
+		out = substStem(p.Out, stem)
+		in  = substStem(p.In, stem)
+	)
+	target, err := p.fn(stem, out, in)
+	if err != nil {
+		return nil, errors.Wrapf(err, "expanding pattern for stem %s", stem)
+	}
+	result := Files(target, in, out, p.opts...)
+	p.instances[stem] = result
+	return result, nil
+}
+
+func substStem(pats []string, stem string) []string {
+	result := make([]string, 0, len(pats))
+	for _, pat := range pats {
+		result = append(result, strings.Replace(pat, "%", stem, 1))
+	}
+	return result
+}
+
+// matchPattern tells whether name matches pat,
+// which contains a single %,
+// and if so returns the stem.
+func matchPattern(pat, name string) (string, bool) {
+	prefix, suffix, ok := strings.Cut(pat, "%")
+	if !ok {
+		return "", false
+	}
+	if len(name) <= len(prefix)+len(suffix) {
+		return "", false
+	}
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	return name[len(prefix) : len(name)-len(suffix)], true
+}
+
+// findInPatterns looks for a pattern with an output pattern matching the given file name,
+// and expands it.
+// It returns nil if there is no such pattern.
+func findInPatterns(name string) (Target, error) {
+	patternsMu.Lock()
+	ps := patterns
+	patternsMu.Unlock()
+
+	for _, p := range ps {
+		for _, o := range p.Out {
+			if stem, ok := matchPattern(o, name); ok {
+				return p.instance(stem)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// findPrereq finds the target that produces the given file,
+// looking first in the files registry (see [Files])
+// and then among patterns (see [Pattern]).
+func findPrereq(name string) (Target, error) {
+	if target := findInFilesRegistry(name); target != nil {
+		return target, nil
+	}
+	return findInPatterns(name)
+}
+
+func patternDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var ypattern struct {
+		In     yaml.Node `yaml:"In"`
+		Out    yaml.Node `yaml:"Out"`
+		Target yaml.Node `yaml:"Target"`
+	}
+	if err := node.Decode(&ypattern); err != nil {
+		return nil, errors.Wrap(err, "YAML error in Pattern node")
+	}
+
+	in, err := con.YAMLFileList(&ypattern.In, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Pattern.In node")
+	}
+	out, err := con.YAMLFileList(&ypattern.Out, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Pattern.Out node")
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no outputs in Pattern node")
+	}
+
+	// Files as they should appear in the subtarget,
+	// i.e. relative to dir,
+	// where a subtarget like !Command runs.
+	var (
+		absDir = con.JoinPath(dir)
+		relIn  = relPaths(absDir, in)
+		relOut = relPaths(absDir, out)
+	)
+
+	targetNode := ypattern.Target
+
+	fn := func(stem string, _, _ []string) (Target, error) {
+		var (
+			sIn  = substStem(relIn, stem)
+			sOut = substStem(relOut, stem)
+		)
+		var firstIn string
+		if len(sIn) > 0 {
+			firstIn = sIn[0]
+		}
+		r := strings.NewReplacer(
+			"$*", stem,
+			"$@", sOut[0],
+			"$<", firstIn,
+			"$^", strings.Join(sIn, " "),
+		)
+		n := substYAML(&targetNode, r.Replace)
+		return con.YAMLTarget(n, dir)
+	}
+
+	return Pattern(out, in, fn)
+}
+
+func relPaths(dir string, files []string) []string {
+	result := make([]string, 0, len(files))
+	for _, f := range files {
+		if rel, err := filepath.Rel(dir, f); err == nil {
+			f = rel
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+// substYAML returns a deep copy of node
+// with f applied to all scalar values.
+func substYAML(node *yaml.Node, f func(string) string) *yaml.Node {
+	result := *node
+	if node.Kind == yaml.ScalarNode {
+		result.Value = f(node.Value)
+	}
+	if len(node.Content) > 0 {
+		result.Content = make([]*yaml.Node, 0, len(node.Content))
+		for _, child := range node.Content {
+			result.Content = append(result.Content, substYAML(child, f))
+		}
+	}
+	return &result
+}
+
+func init() {
+	RegisterYAMLTarget("Pattern", patternDecoder)
+	SetYAMLTagDoc("Pattern", "Define a make-style pattern rule.")
+}
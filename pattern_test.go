@@ -0,0 +1,120 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		pat, name, wantStem string
+		wantOK              bool
+	}{
+		{pat: "%.o", name: "foo.o", wantStem: "foo", wantOK: true},
+		{pat: "obj/%.o", name: "obj/a/b.o", wantStem: "a/b", wantOK: true},
+		{pat: "%.o", name: ".o"},
+		{pat: "%.o", name: "foo.c"},
+		{pat: "obj/%.o", name: "foo.o"},
+		{pat: "foo.o", name: "foo.o"},
+	}
+
+	for _, tc := range cases {
+		stem, ok := matchPattern(tc.pat, tc.name)
+		if ok != tc.wantOK || stem != tc.wantStem {
+			t.Errorf("matchPattern(%s, %s) = %s, %v; want %s, %v", tc.pat, tc.name, stem, ok, tc.wantStem, tc.wantOK)
+		}
+	}
+}
+
+func TestPattern(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	for _, name := range []string{"a", "b"} {
+		if err = os.WriteFile(filepath.Join(tmpdir, name+".c"), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const yml = `
+Objects: !Pattern
+  Out: ["%.o"]
+  In: ["%.c"]
+  Target: !Command
+    Shell: cp $< $@
+
+Prog: !Files
+  In: [a.o, b.o]
+  Out: [prog]
+  Target: !Command
+    Shell: cat a.o b.o
+    Stdout: prog
+`
+	if err = os.WriteFile(filepath.Join(tmpdir, "fab.yaml"), []byte(yml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	con := NewController(tmpdir)
+	if err = con.ReadYAMLFile(""); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	ctx = WithVerbose(ctx, testing.Verbose())
+
+	check := func(name, want string) {
+		t.Helper()
+
+		got, err := os.ReadFile(filepath.Join(tmpdir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("got %s = %q, want %q", name, string(got), want)
+		}
+	}
+
+	t.Run("prereq", func(t *testing.T) {
+		prog, _ := con.RegistryTarget("Prog")
+		if err := con.Run(ctx, prog); err != nil {
+			t.Fatal(err)
+		}
+		check("a.o", "a")
+		check("b.o", "b")
+		check("prog", "ab")
+	})
+
+	t.Run("arg", func(t *testing.T) {
+		targets, err := con.ParseArgs([]string{"a.o"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := findPrereq(filepath.Join(tmpdir, "a.o"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(targets) != 1 || targets[0] != want {
+			t.Errorf("got %v, want [%v]", targets, want)
+		}
+	})
+
+	t.Run("all", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(tmpdir, "c.c"), []byte("c"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		objects, _ := con.RegistryTarget("Objects")
+		if err := con.Run(ctx, objects); err != nil {
+			t.Fatal(err)
+		}
+		check("c.o", "c")
+	})
+}
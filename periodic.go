@@ -0,0 +1,116 @@
+package fab
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Periodic creates a target that works like [Check],
+// but which also reruns its subtarget once per period
+// even when none of its input files has changed.
+//
+// This is useful for checks whose outcome depends on external data,
+// such as a vulnerability database or the packages in a container image.
+// For example, a dependency scan with a period of 24 hours
+// reruns whenever the project's dependencies change,
+// and otherwise at most once a day.
+//
+// Periods are measured in fixed windows since the zero time
+// (see [time.Time.Truncate]),
+// not from the last time the subtarget ran.
+//
+// A Periodic target may be specified in YAML using the !Periodic tag,
+// which introduces a mapping whose fields are:
+//
+//   - Target: the nested subtarget, or target name
+//   - In: the list of input files, interpreted with [YAMLFileList]
+//   - Period: a duration string as parsed by [time.ParseDuration], e.g. 24h
+func Periodic(target Target, in []string, period time.Duration, opts ...FilesOpt) Target {
+	return Check(&periodic{Target: target, Period: period}, in, opts...)
+}
+
+type periodic struct {
+	Target Target
+	Period time.Duration
+}
+
+var _ Target = &periodic{}
+
+// Run implements Target.Run.
+func (p *periodic) Run(ctx context.Context, con *Controller) error {
+	return con.Run(ctx, p.Target)
+}
+
+// Desc implements Target.Desc.
+func (*periodic) Desc() string {
+	return "Periodic"
+}
+
+// Children implements GraphChildren.
+func (p *periodic) Children() []Target {
+	return []Target{p.Target}
+}
+
+// MarshalJSON implements json.Marshaler.
+// The encoding includes the current time window,
+// so the hash of a [Periodic] target changes once per period.
+func (p *periodic) MarshalJSON() ([]byte, error) {
+	var window int64
+	if p.Period > 0 {
+		window = time.Now().Truncate(p.Period).UnixNano()
+	}
+
+	return json.Marshal(struct {
+		Target     Target `json:"target"`
+		TargetType string `json:"target_type"`
+		Period     string `json:"period"`
+		Window     int64  `json:"window"`
+	}{
+		Target:     p.Target,
+		TargetType: reflect.TypeOf(p.Target).String(),
+		Period:     p.Period.String(),
+		Window:     window,
+	})
+}
+
+func periodicDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var yperiodic struct {
+		In     yaml.Node `yaml:"In"`
+		Target yaml.Node `yaml:"Target"`
+		Period string    `yaml:"Period"`
+	}
+	if err := node.Decode(&yperiodic); err != nil {
+		return nil, errors.Wrap(err, "YAML error in Periodic node")
+	}
+
+	target, err := con.YAMLTarget(&yperiodic.Target, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Target child of Periodic node")
+	}
+
+	in, err := con.YAMLFileList(&yperiodic.In, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Periodic.In node")
+	}
+
+	period, err := time.ParseDuration(yperiodic.Period)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Periodic.Period node")
+	}
+
+	return Periodic(target, in, period), nil
+}
+
+func init() {
+	RegisterYAMLTarget("Periodic", periodicDecoder)
+	SetYAMLTagDoc("Periodic", "Run a check when its inputs change, and otherwise after a period of time.")
+}
@@ -0,0 +1,63 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestPeriodic(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	inpath := filepath.Join(tmpdir, "in")
+	if err = os.WriteFile(inpath, []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	ctx = WithVerbose(ctx, testing.Verbose())
+	ctx = WithHashDB(ctx, memdb(set.New[string]()))
+
+	try := func(target Target, ct *countTarget, want uint32) {
+		t.Helper()
+
+		con := NewController("")
+		if err := con.Run(ctx, target); err != nil {
+			t.Fatal(err)
+		}
+		if ct.count != want {
+			t.Errorf("got count %d, want %d", ct.count, want)
+		}
+	}
+
+	t.Run("long_period", func(t *testing.T) {
+		var (
+			ct     = &countTarget{}
+			target = Periodic(ct, []string{inpath}, 24*time.Hour)
+		)
+		try(target, ct, 1)
+		try(target, ct, 1) // same window, inputs unchanged
+	})
+
+	t.Run("short_period", func(t *testing.T) {
+		const period = 50 * time.Millisecond
+
+		var (
+			ct     = &countTarget{}
+			target = Periodic(ct, []string{inpath}, period)
+		)
+		try(target, ct, 1)
+		time.Sleep(period + 10*time.Millisecond)
+		try(target, ct, 2) // new window
+	})
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package fab
+
+import "os/exec"
+
+// defaultShell is the shell program to use when $SHELL is not set.
+// See shellProgram.
+func defaultShell() string {
+	return "/bin/sh"
+}
+
+// isRooted tells whether path is relative to the root of the current drive,
+// which is possible only on Windows.
+func isRooted(string) bool {
+	return false
+}
+
+// setShellCmdLine adjusts the command line of cmd when it runs cmd.exe,
+// which is possible only on Windows.
+func setShellCmdLine(*exec.Cmd) {}
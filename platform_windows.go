@@ -0,0 +1,47 @@
+//go:build windows
+
+package fab
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// defaultShell is the shell program to use when $SHELL is not set.
+// See shellProgram.
+func defaultShell() string {
+	if sh, err := exec.LookPath("sh"); err == nil {
+		return sh
+	}
+	if comspec := os.Getenv("ComSpec"); comspec != "" {
+		return comspec
+	}
+	return "cmd.exe"
+}
+
+// isRooted tells whether path begins with a path separator,
+// making it relative to the root of the current drive
+// (as opposed to absolute, which requires a drive letter or UNC prefix).
+func isRooted(path string) bool {
+	return strings.HasPrefix(path, `\`) || strings.HasPrefix(path, "/")
+}
+
+// setShellCmdLine makes cmd,
+// if it runs a command string with cmd.exe
+// (see shellArgv),
+// pass the string to cmd.exe as written.
+// Otherwise the quoting that Go applies to each argument on Windows
+// adds backslashes before the quotes in the string,
+// which cmd.exe does not understand.
+// The /S flag makes cmd.exe remove only the outer pair of quotes added here.
+func setShellCmdLine(cmd *exec.Cmd) {
+	if len(cmd.Args) != 3 || cmd.Args[1] != "/C" || shellName(cmd.Args[0]) != "cmd" {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.CmdLine = syscall.EscapeArg(cmd.Args[0]) + ` /S /C "` + cmd.Args[2] + `"`
+}
@@ -0,0 +1,81 @@
+//go:build windows
+
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJoinPathWindows(t *testing.T) {
+	t.Parallel()
+
+	con := &Controller{topdir: `C:\top`}
+
+	cases := []struct {
+		inp  []string
+		want string
+	}{{
+		inp:  []string{"a/b", "c"},
+		want: `C:\top\a\b\c`,
+	}, {
+		inp:  []string{"a", `D:\x\y`},
+		want: `D:\x\y`,
+	}, {
+		inp:  []string{"a", "/x/y"},
+		want: `\x\y`,
+	}, {
+		inp:  []string{"a", `\\server\share\f`},
+		want: `\\server\share\f`,
+	}}
+
+	for _, tc := range cases {
+		if got := con.JoinPath(tc.inp...); got != tc.want {
+			t.Errorf("JoinPath(%q) = %s, want %s", tc.inp, got, tc.want)
+		}
+	}
+}
+
+func TestDefaultShellWindows(t *testing.T) {
+	t.Setenv("PATH", "")
+	t.Setenv("ComSpec", `C:\Windows\system32\cmd.exe`)
+	if got := defaultShell(); got != `C:\Windows\system32\cmd.exe` {
+		t.Errorf("got %s, want ComSpec", got)
+	}
+}
+
+func TestShellQuotingWindows(t *testing.T) {
+	comspec := os.Getenv("ComSpec")
+	if comspec == "" {
+		comspec = "cmd.exe"
+	}
+	t.Setenv("SHELL", comspec)
+
+	tmpdir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpdir, "a b.txt"), []byte("hello\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without setShellCmdLine,
+	// cmd.exe sees the quotes preceded by backslashes
+	// and cannot find the file.
+	got, err := CommandOutput(context.Background(), tmpdir, `type "a b.txt"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"hello"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	out := filepath.Join(tmpdir, "c d.txt")
+	c := &Command{Shell: `copy "a b.txt" "c d.txt"`, Dir: tmpdir}
+	if err := NewController(tmpdir).Run(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Error(err)
+	}
+}
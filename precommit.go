@@ -0,0 +1,311 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/slices"
+	"gopkg.in/yaml.v3"
+)
+
+// PreCommitArg is the command-line argument
+// that makes fab install a git pre-commit hook,
+// as in:
+//
+//	fab pre-commit [-force] [-print] [TARGET ...]
+//
+// The hook runs fab with the given targets,
+// or PreCommit if none are given.
+// Usually the target is a [PreCommit] target.
+// Use -print to write the hook to standard output instead of installing it,
+// and -force to replace an existing hook.
+//
+// See [InstallPreCommitHook].
+const PreCommitArg = "pre-commit"
+
+// DefaultPreCommitTarget is the target that the hook installed by `fab pre-commit` runs
+// when no targets are given.
+// See [PreCommitArg].
+const DefaultPreCommitTarget = "PreCommit"
+
+// PreCommit produces a target that runs the given targets
+// on the files that are staged for committing in git,
+// for use in a git pre-commit hook
+// (see [PreCommitArg]).
+//
+// When it runs,
+// it gets the list of staged files
+// (excluding deleted files)
+// in the project's top directory.
+// If any patterns are given,
+// the list is restricted to the files matching at least one of them,
+// as with [filepath.Match],
+// either by base name
+// (as in *.go)
+// or by path relative to the top directory
+// (as in cmd/*/main.go).
+// If the list is not empty,
+// each target is run as if by [ArgTarget]
+// with "--" and the list of files as its arguments.
+// A target that understands these arguments,
+// such as [Format] or [License],
+// operates only on those files;
+// others run as usual.
+//
+// Note that the files are checked as they are in the working tree,
+// which may differ from what is staged.
+//
+// A PreCommit target may be specified in YAML using the tag !PreCommit,
+// which introduces a mapping whose fields are:
+//
+//   - Targets: a sequence of targets or target names
+//   - Patterns: a sequence of patterns
+//
+// Example:
+//
+//	PreCommit: !PreCommit
+//	  Targets: [Format, License]
+//	  Patterns: ["*.go"]
+func PreCommit(targets []Target, patterns ...string) Target {
+	return &preCommit{Targets: targets, Patterns: patterns}
+}
+
+type preCommit struct {
+	Targets  []Target
+	Patterns []string
+}
+
+var _ Target = &preCommit{}
+
+// Run implements Target.Run.
+func (pc *preCommit) Run(ctx context.Context, con *Controller) error {
+	staged, err := stagedFiles(ctx, con.JoinPath())
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	for _, file := range staged {
+		ok, err := pc.match(file)
+		if err != nil {
+			return err
+		}
+		if ok {
+			files = append(files, con.JoinPath(file))
+		}
+	}
+
+	if len(files) == 0 {
+		if GetVerbose(ctx) {
+			con.Indentf("  no staged files to check")
+		}
+		return nil
+	}
+
+	args := append([]string{"--"}, files...)
+	targets := slices.Map(pc.Targets, func(target Target) Target {
+		return ArgTarget(target, args...)
+	})
+	return con.Run(ctx, targets...)
+}
+
+// match tells whether file,
+// relative to the top directory,
+// matches one of pc's patterns.
+func (pc *preCommit) match(file string) (bool, error) {
+	if len(pc.Patterns) == 0 {
+		return true, nil
+	}
+	for _, pattern := range pc.Patterns {
+		for _, s := range []string{filepath.Base(file), file} {
+			ok, err := filepath.Match(pattern, s)
+			if err != nil {
+				return false, errors.Wrapf(err, "in pattern %s", pattern)
+			}
+			if ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Desc implements Target.Desc.
+func (*preCommit) Desc() string {
+	return "PreCommit"
+}
+
+// stagedFiles returns the files staged for committing in the git repository containing dir,
+// relative to dir.
+// Deleted files and files outside dir are omitted.
+func stagedFiles(ctx context.Context, dir string) ([]string, error) {
+	var (
+		cmd    = exec.CommandContext(ctx, "git", "diff", "--cached", "--name-only", "-z", "--diff-filter=ACMR", "--relative")
+		stderr bytes.Buffer
+	)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, CommandErr{Err: errors.Wrap(err, "listing staged files"), Output: stderr.Bytes()}
+	}
+
+	var result []string
+	for _, file := range strings.Split(string(out), "\x00") {
+		if file != "" {
+			result = append(result, filepath.FromSlash(file))
+		}
+	}
+	return result, nil
+}
+
+// PreCommitHook returns the text of a git pre-commit hook
+// that runs fab with the given arguments
+// in the directory rel,
+// relative to the top of the git repository.
+func PreCommitHook(rel string, args ...string) string {
+	buf := new(strings.Builder)
+	fmt.Fprintln(buf, "#!/bin/sh")
+	fmt.Fprintf(buf, "# Installed by \"fab %s\".\n", PreCommitArg)
+	if rel != "" && rel != "." {
+		fmt.Fprintf(buf, "cd \"$(git rev-parse --show-toplevel)\"/%s || exit 1\n", shellQuote(filepath.ToSlash(rel)))
+	}
+	fmt.Fprintf(buf, "exec fab %s\n", shellJoin(args))
+	return buf.String()
+}
+
+// InstallPreCommitHook installs a git pre-commit hook
+// (see [PreCommitHook])
+// in the git repository containing topdir,
+// running fab in topdir with the given arguments.
+// It returns the path of the hook.
+// An existing hook is an error unless force is true.
+func InstallPreCommitHook(ctx context.Context, topdir string, force bool, args ...string) (string, error) {
+	hook, rel, err := preCommitHookPath(ctx, topdir)
+	if err != nil {
+		return "", err
+	}
+
+	if !force {
+		if _, err := os.Stat(hook); err == nil {
+			return "", fmt.Errorf("%s already exists (use -force to replace it)", hook)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", errors.Wrapf(err, "statting %s", hook)
+		}
+	}
+	if err := mkdirParent(hook); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(hook, []byte(PreCommitHook(rel, args...)), 0755); err != nil {
+		return "", errors.Wrapf(err, "writing %s", hook)
+	}
+	// WriteFile does not change the mode of an existing file.
+	return hook, errors.Wrapf(os.Chmod(hook, 0755), "making %s executable", hook)
+}
+
+// preCommitHookPath returns the path of the pre-commit hook
+// for the git repository containing topdir,
+// and the path of topdir relative to the top of the repository.
+func preCommitHookPath(ctx context.Context, topdir string) (hook, rel string, err error) {
+	git := func(args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = topdir
+		out, err := cmd.Output()
+		if err != nil {
+			return "", errors.Wrapf(err, "running git %s", strings.Join(args, " "))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", "", err
+	}
+	hook, err = git("rev-parse", "--git-path", "hooks/pre-commit")
+	if err != nil {
+		return "", "", err
+	}
+	if !filepath.IsAbs(hook) {
+		hook = filepath.Join(topdir, hook)
+	}
+
+	abs, err := filepath.Abs(topdir)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "getting absolute path of %s", topdir)
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return "", "", errors.Wrapf(err, "resolving %s", topdir)
+	}
+	rel, err = filepath.Rel(filepath.FromSlash(root), abs)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "getting path of %s in git repository", topdir)
+	}
+	return hook, rel, nil
+}
+
+// installHook is the `fab pre-commit` mode of the fab command.
+// See [PreCommitArg].
+func (m *Main) installHook(ctx context.Context) error {
+	args := m.Args
+	if len(args) == 0 {
+		args = []string{DefaultPreCommitTarget}
+	}
+	if m.PrintHook {
+		_, rel, err := preCommitHookPath(ctx, m.Topdir)
+		if err != nil {
+			return err
+		}
+		fmt.Print(PreCommitHook(rel, args...))
+		return nil
+	}
+	hook, err := InstallPreCommitHook(ctx, m.Topdir, m.ForceHook, args...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Installed %s\n", hook)
+	return nil
+}
+
+func preCommitDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var ypc struct {
+		Targets  yaml.Node `yaml:"Targets"`
+		Patterns yaml.Node `yaml:"Patterns"`
+	}
+	if err := node.Decode(&ypc); err != nil {
+		return nil, errors.Wrap(err, "YAML error in PreCommit node")
+	}
+
+	if ypc.Targets.Kind != yaml.SequenceNode {
+		return nil, BadYAMLNodeKindError{Got: ypc.Targets.Kind, Want: yaml.SequenceNode}
+	}
+	targets, err := slices.Mapx(ypc.Targets.Content, func(idx int, n *yaml.Node) (Target, error) {
+		target, err := con.YAMLTarget(n, dir)
+		return target, errors.Wrapf(err, "child %d", idx)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in PreCommit.Targets node")
+	}
+
+	patterns, err := con.YAMLStringList(&ypc.Patterns, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in PreCommit.Patterns node")
+	}
+
+	return PreCommit(targets, patterns...), nil
+}
+
+func init() {
+	RegisterYAMLTarget("PreCommit", preCommitDecoder)
+	SetYAMLTagDoc("PreCommit", "Run targets on the files staged for committing in git.")
+}
@@ -0,0 +1,220 @@
+package fab
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestPreCommit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	ctx := context.Background()
+
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = tmpdir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	var (
+		staged   = filepath.Join(tmpdir, "staged.go")
+		unstaged = filepath.Join(tmpdir, "unstaged.go")
+		other    = filepath.Join(tmpdir, "other.txt")
+	)
+	for _, file := range []string{staged, unstaged} {
+		if err := os.WriteFile(file, []byte("package x\nvar  Y=2\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(other, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	git("init", "-q")
+	git("add", "staged.go", "other.txt")
+
+	got, err := stagedFiles(ctx, tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"other.txt", "staged.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got staged files %v, want %v", got, want)
+	}
+
+	ctx = WithVerbose(ctx, testing.Verbose())
+	ctx = WithHashDB(ctx, memdb(set.New[string]()))
+
+	con := NewController(tmpdir)
+	err = con.Run(ctx, PreCommit([]Target{Format(Gofmt, []string{staged, unstaged}, false)}, "*.go"))
+
+	var uerr UnformattedError
+	if !errors.As(err, &uerr) {
+		t.Fatalf("got error %v, want UnformattedError", err)
+	}
+	if !reflect.DeepEqual(uerr.Files, []string{staged}) {
+		t.Errorf("got unformatted files %v, want [%s]", uerr.Files, staged)
+	}
+
+	t.Run("no_matches", func(t *testing.T) {
+		con := NewController(tmpdir)
+		if err := con.Run(ctx, PreCommit([]Target{Format(Gofmt, []string{staged, unstaged}, false)}, "*.c")); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestPreCommitMatch(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		patterns []string
+		file     string
+		want     bool
+	}{{
+		file: "a/b.go", want: true,
+	}, {
+		patterns: []string{"*.go"}, file: "a/b.go", want: true,
+	}, {
+		patterns: []string{"a/*.go"}, file: "a/b.go", want: true,
+	}, {
+		patterns: []string{"c/*.go", "*.txt"}, file: "a/b.go", want: false,
+	}}
+
+	for i, c := range cases {
+		pc := &preCommit{Patterns: c.patterns}
+		got, err := pc.match(filepath.FromSlash(c.file))
+		if err != nil {
+			t.Fatalf("case %d: %s", i+1, err)
+		}
+		if got != c.want {
+			t.Errorf("case %d: got %v, want %v", i+1, got, c.want)
+		}
+	}
+}
+
+func TestPreCommitHook(t *testing.T) {
+	t.Parallel()
+
+	got := PreCommitHook(".", "PreCommit")
+	want := "#!/bin/sh\n# Installed by \"fab pre-commit\".\nexec fab PreCommit\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	got = PreCommitHook("sub dir", "-v", "Lint")
+	if !strings.Contains(got, "cd \"$(git rev-parse --show-toplevel)\"/'sub dir' || exit 1\n") {
+		t.Errorf("hook does not change to sub dir:\n%s", got)
+	}
+	if !strings.HasSuffix(got, "exec fab -v Lint\n") {
+		t.Errorf("hook does not run fab -v Lint:\n%s", got)
+	}
+}
+
+func TestInstallPreCommitHook(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	ctx := context.Background()
+
+	cmd := exec.CommandContext(ctx, "git", "init", "-q")
+	cmd.Dir = tmpdir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init: %s\n%s", err, out)
+	}
+
+	sub := filepath.Join(tmpdir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	hook, err := InstallPreCommitHook(ctx, sub, false, "Lint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(tmpdir, ".git", "hooks", "pre-commit"); hook != want {
+		t.Errorf("got hook %s, want %s", hook, want)
+	}
+	info, err := os.Stat(hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&0100 == 0 {
+		t.Errorf("hook is not executable (mode %s)", info.Mode())
+	}
+	got, err := os.ReadFile(hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := PreCommitHook("sub", "Lint"); string(got) != want {
+		t.Errorf("got hook:\n%s\nwant:\n%s", got, want)
+	}
+
+	if _, err := InstallPreCommitHook(ctx, sub, false, "Lint"); err == nil {
+		t.Error("got no error replacing hook without force")
+	}
+	if _, err := InstallPreCommitHook(ctx, sub, true, "Format"); err != nil {
+		t.Errorf("replacing hook with force: %s", err)
+	}
+}
+
+func TestPreCommitYAML(t *testing.T) {
+	t.Parallel()
+
+	const yml = `
+Lint: !Command
+  Shell: echo lint
+
+PreCommit: !PreCommit
+  Targets: [Lint, !Command {Shell: echo hi}]
+  Patterns: ["*.go", "*.md"]
+`
+
+	con := NewController("")
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+	target, _ := con.RegistryTarget("PreCommit")
+	if target == nil {
+		t.Fatal("PreCommit not registered")
+	}
+	pc, ok := target.(*preCommit)
+	if !ok {
+		t.Fatalf("got %T, want *preCommit", target)
+	}
+	if len(pc.Targets) != 2 {
+		t.Errorf("got %d targets, want 2", len(pc.Targets))
+	}
+	if want := []string{"*.go", "*.md"}; !reflect.DeepEqual(pc.Patterns, want) {
+		t.Errorf("got patterns %v, want %v", pc.Patterns, want)
+	}
+}
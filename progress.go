@@ -0,0 +1,439 @@
+package fab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ProgressSink receives the progress events of a [Controller].
+// Set one with [Controller.SetProgressSink]
+// to render progress in some way other than fab's default text output,
+// e.g. in a program that embeds fab.
+//
+// Progress is called concurrently from the goroutines running targets,
+// so implementations must be safe for concurrent use.
+// It should return quickly.
+type ProgressSink interface {
+	Progress(ProgressEvent)
+}
+
+// ProgressKind is the type of a [ProgressEvent].
+type ProgressKind int
+
+const (
+	// ProgressResolve is the event of a target name being resolved to a target.
+	// The event's Name and Target fields are set.
+	ProgressResolve ProgressKind = iota + 1
+
+	// ProgressStart is the event of a target starting to run.
+	// The event's Parent field is set
+	// if the target was started by another one.
+	ProgressStart
+
+	// ProgressOutput is the event of a [Command] producing output
+	// (in verbose mode only, see [WithVerbose]).
+	// The event's Stream and Data fields are set.
+	// Data is a chunk of output of arbitrary size,
+	// not necessarily a complete line.
+	ProgressOutput
+
+	// ProgressDone is the event of a target finishing.
+	// The event's Err, Cached, and Duration fields are set.
+	ProgressDone
+
+	// ProgressMessage is the event of an informational message,
+	// such as those printed with [Controller.Indentf].
+	// The event's Stream and Message fields are set.
+	ProgressMessage
+)
+
+func (k ProgressKind) String() string {
+	switch k {
+	case ProgressResolve:
+		return "resolve"
+	case ProgressStart:
+		return "start"
+	case ProgressOutput:
+		return "output"
+	case ProgressDone:
+		return "done"
+	case ProgressMessage:
+		return "message"
+	}
+	return fmt.Sprintf("ProgressKind(%d)", int(k))
+}
+
+// ProgressEvent is an event sent to a [ProgressSink].
+type ProgressEvent struct {
+	Kind ProgressKind
+	Time time.Time
+
+	// Target is the target the event is about,
+	// and Desc is its description (see [Controller.Describe]).
+	// They are unset for ProgressMessage events.
+	Target Target
+	Desc   string
+
+	// Depth is the nesting depth of the controller
+	// (see [Controller.Indentf]).
+	Depth int
+
+	// Parent is the target whose Run method started Target,
+	// for ProgressStart.
+	// It is nil for a top-level target.
+	Parent Target
+
+	// Name is the name that was resolved, for ProgressResolve.
+	Name string
+
+	// Stream is "stdout" or "stderr", for ProgressOutput and ProgressMessage.
+	Stream string
+
+	// Data is the output, for ProgressOutput.
+	Data []byte
+
+	// Message is the message, for ProgressMessage.
+	// It does not end with a newline.
+	Message string
+
+	// These fields are for ProgressDone.
+	Err      error
+	Cached   bool // The target was up to date (see [Files]).
+	Duration time.Duration
+}
+
+// SetProgressSink sets the sink for con's progress events.
+//
+// Without a sink,
+// progress is written as text to the standard output and standard error,
+// as if by [NewTextProgressSink],
+// with ProgressResolve, ProgressStart, and ProgressDone events
+// reported only in verbose mode
+// (see [WithVerbose]).
+// A sink set with this method receives all events.
+func (con *Controller) SetProgressSink(sink ProgressSink) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+	con.progress = sink
+}
+
+// ProgressSink returns the sink set with [Controller.SetProgressSink],
+// or nil if none was set.
+func (con *Controller) ProgressSink() ProgressSink {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+	return con.progress
+}
+
+// SetProgressFormat sets con's progress sink according to format,
+// which is the value of the -progress command-line flag.
+// It is "text" (or empty) for fab's default text output,
+// "json" for a sink from [NewJSONProgressSink] writing to w,
+// or "status" for a sink from [NewStatusLineProgressSink]
+// writing to w and to os.Stderr.
+// It may also be "auto",
+// which means "status" if w is a terminal (see [IsTerminal])
+// and "text" otherwise.
+func (con *Controller) SetProgressFormat(w io.Writer, format string) error {
+	if format == "auto" {
+		format = "text"
+		if f, ok := w.(*os.File); ok && IsTerminal(f) {
+			format = "status"
+		}
+	}
+
+	switch format {
+	case "", "text":
+		con.SetProgressSink(nil)
+	case "json":
+		con.SetProgressSink(NewJSONProgressSink(w))
+	case "status":
+		con.SetProgressSink(NewStatusLineProgressSink(w, os.Stderr))
+	default:
+		return fmt.Errorf("unknown progress format %s", format)
+	}
+	return nil
+}
+
+// defaultProgressSink returns the text sink used when no sink has been set.
+func (con *Controller) defaultProgressSink() ProgressSink {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+	if con.text == nil {
+		con.text = newTextProgressSink(con, os.Stdout, os.Stderr)
+	}
+	return con.text
+}
+
+// emit sends a target event to con's progress sink.
+// Without a sink set with SetProgressSink,
+// the event goes to the default text sink,
+// but only in verbose mode.
+func (con *Controller) emit(ctx context.Context, ev ProgressEvent) {
+	sink := con.ProgressSink()
+	if sink == nil {
+		if !GetVerbose(ctx) {
+			return
+		}
+		sink = con.defaultProgressSink()
+	}
+	con.send(sink, ev)
+}
+
+// message sends a ProgressMessage event to con's progress sink.
+func (con *Controller) message(stream, format string, args ...any) {
+	sink := con.ProgressSink()
+	if sink == nil {
+		sink = con.defaultProgressSink()
+	}
+	msg := con.Redact(fmt.Sprintf(format, args...))
+	if n := len(msg); n > 0 && msg[n-1] == '\n' {
+		msg = msg[:n-1]
+	}
+	con.send(sink, ProgressEvent{Kind: ProgressMessage, Stream: stream, Message: msg})
+}
+
+func (con *Controller) send(sink ProgressSink, ev ProgressEvent) {
+	ev.Time = time.Now()
+	if ev.Target != nil && ev.Desc == "" {
+		ev.Desc = con.Describe(ev.Target)
+	}
+	con.mu.Lock()
+	ev.Depth = con.depth
+	con.mu.Unlock()
+	sink.Progress(ev)
+}
+
+// progressWriter is an [io.Writer] that sends what is written to it
+// as ProgressOutput events.
+type progressWriter struct {
+	ctx    context.Context
+	con    *Controller
+	target Target
+	stream string
+}
+
+func (w *progressWriter) Write(buf []byte) (int, error) {
+	data := make([]byte, len(buf))
+	copy(data, buf)
+	w.con.emit(w.ctx, ProgressEvent{Kind: ProgressOutput, Target: w.target, Stream: w.stream, Data: data})
+	return len(buf), nil
+}
+
+// NewTextProgressSink produces a [ProgressSink] that renders events as fab's usual text output:
+// indented lines telling when targets start
+// and when [Files] targets are up to date,
+// indented output of commands,
+// and indented messages,
+// all in the style of con's [TextStyle].
+// The stdout stream goes to w and the stderr stream to errw.
+func NewTextProgressSink(con *Controller, w, errw io.Writer) ProgressSink {
+	return newTextProgressSink(con, w, errw)
+}
+
+func newTextProgressSink(con *Controller, w, errw io.Writer) *textProgressSink {
+	return &textProgressSink{
+		con:     con,
+		w:       w,
+		errw:    errw,
+		copiers: make(map[textCopierKey]io.Writer),
+		lanes:   make(map[uintptr]int),
+	}
+}
+
+type textProgressSink struct {
+	con     *Controller
+	w, errw io.Writer
+
+	mu sync.Mutex
+
+	// The indenting copier for each stream of each target producing output.
+	copiers map[textCopierKey]io.Writer
+
+	// The lane of each running target,
+	// and which lanes are occupied.
+	// See TextStyle.Lanes.
+	lanes    map[uintptr]int
+	occupied []bool
+}
+
+type textCopierKey struct {
+	addr   uintptr // see targetAddr
+	stream string
+}
+
+func (s *textProgressSink) Progress(ev ProgressEvent) {
+	switch ev.Kind {
+	case ProgressStart:
+		s.con.indentf(s.w, "%sRunning %s", s.startLane(ev.Target), ev.Desc)
+
+	case ProgressOutput:
+		s.copier(ev.Target, ev.Desc, ev.Stream).Write(ev.Data)
+
+	case ProgressDone:
+		label := s.endLane(ev.Target)
+
+		if addr, err := targetAddr(ev.Target); err == nil {
+			s.mu.Lock()
+			delete(s.copiers, textCopierKey{addr: addr, stream: "stdout"})
+			delete(s.copiers, textCopierKey{addr: addr, stream: "stderr"})
+			s.mu.Unlock()
+		}
+
+		if ev.Cached {
+			s.con.indentf(s.w, "%s%s is up to date", label, ev.Desc)
+		}
+
+	case ProgressMessage:
+		s.con.indentf(s.writer(ev.Stream), "%s", ev.Message)
+	}
+}
+
+// startLane assigns the lowest unoccupied lane to target
+// and returns its label
+// (which is empty unless TextStyle.Lanes is set).
+func (s *textProgressSink) startLane(target Target) string {
+	style := s.con.TextStyle()
+	if !style.Lanes {
+		return ""
+	}
+	addr, err := targetAddr(target)
+	if err != nil {
+		return ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lane := len(s.occupied)
+	for i, occ := range s.occupied {
+		if !occ {
+			lane = i
+			break
+		}
+	}
+	if lane == len(s.occupied) {
+		s.occupied = append(s.occupied, true)
+	} else {
+		s.occupied[lane] = true
+	}
+	s.lanes[addr] = lane
+	return style.laneLabel(lane)
+}
+
+// lane returns the lane of target,
+// or -1 if it has none.
+func (s *textProgressSink) lane(target Target) int {
+	addr, err := targetAddr(target)
+	if err != nil {
+		return -1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lane, ok := s.lanes[addr]; ok {
+		return lane
+	}
+	return -1
+}
+
+// endLane frees the lane of target
+// and returns its label.
+func (s *textProgressSink) endLane(target Target) string {
+	lane := s.lane(target)
+	if lane < 0 {
+		return ""
+	}
+	addr, _ := targetAddr(target)
+
+	s.mu.Lock()
+	delete(s.lanes, addr)
+	s.occupied[lane] = false
+	s.mu.Unlock()
+
+	return s.con.TextStyle().laneLabel(lane)
+}
+
+func (s *textProgressSink) writer(stream string) io.Writer {
+	if stream == "stderr" {
+		return s.errw
+	}
+	return s.w
+}
+
+func (s *textProgressSink) copier(target Target, desc, stream string) io.Writer {
+	lane := s.lane(target)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	addr, _ := targetAddr(target)
+	key := textCopierKey{addr: addr, stream: stream}
+	c, ok := s.copiers[key]
+	if !ok {
+		style := s.con.TextStyle()
+		prefix := style.OutputPrefix + style.laneLabel(lane)
+		if style.TargetPrefix {
+			prefix += "[" + desc + "] "
+		}
+		c = s.con.IndentingCopier(s.writer(stream), prefix)
+		s.copiers[key] = c
+	}
+	return c
+}
+
+// NewJSONProgressSink produces a [ProgressSink] that writes each event to w
+// as a JSON object on a line by itself.
+// The object's "event" field is the event's [ProgressKind],
+// e.g. "start".
+// Errors writing to w are ignored.
+func NewJSONProgressSink(w io.Writer) ProgressSink {
+	return &jsonProgressSink{enc: json.NewEncoder(w)}
+}
+
+type jsonProgressSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+type jsonProgressEvent struct {
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	Target   string    `json:"target,omitempty"`
+	Depth    int       `json:"depth"`
+	Name     string    `json:"name,omitempty"`
+	Stream   string    `json:"stream,omitempty"`
+	Data     string    `json:"data,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Cached   bool      `json:"cached,omitempty"`
+	Duration float64   `json:"duration,omitempty"` // seconds
+}
+
+func (s *jsonProgressSink) Progress(ev ProgressEvent) {
+	j := jsonProgressEvent{
+		Event:    ev.Kind.String(),
+		Time:     ev.Time,
+		Target:   ev.Desc,
+		Depth:    ev.Depth,
+		Name:     ev.Name,
+		Stream:   ev.Stream,
+		Data:     string(ev.Data),
+		Message:  ev.Message,
+		Cached:   ev.Cached,
+		Duration: ev.Duration.Seconds(),
+	}
+	if ev.Err != nil {
+		j.Error = ev.Err.Error()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.enc.Encode(j)
+}
@@ -0,0 +1,175 @@
+package fab
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []ProgressEvent
+}
+
+func (s *recordingSink) Progress(ev ProgressEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, ev)
+}
+
+func (s *recordingSink) kinds(target Target) []ProgressKind {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []ProgressKind
+	for _, ev := range s.events {
+		if ev.Target == target {
+			result = append(result, ev.Kind)
+		}
+	}
+	return result
+}
+
+func TestProgressSink(t *testing.T) {
+	t.Parallel()
+
+	var (
+		c   = &Command{Shell: "echo hello"}
+		ft  = Files(c, nil, nil)
+		ctx = context.Background()
+	)
+	ctx = WithVerbose(ctx, true)
+	ctx = WithHashDB(ctx, memdb(set.New[string]()))
+
+	sink := new(recordingSink)
+	con := NewController("")
+	con.SetProgressSink(sink)
+	if err := con.Run(ctx, ft); err != nil {
+		t.Fatal(err)
+	}
+
+	got := sink.kinds(c)
+	if len(got) < 3 || got[0] != ProgressStart || got[len(got)-1] != ProgressDone {
+		t.Fatalf("got events %v for the command, want start, output..., done", got)
+	}
+	var output strings.Builder
+	for _, ev := range sink.events {
+		if ev.Kind == ProgressOutput {
+			if ev.Target != c || ev.Stream != "stdout" {
+				t.Errorf("got output event for %s on %s, want command on stdout", ev.Desc, ev.Stream)
+			}
+			output.Write(ev.Data)
+		}
+	}
+	if output.String() != "hello\n" {
+		t.Errorf("got output %q, want %q", output.String(), "hello\n")
+	}
+
+	var sawMessage bool
+	for _, ev := range sink.events {
+		if ev.Kind == ProgressMessage && strings.HasPrefix(ev.Message, "  Running command ") {
+			sawMessage = true
+		}
+	}
+	if !sawMessage {
+		t.Error("no message event for running the command")
+	}
+
+	// A new controller runs the target again,
+	// finding it up to date.
+	sink = new(recordingSink)
+	con = NewController("")
+	con.SetProgressSink(sink)
+	if err := con.Run(ctx, ft); err != nil {
+		t.Fatal(err)
+	}
+	if got := sink.kinds(c); len(got) != 0 {
+		t.Errorf("got events %v for the command in the second run, want none", got)
+	}
+	last := sink.events[len(sink.events)-1]
+	if last.Kind != ProgressDone || last.Target != ft || !last.Cached {
+		t.Errorf("got last event %+v, want done event for cached Files target", last)
+	}
+}
+
+func TestProgressResolve(t *testing.T) {
+	t.Parallel()
+
+	const yml = `
+A: !Command
+  Shell: "true"
+
+B: !All
+  - A
+`
+
+	con := NewController("")
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+	sink := new(recordingSink)
+	con.SetProgressSink(sink)
+
+	b, _ := con.RegistryTarget("B")
+	if err := con.Run(context.Background(), b); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ev := range sink.events {
+		if ev.Kind == ProgressResolve {
+			if ev.Name != "A" || ev.Desc != "A" {
+				t.Errorf("got resolve event for %s to %s, want A to A", ev.Name, ev.Desc)
+			}
+			return
+		}
+	}
+	t.Error("no resolve event")
+}
+
+func TestJSONProgressSink(t *testing.T) {
+	t.Parallel()
+
+	var (
+		buf strings.Builder
+		con = NewController("")
+		ctx = WithVerbose(context.Background(), true)
+	)
+	if err := con.SetProgressFormat(&buf, "json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := con.Run(ctx, &Command{Shell: "echo hello; exit 1"}); err == nil {
+		t.Fatal("got no error from failing command")
+	}
+
+	var events []string
+	dec := json.NewDecoder(strings.NewReader(buf.String()))
+	for dec.More() {
+		var ev jsonProgressEvent
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev.Event)
+		switch ev.Event {
+		case "output":
+			if ev.Data != "hello\n" {
+				t.Errorf("got output %q, want %q", ev.Data, "hello\n")
+			}
+		case "done":
+			if ev.Error == "" {
+				t.Error("done event has no error")
+			}
+		}
+	}
+	want := []string{"start", "message", "output", "done"}
+	if strings.Join(events, " ") != strings.Join(want, " ") {
+		t.Errorf("got events %v, want %v", events, want)
+	}
+
+	if err := con.SetProgressFormat(&buf, "xml"); err == nil {
+		t.Error("got no error for unknown progress format")
+	}
+}
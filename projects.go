@@ -0,0 +1,189 @@
+package fab
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultTargetName is the name of a project's default target.
+// See [Controller.ParseArgs].
+const DefaultTargetName = "Default"
+
+// readProjectsDecl handles the _projects declaration in a top-level fab.yaml file.
+// It is a mapping from subdirectories to project names.
+// The fab.yaml file in each project's subdirectory,
+// if there is one,
+// is read immediately.
+//
+// Example:
+//
+//	_projects:
+//	  services/server: server
+//	  web: web
+func (con *Controller) readProjectsDecl(node *yaml.Node, dir string) error {
+	if dir != "" {
+		return fmt.Errorf("_projects declaration is allowed only in the top-level YAML file")
+	}
+	if node.Kind != yaml.MappingNode {
+		return BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var decl map[string]string
+	if err := node.Decode(&decl); err != nil {
+		return errors.Wrap(err, "decoding _projects declaration")
+	}
+
+	for subdir, name := range decl {
+		if name == "" || strings.ContainsAny(name, ":/") {
+			return fmt.Errorf("bad project name %q", name)
+		}
+		subdir = filepath.Clean(subdir)
+		if subdir == "." || filepath.IsAbs(subdir) || subdir == ".." || strings.HasPrefix(subdir, "../") {
+			return fmt.Errorf("bad project directory %q", subdir)
+		}
+
+		con.mu.Lock()
+		if con.projects == nil {
+			con.projects = make(map[string]string)
+		}
+		_, dup := con.projects[name]
+		con.projects[name] = subdir
+		con.mu.Unlock()
+
+		if dup {
+			return fmt.Errorf("duplicate project name %s", name)
+		}
+	}
+
+	for subdir, name := range decl {
+		err := con.ReadYAMLFile(filepath.Clean(subdir))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return errors.Wrapf(err, "reading YAML for project %s", name)
+		}
+	}
+
+	return nil
+}
+
+// projectDir returns the directory of the project with the given name,
+// and a boolean telling whether there is such a project.
+func (con *Controller) projectDir(name string) (string, bool) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	dir, ok := con.projects[name]
+	return dir, ok
+}
+
+// lookupArg finds the target named by a command-line argument.
+// It is either an alias for another name (see [Controller.SetAlias]),
+// the name of a target in the registry,
+// a subdirectory-wide name like */Build (see [Controller.Foreach]),
+// a file matching the output of a [Pattern],
+// or a project-relative name like server:build
+// (see [Controller.ParseArgs]).
+func (con *Controller) lookupArg(arg string) (Target, error) {
+	if name, ok := con.alias(arg); ok {
+		arg = name
+	}
+	if target, _ := con.RegistryTarget(arg); target != nil {
+		return target, nil
+	}
+	if name, ok := strings.CutPrefix(arg, "*/"); ok {
+		return con.Foreach(name)
+	}
+	target, err := findInPatterns(con.JoinPath(arg))
+	if err != nil || target != nil {
+		return target, err
+	}
+
+	project, name, found := strings.Cut(arg, ":")
+	dir, ok := con.projectDir(project)
+	if !ok {
+		return nil, nil
+	}
+	if !found || name == "" {
+		name = DefaultTargetName
+	}
+
+	if target, _ := con.RegistryTarget(filepath.Join(dir, name)); target != nil {
+		return target, nil
+	}
+
+	// Try again with an initial capital: server:build -> server/Build.
+	r, size := utf8.DecodeRuneInString(name)
+	capitalized := string(unicode.ToUpper(r)) + name[size:]
+	target, _ = con.RegistryTarget(filepath.Join(dir, capitalized))
+	return target, nil
+}
+
+// listProjectTargets is the implementation of [Controller.ListTargets]
+// when there are projects.
+// Targets outside any project are listed first,
+// followed by the targets in each project,
+// using project-relative names.
+func (con *Controller) listProjectTargets(w io.Writer) {
+	con.mu.Lock()
+	var (
+		projectNames []string
+		dirs         = make(map[string]string)
+	)
+	for name, dir := range con.projects {
+		projectNames = append(projectNames, name)
+		dirs[name] = dir
+	}
+	con.mu.Unlock()
+
+	sort.Strings(projectNames)
+
+	// Find the project of each target.
+	// A target belongs to the project with the longest directory containing it.
+	groups := make(map[string][]string) // project name -> target names
+	for _, tname := range con.listedNames() {
+		var (
+			best    string
+			bestLen int
+		)
+		for _, pname := range projectNames {
+			dir := dirs[pname]
+			if strings.HasPrefix(tname, dir+"/") && len(dir) > bestLen {
+				best, bestLen = pname, len(dir)
+			}
+		}
+		groups[best] = append(groups[best], tname)
+	}
+
+	list := func(names []string, dir, prefix string) {
+		for _, tname := range names {
+			display := tname
+			if prefix != "" {
+				display = prefix + ":" + strings.TrimPrefix(tname, dir+"/")
+			}
+			fmt.Fprintln(w, display)
+			if _, d := con.RegistryTarget(tname); d != "" {
+				d = bolRegex.ReplaceAllString(d, "    ")
+				fmt.Fprintln(w, d)
+			}
+			con.writeParams(w, tname)
+		}
+	}
+
+	list(groups[""], "", "")
+
+	for _, pname := range projectNames {
+		if len(groups[pname]) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n[%s] %s\n", pname, dirs[pname])
+		list(groups[pname], dirs[pname], pname)
+	}
+}
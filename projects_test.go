@@ -0,0 +1,90 @@
+package fab
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProjects(t *testing.T) {
+	t.Parallel()
+
+	con := NewController("_testdata/projects")
+	if err := con.ReadYAMLFile(""); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		serverBuild, _ = con.RegistryTarget("services/server/Build")
+		webBuild, _    = con.RegistryTarget("web/Build")
+		serverDflt, _  = con.RegistryTarget("services/server/Default")
+	)
+	if serverBuild == nil || webBuild == nil || serverDflt == nil {
+		t.Fatal("project targets not registered")
+	}
+
+	cases := []struct {
+		arg  string
+		want Target
+	}{
+		{arg: "services/server/Build", want: serverBuild},
+		{arg: "server:Build", want: serverBuild},
+		{arg: "server:build", want: serverBuild},
+		{arg: "web:build", want: webBuild},
+		{arg: "server", want: serverDflt},
+		{arg: "server:", want: serverDflt},
+		{arg: "web"},
+		{arg: "web:nosuch"},
+		{arg: "nosuch:build"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(strings.ReplaceAll(tc.arg, "/", "_"), func(t *testing.T) {
+			targets, err := con.ParseArgs([]string{tc.arg})
+			if tc.want == nil {
+				if err == nil {
+					t.Errorf("got %v, want error", targets)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(targets) != 1 || targets[0] != tc.want {
+				t.Errorf("got %v, want [%v]", targets, tc.want)
+			}
+		})
+	}
+
+	t.Run("list", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		con.ListTargets(buf)
+
+		const want = `Everything
+    Everything builds everything.
+
+[server] services/server
+server:Build
+    Build builds the server.
+server:Default
+
+[web] web
+web:Build
+    Build builds the web frontend.
+`
+		if got := buf.String(); got != want {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	})
+}
+
+func TestProjectsNotTopLevel(t *testing.T) {
+	t.Parallel()
+
+	con := NewController("")
+	err := con.ReadYAML(strings.NewReader("_dir: foo\n_projects:\n  bar: bar\n"), "foo")
+	if err == nil {
+		t.Error("got no error but wanted one")
+	}
+}
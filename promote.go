@@ -0,0 +1,210 @@
+package fab
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Promote is a Target that copies an artifact
+// from one [ArtifactStore] to another,
+// e.g. from a staging store to a production store,
+// along with its [Provenance] record.
+// This supports "build once, deploy many" pipelines:
+// an artifact is built once,
+// and later stages promote that very artifact
+// rather than rebuilding it.
+//
+// The artifact is identified either by Key,
+// or by Target,
+// which must be a [Files] target:
+// the key is computed from that target and the current contents of its input files,
+// which is how the artifact was stored when the target ran
+// (see [WithArtifactStore]).
+//
+// Promotion fails unless the artifact's provenance record
+// shows that it was produced from the expected inputs,
+// i.e. that its input hash matches the key.
+//
+// In dry-run mode (see [WithDryRun]),
+// the artifact is checked but not copied.
+//
+// A Promote target may be specified in YAML using the !Promote tag,
+// which introduces a mapping whose fields are:
+//
+//   - From: the directory of the source [DirArtifactStore]
+//   - To: the directory of the destination DirArtifactStore
+//   - Target: the Files target identifying the artifact
+//   - Key: the hex-encoded key of the artifact, instead of Target
+//
+// From and To are either absolute or relative to the directory containing the YAML file.
+type Promote struct {
+	From ArtifactStore `json:"from"`
+	To   ArtifactStore `json:"to"`
+
+	// Target is a Files target identifying the artifact to promote.
+	// It is not run.
+	Target Target `json:"target,omitempty"`
+
+	// Key is the hex-encoded key of the artifact to promote.
+	// It is used instead of Target if it is non-empty.
+	Key string `json:"key,omitempty"`
+}
+
+var _ Target = &Promote{}
+
+// Run implements Target.Run.
+func (p *Promote) Run(ctx context.Context, con *Controller) error {
+	if p.From == nil || p.To == nil {
+		return fmt.Errorf("promote requires both a source and a destination store")
+	}
+
+	key, err := p.key(ctx, con)
+	if err != nil {
+		return err
+	}
+
+	rc, err := p.From.Get(ctx, key)
+	if err != nil {
+		return errors.Wrapf(err, "getting artifact %x", key)
+	}
+	if rc == nil {
+		return fmt.Errorf("no artifact %x in source store", key)
+	}
+	defer rc.Close()
+
+	// Spool the artifact to a temp file
+	// so it can be checked before it is copied.
+	tmp, err := os.CreateTemp("", "fab-promote")
+	if err != nil {
+		return errors.Wrap(err, "creating temp file")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err = io.Copy(tmp, rc); err != nil {
+		return errors.Wrapf(err, "reading artifact %x", key)
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "rewinding temp file")
+	}
+
+	prov, err := ReadProvenance(tmp)
+	if err != nil {
+		return errors.Wrapf(err, "reading provenance of artifact %x", key)
+	}
+	if prov == nil {
+		return fmt.Errorf("artifact %x has no provenance record", key)
+	}
+	if want := hex.EncodeToString(key); prov.InputHash != want {
+		return ProvenanceMismatchError{Want: want, Got: prov.InputHash}
+	}
+
+	if GetDryRun(ctx) {
+		if GetVerbose(ctx) {
+			con.Indentf("  Would promote artifact %x (%s)", key, prov.Target)
+		}
+		return nil
+	}
+
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "rewinding temp file")
+	}
+	if err = p.To.Put(ctx, key, tmp); err != nil {
+		return errors.Wrapf(err, "storing artifact %x", key)
+	}
+
+	if GetVerbose(ctx) {
+		con.Indentf("  Promoted artifact %x (%s)", key, prov.Target)
+	}
+
+	return nil
+}
+
+func (p *Promote) key(ctx context.Context, con *Controller) ([]byte, error) {
+	if p.Key != "" {
+		key, err := hex.DecodeString(p.Key)
+		return key, errors.Wrapf(err, "decoding key %s", p.Key)
+	}
+
+	target := p.Target
+	if d, ok := target.(*deferredResolutionTarget); ok {
+		var err error
+		if target, err = d.resolve(con); err != nil {
+			return nil, err
+		}
+	}
+	ft, ok := target.(*files)
+	if !ok {
+		return nil, fmt.Errorf("promote requires a key or a Files target, got %T", p.Target)
+	}
+	return ft.artifactKey(ctx, con)
+}
+
+// Desc implements Target.Desc.
+func (*Promote) Desc() string {
+	return "Promote"
+}
+
+// ProvenanceMismatchError is the error returned by [Promote]
+// when an artifact's provenance record does not match the expected inputs.
+type ProvenanceMismatchError struct {
+	Want, Got string // hex-encoded input hashes
+}
+
+func (e ProvenanceMismatchError) Error() string {
+	return fmt.Sprintf("artifact provenance has input hash %s, want %s", e.Got, e.Want)
+}
+
+func promoteDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var ypromote struct {
+		From   string    `yaml:"From"`
+		To     string    `yaml:"To"`
+		Target yaml.Node `yaml:"Target"`
+		Key    string    `yaml:"Key"`
+	}
+	if err := node.Decode(&ypromote); err != nil {
+		return nil, errors.Wrap(err, "YAML error in Promote node")
+	}
+
+	if ypromote.From == "" || ypromote.To == "" {
+		return nil, fmt.Errorf("Promote node requires From and To")
+	}
+
+	result := &Promote{
+		From: DirArtifactStore{Dir: con.JoinPath(dir, ypromote.From)},
+		To:   DirArtifactStore{Dir: con.JoinPath(dir, ypromote.To)},
+		Key:  ypromote.Key,
+	}
+
+	switch {
+	case ypromote.Key != "" && ypromote.Target.Kind != 0:
+		return nil, fmt.Errorf("Promote node may not have both Key and Target")
+
+	case ypromote.Target.Kind != 0:
+		target, err := con.YAMLTarget(&ypromote.Target, dir)
+		if err != nil {
+			return nil, errors.Wrap(err, "YAML error in Promote.Target node")
+		}
+		result.Target = target
+
+	case ypromote.Key == "":
+		return nil, fmt.Errorf("Promote node requires Key or Target")
+	}
+
+	return result, nil
+}
+
+func init() {
+	RegisterYAMLTarget("Promote", promoteDecoder)
+	SetYAMLTagDoc("Promote", "Copy an artifact and its provenance record from one artifact store to another.")
+}
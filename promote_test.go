@@ -0,0 +1,110 @@
+package fab
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestPromote(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		inpath  = filepath.Join(tmpdir, "in")
+		outpath = filepath.Join(tmpdir, "out")
+		staging = DirArtifactStore{Dir: filepath.Join(tmpdir, "staging")}
+		prod    = DirArtifactStore{Dir: filepath.Join(tmpdir, "prod")}
+	)
+	if err = os.WriteFile(inpath, []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	build := Files(Shellf("cp %s %s", inpath, outpath), []string{inpath}, []string{outpath})
+
+	ctx := context.Background()
+	ctx = WithVerbose(ctx, testing.Verbose())
+	ctx = WithHashDB(ctx, memdb(set.New[string]()))
+	ctx = WithArtifactStore(ctx, staging)
+
+	con := NewController(tmpdir)
+	if err = con.Run(ctx, build); err != nil {
+		t.Fatal(err)
+	}
+
+	promote := &Promote{From: staging, To: prod, Target: build}
+	if err = con.Run(ctx, promote); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := build.(*files).artifactKey(ctx, con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := prod.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc == nil {
+		t.Fatal("artifact not promoted")
+	}
+	prov, err := ReadProvenance(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prov == nil {
+		t.Fatal("no provenance record in promoted artifact")
+	}
+	if prov.InputHash != hex.EncodeToString(key) {
+		t.Errorf("got input hash %s, want %x", prov.InputHash, key)
+	}
+	if len(prov.Outputs) != 1 || prov.Outputs[0] != "out" {
+		t.Errorf("got outputs %v, want [out]", prov.Outputs)
+	}
+
+	// New inputs, not yet built: nothing to promote.
+	if err = os.WriteFile(inpath, []byte("bar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = NewController(tmpdir).Run(ctx, promote); err == nil {
+		t.Error("got no error promoting an unbuilt artifact")
+	}
+
+	// An artifact whose provenance does not match its key.
+	badKey := []byte("bad key")
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	if err = writeProvenance(tw, Provenance{InputHash: "0123", Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = staging.Put(ctx, badKey, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	err = NewController(tmpdir).Run(ctx, &Promote{From: staging, To: prod, Key: hex.EncodeToString(badKey)})
+	var mismatch ProvenanceMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("got error %v, want ProvenanceMismatchError", err)
+	}
+	if rc, _ := prod.Get(ctx, badKey); rc != nil {
+		rc.Close()
+		t.Error("mismatched artifact was promoted")
+	}
+}
@@ -37,6 +37,8 @@ import (
 //   - Opts: the list of "other options" (see above) to pass to the protoc command line
 //   - Autoclean: a boolean indicating whether the files listed in Outputs should be added to the "autoclean registry."
 //     See [fab.Autoclean] for more about this feature.
+//   - Toolchain: pinned versions of protoc and its plugins to use instead of those in the PATH.
+//     See [Toolchain].
 func Proto(inputs, outputs, includes, otherOpts []string, filesOpts ...fab.FilesOpt) (fab.Target, error) {
 	alldeps := set.New[string](inputs...)
 	for _, inp := range inputs {
@@ -63,6 +65,7 @@ func protoDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target,
 		Includes  yaml.Node `yaml:"Includes"`
 		Opts      []string  `yaml:"Opts"`
 		Autoclean bool      `yaml:"Autoclean"`
+		Toolchain yaml.Node `yaml:"Toolchain"`
 	}
 	if err := node.Decode(&p); err != nil {
 		return nil, errors.Wrap(err, "YAML error decoding proto.Proto node")
@@ -83,11 +86,20 @@ func protoDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target,
 		return nil, errors.Wrap(err, "parsing protoc include list")
 	}
 
+	if p.Toolchain.Kind != 0 {
+		tc, err := yamlToolchain(&p.Toolchain)
+		if err != nil {
+			return nil, errors.Wrap(err, "YAML error in proto.Proto node")
+		}
+		return tc.Proto(inputs, outputs, includes, p.Opts, fab.Autoclean(p.Autoclean))
+	}
+
 	return Proto(inputs, outputs, includes, p.Opts, fab.Autoclean(p.Autoclean))
 }
 
 func init() {
 	fab.RegisterYAMLTarget("proto.Proto", protoDecoder)
+	fab.SetYAMLTagDoc("proto.Proto", "Compile protocol-buffer files with protoc.")
 }
 
 // Deps reads a protocol-buffer file and returns its list of dependencies.
@@ -162,4 +174,5 @@ func protodepsDecoder(con *fab.Controller, node *yaml.Node, dir string) ([]strin
 
 func init() {
 	fab.RegisterYAMLStringList("proto.Deps", protodepsDecoder)
+	fab.SetYAMLTagDoc("proto.Deps", "List a protocol-buffer file and the files it imports.")
 }
@@ -0,0 +1,274 @@
+package proto
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+	"github.com/bobg/go-generics/v2/slices"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bobg/fab"
+)
+
+// Tool is a specific release of protoc or of a protoc plugin,
+// downloaded as needed and kept in the fab directory
+// (see [fab.GetFabdir]).
+// See [Toolchain].
+type Tool struct {
+	// Name is the name of the program,
+	// e.g. protoc or protoc-gen-go.
+	// For the Protoc field of a Toolchain,
+	// it defaults to protoc.
+	Name string `json:"name,omitempty" yaml:"Name"`
+
+	// URL is where to download the tool.
+	// It is a zip file,
+	// a tar file (optionally gzipped),
+	// or the executable itself,
+	// according to its suffix.
+	URL string `json:"url" yaml:"URL"`
+
+	// SHA256 is the expected hex-encoded SHA-256 hash of the download.
+	// It is required.
+	SHA256 string `json:"sha256" yaml:"SHA256"`
+
+	// Path is the path of the executable within the downloaded archive,
+	// with slashes as separators.
+	// It defaults to bin/NAME if that exists,
+	// and otherwise to NAME
+	// (with .exe appended on Windows).
+	Path string `json:"path,omitempty" yaml:"Path"`
+}
+
+// Toolchain is a pinned set of tools for compiling protocol-buffer files:
+// protoc itself and any plugins it needs
+// (such as protoc-gen-go and protoc-gen-go-grpc).
+// Compiling with a Toolchain,
+// via [Toolchain.Proto],
+// means builds do not depend on whatever versions of those programs are in the PATH.
+//
+// Each tool is downloaded,
+// verified against its SHA256 hash,
+// and unpacked
+// into a subdirectory of the fab directory named for that hash,
+// the first time it is needed.
+//
+// A Toolchain may be specified in YAML
+// as the Toolchain field of a !proto.Proto target.
+// It is a mapping with fields Protoc,
+// a mapping whose fields are those of [Tool],
+// and Plugins,
+// a sequence of such mappings.
+//
+// Example:
+//
+//	Protos: !proto.Proto
+//	  Inputs: [api/api.proto]
+//	  Outputs: [api/api.pb.go]
+//	  Includes: [api]
+//	  Opts: [--go_out=api, --go_opt=paths=source_relative]
+//	  Toolchain:
+//	    Protoc:
+//	      URL: https://github.com/protocolbuffers/protobuf/releases/download/v25.1/protoc-25.1-linux-x86_64.zip
+//	      SHA256: ed8fca87a11c888fed329d6a59c34c7d436165f662a2c875246ddb1ac2b6dd50
+//	    Plugins:
+//	      - Name: protoc-gen-go
+//	        URL: https://github.com/protocolbuffers/protobuf-go/releases/download/v1.31.0/protoc-gen-go.v1.31.0.linux.amd64.tar.gz
+//	        SHA256: ...
+type Toolchain struct {
+	Protoc  Tool   `json:"protoc" yaml:"Protoc"`
+	Plugins []Tool `json:"plugins,omitempty" yaml:"Plugins"`
+}
+
+// Proto is like the package-level [Proto] function,
+// but runs the protoc from tc,
+// with the plugins from tc,
+// instead of the ones found in the PATH.
+// The include directory that comes with protoc,
+// containing the well-known types,
+// is added after the given includes.
+//
+// Since the URLs and hashes of the tools go into the hash of the resulting [fab.Files] target,
+// changing the pinned version of a tool causes the target to run again.
+func (tc Toolchain) Proto(inputs, outputs, includes, otherOpts []string, filesOpts ...fab.FilesOpt) (fab.Target, error) {
+	if tc.Protoc.Name == "" {
+		tc.Protoc.Name = "protoc"
+	}
+	for _, tool := range append([]Tool{tc.Protoc}, tc.Plugins...) {
+		if tool.Name == "" {
+			return nil, fmt.Errorf("tool with no name (URL %s)", tool.URL)
+		}
+		if tool.URL == "" || tool.SHA256 == "" {
+			return nil, fmt.Errorf("tool %s needs both URL and SHA256", tool.Name)
+		}
+	}
+
+	alldeps := set.New[string](inputs...)
+	for _, inp := range inputs {
+		d, err := Deps(inp, includes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "computing dependencies for %s", inp)
+		}
+		alldeps.Add(d...)
+	}
+
+	alldepsSlice := alldeps.Slice()
+	sort.Strings(alldepsSlice)
+
+	p := &pinnedProtoc{
+		Toolchain: tc,
+		Includes:  includes,
+		Opts:      otherOpts,
+		Inputs:    inputs,
+	}
+	return fab.Files(p, alldepsSlice, outputs, filesOpts...), nil
+}
+
+// pinnedProtoc is the subtarget of a [Toolchain.Proto] target.
+type pinnedProtoc struct {
+	Toolchain Toolchain `json:"toolchain"`
+	Includes  []string  `json:"includes,omitempty"`
+	Opts      []string  `json:"opts,omitempty"`
+	Inputs    []string  `json:"inputs"`
+}
+
+var _ fab.Target = &pinnedProtoc{}
+
+// Run implements fab.Target.Run.
+func (p *pinnedProtoc) Run(ctx context.Context, con *fab.Controller) error {
+	if fab.GetDryRun(ctx) {
+		if fab.GetVerbose(ctx) {
+			con.Indentf("  Would run protoc from %s", p.Toolchain.Protoc.URL)
+		}
+		return nil
+	}
+
+	protoc, protocDir, err := p.Toolchain.Protoc.install(ctx, con)
+	if err != nil {
+		return err
+	}
+
+	args := slices.Map(p.Includes, func(inc string) string { return "-I" + inc })
+	if include := filepath.Join(protocDir, "include"); isDir(include) {
+		args = append(args, "-I"+include)
+	}
+	for _, plugin := range p.Toolchain.Plugins {
+		exe, _, err := plugin.install(ctx, con)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--plugin="+plugin.Name+"="+exe)
+	}
+	args = append(args, p.Opts...)
+	args = append(args, p.Inputs...)
+
+	return con.Run(ctx, &fab.Command{Cmd: protoc, Args: args})
+}
+
+// Desc implements fab.Target.Desc.
+func (*pinnedProtoc) Desc() string {
+	return "proto.Proto"
+}
+
+// installMu serializes the installation of tools,
+// which may be shared by concurrently running targets.
+var installMu sync.Mutex
+
+// install makes sure the tool is present in the fab directory,
+// downloading and unpacking it if necessary.
+// It returns the path of the executable
+// and the directory into which the tool was unpacked.
+func (t Tool) install(ctx context.Context, con *fab.Controller) (exe, dir string, err error) {
+	fabdir := fab.GetFabdir(ctx)
+	if fabdir == "" {
+		return "", "", fmt.Errorf("no fab directory for installing %s (see fab.WithFabdir)", t.Name)
+	}
+	var (
+		tooldir = filepath.Join(fabdir, "tools", t.SHA256)
+		xdir    = filepath.Join(tooldir, "x")
+	)
+
+	installMu.Lock()
+	defer installMu.Unlock()
+
+	if exe, ok := t.findExe(xdir); ok {
+		return exe, xdir, nil
+	}
+
+	var (
+		base    = path.Base(t.URL)
+		extract func(archive, dir string, opts ...fab.FilesOpt) fab.Target
+	)
+	switch {
+	case strings.HasSuffix(base, ".zip"):
+		extract = fab.Unzip
+	case strings.HasSuffix(base, ".tar"), strings.HasSuffix(base, ".tar.gz"), strings.HasSuffix(base, ".tgz"):
+		extract = fab.Untar
+	}
+
+	if extract == nil {
+		// The download is the executable itself.
+		exe := filepath.Join(xdir, t.exeName())
+		if err := con.Run(ctx, fab.Download(t.URL, exe, t.SHA256)); err != nil {
+			return "", "", errors.Wrapf(err, "downloading %s", t.Name)
+		}
+		return exe, xdir, errors.Wrapf(os.Chmod(exe, 0755), "making %s executable", exe)
+	}
+
+	archive := filepath.Join(tooldir, base)
+	if err := con.Run(ctx, fab.Download(t.URL, archive, t.SHA256)); err != nil {
+		return "", "", errors.Wrapf(err, "downloading %s", t.Name)
+	}
+	if err := con.Run(ctx, extract(archive, xdir)); err != nil {
+		return "", "", errors.Wrapf(err, "unpacking %s", t.Name)
+	}
+	exe, ok := t.findExe(xdir)
+	if !ok {
+		return "", "", fmt.Errorf("%s not found in %s", t.Name, t.URL)
+	}
+	return exe, xdir, nil
+}
+
+// findExe returns the path of the tool's executable in dir,
+// if it is there.
+func (t Tool) findExe(dir string) (string, bool) {
+	candidates := []string{path.Join("bin", t.exeName()), t.exeName()}
+	if t.Path != "" {
+		candidates = []string{t.Path}
+	}
+	for _, c := range candidates {
+		exe := filepath.Join(dir, filepath.FromSlash(c))
+		if info, err := os.Stat(exe); err == nil && info.Mode().IsRegular() {
+			return exe, true
+		}
+	}
+	return "", false
+}
+
+func (t Tool) exeName() string {
+	if runtime.GOOS == "windows" {
+		return t.Name + ".exe"
+	}
+	return t.Name
+}
+
+func isDir(dir string) bool {
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
+// yamlToolchain decodes the Toolchain field of a !proto.Proto node.
+func yamlToolchain(node *yaml.Node) (Toolchain, error) {
+	var tc Toolchain
+	err := node.Decode(&tc)
+	return tc, errors.Wrap(err, "decoding Toolchain")
+}
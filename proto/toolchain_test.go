@@ -0,0 +1,166 @@
+package proto
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bobg/fab"
+)
+
+func TestToolchain(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test tools are shell scripts")
+	}
+
+	var (
+		tmpdir   = t.TempDir()
+		fabdir   = filepath.Join(tmpdir, "fab")
+		argsfile = filepath.Join(tmpdir, "args")
+		outfile  = filepath.Join(tmpdir, "out")
+	)
+	t.Setenv("FAB_TEST_PROTOC_ARGS", argsfile)
+
+	protocTGZ := tgz(t, map[string]string{
+		"bin/protoc":                      "#!/bin/sh\necho \"$@\" > \"$FAB_TEST_PROTOC_ARGS\"\ntouch " + outfile + "\n",
+		"include/google/protobuf/x.proto": "syntax = \"proto3\";\n",
+	})
+	plugin := []byte("#!/bin/sh\n")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/protoc.tar.gz":
+			w.Write(protocTGZ)
+		case "/protoc-gen-go":
+			w.Write(plugin)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+
+	tc := Toolchain{
+		Protoc: Tool{URL: srv.URL + "/protoc.tar.gz", SHA256: sha256hex(protocTGZ)},
+		Plugins: []Tool{{
+			Name:   "protoc-gen-go",
+			URL:    srv.URL + "/protoc-gen-go",
+			SHA256: sha256hex(plugin),
+		}},
+	}
+
+	p, err := tc.Proto([]string{"testdata/foo.proto"}, []string{outfile}, []string{"testdata"}, []string{"--go_out=" + tmpdir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := fab.WithFabdir(context.Background(), fabdir)
+	if err := fab.NewController("").Run(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(argsfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		protocDir = filepath.Join(fabdir, "tools", tc.Protoc.SHA256, "x")
+		pluginExe = filepath.Join(fabdir, "tools", tc.Plugins[0].SHA256, "x", "protoc-gen-go")
+		want      = strings.Join([]string{
+			"-Itestdata",
+			"-I" + filepath.Join(protocDir, "include"),
+			"--plugin=protoc-gen-go=" + pluginExe,
+			"--go_out=" + tmpdir,
+			"testdata/foo.proto",
+		}, " ")
+	)
+	if strings.TrimSpace(string(got)) != want {
+		t.Errorf("got args %s, want %s", got, want)
+	}
+
+	// A second toolchain with a bad hash fails to install.
+	tc.Protoc.SHA256 = sha256hex([]byte("something else"))
+	p, err = tc.Proto([]string{"testdata/foo.proto"}, []string{outfile}, []string{"testdata"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fab.NewController("").Run(ctx, p)
+	var cerr fab.ChecksumError
+	if !errors.As(err, &cerr) {
+		t.Errorf("got error %v, want a checksum error", err)
+	}
+}
+
+func TestToolchainYAML(t *testing.T) {
+	const doc = `
+Protoc:
+  URL: https://example.com/protoc.zip
+  SHA256: abc
+Plugins:
+  - Name: protoc-gen-go
+    URL: https://example.com/protoc-gen-go.tar.gz
+    SHA256: def
+    Path: protoc-gen-go
+`
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(doc), &node); err != nil {
+		t.Fatal(err)
+	}
+	tc, err := yamlToolchain(node.Content[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.Protoc.URL != "https://example.com/protoc.zip" || tc.Protoc.SHA256 != "abc" {
+		t.Errorf("got protoc %+v", tc.Protoc)
+	}
+	if len(tc.Plugins) != 1 || tc.Plugins[0].Name != "protoc-gen-go" || tc.Plugins[0].Path != "protoc-gen-go" {
+		t.Errorf("got plugins %+v", tc.Plugins)
+	}
+
+	if _, err := (Toolchain{Protoc: Tool{URL: "https://example.com/protoc.zip"}}).Proto(nil, nil, nil, nil); err == nil {
+		t.Error("got no error for a tool without a hash")
+	}
+}
+
+func tgz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var (
+		buf bytes.Buffer
+		gw  = gzip.NewWriter(&buf)
+		tw  = tar.NewWriter(gw)
+	)
+	for name, contents := range files {
+		hdr := &tar.Header{Name: name, Mode: 0755, Size: int64(len(contents)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sha256hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,205 @@
+package fab
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+	"github.com/bobg/go-generics/v2/slices"
+)
+
+// outputRecords is the content of the file in the Fab directory
+// recording the outputs of named [Files] targets.
+type outputRecords struct {
+	// Targets maps the absolute path of each named Files target
+	// (its project's top directory joined with its name)
+	// to the absolute paths of its outputs as of its last successful run.
+	Targets map[string][]string `json:"targets"`
+
+	// Orphans are the absolute paths of files
+	// that were once outputs of a Files target
+	// but were dropped from its output list.
+	Orphans []string `json:"orphans,omitempty"`
+}
+
+const outputsBasename = "outputs.json"
+
+var outputsMu sync.Mutex // protects the output-records file
+
+func readOutputRecords(fabdir string) (*outputRecords, error) {
+	filename := filepath.Join(fabdir, outputsBasename)
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &outputRecords{Targets: make(map[string][]string)}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", filename)
+	}
+	var recs outputRecords
+	if err := json.Unmarshal(data, &recs); err != nil {
+		return nil, errors.Wrapf(err, "decoding %s", filename)
+	}
+	if recs.Targets == nil {
+		recs.Targets = make(map[string][]string)
+	}
+	return &recs, nil
+}
+
+func (recs *outputRecords) write(fabdir string) error {
+	data, err := json.Marshal(recs)
+	if err != nil {
+		return errors.Wrap(err, "encoding output records")
+	}
+	if err := os.MkdirAll(fabdir, 0755); err != nil {
+		return errors.Wrapf(err, "creating directory %s", fabdir)
+	}
+	filename := filepath.Join(fabdir, outputsBasename)
+	tmpname := filename + ".tmp"
+	if err := os.WriteFile(tmpname, data, 0644); err != nil {
+		return errors.Wrapf(err, "writing %s", tmpname)
+	}
+	err = os.Rename(tmpname, filename)
+	return errors.Wrapf(err, "renaming %s to %s", tmpname, filename)
+}
+
+// recordOutputs records the outputs of ft in the Fab directory
+// (see [GetFabdir]),
+// if ft is a named target.
+// Files that ft produced on an earlier run
+// but that are no longer in its output list
+// are noted as "orphans,"
+// for removal with [Controller.PruneOutputs].
+func (ft *files) recordOutputs(ctx context.Context, con *Controller) error {
+	fabdir := GetFabdir(ctx)
+	if fabdir == "" || GetDryRun(ctx) {
+		return nil
+	}
+
+	key, err := con.persistentKey(ft)
+	if err != nil || key == "" {
+		return err
+	}
+
+	out := set.New[string]()
+	for _, file := range ft.Out {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return errors.Wrapf(err, "getting absolute path of %s", file)
+		}
+		out.Add(abs)
+	}
+
+	outputsMu.Lock()
+	defer outputsMu.Unlock()
+
+	recs, err := readOutputRecords(fabdir)
+	if err != nil {
+		return err
+	}
+
+	orphans := set.New(recs.Orphans...)
+	var newOrphans []string
+	for _, file := range recs.Targets[key] {
+		if !out.Has(file) && !orphans.Has(file) {
+			newOrphans = append(newOrphans, file)
+			orphans.Add(file)
+		}
+	}
+	outSlice := out.Slice()
+	sort.Strings(outSlice)
+	orphans.Del(outSlice...)
+
+	if len(newOrphans) == 0 && orphans.Len() == len(recs.Orphans) && slices.Equal(recs.Targets[key], outSlice) {
+		return nil
+	}
+
+	if len(newOrphans) > 0 {
+		con.message("stderr", "Note: %s no longer produces %s; remove with fab -prune-outputs", con.Describe(ft), strings.Join(newOrphans, ", "))
+	}
+
+	recs.Targets[key] = outSlice
+	recs.Orphans = orphans.Slice()
+	sort.Strings(recs.Orphans)
+
+	return recs.write(fabdir)
+}
+
+// StaleOutputs returns the files in con's top directory
+// that were once outputs of a [Files] target
+// but were later dropped from its output list
+// and still exist.
+// These are recorded in the given Fab directory
+// (see [GetFabdir])
+// only for named targets.
+func (con *Controller) StaleOutputs(fabdir string) ([]string, error) {
+	outputsMu.Lock()
+	defer outputsMu.Unlock()
+
+	recs, err := readOutputRecords(fabdir)
+	if err != nil {
+		return nil, err
+	}
+	stale, _, err := con.staleOutputs(recs)
+	return stale, err
+}
+
+// staleOutputs partitions recs.Orphans into
+// those in con's top directory that exist,
+// and the rest.
+func (con *Controller) staleOutputs(recs *outputRecords) (stale, rest []string, err error) {
+	topdir, err := filepath.Abs(con.JoinPath())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "getting absolute path of top directory")
+	}
+	for _, file := range recs.Orphans {
+		if !strings.HasPrefix(file, topdir+string(filepath.Separator)) {
+			rest = append(rest, file)
+			continue
+		}
+		if _, err := os.Lstat(file); err == nil {
+			stale = append(stale, file)
+		}
+	}
+	return stale, rest, nil
+}
+
+// PruneOutputs removes the files reported by [Controller.StaleOutputs]
+// and returns their names.
+// An output that is a directory is removed with all its contents.
+//
+// When [GetDryRun] is true,
+// PruneOutputs reports the files but does not remove them.
+//
+// A [Clean] target with Autoclean set also prunes outputs in this way.
+func (con *Controller) PruneOutputs(ctx context.Context, fabdir string) ([]string, error) {
+	outputsMu.Lock()
+	defer outputsMu.Unlock()
+
+	recs, err := readOutputRecords(fabdir)
+	if err != nil {
+		return nil, err
+	}
+	stale, rest, err := con.staleOutputs(recs)
+	if err != nil {
+		return nil, err
+	}
+	if len(stale) == 0 || GetDryRun(ctx) {
+		return stale, nil
+	}
+
+	for _, file := range stale {
+		if err := os.RemoveAll(file); err != nil {
+			return nil, errors.Wrapf(err, "removing %s", file)
+		}
+	}
+
+	recs.Orphans = rest
+	return stale, recs.write(fabdir)
+}
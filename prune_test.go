@@ -0,0 +1,106 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPruneOutputs(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		fabdir = filepath.Join(tmpdir, "fab")
+		topdir = filepath.Join(tmpdir, "top")
+		ctx    = WithFabdir(context.Background(), fabdir)
+	)
+	if err := os.MkdirAll(topdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// run runs a Files target named Gen that writes the given files in topdir.
+	run := func(names ...string) *Controller {
+		t.Helper()
+
+		var out []string
+		for _, name := range names {
+			out = append(out, filepath.Join(topdir, name))
+		}
+		write := F(func(context.Context, *Controller) error {
+			for _, file := range out {
+				if err := os.WriteFile(file, nil, 0644); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		con := NewController(topdir)
+		target, err := con.RegisterTarget("Gen", "", Files(write, nil, out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := con.Run(ctx, target); err != nil {
+			t.Fatal(err)
+		}
+		return con
+	}
+
+	con := run("a", "b", "c")
+	stale, err := con.StaleOutputs(fabdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 0 {
+		t.Errorf("got stale outputs %v, want none", stale)
+	}
+
+	con = run("a")
+	stale, err = con.StaleOutputs(fabdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(topdir, "b"), filepath.Join(topdir, "c")}
+	if !reflect.DeepEqual(stale, want) {
+		t.Errorf("got stale outputs %v, want %v", stale, want)
+	}
+
+	pruned, err := con.PruneOutputs(WithDryRun(ctx, true), fabdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pruned, want) {
+		t.Errorf("got dry-run pruned outputs %v, want %v", pruned, want)
+	}
+	if _, err := os.Stat(want[0]); err != nil {
+		t.Errorf("dry run removed %s", want[0])
+	}
+
+	// Restoring c as an output means it is no longer stale.
+	con = run("a", "c")
+	if _, err := con.PruneOutputs(ctx, fabdir); err != nil {
+		t.Fatal(err)
+	}
+	for name, wantExist := range map[string]bool{"a": true, "b": false, "c": true} {
+		_, err := os.Stat(filepath.Join(topdir, name))
+		if exists := err == nil; exists != wantExist {
+			t.Errorf("%s exists = %v, want %v", name, exists, wantExist)
+		}
+	}
+
+	stale, err = con.StaleOutputs(fabdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 0 {
+		t.Errorf("got stale outputs %v after pruning, want none", stale)
+	}
+}
@@ -0,0 +1 @@
+def test_app(): pass
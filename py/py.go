@@ -0,0 +1,439 @@
+// Package py contains Fab target types for Python projects:
+// virtual environments,
+// tests,
+// and wheels.
+package py
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bobg/fab"
+)
+
+// marker is the file written in a virtualenv
+// after its requirements are installed,
+// relative to the virtualenv directory.
+// It contains the output of `pip freeze`.
+const marker = ".fab-installed"
+
+// junk is the list of patterns for files,
+// within the input directories of a target,
+// that do not go into its hash.
+var junk = []string{"**/__pycache__/**", "**/*.pyc"}
+
+// Python returns the command for running Python:
+// python3 if it is in the PATH,
+// and otherwise python.
+func Python() string {
+	if _, err := exec.LookPath("python3"); err == nil {
+		return "python3"
+	}
+	return "python"
+}
+
+// Bin returns the path of the program prog in the virtualenv venvdir,
+// such as python or pytest.
+func Bin(venvdir, prog string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(venvdir, "Scripts", prog+".exe")
+	}
+	return filepath.Join(venvdir, "bin", prog)
+}
+
+// Venv produces a target that creates the Python virtual environment venvdir
+// and installs requirements in it.
+// Each of reqs is either a requirements file,
+// installed with `pip install -r FILE`,
+// or a pyproject.toml file,
+// whose project is installed
+// (together with its dependencies)
+// with `pip install -e DIR`.
+// The virtualenv is created with `PYTHON -m venv`,
+// where PYTHON is python if that is not empty,
+// and otherwise [Python].
+//
+// Venv is implemented in terms of [fab.Files].
+// Its inputs are the files in reqs,
+// and its output is a file that Venv writes in venvdir after installing them,
+// listing the installed packages
+// (as from `pip freeze`),
+// rather than the whole virtualenv,
+// which would be costly to hash.
+// When the inputs change,
+// or when the version of Python does,
+// the virtualenv is emptied and created again,
+// so that it does not keep packages that are no longer required.
+// Any opts are passed through to fab.Files.
+//
+// [PyTest] and [Wheel] targets for venvdir
+// have that file as an input,
+// so running one of them
+// runs the Venv target first
+// when the virtualenv is out of date,
+// and runs again itself
+// when the installed packages change.
+//
+// A Venv target may be specified in YAML using the tag !py.Venv,
+// which introduces a mapping whose fields are:
+//
+//   - Dir: the virtualenv directory
+//   - Requirements: a sequence of requirements files and pyproject.toml files
+//   - Python: the Python command
+//
+// Dir and the files in Requirements are either absolute or relative to the directory containing the YAML file.
+func Venv(venvdir string, reqs []string, python string, opts ...fab.FilesOpt) (fab.Target, error) {
+	if venvdir == "" {
+		return nil, errors.New("no virtualenv directory")
+	}
+	if python == "" {
+		python = Python()
+	}
+
+	v := &venv{
+		Create: &fab.Command{
+			Cmd:      python,
+			Args:     []string{"-m", "venv", "--clear", venvdir},
+			HashTool: "--version",
+		},
+	}
+
+	venvPython, err := filepath.Abs(Bin(venvdir, "python"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting absolute path of %s", venvdir)
+	}
+	for _, req := range reqs {
+		args := []string{"-m", "pip", "install", "-r", req}
+		if filepath.Base(req) == "pyproject.toml" {
+			args = []string{"-m", "pip", "install", "-e", filepath.Dir(req)}
+		}
+		v.Install = append(v.Install, &fab.Command{Cmd: venvPython, Args: args})
+	}
+	v.Freeze = &fab.Command{
+		Cmd:        venvPython,
+		Args:       []string{"-m", "pip", "freeze"},
+		StdoutFile: filepath.Join(venvdir, marker),
+	}
+
+	return fab.Files(v, reqs, []string{v.Freeze.StdoutFile}, opts...), nil
+}
+
+// MustVenv is the same as [Venv] but panics on error.
+func MustVenv(venvdir string, reqs []string, python string, opts ...fab.FilesOpt) fab.Target {
+	target, err := Venv(venvdir, reqs, python, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+// venv is the subtarget of a [Venv] target.
+type venv struct {
+	Create  *fab.Command
+	Install []*fab.Command
+	Freeze  *fab.Command
+}
+
+var (
+	_ fab.Target        = &venv{}
+	_ fab.GraphChildren = &venv{}
+)
+
+// Run implements fab.Target.Run.
+func (v *venv) Run(ctx context.Context, con *fab.Controller) error {
+	if err := con.Run(ctx, v.Create); err != nil {
+		return errors.Wrap(err, "creating virtualenv")
+	}
+	for _, c := range v.Install {
+		if err := con.Run(ctx, c); err != nil {
+			return errors.Wrap(err, "installing requirements")
+		}
+	}
+	return errors.Wrap(con.Run(ctx, v.Freeze), "listing installed packages")
+}
+
+// Desc implements fab.Target.Desc.
+func (*venv) Desc() string {
+	return "py.Venv"
+}
+
+// Children implements fab.GraphChildren.
+func (v *venv) Children() []fab.Target {
+	result := []fab.Target{v.Create}
+	for _, c := range v.Install {
+		result = append(result, c)
+	}
+	return append(result, v.Freeze)
+}
+
+func venvDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var v struct {
+		Dir          string    `yaml:"Dir"`
+		Requirements yaml.Node `yaml:"Requirements"`
+		Python       string    `yaml:"Python"`
+	}
+	if err := node.Decode(&v); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding py.Venv")
+	}
+	if v.Dir == "" {
+		return nil, errors.New("YAML error decoding py.Venv: no Dir")
+	}
+
+	reqs, err := con.YAMLFileList(&v.Requirements, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding py.Venv.Requirements")
+	}
+
+	return Venv(con.JoinPath(dir, v.Dir), reqs, v.Python)
+}
+
+// PyTest produces a target that runs `python -m pytest ARGS` in dir,
+// with the python from the virtualenv venvdir
+// (see [Venv]).
+//
+// PyTest is implemented in terms of [fab.Check],
+// so the tests run again only when something they depend on changes.
+// The inputs are the files matching the patterns in src,
+// plus the file showing that the virtualenv is up to date.
+// Each pattern is interpreted relative to dir
+// with the syntax of [fs.Glob];
+// a pattern matching a directory includes all the files in its tree
+// (except for __pycache__ directories and .pyc files).
+//
+// A PyTest target may be specified in YAML using the tag !py.PyTest,
+// which introduces a mapping whose fields are:
+//
+//   - Venv: the virtualenv directory
+//   - Dir: the directory in which to run pytest
+//   - Src: a sequence of patterns for the source and test files
+//   - Args: a sequence of additional arguments for pytest
+//
+// Venv and Dir are either absolute or relative to the directory containing the YAML file.
+// The patterns in Src are relative to Dir.
+func PyTest(venvdir, dir string, src []string, args ...string) (fab.Target, error) {
+	venvPython, err := filepath.Abs(Bin(venvdir, "python"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting absolute path of %s", venvdir)
+	}
+	in, err := inputs(venvdir, dir, src)
+	if err != nil {
+		return nil, err
+	}
+	c := &fab.Command{
+		Cmd:  venvPython,
+		Args: append([]string{"-m", "pytest"}, args...),
+		Dir:  dir,
+	}
+	return fab.Check(c, in, fab.Exclude(junk...)), nil
+}
+
+// MustPyTest is the same as [PyTest] but panics on error.
+func MustPyTest(venvdir, dir string, src []string, args ...string) fab.Target {
+	target, err := PyTest(venvdir, dir, src, args...)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+func pytestDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var p struct {
+		Venv string    `yaml:"Venv"`
+		Dir  string    `yaml:"Dir"`
+		Src  yaml.Node `yaml:"Src"`
+		Args yaml.Node `yaml:"Args"`
+	}
+	if err := node.Decode(&p); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding py.PyTest")
+	}
+	if p.Venv == "" {
+		return nil, errors.New("YAML error decoding py.PyTest: no Venv")
+	}
+
+	src, err := con.YAMLStringList(&p.Src, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding py.PyTest.Src")
+	}
+	args, err := con.YAMLStringList(&p.Args, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding py.PyTest.Args")
+	}
+
+	return PyTest(con.JoinPath(dir, p.Venv), con.JoinPath(dir, p.Dir), src, args...)
+}
+
+// Wheel produces a target that builds a wheel for the Python project in dir
+// (containing pyproject.toml, setup.py, or setup.cfg),
+// running `python -m pip wheel --no-deps --wheel-dir OUTDIR DIR`
+// with the python from the virtualenv venvdir
+// (see [Venv]).
+//
+// Wheel is implemented in terms of [fab.Files].
+// Its inputs are the project's pyproject.toml, setup.py, and setup.cfg files
+// (those that exist),
+// the files matching the patterns in src
+// (as for [PyTest]),
+// and the file showing that the virtualenv is up to date.
+// Its output is outdir,
+// which is emptied before building,
+// and is automatically selected for "autocleaning."
+// See [fab.Autoclean] for more about this feature.
+//
+// A Wheel target may be specified in YAML using the tag !py.Wheel,
+// which introduces a mapping whose fields are:
+//
+//   - Venv: the virtualenv directory
+//   - Dir: the project directory
+//   - Out: the output directory
+//   - Src: a sequence of patterns for the project's source files
+//
+// Venv, Dir, and Out are either absolute or relative to the directory containing the YAML file.
+// The patterns in Src are relative to Dir.
+func Wheel(venvdir, dir, outdir string, src []string) (fab.Target, error) {
+	if outdir == "" {
+		return nil, errors.New("no output directory")
+	}
+	venvPython, err := filepath.Abs(Bin(venvdir, "python"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting absolute path of %s", venvdir)
+	}
+
+	in, err := inputs(venvdir, dir, src)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"pyproject.toml", "setup.cfg", "setup.py"} {
+		full := filepath.Join(dir, name)
+		if _, err := os.Stat(full); err == nil {
+			in = append(in, full)
+		}
+	}
+	sort.Strings(in)
+
+	w := &wheel{
+		Command: &fab.Command{
+			Cmd:  venvPython,
+			Args: []string{"-m", "pip", "wheel", "--no-deps", "--wheel-dir", outdir, dir},
+		},
+		OutDir: outdir,
+	}
+	return fab.Files(w, in, []string{outdir}, fab.Autoclean(true), fab.Exclude(junk...)), nil
+}
+
+// MustWheel is the same as [Wheel] but panics on error.
+func MustWheel(venvdir, dir, outdir string, src []string) fab.Target {
+	target, err := Wheel(venvdir, dir, outdir, src)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+// wheel is the subtarget of a [Wheel] target.
+type wheel struct {
+	Command *fab.Command
+	OutDir  string
+}
+
+var (
+	_ fab.Target        = &wheel{}
+	_ fab.GraphChildren = &wheel{}
+)
+
+// Run implements fab.Target.Run.
+func (w *wheel) Run(ctx context.Context, con *fab.Controller) error {
+	if !fab.GetDryRun(ctx) {
+		// Don't leave wheels for earlier versions of the project lying around.
+		if err := os.RemoveAll(w.OutDir); err != nil {
+			return errors.Wrapf(err, "removing %s", w.OutDir)
+		}
+	}
+	return con.Run(ctx, w.Command)
+}
+
+// Desc implements fab.Target.Desc.
+func (*wheel) Desc() string {
+	return "py.Wheel"
+}
+
+// Children implements fab.GraphChildren.
+func (w *wheel) Children() []fab.Target {
+	return []fab.Target{w.Command}
+}
+
+func wheelDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var w struct {
+		Venv string    `yaml:"Venv"`
+		Dir  string    `yaml:"Dir"`
+		Out  string    `yaml:"Out"`
+		Src  yaml.Node `yaml:"Src"`
+	}
+	if err := node.Decode(&w); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding py.Wheel")
+	}
+	if w.Venv == "" {
+		return nil, errors.New("YAML error decoding py.Wheel: no Venv")
+	}
+	if w.Out == "" {
+		return nil, errors.New("YAML error decoding py.Wheel: no Out")
+	}
+
+	src, err := con.YAMLStringList(&w.Src, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding py.Wheel.Src")
+	}
+
+	return Wheel(con.JoinPath(dir, w.Venv), con.JoinPath(dir, w.Dir), con.JoinPath(dir, w.Out), src)
+}
+
+// inputs returns the marker file of the virtualenv venvdir
+// and the files in dir matching the patterns in src,
+// sorted.
+func inputs(venvdir, dir string, src []string) ([]string, error) {
+	in := set.New(filepath.Join(venvdir, marker))
+
+	fsys := os.DirFS(dir)
+	for _, pattern := range src {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "in pattern %s", pattern)
+		}
+		for _, match := range matches {
+			in.Add(filepath.Join(dir, match))
+		}
+	}
+
+	result := in.Slice()
+	sort.Strings(result)
+	return result, nil
+}
+
+func init() {
+	fab.RegisterYAMLTarget("py.Venv", venvDecoder)
+	fab.SetYAMLTagDoc("py.Venv", "Create a Python virtualenv and install requirements in it.")
+	fab.RegisterYAMLTarget("py.PyTest", pytestDecoder)
+	fab.SetYAMLTagDoc("py.PyTest", "Run Python tests with pytest.")
+	fab.RegisterYAMLTarget("py.Wheel", wheelDecoder)
+	fab.SetYAMLTagDoc("py.Wheel", "Build a wheel for a Python project.")
+}
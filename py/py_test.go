@@ -0,0 +1,61 @@
+package py
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bobg/fab/internal/faketool"
+)
+
+func TestPython(t *testing.T) {
+	e := faketool.New(t, "_testdata")
+	e.WriteFile(t, "app/app/__pycache__/x.pyc", "junk")
+	e.WriteFile(t, "app/tests/__pycache__/y.pyc", "junk")
+
+	// run runs the named target with a new controller
+	// and returns the python commands that ran.
+	run := func(name string) string {
+		t.Helper()
+		return strings.Join(e.Run(t, name), "\n")
+	}
+
+	const (
+		venv    = "python3 -m venv --clear app/.venv\npython -m pip install -r app/requirements.txt\npython -m pip install -e app\npython -m pip freeze"
+		pytest  = "python -m pytest -q"
+		wheel   = "python -m pip wheel --no-deps --wheel-dir dist app"
+		pytest2 = venv + "\n" + pytest
+	)
+
+	// Running the tests creates the virtualenv first.
+	if got := run("Test"); got != pytest2 {
+		t.Errorf("first test run: got %q, want %q", got, pytest2)
+	}
+	if got := run("Test"); got != "" {
+		t.Errorf("second test run: got %q, want nothing", got)
+	}
+
+	// Changes to .pyc files don't matter.
+	e.WriteFile(t, "app/tests/__pycache__/y.pyc", "more junk")
+	if got := run("Test"); got != "" {
+		t.Errorf("after changing .pyc file: got %q, want nothing", got)
+	}
+
+	e.WriteFile(t, "app/tests/test_app.py", "def test_app(): assert True\n")
+	if got := run("Test"); got != pytest {
+		t.Errorf("after changing test: got %q, want %q", got, pytest)
+	}
+
+	if got := run("Wheel"); got != wheel {
+		t.Errorf("first wheel build: got %q, want %q", got, wheel)
+	}
+	if _, err := os.Stat(e.Path("dist", "app-1.0-py3-none-any.whl")); err != nil {
+		t.Error(err)
+	}
+
+	// Changing the requirements refreshes the virtualenv.
+	e.WriteFile(t, "app/requirements.txt", "requests\nattrs\n")
+	if got := run("Test"); got != pytest2 {
+		t.Errorf("after changing requirements: got %q, want %q", got, pytest2)
+	}
+}
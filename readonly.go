@@ -0,0 +1,127 @@
+package fab
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bobg/errors"
+)
+
+// ReadOnlyIn is an option for passing to [Files].
+// When it is true,
+// the input files of the Files target are made read-only
+// while its subtarget runs,
+// and afterwards it is an error if any of them changed.
+// This catches a subtarget that rewrites its own inputs
+// (and whose Files target therefore never appears up to date).
+//
+// Only regular files are made read-only;
+// a subtarget can still add or remove files in an input directory,
+// but that too causes an error.
+func ReadOnlyIn(readOnly bool) FilesOpt {
+	return func(f *files) {
+		f.readOnlyIn = readOnly
+	}
+}
+
+// readOnlyFiles tracks the files made read-only by [ReadOnlyIn],
+// which may be inputs of more than one Files target running at once.
+var readOnlyFiles = struct {
+	mu    sync.Mutex
+	files map[string]*readOnlyFile
+}{
+	files: make(map[string]*readOnlyFile),
+}
+
+type readOnlyFile struct {
+	mode  fs.FileMode // the original mode
+	count int         // the number of Files targets holding this file read-only
+}
+
+// protectInputs makes ft's input files read-only.
+// It returns a function for calling after the subtarget runs,
+// which restores the files' modes
+// and reports an error if any of them changed.
+func (ft *files) protectInputs() (func() error, error) {
+	before, err := snapshotInputs(ft.In)
+	if err != nil {
+		return nil, errors.Wrap(err, "noting input files")
+	}
+
+	protected, err := protectFiles(before)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		if err := releaseFiles(protected); err != nil {
+			return err
+		}
+		after, err := snapshotInputs(ft.In)
+		if err != nil {
+			return errors.Wrap(err, "checking input files")
+		}
+		if changed := before.changed(after); len(changed) > 0 {
+			return fmt.Errorf("subtarget changed input files: %s", strings.Join(changed, ", "))
+		}
+		return nil
+	}, nil
+}
+
+// protectFiles makes the regular files in snapshot read-only
+// and returns their names.
+func protectFiles(snapshot inputSnapshot) ([]string, error) {
+	readOnlyFiles.mu.Lock()
+	defer readOnlyFiles.mu.Unlock()
+
+	var result []string
+	for path := range snapshot {
+		if rf, ok := readOnlyFiles.files[path]; ok {
+			rf.count++
+			result = append(result, path)
+			continue
+		}
+		info, err := os.Lstat(path)
+		if err == nil && !info.Mode().IsRegular() {
+			continue
+		}
+		if err == nil {
+			err = os.Chmod(path, info.Mode()&^0222)
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "making %s read-only", path)
+			return nil, errors.Join(err, releaseFilesLocked(result))
+		}
+		readOnlyFiles.files[path] = &readOnlyFile{mode: info.Mode(), count: 1}
+		result = append(result, path)
+	}
+	return result, nil
+}
+
+// releaseFiles undoes [protectFiles].
+// A file's original mode is restored
+// when no other Files target is holding it read-only.
+func releaseFiles(paths []string) error {
+	readOnlyFiles.mu.Lock()
+	defer readOnlyFiles.mu.Unlock()
+	return releaseFilesLocked(paths)
+}
+
+func releaseFilesLocked(paths []string) error {
+	var result error
+	for _, path := range paths {
+		rf := readOnlyFiles.files[path]
+		rf.count--
+		if rf.count > 0 {
+			continue
+		}
+		delete(readOnlyFiles.files, path)
+		if err := os.Chmod(path, rf.mode); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			result = errors.Join(result, errors.Wrapf(err, "restoring mode of %s", path))
+		}
+	}
+	return result
+}
@@ -0,0 +1,73 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyIn(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		ctx = context.Background()
+		in  = filepath.Join(tmpdir, "in")
+		out = filepath.Join(tmpdir, "out")
+	)
+	if err := os.WriteFile(in, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var modeDuringRun os.FileMode
+	copyIn := F(func(context.Context, *Controller) error {
+		info, err := os.Stat(in)
+		if err != nil {
+			return err
+		}
+		modeDuringRun = info.Mode()
+		data, err := os.ReadFile(in)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(out, data, 0644)
+	})
+
+	if err := NewController("").Run(ctx, Files(copyIn, []string{in}, []string{out}, ReadOnlyIn(true))); err != nil {
+		t.Fatal(err)
+	}
+	if modeDuringRun != 0444 {
+		t.Errorf("got mode %v during run, want %v", modeDuringRun, os.FileMode(0444))
+	}
+	info, err := os.Stat(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode() != 0644 {
+		t.Errorf("got mode %v after run, want %v", info.Mode(), os.FileMode(0644))
+	}
+
+	// This subtarget defeats the read-only mode
+	// (as root can, even without the Chmod).
+	rewriteIn := F(func(context.Context, *Controller) error {
+		if err := os.Chmod(in, 0644); err != nil {
+			return err
+		}
+		return os.WriteFile(in, []byte("yz"), 0644)
+	})
+
+	err = NewController("").Run(ctx, Files(rewriteIn, []string{in}, []string{out}, ReadOnlyIn(true)))
+	if err == nil {
+		t.Fatal("got no error for subtarget that changed its input")
+	}
+	if !strings.Contains(err.Error(), "changed input files: "+in) {
+		t.Errorf("got error %q, want one about changed input files", err)
+	}
+}
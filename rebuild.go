@@ -0,0 +1,410 @@
+package fab
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+)
+
+// HashRecorder is an optional interface that a [HashDB] may implement
+// to remember what went into the hash of each named [Files] target
+// the last time it was added to the database:
+// the hash of each input and output file,
+// and a digest of the subtarget.
+// [Controller.WhyRebuild] compares this record with the current state
+// to tell why a target is not up to date.
+// The [sqlite.DB] type implements it.
+type HashRecorder interface {
+	// HashRecord returns the record stored under key, and true.
+	// If there is no such record,
+	// it returns nil, false.
+	HashRecord(ctx context.Context, key string) ([]byte, bool, error)
+
+	// SetHashRecord stores a record under key,
+	// replacing any earlier one.
+	SetHashRecord(ctx context.Context, key string, record []byte) error
+}
+
+// hashRecord is the breakdown of a [filesHashInputs]
+// stored with a [HashRecorder].
+type hashRecord struct {
+	Target string            `json:"target"` // digest of the subtarget and its type
+	In     map[string]string `json:"in,omitempty"`
+	Out    map[string]string `json:"out,omitempty"`
+	Env    []string          `json:"env,omitempty"`
+	Tools  map[string]string `json:"tools,omitempty"`
+}
+
+func (hi *filesHashInputs) record() (*hashRecord, error) {
+	j, err := json.Marshal([]any{hi.Target, hi.TargetType})
+	if err != nil {
+		return nil, errors.Wrap(err, "in JSON marshaling")
+	}
+	sum := sha256.Sum224(j)
+
+	return &hashRecord{
+		Target: hex.EncodeToString(sum[:]),
+		In:     pairsToMap(hi.In),
+		Out:    pairsToMap(hi.Out),
+		Env:    hi.Env,
+		Tools:  pairsToMap(hi.Tools),
+	}, nil
+}
+
+// pairsToMap converts a [filename, hash, filename, hash, ...] list,
+// as produced by fileHashes,
+// to a map.
+func pairsToMap(pairs []string) map[string]string {
+	if len(pairs) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		result[pairs[i]] = pairs[i+1]
+	}
+	return result
+}
+
+// persistentKey returns a key identifying target across runs of Fab:
+// the absolute path of con's top directory
+// joined with the target's name in the registry.
+// It returns "" if the target is unnamed.
+func (con *Controller) persistentKey(target Target) (string, error) {
+	addr, err := targetAddr(target)
+	if err != nil {
+		return "", nil
+	}
+	con.mu.Lock()
+	tuple, ok := con.targetsByAddr[addr]
+	con.mu.Unlock()
+	if !ok {
+		return "", nil
+	}
+
+	topdir, err := filepath.Abs(con.JoinPath())
+	if err != nil {
+		return "", errors.Wrap(err, "getting absolute path of top directory")
+	}
+	return filepath.Join(topdir, tuple.name), nil
+}
+
+// saveHashRecord stores the breakdown of hi for ft
+// in db,
+// if db is a [HashRecorder] and ft is a named target.
+func (ft *files) saveHashRecord(ctx context.Context, con *Controller, db HashDB, hi *filesHashInputs) error {
+	recorder, ok := db.(HashRecorder)
+	if !ok {
+		return nil
+	}
+	key, err := con.persistentKey(ft)
+	if err != nil || key == "" {
+		return err
+	}
+	rec, err := hi.record()
+	if err != nil {
+		return err
+	}
+	j, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "in JSON marshaling")
+	}
+	err = recorder.SetHashRecord(ctx, key, j)
+	return errors.Wrapf(err, "recording hash of %s", con.Describe(ft))
+}
+
+// RebuildReason tells whether a [Files] target is up to date,
+// and if not,
+// why not.
+// See [Controller.WhyRebuild].
+type RebuildReason struct {
+	// Target is the name of the target (see [Controller.Describe]).
+	Target string `json:"target"`
+
+	// UpToDate tells whether the target's hash is in the hash DB,
+	// so that running it would do nothing.
+	// When it is true the other fields are empty.
+	UpToDate bool `json:"up_to_date,omitempty"`
+
+	// Volatile is the reason the target is volatile (see [Volatile]),
+	// if it is.
+	Volatile string `json:"volatile,omitempty"`
+
+	// NoRecord tells whether the reasons below are unknown
+	// because there is no record of the target's hash from an earlier run.
+	// This is the case for a target that has never been run,
+	// for an unnamed target,
+	// and when the [HashDB] is not a [HashRecorder].
+	NoRecord bool `json:"no_record,omitempty"`
+
+	// InChanged, InAdded, and InRemoved are the input files
+	// that have changed,
+	// that are new,
+	// and that are gone,
+	// since the target last ran.
+	InChanged []string `json:"in_changed,omitempty"`
+	InAdded   []string `json:"in_added,omitempty"`
+	InRemoved []string `json:"in_removed,omitempty"`
+
+	// OutMissing are the output files that do not exist.
+	OutMissing []string `json:"out_missing,omitempty"`
+
+	// OutChanged are the output files that have changed
+	// since the target last ran.
+	OutChanged []string `json:"out_changed,omitempty"`
+
+	// TargetChanged tells whether the definition of the target's subtarget has changed
+	// since the target last ran.
+	TargetChanged bool `json:"target_changed,omitempty"`
+
+	// EnvChanged are the environment variables named with [HashEnv]
+	// whose values have changed
+	// since the target last ran.
+	EnvChanged []string `json:"env_changed,omitempty"`
+
+	// ToolsChanged are the programs
+	// identified with the HashTool field of a [Command]
+	// that have changed
+	// (e.g. by being upgraded)
+	// since the target last ran.
+	ToolsChanged []string `json:"tools_changed,omitempty"`
+}
+
+// String summarizes r in a single line.
+func (r RebuildReason) String() string {
+	switch {
+	case r.UpToDate:
+		return "up to date"
+	case r.Volatile != "":
+		return "volatile: " + r.Volatile
+	}
+
+	var parts []string
+	add := func(label string, files []string) {
+		if len(files) > 0 {
+			parts = append(parts, label+": "+strings.Join(files, ", "))
+		}
+	}
+	add("inputs changed", r.InChanged)
+	add("inputs added", r.InAdded)
+	add("inputs removed", r.InRemoved)
+	add("outputs missing", r.OutMissing)
+	add("outputs changed", r.OutChanged)
+	if r.TargetChanged {
+		parts = append(parts, "subtarget changed")
+	}
+	add("environment changed", r.EnvChanged)
+	add("tools changed", r.ToolsChanged)
+
+	switch {
+	case len(parts) > 0:
+		return strings.Join(parts, "; ")
+	case r.NoRecord:
+		return "no record of an earlier run"
+	default:
+		return "hash not in database"
+	}
+}
+
+// WhyRebuild tells whether target,
+// which must be a [Files] target,
+// is up to date,
+// and if not,
+// which of its input files changed,
+// which of its output files are missing or changed,
+// which of the environment variables named with [HashEnv] changed,
+// which of the tools identified with Command.HashTool changed,
+// and whether its subtarget changed,
+// since it last ran.
+// The comparison is with the record kept in the [HashDB] in ctx,
+// which must be a [HashRecorder] for anything but a missing output file to be reported.
+// Nothing is run,
+// not even the targets that produce the target's inputs,
+// so the answer may be different after they run.
+//
+// The fab command's -explain flag reports the reasons
+// for each Files target among the targets on its command line and their subtargets.
+func (con *Controller) WhyRebuild(ctx context.Context, target Target) (RebuildReason, error) {
+	result := RebuildReason{Target: con.Describe(target)}
+
+	ft, ok := target.(*files)
+	if !ok {
+		return result, fmt.Errorf("%s is not a Files target", result.Target)
+	}
+	if ft.volatile != "" {
+		result.Volatile = ft.volatile
+		return result, nil
+	}
+
+	db := GetHashDB(ctx)
+	if db == nil {
+		return result, fmt.Errorf("no hash DB")
+	}
+
+	hi, err := ft.hashInputs(ctx, con)
+	if err != nil {
+		return result, err
+	}
+	h, err := hi.sum()
+	if err != nil {
+		return result, err
+	}
+	if result.UpToDate, err = db.Has(ctx, h); err != nil || result.UpToDate {
+		return result, errors.Wrap(err, "checking hash db")
+	}
+
+	cur, err := hi.record()
+	if err != nil {
+		return result, err
+	}
+	for file, hash := range cur.Out {
+		if hash == "" {
+			result.OutMissing = append(result.OutMissing, file)
+		}
+	}
+
+	prev, err := con.loadHashRecord(ctx, ft)
+	if err != nil {
+		return result, err
+	}
+	if prev == nil {
+		result.NoRecord = true
+	} else {
+		for file, hash := range cur.In {
+			prevHash, ok := prev.In[file]
+			switch {
+			case !ok:
+				result.InAdded = append(result.InAdded, file)
+			case hash != prevHash:
+				result.InChanged = append(result.InChanged, file)
+			}
+		}
+		for file := range prev.In {
+			if _, ok := cur.In[file]; !ok {
+				result.InRemoved = append(result.InRemoved, file)
+			}
+		}
+		for file, hash := range cur.Out {
+			if hash != "" && hash != prev.Out[file] {
+				result.OutChanged = append(result.OutChanged, file)
+			}
+		}
+		result.TargetChanged = cur.Target != prev.Target
+		result.EnvChanged = changedEnv(prev.Env, cur.Env)
+		for tool, hash := range cur.Tools {
+			if hash != prev.Tools[tool] {
+				result.ToolsChanged = append(result.ToolsChanged, tool)
+			}
+		}
+		for tool := range prev.Tools {
+			if _, ok := cur.Tools[tool]; !ok {
+				result.ToolsChanged = append(result.ToolsChanged, tool)
+			}
+		}
+		sort.Strings(result.ToolsChanged)
+	}
+
+	for _, files := range []*[]string{&result.InChanged, &result.InAdded, &result.InRemoved, &result.OutMissing, &result.OutChanged} {
+		if len(*files) > 0 {
+			*files = con.relPaths(*files)
+			sort.Strings(*files)
+		}
+	}
+
+	return result, nil
+}
+
+// reportPlan tells,
+// in dry-run mode (see [WithDryRun]),
+// whether ft would be rebuilt,
+// and why
+// (see [Controller.WhyRebuild]).
+// It returns true if ft is up to date.
+// The db argument is the hash DB in ctx,
+// or nil if ft is volatile.
+//
+// The inputs of ft are as they are now,
+// before any rebuilding of the targets that produce them,
+// which in dry-run mode does not happen.
+func (ft *files) reportPlan(ctx context.Context, con *Controller, db HashDB) (bool, error) {
+	restricted, err := ft.restricted(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var reason string
+	switch {
+	case GetForce(ctx):
+		reason = "forced"
+	case ft.volatile != "":
+		reason = "volatile: " + ft.volatile
+	case restricted:
+		reason = "restricted to some of its files"
+	case db == nil:
+		reason = "no hash DB"
+	default:
+		r, err := con.WhyRebuild(ctx, ft)
+		if err != nil {
+			return false, errors.Wrapf(err, "checking whether %s is up to date", con.Describe(ft))
+		}
+		if r.UpToDate {
+			con.Indentf("%s is up to date", r.Target)
+			return true, nil
+		}
+		reason = r.String()
+	}
+	con.Indentf("Would rebuild %s (%s)", con.Describe(ft), reason)
+	return false, nil
+}
+
+// loadHashRecord returns the record saved by saveHashRecord for ft,
+// or nil if there isn't one.
+func (con *Controller) loadHashRecord(ctx context.Context, ft *files) (*hashRecord, error) {
+	recorder, ok := GetHashDB(ctx).(HashRecorder)
+	if !ok {
+		return nil, nil
+	}
+	key, err := con.persistentKey(ft)
+	if err != nil || key == "" {
+		return nil, err
+	}
+	j, ok, err := recorder.HashRecord(ctx, key)
+	if err != nil || !ok {
+		return nil, errors.Wrapf(err, "looking up hash record of %s", con.Describe(ft))
+	}
+	var rec hashRecord
+	if err := json.Unmarshal(j, &rec); err != nil {
+		return nil, errors.Wrapf(err, "decoding hash record of %s", con.Describe(ft))
+	}
+	return &rec, nil
+}
+
+// WriteRebuildReasons writes to w,
+// for each [Files] target among the given targets and their subtargets,
+// the result of [Controller.WhyRebuild].
+// Nothing is run.
+func (con *Controller) WriteRebuildReasons(ctx context.Context, w io.Writer, targets ...Target) error {
+	ew := &errWriter{w: w}
+	err := con.walk(targets, func(target Target) error {
+		if _, ok := target.(*files); !ok {
+			return nil
+		}
+		r, err := con.WhyRebuild(ctx, target)
+		if err != nil {
+			return err
+		}
+		ew.printf("%s: %s\n", r.Target, r)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return ew.err
+}
@@ -0,0 +1,166 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+// recdb is a memdb that also implements HashRecorder.
+type recdb struct {
+	memdb
+
+	mu      sync.Mutex
+	records map[string][]byte
+}
+
+var _ HashRecorder = &recdb{}
+
+func (r *recdb) HashRecord(_ context.Context, key string) ([]byte, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.records[key]
+	return rec, ok, nil
+}
+
+func (r *recdb) SetHashRecord(_ context.Context, key string, record []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.records == nil {
+		r.records = make(map[string][]byte)
+	}
+	r.records[key] = record
+	return nil
+}
+
+func TestWhyRebuild(t *testing.T) {
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err := os.WriteFile(filepath.Join(tmpdir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		ctx = WithHashDB(context.Background(), &recdb{memdb: memdb(set.New[string]())})
+		in  = []string{filepath.Join(tmpdir, "a"), filepath.Join(tmpdir, "b")}
+		out = []string{filepath.Join(tmpdir, "out")}
+		con = NewController(tmpdir)
+	)
+
+	build, err := con.RegisterTarget("Build", "", Files(&Command{Shell: "cat a b > out", Dir: tmpdir}, in, out))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(target Target, want RebuildReason) {
+		t.Helper()
+		got, err := con.WhyRebuild(ctx, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want.Target = "Build"
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %#v, want %#v", got, want)
+		}
+	}
+
+	check(build, RebuildReason{NoRecord: true, OutMissing: []string{"out"}})
+
+	if err := con.Run(ctx, build); err != nil {
+		t.Fatal(err)
+	}
+	check(build, RebuildReason{UpToDate: true})
+
+	if err := os.WriteFile(filepath.Join(tmpdir, "a"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(out[0]); err != nil {
+		t.Fatal(err)
+	}
+	check(build, RebuildReason{InChanged: []string{"a"}, OutMissing: []string{"out"}})
+
+	buf := new(bytes.Buffer)
+	if err := con.WriteRebuildReasons(ctx, buf, build); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(buf.String()), "Build: inputs changed: a; outputs missing: out"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Running a target again requires a new Controller.
+	con = NewController(tmpdir)
+	build, err = con.RegisterTarget("Build", "", Files(&Command{Shell: "cat a b > out", Dir: tmpdir}, in, out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := con.Run(ctx, build); err != nil {
+		t.Fatal(err)
+	}
+	check(build, RebuildReason{UpToDate: true})
+
+	// A new definition under the same name.
+	build2, err := con.RegisterTarget("Build", "", Files(&Command{Shell: "cat b a > out", Dir: tmpdir}, in[:1], out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(build2, RebuildReason{InRemoved: []string{"b"}, TargetChanged: true})
+}
+
+func TestDryRunPlan(t *testing.T) {
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpdir, "in"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		db  = &recdb{memdb: memdb(set.New[string]())}
+		ctx = WithHashDB(context.Background(), db)
+		in  = []string{filepath.Join(tmpdir, "in")}
+		out = []string{filepath.Join(tmpdir, "out")}
+	)
+
+	run := func(dryRun bool) string {
+		con := NewController(tmpdir)
+		var buf strings.Builder
+		con.SetProgressSink(NewTextProgressSink(con, &buf, &buf))
+		build, err := con.RegisterTarget("Build", "", Files(&Command{Shell: "cp in out", Dir: tmpdir}, in, out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := con.Run(WithDryRun(ctx, dryRun), build); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	if got := run(true); !strings.Contains(got, "Would rebuild Build (outputs missing: out)") {
+		t.Errorf("before first run, got:\n%s", got)
+	}
+	if _, err := os.Stat(out[0]); err == nil {
+		t.Fatal("dry run created output file")
+	}
+
+	run(false)
+	if got := run(true); !strings.Contains(got, "Build is up to date") {
+		t.Errorf("after first run, got:\n%s", got)
+	}
+
+	if err := os.WriteFile(in[0], []byte("y"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := run(true); !strings.Contains(got, "Would rebuild Build (inputs changed: in)") {
+		t.Errorf("after changing input, got:\n%s", got)
+	}
+}
@@ -5,26 +5,81 @@ import (
 	"reflect"
 	"sort"
 
+	"github.com/bobg/errors"
 	"github.com/bobg/go-generics/v2/maps"
 )
 
-// RegisterTarget places a target in the registry with a given name and doc string.
-func (con *Controller) RegisterTarget(name, doc string, target Target) (Target, error) {
+// Register places a target in the registry with the given name.
+// Options may give it a doc string ([WithDoc]),
+// tags ([WithTags]),
+// aliases ([WithAliases]),
+// and command-line parameters ([WithParams]),
+// or hide it from target listings ([WithHidden]).
+// The return value is the target.
+func (con *Controller) Register(name string, target Target, opts ...RegisterOption) (Target, error) {
 	addr, err := targetAddr(target)
 	if err != nil {
 		return nil, err
 	}
 
-	tuple := targetRegistryTuple{target: target, name: name, doc: doc}
+	tuple := targetRegistryTuple{target: target, name: name}
+	for _, opt := range opts {
+		opt(&tuple)
+	}
+	if err := checkParams(tuple.params); err != nil {
+		return nil, errors.Wrapf(err, "in parameters of %s", name)
+	}
 
 	con.mu.Lock()
 	con.targetsByName[name] = tuple
 	con.targetsByAddr[addr] = tuple
 	con.mu.Unlock()
 
+	for _, alias := range tuple.aliases {
+		con.SetAlias(alias, name)
+	}
+
 	return target, nil
 }
 
+// RegisterTarget places a target in the registry with a given name and doc string.
+// It is the same as calling [Controller.Register]
+// with a [WithDoc] option
+// followed by any others in opts.
+func (con *Controller) RegisterTarget(name, doc string, target Target, opts ...RegisterOption) (Target, error) {
+	return con.Register(name, target, append([]RegisterOption{WithDoc(doc)}, opts...)...)
+}
+
+// RegisterOption is the type of an option to [Controller.Register].
+type RegisterOption func(*targetRegistryTuple)
+
+// WithDoc is a [RegisterOption] giving a target a doc string,
+// which is shown by "fab -list."
+func WithDoc(doc string) RegisterOption {
+	return func(tuple *targetRegistryTuple) {
+		tuple.doc = doc
+	}
+}
+
+// WithHidden is a [RegisterOption] that omits a target from "fab -list"
+// (see [Controller.ListTargets] and [Controller.ListTargetsJSON]),
+// e.g. because it is a helper for other targets.
+// It can still be run by name.
+func WithHidden() RegisterOption {
+	return func(tuple *targetRegistryTuple) {
+		tuple.hidden = true
+	}
+}
+
+// WithAliases is a [RegisterOption] giving a target short names
+// by which it can also be run.
+// See [Controller.SetAlias].
+func WithAliases(aliases ...string) RegisterOption {
+	return func(tuple *targetRegistryTuple) {
+		tuple.aliases = append(tuple.aliases, aliases...)
+	}
+}
+
 func targetAddr(target Target) (uintptr, error) {
 	v := reflect.ValueOf(target)
 	if v.Kind() != reflect.Pointer {
@@ -34,8 +89,11 @@ func targetAddr(target Target) (uintptr, error) {
 }
 
 type targetRegistryTuple struct {
-	target    Target
-	name, doc string
+	target        Target
+	name, doc     string
+	tags, aliases []string
+	hidden        bool
+	params        []Param
 }
 
 // RegistryNames returns the names in the target registry.
@@ -47,6 +105,21 @@ func (con *Controller) RegistryNames() []string {
 	return keys
 }
 
+// listedNames returns the names in the target registry
+// that are not hidden (see [WithHidden]).
+func (con *Controller) listedNames() []string {
+	var result []string
+	for _, name := range con.RegistryNames() {
+		con.mu.Lock()
+		hidden := con.targetsByName[name].hidden
+		con.mu.Unlock()
+		if !hidden {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
 // RegistryTarget returns the target in the registry with the given name,
 // and its doc string.
 func (con *Controller) RegistryTarget(name string) (Target, string) {
@@ -1,7 +1,9 @@
 package fab
 
 import (
+	"bytes"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -57,3 +59,66 @@ func TestDescribe(t *testing.T) {
 		t.Errorf("got %s, want countTarget", got)
 	}
 }
+
+func TestRegisterOptions(t *testing.T) {
+	t.Parallel()
+
+	con := NewController("")
+
+	if _, err := con.Register("Build", &countTarget{}, WithDoc("Build it."), WithAliases("b")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := con.Register("helper", &countTarget{}, WithHidden()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, doc := con.RegistryTarget("Build"); doc != "Build it." {
+		t.Errorf(`got doc "%s", want "Build it."`, doc)
+	}
+	if name, ok := con.alias("b"); !ok || name != "Build" {
+		t.Errorf("got alias b -> %s (%v), want Build", name, ok)
+	}
+	if target, _ := con.RegistryTarget("helper"); target == nil {
+		t.Error("hidden target not in registry")
+	}
+
+	buf := new(bytes.Buffer)
+	con.ListTargets(buf)
+	if want := "Build\n    Build it.\n\nAliases:\n    b -> Build\n"; buf.String() != want {
+		t.Errorf("got listing %q, want %q", buf.String(), want)
+	}
+}
+
+func TestRegisterYAMLOptions(t *testing.T) {
+	t.Parallel()
+
+	const yml = `
+# Comment doc.
+Lint:
+  Doc: Run the linters.
+  Aliases: l
+  Hidden: false
+  Target: !Command
+    Shell: "true"
+
+Helper:
+  Hidden: true
+  Target: !Command
+    Shell: "true"
+`
+
+	con := NewController("")
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, doc := con.RegistryTarget("Lint"); doc != "Run the linters." {
+		t.Errorf(`got doc "%s", want "Run the linters."`, doc)
+	}
+	if name, _ := con.alias("l"); name != "Lint" {
+		t.Errorf("got alias l -> %s, want Lint", name)
+	}
+	if got, want := con.listedNames(), []string{"Lint"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got listed names %v, want %v", got, want)
+	}
+}
@@ -1,6 +1,9 @@
 package fab
 
-import "sync"
+import (
+	"sort"
+	"sync"
+)
 
 type registry[T any] struct {
 	mu    sync.Mutex
@@ -23,3 +26,14 @@ func (r *registry[T]) lookup(name string) (T, bool) {
 	r.mu.Unlock()
 	return val, ok
 }
+
+func (r *registry[T]) names() []string {
+	r.mu.Lock()
+	result := make([]string, 0, len(r.items))
+	for name := range r.items {
+		result = append(result, name)
+	}
+	r.mu.Unlock()
+	sort.Strings(result)
+	return result
+}
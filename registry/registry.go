@@ -0,0 +1,113 @@
+// Package registry describes the YAML tags available in fab.yaml files,
+// for tools such as schema generators, documentation sites, and editor plugins.
+//
+// The tags are the ones registered with fab.RegisterYAMLTarget and fab.RegisterYAMLStringList
+// by the packages linked into the program.
+// The tags of the fab package itself,
+// such as !Command and !Files,
+// are always present.
+// Those of subpackages,
+// such as !go.Binary,
+// are present only when those packages are imported,
+// e.g. with
+//
+//	import _ "github.com/bobg/fab/golang"
+//
+// This package's API is stable:
+// it will change only in backward-compatible ways.
+package registry
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bobg/fab"
+)
+
+// Kind is the kind of a YAML [Tag].
+type Kind int
+
+const (
+	// Target is the kind of a tag that introduces a target,
+	// registered with fab.RegisterYAMLTarget.
+	Target Kind = iota + 1
+
+	// StringList is the kind of a tag that introduces a list of strings,
+	// registered with fab.RegisterYAMLStringList.
+	StringList
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Target:
+		return "target"
+	case StringList:
+		return "string list"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Tag describes a YAML tag,
+// such as !Command.
+type Tag struct {
+	// Name is the name of the tag,
+	// without the leading !.
+	Name string
+
+	Kind Kind
+
+	// Doc is a one-sentence description of the tag
+	// (see fab.SetYAMLTagDoc).
+	// It may be empty.
+	Doc string
+}
+
+// Registry is a source of YAML tags.
+type Registry interface {
+	// Tags returns all the tags in the registry,
+	// sorted by name,
+	// and with target tags before string-list tags of the same name.
+	Tags() []Tag
+
+	// Lookup returns the tag with the given name and kind,
+	// and a boolean telling whether there is one.
+	Lookup(name string, kind Kind) (Tag, bool)
+}
+
+// Default is the [Registry] of the tags registered with the fab package.
+var Default Registry = fabRegistry{}
+
+// Tags returns the tags in the [Default] registry.
+func Tags() []Tag {
+	return Default.Tags()
+}
+
+// Lookup looks up a tag in the [Default] registry.
+func Lookup(name string, kind Kind) (Tag, bool) {
+	return Default.Lookup(name, kind)
+}
+
+type fabRegistry struct{}
+
+func (fabRegistry) Tags() []Tag {
+	var result []Tag
+	for _, name := range fab.YAMLTargetTags() {
+		result = append(result, Tag{Name: name, Kind: Target, Doc: fab.YAMLTagDoc(name)})
+	}
+	for _, name := range fab.YAMLStringListTags() {
+		result = append(result, Tag{Name: name, Kind: StringList, Doc: fab.YAMLTagDoc(name)})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func (r fabRegistry) Lookup(name string, kind Kind) (Tag, bool) {
+	for _, tag := range r.Tags() {
+		if tag.Name == name && tag.Kind == kind {
+			return tag, true
+		}
+	}
+	return Tag{}, false
+}
@@ -0,0 +1,52 @@
+package registry_test
+
+import (
+	"testing"
+
+	_ "github.com/bobg/fab/golang"
+	. "github.com/bobg/fab/registry"
+)
+
+func TestTags(t *testing.T) {
+	tags := Tags()
+
+	for i := 1; i < len(tags); i++ {
+		if tags[i-1].Name > tags[i].Name {
+			t.Errorf("tags %s and %s are out of order", tags[i-1].Name, tags[i].Name)
+		}
+	}
+
+	for _, tag := range tags {
+		if tag.Doc == "" {
+			t.Errorf("tag %s has no doc", tag.Name)
+		}
+	}
+
+	cases := []struct {
+		name string
+		kind Kind
+		ok   bool
+	}{{
+		name: "Command", kind: Target, ok: true,
+	}, {
+		name: "Glob", kind: StringList, ok: true,
+	}, {
+		name: "Glob", kind: Target,
+	}, {
+		name: "go.Binary", kind: Target, ok: true,
+	}, {
+		name: "go.Deps", kind: StringList, ok: true,
+	}, {
+		name: "NoSuchTag", kind: Target,
+	}}
+	for _, tc := range cases {
+		tag, ok := Lookup(tc.name, tc.kind)
+		if ok != tc.ok {
+			t.Errorf("Lookup(%s, %s): got %v, want %v", tc.name, tc.kind, ok, tc.ok)
+			continue
+		}
+		if ok && (tag.Name != tc.name || tag.Kind != tc.kind) {
+			t.Errorf("Lookup(%s, %s): got %+v", tc.name, tc.kind, tag)
+		}
+	}
+}
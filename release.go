@@ -0,0 +1,402 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Release is a target type for cutting a new release of a project
+// whose history is in a git repository
+// and whose commit messages follow the Conventional Commits convention
+// (see https://www.conventionalcommits.org/).
+//
+// When it runs,
+// it finds the most recent version tag
+// (one of the form vX.Y.Z)
+// and examines the commits made since then.
+// The next version is computed from them:
+// a breaking change
+// (a commit type ending in "!", or a "BREAKING CHANGE" footer)
+// bumps the major version,
+// a "feat" commit bumps the minor version,
+// and a "fix" or "perf" commit bumps the patch version.
+// If there are no such commits,
+// there is nothing to release and the target does nothing.
+//
+// Otherwise a section for the new version,
+// listing the commits,
+// is added to the top of Changelog,
+// and the version number in each of VersionFiles is updated.
+// These files are the declared outputs of a Release target.
+// If Tag is true,
+// those files are then committed,
+// and the new commit is tagged with the new version.
+//
+// In dry-run mode (see [WithDryRun]),
+// the new version and changelog section are printed
+// but nothing is changed.
+//
+// A Release target may be specified in YAML using the !Release tag,
+// which introduces a mapping whose fields are:
+//
+//   - Dir: the directory of the git repository,
+//     either absolute or relative to the directory containing the YAML file
+//   - Changelog: the changelog file, relative to Dir
+//   - VersionFiles: a list of files containing version numbers, relative to Dir
+//   - Tag: a boolean, true for committing and tagging the release
+type Release struct {
+	// Dir is the directory of the git repository.
+	// The default is the current directory.
+	Dir string `json:"dir,omitempty"`
+
+	// Changelog is the name of the changelog file,
+	// relative to Dir.
+	// If it is empty,
+	// no changelog is written.
+	Changelog string `json:"changelog,omitempty"`
+
+	// VersionFiles are files containing a version number to update,
+	// relative to Dir.
+	// The version number in each file is the first one following the word "version"
+	// (in any case)
+	// and an = or :,
+	// as in `const Version = "1.2.3"` or `version: 1.2.3`.
+	VersionFiles []string `json:"version_files,omitempty"`
+
+	// Tag tells whether to commit the changes to Changelog and VersionFiles
+	// and tag the result with the new version.
+	Tag bool `json:"tag,omitempty"`
+}
+
+var _ Target = &Release{}
+
+// Run implements Target.Run.
+func (r *Release) Run(ctx context.Context, con *Controller) error {
+	prevTag, err := r.git(ctx, "describe", "--tags", "--abbrev=0", "--match", "v[0-9]*")
+	if err != nil {
+		// No previous version tag.
+		prevTag = ""
+	}
+	prevTag = strings.TrimSpace(prevTag)
+
+	prev := Semver{}
+	if prevTag != "" {
+		if prev, err = ParseSemver(prevTag); err != nil {
+			return errors.Wrapf(err, "parsing tag %s", prevTag)
+		}
+	}
+
+	logArgs := []string{"log", "--format=%s%x1f%b%x1e"}
+	if prevTag != "" {
+		logArgs = append(logArgs, prevTag+"..HEAD")
+	}
+	logOut, err := r.git(ctx, logArgs...)
+	if err != nil {
+		return errors.Wrap(err, "getting commit log")
+	}
+
+	var commits []ConventionalCommit
+	for _, rec := range strings.Split(logOut, "\x1e") {
+		subject, body, _ := strings.Cut(strings.TrimSpace(rec), "\x1f")
+		if c, ok := ParseConventionalCommit(subject, body); ok {
+			commits = append(commits, c)
+		}
+	}
+
+	next, ok := NextVersion(prev, commits)
+	if !ok {
+		if GetVerbose(ctx) {
+			con.Indentf("  No releasable changes since %s", prevTag)
+		}
+		return nil
+	}
+
+	section := ChangelogSection(next, time.Now(), commits)
+
+	if GetDryRun(ctx) {
+		con.Indentf("  Would release %s", next)
+		con.Indentf("%s", section)
+		return nil
+	}
+
+	if GetVerbose(ctx) {
+		con.Indentf("  Releasing %s", next)
+	}
+
+	var changed []string
+
+	if r.Changelog != "" {
+		if err = prependChangelog(r.path(r.Changelog), section); err != nil {
+			return errors.Wrapf(err, "updating %s", r.Changelog)
+		}
+		changed = append(changed, r.Changelog)
+	}
+
+	for _, vf := range r.VersionFiles {
+		if err = updateVersionFile(r.path(vf), next); err != nil {
+			return errors.Wrapf(err, "updating %s", vf)
+		}
+		changed = append(changed, vf)
+	}
+
+	if !r.Tag {
+		return nil
+	}
+
+	if len(changed) > 0 {
+		args := append([]string{"add", "--"}, changed...)
+		if _, err = r.git(ctx, args...); err != nil {
+			return errors.Wrap(err, "adding release changes")
+		}
+		args = append([]string{"commit", "-m", "Release " + next.String(), "--"}, changed...)
+		if _, err = r.git(ctx, args...); err != nil {
+			return errors.Wrap(err, "committing release")
+		}
+	}
+
+	_, err = r.git(ctx, "tag", "-a", next.String(), "-m", "Release "+next.String())
+	return errors.Wrapf(err, "tagging %s", next)
+}
+
+// Desc implements Target.Desc.
+func (*Release) Desc() string {
+	return "Release"
+}
+
+func (r *Release) path(name string) string {
+	return filepath.Join(r.Dir, name)
+}
+
+func (r *Release) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = r.Dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", CommandErr{Err: err, Output: stderr.Bytes()}
+	}
+	return string(out), nil
+}
+
+// Semver is a semantic version number (see https://semver.org/).
+// Pre-release and build suffixes are not supported.
+type Semver struct {
+	Major, Minor, Patch int
+}
+
+// String produces the version number in the form vX.Y.Z.
+func (v Semver) String() string {
+	return fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+var semverRegex = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)$`)
+
+// ParseSemver parses a version number of the form X.Y.Z or vX.Y.Z.
+func ParseSemver(s string) (Semver, error) {
+	m := semverRegex.FindStringSubmatch(s)
+	if m == nil {
+		return Semver{}, fmt.Errorf("malformed version number %s", s)
+	}
+	var result Semver
+	for i, p := range []*int{&result.Major, &result.Minor, &result.Patch} {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return Semver{}, errors.Wrapf(err, "in version number %s", s)
+		}
+		*p = n
+	}
+	return result, nil
+}
+
+// ConventionalCommit is a parsed commit message
+// following the Conventional Commits convention.
+type ConventionalCommit struct {
+	Type        string // e.g. "feat" or "fix"
+	Scope       string // the optional parenthesized scope following the type
+	Description string // the rest of the subject line
+	Breaking    bool
+}
+
+var conventionalRegex = regexp.MustCompile(`^([a-zA-Z]+)(?:\(([^)]*)\))?(!)?:\s*(.*)$`)
+
+// ParseConventionalCommit parses a commit's subject line and body.
+// The boolean result is false if the subject does not follow the convention.
+func ParseConventionalCommit(subject, body string) (ConventionalCommit, bool) {
+	m := conventionalRegex.FindStringSubmatch(strings.TrimSpace(subject))
+	if m == nil {
+		return ConventionalCommit{}, false
+	}
+	return ConventionalCommit{
+		Type:        strings.ToLower(m[1]),
+		Scope:       m[2],
+		Description: m[4],
+		Breaking:    m[3] == "!" || strings.Contains(body, "BREAKING CHANGE:") || strings.Contains(body, "BREAKING-CHANGE:"),
+	}, true
+}
+
+// NextVersion computes the version following prev given the commits since prev.
+// The boolean result is false if none of the commits calls for a new version.
+func NextVersion(prev Semver, commits []ConventionalCommit) (Semver, bool) {
+	var major, minor, patch bool
+	for _, c := range commits {
+		switch {
+		case c.Breaking:
+			major = true
+		case c.Type == "feat":
+			minor = true
+		case c.Type == "fix" || c.Type == "perf":
+			patch = true
+		}
+	}
+
+	switch {
+	case major:
+		return Semver{Major: prev.Major + 1}, true
+	case minor:
+		return Semver{Major: prev.Major, Minor: prev.Minor + 1}, true
+	case patch:
+		return Semver{Major: prev.Major, Minor: prev.Minor, Patch: prev.Patch + 1}, true
+	}
+	return prev, false
+}
+
+// ChangelogSection produces the Markdown changelog section for a new version.
+func ChangelogSection(v Semver, when time.Time, commits []ConventionalCommit) string {
+	groups := []struct {
+		title string
+		pred  func(ConventionalCommit) bool
+	}{{
+		title: "Breaking changes",
+		pred:  func(c ConventionalCommit) bool { return c.Breaking },
+	}, {
+		title: "Features",
+		pred:  func(c ConventionalCommit) bool { return !c.Breaking && c.Type == "feat" },
+	}, {
+		title: "Fixes",
+		pred:  func(c ConventionalCommit) bool { return !c.Breaking && (c.Type == "fix" || c.Type == "perf") },
+	}}
+
+	buf := new(strings.Builder)
+	fmt.Fprintf(buf, "## %s (%s)\n", v, when.Format("2006-01-02"))
+	for _, g := range groups {
+		var lines []string
+		for _, c := range commits {
+			if !g.pred(c) {
+				continue
+			}
+			line := "- "
+			if c.Scope != "" {
+				line += "**" + c.Scope + ":** "
+			}
+			lines = append(lines, line+c.Description)
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(buf, "\n### %s\n\n%s\n", g.title, strings.Join(lines, "\n"))
+	}
+	return buf.String()
+}
+
+// prependChangelog adds section to the top of the changelog file,
+// after its title if it has one.
+func prependChangelog(filename, section string) error {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		data = []byte("# Changelog\n")
+	} else if err != nil {
+		return err
+	}
+
+	var title, rest []byte
+	if bytes.HasPrefix(data, []byte("# ")) {
+		if idx := bytes.IndexByte(data, '\n'); idx >= 0 {
+			title, rest = data[:idx+1], bytes.TrimLeft(data[idx+1:], "\n")
+		} else {
+			title = append(data, '\n')
+		}
+	} else {
+		rest = data
+	}
+
+	buf := new(bytes.Buffer)
+	if len(title) > 0 {
+		buf.Write(title)
+		buf.WriteString("\n")
+	}
+	buf.WriteString(section)
+	if len(rest) > 0 {
+		buf.WriteString("\n")
+		buf.Write(rest)
+	}
+	return os.WriteFile(filename, buf.Bytes(), 0644)
+}
+
+var versionLineRegex = regexp.MustCompile(`((?i:version)\s*[:=]\s*["']?v?)\d+\.\d+\.\d+`)
+
+func updateVersionFile(filename string, v Semver) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	loc := versionLineRegex.FindSubmatchIndex(data)
+	if loc == nil {
+		return fmt.Errorf("no version number found")
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Write(data[:loc[3]]) // through the end of the prefix group
+	fmt.Fprintf(buf, "%d.%d.%d", v.Major, v.Minor, v.Patch)
+	buf.Write(data[loc[1]:])
+
+	return os.WriteFile(filename, buf.Bytes(), info.Mode().Perm())
+}
+
+func releaseDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var yrelease struct {
+		Dir          string    `yaml:"Dir"`
+		Changelog    string    `yaml:"Changelog"`
+		VersionFiles yaml.Node `yaml:"VersionFiles"`
+		Tag          bool      `yaml:"Tag"`
+	}
+	if err := node.Decode(&yrelease); err != nil {
+		return nil, errors.Wrap(err, "YAML error in Release node")
+	}
+
+	versionFiles, err := con.YAMLStringList(&yrelease.VersionFiles, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Release.VersionFiles node")
+	}
+
+	return &Release{
+		Dir:          con.JoinPath(dir, yrelease.Dir),
+		Changelog:    yrelease.Changelog,
+		VersionFiles: versionFiles,
+		Tag:          yrelease.Tag,
+	}, nil
+}
+
+func init() {
+	RegisterYAMLTarget("Release", releaseDecoder)
+	SetYAMLTagDoc("Release", "Cut a new release of the project, tagging it with the next semantic version.")
+}
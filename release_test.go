@@ -0,0 +1,168 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNextVersion(t *testing.T) {
+	t.Parallel()
+
+	prev := Semver{Major: 1, Minor: 2, Patch: 3}
+
+	cases := []struct {
+		subjects []string
+		want     Semver
+		wantOK   bool
+	}{{
+		subjects: []string{"docs: typo", "chore: tidy"},
+		want:     prev,
+	}, {
+		subjects: []string{"fix: crash", "docs: typo"},
+		want:     Semver{Major: 1, Minor: 2, Patch: 4},
+		wantOK:   true,
+	}, {
+		subjects: []string{"fix: crash", "feat(cli): new flag"},
+		want:     Semver{Major: 1, Minor: 3},
+		wantOK:   true,
+	}, {
+		subjects: []string{"feat!: new API", "fix: crash"},
+		want:     Semver{Major: 2},
+		wantOK:   true,
+	}, {
+		subjects: []string{"Not conventional"},
+		want:     prev,
+	}}
+
+	for i, tc := range cases {
+		var commits []ConventionalCommit
+		for _, s := range tc.subjects {
+			if c, ok := ParseConventionalCommit(s, ""); ok {
+				commits = append(commits, c)
+			}
+		}
+		got, ok := NextVersion(prev, commits)
+		if ok != tc.wantOK {
+			t.Errorf("case %d: got ok %v, want %v", i, ok, tc.wantOK)
+		}
+		if got != tc.want {
+			t.Errorf("case %d: got %s, want %s", i, got, tc.want)
+		}
+	}
+}
+
+func TestParseConventionalCommit(t *testing.T) {
+	t.Parallel()
+
+	got, ok := ParseConventionalCommit("feat(yaml): add tags", "Details.\n\nBREAKING CHANGE: old tags removed")
+	if !ok {
+		t.Fatal("not parsed")
+	}
+	want := ConventionalCommit{Type: "feat", Scope: "yaml", Description: "add tags", Breaking: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	git := func(args ...string) string {
+		t.Helper()
+
+		cmd := exec.Command("git", args...)
+		cmd.Dir = tmpdir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+		}
+		return string(out)
+	}
+
+	versionFile := filepath.Join(tmpdir, "version.go")
+	if err = os.WriteFile(versionFile, []byte("package x\n\nconst Version = \"1.0.0\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	git("init", "-q")
+	git("config", "user.name", "Test")
+	git("config", "user.email", "test@example.com")
+	git("add", "version.go")
+	git("commit", "-q", "-m", "chore: initial")
+	git("tag", "v1.0.0")
+	git("commit", "-q", "--allow-empty", "-m", "fix(parser): handle empty input")
+	git("commit", "-q", "--allow-empty", "-m", "feat: add widgets")
+
+	var (
+		r = &Release{
+			Dir:          tmpdir,
+			Changelog:    "CHANGELOG.md",
+			VersionFiles: []string{"version.go"},
+			Tag:          true,
+		}
+		ctx = WithVerbose(context.Background(), testing.Verbose())
+	)
+
+	t.Run("dryrun", func(t *testing.T) {
+		con := NewController("")
+		if err := con.Run(WithDryRun(ctx, true), r); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(tmpdir, "CHANGELOG.md")); !os.IsNotExist(err) {
+			t.Errorf("changelog exists after dry run (err %v)", err)
+		}
+	})
+
+	t.Run("release", func(t *testing.T) {
+		con := NewController("")
+		if err := con.Run(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := os.ReadFile(versionFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "package x\n\nconst Version = \"1.1.0\"\n"; string(got) != want {
+			t.Errorf("got version file %q, want %q", string(got), want)
+		}
+
+		got, err = os.ReadFile(filepath.Join(tmpdir, "CHANGELOG.md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "# Changelog\n\n" + ChangelogSection(Semver{Major: 1, Minor: 1}, time.Now(), []ConventionalCommit{
+			{Type: "feat", Description: "add widgets"},
+			{Type: "fix", Scope: "parser", Description: "handle empty input"},
+		})
+		if string(got) != want {
+			t.Errorf("got changelog %q, want %q", string(got), want)
+		}
+
+		if tag := strings.TrimSpace(git("describe", "--tags")); tag != "v1.1.0" {
+			t.Errorf("got tag %s, want v1.1.0", tag)
+		}
+	})
+
+	t.Run("nothing_to_release", func(t *testing.T) {
+		con := NewController("")
+		if err := con.Run(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+		if tag := strings.TrimSpace(git("describe", "--tags")); tag != "v1.1.0" {
+			t.Errorf("got tag %s, want v1.1.0", tag)
+		}
+	})
+}
@@ -0,0 +1,242 @@
+package fab
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+)
+
+// Remote describes a remote host on which to run targets.
+// See [Controller.RunRemote].
+type Remote struct {
+	// Host is the remote host,
+	// in any form understood by ssh and rsync
+	// (e.g. builder01 or user@builder01).
+	Host string
+
+	// Dir is the directory on the remote host
+	// into which the project is copied.
+	// If it is relative,
+	// it is relative to the remote user's home directory.
+	// The default is fab-remote/BASENAME,
+	// where BASENAME is the last element of the project's top directory.
+	Dir string
+
+	// Fab is the fab command to run on the remote host.
+	// The default is "fab".
+	Fab string
+
+	// SSH is the ssh command to use.
+	// The default is "ssh".
+	SSH string
+
+	// Rsync is the rsync command to use.
+	// The default is "rsync".
+	Rsync string
+}
+
+// RunRemote runs targets on a remote host.
+// It works like this:
+//
+//   - the inputs of the [Files] targets among the given targets and their subtargets,
+//     plus the project's YAML files,
+//     its _fab directory,
+//     and its go.mod and go.sum files,
+//     are copied to the remote host with rsync;
+//   - fab is run on the remote host with ssh,
+//     with the given command-line args;
+//   - the outputs of the Files targets are copied back with rsync.
+//
+// Only declared inputs are copied,
+// so any target that reads undeclared files
+// will not find them on the remote host.
+//
+// This requires ssh and rsync on the local host,
+// and rsync and fab on the remote host.
+func (con *Controller) RunRemote(ctx context.Context, r Remote, args []string, targets ...Target) error {
+	if r.Host == "" {
+		return fmt.Errorf("no remote host")
+	}
+
+	topdir, err := filepath.Abs(con.JoinPath())
+	if err != nil {
+		return errors.Wrap(err, "getting absolute path of top directory")
+	}
+
+	if r.Dir == "" {
+		r.Dir = filepath.Join("fab-remote", filepath.Base(topdir))
+	}
+	if r.Fab == "" {
+		r.Fab = "fab"
+	}
+	if r.SSH == "" {
+		r.SSH = "ssh"
+	}
+	if r.Rsync == "" {
+		r.Rsync = "rsync"
+	}
+
+	ins, outs, err := con.remoteFiles(topdir, targets)
+	if err != nil {
+		return err
+	}
+
+	fabArgs := []string{r.Fab}
+	if GetVerbose(ctx) {
+		fabArgs = append(fabArgs, "-v")
+	}
+	if GetForce(ctx) {
+		fabArgs = append(fabArgs, "-f")
+	}
+	fabArgs = append(fabArgs, args...)
+
+	var (
+		remoteDir = r.Host + ":" + r.Dir + "/"
+		mkdirCmd  = exec.CommandContext(ctx, r.SSH, r.Host, "mkdir -p "+shellQuote(r.Dir))
+		pushCmd   = exec.CommandContext(ctx, r.Rsync, "-a", "-r", "--relative", "--files-from=-", "-e", r.SSH, topdir+"/", remoteDir)
+		runCmd    = exec.CommandContext(ctx, r.SSH, r.Host, "cd "+shellQuote(r.Dir)+" && "+shellJoin(fabArgs))
+		pullCmd   = exec.CommandContext(ctx, r.Rsync, "-a", "-r", "--relative", "--files-from=-", "--ignore-missing-args", "-e", r.SSH, remoteDir, topdir+"/")
+	)
+
+	if GetDryRun(ctx) {
+		if GetVerbose(ctx) {
+			con.Indentf("Would copy %d input(s) to %s", len(ins), remoteDir)
+			con.Indentf("Would run %s", runCmd)
+			con.Indentf("Would copy %d output(s) from %s", len(outs), remoteDir)
+		}
+		return nil
+	}
+
+	if GetVerbose(ctx) {
+		con.Indentf("Copying %d input(s) to %s", len(ins), remoteDir)
+	}
+	if out, err := mkdirCmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(CommandErr{Err: err, Output: out}, "creating %s", remoteDir)
+	}
+	pushCmd.Stdin = strings.NewReader(strings.Join(ins, "\n") + "\n")
+	if out, err := pushCmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(CommandErr{Err: err, Output: out}, "copying inputs to %s", remoteDir)
+	}
+
+	if GetVerbose(ctx) {
+		con.Indentf("Running %s", runCmd)
+	}
+	runCmd.Stdout, runCmd.Stderr = os.Stdout, os.Stderr
+	if err := runCmd.Run(); err != nil {
+		return errors.Wrapf(err, "running fab on %s", r.Host)
+	}
+
+	if len(outs) == 0 {
+		return nil
+	}
+	if GetVerbose(ctx) {
+		con.Indentf("Copying %d output(s) from %s", len(outs), remoteDir)
+	}
+	pullCmd.Stdin = strings.NewReader(strings.Join(outs, "\n") + "\n")
+	if out, err := pullCmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(CommandErr{Err: err, Output: out}, "copying outputs from %s", remoteDir)
+	}
+
+	return nil
+}
+
+// remoteFiles computes the files to copy to and from the remote host in RunRemote,
+// relative to topdir.
+func (con *Controller) remoteFiles(topdir string, targets []Target) (ins, outs []string, err error) {
+	var (
+		inSet  = set.New[string]()
+		outSet = set.New[string]()
+	)
+
+	add := func(s set.Of[string], file string) error {
+		file, err := filepath.Abs(file)
+		if err != nil {
+			return errors.Wrapf(err, "getting absolute path of %s", file)
+		}
+		rel, err := filepath.Rel(topdir, file)
+		if err != nil {
+			return errors.Wrapf(err, "getting relative path to %s", file)
+		}
+		if rel == ".." || strings.HasPrefix(rel, "../") {
+			return fmt.Errorf("file %s is outside the top directory", file)
+		}
+		s.Add(rel)
+		return nil
+	}
+
+	err = con.walk(targets, func(target Target) error {
+		ft, ok := target.(*files)
+		if !ok {
+			return nil
+		}
+		for _, in := range ft.In {
+			if err := add(inSet, in); err != nil {
+				return err
+			}
+		}
+		for _, out := range ft.Out {
+			if err := add(outSet, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	con.mu.Lock()
+	yamlFiles := con.yamlFiles.Slice()
+	con.mu.Unlock()
+
+	for _, file := range yamlFiles {
+		if err := add(inSet, file); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, file := range []string{"go.mod", "go.sum"} {
+		if _, err := os.Stat(filepath.Join(topdir, file)); err == nil {
+			inSet.Add(file)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, errors.Wrapf(err, "statting %s", file)
+		}
+	}
+	fabDirs, err := fabPackageDirs(topdir)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "finding _fab dirs")
+	}
+	inSet.Add(fabDirs...)
+
+	// Inputs produced by other targets needn't be copied.
+	inSet = set.Diff(inSet, outSet)
+
+	ins, outs = inSet.Slice(), outSet.Slice()
+	sort.Strings(ins)
+	sort.Strings(outs)
+
+	return ins, outs, nil
+}
+
+// shellQuote quotes s for use as a single word in a POSIX shell command.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:@,+") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func shellJoin(words []string) string {
+	quoted := make([]string, 0, len(words))
+	for _, w := range words {
+		quoted = append(quoted, shellQuote(w))
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,144 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// These stand-ins for ssh and rsync operate on the local host,
+// ignoring the remote host name.
+const (
+	fakeSSH = `#!/bin/sh
+shift
+exec sh -c "$*"
+`
+
+	fakeRsync = `#!/bin/sh
+src= dst=
+for a in "$@"; do src=$dst; dst=$a; done
+src=${src#*:} dst=${dst#*:}
+while read -r f; do
+  [ -e "$src/$f" ] || continue
+  mkdir -p "$dst/$(dirname "$f")"
+  cp -R "$src/$f" "$dst/$f"
+done
+`
+
+	// The remote fab copies in to out and records its arguments.
+	fakeFab = `#!/bin/sh
+echo "$@" > args
+cp sub/in sub/out
+`
+)
+
+func TestRunRemote(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		localdir  = filepath.Join(tmpdir, "local")
+		remotedir = filepath.Join(tmpdir, "remote")
+		bindir    = filepath.Join(tmpdir, "bin")
+	)
+	for _, dir := range []string{filepath.Join(localdir, "sub"), remotedir, bindir} {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scripts := map[string]string{"ssh": fakeSSH, "rsync": fakeRsync, "fab": fakeFab}
+	for name, script := range scripts {
+		if err = os.WriteFile(filepath.Join(bindir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const yml = `
+Copy: !Files
+  In: [sub/in]
+  Out: [sub/out]
+  Target: !Command
+    Shell: cp sub/in sub/out
+`
+	files := map[string]string{
+		"fab.yaml":  yml,
+		"sub/in":    "hello",
+		"unrelated": "not copied",
+	}
+	for name, content := range files {
+		if err = os.WriteFile(filepath.Join(localdir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	con := NewController(localdir)
+	if err = con.ReadYAMLFile(""); err != nil {
+		t.Fatal(err)
+	}
+	target, _ := con.RegistryTarget("Copy")
+
+	ins, outs, err := con.remoteFiles(localdir, []Target{target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"fab.yaml", "sub/in"}; !reflect.DeepEqual(ins, want) {
+		t.Errorf("got inputs %v, want %v", ins, want)
+	}
+	if want := []string{"sub/out"}; !reflect.DeepEqual(outs, want) {
+		t.Errorf("got outputs %v, want %v", outs, want)
+	}
+
+	r := Remote{
+		Host:  "builder01",
+		Dir:   remotedir,
+		Fab:   filepath.Join(bindir, "fab"),
+		SSH:   filepath.Join(bindir, "ssh"),
+		Rsync: filepath.Join(bindir, "rsync"),
+	}
+	ctx := context.Background()
+	if err = con.RunRemote(ctx, r, []string{"X=it's", "Copy"}, target); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(path, want string) {
+		t.Helper()
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("got %q in %s, want %q", string(got), path, want)
+		}
+	}
+
+	check(filepath.Join(remotedir, "args"), "X=it's Copy\n")
+	check(filepath.Join(localdir, "sub", "out"), "hello")
+
+	if _, err := os.Stat(filepath.Join(remotedir, "unrelated")); !os.IsNotExist(err) {
+		t.Errorf("unrelated file was copied to the remote host (err is %v)", err)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"foo/bar.go": "foo/bar.go",
+		"":           "''",
+		"a b":        "'a b'",
+		"it's":       `'it'\''s'`,
+	}
+	for in, want := range cases {
+		if got := shellQuote(in); got != want {
+			t.Errorf("shellQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package fab
+
+import (
+	"context"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+// Result is a record of one target's run by a [Controller].
+// See [Controller.RunWithResults] and [Controller.Results].
+type Result struct {
+	Target Target
+	Name   string // as produced by [Controller.Describe]
+	Status Status
+
+	// Queued is the time from the request to run the target
+	// until it started running.
+	Queued time.Duration
+
+	// Start is when the target started running,
+	// and Duration is how long it took.
+	// For a target with subtargets,
+	// this includes the time spent in its subtargets.
+	Start    time.Time
+	Duration time.Duration
+
+	// Outputs are the output files of a [Files] target.
+	Outputs []string
+
+	Err error
+}
+
+// Status is the status of a finished target in a [Result].
+type Status string
+
+// Values for Status.
+const (
+	// StatusRan means the target ran successfully.
+	StatusRan Status = "ran"
+
+	// StatusCached means the target was a [Files] target
+	// found to be up to date,
+	// or whose outputs were restored from an [ArtifactStore].
+	StatusCached Status = "cached"
+
+	// StatusFailed means the target ran and produced an error.
+	StatusFailed Status = "failed"
+
+	// StatusSkipped means the target did not run
+	// because another target failed.
+	// It was a [Files] target whose input files were produced by a failing target,
+	// a later step in a [Seq] whose earlier step failed,
+	// or a target not started after a failure
+	// (see [ErrNotStarted]).
+	StatusSkipped Status = "skipped"
+)
+
+// RunWithResults is like [Controller.Run]
+// but additionally returns a [Result] for each target
+// that ran (or was skipped) during the call,
+// including subtargets,
+// in order of start time.
+// Targets that had already run in an earlier call are not included.
+func (con *Controller) RunWithResults(ctx context.Context, targets ...Target) ([]Result, error) {
+	before := con.ranSnapshot()
+	err := con.Run(ctx, targets...)
+	return con.results(before), err
+}
+
+// Results returns a [Result] for each target
+// that the controller has finished running
+// or has skipped,
+// in order of start time.
+func (con *Controller) Results() []Result {
+	return con.results(nil)
+}
+
+// results returns a Result for each finished target
+// whose address is not in skip.
+func (con *Controller) results(skip set.Of[uintptr]) []Result {
+	con.mu.Lock()
+	outcomes := make([]*outcome, 0, len(con.ran))
+	for addr, o := range con.ran {
+		if skip.Has(addr) {
+			continue
+		}
+		outcomes = append(outcomes, o)
+	}
+	for addr, o := range con.notRan {
+		if skip.Has(addr) {
+			continue
+		}
+		outcomes = append(outcomes, o)
+	}
+	con.mu.Unlock()
+
+	var result []Result
+	for _, o := range outcomes {
+		if !o.g.isOpen() || o.target == nil {
+			continue
+		}
+		r := Result{
+			Target:   o.target,
+			Name:     con.Describe(o.target),
+			Status:   StatusRan,
+			Queued:   o.start.Sub(o.requested),
+			Start:    o.start,
+			Duration: o.end.Sub(o.start),
+			Err:      o.err,
+		}
+		switch {
+		case o.err != nil && o.skipped:
+			r.Status = StatusSkipped
+		case o.err != nil:
+			r.Status = StatusFailed
+		case o.cached:
+			r.Status = StatusCached
+		}
+		if ft, ok := o.target.(*files); ok {
+			r.Outputs = ft.Out
+		}
+		result = append(result, r)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result
+}
+
+// setCached marks target as cached for the purpose of [Controller.Results].
+// It must be called while target is running.
+func (con *Controller) setCached(target Target) {
+	if o := con.runningOutcome(target); o != nil {
+		o.cached = true
+	}
+}
+
+// setSkipped marks target as skipped for the purpose of [Controller.Results].
+// It must be called while target is running.
+func (con *Controller) setSkipped(target Target) {
+	if o := con.runningOutcome(target); o != nil {
+		o.skipped = true
+	}
+}
+
+func (con *Controller) runningOutcome(target Target) *outcome {
+	addr, err := targetAddr(target)
+	if err != nil {
+		return nil
+	}
+
+	con.mu.Lock()
+	defer con.mu.Unlock()
+	return con.ran[addr]
+}
+
+// WriteSummary writes to w a summary of the given results
+// (e.g. from [Controller.Results]):
+// which targets failed,
+// which were skipped because other targets failed,
+// and which succeeded.
+// Only named targets (see [Controller.Describe]) are listed by name;
+// the others are only counted.
+func (con *Controller) WriteSummary(w io.Writer, results []Result) error {
+	var (
+		ew      = &errWriter{w: w}
+		named   = make(map[Status][]string)
+		unnamed = make(map[Status]int)
+	)
+	for _, r := range results {
+		status := r.Status
+		if status == StatusCached {
+			status = StatusRan
+		}
+		if con.isNamed(r.Target) {
+			named[status] = append(named[status], r.Name)
+		} else {
+			unnamed[status]++
+		}
+	}
+
+	ew.printf("Summary:\n")
+	for _, item := range []struct {
+		status Status
+		label  string
+	}{
+		{StatusFailed, "Failed"},
+		{StatusSkipped, "Skipped (another target failed)"},
+		{StatusRan, "Succeeded"},
+	} {
+		names := named[item.status]
+		n := len(names) + unnamed[item.status]
+		if n == 0 {
+			continue
+		}
+		sort.Strings(names)
+		ew.printf("  %s: %d\n", item.label, n)
+		for _, name := range names {
+			ew.printf("    %s\n", name)
+		}
+		if u := unnamed[item.status]; u > 0 && len(names) > 0 {
+			ew.printf("    (and %d unnamed)\n", u)
+		}
+	}
+	return ew.err
+}
+
+// isNamed tells whether target is in the registry.
+func (con *Controller) isNamed(target Target) bool {
+	addr, err := targetAddr(target)
+	if err != nil {
+		return false
+	}
+	con.mu.Lock()
+	defer con.mu.Unlock()
+	_, ok := con.targetsByAddr[addr]
+	return ok
+}
@@ -0,0 +1,118 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunWithResults(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		inpath  = filepath.Join(tmpdir, "in")
+		outpath = filepath.Join(tmpdir, "out")
+		cp      = Shellf("cp %s %s", inpath, outpath)
+		build   = Files(cp, []string{inpath}, []string{outpath})
+		con     = NewController(tmpdir)
+		ctx     = context.Background()
+	)
+	if err = os.WriteFile(inpath, []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := con.RunWithResults(ctx, build)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+
+	// The Files target starts before its subtarget.
+	if r := results[0]; r.Target != build || r.Status != StatusRan || !reflect.DeepEqual(r.Outputs, []string{outpath}) {
+		t.Errorf("got %+v for Files target", r)
+	}
+	if r := results[1]; r.Target != cp || r.Status != StatusRan || r.Outputs != nil {
+		t.Errorf("got %+v for Command target", r)
+	}
+	if results[0].Duration < results[1].Duration {
+		t.Errorf("Files target took %s, less than its subtarget's %s", results[0].Duration, results[1].Duration)
+	}
+
+	// Already run: no new results.
+	results, err = con.RunWithResults(ctx, build)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("got %d results on second run, want 0", len(results))
+	}
+	if got := len(con.Results()); got != 2 {
+		t.Errorf("got %d results in total, want 2", got)
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+
+	var (
+		con  = NewController(tmpdir)
+		ctx  = WithKeepGoing(context.Background(), true) // so OK runs even if Gen fails first
+		mid  = filepath.Join(tmpdir, "mid")
+		out  = filepath.Join(tmpdir, "out")
+		fail = &Command{Shell: "exit 1"}
+	)
+	gen, err := con.RegisterTarget("Gen", "", Files(fail, nil, []string{mid}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	build, err := con.RegisterTarget("Build", "", Files(&Command{Shell: "cp mid out", Dir: tmpdir}, []string{mid}, []string{out}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := con.RegisterTarget("OK", "", &Command{Shell: "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := con.Run(ctx, build, ok); err == nil {
+		t.Fatal("got no error")
+	}
+
+	statuses := make(map[Target]Status)
+	for _, r := range con.Results() {
+		statuses[r.Target] = r.Status
+	}
+	if statuses[gen] != StatusFailed || statuses[build] != StatusSkipped || statuses[ok] != StatusRan {
+		t.Errorf("got statuses Gen=%s Build=%s OK=%s", statuses[gen], statuses[build], statuses[ok])
+	}
+
+	var buf strings.Builder
+	if err := con.WriteSummary(&buf, con.Results()); err != nil {
+		t.Fatal(err)
+	}
+	const want = `Summary:
+  Failed: 2
+    Gen
+    (and 1 unnamed)
+  Skipped (another target failed): 1
+    Build
+  Succeeded: 1
+    OK
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
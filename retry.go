@@ -0,0 +1,221 @@
+package fab
+
+import (
+	"context"
+	"time"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// defaultRetryBackoff is the wait before the first retry
+	// of a [Command] with Retries.
+	defaultRetryBackoff = time.Second
+
+	// maxRetryBackoff caps the doubling of the wait between retries.
+	maxRetryBackoff = time.Minute
+)
+
+// Retry produces a target that runs a subtarget,
+// retrying it up to `retries` times if it fails.
+// It waits for `backoff` before the first retry,
+// doubling the wait before each subsequent one
+// (up to a limit of one minute).
+// It does not retry after ctx is canceled.
+//
+// Unlike [Flaky],
+// Retry keeps no record of failures.
+// It is intended for steps that fail for transient reasons,
+// such as network trouble.
+//
+// It is JSON-encodable
+// (and therefore usable as the subtarget in [Files])
+// if its subtarget is.
+//
+// A Retry target may be specified in YAML using the tag !Retry,
+// which introduces a mapping whose fields are:
+//
+//   - Target: the subtarget, or target name
+//   - Retries: the number of times to retry the subtarget after a failure
+//   - Backoff: a duration string as parsed by [time.ParseDuration], e.g. 5s (default 1s)
+func Retry(target Target, retries int, backoff time.Duration) Target {
+	return &retry{
+		Target:  target,
+		Retries: retries,
+		Backoff: backoff,
+	}
+}
+
+type retry struct {
+	Target  Target
+	Retries int
+	Backoff time.Duration
+}
+
+var _ Target = &retry{}
+
+// Run implements Target.Run.
+func (r *retry) Run(ctx context.Context, con *Controller) error {
+	return withRetries(ctx, con, r, r.Retries, r.Backoff, func() error {
+		snapshot := con.ranSnapshot()
+		err := con.Run(withFailureScope(ctx), r.Target)
+		if err != nil {
+			// Allow the subtarget (and any of its failed subtargets) to run again.
+			con.forgetFailures(snapshot)
+		}
+		return err
+	})
+}
+
+// Desc implements Target.Desc.
+func (*retry) Desc() string {
+	return "Retry"
+}
+
+// Children implements GraphChildren.
+func (r *retry) Children() []Target {
+	return []Target{r.Target}
+}
+
+// withRetries calls f,
+// calling it again up to `retries` more times while it fails,
+// with exponential backoff in between.
+func withRetries(ctx context.Context, con *Controller, target Target, retries int, backoff time.Duration, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt > retries || ctx.Err() != nil {
+			return err
+		}
+
+		if GetVerbose(ctx) {
+			con.Indentf("%s failed, retrying in %s (attempt %d of %d): %s", con.Describe(target), backoff, attempt+1, retries+1, err)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// Timeout produces a target that runs a subtarget
+// with a time limit.
+// When the time is up,
+// the context passed to the subtarget is canceled,
+// which interrupts any running [Command]
+// (see [WithGracePeriod]).
+//
+// It is JSON-encodable
+// (and therefore usable as the subtarget in [Files])
+// if its subtarget is.
+//
+// A Timeout target may be specified in YAML using the tag !Timeout,
+// which introduces a mapping whose fields are:
+//
+//   - Target: the subtarget, or target name
+//   - Timeout: a duration string as parsed by [time.ParseDuration], e.g. 10m
+func Timeout(target Target, timeout time.Duration) Target {
+	return &timeoutTarget{
+		Target:  target,
+		Timeout: timeout,
+	}
+}
+
+type timeoutTarget struct {
+	Target  Target
+	Timeout time.Duration
+}
+
+var _ Target = &timeoutTarget{}
+
+// Run implements Target.Run.
+func (t *timeoutTarget) Run(ctx context.Context, con *Controller) error {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+
+	err := con.Run(ctx, t.Target)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = errors.Wrapf(err, "timed out after %s", t.Timeout)
+	}
+	return err
+}
+
+// Desc implements Target.Desc.
+func (*timeoutTarget) Desc() string {
+	return "Timeout"
+}
+
+// Children implements GraphChildren.
+func (t *timeoutTarget) Children() []Target {
+	return []Target{t.Target}
+}
+
+func retryDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var yretry struct {
+		Target  yaml.Node `yaml:"Target"`
+		Retries int       `yaml:"Retries"`
+		Backoff string    `yaml:"Backoff"`
+	}
+	if err := node.Decode(&yretry); err != nil {
+		return nil, errors.Wrap(err, "YAML error in Retry node")
+	}
+
+	target, err := con.YAMLTarget(&yretry.Target, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Retry.Target node")
+	}
+
+	backoff := defaultRetryBackoff
+	if yretry.Backoff != "" {
+		if backoff, err = time.ParseDuration(yretry.Backoff); err != nil {
+			return nil, errors.Wrap(err, "parsing Retry.Backoff")
+		}
+	}
+
+	return Retry(target, yretry.Retries, backoff), nil
+}
+
+func timeoutDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var ytimeout struct {
+		Target  yaml.Node `yaml:"Target"`
+		Timeout string    `yaml:"Timeout"`
+	}
+	if err := node.Decode(&ytimeout); err != nil {
+		return nil, errors.Wrap(err, "YAML error in Timeout node")
+	}
+
+	target, err := con.YAMLTarget(&ytimeout.Target, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error in Timeout.Target node")
+	}
+
+	timeout, err := time.ParseDuration(ytimeout.Timeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing Timeout.Timeout")
+	}
+
+	return Timeout(target, timeout), nil
+}
+
+func init() {
+	RegisterYAMLTarget("Retry", retryDecoder)
+	SetYAMLTagDoc("Retry", "Run a target, retrying it when it fails.")
+	RegisterYAMLTarget("Timeout", timeoutDecoder)
+	SetYAMLTagDoc("Timeout", "Run a target with a time limit.")
+}
@@ -0,0 +1,120 @@
+package fab
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		failures, retries, wantRuns int
+		wantErr                     bool
+	}{{
+		failures: 2, retries: 2, wantRuns: 3,
+	}, {
+		failures: 3, retries: 2, wantRuns: 3, wantErr: true,
+	}, {
+		failures: 0, retries: 2, wantRuns: 1,
+	}} {
+		tc := tc
+		t.Run(fmt.Sprintf("failures_%d_retries_%d", tc.failures, tc.retries), func(t *testing.T) {
+			var (
+				runs   int
+				target = F(func(context.Context, *Controller) error {
+					runs++
+					if runs <= tc.failures {
+						return fmt.Errorf("failure %d", runs)
+					}
+					return nil
+				})
+				con = NewController("")
+			)
+			err := con.Run(ctx, Retry(target, tc.retries, time.Millisecond))
+			if tc.wantErr != (err != nil) {
+				t.Errorf("got error %v, want error: %v", err, tc.wantErr)
+			}
+			if runs != tc.wantRuns {
+				t.Errorf("got %d runs, want %d", runs, tc.wantRuns)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+
+	var (
+		con   = NewController("")
+		start = time.Now()
+	)
+	err := con.Run(context.Background(), Timeout(Shellf("sleep 10"), 50*time.Millisecond))
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	if !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("got error %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %s", elapsed)
+	}
+}
+
+func TestCommandRetriesAndTimeout(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	yml := fmt.Sprintf(`
+Retried: !Command
+  Shell: echo x >> %[1]s/count && [ $(wc -l < %[1]s/count) -ge 2 ]
+  Retries: 1
+
+Slow: !Command
+  Shell: sleep 10
+  Timeout: 50ms
+`, tmpdir)
+
+	con := NewController("")
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	retried, _ := con.RegistryTarget("Retried")
+	if c := retried.(*Command); c.Retries != 1 {
+		t.Errorf("got %d retries, want 1", c.Retries)
+	}
+	slow, _ := con.RegistryTarget("Slow")
+	if c := slow.(*Command); c.Timeout != 50*time.Millisecond {
+		t.Errorf("got timeout %s, want 50ms", c.Timeout)
+	}
+
+	ctx := context.Background()
+	if err := con.Run(ctx, retried); err != nil {
+		t.Error(err)
+	}
+	count, err := os.ReadFile(filepath.Join(tmpdir, "count"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs := strings.Count(string(count), "x"); runs != 2 {
+		t.Errorf("got %d runs, want 2", runs)
+	}
+
+	err = con.Run(ctx, slow)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("got error %v, want a timeout", err)
+	}
+}
@@ -5,16 +5,32 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/maps"
+	"github.com/bobg/go-generics/v2/set"
 )
 
 type outcome struct {
 	g   *gate
 	err error
+
+	// These fields are set before g is opened.
+	// See Controller.results.
+	target                Target
+	requested, start, end time.Time
+	cached                bool
+	skipped               bool
+
+	// cancel cancels the context of the running target.
+	// It is protected by the controller's mutex.
+	// See Controller.Cancel.
+	cancel context.CancelCauseFunc
 }
 
 func (con *Controller) incDepth() {
@@ -46,6 +62,32 @@ func (con *Controller) decDepth() {
 // it blocks until the first one completes,
 // then uses the first one's result.
 //
+// If a target depends on itself,
+// directly or through other targets,
+// the request that would complete the cycle
+// fails with a [CycleError]
+// instead of waiting forever.
+//
+// A target that would exceed one of the controller's [Limits]
+// fails with a [LimitError].
+//
+// Targets whose [Parallelizable] Parallel method returns false
+// are run one at a time,
+// in order.
+//
+// Normally, once a target fails,
+// targets not yet started
+// (in this call or in the calls nested inside it)
+// fail with [ErrNotStarted] instead of running,
+// while those already running are left to finish.
+// In "keep going" mode (see [WithKeepGoing]),
+// targets that don't depend on the failing one
+// are started and run to completion as usual.
+// In "fail fast" mode (see [WithFailFast]),
+// the first failure also cancels the context of the targets still running.
+// Since the failure of a subtarget is normally the failure of its parent too,
+// this stops the whole build promptly.
+//
 // This function waits for all goroutines to complete.
 // The return value may be an accumulation of multiple errors
 // produced with [errors.Join].
@@ -58,37 +100,87 @@ func (con *Controller) Run(ctx context.Context, targets ...Target) error {
 	defer con.decDepth()
 
 	var (
-		verbose = GetVerbose(ctx)
-		errs    = make([]error, len(targets))
-		wg      sync.WaitGroup
+		parent    = getRunning(ctx)
+		requested = time.Now()
+		errs      = make([]error, len(targets))
+		wg        sync.WaitGroup
+		serial    []func() // runs the targets that are not Parallelizable, see below
+		failFast  context.CancelCauseFunc
 	)
-	for i, target := range targets {
-		addr, err := targetAddr(target)
-		if err != nil {
-			errs[i] = err
-			continue
+	if GetFailFast(ctx) {
+		ctx, failFast = context.WithCancelCause(ctx)
+		defer failFast(nil)
+	}
+	failed := getFailed(ctx)
+	if failed == nil {
+		failed = new(atomic.Bool)
+		ctx = withFailed(ctx, failed)
+	}
+	fail := func(i int, err error) {
+		errs[i] = err
+		if err == nil {
+			return
 		}
-
+		if !GetKeepGoing(ctx) {
+			failed.Store(true)
+		}
+		if failFast != nil {
+			failFast(err)
+		}
+	}
+	for i, target := range targets {
 		i, target := i, target // Go loop-var pitfall
 
 		if d, ok := target.(*deferredResolutionTarget); ok {
 			// Short-circuit here to avoid some confusing extra output in verbose mode.
+			var err error
 			target, err = d.resolve(con)
 			if err != nil {
 				errs[i] = err
 				continue
 			}
+			con.emit(ctx, ProgressEvent{Kind: ProgressResolve, Target: target, Name: d.Name})
 		}
 
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
+		addr, err := targetAddr(target)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if err := con.checkDepth(ctx, target); err != nil {
+			errs[i] = err
+			continue
+		}
+
+		run := func() {
+			if failFast != nil && ctx.Err() != nil {
+				errs[i] = con.notStarted(target)
+				return
+			}
 
 			con.mu.Lock()
+			if err := con.addRunEdge(parent, target, addr); err != nil {
+				con.mu.Unlock()
+				errs[i] = err
+				return
+			}
+			defer con.removeRunEdge(parent, addr)
+
 			o, ok := con.ran[addr]
 			if !ok {
-				o = &outcome{g: newGate(false)}
+				if failed.Load() {
+					con.mu.Unlock()
+					errs[i] = con.notStarted(target)
+					return
+				}
+				if max := con.limits.MaxTargets; max > 0 && len(con.ran) >= max {
+					con.mu.Unlock()
+					errs[i] = con.limitError(ctx, "target count", max, target)
+					return
+				}
+				o = &outcome{g: newGate(false), target: target}
 				con.ran[addr] = o
+				delete(con.notRan, addr)
 			}
 			con.mu.Unlock()
 
@@ -96,20 +188,51 @@ func (con *Controller) Run(ctx context.Context, targets ...Target) error {
 				// This target was launched in a different goroutine.
 				// Wait for it to produce a result.
 				o.g.wait()
-				errs[i] = o.err
+				fail(i, o.err)
 			} else {
 				// This target was not previously launched,
 				// so run it and then open its "outcome gate."
-				if verbose {
-					con.Indentf("Running %s", con.Describe(target))
+				tctx, cancel := context.WithCancelCause(ctx)
+				con.mu.Lock()
+				o.cancel = cancel
+				con.mu.Unlock()
+
+				var parentTarget Target
+				if frame := getRunFrame(ctx); frame != nil {
+					parentTarget = frame.target
 				}
-				err := target.Run(ctx, con)
+				con.emit(ctx, ProgressEvent{Kind: ProgressStart, Target: target, Parent: parentTarget})
+				o.requested, o.start = requested, time.Now()
+				err := target.Run(withRunFrame(withRunning(tctx, addr), target), con)
+				o.end = time.Now()
+				cancel(nil)
 				if err != nil {
 					err = errors.Wrapf(err, "running %s", con.Describe(target))
 				}
-				errs[i] = err
+				con.emit(ctx, ProgressEvent{Kind: ProgressDone, Target: target, Err: err, Cached: o.cached, Duration: o.end.Sub(o.start)})
 				o.err = err
 				o.g.set(true)
+				fail(i, err)
+			}
+		}
+
+		if p, ok := target.(Parallelizable); ok && !p.Parallel() {
+			serial = append(serial, run)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run()
+		}()
+	}
+
+	if len(serial) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, run := range serial {
+				run()
 			}
 		}()
 	}
@@ -119,14 +242,129 @@ func (con *Controller) Run(ctx context.Context, targets ...Target) error {
 	return errors.Join(errs...)
 }
 
+// ErrNotStarted is the error for a target that [Controller.Run] did not start
+// because another target failed
+// (unless in "keep going" mode, see [WithKeepGoing]),
+// or that a [Seq] did not run
+// because an earlier step failed.
+var ErrNotStarted = errors.New("not started because another target failed")
+
+// notStarted records that target was not started because another target failed,
+// so that it appears as skipped in [Controller.Results]
+// (unless it runs later),
+// and returns a suitable error wrapping [ErrNotStarted].
+func (con *Controller) notStarted(target Target) error {
+	if d, ok := target.(*deferredResolutionTarget); ok {
+		if resolved, err := d.resolve(con); err == nil {
+			target = resolved
+		}
+	}
+
+	err := errors.Wrapf(ErrNotStarted, "%s", con.Describe(target))
+
+	addr, aerr := targetAddr(target)
+	if aerr != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	if _, ok := con.ran[addr]; ok {
+		return err
+	}
+	if _, ok := con.notRan[addr]; !ok {
+		con.notRan[addr] = &outcome{
+			g:         newGate(true),
+			err:       err,
+			target:    target,
+			requested: now,
+			start:     now,
+			end:       now,
+			skipped:   true,
+		}
+	}
+	return err
+}
+
+// Cancel cancels the context of the given target if it is running,
+// reporting whether it was.
+// The target's Run method sees its context canceled,
+// with [context.Cause] returning [ErrCanceled].
+// What happens next is up to the target;
+// a [Command], for example, kills its subprocess
+// (see [WithGracePeriod]).
+//
+// Other targets are unaffected,
+// except that a target waiting for the canceled one
+// will normally fail when it does.
+func (con *Controller) Cancel(target Target) bool {
+	addr, err := targetAddr(target)
+	if err != nil {
+		return false
+	}
+
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	o, ok := con.ran[addr]
+	if !ok || o.cancel == nil || o.g.isOpen() {
+		return false
+	}
+	o.cancel(ErrCanceled)
+	return true
+}
+
+// ErrCanceled is the cause of the context cancellation
+// of a target canceled with [Controller.Cancel].
+var ErrCanceled = errors.New("canceled")
+
+// ranSnapshot returns the set of target addresses
+// that have run or are running.
+func (con *Controller) ranSnapshot() set.Of[uintptr] {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+	return set.New[uintptr](append(maps.Keys(con.ran), maps.Keys(con.notRan)...)...)
+}
+
+// forgetFailures removes from the controller's memory
+// any finished, failed target that is not in `keep`
+// (normally the result of an earlier call to ranSnapshot).
+// This allows those targets to be run again,
+// e.g. when retrying a target whose subtargets failed.
+func (con *Controller) forgetFailures(keep set.Of[uintptr]) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	for addr, o := range con.ran {
+		if keep.Has(addr) {
+			continue
+		}
+		if o.g.isOpen() && o.err != nil {
+			delete(con.ran, addr)
+		}
+	}
+	for addr := range con.notRan {
+		if !keep.Has(addr) {
+			delete(con.notRan, addr)
+		}
+	}
+}
+
 // Indentf formats and prints its arguments
 // with leading indentation based on the nesting depth of the controller.
 // The nesting depth increases with each call to [Controller.Run]
 // and decreases at the end of the call.
 //
 // A newline is added to the end of the string if one is not already there.
+//
+// If a [ProgressSink] has been set with [Controller.SetProgressSink],
+// the string goes to it instead,
+// as a ProgressMessage event.
 func (con *Controller) Indentf(format string, args ...any) {
-	con.indentf(os.Stdout, format, args...)
+	con.message("stdout", format, args...)
 }
 
 func (con *Controller) indentf(w io.Writer, format string, args ...any) {
@@ -134,12 +372,17 @@ func (con *Controller) indentf(w io.Writer, format string, args ...any) {
 		format += "\n"
 	}
 
+	if con.TextStyle().Width > 0 {
+		fmt.Fprintf(con.IndentingCopier(w, ""), format, args...)
+		return
+	}
+
 	con.mu.Lock()
 	depth := con.depth
 	con.mu.Unlock()
 
 	if depth > 0 {
-		fmt.Fprint(w, strings.Repeat("  ", int(depth)))
+		fmt.Fprint(w, strings.Repeat(con.TextStyle().Indent, int(depth)))
 	}
 	fmt.Fprintf(w, format, args...)
 }
@@ -148,25 +391,37 @@ func (con *Controller) indentf(w io.Writer, format string, args ...any) {
 // indenting each line according to the indentation depth of the controller.
 // After indentation,
 // each line additionally gets any prefix specified in `prefix`.
+// The indentation for each level of nesting
+// is the Indent field of the controller's [TextStyle].
+// If the style's Width is positive,
+// lines longer than that are wrapped,
+// with continuation lines getting the style's WrapPrefix after the indentation and prefix.
 //
 // The wrapper converts \r\n to \n, and bare \r to \n.
 // A \r at the very end of the input is silently dropped.
 func (con *Controller) IndentingCopier(w io.Writer, prefix string) io.Writer {
+	style := con.TextStyle()
+
 	con.mu.Lock()
 	depth := con.depth
 	con.mu.Unlock()
 
+	indent := strings.Repeat(style.Indent, int(depth)) + prefix
 	return &indentingCopier{
 		w:      bufio.NewWriter(w),
-		indent: strings.Repeat("  ", int(depth)) + prefix,
+		indent: indent,
+		wrap:   indent + style.WrapPrefix,
+		width:  style.Width,
 		bol:    true,
 	}
 }
 
 type indentingCopier struct {
-	w          *bufio.Writer
-	indent     string
-	bol, sawcr bool
+	w             *bufio.Writer
+	indent, wrap  string
+	width         int // if positive, wrap lines at this many runes
+	col, ncontent int // runes on the current line: total, and not counting indentation
+	bol, sawcr    bool
 }
 
 func (c *indentingCopier) Write(buf []byte) (int, error) {
@@ -194,12 +449,26 @@ func (c *indentingCopier) Write(buf []byte) (int, error) {
 				}
 			}
 			if c.bol {
-				_, err := c.w.WriteString(c.indent)
-				if err != nil {
+				if err := c.startLine(c.indent); err != nil {
 					return n, err
 				}
 			}
 			c.bol = false
+
+			// Count runes by their first bytes
+			// (the ones that are not UTF-8 continuation bytes).
+			if b&0xC0 != 0x80 {
+				if c.width > 0 && c.col >= c.width && c.ncontent > 0 {
+					if err := c.w.WriteByte('\n'); err != nil {
+						return n, err
+					}
+					if err := c.startLine(c.wrap); err != nil {
+						return n, err
+					}
+				}
+				c.col++
+				c.ncontent++
+			}
 			if err := c.w.WriteByte(b); err != nil {
 				return n, err
 			}
@@ -211,6 +480,15 @@ func (c *indentingCopier) Write(buf []byte) (int, error) {
 	return n, err
 }
 
+// startLine writes the indentation at the beginning of a line.
+func (c *indentingCopier) startLine(indent string) error {
+	if _, err := c.w.WriteString(indent); err != nil {
+		return err
+	}
+	c.col, c.ncontent = utf8.RuneCountInString(indent), 0
+	return nil
+}
+
 func (c *indentingCopier) newline() error {
 	if err := c.w.WriteByte('\n'); err != nil {
 		return err
@@ -3,10 +3,12 @@ package fab
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bobg/go-generics/v2/set"
 	"github.com/bradleyjkemp/cupaloy/v2"
@@ -140,3 +142,77 @@ func TestIndentf(t *testing.T) {
 		t.Errorf("got %s, want \"  bar\\n\"", buf.String())
 	}
 }
+
+func TestFailFast(t *testing.T) {
+	t.Parallel()
+
+	for _, failFast := range []bool{false, true} {
+		var (
+			boom     = errors.New("boom")
+			canceled atomic.Bool
+			started  = make(chan struct{})
+			fail     = &capTarget{serial: true, f: func(context.Context, *Controller) error {
+				<-started
+				return boom
+			}}
+			after = &capTarget{serial: true, f: func(context.Context, *Controller) error { return nil }}
+			slow  = F(func(ctx context.Context, _ *Controller) error {
+				close(started)
+				select {
+				case <-ctx.Done():
+					canceled.Store(true)
+					return ctx.Err()
+				case <-time.After(200 * time.Millisecond):
+					return nil
+				}
+			})
+			ctx = WithFailFast(context.Background(), failFast)
+		)
+
+		// Without fail-fast, only keep-going mode starts the target after the failure.
+		ctx = WithKeepGoing(ctx, true)
+
+		err := NewController("").Run(ctx, slow, fail, after)
+		if !errors.Is(err, boom) {
+			t.Errorf("failFast=%v: got error %v, want boom", failFast, err)
+		}
+		if got := canceled.Load(); got != failFast {
+			t.Errorf("failFast=%v: slow target canceled: %v", failFast, got)
+		}
+		if got := errors.Is(err, ErrNotStarted); got != failFast {
+			t.Errorf("failFast=%v: target after failure not started: %v", failFast, got)
+		}
+	}
+}
+
+func TestKeepGoing(t *testing.T) {
+	t.Parallel()
+
+	for _, keepGoing := range []bool{false, true} {
+		var (
+			boom  = errors.New("boom")
+			fail  = &capTarget{serial: true, f: func(context.Context, *Controller) error { return boom }}
+			after = &capTarget{serial: true, f: func(context.Context, *Controller) error { return nil }}
+			con   = NewController("")
+			ctx   = WithKeepGoing(context.Background(), keepGoing)
+		)
+
+		err := con.Run(ctx, fail, after)
+		if !errors.Is(err, boom) {
+			t.Errorf("keepGoing=%v: got error %v, want boom", keepGoing, err)
+		}
+		if got := errors.Is(err, ErrNotStarted); got == keepGoing {
+			t.Errorf("keepGoing=%v: target after failure not started: %v", keepGoing, got)
+		}
+
+		wantStatus := StatusSkipped
+		if keepGoing {
+			wantStatus = StatusRan
+		}
+		for _, r := range con.Results() {
+			if r.Target == after && r.Status != wantStatus {
+				t.Errorf("keepGoing=%v: got status %s for target after failure, want %s", keepGoing, r.Status, wantStatus)
+			}
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package rust
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bobg/fab"
+)
+
+// metadata is the subset of the output of `cargo metadata` that this package uses.
+type metadata struct {
+	Packages []struct {
+		Name         string `json:"name"`
+		ManifestPath string `json:"manifest_path"`
+		Targets      []struct {
+			Name string   `json:"name"`
+			Kind []string `json:"kind"`
+		} `json:"targets"`
+	} `json:"packages"`
+	WorkspaceRoot   string `json:"workspace_root"`
+	TargetDirectory string `json:"target_directory"`
+}
+
+func readMetadata(dir string) (*metadata, error) {
+	cmd := exec.Command("cargo", "metadata", "--format-version", "1", "--no-deps")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fab.CommandErr{Err: err, Output: stderr.Bytes()}
+	}
+
+	var md metadata
+	if err := json.Unmarshal(out, &md); err != nil {
+		return nil, errors.Wrap(err, "decoding cargo metadata")
+	}
+	return &md, nil
+}
+
+// Deps produces the list of files involved in building the Rust package in the given directory
+// (or the packages of the workspace containing it).
+// It uses `cargo metadata` to find the workspace's packages,
+// and includes every file in the directory tree of each one
+// (other than the target directory and hidden files),
+// plus the workspace's Cargo.toml and Cargo.lock.
+// Dependencies from crate registries are not included;
+// they are pinned by Cargo.lock.
+// The list is sorted for consistent, predictable results.
+//
+// A call to Deps may be specified in YAML using the tag !cargo.Deps,
+// which introduces a mapping whose field is:
+//
+//   - Dir: the directory containing the Rust package,
+//     either absolute or relative to the directory containing the YAML file
+func Deps(dir string) ([]string, error) {
+	md, err := readMetadata(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting cargo metadata in %s", dir)
+	}
+	return md.deps()
+}
+
+func (md *metadata) deps() ([]string, error) {
+	files := set.New[string]()
+
+	for _, name := range []string{"Cargo.toml", "Cargo.lock"} {
+		path := filepath.Join(md.WorkspaceRoot, name)
+		if _, err := os.Stat(path); err == nil {
+			files.Add(path)
+		}
+	}
+
+	for _, pkg := range md.Packages {
+		files.Add(pkg.ManifestPath)
+
+		err := filepath.WalkDir(filepath.Dir(pkg.ManifestPath), func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if path == md.TargetDirectory || (strings.HasPrefix(entry.Name(), ".") && path != filepath.Dir(pkg.ManifestPath)) {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if strings.HasPrefix(entry.Name(), ".") {
+				return nil
+			}
+			files.Add(path)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "walking package %s", pkg.Name)
+		}
+	}
+
+	slice := files.Slice()
+	sort.Strings(slice)
+	return slice, nil
+}
+
+// binaries produces the paths of the executables that `cargo build` produces in dir
+// with the given profile directory ("debug" or "release").
+// If dir contains a member of the workspace,
+// those are the binaries of that package;
+// otherwise
+// (e.g. dir contains a virtual manifest)
+// they are the binaries of all the workspace's packages.
+func (md *metadata) binaries(dir, profile string) ([]string, error) {
+	absdir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "making %s absolute", dir)
+	}
+
+	pkgs := md.Packages
+	for i, pkg := range md.Packages {
+		if filepath.Dir(pkg.ManifestPath) == absdir {
+			pkgs = md.Packages[i : i+1]
+			break
+		}
+	}
+
+	var suffix string
+	if runtime.GOOS == "windows" {
+		suffix = ".exe"
+	}
+
+	var result []string
+	for _, pkg := range pkgs {
+		for _, target := range pkg.Targets {
+			for _, kind := range target.Kind {
+				if kind == "bin" {
+					result = append(result, filepath.Join(md.TargetDirectory, profile, target.Name+suffix))
+					break
+				}
+			}
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Build is a target describing how to compile the Rust package in `dir`
+// (or, for a workspace root, all the packages in the workspace)
+// with `cargo build`.
+// If release is true,
+// it builds with the release profile.
+// Additional command-line arguments for `cargo build` can be specified with `flags`.
+//
+// Build is implemented in terms of [fab.Files],
+// with the files produced by [Deps] as inputs.
+// The outputs are the packages' executables in the target directory
+// (e.g. target/debug/NAME),
+// which are automatically selected for "autocleaning."
+// See [fab.Autoclean] for more about this feature.
+//
+// A Build target may be specified in YAML using the tag !cargo.Build,
+// which introduces a mapping whose fields are:
+//
+//   - Dir: the directory containing the Rust package,
+//     either absolute or relative to the directory containing the YAML file
+//   - Release: a boolean, true for building with the release profile
+//   - Flags: a sequence of additional command-line flags for `cargo build`
+func Build(dir string, release bool, flags ...string) (fab.Target, error) {
+	md, err := readMetadata(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting cargo metadata in %s", dir)
+	}
+	deps, err := md.deps()
+	if err != nil {
+		return nil, errors.Wrap(err, "computing dependencies")
+	}
+
+	var (
+		args    = []string{"build"}
+		profile = "debug"
+	)
+	if release {
+		args = append(args, "--release")
+		profile = "release"
+	}
+	args = append(args, flags...)
+
+	outs, err := md.binaries(dir, profile)
+	if err != nil {
+		return nil, errors.Wrap(err, "computing outputs")
+	}
+
+	c := &fab.Command{
+		Cmd:  "cargo",
+		Args: args,
+		Dir:  dir,
+	}
+	return fab.Files(c, deps, outs, fab.Autoclean(true)), nil
+}
+
+// MustBuild is the same as [Build] but panics on error.
+func MustBuild(dir string, release bool, flags ...string) fab.Target {
+	target, err := Build(dir, release, flags...)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+func buildDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var b struct {
+		Dir     string    `yaml:"Dir"`
+		Release bool      `yaml:"Release"`
+		Flags   yaml.Node `yaml:"Flags"`
+	}
+	if err := node.Decode(&b); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding cargo.Build")
+	}
+
+	flags, err := con.YAMLStringList(&b.Flags, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding cargo.Build.Flags")
+	}
+
+	return Build(con.JoinPath(dir, b.Dir), b.Release, flags...)
+}
+
+// Test is a target that runs `cargo test` in `dir`.
+// Additional command-line arguments for `cargo test` can be specified with `flags`.
+//
+// Test is implemented in terms of [fab.Files],
+// with the files produced by [Deps] as inputs,
+// and no outputs.
+// When the tests pass,
+// a record of that is added to the hash DB,
+// so they are not rerun until the package or the flags change.
+//
+// A Test target may be specified in YAML using the tag !cargo.Test,
+// which introduces a mapping whose fields are:
+//
+//   - Dir: the directory containing the Rust package,
+//     either absolute or relative to the directory containing the YAML file
+//   - Flags: a sequence of additional command-line flags for `cargo test`
+func Test(dir string, flags ...string) (fab.Target, error) {
+	deps, err := Deps(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "computing dependencies")
+	}
+	c := &fab.Command{
+		Cmd:  "cargo",
+		Args: append([]string{"test"}, flags...),
+		Dir:  dir,
+	}
+	return fab.Files(c, deps, nil), nil
+}
+
+// MustTest is the same as [Test] but panics on error.
+func MustTest(dir string, flags ...string) fab.Target {
+	target, err := Test(dir, flags...)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+func testDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var t struct {
+		Dir   string    `yaml:"Dir"`
+		Flags yaml.Node `yaml:"Flags"`
+	}
+	if err := node.Decode(&t); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding cargo.Test")
+	}
+
+	flags, err := con.YAMLStringList(&t.Flags, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding cargo.Test.Flags")
+	}
+
+	return Test(con.JoinPath(dir, t.Dir), flags...)
+}
+
+func depsDecoder(con *fab.Controller, node *yaml.Node, dir string) ([]string, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var d struct {
+		Dir string `yaml:"Dir"`
+	}
+	if err := node.Decode(&d); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding cargo.Deps")
+	}
+
+	return Deps(con.JoinPath(dir, d.Dir))
+}
+
+func init() {
+	fab.RegisterYAMLTarget("cargo.Build", buildDecoder)
+	fab.SetYAMLTagDoc("cargo.Build", "Build the binaries of a Rust workspace with cargo.")
+	fab.RegisterYAMLTarget("cargo.Test", testDecoder)
+	fab.SetYAMLTagDoc("cargo.Test", "Run the tests of a Rust workspace with cargo.")
+	fab.RegisterYAMLStringList("cargo.Deps", depsDecoder)
+	fab.SetYAMLTagDoc("cargo.Deps", "List the files that a Rust workspace depends on.")
+}
@@ -0,0 +1,87 @@
+package rust
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bobg/fab/internal/faketool"
+)
+
+// setup copies _testdata (an app with a fake cargo) to a temporary dir
+// and adds files that Deps and the Build target should ignore.
+func setup(t *testing.T) *faketool.Env {
+	t.Helper()
+
+	e := faketool.New(t, "_testdata")
+	e.WriteFile(t, "app/.gitignore", "/target\n")
+	e.WriteFile(t, "app/.git/HEAD", "ref: refs/heads/main\n")
+	e.WriteFile(t, "app/target/debug/junk", "junk\n")
+	return e
+}
+
+func TestDeps(t *testing.T) {
+	e := setup(t)
+
+	got, err := Deps(e.Path("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		e.Path("app", "Cargo.lock"),
+		e.Path("app", "Cargo.toml"),
+		e.Path("app", "build.rs"),
+		e.Path("app", "src", "main.rs"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	e := setup(t)
+
+	// run runs the named target with a new controller
+	// and returns the cargo commands that ran,
+	// other than "cargo metadata."
+	run := func(name string) string {
+		t.Helper()
+
+		var cmds []string
+		for _, line := range e.Run(t, name) {
+			if !strings.HasPrefix(line, "cargo metadata ") {
+				cmds = append(cmds, line)
+			}
+		}
+		return strings.Join(cmds, "; ")
+	}
+
+	if got := run("Build"); got != "cargo build" {
+		t.Errorf("first run: got cargo commands %q, want %q", got, "cargo build")
+	}
+	if _, err := os.Stat(e.Path("app", "target", "debug", "app")); err != nil {
+		t.Error(err)
+	}
+	if got := run("Build"); got != "" {
+		t.Errorf("second run: got cargo commands %q, want none", got)
+	}
+
+	e.WriteFile(t, "app/src/main.rs", "fn main() { }\n")
+	if got := run("Build"); got != "cargo build" {
+		t.Errorf("after changing source: got cargo commands %q, want %q", got, "cargo build")
+	}
+
+	// Changes in the target directory don't matter.
+	e.WriteFile(t, "app/target/debug/junk", "more junk\n")
+	if got := run("Build"); got != "" {
+		t.Errorf("after changing target dir: got cargo commands %q, want none", got)
+	}
+
+	if got := run("Test"); got != "cargo test --quiet" {
+		t.Errorf("test: got cargo commands %q, want %q", got, "cargo test --quiet")
+	}
+	if got := run("Test"); got != "" {
+		t.Errorf("second test: got cargo commands %q, want none", got)
+	}
+}
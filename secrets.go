@@ -0,0 +1,215 @@
+package fab
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted is what replaces each secret value
+// (see [Controller.AddSecrets])
+// in output.
+const Redacted = "***"
+
+// AddSecrets registers secret values with con,
+// such as passwords and API tokens,
+// that must not appear in output.
+// Each occurrence of one of them
+// in the output of a [Command]
+// (when it is copied to Fab's own output in verbose mode,
+// or captured in a [CommandErr]),
+// and in messages printed by con
+// (see [Controller.Indentf]),
+// is replaced with [Redacted].
+//
+// Output that a Command sends to a file or writer of its own
+// (see Command.StdoutFile and Command.Stdout)
+// is not redacted.
+// Neither is a secret that is split across lines of output.
+//
+// Empty values are ignored.
+func (con *Controller) AddSecrets(values ...string) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	for _, value := range values {
+		if value != "" {
+			con.secrets = append(con.secrets, value)
+		}
+	}
+
+	// Longest first,
+	// so that a secret containing another is redacted whole.
+	sort.SliceStable(con.secrets, func(i, j int) bool {
+		return len(con.secrets[i]) > len(con.secrets[j])
+	})
+}
+
+// AddSecretEnv registers the values of the given environment variables as secrets
+// (see [Controller.AddSecrets]).
+// Variables that are not set are ignored.
+func (con *Controller) AddSecretEnv(names ...string) {
+	var values []string
+	for _, name := range names {
+		values = append(values, os.Getenv(name))
+	}
+	con.AddSecrets(values...)
+}
+
+// ReadSecretsFile registers the values in the given file as secrets
+// (see [Controller.AddSecrets]).
+// Each line of the file is either NAME=VALUE,
+// in which case VALUE is a secret,
+// or a secret by itself.
+// Blank lines and lines beginning with # are ignored.
+func (con *Controller) ReadSecretsFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", filename)
+	}
+	defer f.Close()
+
+	var (
+		sc     = bufio.NewScanner(f)
+		values []string
+	)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if name, value, ok := strings.Cut(line, "="); ok && varNameRegex.MatchString(name) {
+			line = value
+		}
+		values = append(values, line)
+	}
+	if err := sc.Err(); err != nil {
+		return errors.Wrapf(err, "reading %s", filename)
+	}
+
+	con.AddSecrets(values...)
+	return nil
+}
+
+// Redact returns a copy of s
+// with each secret registered with [Controller.AddSecrets]
+// replaced with [Redacted].
+func (con *Controller) Redact(s string) string {
+	con.mu.Lock()
+	secrets := con.secrets
+	con.mu.Unlock()
+
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	return s
+}
+
+// hasSecrets tells whether any secrets have been registered with con.
+func (con *Controller) hasSecrets() bool {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+	return len(con.secrets) > 0
+}
+
+// redactWriter is an io.Writer that redacts secrets
+// (see [Controller.AddSecrets])
+// in the output it copies to w.
+// It buffers its input a line at a time,
+// so that a secret split across two writes is still found.
+type redactWriter struct {
+	con *Controller
+	w   io.Writer
+
+	mu   sync.Mutex
+	line []byte // the current partial line
+}
+
+func (r *redactWriter) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.line = append(r.line, p...)
+	i := bytes.LastIndexByte(r.line, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	if _, err := io.WriteString(r.w, r.con.Redact(string(r.line[:i+1]))); err != nil {
+		return 0, err
+	}
+	r.line = append(r.line[:0], r.line[i+1:]...)
+	return len(p), nil
+}
+
+// flush writes any pending partial line.
+func (r *redactWriter) flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.line) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(r.w, r.con.Redact(string(r.line)))
+	r.line = r.line[:0]
+	return err
+}
+
+// readSecretsDecl handles the _secrets declaration in a top-level fab.yaml file.
+// It is either a list of environment-variable names,
+// whose values are secrets,
+// or a mapping with the fields Env,
+// a list of environment-variable names,
+// and File,
+// the name of a file to read with [Controller.ReadSecretsFile],
+// relative to the top directory.
+// See [Controller.AddSecrets].
+//
+// Example:
+//
+//	_secrets:
+//	  Env: [GITHUB_TOKEN, NPM_TOKEN]
+//	  File: .secrets
+func (con *Controller) readSecretsDecl(node *yaml.Node, dir string) error {
+	if dir != "" {
+		return fmt.Errorf("_secrets declaration is allowed only in the top-level YAML file")
+	}
+
+	if node.Kind == yaml.SequenceNode {
+		names, err := con.YAMLStringList(node, dir)
+		if err != nil {
+			return err
+		}
+		con.AddSecretEnv(names...)
+		return nil
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode | yaml.SequenceNode}
+	}
+
+	var ysecrets struct {
+		Env  yaml.Node `yaml:"Env"`
+		File string    `yaml:"File"`
+	}
+	if err := node.Decode(&ysecrets); err != nil {
+		return errors.Wrap(err, "YAML error in _secrets declaration")
+	}
+	names, err := con.YAMLStringList(&ysecrets.Env, dir)
+	if err != nil {
+		return errors.Wrap(err, "YAML error in _secrets.Env")
+	}
+	con.AddSecretEnv(names...)
+
+	if ysecrets.File != "" {
+		return con.ReadSecretsFile(con.JoinPath(ysecrets.File))
+	}
+	return nil
+}
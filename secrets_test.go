@@ -0,0 +1,96 @@
+package fab
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	secretsFile := filepath.Join(tmpdir, "secrets")
+	if err := os.WriteFile(secretsFile, []byte("# comment\n\nTOKEN=tok123\nbarepassword\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	con := NewController("")
+	con.AddSecrets("abc", "abcdef", "")
+	if err := con.ReadSecretsFile(secretsFile); err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		inp  = "abcdef abc ab tok123 TOKEN barepassword"
+		want = "*** *** ab *** TOKEN ***"
+	)
+	if got := con.Redact(inp); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRedactCommand(t *testing.T) {
+	t.Parallel()
+
+	const secret = "hunter2"
+
+	con := NewController("")
+	con.AddSecrets(secret)
+
+	// Non-verbose: the output is captured in a CommandErr.
+	ctx := context.Background()
+	err := con.Run(ctx, &Command{Shell: "echo password is " + secret + "; false"})
+	var cerr CommandErr
+	if !errors.As(err, &cerr) {
+		t.Fatalf("got error %v, want CommandErr", err)
+	}
+	if got := string(cerr.Output); got != "password is ***\n" {
+		t.Errorf("got output %q", got)
+	}
+
+	// Verbose: the output is copied to Fab's own output.
+	// Here the secret is split across two writes.
+	con = NewController("")
+	con.AddSecrets(secret)
+	var buf strings.Builder
+	con.SetProgressSink(NewTextProgressSink(con, &buf, &buf))
+	ctx = WithVerbose(ctx, true)
+	if err := con.Run(ctx, &Command{Shell: "printf hun; sleep 0.1; printf 'ter2\\n'; printf " + secret}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), secret) {
+		t.Errorf("secret found in output:\n%s", buf.String())
+	}
+	if strings.Count(buf.String(), Redacted) != 3 { // once in "Running command," once in each line of output
+		t.Errorf("secret not redacted in output:\n%s", buf.String())
+	}
+}
+
+func TestSecretsDecl(t *testing.T) {
+	t.Setenv("FAB_TEST_SECRET", "s3cr3t")
+
+	con := NewController("")
+	if err := con.ReadYAML(strings.NewReader("_secrets: [FAB_TEST_SECRET, FAB_TEST_UNSET_SECRET]\n"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := con.Redact("x s3cr3t y"); got != "x *** y" {
+		t.Errorf("got %q", got)
+	}
+
+	con = NewController("")
+	if err := con.ReadYAML(strings.NewReader("_secrets:\n  Env: [FAB_TEST_SECRET]\n"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := con.Redact("x s3cr3t y"); got != "x *** y" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -9,7 +9,11 @@ import (
 )
 
 // Seq produces a target that runs a collection of targets in sequence.
-// Its Run method exits early when a target in the sequence fails.
+// Its Run method exits early when a target in the sequence fails,
+// even in "keep going" mode (see [WithKeepGoing]),
+// since later steps may rely on earlier ones.
+// The remaining steps are reported as skipped
+// (see [StatusSkipped]).
 //
 // It is JSON-encodable
 // (and therefore usable as the subtarget in [Files])
@@ -31,8 +35,11 @@ var _ Target = &seq{}
 
 // Run implements Target.Run.
 func (s *seq) Run(ctx context.Context, con *Controller) error {
-	for _, t := range s.targets {
+	for i, t := range s.targets {
 		if err := con.Run(ctx, t); err != nil {
+			for _, rest := range s.targets[i+1:] {
+				con.notStarted(rest)
+			}
 			return err
 		}
 	}
@@ -43,6 +50,11 @@ func (*seq) Desc() string {
 	return "Seq"
 }
 
+// Children implements GraphChildren.
+func (s *seq) Children() []Target {
+	return s.targets
+}
+
 func seqDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
 	if node.Kind != yaml.SequenceNode {
 		return nil, BadYAMLNodeKindError{Got: node.Kind, Want: yaml.SequenceNode}
@@ -62,4 +74,5 @@ func seqDecoder(con *Controller, node *yaml.Node, dir string) (Target, error) {
 
 func init() {
 	RegisterYAMLTarget("Seq", seqDecoder)
+	SetYAMLTagDoc("Seq", "Run targets one after another.")
 }
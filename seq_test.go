@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -75,3 +76,41 @@ func TestSeq(t *testing.T) {
 		t.Error("t2 ran but should not have")
 	}
 }
+
+func TestSeqKeepGoing(t *testing.T) {
+	t.Parallel()
+
+	// A Seq stops at its first failure even in keep-going mode,
+	// reporting the remaining steps as skipped,
+	// but an unrelated target still runs.
+	var (
+		fail1 = F(func(context.Context, *Controller) error { return errors.New("fail1") })
+		fail2 = F(func(context.Context, *Controller) error { return errors.New("fail2") })
+		ct    countTarget
+		other countTarget
+		con   = NewController("")
+		ctx   = WithKeepGoing(context.Background(), true)
+	)
+
+	err := con.Run(ctx, Seq(fail1, &ct, fail2), &other)
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	if ct.count != 0 {
+		t.Errorf("got count %d for step after failure, want 0", ct.count)
+	}
+	if strings.Contains(err.Error(), "fail2") {
+		t.Errorf("error %q mentions fail2", err)
+	}
+	if other.count != 1 {
+		t.Errorf("got count %d for unrelated target, want 1", other.count)
+	}
+
+	statuses := make(map[Target]Status)
+	for _, r := range con.Results() {
+		statuses[r.Target] = r.Status
+	}
+	if statuses[&ct] != StatusSkipped || statuses[fail2] != StatusSkipped {
+		t.Errorf("got statuses %s and %s for the remaining steps, want skipped", statuses[&ct], statuses[fail2])
+	}
+}
@@ -0,0 +1,52 @@
+package fab
+
+import (
+	"os"
+	"strings"
+)
+
+// shellProgram returns the shell program that runs the Shell string of a [Command]
+// (and the commands of [CommandOutput] and the !Command condition of [If]).
+// This is $SHELL if that is set.
+// Otherwise it is /bin/sh,
+// except on Windows,
+// where it is sh if that is in the PATH
+// (as with Git for Windows),
+// and otherwise $ComSpec,
+// normally cmd.exe.
+func shellProgram() string {
+	if sh := os.Getenv("SHELL"); sh != "" {
+		return sh
+	}
+	return defaultShell()
+}
+
+// shellArgv returns the program and arguments for running the command string cmd
+// with the shell program sh.
+// The argument introducing cmd depends on the shell:
+// /C for cmd.exe,
+// -Command for PowerShell,
+// and -c for all others.
+//
+// On Windows,
+// the resulting [exec.Cmd] needs setShellCmdLine
+// for cmd.exe to see cmd as written.
+func shellArgv(sh, cmd string) (string, []string) {
+	switch shellName(sh) {
+	case "cmd":
+		return sh, []string{"/C", cmd}
+	case "powershell", "pwsh":
+		return sh, []string{"-NoProfile", "-Command", cmd}
+	}
+	return sh, []string{"-c", cmd}
+}
+
+// shellName returns the name of the shell program sh
+// without its directory or any .exe suffix,
+// in lower case.
+func shellName(sh string) string {
+	if i := strings.LastIndexAny(sh, `/\`); i >= 0 {
+		sh = sh[i+1:]
+	}
+	return strings.TrimSuffix(strings.ToLower(sh), ".exe")
+}
@@ -0,0 +1,63 @@
+package fab
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShellArgv(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		sh       string
+		wantArgs []string
+	}{{
+		sh:       "/bin/sh",
+		wantArgs: []string{"-c", "echo hi"},
+	}, {
+		sh:       "/usr/local/bin/bash",
+		wantArgs: []string{"-c", "echo hi"},
+	}, {
+		sh:       `C:\Program Files\Git\bin\sh.exe`,
+		wantArgs: []string{"-c", "echo hi"},
+	}, {
+		sh:       `C:\Windows\system32\cmd.exe`,
+		wantArgs: []string{"/C", "echo hi"},
+	}, {
+		sh:       "CMD.EXE",
+		wantArgs: []string{"/C", "echo hi"},
+	}, {
+		sh:       "powershell.exe",
+		wantArgs: []string{"-NoProfile", "-Command", "echo hi"},
+	}, {
+		sh:       "/usr/bin/pwsh",
+		wantArgs: []string{"-NoProfile", "-Command", "echo hi"},
+	}}
+
+	for _, tc := range cases {
+		tc := tc // Go loop var pitfall
+		t.Run(tc.sh, func(t *testing.T) {
+			t.Parallel()
+
+			gotSh, gotArgs := shellArgv(tc.sh, "echo hi")
+			if gotSh != tc.sh {
+				t.Errorf("got program %s, want %s", gotSh, tc.sh)
+			}
+			if !reflect.DeepEqual(gotArgs, tc.wantArgs) {
+				t.Errorf("got args %v, want %v", gotArgs, tc.wantArgs)
+			}
+		})
+	}
+}
+
+func TestShellProgram(t *testing.T) {
+	t.Setenv("SHELL", "/opt/bin/zsh")
+	if got := shellProgram(); got != "/opt/bin/zsh" {
+		t.Errorf("got %s, want /opt/bin/zsh", got)
+	}
+
+	t.Setenv("SHELL", "")
+	if got, want := shellProgram(), defaultShell(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,103 @@
+package fab
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/bobg/errors"
+)
+
+const (
+	// outputMemLimit is how much of a command's captured output
+	// is kept in memory before it spills to a temporary file.
+	outputMemLimit = 1 << 20
+
+	// outputTailSize is how much of a command's spilled output
+	// is included in its [CommandErr].
+	outputTailSize = 64 << 10
+)
+
+// spillBuffer is an io.Writer that keeps up to limit bytes in memory,
+// then moves everything to a temporary file.
+// It captures the output of a [Command] in non-verbose mode,
+// so that a chatty command cannot use unbounded memory.
+type spillBuffer struct {
+	limit int
+
+	mu  sync.Mutex // protects the remaining fields
+	buf bytes.Buffer
+	f   *os.File
+}
+
+func (b *spillBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.f == nil && b.buf.Len()+len(p) > b.limit {
+		f, err := os.CreateTemp("", "fab-output-*.txt")
+		if err != nil {
+			return 0, errors.Wrap(err, "creating output file")
+		}
+		if _, err := f.Write(b.buf.Bytes()); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return 0, errors.Wrapf(err, "writing %s", f.Name())
+		}
+		b.buf = bytes.Buffer{}
+		b.f = f
+	}
+	if b.f != nil {
+		return b.f.Write(p)
+	}
+	return b.buf.Write(p)
+}
+
+// result bundles err together with the captured output into a [CommandErr].
+// If the output spilled to a file,
+// the CommandErr names the file and includes only the last tailSize bytes of output.
+// The file is kept when err is non-nil and removed otherwise.
+// The result is err itself when err is nil or there was no output.
+func (b *spillBuffer) result(err error, tailSize int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.f == nil {
+		if err != nil && b.buf.Len() > 0 {
+			return CommandErr{Err: err, Output: b.buf.Bytes()}
+		}
+		return err
+	}
+
+	defer b.f.Close()
+
+	name := b.f.Name()
+	if err == nil {
+		return errors.Wrapf(os.Remove(name), "removing %s", name)
+	}
+
+	tail, tailErr := readTail(b.f, tailSize)
+	if tailErr != nil {
+		return errors.Join(err, tailErr)
+	}
+	return CommandErr{Err: err, Output: tail, OutputFile: name}
+}
+
+// readTail reads the last n bytes of f.
+func readTail(f *os.File, n int) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "statting %s", f.Name())
+	}
+	offset := info.Size() - int64(n)
+	if offset < 0 {
+		offset = 0
+	}
+	tail := make([]byte, info.Size()-offset)
+	_, err = f.ReadAt(tail, offset)
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return tail, errors.Wrapf(err, "reading %s", f.Name())
+}
@@ -0,0 +1,89 @@
+package fab
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSpillBuffer(t *testing.T) {
+	t.Parallel()
+
+	errFailed := errors.New("failed")
+
+	t.Run("in_memory", func(t *testing.T) {
+		b := &spillBuffer{limit: 100}
+		if _, err := b.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		err := b.result(errFailed, 10)
+
+		var cerr CommandErr
+		if !errors.As(err, &cerr) {
+			t.Fatalf("got %v, want CommandErr", err)
+		}
+		if string(cerr.Output) != "hello" || cerr.OutputFile != "" {
+			t.Errorf("got %+v", cerr)
+		}
+	})
+
+	t.Run("no_output", func(t *testing.T) {
+		b := &spillBuffer{limit: 100}
+		if err := b.result(errFailed, 10); err != errFailed {
+			t.Errorf("got %v, want %v", err, errFailed)
+		}
+	})
+
+	t.Run("spilled", func(t *testing.T) {
+		b := &spillBuffer{limit: 100}
+		for i := 0; i < 50; i++ {
+			if _, err := b.Write([]byte("0123456789")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if b.buf.Len() != 0 {
+			t.Errorf("%d bytes still in memory", b.buf.Len())
+		}
+		err := b.result(errFailed, 15)
+
+		var cerr CommandErr
+		if !errors.As(err, &cerr) {
+			t.Fatalf("got %v, want CommandErr", err)
+		}
+		if cerr.OutputFile == "" {
+			t.Fatal("no output file")
+		}
+		defer os.Remove(cerr.OutputFile)
+
+		if string(cerr.Output) != "567890123456789" {
+			t.Errorf("got tail %q", cerr.Output)
+		}
+		if !strings.Contains(err.Error(), cerr.OutputFile) {
+			t.Errorf("error %q does not name the output file", err)
+		}
+
+		full, err := os.ReadFile(cerr.OutputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := bytes.Repeat([]byte("0123456789"), 50); !bytes.Equal(full, want) {
+			t.Errorf("got %d bytes in output file, want %d", len(full), len(want))
+		}
+	})
+
+	t.Run("spilled_success", func(t *testing.T) {
+		b := &spillBuffer{limit: 5}
+		if _, err := b.Write([]byte("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+		name := b.f.Name()
+		if err := b.result(nil, 10); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("output file %s not removed (err is %v)", name, err)
+		}
+	})
+}
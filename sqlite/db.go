@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	_ "embed"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/benbjohnson/clock"
@@ -128,3 +130,86 @@ func (db *DB) Add(ctx context.Context, h []byte) error {
 	}
 	return nil
 }
+
+// FileHash returns the hash recorded for the file at path with SetFileHash,
+// and true,
+// if the record has the given size, mtime, and inode.
+// Otherwise it returns "", false.
+// This implements fab.FileHashCache.
+func (db *DB) FileHash(ctx context.Context, path string, size, mtime int64, inode uint64) (string, bool, error) {
+	const q = `SELECT hash FROM file_hashes WHERE path = $1 AND size = $2 AND mtime = $3 AND inode = $4`
+	var hash string
+	err := db.db.QueryRowContext(ctx, q, path, size, mtime, int64(inode)).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, errors.Wrap(err, "querying database")
+	}
+	return hash, true, nil
+}
+
+// SetFileHash records the hash of the file at path
+// with the given size, mtime, and inode,
+// replacing any earlier record for path.
+// This implements fab.FileHashCache.
+func (db *DB) SetFileHash(ctx context.Context, path string, size, mtime int64, inode uint64, hash string) error {
+	const q = `INSERT INTO file_hashes (path, size, mtime, inode, hash) VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO UPDATE SET size = $2, mtime = $3, inode = $4, hash = $5 WHERE path = $1`
+	_, err := db.db.ExecContext(ctx, q, path, size, mtime, int64(inode), hash)
+	return errors.Wrap(err, "adding file hash to database")
+}
+
+// HashRecord returns the record stored under key with SetHashRecord,
+// and true.
+// If there is no such record,
+// it returns nil, false.
+// This implements fab.HashRecorder.
+func (db *DB) HashRecord(ctx context.Context, key string) ([]byte, bool, error) {
+	const q = `SELECT record FROM hash_records WHERE key = $1`
+	var record []byte
+	err := db.db.QueryRowContext(ctx, q, key).Scan(&record)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrap(err, "querying database")
+	}
+	return record, true, nil
+}
+
+// SetHashRecord stores a record under key,
+// replacing any earlier one.
+// This implements fab.HashRecorder.
+func (db *DB) SetHashRecord(ctx context.Context, key string, record []byte) error {
+	const q = `INSERT INTO hash_records (key, record) VALUES ($1, $2) ON CONFLICT DO UPDATE SET record = $2 WHERE key = $1`
+	_, err := db.db.ExecContext(ctx, q, key, record)
+	return errors.Wrap(err, "adding hash record to database")
+}
+
+// Check runs SQLite's integrity check on db,
+// returning an error if it finds any problems.
+func (db *DB) Check(ctx context.Context) error {
+	rows, err := db.db.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return errors.Wrap(err, "checking database integrity")
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return errors.Wrap(err, "scanning integrity-check result")
+		}
+		if s != "ok" {
+			problems = append(problems, s)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "reading integrity-check results")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("database integrity check failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -151,3 +151,120 @@ func TestDBKeep(t *testing.T) {
 		t.Error("entry [3] missing")
 	}
 }
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	tmpfile, err := os.CreateTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+	defer os.Remove(tmpfile.Name())
+
+	ctx := context.Background()
+
+	db, err := Open(tmpfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Add(ctx, []byte("hash")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Check(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+var _ fab.FileHashCache = &DB{}
+
+func TestFileHash(t *testing.T) {
+	t.Parallel()
+
+	tmpfile, err := os.CreateTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+	defer os.Remove(tmpfile.Name())
+
+	ctx := context.Background()
+
+	db, err := Open(tmpfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, ok, err := db.FileHash(ctx, "/a", 1, 2, 3); err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Error("found hash in empty db")
+	}
+
+	if err := db.SetFileHash(ctx, "/a", 1, 2, 3, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if h, ok, err := db.FileHash(ctx, "/a", 1, 2, 3); err != nil {
+		t.Fatal(err)
+	} else if !ok || h != "abc" {
+		t.Errorf("got %q, %v; want abc, true", h, ok)
+	}
+	if _, ok, err := db.FileHash(ctx, "/a", 1, 5, 3); err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Error("found hash with different mtime")
+	}
+
+	if err := db.SetFileHash(ctx, "/a", 1, 5, 3, "def"); err != nil {
+		t.Fatal(err)
+	}
+	if h, ok, err := db.FileHash(ctx, "/a", 1, 5, 3); err != nil {
+		t.Fatal(err)
+	} else if !ok || h != "def" {
+		t.Errorf("after update got %q, %v; want def, true", h, ok)
+	}
+	if _, ok, err := db.FileHash(ctx, "/a", 1, 2, 3); err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Error("found replaced record")
+	}
+}
+
+func TestHashRecord(t *testing.T) {
+	t.Parallel()
+
+	tmpfile, err := os.CreateTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+	defer os.Remove(tmpfile.Name())
+
+	ctx := context.Background()
+
+	db, err := Open(tmpfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, ok, err := db.HashRecord(ctx, "/top/T"); err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Error("found record in empty db")
+	}
+
+	for _, rec := range []string{"first", "second"} {
+		if err := db.SetHashRecord(ctx, "/top/T", []byte(rec)); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok, err := db.HashRecord(ctx, "/top/T"); err != nil {
+			t.Fatal(err)
+		} else if !ok || string(got) != rec {
+			t.Errorf("got %q, %v; want %s, true", got, ok, rec)
+		}
+	}
+}
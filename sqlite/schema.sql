@@ -4,3 +4,16 @@ CREATE TABLE IF NOT EXISTS hashes (
 );
 
 CREATE INDEX IF NOT EXISTS unix_secs_idx ON hashes (unix_secs);
+
+CREATE TABLE IF NOT EXISTS file_hashes (
+  path TEXT NOT NULL PRIMARY KEY,
+  size INT NOT NULL,
+  mtime INT NOT NULL,
+  inode INT NOT NULL,
+  hash TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS hash_records (
+  key TEXT NOT NULL PRIMARY KEY,
+  record BLOB NOT NULL
+);
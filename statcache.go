@@ -0,0 +1,80 @@
+package fab
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/bobg/errors"
+)
+
+// FileHashCache is an optional interface that a [HashDB] may implement
+// to remember the hashes of files,
+// so that a file whose size, modification time, and inode are unchanged
+// need not be read and hashed again.
+// This is the "stat cache."
+// The [sqlite.DB] type implements it.
+//
+// Turn off the stat cache with [WithTrustMtime]
+// (or the -trust-mtime=false flag of the fab command)
+// for filesystems where modification times are unreliable.
+type FileHashCache interface {
+	// FileHash returns the hash recorded for the file at path
+	// (an absolute path)
+	// with the given size, modification time (in nanoseconds since the Unix epoch), and inode,
+	// and true.
+	// If there is no such record,
+	// or if the record is for a different size, modification time, or inode,
+	// it returns "", false.
+	FileHash(ctx context.Context, path string, size, mtime int64, inode uint64) (string, bool, error)
+
+	// SetFileHash records the hash of the file at path,
+	// replacing any earlier record for path.
+	SetFileHash(ctx context.Context, path string, size, mtime int64, inode uint64, hash string) error
+}
+
+// racyWindow is how recently a file may have been modified
+// for its hash to be left out of the stat cache.
+// A file modified this recently may be modified again
+// without any change to its size or (coarse-grained) modification time,
+// and a stale hash in the cache would hide that change.
+const racyWindow = 2 * time.Second
+
+// cachedHashFile returns the hash of the file at path,
+// whose info is given,
+// using the stat cache if there is one.
+func cachedHashFile(ctx context.Context, path string, info fs.FileInfo) (string, error) {
+	cache, _ := GetHashDB(ctx).(FileHashCache)
+	if cache == nil || !GetTrustMtime(ctx) {
+		return hashFile(path)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "getting absolute path of %s", path)
+	}
+	var (
+		size  = info.Size()
+		mtime = info.ModTime()
+		inode = fileInode(info)
+	)
+
+	h, ok, err := cache.FileHash(ctx, abs, size, mtime.UnixNano(), inode)
+	if err != nil {
+		return "", errors.Wrapf(err, "looking up %s in stat cache", path)
+	}
+	if ok {
+		return h, nil
+	}
+
+	h, err = hashFile(path)
+	if err != nil {
+		return "", err
+	}
+	if time.Since(mtime) < racyWindow {
+		return h, nil
+	}
+	err = cache.SetFileHash(ctx, abs, size, mtime.UnixNano(), inode, h)
+	return h, errors.Wrapf(err, "adding %s to stat cache", path)
+}
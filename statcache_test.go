@@ -0,0 +1,125 @@
+package fab
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+// statCacheDB is a [HashDB] that is also a [FileHashCache].
+type statCacheDB struct {
+	memdb
+
+	mu      sync.Mutex
+	entries map[string]string // path -> "size mtime inode hash"
+	hits    int
+}
+
+var _ FileHashCache = &statCacheDB{}
+
+func (db *statCacheDB) FileHash(_ context.Context, path string, size, mtime int64, inode uint64) (string, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var (
+		gotSize, gotMtime int64
+		gotInode          uint64
+		hash              string
+	)
+	if _, err := fmt.Sscan(db.entries[path], &gotSize, &gotMtime, &gotInode, &hash); err != nil {
+		return "", false, nil
+	}
+	if gotSize != size || gotMtime != mtime || gotInode != inode {
+		return "", false, nil
+	}
+	db.hits++
+	return hash, true, nil
+}
+
+func (db *statCacheDB) SetFileHash(_ context.Context, path string, size, mtime int64, inode uint64, hash string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.entries[path] = fmt.Sprintf("%d %d %d %s", size, mtime, inode, hash)
+	return nil
+}
+
+func TestStatCache(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		file = filepath.Join(tmpdir, "file")
+		old  = time.Now().Add(-time.Hour)
+	)
+	if err := os.WriteFile(file, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, old, old); err != nil {
+		t.Fatal(err)
+	}
+	want, err := hashFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &statCacheDB{memdb: memdb(set.New[string]()), entries: make(map[string]string)}
+	ctx := WithHashDB(context.Background(), db)
+
+	hash := func(ctx context.Context) string {
+		t.Helper()
+		got, err := fileHashes(ctx, []string{file})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got[1]
+	}
+
+	if got := hash(ctx); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if len(db.entries) != 1 {
+		t.Fatalf("got %d stat-cache entries, want 1", len(db.entries))
+	}
+	if got := hash(ctx); got != want {
+		t.Errorf("got %s from stat cache, want %s", got, want)
+	}
+	if db.hits != 1 {
+		t.Errorf("got %d stat-cache hits, want 1", db.hits)
+	}
+
+	// With mtimes not trusted, the stat cache is not consulted.
+	if got := hash(WithTrustMtime(ctx, false)); got != want {
+		t.Errorf("got %s without trusting mtime, want %s", got, want)
+	}
+	if db.hits != 1 {
+		t.Errorf("got %d stat-cache hits without trusting mtime, want 1", db.hits)
+	}
+
+	// A file modified moments ago is hashed but not cached.
+	if err := os.WriteFile(file, []byte("goodbye\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want2, err := hashFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if got := hash(ctx); got != want2 {
+			t.Errorf("got %s after change, want %s", got, want2)
+		}
+	}
+	if db.hits != 1 {
+		t.Errorf("got %d stat-cache hits after change, want 1", db.hits)
+	}
+}
@@ -0,0 +1,172 @@
+package fab
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// NewStatusLineProgressSink produces a [ProgressSink]
+// that keeps a single status line up to date on a terminal,
+// redrawing it in place as targets start and finish
+// and once a second while any are running.
+// The line shows the elapsed time;
+// counts of the targets running, done, cached (up to date), and failed;
+// and the descriptions of the targets currently running.
+// It is cleared when nothing is running.
+//
+// ProgressMessage events are printed above the status line,
+// the stdout stream to w and the stderr stream to errw.
+// ProgressResolve and ProgressOutput events are ignored,
+// so this sink is meant for non-verbose mode.
+//
+// The status line is written to w using a carriage return and an ANSI "erase line" sequence,
+// and is truncated to the width in the COLUMNS environment variable
+// (80 if that is unset).
+func NewStatusLineProgressSink(w, errw io.Writer) ProgressSink {
+	return &statusLineSink{
+		w:     w,
+		errw:  errw,
+		width: terminalWidth(),
+	}
+}
+
+type statusLineSink struct {
+	w, errw io.Writer
+	width   int
+
+	mu                   sync.Mutex
+	start                time.Time
+	running              []string // descriptions of running targets, in the order they started
+	done, cached, failed int
+	shown                bool          // whether a status line is on the screen
+	stop                 chan struct{} // non-nil while the ticker goroutine is running
+}
+
+func (s *statusLineSink) Progress(ev ProgressEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.start.IsZero() {
+		s.start = ev.Time
+	}
+
+	switch ev.Kind {
+	case ProgressStart:
+		s.running = append(s.running, ev.Desc)
+		if s.stop == nil {
+			s.stop = make(chan struct{})
+			go s.tick(s.stop)
+		}
+
+	case ProgressDone:
+		for i, desc := range s.running {
+			if desc == ev.Desc {
+				s.running = append(s.running[:i], s.running[i+1:]...)
+				break
+			}
+		}
+		switch {
+		case ev.Err != nil:
+			s.failed++
+		case ev.Cached:
+			s.cached++
+		default:
+			s.done++
+		}
+
+	case ProgressMessage:
+		s.clear()
+		w := s.w
+		if ev.Stream == "stderr" {
+			w = s.errw
+		}
+		fmt.Fprintln(w, ev.Message)
+
+	default:
+		return
+	}
+
+	if len(s.running) == 0 {
+		s.clear()
+		if s.stop != nil {
+			close(s.stop)
+			s.stop = nil
+		}
+		return
+	}
+	s.draw(ev.Time)
+}
+
+// tick redraws the status line once a second
+// (to keep the elapsed time current)
+// until stop is closed.
+func (s *statusLineSink) tick(stop chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			if s.stop == stop {
+				s.draw(now)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// draw writes the status line.
+// The caller must hold s.mu.
+func (s *statusLineSink) draw(now time.Time) {
+	line := s.line(now)
+	fmt.Fprintf(s.w, "\r%s\x1b[K", line)
+	s.shown = true
+}
+
+// clear erases the status line, if one is showing.
+// The caller must hold s.mu.
+func (s *statusLineSink) clear() {
+	if !s.shown {
+		return
+	}
+	fmt.Fprint(s.w, "\r\x1b[K")
+	s.shown = false
+}
+
+// line produces the text of the status line,
+// truncated to fit s.width.
+// The caller must hold s.mu.
+func (s *statusLineSink) line(now time.Time) string {
+	line := fmt.Sprintf("[%s] %d running, %d done, %d cached, %d failed", now.Sub(s.start).Round(time.Second), len(s.running), s.done, s.cached, s.failed)
+	if len(s.running) > 0 {
+		line += ": " + strings.Join(s.running, ", ")
+	}
+
+	// Leave the last column empty,
+	// since some terminals wrap when it is written.
+	max := s.width - 1
+	if max <= 3 || utf8.RuneCountInString(line) <= max {
+		return line
+	}
+	runes := []rune(line)
+	return string(runes[:max-3]) + "..."
+}
+
+// terminalWidth returns the width of the terminal
+// according to the COLUMNS environment variable,
+// or 80 if that is unset or invalid.
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
@@ -0,0 +1,121 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusLine(t *testing.T) {
+	var (
+		buf  bytes.Buffer
+		t0   = time.Now()
+		sink = &statusLineSink{w: &buf, errw: &buf, width: 80}
+	)
+
+	send := func(ev ProgressEvent, secs int) string {
+		buf.Reset()
+		ev.Time = t0.Add(time.Duration(secs) * time.Second)
+		sink.Progress(ev)
+		return buf.String()
+	}
+
+	cases := []struct {
+		ev   ProgressEvent
+		secs int
+		want string
+	}{{
+		ev:   ProgressEvent{Kind: ProgressStart, Desc: "Build"},
+		want: "\r[0s] 1 running, 0 done, 0 cached, 0 failed: Build\x1b[K",
+	}, {
+		ev:   ProgressEvent{Kind: ProgressStart, Desc: "Test"},
+		secs: 1,
+		want: "\r[1s] 2 running, 0 done, 0 cached, 0 failed: Build, Test\x1b[K",
+	}, {
+		ev:   ProgressEvent{Kind: ProgressMessage, Stream: "stdout", Message: "hello"},
+		secs: 2,
+		want: "\r\x1b[Khello\n\r[2s] 2 running, 0 done, 0 cached, 0 failed: Build, Test\x1b[K",
+	}, {
+		ev:   ProgressEvent{Kind: ProgressDone, Desc: "Build", Cached: true},
+		secs: 3,
+		want: "\r[3s] 1 running, 0 done, 1 cached, 0 failed: Test\x1b[K",
+	}, {
+		ev:   ProgressEvent{Kind: ProgressOutput, Desc: "Test", Data: []byte("ignored")},
+		secs: 4,
+		want: "",
+	}, {
+		ev:   ProgressEvent{Kind: ProgressDone, Desc: "Test", Err: errors.New("oops")},
+		secs: 5,
+		want: "\r\x1b[K",
+	}, {
+		ev:   ProgressEvent{Kind: ProgressStart, Desc: "Lint"},
+		secs: 65,
+		want: "\r[1m5s] 1 running, 0 done, 1 cached, 1 failed: Lint\x1b[K",
+	}, {
+		ev:   ProgressEvent{Kind: ProgressDone, Desc: "Lint"},
+		secs: 66,
+		want: "\r\x1b[K",
+	}}
+
+	for i, c := range cases {
+		if got := send(c.ev, c.secs); got != c.want {
+			t.Errorf("case %d: got %q, want %q", i+1, got, c.want)
+		}
+	}
+
+	if sink.stop != nil {
+		t.Error("ticker still running after all targets finished")
+	}
+}
+
+func TestStatusLineTruncate(t *testing.T) {
+	sink := &statusLineSink{width: 40, start: time.Now()}
+	sink.running = []string{"Alpha", "Beta", "Gamma", "Delta"}
+
+	got := sink.line(sink.start)
+	if want := "[0s] 4 running, 0 done, 0 cached, 0 ..."; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStatusLineRun(t *testing.T) {
+	var buf bytes.Buffer
+
+	con := NewController("")
+	con.SetProgressSink(&statusLineSink{w: &buf, errw: &buf, width: 80})
+
+	target := F(func(context.Context, *Controller) error { return nil })
+	if err := con.Run(context.Background(), target); err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	if !strings.Contains(got, " 1 running, 0 done, 0 cached, 0 failed: ") {
+		t.Errorf("no status line in %q", got)
+	}
+	if !strings.HasSuffix(got, "\r\x1b[K") {
+		t.Errorf("status line not cleared at end of %q", got)
+	}
+}
+
+func TestSetProgressFormatAuto(t *testing.T) {
+	var buf bytes.Buffer
+
+	con := NewController("")
+	if err := con.SetProgressFormat(&buf, "auto"); err != nil {
+		t.Fatal(err)
+	}
+	if sink := con.ProgressSink(); sink != nil {
+		t.Errorf("got sink %T for a non-terminal writer, want nil", sink)
+	}
+
+	if err := con.SetProgressFormat(&buf, "status"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := con.ProgressSink().(*statusLineSink); !ok {
+		t.Errorf("got sink %T, want *statusLineSink", con.ProgressSink())
+	}
+}
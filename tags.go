@@ -0,0 +1,98 @@
+package fab
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+)
+
+// WithTags is a [RegisterOption] giving a target some tags,
+// such as "lint", "test", or "ci",
+// by which it can be selected with [Controller.TaggedTargets]
+// (and the -tag command-line flag).
+//
+// In YAML,
+// a target entry may be written as an untyped mapping
+// with a Tags field beside the Target field
+// (see [Controller.ReadYAML]).
+// The value of Tags is a tag or a list of them.
+//
+// Example:
+//
+//	Lint:
+//	  Tags: [lint, ci]
+//	  Target: !Command
+//	    Shell: golangci-lint run ./...
+func WithTags(tags ...string) RegisterOption {
+	return func(tuple *targetRegistryTuple) {
+		tuple.tags = append(tuple.tags, tags...)
+	}
+}
+
+// Tags returns the tags of the target in the registry with the given name,
+// sorted.
+// See [WithTags].
+func (con *Controller) Tags(name string) []string {
+	con.mu.Lock()
+	tuple := con.targetsByName[name]
+	con.mu.Unlock()
+
+	if len(tuple.tags) == 0 {
+		return nil
+	}
+	tags := set.New[string](tuple.tags...).Slice()
+	sort.Strings(tags)
+	return tags
+}
+
+// TaggedTargets returns the sorted names of the registered targets
+// having any of the given tags
+// (see [WithTags]).
+// It first reads all of the project's YAML files
+// (see [Controller.ReadAllYAMLFiles])
+// so that targets in subdirectories are included.
+func (con *Controller) TaggedTargets(tags ...string) ([]string, error) {
+	if err := con.ReadAllYAMLFiles(); err != nil {
+		return nil, err
+	}
+
+	want := set.New[string](tags...)
+
+	con.mu.Lock()
+	var result []string
+	for name, tuple := range con.targetsByName {
+		for _, tag := range tuple.tags {
+			if want.Has(tag) {
+				result = append(result, name)
+				break
+			}
+		}
+	}
+	con.mu.Unlock()
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// TagArgs returns the names of the targets having any of the tags in tagList,
+// a comma-separated list that is the value of the -tag command-line flag.
+// It is an error if there are none.
+func (con *Controller) TagArgs(tagList string) ([]string, error) {
+	var tags []string
+	for _, tag := range strings.Split(tagList, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	names, err := con.TaggedTargets(tags...)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding tagged targets")
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no targets tagged %s", tagList)
+	}
+	return names, nil
+}
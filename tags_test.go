@@ -0,0 +1,95 @@
+package fab
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTaggedTargets(t *testing.T) {
+	t.Parallel()
+
+	con := NewController("_testdata/tags")
+	if err := con.ReadYAMLFile(""); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := con.Tags("Lint"), []string{"ci", "lint"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got tags %v for Lint, want %v", got, want)
+	}
+	if got := con.Tags("Release"); len(got) != 0 {
+		t.Errorf("got tags %v for Release, want none", got)
+	}
+
+	cases := []struct {
+		tags []string
+		want []string
+	}{
+		{[]string{"ci"}, []string{"Lint", "Test", "sub/Test"}},
+		{[]string{"lint"}, []string{"Lint"}},
+		{[]string{"lint", "test"}, []string{"Lint", "sub/Test"}},
+		{[]string{"release"}, nil},
+	}
+	for _, c := range cases {
+		t.Run(strings.Join(c.tags, ","), func(t *testing.T) {
+			got, err := con.TaggedTargets(c.tags...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+
+	if _, err := con.TagArgs("release"); err == nil {
+		t.Error("got no error for a tag with no targets")
+	}
+	got, err := con.TagArgs("lint, test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Lint", "sub/Test"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// The Target field is the registered target.
+	target, _ := con.RegistryTarget("Lint")
+	if c, ok := target.(*Command); !ok || c.Shell != "true" {
+		t.Errorf("got %#v for Lint, want a Command", target)
+	}
+}
+
+func TestWithTags(t *testing.T) {
+	t.Parallel()
+
+	con := NewController("")
+	if _, err := con.RegisterTarget("Build", "", &countTarget{}, WithTags("b", "a"), WithTags("a")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := con.Tags("Build"), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	buf := new(bytes.Buffer)
+	con.ListTargets(buf)
+	if want := "Build\n    Tags: a, b\n"; buf.String() != want {
+		t.Errorf("got listing %q, want %q", buf.String(), want)
+	}
+}
+
+func TestBadTagsYAML(t *testing.T) {
+	t.Parallel()
+
+	for _, yml := range []string{
+		"X:\n  Tags: [a]\n",
+		"X:\n  Tags: [a]\n  Target: !Command\n    Shell: \"true\"\n  Extra: 1\n",
+		"X:\n  Tags: {a: b}\n  Target: !Command\n    Shell: \"true\"\n",
+	} {
+		con := NewController("")
+		if err := con.ReadYAML(strings.NewReader(yml), ""); err == nil {
+			t.Errorf("got no error for %q", yml)
+		}
+	}
+}
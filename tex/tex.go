@@ -0,0 +1,322 @@
+// Package tex contains Fab target types for building documents
+// with latexmk and pandoc.
+package tex
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bobg/fab"
+)
+
+// Latexmk produces a target that builds a PDF from the LaTeX file main,
+// running `latexmk -pdf -outdir=OUTDIR FLAGS MAIN`
+// in the directory containing main.
+// If outdir is empty,
+// it is the directory containing main.
+// Flags such as -xelatex or -lualatex
+// select a different engine.
+//
+// Latexmk is implemented in terms of [fab.Files].
+// Its inputs are the files found by [Deps],
+// and its output is the PDF file in outdir,
+// which is automatically selected for "autocleaning."
+// See [fab.Autoclean] for more about this feature.
+// Any opts are passed through to fab.Files.
+//
+// A Latexmk target may be specified in YAML using the tag !tex.Latexmk,
+// which introduces a mapping whose fields are:
+//
+//   - Main: the main LaTeX file
+//   - Out: the output directory
+//   - Flags: a sequence of additional flags for latexmk
+//
+// Main and Out are either absolute or relative to the directory containing the YAML file.
+func Latexmk(main, outdir string, flags []string, opts ...fab.FilesOpt) (fab.Target, error) {
+	main, err := filepath.Abs(main)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting absolute path of %s", main)
+	}
+	dir := filepath.Dir(main)
+	if outdir == "" {
+		outdir = dir
+	}
+	if outdir, err = filepath.Abs(outdir); err != nil {
+		return nil, errors.Wrapf(err, "getting absolute path of %s", outdir)
+	}
+
+	deps, err := Deps(main)
+	if err != nil {
+		return nil, errors.Wrapf(err, "computing dependencies of %s", main)
+	}
+
+	base := filepath.Base(main)
+	pdf := filepath.Join(outdir, strings.TrimSuffix(base, filepath.Ext(base))+".pdf")
+
+	args := []string{"-pdf", "-outdir=" + outdir}
+	args = append(args, flags...)
+	args = append(args, base)
+
+	c := &fab.Command{
+		Cmd:  "latexmk",
+		Args: args,
+		Dir:  dir,
+	}
+	opts = append([]fab.FilesOpt{fab.Autoclean(true)}, opts...)
+	return fab.Files(c, deps, []string{pdf}, opts...), nil
+}
+
+// MustLatexmk is the same as [Latexmk] but panics on error.
+func MustLatexmk(main, outdir string, flags []string, opts ...fab.FilesOpt) fab.Target {
+	target, err := Latexmk(main, outdir, flags, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+func latexmkDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var l struct {
+		Main  string    `yaml:"Main"`
+		Out   string    `yaml:"Out"`
+		Flags yaml.Node `yaml:"Flags"`
+	}
+	if err := node.Decode(&l); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding tex.Latexmk")
+	}
+	if l.Main == "" {
+		return nil, errors.New("YAML error decoding tex.Latexmk: no Main")
+	}
+
+	flags, err := con.YAMLStringList(&l.Flags, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding tex.Latexmk.Flags")
+	}
+
+	var outdir string
+	if l.Out != "" {
+		outdir = con.JoinPath(dir, l.Out)
+	}
+
+	return Latexmk(con.JoinPath(dir, l.Main), outdir, flags)
+}
+
+// Pandoc produces a target that converts the documents in inputs to out,
+// running `pandoc -o OUT FLAGS INPUTS`.
+// The output format is determined by pandoc from the name of out,
+// unless flags say otherwise
+// (e.g. with --to).
+//
+// Pandoc is implemented in terms of [fab.Files].
+// Its inputs are the files in inputs,
+// plus, for LaTeX inputs (named .tex or .latex),
+// the files found by [Deps].
+// Its output is out,
+// which is automatically selected for "autocleaning."
+// See [fab.Autoclean] for more about this feature.
+// Any opts are passed through to fab.Files.
+//
+// A Pandoc target may be specified in YAML using the tag !tex.Pandoc,
+// which introduces a mapping whose fields are:
+//
+//   - Inputs: a sequence of input files
+//   - Out: the output file
+//   - Flags: a sequence of additional flags for pandoc
+//
+// The input and output files are either absolute or relative to the directory containing the YAML file.
+func Pandoc(inputs []string, out string, flags []string, opts ...fab.FilesOpt) (fab.Target, error) {
+	if len(inputs) == 0 {
+		return nil, errors.New("no input files")
+	}
+	if out == "" {
+		return nil, errors.New("no output file")
+	}
+
+	in := set.New(inputs...)
+	for _, inp := range inputs {
+		switch filepath.Ext(inp) {
+		case ".tex", ".latex":
+			deps, err := Deps(inp)
+			if err != nil {
+				return nil, errors.Wrapf(err, "computing dependencies of %s", inp)
+			}
+			in.Add(deps...)
+		}
+	}
+	inSlice := in.Slice()
+	sort.Strings(inSlice)
+
+	args := []string{"-o", out}
+	args = append(args, flags...)
+	args = append(args, inputs...)
+
+	c := &fab.Command{
+		Cmd:  "pandoc",
+		Args: args,
+	}
+	opts = append([]fab.FilesOpt{fab.Autoclean(true)}, opts...)
+	return fab.Files(c, inSlice, []string{out}, opts...), nil
+}
+
+// MustPandoc is the same as [Pandoc] but panics on error.
+func MustPandoc(inputs []string, out string, flags []string, opts ...fab.FilesOpt) fab.Target {
+	target, err := Pandoc(inputs, out, flags, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return target
+}
+
+func pandocDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fab.BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+
+	var p struct {
+		Inputs yaml.Node `yaml:"Inputs"`
+		Out    string    `yaml:"Out"`
+		Flags  yaml.Node `yaml:"Flags"`
+	}
+	if err := node.Decode(&p); err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding tex.Pandoc")
+	}
+	if p.Out == "" {
+		return nil, errors.New("YAML error decoding tex.Pandoc: no Out")
+	}
+
+	inputs, err := con.YAMLFileList(&p.Inputs, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding tex.Pandoc.Inputs")
+	}
+	flags, err := con.YAMLStringList(&p.Flags, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML error decoding tex.Pandoc.Flags")
+	}
+
+	return Pandoc(inputs, con.JoinPath(dir, p.Out), flags)
+}
+
+// Deps returns the dependencies of the LaTeX file main.
+// Included in the dependencies is the file itself,
+// plus the files named in its
+// \input, \include, \includegraphics, \bibliography, and \addbibresource commands,
+// and in theirs,
+// recursively.
+// As in LaTeX,
+// the names are relative to the directory containing main,
+// and a name with no extension
+// has the usual one added
+// (.tex, .bib, or one of .pdf, .png, .jpg, .jpeg, and .eps for graphics).
+// Files that cannot be found,
+// such as those from the TeX distribution,
+// are not included.
+// The list is sorted for consistent, predictable results.
+func Deps(main string) ([]string, error) {
+	result := set.New[string](main)
+	if err := texdeps(main, filepath.Dir(main), result); err != nil {
+		return nil, err
+	}
+	slice := result.Slice()
+	sort.Strings(slice)
+	return slice, nil
+}
+
+var (
+	commandRegex = regexp.MustCompile(`\\(input|include|includegraphics|bibliography|addbibresource)\s*(?:\[[^\]]*\])?\s*\{([^}]*)\}`)
+
+	// commentRegex matches a comment:
+	// a % that is not escaped with a backslash,
+	// and the rest of the line.
+	commentRegex = regexp.MustCompile(`(^|[^\\])%.*`)
+)
+
+// exts tells, for each command,
+// the extensions to try for a name that has none.
+var exts = map[string][]string{
+	"input":           {".tex"},
+	"include":         {".tex"},
+	"includegraphics": {".pdf", ".png", ".jpg", ".jpeg", ".eps"},
+	"bibliography":    {".bib"},
+	"addbibresource":  {".bib"},
+}
+
+func texdeps(filename, dir string, result set.Of[string]) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", filename)
+	}
+	defer f.Close()
+
+	var found []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := commentRegex.ReplaceAllString(sc.Text(), "$1")
+		for _, m := range commandRegex.FindAllStringSubmatch(line, -1) {
+			names := []string{m[2]}
+			if m[1] == "bibliography" {
+				names = strings.Split(m[2], ",")
+			}
+			for _, name := range names {
+				if full, ok := resolve(dir, strings.TrimSpace(name), exts[m[1]]); ok && !result.Has(full) {
+					result.Add(full)
+					found = append(found, full)
+				}
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return errors.Wrapf(err, "scanning %s", filename)
+	}
+
+	for _, full := range found {
+		if ext := filepath.Ext(full); ext == ".tex" || ext == ".latex" {
+			if err := texdeps(full, dir, result); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve finds the file named name relative to dir,
+// trying each of exts in turn if name has no extension.
+func resolve(dir, name string, exts []string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+	candidates := []string{name}
+	if filepath.Ext(name) == "" {
+		candidates = nil
+		for _, ext := range exts {
+			candidates = append(candidates, name+ext)
+		}
+	}
+	for _, c := range candidates {
+		if info, err := os.Stat(c); err == nil && info.Mode().IsRegular() {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+func init() {
+	fab.RegisterYAMLTarget("tex.Latexmk", latexmkDecoder)
+	fab.SetYAMLTagDoc("tex.Latexmk", "Build a PDF from a LaTeX file with latexmk.")
+	fab.RegisterYAMLTarget("tex.Pandoc", pandocDecoder)
+	fab.SetYAMLTagDoc("tex.Pandoc", "Convert documents with pandoc.")
+}
@@ -0,0 +1,72 @@
+package tex
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/bobg/fab/internal/faketool"
+)
+
+func TestDeps(t *testing.T) {
+	e := faketool.New(t, "_testdata/deps")
+
+	got, err := Deps(e.Path("doc", "main.tex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		e.Path("doc", "chapters", "one.tex"),
+		e.Path("doc", "chapters", "shared.tex"),
+		e.Path("doc", "figs", "plot.png"),
+		e.Path("doc", "intro.tex"),
+		e.Path("doc", "main.tex"),
+		e.Path("doc", "more.bib"),
+		e.Path("doc", "refs.bib"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLatexmkPandoc(t *testing.T) {
+	e := faketool.New(t, "_testdata/docs")
+
+	// run runs the named target with a new controller
+	// and returns the commands that ran, sorted.
+	run := func(name string) []string {
+		t.Helper()
+
+		result := e.Run(t, name)
+		sort.Strings(result)
+		return result
+	}
+
+	var (
+		latexmk = "latexmk -pdf -outdir=out -xelatex main.tex"
+		pandoc  = "pandoc -o out/main.html --standalone doc/main.tex"
+	)
+
+	if got, want := run("Docs"), []string{latexmk, pandoc}; !reflect.DeepEqual(got, want) {
+		t.Errorf("first run: got %q, want %q", got, want)
+	}
+	if _, err := os.Stat(e.Path("out", "main.pdf")); err != nil {
+		t.Error(err)
+	}
+	if got := run("Docs"); len(got) > 0 {
+		t.Errorf("second run: got %q, want nothing", got)
+	}
+
+	// Changing an unused file doesn't matter.
+	e.WriteFile(t, "doc/unused.tex", "Still unused\n")
+	if got := run("Docs"); len(got) > 0 {
+		t.Errorf("after changing unused file: got %q, want nothing", got)
+	}
+
+	// Changing an \input file rebuilds both.
+	e.WriteFile(t, "doc/intro.tex", "Goodbye\n")
+	if got, want := run("Docs"), []string{latexmk, pandoc}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after changing intro: got %q, want %q", got, want)
+	}
+}
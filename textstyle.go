@@ -0,0 +1,115 @@
+package fab
+
+import (
+	"fmt"
+	"os"
+)
+
+// TextStyle controls the appearance of fab's text output:
+// the messages printed with [Controller.Indentf],
+// the output of commands copied with [Controller.IndentingCopier],
+// and the progress reports of the default [ProgressSink].
+// Set it with [Controller.SetTextStyle].
+//
+// Empty fields get default values.
+type TextStyle struct {
+	// Indent is the indentation for each level of nesting
+	// (see [Controller.Indentf]).
+	// The default is two spaces.
+	Indent string
+
+	// OutputPrefix follows the indentation on each line of a command's output.
+	// The default is four spaces.
+	OutputPrefix string
+
+	// TargetPrefix tells whether each line of a command's output
+	// should begin
+	// (after the indentation and OutputPrefix)
+	// with the name of the target producing it in brackets,
+	// as in "[Build] ".
+	// This helps tell apart the output of targets running concurrently.
+	TargetPrefix bool
+
+	// Width, if positive,
+	// is the maximum width of a line of output,
+	// in runes.
+	// Longer lines are wrapped.
+	Width int
+
+	// WrapPrefix follows the indentation
+	// (and OutputPrefix, for command output)
+	// on lines continuing a wrapped line.
+	// The default is two spaces.
+	WrapPrefix string
+
+	// Lanes tells whether to begin each line about a running target
+	// (after the indentation)
+	// with the number of its "lane," as in "#2 ".
+	// Each running target occupies a lane,
+	// and a target starting while others are running gets a new one,
+	// so the lanes show which targets run concurrently.
+	// See also [Controller.WriteGantt].
+	Lanes bool
+
+	// Color tells whether to color lane numbers
+	// (see Lanes)
+	// with ANSI terminal escape sequences.
+	Color bool
+}
+
+// UnicodeTextStyle is a [TextStyle] that uses UTF-8 drawing characters
+// to show nesting and wrapped lines.
+var UnicodeTextStyle = TextStyle{
+	Indent:       "│ ",
+	OutputPrefix: "┊   ",
+	WrapPrefix:   "↪ ",
+}
+
+// SetTextStyle sets the style of con's text output.
+func (con *Controller) SetTextStyle(style TextStyle) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+	con.style = style
+}
+
+// TextStyle returns the style of con's text output
+// (see [Controller.SetTextStyle]),
+// with empty fields filled in with their defaults.
+func (con *Controller) TextStyle() TextStyle {
+	con.mu.Lock()
+	style := con.style
+	con.mu.Unlock()
+
+	if style.Indent == "" {
+		style.Indent = "  "
+	}
+	if style.OutputPrefix == "" {
+		style.OutputPrefix = "    "
+	}
+	if style.WrapPrefix == "" {
+		style.WrapPrefix = "  "
+	}
+	return style
+}
+
+// laneColors are the ANSI color codes for lane numbers.
+var laneColors = []int{36, 33, 35, 32, 34, 31}
+
+// laneLabel produces the prefix for lines about a target in the given lane
+// (counting from 0).
+func (style TextStyle) laneLabel(lane int) string {
+	if !style.Lanes || lane < 0 {
+		return ""
+	}
+	if style.Color {
+		return fmt.Sprintf("\x1b[%dm#%d\x1b[0m ", laneColors[lane%len(laneColors)], lane+1)
+	}
+	return fmt.Sprintf("#%d ", lane+1)
+}
+
+// IsTerminal tells whether f is a terminal,
+// e.g. for deciding whether to set the Color field of a [TextStyle].
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
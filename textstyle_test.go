@@ -0,0 +1,99 @@
+package fab
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTextStyleWrap(t *testing.T) {
+	t.Parallel()
+
+	con := NewController("")
+	con.SetTextStyle(TextStyle{Width: 10})
+	con.incDepth()
+
+	var buf strings.Builder
+	fmt.Fprint(con.IndentingCopier(&buf, "> "), "abcdefghijklmnop\nxyz\n")
+
+	const want = "  > abcdef\n  >   ghij\n  >   klmn\n  >   op\n  > xyz\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestTextStyleUnicode(t *testing.T) {
+	t.Parallel()
+
+	con := NewController("")
+	style := UnicodeTextStyle
+	style.Width = 8
+	con.SetTextStyle(style)
+
+	var buf strings.Builder
+	con.SetProgressSink(NewTextProgressSink(con, &buf, &buf))
+	con.incDepth()
+	con.incDepth()
+	con.Indentf("héllo wörld")
+
+	// Width is measured in runes, not bytes.
+	const want = "│ │ héll\n│ │ ↪ o \n│ │ ↪ wö\n│ │ ↪ rl\n│ │ ↪ d\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestTextStyleTargetPrefix(t *testing.T) {
+	t.Parallel()
+
+	con := NewController("")
+	con.SetTextStyle(TextStyle{OutputPrefix: "| ", TargetPrefix: true})
+
+	var buf strings.Builder
+	con.SetProgressSink(NewTextProgressSink(con, &buf, &buf))
+
+	ctx := WithVerbose(context.Background(), true)
+	if err := con.Run(ctx, &Command{Shell: "echo a; echo b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	const want = "  | [unnamed Command] a\n  | [unnamed Command] b\n"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("output does not contain:\n%s\noutput is:\n%s", want, buf.String())
+	}
+}
+
+func TestTextStyleLanes(t *testing.T) {
+	t.Parallel()
+
+	con := NewController("")
+	con.SetTextStyle(TextStyle{Lanes: true})
+
+	var buf strings.Builder
+	con.SetProgressSink(NewTextProgressSink(con, &buf, &buf))
+
+	var (
+		ctx = WithVerbose(context.Background(), true)
+		a   = &Command{Shell: "sleep 0.2; echo a"}
+		b   = &Command{Shell: "sleep 0.2; echo b"}
+	)
+	if err := con.Run(ctx, a, b); err != nil {
+		t.Fatal(err)
+	}
+
+	// The two commands run concurrently, so they are in different lanes.
+	for _, want := range []string{"#1 Running", "#2 Running"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output does not contain %q; output is:\n%s", want, buf.String())
+		}
+	}
+	if !strings.Contains(buf.String(), "    #1 a\n") && !strings.Contains(buf.String(), "    #2 a\n") {
+		t.Errorf("output of first command has no lane label; output is:\n%s", buf.String())
+	}
+
+	style := TextStyle{Lanes: true, Color: true}
+	if got := style.laneLabel(1); got != "\x1b[33m#2\x1b[0m " {
+		t.Errorf("got colored lane label %q", got)
+	}
+}
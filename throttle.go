@@ -0,0 +1,116 @@
+package fab
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/bobg/errors"
+)
+
+// throttleWriter is an io.Writer that summarizes the output of noisy tools.
+// It buffers its input a line at a time.
+// A line rewritten with carriage returns,
+// as in a progress bar,
+// collapses to its final version.
+// Of the resulting lines,
+// only the first and every `every`th one after that is written;
+// the rest are counted.
+type throttleWriter struct {
+	w     io.Writer
+	every int
+
+	mu      sync.Mutex
+	line    []byte // the current partial line
+	cr      bool   // the last byte seen was a carriage return
+	n       int    // number of complete lines seen
+	skipped []byte // the last complete line not written, if any
+	nskip   int    // number of lines not written since the last one that was
+}
+
+func (t *throttleWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, b := range p {
+		switch {
+		case b == '\n':
+			if err := t.endLine(); err != nil {
+				return 0, err
+			}
+		case b == '\r':
+			t.cr = true
+		default:
+			if t.cr {
+				// The line is being rewritten.
+				t.line = t.line[:0]
+				t.cr = false
+			}
+			t.line = append(t.line, b)
+		}
+	}
+	return len(p), nil
+}
+
+// endLine handles a complete line.
+// The caller must hold t.mu.
+func (t *throttleWriter) endLine() error {
+	line := append(t.line, '\n')
+	t.line, t.cr = t.line[:0], false
+
+	t.n++
+	if t.every > 1 && (t.n-1)%t.every != 0 {
+		t.skipped = append(t.skipped[:0], line...)
+		t.nskip++
+		return nil
+	}
+	if err := t.writeSkipped(false); err != nil {
+		return err
+	}
+	_, err := t.w.Write(line)
+	return errors.Wrap(err, "writing throttled output")
+}
+
+// writeSkipped writes a note about the number of lines not written.
+// If last is true,
+// the final line not written is written too,
+// so that the end of the output is always shown.
+// The caller must hold t.mu.
+func (t *throttleWriter) writeSkipped(last bool) error {
+	if t.nskip == 0 {
+		return nil
+	}
+	n := t.nskip
+	if last {
+		n--
+	}
+	if n > 0 {
+		if _, err := fmt.Fprintf(t.w, "[%d lines omitted]\n", n); err != nil {
+			return errors.Wrap(err, "writing throttled output")
+		}
+	}
+	if last {
+		if _, err := t.w.Write(t.skipped); err != nil {
+			return errors.Wrap(err, "writing throttled output")
+		}
+	}
+	t.nskip = 0
+	return nil
+}
+
+// flush writes any pending output.
+// It is called after the command exits.
+func (t *throttleWriter) flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.writeSkipped(true); err != nil {
+		return err
+	}
+	if len(t.line) == 0 {
+		return nil
+	}
+	_, err := t.w.Write(append(t.line, '\n'))
+	t.line = t.line[:0]
+	return errors.Wrap(err, "writing throttled output")
+}
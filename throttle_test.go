@@ -0,0 +1,78 @@
+package fab
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestThrottleWriter(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		every int
+		in    []string // written in separate calls
+		want  string
+	}{{
+		name:  "collapse",
+		every: 1,
+		in:    []string{"start\n", "10%\r20%", "\r30%\r", "100%\n", "done\r\n"},
+		want:  "start\n100%\ndone\n",
+	}, {
+		name:  "every_third",
+		every: 3,
+		in:    []string{"1\n2\n3\n4\n", "5\n6\n7\n8\n"},
+		want:  "1\n[2 lines omitted]\n4\n[2 lines omitted]\n7\n8\n",
+	}, {
+		name:  "one_skipped_at_end",
+		every: 3,
+		in:    []string{"1\n2\n"},
+		want:  "1\n2\n",
+	}, {
+		name:  "partial_last_line",
+		every: 2,
+		in:    []string{"1\n2\n3\n4\n5"},
+		want:  "1\n[1 lines omitted]\n3\n4\n5\n",
+	}}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				buf bytes.Buffer
+				w   = &throttleWriter{w: &buf, every: tc.every}
+			)
+			for _, s := range tc.in {
+				if _, err := w.Write([]byte(s)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCommandThrottleYAML(t *testing.T) {
+	t.Parallel()
+
+	const yml = `
+Noisy: !Command
+  Shell: seq 1000
+  Throttle: 5
+`
+
+	con := NewController("")
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+	noisy, _ := con.RegistryTarget("Noisy")
+	if c := noisy.(*Command); c.Throttle != 5 {
+		t.Errorf("got Throttle %d, want 5", c.Throttle)
+	}
+}
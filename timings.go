@@ -0,0 +1,194 @@
+package fab
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bobg/errors"
+)
+
+// WriteTimings writes a table of the controller's [Results] to w,
+// slowest targets first.
+func (con *Controller) WriteTimings(w io.Writer) error {
+	results := con.Results()
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Duration > results[j].Duration
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Wall\tQueued\tStatus\tTarget")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Duration.Round(time.Millisecond), r.Queued.Round(time.Millisecond), r.Status, r.Name)
+	}
+	return tw.Flush()
+}
+
+// WriteTrace writes the controller's [Results] to w
+// in the Chrome trace-event format,
+// which can be viewed with chrome://tracing or https://ui.perfetto.dev.
+//
+// Concurrently running targets are assigned to different "threads" in the trace.
+func (con *Controller) WriteTrace(w io.Writer) error {
+	type traceEvent struct {
+		Name string         `json:"name"`
+		Cat  string         `json:"cat"`
+		Ph   string         `json:"ph"`
+		Ts   int64          `json:"ts"`  // microseconds
+		Dur  int64          `json:"dur"` // microseconds
+		Pid  int            `json:"pid"`
+		Tid  int            `json:"tid"`
+		Args map[string]any `json:"args,omitempty"`
+	}
+
+	var (
+		results  = con.Results()
+		events   = []traceEvent{} // not nil, so it encodes as []
+		lanes, _ = assignLanes(results)
+	)
+	for i, r := range results {
+		ev := traceEvent{
+			Name: r.Name,
+			Cat:  "target",
+			Ph:   "X",
+			Ts:   r.Start.Sub(results[0].Start).Microseconds(),
+			Dur:  r.Duration.Microseconds(),
+			Pid:  1,
+			Tid:  lanes[i] + 1,
+			Args: map[string]any{"status": r.Status},
+		}
+		if r.Err != nil {
+			ev.Args["error"] = r.Err.Error()
+		}
+		events = append(events, ev)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}{
+		TraceEvents: events,
+	})
+}
+
+// WriteTraceFile writes the controller's [Results] to the named file
+// using [Controller.WriteTrace].
+func (con *Controller) WriteTraceFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", filename)
+	}
+	defer f.Close()
+
+	if err = con.WriteTrace(f); err != nil {
+		return errors.Wrapf(err, "writing %s", filename)
+	}
+	return errors.Wrapf(f.Close(), "closing %s", filename)
+}
+
+// assignLanes assigns each of the given results
+// (which must be in order of start time)
+// to the lowest-numbered "lane" that is free when it starts,
+// so that targets running concurrently are in different lanes.
+// It returns the lane of each result
+// and the number of lanes.
+func assignLanes(results []Result) ([]int, int) {
+	var (
+		result = make([]int, len(results))
+		ends   []time.Time // end time of the last result in each lane
+	)
+	for i, r := range results {
+		lane := -1
+		for j, end := range ends {
+			if !end.After(r.Start) {
+				lane = j
+				break
+			}
+		}
+		if lane < 0 {
+			lane = len(ends)
+			ends = append(ends, time.Time{})
+		}
+		ends[lane] = r.Start.Add(r.Duration)
+		result[i] = lane
+	}
+	return result, len(ends)
+}
+
+// GanttWidth is the width of the chart
+// written by [Controller.WriteGantt]
+// in the fab command.
+const GanttWidth = 60
+
+// WriteGantt writes a text chart of the controller's [Results] to w,
+// showing when each target ran relative to the others,
+// so it is possible to see whether targets ran concurrently.
+// Each target gets a row,
+// in order of start time,
+// with a bar `width` characters wide at most.
+// The bar is made of # for a target that ran,
+// - for a target that was up to date,
+// and ! for a target that failed.
+// Each row also shows the target's lane
+// (see [TextStyle.Lanes]).
+func (con *Controller) WriteGantt(w io.Writer, width int) error {
+	return writeGantt(w, con.Results(), width)
+}
+
+func writeGantt(w io.Writer, results []Result, width int) error {
+	if len(results) == 0 {
+		return nil
+	}
+	lanes, nlanes := assignLanes(results)
+
+	var (
+		start = results[0].Start
+		end   time.Time
+	)
+	for _, r := range results {
+		if e := r.Start.Add(r.Duration); e.After(end) {
+			end = e
+		}
+	}
+	span := end.Sub(start)
+	if span <= 0 {
+		span = 1
+	}
+	col := func(t time.Time) int {
+		return int(int64(t.Sub(start)) * int64(width) / int64(span))
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, r := range results {
+		var (
+			from = col(r.Start)
+			to   = col(r.Start.Add(r.Duration)) - 1 // inclusive
+		)
+		if from >= width {
+			from = width - 1
+		}
+		if to < from {
+			to = from
+		}
+		ch := "#"
+		switch r.Status {
+		case StatusCached:
+			ch = "-"
+		case StatusFailed:
+			ch = "!"
+		}
+		bar := strings.Repeat(" ", from) + strings.Repeat(ch, to-from+1) + strings.Repeat(" ", width-to-1)
+		fmt.Fprintf(tw, "#%d\t%s\t|%s|\t%s\n", lanes[i]+1, r.Name, bar, r.Duration.Round(time.Millisecond))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d targets in %d lanes over %s\n", len(results), nlanes, span.Round(time.Millisecond))
+	return err
+}
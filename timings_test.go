@@ -0,0 +1,150 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestTimings(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		inpath  = filepath.Join(tmpdir, "in")
+		outpath = filepath.Join(tmpdir, "out")
+		db      = memdb(set.New[string]())
+	)
+	if err = os.WriteFile(inpath, []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		sleep = F(func(context.Context, *Controller) error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})
+		fail = F(func(context.Context, *Controller) error {
+			return fmt.Errorf("failed")
+		})
+		build = Files(Shellf("cp %s %s", inpath, outpath), []string{inpath}, []string{outpath})
+	)
+
+	ctx := context.Background()
+	ctx = WithHashDB(ctx, db)
+
+	// Run build once so it is up to date in the next controller.
+	if err = NewController(tmpdir).Run(ctx, build); err != nil {
+		t.Fatal(err)
+	}
+
+	con := NewController(tmpdir)
+	if err = con.Run(ctx, sleep, fail, build); err == nil {
+		t.Fatal("got no error")
+	}
+
+	results := con.Results()
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+
+	byTarget := make(map[Target]Result)
+	for _, r := range results {
+		byTarget[r.Target] = r
+	}
+	if r := byTarget[sleep]; r.Duration < 20*time.Millisecond || r.Status != StatusRan {
+		t.Errorf("got %+v for sleep target", r)
+	}
+	if r := byTarget[fail]; r.Status != StatusFailed || r.Err == nil {
+		t.Errorf("got %+v for failing target", r)
+	}
+	if r := byTarget[build]; r.Status != StatusCached || r.Err != nil {
+		t.Errorf("got %+v for up-to-date target", r)
+	}
+
+	buf := new(bytes.Buffer)
+	if err = con.WriteTimings(buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines of timings, want 4:\n%s", len(lines), buf)
+	}
+	if !strings.Contains(lines[1], "ran") || !strings.HasSuffix(lines[1], "F") {
+		t.Errorf("slowest target is not first:\n%s", buf)
+	}
+	if !strings.Contains(buf.String(), "cached") || !strings.Contains(buf.String(), "failed") {
+		t.Errorf("missing status in timings:\n%s", buf)
+	}
+
+	buf.Reset()
+	if err = con.WriteTrace(buf); err != nil {
+		t.Fatal(err)
+	}
+	var trace struct {
+		TraceEvents []struct {
+			Name string `json:"name"`
+			Ph   string `json:"ph"`
+			Dur  int64  `json:"dur"`
+			Tid  int    `json:"tid"`
+		} `json:"traceEvents"`
+	}
+	if err = json.Unmarshal(buf.Bytes(), &trace); err != nil {
+		t.Fatal(err)
+	}
+	if len(trace.TraceEvents) != 3 {
+		t.Fatalf("got %d trace events, want 3", len(trace.TraceEvents))
+	}
+
+	// The three targets ran concurrently,
+	// and the sleep target at least overlaps the others,
+	// so they cannot all be in the same lane.
+	tids := set.New[int]()
+	for _, ev := range trace.TraceEvents {
+		if ev.Ph != "X" {
+			t.Errorf("got event phase %s, want X", ev.Ph)
+		}
+		tids.Add(ev.Tid)
+	}
+	if tids.Len() < 2 {
+		t.Errorf("got %d lanes, want at least 2", tids.Len())
+	}
+}
+
+func TestWriteGantt(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	results := []Result{
+		{Name: "A", Start: start, Duration: 5 * time.Second, Status: StatusRan},
+		{Name: "B", Start: start.Add(time.Second), Duration: 4 * time.Second, Status: StatusCached},
+		{Name: "C", Start: start.Add(5 * time.Second), Duration: 5 * time.Second, Status: StatusFailed},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := writeGantt(buf, results, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `#1  A  |#####     |  5s
+#2  B  | ----     |  4s
+#1  C  |     !!!!!|  5s
+3 targets in 2 lanes over 10s
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,167 @@
+package fab
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+)
+
+// ReadToolVersions parses the .tool-versions file in the given directory,
+// as used by asdf (asdf-vm.com) and compatible version managers.
+// The result maps each tool name to its version.
+// Only the first version listed for a tool is used.
+// If there is no .tool-versions file,
+// the result is nil
+// with no error.
+func ReadToolVersions(dir string) (map[string]string, error) {
+	filename := filepath.Join(dir, ".tool-versions")
+	f, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %s", filename)
+	}
+	defer f.Close()
+
+	result := make(map[string]string)
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("no version for tool %s in %s", fields[0], filename)
+		}
+		result[fields[0]] = fields[1]
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrapf(err, "reading %s", filename)
+	}
+
+	return result, nil
+}
+
+// ToolEnv computes a list of VAR=VALUE environment settings
+// that make commands see the same tools and environment
+// that a developer gets interactively in the given directory.
+// The result is suitable for [WithEnv].
+//
+// If dir contains a .tool-versions file (see [ReadToolVersions]),
+// then for each tool in it,
+// ASDF_TOOL_VERSION is set to the tool's version
+// (with TOOL being the uppercased tool name),
+// which selects that version in asdf's shims;
+// and the tool's installation directory,
+// if it exists under $ASDF_DATA_DIR (default $HOME/.asdf),
+// is added to the front of PATH.
+//
+// If dir contains a .envrc file
+// and the direnv program (direnv.net) is available,
+// then the variables exported by `direnv export json` are included too.
+// The .envrc file must already be allowed with `direnv allow`.
+func ToolEnv(ctx context.Context, dir string) ([]string, error) {
+	var (
+		result []string
+		path   = os.Getenv("PATH")
+	)
+
+	envrc := filepath.Join(dir, ".envrc")
+	if _, err := os.Stat(envrc); err == nil {
+		direnv, err := exec.LookPath("direnv")
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s exists but direnv is not available", envrc)
+		}
+		cmd := exec.CommandContext(ctx, direnv, "export", "json")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "DIRENV_LOG_FORMAT=")
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, errors.Wrapf(err, "running %s export json in %s", direnv, dir)
+		}
+
+		var vars map[string]*string
+		if len(out) > 0 {
+			if err := json.Unmarshal(out, &vars); err != nil {
+				return nil, errors.Wrap(err, "decoding direnv output")
+			}
+		}
+
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			val := vars[name]
+			if val == nil || strings.HasPrefix(name, "DIRENV_") {
+				continue
+			}
+			if name == "PATH" {
+				path = *val
+				continue
+			}
+			result = append(result, name+"="+*val)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, errors.Wrapf(err, "statting %s", envrc)
+	}
+
+	versions, err := ReadToolVersions(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	tools := make([]string, 0, len(versions))
+	for tool := range versions {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+
+	asdfDir := os.Getenv("ASDF_DATA_DIR")
+	if asdfDir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			asdfDir = filepath.Join(home, ".asdf")
+		}
+	}
+
+	var bindirs []string
+	for _, tool := range tools {
+		version := versions[tool]
+		envname := "ASDF_" + strings.ToUpper(strings.ReplaceAll(tool, "-", "_")) + "_VERSION"
+		result = append(result, envname+"="+version)
+
+		if asdfDir == "" {
+			continue
+		}
+		bindir := filepath.Join(asdfDir, "installs", tool, version, "bin")
+		if info, err := os.Stat(bindir); err == nil && info.IsDir() {
+			bindirs = append(bindirs, bindir)
+		}
+	}
+
+	if len(bindirs) > 0 {
+		if path != "" {
+			bindirs = append(bindirs, path)
+		}
+		path = strings.Join(bindirs, string(filepath.ListSeparator))
+	}
+	if path != os.Getenv("PATH") {
+		result = append(result, "PATH="+path)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,92 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToolEnv(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		projdir = filepath.Join(tmpdir, "proj")
+		asdfDir = filepath.Join(tmpdir, "asdf")
+		bindir  = filepath.Join(asdfDir, "installs", "nodejs", "18.1.0", "bin")
+	)
+	if err = os.MkdirAll(projdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(bindir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	const toolVersions = `
+# Tools for this project.
+nodejs 18.1.0
+golang-ci 1.21.0 1.20.0 # first one wins
+`
+	if err = os.WriteFile(filepath.Join(projdir, ".tool-versions"), []byte(toolVersions), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("ASDF_DATA_DIR", asdfDir)
+	t.Setenv("PATH", "/bin:/usr/bin")
+
+	versions, err := ReadToolVersions(projdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantVersions := map[string]string{"nodejs": "18.1.0", "golang-ci": "1.21.0"}
+	if !reflect.DeepEqual(versions, wantVersions) {
+		t.Errorf("got versions %v, want %v", versions, wantVersions)
+	}
+
+	ctx := context.Background()
+
+	env, err := ToolEnv(ctx, projdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantEnv := []string{
+		"ASDF_GOLANG_CI_VERSION=1.21.0",
+		"ASDF_NODEJS_VERSION=18.1.0",
+		"PATH=" + bindir + ":/bin:/usr/bin",
+	}
+	if !reflect.DeepEqual(env, wantEnv) {
+		t.Errorf("got env %v, want %v", env, wantEnv)
+	}
+
+	ctx = WithEnv(ctx, env)
+
+	buf := new(bytes.Buffer)
+	cmd := &Command{
+		Shell:  "echo $ASDF_NODEJS_VERSION $ASDF_GOLANG_CI_VERSION",
+		Stdout: buf,
+		Env:    []string{"ASDF_GOLANG_CI_VERSION=override"},
+	}
+	con := NewController(projdir)
+	if err = con.Run(ctx, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "18.1.0 override" {
+		t.Errorf("got command output %q, want %q", got, "18.1.0 override")
+	}
+
+	// No .tool-versions or .envrc: no environment.
+	env, err = ToolEnv(context.Background(), tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env) != 0 {
+		t.Errorf("got env %v, want none", env)
+	}
+}
@@ -0,0 +1,125 @@
+package fab
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+)
+
+// ToolDigest is the value of a [Command]'s HashTool field
+// that puts a digest of the command's executable file
+// into the hash of a [Files] target.
+const ToolDigest = "digest"
+
+// toolHashInputs returns the tool identities that go into the hash of ft,
+// for each [Command] in its subtarget with a HashTool setting,
+// as a list of [path, hash, path, hash, ...]
+// sorted by path.
+// The path is the resolved path of the command's executable,
+// and the hash is a digest of either the executable itself
+// or its version output,
+// according to HashTool.
+// A tool that cannot be found has its name in place of the path,
+// and an empty hash.
+func (ft *files) toolHashInputs(ctx context.Context, con *Controller) ([]string, error) {
+	hashes := make(map[string]string)
+	for _, c := range con.commands(ft.Target) {
+		if c.HashTool == "" {
+			continue
+		}
+		name := c.toolName()
+		if name == "" {
+			continue
+		}
+		if c.Dir != "" && !filepath.IsAbs(name) && strings.ContainsAny(name, `/`+string(filepath.Separator)) {
+			// A relative path to the program is relative to the command's directory.
+			name = filepath.Join(c.Dir, name)
+			if !strings.ContainsRune(name, filepath.Separator) {
+				name = "." + string(filepath.Separator) + name // keep LookPath from searching PATH
+			}
+		}
+		path, err := exec.LookPath(name)
+		if err != nil {
+			hashes[name] = ""
+			continue
+		}
+		h, err := con.toolHash(ctx, path, c.HashTool)
+		if err != nil {
+			return nil, errors.Wrapf(err, "identifying %s", path)
+		}
+		hashes[path] = h
+	}
+
+	paths := make([]string, 0, len(hashes))
+	for path := range hashes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	result := make([]string, 0, 2*len(paths))
+	for _, path := range paths {
+		result = append(result, path, hashes[path])
+	}
+	return result, nil
+}
+
+// toolName is the name of the program that c runs:
+// Cmd if it is set,
+// and otherwise the first word of Shell.
+func (c *Command) toolName() string {
+	if c.Cmd != "" {
+		return c.Cmd
+	}
+	if words := strings.Fields(c.Shell); len(words) > 0 {
+		return words[0]
+	}
+	return ""
+}
+
+// toolHash identifies the executable at path
+// according to mode,
+// which is either [ToolDigest]
+// or the space-separated arguments that make the program print its version
+// (see Command.HashTool).
+// Results are remembered for the life of con,
+// so each tool is run for its version at most once.
+func (con *Controller) toolHash(ctx context.Context, path, mode string) (string, error) {
+	key := path + "\x00" + mode
+
+	con.mu.Lock()
+	h, ok := con.toolHashes[key]
+	con.mu.Unlock()
+	if ok {
+		return h, nil
+	}
+
+	if mode == ToolDigest {
+		var err error
+		if h, err = hashFile(path); err != nil {
+			return "", err
+		}
+	} else {
+		cmd := exec.CommandContext(ctx, path, strings.Fields(mode)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", CommandErr{Err: errors.Wrapf(err, "running %s %s", path, mode), Output: out}
+		}
+		sum := sha256.Sum224(out)
+		h = hex.EncodeToString(sum[:])
+	}
+
+	con.mu.Lock()
+	if con.toolHashes == nil {
+		con.toolHashes = make(map[string]string)
+	}
+	con.toolHashes[key] = h
+	con.mu.Unlock()
+
+	return h, nil
+}
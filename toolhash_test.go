@@ -0,0 +1,122 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestToolHash(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test tool is a shell script")
+	}
+
+	cases := []struct {
+		mode    string
+		script  string
+		edit    string // same version output, different file
+		upgrade string
+	}{{
+		mode:    "--version",
+		script:  "#!/bin/sh\necho tool 1.0\n",
+		edit:    "#!/bin/sh\n# comment\necho tool 1.0\n",
+		upgrade: "#!/bin/sh\necho tool 2.0\n",
+	}, {
+		mode:    ToolDigest,
+		script:  "#!/bin/sh\necho tool 1.0\n",
+		edit:    "#!/bin/sh\necho tool 1.0\n",
+		upgrade: "#!/bin/sh\necho tool 2.0\n",
+	}}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.mode, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				tmpdir = t.TempDir()
+				tool   = filepath.Join(tmpdir, "tool")
+				db     = &recdb{memdb: memdb(set.New[string]())}
+				ctx    = WithHashDB(context.Background(), db)
+			)
+
+			writeTool := func(script string) {
+				t.Helper()
+				if err := os.WriteFile(tool, []byte(script), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			steps := []struct {
+				script  string
+				wantRun bool
+			}{
+				{script: tc.script, wantRun: true},
+				{script: tc.script, wantRun: false},
+				{script: tc.edit, wantRun: false},
+				{script: tc.upgrade, wantRun: true},
+			}
+			for i, step := range steps {
+				writeTool(step.script)
+
+				con := NewController(tmpdir)
+				target, err := con.RegisterTarget("Build", "", Files(&Command{Cmd: tool, HashTool: tc.mode}, nil, nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if i == len(steps)-1 {
+					r, err := con.WhyRebuild(ctx, target)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if want := []string{tool}; !reflect.DeepEqual(r.ToolsChanged, want) {
+						t.Errorf("got tools changed %v, want %v", r.ToolsChanged, want)
+					}
+				}
+
+				if err := con.Run(ctx, target); err != nil {
+					t.Fatal(err)
+				}
+				want := StatusCached
+				if step.wantRun {
+					want = StatusRan
+				}
+				var found bool
+				for _, r := range con.Results() {
+					if r.Target != target {
+						continue
+					}
+					found = true
+					if r.Status != want {
+						t.Errorf("step %d: got status %s, want %s", i, r.Status, want)
+					}
+				}
+				if !found {
+					t.Errorf("step %d: no result for target", i)
+				}
+			}
+		})
+	}
+}
+
+func TestToolName(t *testing.T) {
+	cases := []struct {
+		cmd  Command
+		want string
+	}{
+		{cmd: Command{Cmd: "protoc", Args: []string{"--version"}}, want: "protoc"},
+		{cmd: Command{Shell: "  go build ./..."}, want: "go"},
+		{cmd: Command{}, want: ""},
+	}
+	for _, tc := range cases {
+		if got := tc.cmd.toolName(); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+}
@@ -16,6 +16,10 @@ import (
 // The top directory is the one containing a _fab subdirectory
 // or (since that might not exist)
 // the one that fab.yaml files' _dir declarations are relative to.
+// A _dir declaration takes precedence,
+// so a subdirectory of a project may have its own _fab package
+// (see [CompilePackages])
+// as long as it also has a fab.yaml file declaring its place in the project.
 //
 // If TopDir can't find the answer in dir,
 // it will look in dir's parent,
@@ -28,14 +32,6 @@ func TopDir(dir string) (string, error) {
 	}
 
 	for {
-		info, err := os.Stat(filepath.Join(dir, "_fab"))
-		if err == nil && info.IsDir() {
-			return dir, nil
-		}
-		if err != nil && !errors.Is(err, fs.ErrNotExist) {
-			return "", errors.Wrapf(err, "statting %s/_fab", dir)
-		}
-
 		result, err := topDirHelper(dir)
 		if err != nil {
 			return "", err
@@ -44,6 +40,14 @@ func TopDir(dir string) (string, error) {
 			return result, nil
 		}
 
+		info, err := os.Stat(filepath.Join(dir, "_fab"))
+		if err == nil && info.IsDir() {
+			return dir, nil
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", errors.Wrapf(err, "statting %s/_fab", dir)
+		}
+
 		parent := filepath.Dir(dir)
 		if parent == dir {
 			return "", fmt.Errorf("top directory not found")
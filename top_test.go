@@ -52,6 +52,10 @@ func TestTopDir(t *testing.T) {
 		name: "case9",
 		dir:  "case9/subdir1",
 		want: "case9",
+	}, {
+		name: "case10",
+		dir:  "case10/foo", // has its own _fab, but fab.yaml says it's a subdir
+		want: "case10",
 	}}
 
 	tmpdir, err := os.MkdirTemp("", "fab")
@@ -101,4 +101,5 @@ func declsDecoder(con *fab.Controller, node *yaml.Node, dir string) (fab.Target,
 
 func init() {
 	fab.RegisterYAMLTarget("ts.Decls", declsDecoder)
+	fab.SetYAMLTagDoc("ts.Decls", "Write TypeScript type declarations for a Go type.")
 }
@@ -0,0 +1,521 @@
+package fab
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bobg/errors"
+)
+
+// RunUI runs the given targets like [Controller.Run],
+// while showing a full-screen, interactive display of their progress
+// on the terminal connected to in and out.
+//
+// The display shows the tree of targets that have started,
+// each with its state (running, done, cached, failed, or canceled)
+// and its running time.
+// These keys are recognized:
+//
+//   - up and down arrows (or k and j) select a target;
+//   - enter (or space) expands or collapses the output of the selected target;
+//   - c cancels the selected target, if it is running (see [Controller.Cancel]);
+//   - q (or control-C) cancels any running targets and quits.
+//
+// When the targets finish,
+// the display remains until q is pressed.
+//
+// The targets are run in verbose mode (see [WithVerbose]),
+// so that the output of each [Command] can be shown,
+// and the controller's progress sink is replaced for the duration of the call
+// (see [Controller.SetProgressSink]).
+// The terminal is put into "raw" mode using the stty command,
+// so this works only on systems that have one.
+func (con *Controller) RunUI(ctx context.Context, in *os.File, out io.Writer, targets ...Target) error {
+	if !IsTerminal(in) {
+		return fmt.Errorf("%s is not a terminal", in.Name())
+	}
+
+	restore, err := rawMode(in)
+	if err != nil {
+		return errors.Wrap(err, "setting terminal to raw mode")
+	}
+	defer restore()
+
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l") // Switch to the alternate screen and hide the cursor.
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	u := newTUI(con, time.Now())
+
+	prev := con.ProgressSink()
+	con.SetProgressSink(u)
+	defer con.SetProgressSink(prev)
+
+	ctx, cancel := context.WithCancel(WithVerbose(ctx, true))
+	defer cancel()
+
+	var (
+		keys = make(chan string)
+		done = make(chan error, 1)
+	)
+	go readKeys(in, keys)
+	go func() {
+		done <- con.Run(ctx, targets...)
+	}()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	var (
+		rows, cols = terminalSize(in)
+		ticks      int
+		quitting   bool
+	)
+
+	for {
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				// Input is closed, so there is no way to quit later.
+				keys = nil
+				quitting = true
+				cancel()
+				if u.isFinished() {
+					return u.result()
+				}
+				continue
+			}
+			if !u.key(key) {
+				continue
+			}
+			quitting = true
+			cancel()
+			if u.isFinished() {
+				return u.result()
+			}
+
+		case err := <-done:
+			u.finish(time.Now(), err)
+			if quitting {
+				return err
+			}
+
+		case now := <-ticker.C:
+			ticks++
+			if ticks%10 == 0 {
+				rows, cols = terminalSize(in)
+			}
+			var buf strings.Builder
+			u.render(&buf, now, cols, rows)
+			io.WriteString(out, buf.String())
+		}
+	}
+}
+
+// tui is the state of the display produced by RunUI.
+// It is the controller's progress sink during the call.
+type tui struct {
+	con *Controller
+
+	mu       sync.Mutex
+	start    time.Time
+	nodes    map[uintptr]*tuiNode
+	roots    []*tuiNode
+	selected *tuiNode
+	messages []string
+	finished bool
+	end      time.Time
+	err      error
+}
+
+type tuiNode struct {
+	target   Target
+	desc     string
+	parent   *tuiNode
+	children []*tuiNode
+
+	state      string
+	start, end time.Time
+
+	output   []string // complete lines, at most tuiMaxOutputLines of them
+	partial  string   // an incomplete last line of output
+	expanded bool
+}
+
+const (
+	tuiMaxOutputLines = 1000 // lines of output to keep for each target
+	tuiExpandLines    = 10   // lines of output to show for an expanded target
+	tuiMessageLines   = 3    // lines of messages to show
+)
+
+func newTUI(con *Controller, start time.Time) *tui {
+	return &tui{
+		con:   con,
+		start: start,
+		nodes: make(map[uintptr]*tuiNode),
+	}
+}
+
+func (u *tui) Progress(ev ProgressEvent) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	switch ev.Kind {
+	case ProgressStart:
+		addr, err := targetAddr(ev.Target)
+		if err != nil {
+			return
+		}
+		node := &tuiNode{target: ev.Target, desc: ev.Desc, state: "running", start: ev.Time}
+		u.nodes[addr] = node
+		if ev.Parent != nil {
+			if parentAddr, err := targetAddr(ev.Parent); err == nil {
+				node.parent = u.nodes[parentAddr]
+			}
+		}
+		if node.parent != nil {
+			node.parent.children = append(node.parent.children, node)
+		} else {
+			u.roots = append(u.roots, node)
+		}
+		if u.selected == nil {
+			u.selected = node
+		}
+
+	case ProgressDone:
+		node := u.node(ev.Target)
+		if node == nil {
+			return
+		}
+		node.end = ev.Time
+		switch {
+		case node.state == "canceled":
+		case ev.Err != nil:
+			node.state = "failed"
+		case ev.Cached:
+			node.state = "cached"
+		default:
+			node.state = "done"
+		}
+
+	case ProgressOutput:
+		node := u.node(ev.Target)
+		if node == nil {
+			return
+		}
+		lines := strings.Split(node.partial+string(ev.Data), "\n")
+		node.partial = lines[len(lines)-1]
+		node.output = append(node.output, lines[:len(lines)-1]...)
+		if n := len(node.output); n > tuiMaxOutputLines {
+			node.output = node.output[n-tuiMaxOutputLines:]
+		}
+
+	case ProgressMessage:
+		u.messages = append(u.messages, ev.Message)
+		if n := len(u.messages); n > tuiMessageLines {
+			u.messages = u.messages[n-tuiMessageLines:]
+		}
+	}
+}
+
+// node returns the node for target,
+// or nil if there is none.
+// The caller must hold u.mu.
+func (u *tui) node(target Target) *tuiNode {
+	addr, err := targetAddr(target)
+	if err != nil {
+		return nil
+	}
+	return u.nodes[addr]
+}
+
+// finish records the end of the run.
+func (u *tui) finish(end time.Time, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.finished, u.end, u.err = true, end, err
+}
+
+func (u *tui) isFinished() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.finished
+}
+
+func (u *tui) result() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.err
+}
+
+// key handles a keypress,
+// reporting whether it is a request to quit.
+func (u *tui) key(key string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	switch key {
+	case "q":
+		return true
+
+	case "up", "down":
+		nodes := u.visible()
+		for i, node := range nodes {
+			if node != u.selected {
+				continue
+			}
+			if key == "up" && i > 0 {
+				u.selected = nodes[i-1]
+			} else if key == "down" && i < len(nodes)-1 {
+				u.selected = nodes[i+1]
+			}
+			break
+		}
+
+	case "enter":
+		if u.selected != nil {
+			u.selected.expanded = !u.selected.expanded
+		}
+
+	case "c":
+		if u.selected != nil && u.selected.state == "running" && u.con.Cancel(u.selected.target) {
+			u.selected.state = "canceled"
+		}
+	}
+
+	return false
+}
+
+// visible returns the nodes in the order they are displayed.
+// The caller must hold u.mu.
+func (u *tui) visible() []*tuiNode {
+	var (
+		result []*tuiNode
+		walk   func([]*tuiNode)
+	)
+	walk = func(nodes []*tuiNode) {
+		for _, node := range nodes {
+			result = append(result, node)
+			walk(node.children)
+		}
+	}
+	walk(u.roots)
+	return result
+}
+
+// depth returns the number of ancestors of node.
+func (node *tuiNode) depth() int {
+	var d int
+	for p := node.parent; p != nil; p = p.parent {
+		d++
+	}
+	return d
+}
+
+// render writes the display to w,
+// sized for a terminal of the given width and height.
+func (u *tui) render(w io.Writer, now time.Time, width, height int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.finished {
+		now = u.end
+	}
+
+	var (
+		counts   = make(map[string]int)
+		body     []string
+		selected int
+	)
+	for _, node := range u.visible() {
+		counts[node.state]++
+
+		cursor := "  "
+		if node == u.selected {
+			cursor = "> "
+			selected = len(body)
+		}
+		marker := " "
+		if len(node.output) > 0 || node.partial != "" {
+			marker = "+"
+			if node.expanded {
+				marker = "-"
+			}
+		}
+		end := now
+		if !node.end.IsZero() {
+			end = node.end
+		}
+		indent := strings.Repeat("  ", node.depth())
+		body = append(body, fmt.Sprintf("%s%s%s %-8s %s (%s)", cursor, indent, marker, node.state, node.desc, end.Sub(node.start).Round(time.Millisecond)))
+
+		if node.expanded {
+			output := node.output
+			if node.partial != "" {
+				output = append(output[:len(output):len(output)], node.partial)
+			}
+			if n := len(output); n > tuiExpandLines {
+				output = output[n-tuiExpandLines:]
+			}
+			for _, line := range output {
+				body = append(body, fmt.Sprintf("  %s    | %s", indent, line))
+			}
+		}
+	}
+
+	status := "running"
+	if u.finished {
+		status = "finished"
+		if u.err != nil {
+			status = "failed"
+		}
+	}
+	header := fmt.Sprintf("fab: %s [%s] %d running, %d done, %d cached, %d failed, %d canceled", status, now.Sub(u.start).Round(time.Second), counts["running"], counts["done"], counts["cached"], counts["failed"], counts["canceled"])
+	footer := "up/down: select  enter: show output  c: cancel  q: quit"
+	if u.finished {
+		footer = "up/down: select  enter: show output  q: quit"
+	}
+
+	// Scroll the body so the selected target is visible.
+	room := height - 2 - len(u.messages)
+	if room < 1 {
+		room = 1
+	}
+	if len(body) > room {
+		first := selected - room/2
+		if first < 0 {
+			first = 0
+		}
+		if first > len(body)-room {
+			first = len(body) - room
+		}
+		body = body[first : first+room]
+	}
+
+	lines := []string{header}
+	lines = append(lines, body...)
+	for len(lines) < height-1-len(u.messages) {
+		lines = append(lines, "")
+	}
+	lines = append(lines, u.messages...)
+	lines = append(lines, footer)
+
+	fmt.Fprint(w, "\x1b[H") // Move the cursor to the top left.
+	for i, line := range lines {
+		if width > 1 && utf8.RuneCountInString(line) > width-1 {
+			line = string([]rune(line)[:width-1])
+		}
+		fmt.Fprint(w, line, "\x1b[K")
+		if i < len(lines)-1 {
+			fmt.Fprint(w, "\r\n")
+		}
+	}
+	fmt.Fprint(w, "\x1b[J") // Clear the rest of the screen.
+}
+
+// readKeys reads keypresses from r and sends them to ch,
+// translating escape sequences for the arrow keys
+// and some synonyms.
+// It closes ch at the end of the input.
+func readKeys(r io.Reader, ch chan<- string) {
+	defer close(ch)
+
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return
+		}
+		switch b {
+		case 3: // control-C
+			ch <- "q"
+
+		case '\r', '\n', ' ':
+			ch <- "enter"
+
+		case 'k':
+			ch <- "up"
+
+		case 'j':
+			ch <- "down"
+
+		case 0x1b:
+			// Arrow keys send ESC [ A (up) and ESC [ B (down).
+			if b, err = br.ReadByte(); err != nil {
+				return
+			}
+			if b != '[' {
+				continue
+			}
+			if b, err = br.ReadByte(); err != nil {
+				return
+			}
+			switch b {
+			case 'A':
+				ch <- "up"
+			case 'B':
+				ch <- "down"
+			}
+
+		default:
+			ch <- string(rune(b))
+		}
+	}
+}
+
+// rawMode puts the terminal f into raw mode,
+// returning a function that restores its previous mode.
+func rawMode(f *os.File) (func() error, error) {
+	cmd := exec.Command("stty", "-g")
+	cmd.Stdin = f
+	saved, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrap(err, "saving terminal mode")
+	}
+
+	cmd = exec.Command("stty", "raw", "-echo")
+	cmd.Stdin = f
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrap(err, "setting raw mode")
+	}
+
+	restore := func() error {
+		cmd := exec.Command("stty", strings.TrimSpace(string(saved)))
+		cmd.Stdin = f
+		return cmd.Run()
+	}
+	return restore, nil
+}
+
+// terminalSize returns the number of rows and columns of the terminal f,
+// falling back to the LINES and COLUMNS environment variables
+// (and then to 24 and 80).
+func terminalSize(f *os.File) (rows, cols int) {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = f
+	if out, err := cmd.Output(); err == nil {
+		if fields := strings.Fields(string(out)); len(fields) == 2 {
+			rows, _ = strconv.Atoi(fields[0])
+			cols, _ = strconv.Atoi(fields[1])
+		}
+	}
+	if rows <= 0 {
+		rows = 24
+		if n, err := strconv.Atoi(os.Getenv("LINES")); err == nil && n > 0 {
+			rows = n
+		}
+	}
+	if cols <= 0 {
+		cols = terminalWidth()
+	}
+	return rows, cols
+}
@@ -0,0 +1,135 @@
+package fab
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTUI(t *testing.T) {
+	var (
+		con    = NewController("")
+		t0     = time.Now()
+		u      = newTUI(con, t0)
+		build  = &countTarget{}
+		test   = &countTarget{}
+		vet    = &countTarget{}
+		render = func(secs int) []string {
+			var buf strings.Builder
+			u.render(&buf, t0.Add(time.Duration(secs)*time.Second), 80, 10)
+			s := strings.ReplaceAll(buf.String(), "\x1b[K", "")
+			s = strings.TrimPrefix(s, "\x1b[H")
+			s = strings.TrimSuffix(s, "\x1b[J")
+			return strings.Split(s, "\r\n")
+		}
+	)
+
+	u.Progress(ProgressEvent{Kind: ProgressStart, Time: t0, Target: build, Desc: "Build"})
+	u.Progress(ProgressEvent{Kind: ProgressStart, Time: t0, Target: test, Desc: "Test", Parent: build})
+	u.Progress(ProgressEvent{Kind: ProgressStart, Time: t0, Target: vet, Desc: "Vet", Parent: build})
+	u.Progress(ProgressEvent{Kind: ProgressOutput, Time: t0, Target: test, Data: []byte("line 1\nline")})
+	u.Progress(ProgressEvent{Kind: ProgressOutput, Time: t0, Target: test, Data: []byte(" 2\n")})
+	u.Progress(ProgressEvent{Kind: ProgressDone, Time: t0.Add(time.Second), Target: vet, Err: errors.New("oops")})
+	u.Progress(ProgressEvent{Kind: ProgressMessage, Message: "hello"})
+
+	u.key("down")
+	u.key("enter")
+
+	want := []string{
+		"fab: running [2s] 2 running, 0 done, 0 cached, 1 failed, 0 canceled",
+		"    running  Build (2s)",
+		">   - running  Test (2s)",
+		"        | line 1",
+		"        | line 2",
+		"      failed   Vet (1s)",
+		"",
+		"",
+		"hello",
+		"up/down: select  enter: show output  c: cancel  q: quit",
+	}
+	if got := render(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	u.key("down")
+	u.key("down") // no further
+	u.key("up")
+	u.key("enter")
+	u.Progress(ProgressEvent{Kind: ProgressDone, Time: t0.Add(3 * time.Second), Target: test, Cached: true})
+	u.Progress(ProgressEvent{Kind: ProgressDone, Time: t0.Add(3 * time.Second), Target: build})
+	u.finish(t0.Add(3*time.Second), nil)
+
+	want = []string{
+		"fab: finished [3s] 0 running, 1 done, 1 cached, 1 failed, 0 canceled",
+		"    done     Build (3s)",
+		">   + cached   Test (3s)",
+		"      failed   Vet (1s)",
+		"",
+		"",
+		"",
+		"",
+		"hello",
+		"up/down: select  enter: show output  q: quit",
+	}
+	if got := render(5); !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if !u.key("q") {
+		t.Error("q did not quit")
+	}
+}
+
+func TestReadKeys(t *testing.T) {
+	ch := make(chan string)
+	go readKeys(strings.NewReader("j\x1b[Ak\r c\x03\x1bx"), ch)
+
+	var got []string
+	for key := range ch {
+		got = append(got, key)
+	}
+	if want := []string{"down", "up", "up", "enter", "enter", "c", "q"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	var (
+		con     = NewController("")
+		started = make(chan struct{})
+		cause   error
+	)
+	target := F(func(ctx context.Context, _ *Controller) error {
+		close(started)
+		<-ctx.Done()
+		cause = context.Cause(ctx)
+		return ctx.Err()
+	})
+
+	if con.Cancel(target) {
+		t.Error("canceled a target that was not running")
+	}
+
+	errch := make(chan error, 1)
+	go func() {
+		errch <- con.Run(context.Background(), target)
+	}()
+
+	<-started
+	if !con.Cancel(target) {
+		t.Error("did not cancel the running target")
+	}
+	if err := <-errch; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+	if !errors.Is(cause, ErrCanceled) {
+		t.Errorf("got cause %v, want ErrCanceled", cause)
+	}
+
+	if con.Cancel(target) {
+		t.Error("canceled a target that already finished")
+	}
+}
@@ -0,0 +1,296 @@
+package fab
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// readVarsDecl handles the _vars declaration in a fab.yaml file.
+// It is a mapping from variable names to values.
+// A value may refer to variables declared earlier.
+//
+// Variables declared in a YAML file are in scope
+// in that file
+// and in the YAML files of its subdirectories.
+// See [Controller.Var].
+//
+// Example:
+//
+//	_vars:
+//	  OUT: build
+//	  BIN: ${OUT}/bin
+func (con *Controller) readVarsDecl(node *yaml.Node, dir string) error {
+	if node.Kind != yaml.MappingNode {
+		return BadYAMLNodeKindError{Got: node.Kind, Want: yaml.MappingNode}
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		var (
+			nameNode  = node.Content[i]
+			valueNode = node.Content[i+1]
+		)
+		if nameNode.Kind != yaml.ScalarNode {
+			return BadYAMLNodeKindError{Got: nameNode.Kind, Want: yaml.ScalarNode}
+		}
+		if valueNode.Kind != yaml.ScalarNode {
+			return BadYAMLNodeKindError{Got: valueNode.Kind, Want: yaml.ScalarNode}
+		}
+		name := nameNode.Value
+		if !varNameRegex.MatchString(name) {
+			return fmt.Errorf("bad variable name %q", name)
+		}
+		value := con.Interpolate(valueNode.Value, dir)
+
+		con.mu.Lock()
+		if con.vars == nil {
+			con.vars = make(map[string]map[string]string)
+		}
+		if con.vars[dir] == nil {
+			con.vars[dir] = make(map[string]string)
+		}
+		con.vars[dir][name] = value
+		con.mu.Unlock()
+	}
+	return nil
+}
+
+var (
+	varNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	varRefRegex  = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`) // also matches an escaped $${NAME}
+)
+
+// SetVar sets the value of a variable,
+// overriding any value from a _vars declaration in a YAML file
+// or from the environment.
+// See [Controller.Var].
+//
+// Variables must be set before reading the YAML files that use them.
+func (con *Controller) SetVar(name, value string) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	if con.varOverrides == nil {
+		con.varOverrides = make(map[string]string)
+	}
+	con.varOverrides[name] = value
+}
+
+// ParseVarArgs calls [Controller.SetVar] for each NAME=value argument in args
+// that precedes the first argument beginning with "-".
+// It returns the remaining arguments.
+//
+// This allows a command line like
+//
+//	fab OUT=/tmp/build Build
+//
+// to override the variable OUT.
+func (con *Controller) ParseVarArgs(args []string) []string {
+	var (
+		result   []string
+		sawFlags bool
+	)
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			sawFlags = true
+		}
+		if !sawFlags {
+			if name, value, ok := strings.Cut(arg, "="); ok && varNameRegex.MatchString(name) {
+				con.SetVar(name, value)
+				continue
+			}
+		}
+		result = append(result, arg)
+	}
+	return result
+}
+
+// Var returns the value of the variable with the given name
+// as seen by the YAML file in the given directory,
+// and a boolean telling whether the variable is defined.
+//
+// A variable is defined if it was set with [Controller.SetVar]
+// (e.g. on the command line),
+// or if it appears in the _vars declaration
+// of the YAML file in dir or in any of its parent directories.
+// The value is taken from the first of these places that has one:
+//
+//   - the value set with SetVar;
+//   - the environment variable of the same name;
+//   - the nearest _vars declaration.
+func (con *Controller) Var(name, dir string) (string, bool) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	if value, ok := con.varOverrides[name]; ok {
+		return value, true
+	}
+
+	for {
+		if value, ok := con.vars[dir][name]; ok {
+			if envval, ok := os.LookupEnv(name); ok {
+				return envval, true
+			}
+			return value, true
+		}
+		if dir == "" {
+			return "", false
+		}
+		dir = filepath.Dir(dir)
+		if dir == "." || dir == "/" {
+			dir = ""
+		}
+	}
+}
+
+// Interpolate replaces each ${NAME} in s
+// with the value of the variable NAME
+// as seen by the YAML file in the given directory.
+// See [Controller.Var].
+// References to undefined variables are left unchanged,
+// so that they may be interpreted by a shell.
+// So are escaped references of the form $${NAME}
+// (see [Command.Expand]).
+func (con *Controller) Interpolate(s, dir string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+	return varRefRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref
+		}
+		name := ref[2 : len(ref)-1]
+		if value, ok := con.Var(name, dir); ok {
+			return value
+		}
+		return ref
+	})
+}
+
+// interpolateYAML returns a copy of node
+// with [Controller.Interpolate] applied to all scalar values.
+func (con *Controller) interpolateYAML(node *yaml.Node, dir string) *yaml.Node {
+	return substYAML(node, func(s string) string { return con.Interpolate(s, dir) })
+}
+
+// varScope returns all the variables
+// as seen by the YAML file in the given directory,
+// with the values that [Controller.Var] would return.
+func (con *Controller) varScope(dir string) map[string]string {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	result := make(map[string]string)
+	for {
+		for name, value := range con.vars[dir] {
+			if _, ok := result[name]; ok {
+				continue // a nearer declaration takes precedence
+			}
+			if envval, ok := os.LookupEnv(name); ok {
+				value = envval
+			}
+			result[name] = value
+		}
+		if dir == "" {
+			break
+		}
+		dir = filepath.Dir(dir)
+		if dir == "." || dir == "/" {
+			dir = ""
+		}
+	}
+	for name, value := range con.varOverrides {
+		result[name] = value
+	}
+	return result
+}
+
+// outTemplateData returns the data
+// against which the templates in the Out lists of the YAML target named `name` are evaluated.
+// See expandOutTemplates.
+func (con *Controller) outTemplateData(name, dir string) map[string]string {
+	result := map[string]string{
+		"TargetName": name,
+		"Dir":        dir,
+		"GOOS":       runtime.GOOS,
+		"GOARCH":     runtime.GOARCH,
+	}
+	for _, v := range []string{"GOOS", "GOARCH"} {
+		if value := os.Getenv(v); value != "" {
+			result[v] = value
+		}
+	}
+	for name, value := range con.varScope(dir) {
+		result[name] = value
+	}
+	return result
+}
+
+// expandOutTemplates returns a copy of node
+// in which the value of each mapping entry named Out
+// (such as the output-file list of a [Files] target)
+// has its scalars evaluated as [text/template] templates
+// against the given data.
+// This allows a YAML target to declare outputs like
+//
+//	Out: [dist/{{.TargetName}}/{{.GOOS}}/app]
+//
+// The data includes TargetName
+// (the name of the YAML target, without its directory),
+// Dir
+// (the directory of the YAML file, relative to the top directory),
+// GOOS and GOARCH
+// (from the environment, or else those of the running program),
+// and the variables in scope
+// (see [Controller.Var]),
+// which override those.
+// A reference to anything else is an error.
+func expandOutTemplates(node *yaml.Node, data map[string]string) (*yaml.Node, error) {
+	var err error
+	f := func(s string) string {
+		if err != nil || !strings.Contains(s, "{{") {
+			return s
+		}
+		var (
+			tmpl *template.Template
+			buf  strings.Builder
+		)
+		tmpl, err = template.New("").Option("missingkey=error").Parse(s)
+		if err != nil {
+			err = errors.Wrapf(err, "parsing template %q", s)
+			return s
+		}
+		if err = tmpl.Execute(&buf, data); err != nil {
+			err = errors.Wrapf(err, "executing template %q", s)
+			return s
+		}
+		return buf.String()
+	}
+	result := substOut(node, f)
+	return result, err
+}
+
+// substOut returns a deep copy of node
+// with f applied to all the scalar values
+// within the value of each mapping entry named Out.
+func substOut(node *yaml.Node, f func(string) string) *yaml.Node {
+	result := *node
+	if len(node.Content) > 0 {
+		result.Content = make([]*yaml.Node, 0, len(node.Content))
+		for i, child := range node.Content {
+			if node.Kind == yaml.MappingNode && i%2 == 1 && node.Content[i-1].Value == "Out" {
+				child = substYAML(child, f)
+			} else {
+				child = substOut(child, f)
+			}
+			result.Content = append(result.Content, child)
+		}
+	}
+	return &result
+}
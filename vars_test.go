@@ -0,0 +1,167 @@
+package fab
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVars(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		args      []string
+		wantShell string
+		wantIn    []string
+		wantSub   string
+		wantArgs  []string
+	}{{
+		name:      "default",
+		args:      []string{"Hello"},
+		wantShell: "echo hello ${UNDECLARED}",
+		wantIn:    []string{"build/bin/prog"},
+		wantSub:   "build/sub",
+		wantArgs:  []string{"Hello"},
+	}, {
+		name:      "override",
+		args:      []string{"OUT=/tmp/out", "Hello", "-x", "Y=z"},
+		wantShell: "echo hello ${UNDECLARED}",
+		wantIn:    []string{"/tmp/out/bin/prog"},
+		wantSub:   "/tmp/out/sub",
+		wantArgs:  []string{"Hello", "-x", "Y=z"},
+	}}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			con := NewController("_testdata/vars")
+			gotArgs := con.ParseVarArgs(tc.args)
+			if !reflect.DeepEqual(gotArgs, tc.wantArgs) {
+				t.Errorf("got args %v, want %v", gotArgs, tc.wantArgs)
+			}
+
+			if err := con.ReadYAMLFile(""); err != nil {
+				t.Fatal(err)
+			}
+
+			hello, _ := con.RegistryTarget("Hello")
+			if cmd, ok := hello.(*Command); !ok {
+				t.Errorf("got %T, want *Command", hello)
+			} else if cmd.Shell != tc.wantShell {
+				t.Errorf("got shell %q, want %q", cmd.Shell, tc.wantShell)
+			}
+
+			prog, _ := con.RegistryTarget("Prog")
+			if f, ok := prog.(*files); !ok {
+				t.Errorf("got %T, want *files", prog)
+			} else {
+				var want []string
+				for _, in := range tc.wantIn {
+					want = append(want, con.JoinPath(in))
+				}
+				if !reflect.DeepEqual(f.In, want) {
+					t.Errorf("got inputs %v, want %v", f.In, want)
+				}
+			}
+
+			sub, _ := con.RegistryTarget("sub/Sub")
+			if cmd, ok := sub.(*Command); !ok {
+				t.Errorf("got %T, want *Command", sub)
+			} else if want := []string{tc.wantSub}; !reflect.DeepEqual(cmd.Args, want) {
+				t.Errorf("got args %v, want %v", cmd.Args, want)
+			}
+		})
+	}
+}
+
+func TestVarsEnv(t *testing.T) {
+	t.Setenv("GREETING", "bonjour")
+
+	con := NewController(filepath.Join("_testdata", "vars"))
+	if err := con.ReadYAMLFile(""); err != nil {
+		t.Fatal(err)
+	}
+
+	hello, _ := con.RegistryTarget("Hello")
+	cmd, ok := hello.(*Command)
+	if !ok {
+		t.Fatalf("got %T, want *Command", hello)
+	}
+	if want := "echo bonjour ${UNDECLARED}"; cmd.Shell != want {
+		t.Errorf("got shell %q, want %q", cmd.Shell, want)
+	}
+
+	// Undeclared variables are not taken from the environment.
+	if _, ok := con.Var("HOME", ""); ok && os.Getenv("HOME") != "" {
+		t.Error("HOME is defined but should not be")
+	}
+}
+
+func TestOutTemplates(t *testing.T) {
+	t.Parallel()
+
+	const yml = `
+_vars:
+  DIST: dist
+
+App: !Files
+  In: [main.go]
+  Out: ['{{.DIST}}/{{.TargetName}}/{{.GOOS}}/app']
+  Target: !Command
+    Shell: go build -o {{.NotExpanded}} .
+
+Both: !All
+  - !Files
+    In: [a]
+    Out: ['{{.TargetName}}.out']
+    Target: !Command
+      Shell: true
+`
+
+	con := NewController("")
+	con.SetVar("GOOS", "plan9")
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	app, _ := con.RegistryTarget("App")
+	f, ok := app.(*files)
+	if !ok {
+		t.Fatalf("got %T, want *files", app)
+	}
+	if want := []string{"dist/App/plan9/app"}; !reflect.DeepEqual(f.Out, want) {
+		t.Errorf("got outputs %v, want %v", f.Out, want)
+	}
+	if cmd, ok := f.Target.(*Command); !ok {
+		t.Errorf("got %T, want *Command", f.Target)
+	} else if want := "go build -o {{.NotExpanded}} ."; cmd.Shell != want {
+		t.Errorf("got shell %q, want %q", cmd.Shell, want)
+	}
+
+	both, _ := con.RegistryTarget("Both")
+	a, ok := both.(*all)
+	if !ok {
+		t.Fatalf("got %T, want *all", both)
+	}
+	if f, ok := a.Targets[0].(*files); !ok {
+		t.Errorf("got %T, want *files", a.Targets[0])
+	} else if want := []string{"Both.out"}; !reflect.DeepEqual(f.Out, want) {
+		t.Errorf("got outputs %v, want %v", f.Out, want)
+	}
+
+	const bad = `
+Bad: !Files
+  In: [a]
+  Out: ['{{.Undefined}}']
+  Target: !Command
+    Shell: true
+`
+	if err := NewController("").ReadYAML(strings.NewReader(bad), ""); err == nil {
+		t.Error("got no error for template referring to an undefined variable")
+	}
+}
@@ -0,0 +1,84 @@
+package fab
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Volatile is an option for passing to [Files].
+// It marks the Files target as never up to date,
+// for the given reason,
+// so its subtarget runs every time the target does.
+// This is for a subtarget that depends on something other than its input files,
+// such as the time of day or the state of a remote service.
+// It is clearer than the common trick of listing a nonexistent input file.
+//
+// A volatile Files target still runs the targets that produce its input files first,
+// and its output files can still be inputs to other Files targets.
+// Its outputs are never saved to or restored from an [ArtifactStore].
+//
+// In YAML,
+// a Files target is made volatile by including a !Volatile entry in its In list,
+// whose value is the reason:
+//
+//	Stamp: !Files
+//	  Target: !Command
+//	    Shell: date > stamp.txt
+//	  In:
+//	    - !Volatile depends on the current time
+//	  Out:
+//	    - stamp.txt
+//
+// An empty reason does not make a target volatile.
+func Volatile(reason string) FilesOpt {
+	return func(f *files) {
+		f.volatile = reason
+	}
+}
+
+// yamlFilesIn parses the In list of a YAML Files node,
+// which may include !Volatile entries
+// (see [Volatile]).
+// It returns the input files and the reasons from the !Volatile entries.
+func (con *Controller) yamlFilesIn(node *yaml.Node, dir string) ([]string, []string, error) {
+	if node.Kind != yaml.SequenceNode || normalizeTag(node.Tag) != "" {
+		in, err := con.YAMLFileList(node, dir)
+		return in, nil, err
+	}
+
+	var (
+		nodes   []*yaml.Node
+		reasons []string
+	)
+	for _, child := range node.Content {
+		if normalizeTag(child.Tag) != "Volatile" {
+			nodes = append(nodes, child)
+			continue
+		}
+		if child.Kind != yaml.ScalarNode {
+			return nil, nil, BadYAMLNodeKindError{Got: child.Kind, Want: yaml.ScalarNode}
+		}
+		reason := strings.TrimSpace(child.Value)
+		if reason == "" {
+			return nil, nil, fmt.Errorf("!Volatile requires a reason")
+		}
+		reasons = append(reasons, reason)
+	}
+
+	in, err := con.YAMLFileListFromNodes(nodes, dir)
+	return in, reasons, err
+}
+
+// volatileDecoder reports the misuse of !Volatile
+// anywhere other than the In list of a Files target,
+// which is handled by [Controller.yamlFilesIn].
+func volatileDecoder(*Controller, *yaml.Node, string) ([]string, error) {
+	return nil, fmt.Errorf("!Volatile is allowed only in the In list of a Files target")
+}
+
+func init() {
+	RegisterYAMLStringList("Volatile", volatileDecoder)
+	SetYAMLTagDoc("Volatile", "In the In list of a Files target, mark the target as never up to date.")
+}
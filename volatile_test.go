@@ -0,0 +1,99 @@
+package fab
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bobg/go-generics/v2/set"
+)
+
+func TestVolatile(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		in  = filepath.Join(tmpdir, "in")
+		mid = filepath.Join(tmpdir, "mid")
+		out = filepath.Join(tmpdir, "out")
+		ctx = WithHashDB(context.Background(), memdb(set.New[string]()))
+	)
+	if err := os.WriteFile(in, []byte("x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each target appends to its output file,
+	// so the number of lines tells how many times it ran.
+	// The first one is found as the producer of mid.
+	Files(&Command{Shell: "cat in >> mid", Dir: tmpdir}, []string{in}, []string{mid})
+	volatile := Files(&Command{Shell: "cat mid >> out", Dir: tmpdir}, []string{mid}, []string{out}, Volatile("testing"))
+
+	for i := 0; i < 2; i++ {
+		if err := NewController(tmpdir).Run(ctx, volatile); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkLines := func(file string, want int) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(string(data), "\n"); got != want {
+			t.Errorf("got %d line(s) in %s, want %d", got, filepath.Base(file), want)
+		}
+	}
+	checkLines(mid, 1)
+	checkLines(out, 2)
+}
+
+func TestVolatileYAML(t *testing.T) {
+	t.Parallel()
+
+	const yml = `
+Stamp: !Files
+  Target: !Command
+    Shell: date > stamp.txt
+  In:
+    - a.txt
+    - !Volatile depends on the current time
+  Out:
+    - stamp.txt
+`
+
+	con := NewController("")
+	if err := con.ReadYAML(strings.NewReader(yml), ""); err != nil {
+		t.Fatal(err)
+	}
+	target, _ := con.RegistryTarget("Stamp")
+	ft, ok := target.(*files)
+	if !ok {
+		t.Fatalf("got %T, want *files", target)
+	}
+	if ft.volatile != "depends on the current time" {
+		t.Errorf("got volatile reason %q, want %q", ft.volatile, "depends on the current time")
+	}
+	if len(ft.In) != 1 || ft.In[0] != "a.txt" {
+		t.Errorf("got In %v, want [a.txt]", ft.In)
+	}
+
+	const bad = `
+Bad: !Files
+  Target: !Command
+    Shell: echo hello
+  In: !Glob
+    - !Volatile misplaced
+`
+
+	con = NewController("")
+	if err := con.ReadYAML(strings.NewReader(bad), ""); err == nil {
+		t.Error("got no error for misplaced !Volatile")
+	}
+}
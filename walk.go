@@ -0,0 +1,81 @@
+package fab
+
+import (
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
+)
+
+// subtargets returns the immediate subtargets of a target,
+// for those target types whose structure is known,
+// including those implementing [GraphChildren].
+// A [deferredResolutionTarget] is resolved,
+// and its subtarget is the target it resolves to.
+// The subtargets of a [Files] target
+// include any targets producing its input files.
+func (con *Controller) subtargets(target Target) ([]Target, error) {
+	switch t := target.(type) {
+	case *files:
+		result := []Target{t.Target}
+		for _, in := range t.In {
+			prereq, err := findPrereq(in)
+			if err != nil {
+				return nil, errors.Wrapf(err, "finding prerequisite for %s", in)
+			}
+			if prereq != nil {
+				result = append(result, prereq)
+			}
+		}
+		return result, nil
+
+	case *deferredResolutionTarget:
+		resolved, err := t.resolve(con)
+		if err != nil {
+			return nil, err
+		}
+		return []Target{resolved}, nil
+
+	case GraphChildren:
+		return t.Children(), nil
+	}
+
+	return nil, nil
+}
+
+// walk calls fn on each of the given targets and,
+// recursively,
+// on their subtargets (see [Controller.subtargets]).
+// Each target is visited only once,
+// even if it is reachable along more than one path.
+func (con *Controller) walk(targets []Target, fn func(Target) error) error {
+	seen := set.New[uintptr]()
+	return con.walkHelper(targets, seen, fn)
+}
+
+func (con *Controller) walkHelper(targets []Target, seen set.Of[uintptr], fn func(Target) error) error {
+	for _, target := range targets {
+		if target == nil {
+			continue
+		}
+		addr, err := targetAddr(target)
+		if err != nil {
+			return err
+		}
+		if seen.Has(addr) {
+			continue
+		}
+		seen.Add(addr)
+
+		if err := fn(target); err != nil {
+			return err
+		}
+
+		subs, err := con.subtargets(target)
+		if err != nil {
+			return errors.Wrapf(err, "getting subtargets of %s", con.Describe(target))
+		}
+		if err := con.walkHelper(subs, seen, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package fab
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/maps"
+	"github.com/bobg/go-generics/v2/set"
+)
+
+// WatchInterval is the polling interval used by the fab command in -watch mode.
+const WatchInterval = time.Second
+
+// Watch runs the given targets,
+// then watches the input files of any [Files] targets among them
+// (or among their subtargets),
+// and runs the targets again whenever any of those files changes.
+// It continues doing this until the context is canceled.
+//
+// Files are checked for changes by polling their sizes and modification times
+// every `interval`.
+// Directories among the input files are watched recursively.
+//
+// An error from running the targets is reported on standard output
+// but does not end the watch.
+// Each time the targets rerun,
+// con forgets the outcome of all previous runs,
+// so every target is eligible to run again.
+// (Files targets will still skip their subtargets
+// when their inputs and outputs are up to date.)
+func (con *Controller) Watch(ctx context.Context, interval time.Duration, targets ...Target) error {
+	verbose := GetVerbose(ctx)
+
+	for {
+		if err := con.Run(ctx, targets...); err != nil {
+			fmt.Printf("Error: %s\n", err)
+		}
+
+		inputs, err := con.watchInputs(targets)
+		if err != nil {
+			return errors.Wrap(err, "finding files to watch")
+		}
+		if len(inputs) == 0 {
+			return fmt.Errorf("no input files to watch")
+		}
+		if verbose {
+			con.Indentf("Watching %d file(s) for changes", len(inputs))
+		}
+
+		before, err := watchState(inputs)
+		if err != nil {
+			return errors.Wrap(err, "getting initial state of watched files")
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(interval):
+			}
+
+			after, err := watchState(inputs)
+			if err != nil {
+				return errors.Wrap(err, "getting state of watched files")
+			}
+			if changed := watchChanged(before, after); len(changed) > 0 {
+				if verbose {
+					con.Indentf("Change detected in %v, rerunning", changed)
+				}
+				break
+			}
+		}
+
+		con.forgetAll()
+	}
+}
+
+// forgetAll clears the controller's memory of targets that have run.
+func (con *Controller) forgetAll() {
+	con.mu.Lock()
+	con.ran = make(map[uintptr]*outcome)
+	con.mu.Unlock()
+}
+
+// watchInputs returns the sorted input files of all Files targets reachable from the given targets.
+func (con *Controller) watchInputs(targets []Target) ([]string, error) {
+	inputs := set.New[string]()
+	err := con.walk(targets, func(target Target) error {
+		if ip, ok := target.(InputsProvider); ok {
+			inputs.Add(ip.Inputs()...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := inputs.Slice()
+	sort.Strings(result)
+	return result, nil
+}
+
+type watchFileState struct {
+	size    int64
+	modtime time.Time
+}
+
+// watchState stats the given files,
+// recursing into directories.
+// Files that don't exist are absent from the result.
+func watchState(paths []string) (map[string]watchFileState, error) {
+	result := make(map[string]watchFileState)
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return errors.Wrapf(err, "statting %s", p)
+			}
+			result[p] = watchFileState{size: info.Size(), modtime: info.ModTime()}
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, errors.Wrapf(err, "walking %s", path)
+		}
+	}
+	return result, nil
+}
+
+// watchChanged returns the sorted list of files that differ between two results of watchState.
+func watchChanged(before, after map[string]watchFileState) []string {
+	changed := set.New[string]()
+	for path, b := range before {
+		a, ok := after[path]
+		if !ok || a.size != b.size || !a.modtime.Equal(b.modtime) {
+			changed.Add(path)
+		}
+	}
+	for _, path := range maps.Keys(after) {
+		if _, ok := before[path]; !ok {
+			changed.Add(path)
+		}
+	}
+	result := changed.Slice()
+	sort.Strings(result)
+	return result
+}
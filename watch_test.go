@@ -0,0 +1,77 @@
+package fab
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "fab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		indir  = filepath.Join(tmpdir, "in")
+		inpath = filepath.Join(indir, "file")
+	)
+	if err = os.Mkdir(indir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(inpath, []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		ct     = &countTarget{}
+		target = All(Files(ct, []string{indir}, nil))
+		con    = NewController("")
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = WithVerbose(ctx, testing.Verbose())
+
+	errch := make(chan error, 1)
+	go func() {
+		errch <- con.Watch(ctx, 10*time.Millisecond, target)
+	}()
+
+	waitFor := func(want uint32) {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadUint32(&ct.count) < want {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for count %d", want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitFor(1)
+
+	if err = os.WriteFile(inpath, []byte("foobar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(2)
+
+	// Adding a file to the watched directory also counts as a change.
+	if err = os.WriteFile(filepath.Join(indir, "file2"), []byte("baz"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(3)
+
+	cancel()
+	if err = <-errch; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
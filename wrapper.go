@@ -0,0 +1,77 @@
+package fab
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/bobg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// SetCommandWrapper sets the command wrapper
+// for every [Command] run by con.
+// The words of the wrapper are prepended to the command line of each Command,
+// so that e.g. the wrapper
+//
+//	nix develop --command
+//
+// causes the Command `go test ./...`
+// to run as
+//
+//	nix develop --command go test ./...
+//
+// A Command with NoWrapper set is run without the wrapper.
+// With no words,
+// SetCommandWrapper removes the wrapper.
+//
+// The wrapper may also be set in the top-level fab.yaml file
+// with the _wrapper declaration.
+// Its value is either a list of words,
+// or the special string `nix`,
+// meaning `nix develop TOPDIR --command`.
+//
+// Example:
+//
+//	_wrapper: [direnv, exec, .]
+func (con *Controller) SetCommandWrapper(words ...string) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	con.wrapper = words
+}
+
+// CommandWrapper returns the command wrapper
+// set with [Controller.SetCommandWrapper].
+func (con *Controller) CommandWrapper() []string {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	return con.wrapper
+}
+
+// readWrapperDecl handles the _wrapper declaration in a top-level fab.yaml file.
+// See [Controller.SetCommandWrapper].
+func (con *Controller) readWrapperDecl(node *yaml.Node, dir string) error {
+	if dir != "" {
+		return fmt.Errorf("_wrapper declaration is allowed only in the top-level YAML file")
+	}
+
+	if node.Kind == yaml.ScalarNode {
+		if node.Value != "nix" {
+			return fmt.Errorf("unknown wrapper %s", node.Value)
+		}
+		topdir, err := filepath.Abs(con.JoinPath())
+		if err != nil {
+			return errors.Wrap(err, "getting absolute path of top directory")
+		}
+		con.SetCommandWrapper("nix", "develop", topdir, "--command")
+		return nil
+	}
+
+	words, err := con.YAMLStringList(node, dir)
+	if err != nil {
+		return err
+	}
+	con.SetCommandWrapper(words...)
+	return nil
+}
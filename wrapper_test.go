@@ -0,0 +1,85 @@
+package fab
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommandWrapper(t *testing.T) {
+	t.Parallel()
+
+	con := NewController("")
+	con.SetCommandWrapper("env", "FOO=wrapped")
+
+	ctx := context.Background()
+
+	for _, noWrapper := range []bool{false, true} {
+		buf := new(bytes.Buffer)
+		cmd := &Command{
+			Shell:     "echo x${FOO}x",
+			Stdout:    buf,
+			NoWrapper: noWrapper,
+		}
+		if err := cmd.Run(ctx, con); err != nil {
+			t.Fatal(err)
+		}
+
+		want := "xwrappedx"
+		if noWrapper {
+			want = "xx"
+		}
+		if got := strings.TrimSpace(buf.String()); got != want {
+			t.Errorf("with NoWrapper %v got %q, want %q", noWrapper, got, want)
+		}
+	}
+}
+
+func TestWrapperDecl(t *testing.T) {
+	t.Parallel()
+
+	topdir, err := filepath.Abs("_testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		yaml    string
+		want    []string
+		wantErr bool
+	}{{
+		yaml: "_wrapper: nix",
+		want: []string{"nix", "develop", topdir, "--command"},
+	}, {
+		yaml: "_wrapper: [direnv, exec, .]",
+		want: []string{"direnv", "exec", "."},
+	}, {
+		yaml:    "_wrapper: bogus",
+		wantErr: true,
+	}}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.yaml, func(t *testing.T) {
+			t.Parallel()
+
+			con := NewController("_testdata")
+			err := con.ReadYAML(strings.NewReader(tc.yaml), "")
+			if tc.wantErr {
+				if err == nil {
+					t.Error("got no error, want one")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := con.CommandWrapper(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"sync"
 
 	"github.com/bobg/errors"
+	"github.com/bobg/go-generics/v2/set"
 	"github.com/bobg/go-generics/v2/slices"
 	"gopkg.in/yaml.v3"
 )
@@ -26,6 +27,7 @@ type (
 var (
 	yamlTargetRegistry     = newRegistry[YAMLTargetFunc]()
 	yamlStringListRegistry = newRegistry[YAMLStringListFunc]()
+	yamlTagDocs            = newRegistry[string]()
 )
 
 // RegisterYAMLTarget places a function in the YAML target registry with the given name.
@@ -34,6 +36,31 @@ func RegisterYAMLTarget(name string, fn YAMLTargetFunc) {
 	yamlTargetRegistry.add(name, fn)
 }
 
+// YAMLTargetTags returns the names in the YAML target registry
+// (see [RegisterYAMLTarget]),
+// in sorted order.
+// See also the registry subpackage.
+func YAMLTargetTags() []string {
+	return yamlTargetRegistry.names()
+}
+
+// SetYAMLTagDoc sets the documentation for the YAML tag with the given name
+// (see [RegisterYAMLTarget] and [RegisterYAMLStringList]),
+// for tools that describe the available tags.
+// By convention it is a sentence,
+// and it should be set in the same init function that registers the tag.
+func SetYAMLTagDoc(name, doc string) {
+	yamlTagDocs.add(name, doc)
+}
+
+// YAMLTagDoc returns the documentation
+// set with [SetYAMLTagDoc]
+// for the YAML tag with the given name.
+func YAMLTagDoc(name string) string {
+	doc, _ := yamlTagDocs.lookup(name)
+	return doc
+}
+
 // YAMLTarget parses a [Target] from a YAML node.
 // If the node has a tag `!foo`,
 // then the [YAMLTargetFunc] in the YAML target registry named `foo` is used to parse the node.
@@ -86,7 +113,7 @@ func (con *Controller) YAMLTarget(node *yaml.Node, dir string) (Target, error) {
 	}
 
 	// TODO: try to resolve now?
-	return &deferredResolutionTarget{Name: qname}, nil
+	return &deferredResolutionTarget{Name: con.renameYAMLRef(qname)}, nil
 }
 
 type deferredResolutionTarget struct {
@@ -152,38 +179,110 @@ func (dt *deferredResolutionTarget) Desc() string {
 //
 //	Test: !Command
 //	  - go test ./...
+//
+// An entry may also be an untyped mapping
+// with the target in its Target field
+// and registration options (see [Controller.Register]) beside it:
+// Doc, a doc string
+// (overriding the one taken from a comment);
+// Tags, a tag or a list of them (see [WithTags]);
+// Hidden, a boolean (see [WithHidden]);
+// Aliases, a list of short names (see [WithAliases]);
+// and Params, a list of command-line parameters (see [WithParams]).
+//
+//	Lint:
+//	  Doc: Run the linters.
+//	  Tags: [lint, ci]
+//	  Aliases: [l]
+//	  Target: !Command
+//	    Shell: golangci-lint run ./...
 func (con *Controller) ReadYAML(r io.Reader, dir string) error {
+	m, err := decodeYAMLMapping(r)
+	if err != nil {
+		return err
+	}
+
+	// Bare target names in this file
+	// are not renamed by any file that is including another one.
+	// See includeYAMLFile.
+	old := con.swapYAMLRenames(nil)
+	defer con.swapYAMLRenames(old)
+
+	sawDirDecl, err := con.readYAMLMapping(m, dir, con.JoinPath(dir), "", nil)
+	if err != nil {
+		return err
+	}
+
+	if dir != "" && !sawDirDecl {
+		return fmt.Errorf("no _dir declaration in YAML file")
+	}
+
+	return nil
+}
+
+// decodeYAMLMapping decodes a YAML document
+// whose top level must be a mapping,
+// and returns that mapping node.
+func decodeYAMLMapping(r io.Reader) (*yaml.Node, error) {
 	var (
 		dec = yaml.NewDecoder(r)
 		doc yaml.Node
 	)
 
 	if err := dec.Decode(&doc); err != nil {
-		return errors.Wrap(err, "decoding YAML")
+		return nil, errors.Wrap(err, "decoding YAML")
 	}
 
 	if doc.Kind != yaml.DocumentNode {
-		return errors.Wrap(BadYAMLNodeKindError{Got: doc.Kind, Want: yaml.DocumentNode}, "at top level")
+		return nil, errors.Wrap(BadYAMLNodeKindError{Got: doc.Kind, Want: yaml.DocumentNode}, "at top level")
 	}
 	if len(doc.Content) != 1 {
-		return fmt.Errorf("got %d children of top-level node, want 1", len(doc.Content))
+		return nil, fmt.Errorf("got %d children of top-level node, want 1", len(doc.Content))
 	}
 
 	m := doc.Content[0]
 	if m.Kind != yaml.MappingNode {
-		return errors.Wrap(BadYAMLNodeKindError{Got: m.Kind, Want: yaml.MappingNode}, "at document second level")
+		return nil, errors.Wrap(BadYAMLNodeKindError{Got: m.Kind, Want: yaml.MappingNode}, "at document second level")
 	}
 
 	if len(m.Content)%2 != 0 {
-		return fmt.Errorf("got %d children for second-level node, want an even number", len(m.Content))
+		return nil, fmt.Errorf("got %d children for second-level node, want an even number", len(m.Content))
 	}
 
+	return m, nil
+}
+
+// readYAMLMapping registers the targets in m,
+// the top-level mapping of a YAML file,
+// and handles its declarations.
+// It reports whether there was a _dir declaration.
+//
+// The dir argument is the directory relative to con's top directory
+// whose namespace the targets go in,
+// and filedir is the directory containing the YAML file
+// (which is different from dir for included files).
+// Each target name gets the given prefix.
+// The including argument is the list of included files being read,
+// outermost first
+// (empty when m is not from an included file).
+// See readIncludeDecl.
+func (con *Controller) readYAMLMapping(m *yaml.Node, dir, filedir, prefix string, including []string) (bool, error) {
 	var sawDirDecl bool
 
+	// Handle any _vars declaration first,
+	// so that its variables are available throughout the file.
+	for i := 0; i < len(m.Content); i += 2 {
+		if nameNode := m.Content[i]; nameNode.Kind == yaml.ScalarNode && nameNode.Value == "_vars" {
+			if err := con.readVarsDecl(m.Content[i+1], dir); err != nil {
+				return false, errors.Wrap(err, "in _vars declaration")
+			}
+		}
+	}
+
 	for i := 0; i < len(m.Content); i += 2 {
 		nameNode := m.Content[i]
 		if nameNode.Kind != yaml.ScalarNode {
-			return errors.Wrapf(BadYAMLNodeKindError{Got: nameNode.Kind, Want: yaml.ScalarNode}, "in entry %d", i)
+			return false, errors.Wrapf(BadYAMLNodeKindError{Got: nameNode.Kind, Want: yaml.ScalarNode}, "in entry %d", i)
 		}
 
 		var (
@@ -196,44 +295,185 @@ func (con *Controller) ReadYAML(r io.Reader, dir string) error {
 		doc = strings.TrimLeft(doc, "# ")
 
 		if name == "_dir" {
+			if len(including) > 0 {
+				return false, fmt.Errorf("_dir declaration not allowed in included file")
+			}
 			decl := m.Content[i+1]
 			if decl.Kind != yaml.ScalarNode {
-				return fmt.Errorf("_dir declaration value has kind %v, want %v", decl.Kind, yaml.ScalarNode)
+				return false, fmt.Errorf("_dir declaration value has kind %v, want %v", decl.Kind, yaml.ScalarNode)
 			}
 			if decl.Value != dir {
-				return fmt.Errorf("_dir declaration %s does not match actual directory %s", decl.Value, dir)
+				return false, fmt.Errorf("_dir declaration %s does not match actual directory %s", decl.Value, dir)
 			}
 			sawDirDecl = true
 			continue
 		}
 
+		if name == "_projects" {
+			if err := con.readProjectsDecl(m.Content[i+1], dir); err != nil {
+				return false, errors.Wrap(err, "in _projects declaration")
+			}
+			continue
+		}
+
+		if name == "_vars" {
+			continue
+		}
+
+		if name == "_default" {
+			if err := con.readDefaultDecl(m.Content[i+1], dir); err != nil {
+				return false, errors.Wrap(err, "in _default declaration")
+			}
+			continue
+		}
+
+		if name == "_aliases" {
+			if err := con.readAliasesDecl(m.Content[i+1], dir); err != nil {
+				return false, errors.Wrap(err, "in _aliases declaration")
+			}
+			continue
+		}
+
+		if name == "_wrapper" {
+			if err := con.readWrapperDecl(m.Content[i+1], dir); err != nil {
+				return false, errors.Wrap(err, "in _wrapper declaration")
+			}
+			continue
+		}
+
+		if name == "_clean_env" {
+			if err := con.readCleanEnvDecl(m.Content[i+1], dir); err != nil {
+				return false, errors.Wrap(err, "in _clean_env declaration")
+			}
+			continue
+		}
+
+		if name == "_secrets" {
+			if err := con.readSecretsDecl(m.Content[i+1], dir); err != nil {
+				return false, errors.Wrap(err, "in _secrets declaration")
+			}
+			continue
+		}
+
+		if name == "_include" {
+			if err := con.readIncludeDecl(m.Content[i+1], dir, filedir, prefix, including); err != nil {
+				return false, errors.Wrap(err, "in _include declaration")
+			}
+			continue
+		}
+
 		if strings.Contains(name, "/") {
-			return fmt.Errorf("no slashes in target names")
+			return false, fmt.Errorf("no slashes in target names")
+		}
+
+		targetNode := con.interpolateYAML(m.Content[i+1], dir)
+		targetNode, err := expandOutTemplates(targetNode, con.outTemplateData(prefix+name, dir))
+		if err != nil {
+			return false, errors.Wrapf(err, "in YAML node for %s", name)
+		}
+
+		if normalizeTag(targetNode.Tag) == "Include" {
+			if err := con.includeTagged(targetNode, dir, filedir, prefix+name+".", including); err != nil {
+				return false, errors.Wrapf(err, "in YAML node for %s", name)
+			}
+			continue
+		}
+
+		targetNode, opts, err := yamlTargetEntry(targetNode)
+		if err != nil {
+			return false, errors.Wrapf(err, "in YAML node for %s", name)
 		}
 
-		targetNode := m.Content[i+1]
 		target, err := con.YAMLTarget(targetNode, dir)
 		if err != nil {
-			return errors.Wrapf(err, "in YAML node for %s", name)
+			return false, errors.Wrapf(err, "in YAML node for %s", name)
 		}
 
 		// The following was previously inside a "if target is not a deferredResolutionTarget" block,
 		// but I think that was wrong.
 		// Or maybe I'm wrong now...
 
-		qname := filepath.Join(dir, name)
+		qname := filepath.Join(dir, prefix+name)
 
-		_, err = con.RegisterTarget(qname, doc, target)
+		_, err = con.RegisterTarget(qname, doc, target, opts...)
 		if err != nil {
-			return errors.Wrapf(err, "registering target %s", qname)
+			return false, errors.Wrapf(err, "registering target %s", qname)
 		}
 	}
 
-	if dir != "" && !sawDirDecl {
-		return fmt.Errorf("no _dir declaration in YAML file")
+	return sawDirDecl, nil
+}
+
+// yamlTargetEntry handles the untyped mapping form of a YAML target entry,
+// which has a Target field for the target itself
+// and other fields for registration options.
+// It returns the target node and the options.
+// Any other node is returned unchanged, with no options.
+// See [Controller.ReadYAML].
+func yamlTargetEntry(node *yaml.Node) (*yaml.Node, []RegisterOption, error) {
+	if node.Kind != yaml.MappingNode || normalizeTag(node.Tag) != "" {
+		return node, nil, nil
 	}
 
-	return nil
+	var (
+		target *yaml.Node
+		opts   []RegisterOption
+	)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i].Value, node.Content[i+1]
+		switch key {
+		case "Target":
+			target = val
+
+		case "Doc":
+			var doc string
+			if err := val.Decode(&doc); err != nil {
+				return nil, nil, errors.Wrap(err, "decoding Doc")
+			}
+			opts = append(opts, WithDoc(doc))
+
+		case "Tags", "Aliases":
+			var names []string
+			switch val.Kind {
+			case yaml.ScalarNode:
+				names = []string{val.Value}
+			case yaml.SequenceNode:
+				if err := val.Decode(&names); err != nil {
+					return nil, nil, errors.Wrapf(err, "decoding %s", key)
+				}
+			default:
+				return nil, nil, errors.Wrapf(BadYAMLNodeKindError{Got: val.Kind, Want: yaml.SequenceNode}, "in %s", key)
+			}
+			if key == "Tags" {
+				opts = append(opts, WithTags(names...))
+			} else {
+				opts = append(opts, WithAliases(names...))
+			}
+
+		case "Params":
+			params, err := yamlParams(val)
+			if err != nil {
+				return nil, nil, err
+			}
+			opts = append(opts, WithParams(params...))
+
+		case "Hidden":
+			var hidden bool
+			if err := val.Decode(&hidden); err != nil {
+				return nil, nil, errors.Wrap(err, "decoding Hidden")
+			}
+			if hidden {
+				opts = append(opts, WithHidden())
+			}
+
+		default:
+			return nil, nil, fmt.Errorf("unknown field %s in untyped target entry", key)
+		}
+	}
+	if target == nil {
+		return nil, nil, fmt.Errorf("no Target in untyped target entry")
+	}
+	return target, opts, nil
 }
 
 // ReadYAMLFile calls ReadYAML
@@ -256,10 +496,31 @@ func (con *Controller) ReadYAMLFile(dir string) error {
 		rel = ""
 	}
 
+	con.mu.Lock()
+	if con.yamlDirs == nil {
+		con.yamlDirs = set.New[string]()
+	}
+	con.yamlDirs.Add(rel)
+	con.mu.Unlock()
+
+	con.addYAMLFile(f.Name())
+
 	err = con.ReadYAML(f, rel)
 	return errors.Wrapf(err, "reading YAML file in %s", dir)
 }
 
+// addYAMLFile records the name of a YAML file that has been read.
+// See RunRemote.
+func (con *Controller) addYAMLFile(filename string) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+
+	if con.yamlFiles == nil {
+		con.yamlFiles = set.New[string]()
+	}
+	con.yamlFiles.Add(filename)
+}
+
 func openFabYAML(dir string) (*os.File, error) {
 	filename := filepath.Join(dir, "fab.yaml")
 	f, err := os.Open(filename)
@@ -276,6 +537,14 @@ func RegisterYAMLStringList(name string, fn YAMLStringListFunc) {
 	yamlStringListRegistry.add(name, fn)
 }
 
+// YAMLStringListTags returns the names in the YAML string-list registry
+// (see [RegisterYAMLStringList]),
+// in sorted order.
+// See also the registry subpackage.
+func YAMLStringListTags() []string {
+	return yamlStringListRegistry.names()
+}
+
 // YAMLStringList parses a []string from a YAML node.
 // If the node has a tag `!foo`,
 // then the [YAMLStringListFunc] in the YAML string-list registry named `foo` is used to parse the node.